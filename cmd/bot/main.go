@@ -2,17 +2,32 @@ package main
 
 import (
 	"context"
-	"github.com/profectus200/contact-book-bot/cmd/logging"
-	"github.com/profectus200/contact-book-bot/cmd/tracing"
-	"go.uber.org/zap"
+	"log"
 	"os"
 	"os/signal"
+	// Time zones of the users are looked up in the embedded database, as the image has none.
+	_ "time/tzdata"
 
+	"go.uber.org/zap"
+
+	"github.com/profectus200/contact-book-bot/cmd/logging"
+	"github.com/profectus200/contact-book-bot/cmd/tracing"
 	"github.com/profectus200/contact-book-bot/internal/clients/tg"
 	"github.com/profectus200/contact-book-bot/internal/config"
 	"github.com/profectus200/contact-book-bot/internal/database"
+	"github.com/profectus200/contact-book-bot/internal/model/access"
+	"github.com/profectus200/contact-book-bot/internal/model/account"
+	"github.com/profectus200/contact-book-bot/internal/model/admin"
+	"github.com/profectus200/contact-book-bot/internal/model/api"
+	"github.com/profectus200/contact-book-bot/internal/model/calendar"
 	"github.com/profectus200/contact-book-bot/internal/model/callbacks"
+	"github.com/profectus200/contact-book-bot/internal/model/carddav"
+	"github.com/profectus200/contact-book-bot/internal/model/conversation"
+	"github.com/profectus200/contact-book-bot/internal/model/flows"
 	"github.com/profectus200/contact-book-bot/internal/model/messages"
+	"github.com/profectus200/contact-book-bot/internal/model/reminders"
+	"github.com/profectus200/contact-book-bot/internal/model/webhooks"
+	"github.com/profectus200/contact-book-bot/internal/server"
 	"github.com/profectus200/contact-book-bot/internal/worker"
 )
 
@@ -20,34 +35,71 @@ func main() {
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, os.Kill)
 	defer cancel()
 
-	logger := logging.InitLogger()
-	tracing.InitTracing("actions_handler", logger)
-
-	logger.Info("Initializing config")
 	config, err := config.New()
 	if err != nil {
-		logger.Fatal("Cannot create config", zap.Error(err))
+		log.Fatal("cannot create config ", err)
 	}
 
-	logger.Info("Initializing database")
-	db, err := database.New(config)
+	logger := logging.InitLogger(config)
+	defer logger.Sync()
+
+	tracing.InitTracing("actions_handler", logger)
+
+	logger.Info("Initializing storage", zap.String("driver", config.StorageDriver()))
+	storage, err := database.Open(config)
 	if err != nil {
-		logger.Fatal("Cannot create database", zap.Error(err))
+		logger.Fatal("Cannot open storage", zap.Error(err))
 	}
-
-	contactsDB := database.NewContactsDB(db)
-	usersDB := database.NewUsersDB(db)
+	defer storage.Close()
 
 	logger.Info("Initializing tg client")
-	tgClient, err := tg.New(config)
+	codec := callbacks.NewCodec(config.CallbackSecret())
+	tgClient, err := tg.New(config, codec, tg.NewLimiter(tg.BotAPILimits), logger)
 	if err != nil {
 		logger.Fatal("Cannot create new tg client", zap.Error(err))
 	}
 
-	msgModel := messages.New(tgClient, contactsDB, usersDB)
-	callbackModel := callbacks.New(tgClient, contactsDB, usersDB)
+	engine := conversation.New(tgClient, storage.Users, storage.Settings, storage.Tx, logger)
+	conversations := flows.New(engine, tgClient, storage.Contacts, storage.Settings, storage.Webhooks, logger)
+
+	accessModel, err := access.New(tgClient, storage.Access, storage.Users, storage.Tx, config, logger)
+	if err != nil {
+		logger.Fatal("Cannot read access policy", zap.Error(err))
+	}
+
+	calendarModel := calendar.New(tgClient, storage.Contacts, storage.Users, storage.Settings, accessModel, config.PublicURL(), logger)
+	carddavModel := carddav.New(tgClient, storage.Contacts, storage.Users, storage.Tx, accessModel, config.PublicURL(), logger)
+	apiModel := api.New(tgClient, storage.Contacts, storage.Users, storage.Tx, accessModel, config.PublicURL(), logger)
+	webhookModel := webhooks.New(tgClient, storage.Webhooks, webhooks.NewHTTPClient(config.WebhooksAllowPrivate()), logger)
+	accountModel := account.New(tgClient, storage.Contacts, storage.Users, storage.Settings, storage.Webhooks, storage.Access, storage.Tx, logger)
+	adminModel := admin.New(tgClient, storage.Users, config.Admins(), admin.BroadcastInterval, logger)
 
-	updateListenerWorker := worker.NewUpdateListenerWorker(tgClient, msgModel, callbackModel)
+	msgModel := messages.New(tgClient, storage.Contacts, conversations, calendarModel, carddavModel, apiModel, webhookModel, accountModel, adminModel, accessModel, logger)
+	callbackModel := callbacks.New(tgClient, storage.Contacts, storage.Users, storage.Settings, storage.Tx, conversations, calendarModel, webhookModel, accountModel, codec, logger)
+	reminderModel := reminders.New(tgClient, storage.Contacts, storage.Users, storage.Settings, logger)
+
+	updateListenerWorker := worker.NewUpdateListenerWorker(tgClient, msgModel, callbackModel, storage.Settings, storage.Users, accessModel, logger)
+	conversationTimeoutWorker := worker.NewConversationTimeoutWorker(engine, worker.ConversationTimeoutInterval, logger)
+	reminderWorker := worker.NewReminderWorker(reminderModel, worker.ReminderInterval, logger)
+	webhookWorker := worker.NewWebhookWorker(webhookModel, worker.WebhookInterval, logger)
+
+	go conversationTimeoutWorker.Run(ctx)
+	go reminderWorker.Run(ctx)
+	go webhookWorker.Run(ctx)
+
+	if config.HTTPAddr() != "" {
+		srv := server.New(config.HTTPAddr(), logger)
+		srv.Handle(calendar.PathPrefix, calendarModel)
+		srv.Handle(carddav.PathPrefix, carddavModel)
+		srv.Handle(carddav.WellKnownPath, carddavModel)
+		srv.Handle(api.PathPrefix, apiModel)
+
+		go func() {
+			if err := srv.Run(ctx); err != nil {
+				logger.Error("HTTP server stopped", zap.Error(err))
+			}
+		}()
+	}
 
 	updateListenerWorker.Run(ctx)
 }
@@ -1,15 +1,62 @@
 package logging
 
 import (
-	"go.uber.org/zap"
+	"context"
 	"log"
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	formatJSON    = "json"
+	formatConsole = "console"
 )
 
-func InitLogger() *zap.Logger {
-	logger, err := zap.NewProduction()
+type settingsGetter interface {
+	LogLevel() string
+	LogFormat() string
+}
+
+func InitLogger(settings settingsGetter) *zap.Logger {
+	var cfg zap.Config
+	switch strings.ToLower(settings.LogFormat()) {
+	case formatConsole:
+		cfg = zap.NewDevelopmentConfig()
+	case formatJSON, "":
+		cfg = zap.NewProductionConfig()
+	default:
+		log.Fatal("unknown log format ", settings.LogFormat())
+	}
+
+	if settings.LogLevel() != "" {
+		level, err := zapcore.ParseLevel(settings.LogLevel())
+		if err != nil {
+			log.Fatal("cannot parse log level ", err)
+		}
+		cfg.Level = zap.NewAtomicLevelAt(level)
+	}
+
+	logger, err := cfg.Build()
 	if err != nil {
 		log.Fatal("cannot init logger ", err)
 	}
 
 	return logger
 }
+
+type loggerKey struct{}
+
+// WithLogger returns a copy of ctx carrying the logger with per-update fields.
+func WithLogger(ctx context.Context, logger *zap.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// FromContext returns the logger stored in ctx, or fallback if there is none.
+func FromContext(ctx context.Context, fallback *zap.Logger) *zap.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*zap.Logger); ok {
+		return logger
+	}
+	return fallback
+}
@@ -0,0 +1,58 @@
+package logging
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+)
+
+// Contact data is personal, so it never goes to the logs as is.
+// These helpers keep just enough of a value to tell two entries apart.
+
+// Name returns a field with the name masked except for its first letter.
+func Name(key, name string) zap.Field {
+	return zap.String(key, maskName(name))
+}
+
+// Phone returns a field with the phone masked except for its last two digits.
+func Phone(key, phone string) zap.Field {
+	return zap.String(key, maskPhone(phone))
+}
+
+// Email returns a field with the mailbox masked like a name and the domain kept.
+func Email(key, email string) zap.Field {
+	mailbox, domain, ok := strings.Cut(email, "@")
+	if !ok {
+		return zap.String(key, maskName(email))
+	}
+	return zap.String(key, maskName(mailbox)+"@"+domain)
+}
+
+// Text returns a field with the length of a free-form user input instead of the input itself.
+func Text(key, text string) zap.Field {
+	return zap.Int(key+"_len", utf8.RuneCountInString(text))
+}
+
+func maskName(name string) string {
+	if name == "" {
+		return ""
+	}
+
+	first, _ := utf8.DecodeRuneInString(name)
+	return string(first) + strings.Repeat("*", utf8.RuneCountInString(name)-1)
+}
+
+func maskPhone(phone string) string {
+	digits := make([]rune, 0, len(phone))
+	for _, r := range phone {
+		if r >= '0' && r <= '9' {
+			digits = append(digits, r)
+		}
+	}
+
+	if len(digits) <= 2 {
+		return strings.Repeat("*", len(digits))
+	}
+	return strings.Repeat("*", len(digits)-2) + string(digits[len(digits)-2:])
+}
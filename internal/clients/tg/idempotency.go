@@ -0,0 +1,71 @@
+package tg
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// sentTTL is how long a delivered key is remembered.
+	sentTTL = 48 * time.Hour
+	// sentPruneSize is the number of remembered keys after which the expired ones are dropped.
+	sentPruneSize = 4096
+)
+
+// sentKeys remembers the idempotency keys of delivered messages, so that a message
+// queued twice, e.g. by overlapping runs of a scheduler, is sent once.
+type sentKeys struct {
+	mu       sync.Mutex
+	sent     map[string]time.Time
+	inFlight map[string]struct{}
+}
+
+func newSentKeys() *sentKeys {
+	return &sentKeys{
+		sent:     make(map[string]time.Time),
+		inFlight: make(map[string]struct{}),
+	}
+}
+
+// Reserve returns false if the message with the key was already delivered or is being
+// delivered right now. Otherwise the caller must call Done or Release afterwards.
+func (k *sentKeys) Reserve(key string) bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if _, ok := k.inFlight[key]; ok {
+		return false
+	}
+	if sentAt, ok := k.sent[key]; ok && time.Since(sentAt) < sentTTL {
+		return false
+	}
+
+	k.inFlight[key] = struct{}{}
+	return true
+}
+
+// Done marks the message with the key as delivered.
+func (k *sentKeys) Done(key string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	delete(k.inFlight, key)
+	k.sent[key] = time.Now()
+
+	if len(k.sent) < sentPruneSize {
+		return
+	}
+	for sentKey, sentAt := range k.sent {
+		if time.Since(sentAt) >= sentTTL {
+			delete(k.sent, sentKey)
+		}
+	}
+}
+
+// Release lets the message with the key be delivered again after a failed attempt.
+func (k *sentKeys) Release(key string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	delete(k.inFlight, key)
+}
@@ -2,22 +2,212 @@ package tg
 
 import (
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/profectus200/contact-book-bot/internal/i18n"
 	"github.com/profectus200/contact-book-bot/internal/model/callbacks"
+	"github.com/profectus200/contact-book-bot/internal/types"
 )
 
-var editContactKeyboard = tgbotapi.NewInlineKeyboardMarkup(
-	tgbotapi.NewInlineKeyboardRow(
-		tgbotapi.NewInlineKeyboardButtonData("Change name", callbacks.ChangeContactName),
-		tgbotapi.NewInlineKeyboardButtonData("Change phone", callbacks.ChangeContactPhone),
-	),
-	tgbotapi.NewInlineKeyboardRow(
-		tgbotapi.NewInlineKeyboardButtonData("Change birthday", callbacks.ChangeContactBirthday),
-		tgbotapi.NewInlineKeyboardButtonData("Change description", callbacks.ChangeContactDescription),
-	),
-	tgbotapi.NewInlineKeyboardRow(
-		tgbotapi.NewInlineKeyboardButtonData("Delete contact", callbacks.DeleteContact),
-	),
-	tgbotapi.NewInlineKeyboardRow(
-		tgbotapi.NewInlineKeyboardButtonData("Save", callbacks.ChangeContactDone),
-	),
-)
+// buttons makes the buttons of a keyboard sent to a user, with the data signed for the user.
+type buttons struct {
+	codec  callbackEncoder
+	userID int64
+}
+
+func (c *Client) buttons(userID int64) buttons {
+	return buttons{codec: c.codec, userID: userID}
+}
+
+func (b buttons) button(text string, payload callbacks.Payload) tgbotapi.InlineKeyboardButton {
+	return tgbotapi.NewInlineKeyboardButtonData(text, b.codec.Encode(b.userID, payload))
+}
+
+func (b buttons) card(text string, action callbacks.Action, contactID int) tgbotapi.InlineKeyboardButton {
+	return b.button(text, callbacks.CardPayload(action, contactID))
+}
+
+func (b buttons) action(text string, action callbacks.Action) tgbotapi.InlineKeyboardButton {
+	return b.button(text, callbacks.Payload{Action: action})
+}
+
+// editContactKeyboard is the keyboard of the card of the contact, 0 for a new contact.
+// A new contact may also be filled in step by step.
+func (b buttons) editContactKeyboard(contactID int, lang i18n.Lang) tgbotapi.InlineKeyboardMarkup {
+	rows := [][]tgbotapi.InlineKeyboardButton{
+		tgbotapi.NewInlineKeyboardRow(
+			b.card(lang.T(i18n.ButtonChangeName), callbacks.ChangeContactName, contactID),
+			b.card(lang.T(i18n.ButtonChangePhone), callbacks.ChangeContactPhone, contactID),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			b.card(lang.T(i18n.ButtonChangeEmail), callbacks.ChangeContactEmail, contactID),
+			b.card(lang.T(i18n.ButtonChangeBirthday), callbacks.ChangeContactBirthday, contactID),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			b.card(lang.T(i18n.ButtonChangeDescription), callbacks.ChangeContactDescription, contactID),
+			b.card(lang.T(i18n.ButtonChangePhoto), callbacks.ChangeContactPhoto, contactID),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			b.card(lang.T(i18n.ButtonAddField), callbacks.AddCustomField, contactID),
+			b.card(lang.T(i18n.ButtonAddDate), callbacks.AddEvent, contactID),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			b.card(lang.T(i18n.ButtonLogInteraction), callbacks.LogInteraction, contactID),
+			b.card(lang.T(i18n.ButtonRemind), callbacks.AddReminder, contactID),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			b.card(lang.T(i18n.ButtonDelete), callbacks.DeleteContact, contactID),
+		),
+	}
+	if contactID == 0 {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			b.card(lang.T(i18n.ButtonWizard), callbacks.StartWizard, contactID),
+		))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		b.card(lang.T(i18n.ButtonSave), callbacks.ChangeContactDone, contactID),
+	))
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+// summaryKeyboard is under the contact added with the wizard.
+func (b buttons) summaryKeyboard(contactID int, lang i18n.Lang) tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			b.card(lang.T(i18n.ButtonEdit), callbacks.EditContactCard, contactID),
+			b.card(lang.T(i18n.ButtonConfirm), callbacks.ConfirmContact, contactID),
+		),
+	)
+}
+
+// duplicatesKeyboard is under the pair of /duplicates with the given number: either contact
+// may be kept, or the pair skipped.
+func (b buttons) duplicatesKeyboard(dup types.Duplicate, page int, lang i18n.Lang) tgbotapi.InlineKeyboardMarkup {
+	first, second := dup.First.ContactID, dup.Second.ContactID
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			b.button(lang.T(i18n.ButtonMergeInto, first), callbacks.MergePayload(first, second, page)),
+			b.button(lang.T(i18n.ButtonMergeInto, second), callbacks.MergePayload(second, first, page)),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			b.button(lang.T(i18n.ButtonSkip), callbacks.Payload{Action: callbacks.ShowDuplicates, Page: page + 1}),
+		),
+	)
+}
+
+// nextDuplicatesKeyboard goes on to the pair with the given number.
+func (b buttons) nextDuplicatesKeyboard(page int, lang i18n.Lang) tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			b.button(lang.T(i18n.ButtonNext), callbacks.Payload{Action: callbacks.ShowDuplicates, Page: page}),
+		),
+	)
+}
+
+// reminderKeyboard is under a delivered reminder.
+func (b buttons) reminderKeyboard(reminderID int, lang i18n.Lang) tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			b.button(lang.T(i18n.ButtonSnooze), callbacks.ReminderPayload(callbacks.SnoozeReminder, reminderID)),
+			b.button(lang.T(i18n.ButtonReminderDone), callbacks.ReminderPayload(callbacks.CompleteReminder, reminderID)),
+		),
+	)
+}
+
+// remindersKeyboard cancels the reminders of /reminders, by their numbers in the list.
+func (b buttons) remindersKeyboard(reminders []types.Reminder, lang i18n.Lang) tgbotapi.InlineKeyboardMarkup {
+	rows := numberedRows(len(reminders), func(i int) tgbotapi.InlineKeyboardButton {
+		return b.button(lang.T(i18n.ButtonCancelReminder, i+1), callbacks.ReminderPayload(callbacks.CancelReminder, reminders[i].ID))
+	})
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+// numberedRows lays out the buttons of the items of a numbered list three in a row.
+func numberedRows(n int, button func(i int) tgbotapi.InlineKeyboardButton) [][]tgbotapi.InlineKeyboardButton {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for start := 0; start < n; start += 3 {
+		var row []tgbotapi.InlineKeyboardButton
+		for i := start; i < n && i < start+3; i++ {
+			row = append(row, button(i))
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// calendarKeyboard is under the /calendar link, a new link is offered only when there is one.
+func (b buttons) calendarKeyboard(hasLink bool, lang i18n.Lang) tgbotapi.InlineKeyboardMarkup {
+	row := tgbotapi.NewInlineKeyboardRow(
+		b.action(lang.T(i18n.ButtonCalendarFile), callbacks.CalendarFile),
+	)
+	if hasLink {
+		row = append(row, b.action(lang.T(i18n.ButtonCalendarReset), callbacks.CalendarReset))
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(row)
+}
+
+// webhooksKeyboard removes the webhooks of /webhooks by their numbers in the list,
+// and adds one while the user has fewer than allowed.
+func (b buttons) webhooksKeyboard(webhooks []types.Webhook, lang i18n.Lang) tgbotapi.InlineKeyboardMarkup {
+	rows := numberedRows(len(webhooks), func(i int) tgbotapi.InlineKeyboardButton {
+		return b.button(lang.T(i18n.ButtonRemoveWebhook, i+1), callbacks.WebhookPayload(webhooks[i].ID))
+	})
+	if len(webhooks) < types.MaxWebhooks {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(b.action(lang.T(i18n.ButtonAddWebhook), callbacks.WebhookAdd)))
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+// deleteAccountKeyboard is under the question of /delete_account.
+func (b buttons) deleteAccountKeyboard(lang i18n.Lang) tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		b.action(lang.T(i18n.ButtonDeleteAccount), callbacks.DeleteAccount),
+		b.action(lang.T(i18n.ButtonKeepAccount), callbacks.KeepAccount),
+	))
+}
+
+// languageKeyboard offers every supported language, each named in itself.
+func (b buttons) languageKeyboard() tgbotapi.InlineKeyboardMarkup {
+	row := make([]tgbotapi.InlineKeyboardButton, 0, len(i18n.Languages))
+	for _, lang := range i18n.Languages {
+		row = append(row, b.button(lang.Name(), callbacks.SetLanguagePayload(lang)))
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(row)
+}
+
+// settingsKeyboard is the /settings menu. Field buttons show whether lists show the field.
+func (b buttons) settingsKeyboard(settings types.Settings, lang i18n.Lang) tgbotapi.InlineKeyboardMarkup {
+	rows := [][]tgbotapi.InlineKeyboardButton{
+		tgbotapi.NewInlineKeyboardRow(
+			b.action(lang.T(i18n.ButtonLanguage), callbacks.SettingsLanguage),
+			b.action(lang.T(i18n.ButtonTimezone), callbacks.SettingsTimezone),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			b.action(lang.T(i18n.ButtonPhoneRegion), callbacks.SettingsPhoneRegion),
+			b.action(lang.T(i18n.ButtonReminderTime), callbacks.SettingsReminderTime),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			b.action(lang.T(i18n.ButtonSortOrder, settings.SortOrder.Name(lang)), callbacks.SettingsSortOrder),
+			b.action(lang.T(i18n.ButtonStaleDays), callbacks.SettingsStaleDays),
+		),
+	}
+
+	var row []tgbotapi.InlineKeyboardButton
+	for _, field := range types.CardFields {
+		label := lang.T(i18n.ButtonFieldHidden, field.Name(lang))
+		if settings.Shows(field) {
+			label = lang.T(i18n.ButtonFieldShown, field.Name(lang))
+		}
+		row = append(row, b.button(label, callbacks.ToggleFieldPayload(field)))
+		if len(row) == 2 {
+			rows = append(rows, row)
+			row = nil
+		}
+	}
+	if len(row) > 0 {
+		rows = append(rows, row)
+	}
+
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		b.action(lang.T(i18n.ButtonClose), callbacks.SettingsClose),
+	))
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
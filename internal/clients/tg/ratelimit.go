@@ -0,0 +1,161 @@
+package tg
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	// noChat is used for requests which are not addressed to a chat, e.g. callback answers.
+	noChat int64 = 0
+
+	// idleChatsLimit is the number of chat buckets after which the idle ones are dropped.
+	idleChatsLimit = 1024
+)
+
+// Limits are the rates of requests per second and the bursts tolerated above them.
+type Limits struct {
+	GlobalRate  int
+	GlobalBurst int
+	ChatRate    int
+	ChatBurst   int
+}
+
+// BotAPILimits are the limits of Telegram: about 30 messages per second overall and about
+// one message per second in a single chat, with short bursts tolerated.
+var BotAPILimits = Limits{
+	GlobalRate:  30,
+	GlobalBurst: 30,
+	ChatRate:    1,
+	ChatBurst:   3,
+}
+
+// bucket is a token bucket in its GCRA form: it hands out time slots instead of tokens,
+// so that callers can reserve a slot and sleep until it comes.
+type bucket struct {
+	interval time.Duration
+	burst    int
+	// next is the theoretical arrival time of the next request: the bucket is full
+	// when it is in the past and empty when it is burst intervals in the future.
+	next time.Time
+}
+
+func newBucket(rate, burst int) *bucket {
+	return &bucket{
+		interval: time.Second / time.Duration(rate),
+		burst:    burst,
+	}
+}
+
+func (b *bucket) tolerance() time.Duration {
+	return time.Duration(b.burst-1) * b.interval
+}
+
+// earliest returns the earliest time not before t at which a token is available.
+func (b *bucket) earliest(t time.Time) time.Time {
+	slot := b.next.Add(-b.tolerance())
+	if slot.Before(t) {
+		return t
+	}
+	return slot
+}
+
+// take consumes a token at time t, which must not be before earliest(t).
+func (b *bucket) take(t time.Time) {
+	if b.next.Before(t) {
+		b.next = t
+	}
+	b.next = b.next.Add(b.interval)
+}
+
+// pause makes the bucket hand out no tokens until t.
+func (b *bucket) pause(t time.Time) {
+	next := t.Add(b.tolerance())
+	if b.next.Before(next) {
+		b.next = next
+	}
+}
+
+func (b *bucket) idle(t time.Time) bool {
+	return !b.next.After(t)
+}
+
+// Limiter keeps requests within the global and the per-chat limits.
+type Limiter struct {
+	mu     sync.Mutex
+	limits Limits
+	global *bucket
+	chats  map[int64]*bucket
+}
+
+func NewLimiter(limits Limits) *Limiter {
+	return &Limiter{
+		limits: limits,
+		global: newBucket(limits.GlobalRate, limits.GlobalBurst),
+		chats:  make(map[int64]*bucket),
+	}
+}
+
+// Wait blocks until a request to chatID may be sent.
+func (l *Limiter) Wait(ctx context.Context, chatID int64) error {
+	delay := l.reserve(chatID)
+	if delay <= 0 {
+		return nil
+	}
+
+	return sleep(ctx, delay)
+}
+
+// Pause stops requests to chatID until the given time, as Telegram asks in retry_after.
+func (l *Limiter) Pause(chatID int64, until time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if chatID == noChat {
+		l.global.pause(until)
+		return
+	}
+	l.chat(chatID).pause(until)
+}
+
+func (l *Limiter) reserve(chatID int64) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	slot := l.global.earliest(now)
+
+	var chat *bucket
+	if chatID != noChat {
+		chat = l.chat(chatID)
+		if chatSlot := chat.earliest(now); chatSlot.After(slot) {
+			slot = l.global.earliest(chatSlot)
+		}
+		chat.take(slot)
+	}
+	l.global.take(slot)
+
+	if len(l.chats) > idleChatsLimit {
+		l.dropIdle(now)
+	}
+
+	return slot.Sub(now)
+}
+
+func (l *Limiter) chat(chatID int64) *bucket {
+	b, ok := l.chats[chatID]
+	if !ok {
+		b = newBucket(l.limits.ChatRate, l.limits.ChatBurst)
+		l.chats[chatID] = b
+	}
+	return b
+}
+
+func (l *Limiter) dropIdle(now time.Time) {
+	for chatID, b := range l.chats {
+		if b.idle(now) {
+			delete(l.chats, chatID)
+		}
+	}
+}
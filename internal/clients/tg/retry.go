@@ -0,0 +1,99 @@
+package tg
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"go.uber.org/zap"
+)
+
+const (
+	maxAttempts    = 5
+	initialBackoff = 500 * time.Millisecond
+	maxBackoff     = 30 * time.Second
+)
+
+// withRetry calls do until it succeeds, fails permanently or runs out of attempts.
+// Every attempt waits for the rate limiter first. Too Many Requests pauses the chat for
+// the time Telegram asked in retry_after, server and network errors are retried with
+// exponential backoff, any other error is returned at once.
+func (c *Client) withRetry(ctx context.Context, chatID int64, method string, do func() error) error {
+	backoff := initialBackoff
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err := c.limiter.Wait(ctx, chatID); err != nil {
+			return err
+		}
+
+		err = do()
+		if err == nil || attempt == maxAttempts {
+			return err
+		}
+
+		delay, retry := retryDelay(err, backoff)
+		if !retry {
+			return err
+		}
+
+		c.logger.Warn("Retrying request",
+			zap.String("method", method),
+			zap.Int64("chat_id", chatID),
+			zap.Int("attempt", attempt),
+			zap.Duration("delay", delay),
+			zap.Error(err),
+		)
+
+		var apiErr *tgbotapi.Error
+		if errors.As(err, &apiErr) && apiErr.Code == http.StatusTooManyRequests {
+			c.limiter.Pause(chatID, time.Now().Add(delay))
+		} else if err := sleep(ctx, delay); err != nil {
+			return err
+		}
+
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// retryDelay tells whether the request failed with err is worth retrying and after what delay.
+func retryDelay(err error, backoff time.Duration) (time.Duration, bool) {
+	var apiErr *tgbotapi.Error
+	if errors.As(err, &apiErr) {
+		switch {
+		case apiErr.Code == http.StatusTooManyRequests:
+			if apiErr.RetryAfter > 0 {
+				return time.Duration(apiErr.RetryAfter) * time.Second, true
+			}
+			return backoff, true
+		case apiErr.Code >= http.StatusInternalServerError:
+			return backoff, true
+		}
+		return 0, false
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return backoff, true
+	}
+
+	return 0, false
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -1,110 +1,359 @@
 package tg
 
 import (
-	"log"
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/pkg/errors"
+	"github.com/profectus200/contact-book-bot/internal/i18n"
+	"github.com/profectus200/contact-book-bot/internal/model/callbacks"
+	"github.com/profectus200/contact-book-bot/internal/types"
+	"go.uber.org/zap"
 )
 
 type tokenGetter interface {
 	Token() string
+	APIEndpoint() string
+}
+
+type callbackEncoder interface {
+	Encode(userID int64, payload callbacks.Payload) string
+}
+
+type rateLimiter interface {
+	Wait(ctx context.Context, chatID int64) error
+	Pause(chatID int64, until time.Time)
 }
 
 type Client struct {
-	client *tgbotapi.BotAPI
+	client   *tgbotapi.BotAPI
+	codec    callbackEncoder
+	limiter  rateLimiter
+	sent     *sentKeys
+	stopped  chan struct{}
+	stopOnce sync.Once
+	logger   *zap.Logger
 }
 
-func New(tokenGetter tokenGetter) (*Client, error) {
-	client, err := tgbotapi.NewBotAPI(tokenGetter.Token())
+// New connects to the Bot API. The requests wait for the limiter, which is
+// NewLimiter(BotAPILimits) for Telegram.
+func New(tokenGetter tokenGetter, codec callbackEncoder, limiter rateLimiter, logger *zap.Logger) (*Client, error) {
+	endpoint := tokenGetter.APIEndpoint()
+	if endpoint == "" {
+		endpoint = tgbotapi.APIEndpoint
+	}
+
+	client, err := tgbotapi.NewBotAPIWithAPIEndpoint(tokenGetter.Token(), endpoint)
 	if err != nil {
 		return nil, errors.Wrap(err, "cannot NewBotAPI")
 	}
 
+	logger = logger.Named("tg")
+	logger.Info("Authorized", zap.String("bot", client.Self.UserName))
+
 	return &Client{
-		client: client,
+		client:  client,
+		codec:   codec,
+		limiter: limiter,
+		sent:    newSentKeys(),
+		stopped: make(chan struct{}),
+		logger:  logger,
 	}, nil
 }
 
-func (c *Client) SendMessage(text string, userID int64) error {
-	_, err := c.client.Send(tgbotapi.NewMessage(userID, text))
+// send sends a message to the chat, keeping within the rate limits and retrying on failures.
+func (c *Client) send(ctx context.Context, chatID int64, method string, msg tgbotapi.Chattable) (tgbotapi.Message, error) {
+	var sent tgbotapi.Message
+	err := c.withRetry(ctx, chatID, method, func() error {
+		var err error
+		sent, err = c.client.Send(msg)
+		return err
+	})
 	if err != nil {
-		return errors.Wrap(err, "cannot Send")
+		return sent, errors.Wrap(err, "cannot Send")
+	}
+
+	return sent, nil
+}
+
+// request is send for the methods which do not return a message.
+func (c *Client) request(ctx context.Context, chatID int64, method string, req tgbotapi.Chattable) error {
+	err := c.withRetry(ctx, chatID, method, func() error {
+		_, err := c.client.Request(req)
+		return err
+	})
+	if err != nil {
+		return errors.Wrap(err, "cannot Request")
 	}
+
 	return nil
 }
 
-func (c *Client) EditContact(text string, userID int64) error {
-	msg := tgbotapi.NewMessage(userID, text)
+func (c *Client) SendMessage(ctx context.Context, text string, userID int64) error {
+	_, err := c.send(ctx, userID, "sendMessage", tgbotapi.NewMessage(userID, text))
+	return err
+}
 
-	msg.ReplyMarkup = editContactKeyboard
+// SendMessageOnce sends the message unless a message with the same key has already been
+// sent. Broadcasts use it so that a retried or rescheduled delivery does not duplicate messages.
+func (c *Client) SendMessageOnce(ctx context.Context, key string, text string, userID int64) error {
+	return c.once(key, userID, func() error {
+		return c.SendMessage(ctx, text, userID)
+	})
+}
 
-	_, err := c.client.Send(msg)
+// once calls send unless the message with the key has already been sent.
+func (c *Client) once(key string, chatID int64, send func() error) error {
+	if !c.sent.Reserve(key) {
+		c.logger.Debug("Message already sent", zap.String("key", key), zap.Int64("chat_id", chatID))
+		return nil
+	}
 
-	if err != nil {
-		return errors.Wrap(err, "cannot Send")
+	if err := send(); err != nil {
+		c.sent.Release(key)
+		return err
 	}
 
+	c.sent.Done(key)
 	return nil
 }
 
-func (c *Client) ShowAlert(text string, messageID string) error {
-	alert := tgbotapi.NewCallback(messageID, text)
-	_, err := c.client.Request(alert)
+// EditContact sends the card of the contact. The card of a contact with a photo is the photo
+// with the card in the caption.
+func (c *Client) EditContact(ctx context.Context, text string, userID int64, contactID int, photoID string, lang i18n.Lang) error {
+	keyboard := c.buttons(userID).editContactKeyboard(contactID, lang)
 
-	if err != nil {
-		return errors.Wrap(err, "cannot Request")
+	if photoID != "" {
+		photo := tgbotapi.NewPhoto(userID, tgbotapi.FileID(photoID))
+		photo.Caption = text
+		photo.ReplyMarkup = keyboard
+
+		_, err := c.send(ctx, userID, "sendPhoto", photo)
+		return err
 	}
 
-	return nil
+	msg := tgbotapi.NewMessage(userID, text)
+
+	msg.ReplyMarkup = keyboard
+
+	_, err := c.send(ctx, userID, "sendMessage", msg)
+	return err
 }
 
-func (c *Client) EditContactMessage(text string, userID int64, messageID int) error {
-	editMessage := tgbotapi.NewEditMessageTextAndMarkup(userID, messageID, text, editContactKeyboard)
-	_, err := c.client.Send(editMessage)
+func (c *Client) ShowAlert(ctx context.Context, text string, messageID string) error {
+	alert := tgbotapi.NewCallback(messageID, text)
+	return c.request(ctx, noChat, "answerCallbackQuery", alert)
+}
 
+// EditContactMessage shows the contact in the card sent before. A text cannot be edited into
+// a photo and back, so the card is sent again when the contact got or lost its photo.
+func (c *Client) EditContactMessage(ctx context.Context, text string, userID int64, messageID int, contactID int, photoID string, lang i18n.Lang) error {
+	keyboard := c.buttons(userID).editContactKeyboard(contactID, lang)
+
+	var err error
+	if photoID != "" {
+		media := tgbotapi.NewInputMediaPhoto(tgbotapi.FileID(photoID))
+		media.Caption = text
+		editMedia := tgbotapi.EditMessageMediaConfig{
+			BaseEdit: tgbotapi.BaseEdit{ChatID: userID, MessageID: messageID, ReplyMarkup: &keyboard},
+			Media:    media,
+		}
+		_, err = c.send(ctx, userID, "editMessageMedia", editMedia)
+	} else {
+		editMessage := tgbotapi.NewEditMessageTextAndMarkup(userID, messageID, text, keyboard)
+		_, err = c.send(ctx, userID, "editMessageText", editMessage)
+	}
+	if !isOtherKindOfMessage(err) {
+		return err
+	}
+
+	c.logger.Debug("Sending the card again", zap.Int64("chat_id", userID), zap.Int("message_id", messageID))
+	err = c.DeleteMessage(ctx, userID, messageID)
 	if err != nil {
-		return errors.Wrap(err, "cannot Send")
+		return errors.Wrap(err, "cannot DeleteMessage")
 	}
+	return c.EditContact(ctx, text, userID, contactID, photoID, lang)
+}
 
-	return nil
+// isOtherKindOfMessage tells whether the edit failed because a text was edited as a photo or back.
+func isOtherKindOfMessage(err error) bool {
+	var apiErr *tgbotapi.Error
+	if !errors.As(err, &apiErr) || apiErr.Code != http.StatusBadRequest {
+		return false
+	}
+	return strings.Contains(apiErr.Message, "there is no text in the message") ||
+		strings.Contains(apiErr.Message, "there is no media in the message")
 }
 
-func (c *Client) DoneMessage(userID int64, messageID int) error {
+func (c *Client) SendContactSummary(ctx context.Context, text string, userID int64, contactID int, lang i18n.Lang) error {
+	msg := tgbotapi.NewMessage(userID, text)
 
-	editMessage := tgbotapi.NewEditMessageText(userID, messageID, "Saved")
-	_, err := c.client.Send(editMessage)
-	if err != nil {
-		return errors.Wrap(err, "cannot Send")
-	}
+	msg.ReplyMarkup = c.buttons(userID).summaryKeyboard(contactID, lang)
 
-	return nil
+	_, err := c.send(ctx, userID, "sendMessage", msg)
+	return err
 }
 
-func (c *Client) DeleteMessage(userID int64, messageID int) error {
-	deleteMessage := tgbotapi.NewDeleteMessage(userID, messageID)
-	_, err := c.client.Request(deleteMessage)
+// EditMessage replaces the text of the message and removes its buttons.
+func (c *Client) EditMessage(ctx context.Context, text string, userID int64, messageID int) error {
+	editMessage := tgbotapi.NewEditMessageText(userID, messageID, text)
+	_, err := c.send(ctx, userID, "editMessageText", editMessage)
+	return err
+}
 
-	if err != nil {
-		return errors.Wrap(err, "cannot Request")
-	}
+func (c *Client) ChooseLanguage(ctx context.Context, text string, userID int64) error {
+	msg := tgbotapi.NewMessage(userID, text)
 
-	return nil
+	msg.ReplyMarkup = c.buttons(userID).languageKeyboard()
+
+	_, err := c.send(ctx, userID, "sendMessage", msg)
+	return err
 }
 
-func (c *Client) Start() tgbotapi.UpdatesChannel {
-	u := tgbotapi.NewUpdate(0)
-	u.Timeout = 60
+// EditChooseLanguage turns the message into the language menu.
+func (c *Client) EditChooseLanguage(ctx context.Context, text string, userID int64, messageID int) error {
+	editMessage := tgbotapi.NewEditMessageTextAndMarkup(userID, messageID, text, c.buttons(userID).languageKeyboard())
+	_, err := c.send(ctx, userID, "editMessageText", editMessage)
+	return err
+}
 
-	return c.client.GetUpdatesChan(u)
+func (c *Client) SendSettings(ctx context.Context, text string, userID int64, settings types.Settings, lang i18n.Lang) error {
+	msg := tgbotapi.NewMessage(userID, text)
+
+	msg.ReplyMarkup = c.buttons(userID).settingsKeyboard(settings, lang)
+
+	_, err := c.send(ctx, userID, "sendMessage", msg)
+	return err
+}
+
+func (c *Client) EditSettings(ctx context.Context, text string, userID int64, messageID int, settings types.Settings, lang i18n.Lang) error {
+	editMessage := tgbotapi.NewEditMessageTextAndMarkup(userID, messageID, text, c.buttons(userID).settingsKeyboard(settings, lang))
+	_, err := c.send(ctx, userID, "editMessageText", editMessage)
+	return err
 }
 
-func (c *Client) Stop() {
-	log.Println("Stop receiving updates")
-	c.client.StopReceivingUpdates()
+// SendDuplicates shows the pair of possible duplicates with the given number.
+func (c *Client) SendDuplicates(ctx context.Context, text string, userID int64, dup types.Duplicate, page int, lang i18n.Lang) error {
+	msg := tgbotapi.NewMessage(userID, text)
+
+	msg.ReplyMarkup = c.buttons(userID).duplicatesKeyboard(dup, page, lang)
+
+	_, err := c.send(ctx, userID, "sendMessage", msg)
+	return err
 }
 
-func (c *Client) Request(callback tgbotapi.CallbackConfig) error {
-	_, err := c.client.Request(callback)
-	return errors.Wrap(err, "cannot Request")
-} // fixme
+func (c *Client) EditDuplicates(ctx context.Context, text string, userID int64, messageID int, dup types.Duplicate, page int, lang i18n.Lang) error {
+	editMessage := tgbotapi.NewEditMessageTextAndMarkup(userID, messageID, text, c.buttons(userID).duplicatesKeyboard(dup, page, lang))
+	_, err := c.send(ctx, userID, "editMessageText", editMessage)
+	return err
+}
+
+// EditMergedContact shows the contact left after merging, with the button going on to the pair
+// with the given number.
+func (c *Client) EditMergedContact(ctx context.Context, text string, userID int64, messageID int, page int, lang i18n.Lang) error {
+	editMessage := tgbotapi.NewEditMessageTextAndMarkup(userID, messageID, text, c.buttons(userID).nextDuplicatesKeyboard(page, lang))
+	_, err := c.send(ctx, userID, "editMessageText", editMessage)
+	return err
+}
+
+// SendReminder delivers the reminder with the buttons to snooze it or mark it done, once
+// for the key like SendMessageOnce.
+func (c *Client) SendReminder(ctx context.Context, key string, text string, userID int64, reminderID int, lang i18n.Lang) error {
+	msg := tgbotapi.NewMessage(userID, text)
+
+	msg.ReplyMarkup = c.buttons(userID).reminderKeyboard(reminderID, lang)
+
+	return c.once(key, userID, func() error {
+		_, err := c.send(ctx, userID, "sendMessage", msg)
+		return err
+	})
+}
+
+// SendReminders shows the list of /reminders with the buttons cancelling them.
+func (c *Client) SendReminders(ctx context.Context, text string, userID int64, reminders []types.Reminder, lang i18n.Lang) error {
+	msg := tgbotapi.NewMessage(userID, text)
+
+	msg.ReplyMarkup = c.buttons(userID).remindersKeyboard(reminders, lang)
+
+	_, err := c.send(ctx, userID, "sendMessage", msg)
+	return err
+}
+
+func (c *Client) EditReminders(ctx context.Context, text string, userID int64, messageID int, reminders []types.Reminder, lang i18n.Lang) error {
+	editMessage := tgbotapi.NewEditMessageTextAndMarkup(userID, messageID, text, c.buttons(userID).remindersKeyboard(reminders, lang))
+	_, err := c.send(ctx, userID, "editMessageText", editMessage)
+	return err
+}
+
+// SendCalendarLink shows the /calendar link with the buttons sending the file and, when there
+// is a link, replacing it.
+func (c *Client) SendCalendarLink(ctx context.Context, text string, userID int64, hasLink bool, lang i18n.Lang) error {
+	msg := tgbotapi.NewMessage(userID, text)
+
+	msg.ReplyMarkup = c.buttons(userID).calendarKeyboard(hasLink, lang)
+	// The preview of a calendar link shows nothing useful.
+	msg.DisableWebPagePreview = true
+
+	_, err := c.send(ctx, userID, "sendMessage", msg)
+	return err
+}
+
+func (c *Client) EditCalendarLink(ctx context.Context, text string, userID int64, messageID int, lang i18n.Lang) error {
+	editMessage := tgbotapi.NewEditMessageTextAndMarkup(userID, messageID, text, c.buttons(userID).calendarKeyboard(true, lang))
+	editMessage.DisableWebPagePreview = true
+	_, err := c.send(ctx, userID, "editMessageText", editMessage)
+	return err
+}
+
+// SendWebhooks shows the list of /webhooks with the buttons removing them and adding one.
+func (c *Client) SendWebhooks(ctx context.Context, text string, userID int64, webhooks []types.Webhook, lang i18n.Lang) error {
+	msg := tgbotapi.NewMessage(userID, text)
+
+	msg.ReplyMarkup = c.buttons(userID).webhooksKeyboard(webhooks, lang)
+	msg.DisableWebPagePreview = true
+
+	_, err := c.send(ctx, userID, "sendMessage", msg)
+	return err
+}
+
+func (c *Client) EditWebhooks(ctx context.Context, text string, userID int64, messageID int, webhooks []types.Webhook, lang i18n.Lang) error {
+	editMessage := tgbotapi.NewEditMessageTextAndMarkup(userID, messageID, text, c.buttons(userID).webhooksKeyboard(webhooks, lang))
+	editMessage.DisableWebPagePreview = true
+	_, err := c.send(ctx, userID, "editMessageText", editMessage)
+	return err
+}
+
+// SendDeleteAccount asks whether to delete the account, with the buttons to delete it and
+// to keep it.
+func (c *Client) SendDeleteAccount(ctx context.Context, text string, userID int64, lang i18n.Lang) error {
+	msg := tgbotapi.NewMessage(userID, text)
+
+	msg.ReplyMarkup = c.buttons(userID).deleteAccountKeyboard(lang)
+
+	_, err := c.send(ctx, userID, "sendMessage", msg)
+	return err
+}
+
+// SendDocument sends the data as a file with the name.
+func (c *Client) SendDocument(ctx context.Context, name string, data []byte, caption string, userID int64) error {
+	document := tgbotapi.NewDocument(userID, tgbotapi.FileBytes{Name: name, Bytes: data})
+	document.Caption = caption
+
+	_, err := c.send(ctx, userID, "sendDocument", document)
+	return err
+}
+
+func (c *Client) DoneMessage(ctx context.Context, userID int64, messageID int, lang i18n.Lang) error {
+	editMessage := tgbotapi.NewEditMessageText(userID, messageID, lang.T(i18n.Saved))
+	_, err := c.send(ctx, userID, "editMessageText", editMessage)
+	return err
+}
+
+func (c *Client) DeleteMessage(ctx context.Context, userID int64, messageID int) error {
+	deleteMessage := tgbotapi.NewDeleteMessage(userID, messageID)
+	return c.request(ctx, userID, "deleteMessage", deleteMessage)
+}
@@ -0,0 +1,158 @@
+package tg_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/profectus200/contact-book-bot/internal/clients/tg"
+	"github.com/profectus200/contact-book-bot/internal/clients/tg/tgfake"
+	"go.uber.org/zap"
+)
+
+const userID int64 = 42
+
+type fakeEndpoint struct {
+	endpoint string
+}
+
+func (e fakeEndpoint) Token() string {
+	return tgfake.Token
+}
+
+func (e fakeEndpoint) APIEndpoint() string {
+	return e.endpoint
+}
+
+func newClient(t *testing.T) (*tg.Client, *tgfake.Server) {
+	t.Helper()
+
+	server := tgfake.NewServer()
+	t.Cleanup(server.Close)
+
+	client, err := tg.New(fakeEndpoint{endpoint: server.Endpoint()}, nil, tg.NewLimiter(tg.BotAPILimits), zap.NewNop())
+	if err != nil {
+		t.Fatalf("cannot create client: %v", err)
+	}
+	return client, server
+}
+
+func botMessages(server *tgfake.Server) int {
+	count := 0
+	for _, msg := range server.Messages(userID) {
+		if msg.FromBot {
+			count++
+		}
+	}
+	return count
+}
+
+func TestRetryAfter(t *testing.T) {
+	client, server := newClient(t)
+	server.FailNext("sendMessage", http.StatusTooManyRequests, 1)
+
+	start := time.Now()
+	if err := client.SendMessage(context.Background(), "hello", userID); err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("sent after %v, want the retry_after of 1s", elapsed)
+	}
+	if calls := server.Calls("sendMessage"); calls != 2 {
+		t.Errorf("sendMessage called %d times, want 2", calls)
+	}
+	if sent := botMessages(server); sent != 1 {
+		t.Errorf("%d messages delivered, want 1", sent)
+	}
+}
+
+func TestServerErrorBackoff(t *testing.T) {
+	client, server := newClient(t)
+	server.FailNext("sendMessage", http.StatusBadGateway, 0)
+	server.FailNext("sendMessage", http.StatusInternalServerError, 0)
+
+	start := time.Now()
+	if err := client.SendMessage(context.Background(), "hello", userID); err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+
+	// The backoff doubles: 500ms after the first failure and 1s after the second one.
+	if elapsed := time.Since(start); elapsed < 1500*time.Millisecond {
+		t.Errorf("sent after %v, want at least 1.5s of backoff", elapsed)
+	}
+	if calls := server.Calls("sendMessage"); calls != 3 {
+		t.Errorf("sendMessage called %d times, want 3", calls)
+	}
+}
+
+func TestClientErrorNotRetried(t *testing.T) {
+	client, server := newClient(t)
+	server.FailNext("sendMessage", http.StatusBadRequest, 0)
+
+	if err := client.SendMessage(context.Background(), "hello", userID); err == nil {
+		t.Fatal("SendMessage succeeded, want the error of the server")
+	}
+	if calls := server.Calls("sendMessage"); calls != 1 {
+		t.Errorf("sendMessage called %d times, want 1", calls)
+	}
+}
+
+func TestRetryCancelled(t *testing.T) {
+	client, server := newClient(t)
+	server.FailNext("sendMessage", http.StatusBadGateway, 0)
+	server.FailNext("sendMessage", http.StatusBadGateway, 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if err := client.SendMessage(ctx, "hello", userID); err == nil {
+		t.Fatal("SendMessage succeeded, want the context error")
+	}
+	if elapsed := time.Since(start); elapsed > 400*time.Millisecond {
+		t.Errorf("gave up after %v, want right after the context is done", elapsed)
+	}
+	if calls := server.Calls("sendMessage"); calls != 1 {
+		t.Errorf("sendMessage called %d times, want 1", calls)
+	}
+}
+
+func TestSendMessageOnce(t *testing.T) {
+	client, server := newClient(t)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if err := client.SendMessageOnce(ctx, "broadcast:1", "hello", userID); err != nil {
+			t.Fatalf("SendMessageOnce: %v", err)
+		}
+	}
+	if err := client.SendMessageOnce(ctx, "broadcast:2", "hello again", userID); err != nil {
+		t.Fatalf("SendMessageOnce: %v", err)
+	}
+
+	if calls := server.Calls("sendMessage"); calls != 2 {
+		t.Errorf("sendMessage called %d times, want 2", calls)
+	}
+	if sent := botMessages(server); sent != 2 {
+		t.Errorf("%d messages delivered, want 2", sent)
+	}
+}
+
+func TestSendMessageOnceAfterFailure(t *testing.T) {
+	client, server := newClient(t)
+	ctx := context.Background()
+	server.FailNext("sendMessage", http.StatusForbidden, 0)
+
+	if err := client.SendMessageOnce(ctx, "broadcast:1", "hello", userID); err == nil {
+		t.Fatal("SendMessageOnce succeeded, want the error of the server")
+	}
+	if err := client.SendMessageOnce(ctx, "broadcast:1", "hello", userID); err != nil {
+		t.Fatalf("SendMessageOnce: %v", err)
+	}
+
+	if sent := botMessages(server); sent != 1 {
+		t.Errorf("%d messages delivered, want 1 after the failed attempt", sent)
+	}
+}
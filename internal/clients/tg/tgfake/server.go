@@ -0,0 +1,615 @@
+// Package tgfake is an in-process fake of the Telegram Bot API for driving the bot without Telegram.
+//
+// The server keeps the chats as the users would see them: messages of the users and of the bot,
+// with edits and deletions applied and the inline keyboards attached. Users act through
+// SendText, SendPhoto and PressButton, which queue updates for getUpdates.
+package tgfake
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	Token = "fake-token"
+	botID = 1
+
+	// maxPollTimeout caps long polling, so that a stopped client does not hang for a minute.
+	maxPollTimeout = time.Second
+)
+
+// Button is an inline keyboard button.
+type Button struct {
+	Text string
+	Data string
+}
+
+// Message is a message in a chat as the user sees it.
+type Message struct {
+	ID      int
+	FromBot bool
+	// Text is the caption of a photo or a document.
+	Text string
+	// Photo is the file_id of the photo of the message, if it is a photo.
+	Photo string
+	// Document is the file sent, if the message is a document.
+	Document *Document
+	Keyboard [][]Button
+	Deleted  bool
+	Edited   bool
+}
+
+// Document is a file uploaded by the bot.
+type Document struct {
+	Name string
+	Data []byte
+}
+
+// Alert is an answer to a callback query.
+type Alert struct {
+	CallbackID string
+	Text       string
+}
+
+type failure struct {
+	code       int
+	retryAfter int
+}
+
+type Server struct {
+	server *httptest.Server
+
+	mu            sync.Mutex
+	updateAdded   chan struct{}
+	updates       []json.RawMessage
+	nextUpdateID  int
+	nextCallback  int
+	chats         map[int64][]*Message
+	alerts        []Alert
+	calls         map[string]int
+	failures      map[string][]failure
+	lastMessageID map[int64]int
+}
+
+func NewServer() *Server {
+	s := &Server{
+		updateAdded:   make(chan struct{}),
+		nextUpdateID:  1,
+		chats:         make(map[int64][]*Message),
+		calls:         make(map[string]int),
+		failures:      make(map[string][]failure),
+		lastMessageID: make(map[int64]int),
+	}
+	s.server = httptest.NewServer(http.HandlerFunc(s.handle))
+
+	return s
+}
+
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// Endpoint is the API endpoint format to pass to the client together with Token.
+func (s *Server) Endpoint() string {
+	return s.server.URL + "/bot%s/%s"
+}
+
+// SendText makes the user send a text message to the bot and returns its ID.
+func (s *Server) SendText(userID int64, text string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	msg := s.addMessage(userID, false, text, nil)
+	s.addUpdate("message", map[string]any{
+		"message_id": msg.ID,
+		"date":       time.Now().Unix(),
+		"from":       user(userID),
+		"chat":       chat(userID),
+		"text":       text,
+	})
+
+	return msg.ID
+}
+
+// SendPhoto makes the user send a photo without a caption to the bot and returns its ID.
+func (s *Server) SendPhoto(userID int64, fileID string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	msg := s.addMessage(userID, false, "", nil)
+	msg.Photo = fileID
+	s.addUpdate("message", map[string]any{
+		"message_id": msg.ID,
+		"date":       time.Now().Unix(),
+		"from":       user(userID),
+		"chat":       chat(userID),
+		"photo":      photoSizes(fileID),
+	})
+
+	return msg.ID
+}
+
+// PressButton makes the user press the button with the data under the message
+// and returns the ID of the callback query.
+func (s *Server) PressButton(userID int64, messageID int, data string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	msg := s.message(userID, messageID)
+	if msg == nil || msg.Deleted {
+		return "", fmt.Errorf("no message %d in chat %d", messageID, userID)
+	}
+	if !hasButton(msg.Keyboard, data) {
+		return "", fmt.Errorf("message %d has no button %q", messageID, data)
+	}
+
+	s.nextCallback++
+	callbackID := strconv.Itoa(s.nextCallback)
+	s.addUpdate("callback_query", map[string]any{
+		"id":   callbackID,
+		"from": user(userID),
+		"message": map[string]any{
+			"message_id": messageID,
+			"date":       time.Now().Unix(),
+			"from":       map[string]any{"id": botID, "is_bot": true},
+			"chat":       chat(userID),
+			"text":       msg.Text,
+		},
+		"chat_instance": strconv.FormatInt(userID, 10),
+		"data":          data,
+	})
+
+	return callbackID, nil
+}
+
+// Messages returns the messages of the chat with the user, including the deleted ones.
+func (s *Server) Messages(userID int64) []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	messages := make([]Message, 0, len(s.chats[userID]))
+	for _, msg := range s.chats[userID] {
+		messages = append(messages, *msg)
+	}
+	return messages
+}
+
+// LastBotMessage returns the latest message of the bot in the chat which was not deleted.
+func (s *Server) LastBotMessage(userID int64) (Message, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	chat := s.chats[userID]
+	for i := len(chat) - 1; i >= 0; i-- {
+		if chat[i].FromBot && !chat[i].Deleted {
+			return *chat[i], true
+		}
+	}
+	return Message{}, false
+}
+
+// Alerts returns the answers to the callback queries.
+func (s *Server) Alerts() []Alert {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Alert(nil), s.alerts...)
+}
+
+// Calls returns how many times the method was called.
+func (s *Server) Calls(method string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.calls[method]
+}
+
+// FailNext makes the next call of the method fail with the error code.
+// A positive retryAfter is returned in the response parameters, as Telegram does with 429.
+func (s *Server) FailNext(method string, code int, retryAfter int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failures[method] = append(s.failures[method], failure{code: code, retryAfter: retryAfter})
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if len(parts) != 2 || parts[0] != "bot"+Token {
+		writeError(w, http.StatusUnauthorized, "Unauthorized", 0)
+		return
+	}
+	method := parts[1]
+
+	if err := r.ParseMultipartForm(1 << 20); err != nil && err != http.ErrNotMultipart {
+		writeError(w, http.StatusBadRequest, err.Error(), 0)
+		return
+	}
+
+	if method == "getUpdates" {
+		s.getUpdates(w, r)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.calls[method]++
+	if failures := s.failures[method]; len(failures) > 0 {
+		s.failures[method] = failures[1:]
+		writeError(w, failures[0].code, http.StatusText(failures[0].code), failures[0].retryAfter)
+		return
+	}
+
+	result, code, err := s.call(method, r)
+	if err != nil {
+		writeError(w, code, err.Error(), 0)
+		return
+	}
+	writeResult(w, result)
+}
+
+func (s *Server) call(method string, r *http.Request) (any, int, error) {
+	switch method {
+	case "getMe":
+		return map[string]any{"id": botID, "is_bot": true, "first_name": "Contact book", "username": "fake_bot"}, 0, nil
+	case "sendMessage":
+		chatID, err := strconv.ParseInt(r.FormValue("chat_id"), 10, 64)
+		if err != nil {
+			return nil, http.StatusBadRequest, fmt.Errorf("Bad Request: chat not found")
+		}
+		if r.FormValue("text") == "" {
+			return nil, http.StatusBadRequest, fmt.Errorf("Bad Request: message text is empty")
+		}
+		keyboard, err := parseKeyboard(r.FormValue("reply_markup"))
+		if err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+
+		msg := s.addMessage(chatID, true, r.FormValue("text"), keyboard)
+		return s.messageResult(chatID, msg), 0, nil
+	case "sendPhoto":
+		chatID, err := strconv.ParseInt(r.FormValue("chat_id"), 10, 64)
+		if err != nil {
+			return nil, http.StatusBadRequest, fmt.Errorf("Bad Request: chat not found")
+		}
+		if r.FormValue("photo") == "" {
+			return nil, http.StatusBadRequest, fmt.Errorf("Bad Request: there is no photo in the request")
+		}
+		keyboard, err := parseKeyboard(r.FormValue("reply_markup"))
+		if err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+
+		msg := s.addMessage(chatID, true, r.FormValue("caption"), keyboard)
+		msg.Photo = r.FormValue("photo")
+		return s.messageResult(chatID, msg), 0, nil
+	case "sendDocument":
+		chatID, err := strconv.ParseInt(r.FormValue("chat_id"), 10, 64)
+		if err != nil {
+			return nil, http.StatusBadRequest, fmt.Errorf("Bad Request: chat not found")
+		}
+		document, err := formFile(r, "document")
+		if err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+		keyboard, err := parseKeyboard(r.FormValue("reply_markup"))
+		if err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+
+		msg := s.addMessage(chatID, true, r.FormValue("caption"), keyboard)
+		msg.Document = document
+		return s.messageResult(chatID, msg), 0, nil
+	case "editMessageMedia":
+		msg, chatID, err := s.formMessage(r)
+		if err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+		if msg.Photo == "" {
+			return nil, http.StatusBadRequest, fmt.Errorf("Bad Request: there is no media in the message to edit")
+		}
+		var media inputMedia
+		if err := json.Unmarshal([]byte(r.FormValue("media")), &media); err != nil || media.Type != "photo" || media.Media == "" {
+			return nil, http.StatusBadRequest, fmt.Errorf("Bad Request: can't parse InputMedia")
+		}
+		keyboard, err := parseKeyboard(r.FormValue("reply_markup"))
+		if err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+		if msg.Photo == media.Media && msg.Text == media.Caption && equalKeyboards(msg.Keyboard, keyboard) {
+			return nil, http.StatusBadRequest, fmt.Errorf("Bad Request: message is not modified")
+		}
+
+		msg.Photo = media.Media
+		msg.Text = media.Caption
+		msg.Keyboard = keyboard
+		msg.Edited = true
+		return s.messageResult(chatID, msg), 0, nil
+	case "editMessageText":
+		msg, chatID, err := s.formMessage(r)
+		if err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+		if msg.Photo != "" {
+			return nil, http.StatusBadRequest, fmt.Errorf("Bad Request: there is no text in the message to edit")
+		}
+		keyboard, err := parseKeyboard(r.FormValue("reply_markup"))
+		if err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+		if msg.Text == r.FormValue("text") && equalKeyboards(msg.Keyboard, keyboard) {
+			return nil, http.StatusBadRequest, fmt.Errorf("Bad Request: message is not modified")
+		}
+
+		msg.Text = r.FormValue("text")
+		msg.Keyboard = keyboard
+		msg.Edited = true
+		return s.messageResult(chatID, msg), 0, nil
+	case "deleteMessage":
+		msg, _, err := s.formMessage(r)
+		if err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+
+		msg.Deleted = true
+		return true, 0, nil
+	case "answerCallbackQuery":
+		s.alerts = append(s.alerts, Alert{
+			CallbackID: r.FormValue("callback_query_id"),
+			Text:       r.FormValue("text"),
+		})
+		return true, 0, nil
+	}
+
+	return nil, http.StatusNotFound, fmt.Errorf("Not Found: method %s is not supported", method)
+}
+
+func (s *Server) getUpdates(w http.ResponseWriter, r *http.Request) {
+	offset, _ := strconv.Atoi(r.FormValue("offset"))
+	timeout, _ := strconv.Atoi(r.FormValue("timeout"))
+
+	deadline := time.NewTimer(minDuration(time.Duration(timeout)*time.Second, maxPollTimeout))
+	defer deadline.Stop()
+
+	for {
+		s.mu.Lock()
+		// Updates are numbered from one, so the index of an update is its ID minus one.
+		if offset < 1 {
+			offset = 1
+		}
+		var pending []json.RawMessage
+		if offset <= len(s.updates) {
+			pending = append(pending, s.updates[offset-1:]...)
+		}
+		added := s.updateAdded
+		s.mu.Unlock()
+
+		if len(pending) > 0 {
+			writeResult(w, pending)
+			return
+		}
+
+		select {
+		case <-added:
+		case <-deadline.C:
+			writeResult(w, []json.RawMessage{})
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// addUpdate must be called with the mutex held.
+func (s *Server) addUpdate(kind string, payload map[string]any) {
+	raw, _ := json.Marshal(map[string]any{
+		"update_id": s.nextUpdateID,
+		kind:        payload,
+	})
+	s.nextUpdateID++
+	s.updates = append(s.updates, raw)
+
+	close(s.updateAdded)
+	s.updateAdded = make(chan struct{})
+}
+
+// addMessage must be called with the mutex held.
+func (s *Server) addMessage(chatID int64, fromBot bool, text string, keyboard [][]Button) *Message {
+	s.lastMessageID[chatID]++
+	msg := &Message{
+		ID:       s.lastMessageID[chatID],
+		FromBot:  fromBot,
+		Text:     text,
+		Keyboard: keyboard,
+	}
+	s.chats[chatID] = append(s.chats[chatID], msg)
+
+	return msg
+}
+
+// message must be called with the mutex held.
+func (s *Server) message(chatID int64, messageID int) *Message {
+	for _, msg := range s.chats[chatID] {
+		if msg.ID == messageID {
+			return msg
+		}
+	}
+	return nil
+}
+
+// formMessage finds the message the request refers to. It must be called with the mutex held.
+func (s *Server) formMessage(r *http.Request) (*Message, int64, error) {
+	chatID, err := strconv.ParseInt(r.FormValue("chat_id"), 10, 64)
+	if err != nil {
+		return nil, 0, fmt.Errorf("Bad Request: chat not found")
+	}
+	messageID, err := strconv.Atoi(r.FormValue("message_id"))
+	if err != nil {
+		return nil, 0, fmt.Errorf("Bad Request: message identifier is not specified")
+	}
+
+	msg := s.message(chatID, messageID)
+	if msg == nil || msg.Deleted {
+		return nil, 0, fmt.Errorf("Bad Request: message to edit not found")
+	}
+
+	return msg, chatID, nil
+}
+
+func (s *Server) messageResult(chatID int64, msg *Message) map[string]any {
+	result := map[string]any{
+		"message_id": msg.ID,
+		"date":       time.Now().Unix(),
+		"from":       map[string]any{"id": botID, "is_bot": true},
+		"chat":       chat(chatID),
+	}
+	switch {
+	case msg.Photo != "":
+		result["photo"] = photoSizes(msg.Photo)
+		result["caption"] = msg.Text
+	case msg.Document != nil:
+		result["document"] = map[string]any{"file_id": msg.Document.Name, "file_unique_id": msg.Document.Name, "file_name": msg.Document.Name}
+		result["caption"] = msg.Text
+	default:
+		result["text"] = msg.Text
+	}
+	if len(msg.Keyboard) > 0 {
+		result["reply_markup"] = keyboardMarkup(msg.Keyboard)
+	}
+	return result
+}
+
+// formFile reads the file uploaded in the field of the request.
+func formFile(r *http.Request, field string) (*Document, error) {
+	file, header, err := r.FormFile(field)
+	if err != nil {
+		return nil, fmt.Errorf("Bad Request: there is no %s in the request", field)
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, fmt.Errorf("Bad Request: cannot read the %s", field)
+	}
+	return &Document{Name: header.Filename, Data: data}, nil
+}
+
+func user(userID int64) map[string]any {
+	return map[string]any{"id": userID, "is_bot": false, "first_name": "User", "username": fmt.Sprintf("user%d", userID)}
+}
+
+func chat(chatID int64) map[string]any {
+	return map[string]any{"id": chatID, "type": "private"}
+}
+
+// photoSizes is the photo as Telegram sends it, in a single size.
+func photoSizes(fileID string) []map[string]any {
+	return []map[string]any{{"file_id": fileID, "file_unique_id": fileID, "width": 640, "height": 640}}
+}
+
+type inputMedia struct {
+	Type    string `json:"type"`
+	Media   string `json:"media"`
+	Caption string `json:"caption"`
+}
+
+type inlineButton struct {
+	Text         string `json:"text"`
+	CallbackData string `json:"callback_data"`
+}
+
+type inlineMarkup struct {
+	InlineKeyboard [][]inlineButton `json:"inline_keyboard"`
+}
+
+func parseKeyboard(raw string) ([][]Button, error) {
+	if raw == "" {
+		return nil, nil
+	}
+
+	var markup inlineMarkup
+	if err := json.Unmarshal([]byte(raw), &markup); err != nil {
+		return nil, fmt.Errorf("Bad Request: can't parse reply keyboard markup JSON object")
+	}
+
+	keyboard := make([][]Button, 0, len(markup.InlineKeyboard))
+	for _, row := range markup.InlineKeyboard {
+		buttons := make([]Button, 0, len(row))
+		for _, button := range row {
+			buttons = append(buttons, Button{Text: button.Text, Data: button.CallbackData})
+		}
+		keyboard = append(keyboard, buttons)
+	}
+	return keyboard, nil
+}
+
+func keyboardMarkup(keyboard [][]Button) inlineMarkup {
+	markup := inlineMarkup{InlineKeyboard: make([][]inlineButton, 0, len(keyboard))}
+	for _, row := range keyboard {
+		buttons := make([]inlineButton, 0, len(row))
+		for _, button := range row {
+			buttons = append(buttons, inlineButton{Text: button.Text, CallbackData: button.Data})
+		}
+		markup.InlineKeyboard = append(markup.InlineKeyboard, buttons)
+	}
+	return markup
+}
+
+func hasButton(keyboard [][]Button, data string) bool {
+	for _, row := range keyboard {
+		for _, button := range row {
+			if button.Data == data {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func equalKeyboards(a, b [][]Button) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if len(a[i]) != len(b[i]) {
+			return false
+		}
+		for j := range a[i] {
+			if a[i][j] != b[i][j] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func writeResult(w http.ResponseWriter, result any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"ok": true, "result": result})
+}
+
+func writeError(w http.ResponseWriter, code int, description string, retryAfter int) {
+	response := map[string]any{"ok": false, "error_code": code, "description": description}
+	if retryAfter > 0 {
+		response["parameters"] = map[string]any{"retry_after": retryAfter}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+func minDuration(a, b time.Duration) time.Duration {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,75 @@
+package tg
+
+import (
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/profectus200/contact-book-bot/internal/types"
+)
+
+// Start starts polling the Bot API and converts the received updates for the worker.
+// Updates the bot does not handle are skipped.
+func (c *Client) Start() <-chan types.Update {
+	u := tgbotapi.NewUpdate(0)
+	u.Timeout = 60
+
+	updates := make(chan types.Update)
+	go func() {
+		defer close(updates)
+
+		for update := range c.client.GetUpdatesChan(u) {
+			converted, ok := convertUpdate(update)
+			if !ok {
+				continue
+			}
+
+			select {
+			case updates <- converted:
+			case <-c.stopped:
+				return
+			}
+		}
+	}()
+
+	return updates
+}
+
+// Stop stops polling the Bot API, calling it again does nothing.
+func (c *Client) Stop() {
+	c.stopOnce.Do(func() {
+		c.logger.Info("Stop receiving updates")
+		close(c.stopped)
+		c.client.StopReceivingUpdates()
+	})
+}
+
+func convertUpdate(update tgbotapi.Update) (types.Update, bool) {
+	converted := types.Update{UpdateID: update.UpdateID}
+
+	switch {
+	case update.Message != nil && update.Message.From != nil:
+		converted.Message = &types.UpdateMessage{
+			MessageID:    update.Message.MessageID,
+			UserID:       update.Message.From.ID,
+			UserName:     update.Message.From.UserName,
+			LanguageCode: update.Message.From.LanguageCode,
+			Text:         update.Message.Text,
+		}
+		if photo := update.Message.Photo; len(photo) > 0 {
+			// The sizes go from the smallest to the largest.
+			converted.Message.PhotoID = photo[len(photo)-1].FileID
+			converted.Message.Text = update.Message.Caption
+		}
+	case update.CallbackQuery != nil && update.CallbackQuery.Message != nil:
+		converted.Callback = &types.UpdateCallback{
+			CallbackID:   update.CallbackQuery.ID,
+			UserID:       update.CallbackQuery.From.ID,
+			UserName:     update.CallbackQuery.From.UserName,
+			LanguageCode: update.CallbackQuery.From.LanguageCode,
+			MessageID:    update.CallbackQuery.Message.MessageID,
+			Data:         update.CallbackQuery.Data,
+		}
+	default:
+		return converted, false
+	}
+
+	return converted, true
+}
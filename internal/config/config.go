@@ -1,15 +1,24 @@
 package config
 
 import (
+	"crypto/sha256"
 	"github.com/pkg/errors"
 	"gopkg.in/yaml.v3"
 	"os"
+	"strings"
 )
 
 const configFile = "data/config.yaml"
 
 type Config struct {
-	Token string `yaml:"token"`
+	Token       string `yaml:"token"`
+	APIEndpoint string `yaml:"api_endpoint"`
+	// CallbackSecret signs the data of the buttons. It is derived from the token when empty.
+	CallbackSecret string `yaml:"callback_secret"`
+
+	// Storage is the storage driver: postgres (the default), sqlite or memory.
+	Storage    string `yaml:"storage"`
+	SQLitePath string `yaml:"sqlite_path"`
 
 	Host     string `yaml:"host"`
 	Port     int    `yaml:"port"`
@@ -17,6 +26,36 @@ type Config struct {
 	Password string `yaml:"password"`
 	Database string `yaml:"database"`
 	SslMode  string `yaml:"sslmode"`
+
+	LogLevel  string `yaml:"log_level"`
+	LogFormat string `yaml:"log_format"`
+
+	// HTTPAddr is the address the HTTP server listens on, e.g. ":8080". The bot serves
+	// nothing over HTTP when it is empty.
+	HTTPAddr string `yaml:"http_addr"`
+	// PublicURL is where the HTTP server is reachable from the outside, e.g.
+	// https://bot.example.com, for the links the bot sends.
+	PublicURL string `yaml:"public_url"`
+
+	// WebhooksAllowPrivate lets the webhooks of the users point to the loopback and the
+	// private networks. They are refused by default, so that the users cannot reach the
+	// services next to the bot.
+	WebhooksAllowPrivate bool `yaml:"webhooks_allow_private"`
+
+	// Admins are the Telegram IDs of the operators of the bot, who may see the statistics,
+	// send messages to all the users and ban them.
+	Admins []int64 `yaml:"admins"`
+	// Access is who may use the bot. The admins may change the mode and add to the
+	// allowlist in the chat.
+	Access AccessConfig `yaml:"access"`
+}
+
+type AccessConfig struct {
+	// Mode is open (the default), allowlist or invite.
+	Mode string `yaml:"mode"`
+	// Users and Usernames are always let in, whatever the admins change in the chat.
+	Users     []int64  `yaml:"users"`
+	Usernames []string `yaml:"usernames"`
 }
 
 type Service struct {
@@ -43,6 +82,31 @@ func (s *Service) Token() string {
 	return s.Config.Token
 }
 
+// APIEndpoint is the Bot API URL format, e.g. of a self-hosted Bot API server.
+// The default Telegram endpoint is used when it is empty.
+func (s *Service) APIEndpoint() string {
+	return s.Config.APIEndpoint
+}
+
+// CallbackSecret is the key the data of the buttons is signed with. Without one in the
+// config the key is derived from the token, which is as secret and changes with the bot.
+func (s *Service) CallbackSecret() []byte {
+	if s.Config.CallbackSecret != "" {
+		return []byte(s.Config.CallbackSecret)
+	}
+
+	key := sha256.Sum256([]byte("callback-data:" + s.Config.Token))
+	return key[:]
+}
+
+func (s *Service) StorageDriver() string {
+	return s.Config.Storage
+}
+
+func (s *Service) SQLitePath() string {
+	return s.Config.SQLitePath
+}
+
 func (s *Service) GetHost() string {
 	return s.Config.Host
 }
@@ -50,3 +114,49 @@ func (s *Service) GetHost() string {
 func (s *Service) GetPort() int {
 	return s.Config.Port
 }
+
+func (s *Service) LogLevel() string {
+	return s.Config.LogLevel
+}
+
+func (s *Service) LogFormat() string {
+	return s.Config.LogFormat
+}
+
+func (s *Service) HTTPAddr() string {
+	return s.Config.HTTPAddr
+}
+
+// PublicURL is the base of the links to the HTTP server, without the trailing slash.
+// It is empty when the server is not reachable from the outside.
+func (s *Service) PublicURL() string {
+	if s.Config.HTTPAddr == "" {
+		return ""
+	}
+	return strings.TrimSuffix(s.Config.PublicURL, "/")
+}
+
+// WebhooksAllowPrivate is whether the webhooks may point to the private networks.
+func (s *Service) WebhooksAllowPrivate() bool {
+	return s.Config.WebhooksAllowPrivate
+}
+
+// Admins are the Telegram IDs of the users allowed the commands of the admins.
+func (s *Service) Admins() []int64 {
+	return s.Config.Admins
+}
+
+// AccessMode is the access mode until the admins set another one, open when it is empty.
+func (s *Service) AccessMode() string {
+	return s.Config.Access.Mode
+}
+
+// AccessUsers are the IDs of the users always let in.
+func (s *Service) AccessUsers() []int64 {
+	return s.Config.Access.Users
+}
+
+// AccessUsernames are the usernames of the users always let in, with or without the @.
+func (s *Service) AccessUsernames() []string {
+	return s.Config.Access.Usernames
+}
@@ -0,0 +1,321 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+	"github.com/profectus200/contact-book-bot/internal/types"
+)
+
+type accessDB struct {
+	db *sql.DB
+}
+
+func NewAccessDB(db *sql.DB) *accessDB {
+	return &accessDB{
+		db: db,
+	}
+}
+
+// GetAccessMode returns the mode set by the admins, empty when they have not set any.
+func (db *accessDB) GetAccessMode(ctx context.Context) (types.AccessMode, error) {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"GetAccessMode",
+	)
+	defer span.Finish()
+
+	const query = `
+		SELECT
+			mode
+		FROM
+			access_policy
+		WHERE
+			id = 1
+	`
+
+	var mode types.AccessMode
+	err := conn(ctx, db.db).QueryRowContext(ctx, query).Scan(&mode)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", errors.Wrap(err, "cannot Scan")
+	}
+
+	return mode, nil
+}
+
+// SetAccessMode replaces the mode set by the admins, an empty mode brings back the one
+// from the config.
+func (db *accessDB) SetAccessMode(ctx context.Context, mode types.AccessMode) error {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"SetAccessMode",
+	)
+	defer span.Finish()
+
+	if mode == "" {
+		const deleteQuery = `
+			DELETE FROM access_policy
+		`
+
+		_, err := conn(ctx, db.db).ExecContext(ctx, deleteQuery)
+		if err != nil {
+			return errors.Wrap(err, "cannot ExecContent")
+		}
+		return nil
+	}
+
+	const query = `
+		INSERT INTO access_policy(
+			id,
+			mode
+		) VALUES (
+			1, $1
+		)
+		ON CONFLICT(id) DO UPDATE SET
+			mode = excluded.mode
+	`
+
+	_, err := conn(ctx, db.db).ExecContext(ctx, query,
+		string(mode),
+	)
+	if err != nil {
+		return errors.Wrap(err, "cannot ExecContent")
+	}
+
+	return nil
+}
+
+// GetAllowlist returns the users let in by the admins or with an invite, in the order of adding.
+func (db *accessDB) GetAllowlist(ctx context.Context) ([]types.AllowlistEntry, error) {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"GetAllowlist",
+	)
+	defer span.Finish()
+
+	const query = `
+		SELECT
+			tg_user_id,
+			username
+		FROM
+			allowlist
+		ORDER BY
+			entry_id
+	`
+
+	rows, err := conn(ctx, db.db).QueryContext(ctx, query)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot QueryContext")
+	}
+	defer rows.Close()
+
+	var entries []types.AllowlistEntry
+	for rows.Next() {
+		var (
+			userID   sql.NullInt64
+			username sql.NullString
+		)
+		if err := rows.Scan(&userID, &username); err != nil {
+			return nil, errors.Wrap(err, "cannot Scan")
+		}
+		entries = append(entries, types.AllowlistEntry{UserID: userID.Int64, Username: username.String})
+	}
+
+	return entries, errors.Wrap(rows.Err(), "cannot Next")
+}
+
+// IsAllowed tells whether the user is on the allowlist by the ID or by the username.
+func (db *accessDB) IsAllowed(ctx context.Context, userID int64, username string) (bool, error) {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"IsAllowed",
+	)
+	defer span.Finish()
+
+	const query = `
+		SELECT
+			COUNT(*)
+		FROM
+			allowlist
+		WHERE
+			tg_user_id = $1 OR username = $2
+	`
+
+	var count int
+	err := conn(ctx, db.db).QueryRowContext(ctx, query,
+		userID,
+		sql.NullString{String: types.NormalizeUsername(username), Valid: username != ""},
+	).Scan(&count)
+	if err != nil {
+		return false, errors.Wrap(err, "cannot Scan")
+	}
+
+	return count > 0, nil
+}
+
+// Allow adds the entry to the allowlist, it does nothing when the entry is there already.
+func (db *accessDB) Allow(ctx context.Context, entry types.AllowlistEntry, now time.Time) error {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"Allow",
+	)
+	defer span.Finish()
+
+	const query = `
+		INSERT INTO allowlist(
+			tg_user_id,
+			username,
+			created_at
+		) VALUES (
+			$1, $2, $3
+		)
+		ON CONFLICT DO NOTHING
+	`
+
+	userID, username := entryColumns(entry)
+	_, err := conn(ctx, db.db).ExecContext(ctx, query,
+		userID,
+		username,
+		now.UTC(),
+	)
+	if err != nil {
+		return errors.Wrap(err, "cannot ExecContent")
+	}
+
+	return nil
+}
+
+// Disallow removes the entry from the allowlist, it is false when the entry is not there.
+func (db *accessDB) Disallow(ctx context.Context, entry types.AllowlistEntry) (bool, error) {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"Disallow",
+	)
+	defer span.Finish()
+
+	const query = `
+		DELETE FROM allowlist
+		WHERE
+			tg_user_id = $1 OR username = $2
+	`
+
+	userID, username := entryColumns(entry)
+	result, err := conn(ctx, db.db).ExecContext(ctx, query,
+		userID,
+		username,
+	)
+	if err != nil {
+		return false, errors.Wrap(err, "cannot ExecContent")
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "cannot RowsAffected")
+	}
+	return deleted > 0, nil
+}
+
+// entryColumns are the columns of the entry, NULL for the one not set.
+func entryColumns(entry types.AllowlistEntry) (sql.NullInt64, sql.NullString) {
+	if entry.Username != "" {
+		return sql.NullInt64{}, sql.NullString{String: types.NormalizeUsername(entry.Username), Valid: true}
+	}
+	return sql.NullInt64{Int64: entry.UserID, Valid: true}, sql.NullString{}
+}
+
+// AddInvite adds the invite, unused.
+func (db *accessDB) AddInvite(ctx context.Context, invite types.Invite) error {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"AddInvite",
+	)
+	defer span.Finish()
+
+	const query = `
+		INSERT INTO invites(
+			code,
+			created_by,
+			created_at,
+			expires_at
+		) VALUES (
+			$1, $2, $3, $4
+		)
+	`
+
+	_, err := conn(ctx, db.db).ExecContext(ctx, query,
+		invite.Code,
+		invite.CreatedBy,
+		invite.CreatedAt.UTC(),
+		invite.ExpiresAt.UTC(),
+	)
+	if err != nil {
+		return errors.Wrap(err, "cannot ExecContent")
+	}
+
+	return nil
+}
+
+// UseInvite marks the invite used by the user. It is false when there is no such invite,
+// it has been used or it has expired by now.
+func (db *accessDB) UseInvite(ctx context.Context, code string, userID int64, now time.Time) (bool, error) {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"UseInvite",
+	)
+	defer span.Finish()
+
+	const query = `
+		UPDATE invites
+		SET
+			used_by = $1,
+			used_at = $2
+		WHERE
+			code = $3 AND used_by IS NULL AND expires_at > $2
+	`
+
+	result, err := conn(ctx, db.db).ExecContext(ctx, query,
+		userID,
+		now.UTC(),
+		code,
+	)
+	if err != nil {
+		return false, errors.Wrap(err, "cannot ExecContent")
+	}
+
+	used, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "cannot RowsAffected")
+	}
+	return used > 0, nil
+}
+
+// ForgetInvites deletes the invites the user has made or used. The allowlist is kept:
+// it is the decision of the admins, not the data of the user.
+func (db *accessDB) ForgetInvites(ctx context.Context, userID int64) error {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"ForgetInvites",
+	)
+	defer span.Finish()
+
+	const query = `
+		DELETE FROM invites
+		WHERE
+			created_by = $1 OR used_by = $1
+	`
+
+	_, err := conn(ctx, db.db).ExecContext(ctx, query,
+		userID,
+	)
+	if err != nil {
+		return errors.Wrap(err, "cannot ExecContent")
+	}
+
+	return nil
+}
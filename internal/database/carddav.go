@@ -0,0 +1,104 @@
+package database
+
+import (
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+	"github.com/profectus200/contact-book-bot/internal/types"
+	"golang.org/x/net/context"
+)
+
+// GetCardResources returns the names CardDAV clients have given to the vCards of the contacts.
+func (db *contactsDB) GetCardResources(ctx context.Context, userID int64) ([]types.CardResource, error) {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"GetCardResources",
+	)
+	defer span.Finish()
+
+	const query = `
+		SELECT
+			contact_id,
+			name,
+			uid
+		FROM
+			carddav_resources
+		WHERE
+			tg_user_id = $1
+		ORDER BY
+			contact_id
+	`
+
+	rows, err := conn(ctx, db.db).QueryContext(ctx, query,
+		userID,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot QueryContext")
+	}
+	defer rows.Close()
+
+	var resources []types.CardResource
+	for rows.Next() {
+		var resource types.CardResource
+		if err := rows.Scan(&resource.ContactID, &resource.Name, &resource.UID); err != nil {
+			return nil, errors.Wrap(err, "cannot Scan")
+		}
+		resources = append(resources, resource)
+	}
+
+	return resources, errors.Wrap(rows.Err(), "cannot Next")
+}
+
+// WriteCardResource names the vCard of the contact, replacing the name it had.
+func (db *contactsDB) WriteCardResource(ctx context.Context, userID int64, resource types.CardResource) error {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"WriteCardResource",
+	)
+	defer span.Finish()
+
+	const query = `
+		INSERT INTO carddav_resources(
+			tg_user_id,
+			contact_id,
+			name,
+			uid
+		)
+		SELECT
+			$1, $2, $3, $4
+		WHERE EXISTS (
+			SELECT 1 FROM contacts WHERE tg_user_id = $1 AND contact_id = $2
+		)
+		ON CONFLICT (tg_user_id, contact_id) DO UPDATE SET
+			name = excluded.name,
+			uid = excluded.uid
+	`
+
+	_, err := conn(ctx, db.db).ExecContext(ctx, query,
+		userID,
+		resource.ContactID,
+		resource.Name,
+		resource.UID,
+	)
+	if err != nil {
+		return errors.Wrap(err, "cannot ExecContent")
+	}
+
+	return nil
+}
+
+// deleteCardResource deletes the name of the vCard of the deleted contact.
+func (db *contactsDB) deleteCardResource(ctx context.Context, userID int64, contactID int) error {
+	const query = `
+		DELETE FROM
+			carddav_resources
+		WHERE
+			tg_user_id = $1 AND
+			contact_id = $2
+	`
+
+	_, err := conn(ctx, db.db).ExecContext(ctx, query,
+		userID,
+		contactID,
+	)
+	return errors.Wrap(err, "cannot ExecContent")
+}
@@ -10,12 +10,16 @@ import (
 )
 
 type contactsDB struct {
-	db *sql.DB
+	db      *sql.DB
+	tx      *txManager
+	dialect dialect
 }
 
 func NewContactsDB(db *sql.DB) *contactsDB {
 	return &contactsDB{
-		db: db,
+		db:      db,
+		tx:      NewTxManager(db),
+		dialect: dialectPostgres,
 	}
 }
 
@@ -31,27 +35,65 @@ func (db *contactsDB) WriteContact(ctx context.Context, fromID int64, contact *t
 			tg_user_id,
 			contact_id,
 			name,
+			email,
 			phone,
-		    birthday,
-		    description
+			birthday_day,
+			birthday_month,
+			birthday_year,
+		    description,
+			photo_file_id
 		) values (
-			$1, $2, $3, $4, $5, $6
-		);
+			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10
+		)
+		ON CONFLICT (tg_user_id, contact_id) DO UPDATE SET
+			name = excluded.name,
+			email = excluded.email,
+			phone = excluded.phone,
+			birthday_day = excluded.birthday_day,
+			birthday_month = excluded.birthday_month,
+			birthday_year = excluded.birthday_year,
+			description = excluded.description,
+			photo_file_id = excluded.photo_file_id
 	`
 
-	_, err := db.db.ExecContext(ctx, query,
-		fromID,
-		contact.ContactID,
-		contact.Name,
-		contact.Phone,
-		contact.Birthday,
-		contact.Description,
-	)
-	if err != nil {
-		return errors.Wrap(err, "cannot ExecContent")
-	}
+	day, month, year := birthdayArgs(contact.Birthday)
+	return db.changed(ctx, fromID, contact.ContactID, types.ContactCreated, func(ctx context.Context) error {
+		_, err := conn(ctx, db.db).ExecContext(ctx, query,
+			fromID,
+			contact.ContactID,
+			contact.Name,
+			contact.Email,
+			contact.Phone,
+			day,
+			month,
+			year,
+			contact.Description,
+			contact.PhotoID,
+		)
+		if err != nil {
+			return errors.Wrap(err, "cannot ExecContent")
+		}
+
+		// A contact written over another one with its ID replaces it whole, as in the memory storage.
+		if err := db.deleteCustomFields(ctx, fromID, contact.ContactID); err != nil {
+			return errors.Wrap(err, "cannot deleteCustomFields")
+		}
+		if err := db.deleteEvents(ctx, fromID, contact.ContactID); err != nil {
+			return errors.Wrap(err, "cannot deleteEvents")
+		}
+		for _, field := range contact.CustomFields {
+			if err := db.writeCustomField(ctx, fromID, contact.ContactID, field); err != nil {
+				return errors.Wrap(err, "cannot writeCustomField")
+			}
+		}
+		for _, event := range contact.Events {
+			if err := db.writeEvent(ctx, fromID, contact.ContactID, event); err != nil {
+				return errors.Wrap(err, "cannot writeEvent")
+			}
+		}
 
-	return nil
+		return errors.Wrap(db.updateSearchText(ctx, fromID, contact.ContactID), "cannot updateSearchText")
+	})
 }
 
 func (db *contactsDB) GetContact(ctx context.Context, userID int64, contactID int) (*types.Contact, error) {
@@ -64,21 +106,27 @@ func (db *contactsDB) GetContact(ctx context.Context, userID int64, contactID in
 	const query = `
 		SELECT 
 			name,
+			email,
 			phone,
-			birthday,
-			description
+			birthday_day,
+			birthday_month,
+			birthday_year,
+			description,
+			photo_file_id
 		FROM contacts
 		WHERE 
 			tg_user_id = $1 AND contact_id = $2
 	`
 
-	contact := types.NewContact()
+	contact := &types.Contact{}
 
-	err := db.db.QueryRowContext(ctx, query,
+	var day, month, year sql.NullInt32
+	err := conn(ctx, db.db).QueryRowContext(ctx, query,
 		userID,
 		contactID,
-	).Scan(&contact.Name, &contact.Phone, &contact.Birthday, &contact.Description)
+	).Scan(&contact.Name, &contact.Email, &contact.Phone, &day, &month, &year, &contact.Description, &contact.PhotoID)
 	contact.ContactID = contactID
+	contact.Birthday = scanBirthday(day, month, year)
 
 	if err != nil {
 		if err != sql.ErrNoRows {
@@ -89,6 +137,10 @@ func (db *contactsDB) GetContact(ctx context.Context, userID int64, contactID in
 		return nil, nil
 	}
 
+	if err := db.attachDetails(ctx, userID, contact); err != nil {
+		return nil, errors.Wrap(err, "cannot attachDetails")
+	}
+
 	return contact, nil
 }
 
@@ -103,15 +155,19 @@ func (db *contactsDB) GetAllContacts(ctx context.Context, userID int64) ([]*type
 		SELECT 
 			contact_id,
 			name,
+			email,
 			phone,
-			birthday,
-			description
+			birthday_day,
+			birthday_month,
+			birthday_year,
+			description,
+			photo_file_id
 		FROM contacts
 		WHERE 
 			tg_user_id = $1
 	`
 
-	rows, err := db.db.QueryContext(ctx, query, userID)
+	rows, err := conn(ctx, db.db).QueryContext(ctx, query, userID)
 	if err != nil {
 		return nil, errors.Wrap(err, "cannot QueryContext")
 	}
@@ -119,11 +175,13 @@ func (db *contactsDB) GetAllContacts(ctx context.Context, userID int64) ([]*type
 
 	contacts := []*types.Contact{}
 	for rows.Next() {
-		contact := types.NewContact()
-		err := rows.Scan(&contact.ContactID, &contact.Name, &contact.Phone, &contact.Birthday, &contact.Description)
+		contact := &types.Contact{}
+		var day, month, year sql.NullInt32
+		err := rows.Scan(&contact.ContactID, &contact.Name, &contact.Email, &contact.Phone, &day, &month, &year, &contact.Description, &contact.PhotoID)
 		if err != nil {
 			return nil, errors.Wrap(err, "failed to scan contact row")
 		}
+		contact.Birthday = scanBirthday(day, month, year)
 		contacts = append(contacts, contact)
 	}
 
@@ -131,6 +189,10 @@ func (db *contactsDB) GetAllContacts(ctx context.Context, userID int64) ([]*type
 		return nil, errors.Wrap(err, "cannot Scan")
 	}
 
+	if err := db.attachDetails(ctx, userID, contacts...); err != nil {
+		return nil, errors.Wrap(err, "cannot attachDetails")
+	}
+
 	return contacts, nil
 }
 
@@ -144,15 +206,19 @@ func (db *contactsDB) GetContactByName(ctx context.Context, userID int64, name s
 	const query = `
 		SELECT 
 			contact_id,
+			email,
 			phone,
-			birthday,
-			description
+			birthday_day,
+			birthday_month,
+			birthday_year,
+			description,
+			photo_file_id
 		FROM contacts
 		WHERE 
 			tg_user_id = $1 AND name = $2
 	`
 
-	rows, err := db.db.QueryContext(ctx, query, userID, name)
+	rows, err := conn(ctx, db.db).QueryContext(ctx, query, userID, name)
 	if err != nil {
 		return nil, errors.Wrap(err, "cannot QueryContext")
 	}
@@ -160,19 +226,105 @@ func (db *contactsDB) GetContactByName(ctx context.Context, userID int64, name s
 
 	contacts := []*types.Contact{}
 	for rows.Next() {
-		contact := types.NewContact()
-		err := rows.Scan(&contact.ContactID, &contact.Phone, &contact.Birthday, &contact.Description)
+		contact := &types.Contact{}
+		var day, month, year sql.NullInt32
+		err := rows.Scan(&contact.ContactID, &contact.Email, &contact.Phone, &day, &month, &year, &contact.Description, &contact.PhotoID)
 		if err != nil {
 			return nil, errors.Wrap(err, "cannot Scan")
 		}
 
 		contact.Name = name
+		contact.Birthday = scanBirthday(day, month, year)
 		contacts = append(contacts, contact)
 	}
 
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "cannot Scan")
+	}
+
+	if err := db.attachDetails(ctx, userID, contacts...); err != nil {
+		return nil, errors.Wrap(err, "cannot attachDetails")
+	}
+
 	return contacts, nil
 }
 
+// SearchContacts finds the contacts with every term of the query in the name, the description
+// or the values of the custom fields, the best matches first. Postgres searches the full-text
+// index, SQLite has none and searches the contacts of the user the same way in Go.
+func (db *contactsDB) SearchContacts(ctx context.Context, userID int64, query types.SearchQuery) ([]types.SearchResult, error) {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"SearchContacts",
+	)
+	defer span.Finish()
+
+	if db.dialect == dialectSQLite {
+		contacts, err := db.GetAllContacts(ctx, userID)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot GetAllContacts")
+		}
+		return types.SearchContacts(contacts, query), nil
+	}
+
+	// The snippets are made in Go like the words of the index are, so that they are the same
+	// in every storage.
+	const sqlQuery = `
+		SELECT
+			contact_id,
+			name,
+			email,
+			phone,
+			birthday_day,
+			birthday_month,
+			birthday_year,
+			description,
+			photo_file_id
+		FROM
+			contacts,
+			to_tsquery('simple', $2) query
+		WHERE
+			tg_user_id = $1 AND
+			search @@ query
+		ORDER BY
+			ts_rank(search, query) DESC,
+			contact_id
+	`
+
+	rows, err := conn(ctx, db.db).QueryContext(ctx, sqlQuery, userID, query.TSQuery())
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot QueryContext")
+	}
+	defer rows.Close()
+
+	results := []types.SearchResult{}
+	for rows.Next() {
+		contact := &types.Contact{}
+		var day, month, year sql.NullInt32
+		err := rows.Scan(&contact.ContactID, &contact.Name, &contact.Email, &contact.Phone, &day, &month, &year,
+			&contact.Description, &contact.PhotoID)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot Scan")
+		}
+		contact.Birthday = scanBirthday(day, month, year)
+		results = append(results, types.SearchResult{Contact: contact, Snippet: types.Snippet(contact.Description, query)})
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "cannot Scan")
+	}
+
+	contacts := make([]*types.Contact, 0, len(results))
+	for _, result := range results {
+		contacts = append(contacts, result.Contact)
+	}
+	if err := db.attachDetails(ctx, userID, contacts...); err != nil {
+		return nil, errors.Wrap(err, "cannot attachDetails")
+	}
+
+	return results, nil
+}
+
 func (db *contactsDB) DeleteContact(ctx context.Context, userID int64, contactID int) error {
 	span, ctx := opentracing.StartSpanFromContext(
 		ctx,
@@ -187,16 +339,41 @@ func (db *contactsDB) DeleteContact(ctx context.Context, userID int64, contactID
 			tg_user_id = $1 AND
 			contact_id = $2
 	`
-	_, err := db.db.ExecContext(ctx, query,
-		userID,
-		contactID,
-	)
 
-	if err != nil {
-		return errors.Wrap(err, "cannot ExecContent")
-	}
+	return db.tx.InTx(ctx, func(ctx context.Context) error {
+		if err := db.deleteCustomFields(ctx, userID, contactID); err != nil {
+			return errors.Wrap(err, "cannot deleteCustomFields")
+		}
+		if err := db.deleteEvents(ctx, userID, contactID); err != nil {
+			return errors.Wrap(err, "cannot deleteEvents")
+		}
+		if err := db.deleteInteractions(ctx, userID, contactID); err != nil {
+			return errors.Wrap(err, "cannot deleteInteractions")
+		}
+		if err := db.deleteReminders(ctx, userID, contactID); err != nil {
+			return errors.Wrap(err, "cannot deleteReminders")
+		}
+		if err := db.deleteCardResource(ctx, userID, contactID); err != nil {
+			return errors.Wrap(err, "cannot deleteCardResource")
+		}
 
-	return nil
+		result, err := conn(ctx, db.db).ExecContext(ctx, query,
+			userID,
+			contactID,
+		)
+		if err != nil {
+			return errors.Wrap(err, "cannot ExecContent")
+		}
+
+		deleted, err := result.RowsAffected()
+		if err != nil {
+			return errors.Wrap(err, "cannot RowsAffected")
+		}
+		if deleted == 0 {
+			return nil
+		}
+		return errors.Wrap(db.enqueueEvent(ctx, userID, contactID, types.ContactDeleted), "cannot enqueueEvent")
+	})
 }
 
 func (db *contactsDB) WriteName(ctx context.Context, name string, userID int64, contactID int) error {
@@ -216,17 +393,45 @@ func (db *contactsDB) WriteName(ctx context.Context, name string, userID int64,
 			contact_id = $3
 	`
 
-	_, err := db.db.ExecContext(ctx, query,
-		name,
-		userID,
-		contactID,
+	return db.changed(ctx, userID, contactID, types.ContactUpdated, func(ctx context.Context) error {
+		_, err := conn(ctx, db.db).ExecContext(ctx, query,
+			name,
+			userID,
+			contactID,
+		)
+		if err != nil {
+			return errors.Wrap(err, "cannot ExecContent")
+		}
+
+		return errors.Wrap(db.updateSearchText(ctx, userID, contactID), "cannot updateSearchText")
+	})
+}
+
+func (db *contactsDB) WriteEmail(ctx context.Context, email string, userID int64, contactID int) error {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"WriteEmail",
 	)
+	defer span.Finish()
 
-	if err != nil {
-		return errors.Wrap(err, "cannot ExecContent")
-	}
+	const query = `
+		UPDATE 
+			contacts
+		SET
+			email = $1
+		WHERE
+			tg_user_id = $2 AND
+			contact_id = $3
+	`
 
-	return nil
+	return db.changed(ctx, userID, contactID, types.ContactUpdated, func(ctx context.Context) error {
+		_, err := conn(ctx, db.db).ExecContext(ctx, query,
+			email,
+			userID,
+			contactID,
+		)
+		return errors.Wrap(err, "cannot ExecContent")
+	})
 }
 
 func (db *contactsDB) WritePhone(ctx context.Context, phone string, userID int64, contactID int) error {
@@ -246,20 +451,18 @@ func (db *contactsDB) WritePhone(ctx context.Context, phone string, userID int64
 			contact_id = $3
 	`
 
-	_, err := db.db.ExecContext(ctx, query,
-		phone,
-		userID,
-		contactID,
-	)
-
-	if err != nil {
+	return db.changed(ctx, userID, contactID, types.ContactUpdated, func(ctx context.Context) error {
+		_, err := conn(ctx, db.db).ExecContext(ctx, query,
+			phone,
+			userID,
+			contactID,
+		)
 		return errors.Wrap(err, "cannot ExecContent")
-	}
-
-	return nil
+	})
 }
 
-func (db *contactsDB) WriteBirthday(ctx context.Context, birthday time.Time, userID int64, contactID int) error {
+// WriteBirthday writes the birthday of the contact, nil removes it.
+func (db *contactsDB) WriteBirthday(ctx context.Context, birthday *types.Birthday, userID int64, contactID int) error {
 	span, ctx := opentracing.StartSpanFromContext(
 		ctx,
 		"WriteBirthday",
@@ -270,23 +473,25 @@ func (db *contactsDB) WriteBirthday(ctx context.Context, birthday time.Time, use
 		UPDATE 
 			contacts
 		SET
-			birthday = $1
+			birthday_day = $1,
+			birthday_month = $2,
+			birthday_year = $3
 		WHERE
-			tg_user_id = $2 AND
-			contact_id = $3
+			tg_user_id = $4 AND
+			contact_id = $5
 	`
 
-	_, err := db.db.ExecContext(ctx, query,
-		birthday,
-		userID,
-		contactID,
-	)
-
-	if err != nil {
+	day, month, year := birthdayArgs(birthday)
+	return db.changed(ctx, userID, contactID, types.ContactUpdated, func(ctx context.Context) error {
+		_, err := conn(ctx, db.db).ExecContext(ctx, query,
+			day,
+			month,
+			year,
+			userID,
+			contactID,
+		)
 		return errors.Wrap(err, "cannot ExecContent")
-	}
-
-	return nil
+	})
 }
 
 func (db *contactsDB) WriteDescription(ctx context.Context, description string, userID int64, contactID int) error {
@@ -306,15 +511,166 @@ func (db *contactsDB) WriteDescription(ctx context.Context, description string,
 			contact_id = $3
 	`
 
-	_, err := db.db.ExecContext(ctx, query,
-		description,
-		userID,
-		contactID,
+	return db.changed(ctx, userID, contactID, types.ContactUpdated, func(ctx context.Context) error {
+		_, err := conn(ctx, db.db).ExecContext(ctx, query,
+			description,
+			userID,
+			contactID,
+		)
+		if err != nil {
+			return errors.Wrap(err, "cannot ExecContent")
+		}
+
+		return errors.Wrap(db.updateSearchText(ctx, userID, contactID), "cannot updateSearchText")
+	})
+}
+
+// WritePhoto sets the Telegram file_id of the photo of the contact, empty to remove the photo.
+func (db *contactsDB) WritePhoto(ctx context.Context, photoID string, userID int64, contactID int) error {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"WritePhoto",
 	)
+	defer span.Finish()
 
-	if err != nil {
+	const query = `
+		UPDATE 
+			contacts
+		SET
+			photo_file_id = $1
+		WHERE
+			tg_user_id = $2 AND
+			contact_id = $3
+	`
+
+	return db.changed(ctx, userID, contactID, types.ContactUpdated, func(ctx context.Context) error {
+		_, err := conn(ctx, db.db).ExecContext(ctx, query,
+			photoID,
+			userID,
+			contactID,
+		)
 		return errors.Wrap(err, "cannot ExecContent")
+	})
+}
+
+// MergeContacts merges the other contact into the kept one and deletes it, see types.MergeContacts.
+// It returns the merged contact, or nil when either contact does not exist.
+func (db *contactsDB) MergeContacts(ctx context.Context, userID int64, keepID, otherID int) (*types.Contact, error) {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"MergeContacts",
+	)
+	defer span.Finish()
+
+	var merged *types.Contact
+	err := db.tx.InTx(ctx, func(ctx context.Context) error {
+		keep, err := db.GetContact(ctx, userID, keepID)
+		if err != nil {
+			return errors.Wrap(err, "cannot GetContact")
+		}
+		other, err := db.GetContact(ctx, userID, otherID)
+		if err != nil {
+			return errors.Wrap(err, "cannot GetContact")
+		}
+		if keep == nil || other == nil || keepID == otherID {
+			return nil
+		}
+
+		merged = types.MergeContacts(keep, other)
+
+		const query = `
+			UPDATE
+				contacts
+			SET
+				name = $1,
+				email = $2,
+				phone = $3,
+				birthday_day = $4,
+				birthday_month = $5,
+				birthday_year = $6,
+				description = $7,
+				photo_file_id = $8
+			WHERE
+				tg_user_id = $9 AND
+				contact_id = $10
+		`
+
+		day, month, year := birthdayArgs(merged.Birthday)
+		_, err = conn(ctx, db.db).ExecContext(ctx, query,
+			merged.Name,
+			merged.Email,
+			merged.Phone,
+			day,
+			month,
+			year,
+			merged.Description,
+			merged.PhotoID,
+			userID,
+			keepID,
+		)
+		if err != nil {
+			return errors.Wrap(err, "cannot ExecContent")
+		}
+
+		for _, field := range merged.CustomFields {
+			if _, ok := keep.CustomField(field.Name); ok {
+				continue
+			}
+			if err := db.writeCustomField(ctx, userID, keepID, field); err != nil {
+				return errors.Wrap(err, "cannot writeCustomField")
+			}
+		}
+		for _, event := range merged.Events {
+			if _, ok := keep.Event(event.Name); ok {
+				continue
+			}
+			if err := db.writeEvent(ctx, userID, keepID, event); err != nil {
+				return errors.Wrap(err, "cannot writeEvent")
+			}
+		}
+		if err := db.updateSearchText(ctx, userID, keepID); err != nil {
+			return errors.Wrap(err, "cannot updateSearchText")
+		}
+
+		if err := db.moveInteractions(ctx, userID, otherID, keepID); err != nil {
+			return errors.Wrap(err, "cannot moveInteractions")
+		}
+		if err := db.moveReminders(ctx, userID, otherID, keepID); err != nil {
+			return errors.Wrap(err, "cannot moveReminders")
+		}
+		if err := db.enqueueEvent(ctx, userID, keepID, types.ContactUpdated); err != nil {
+			return errors.Wrap(err, "cannot enqueueEvent")
+		}
+
+		return errors.Wrap(db.DeleteContact(ctx, userID, otherID), "cannot DeleteContact")
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return merged, nil
+}
+
+// birthdayArgs splits the birthday into the nullable columns, the year is NULL when unknown.
+func birthdayArgs(birthday *types.Birthday) (day, month, year sql.NullInt32) {
+	if birthday == nil {
+		return
 	}
 
-	return nil
+	day = sql.NullInt32{Int32: int32(birthday.Day), Valid: true}
+	month = sql.NullInt32{Int32: int32(birthday.Month), Valid: true}
+	year = sql.NullInt32{Int32: int32(birthday.Year), Valid: birthday.HasYear()}
+	return
+}
+
+func scanBirthday(day, month, year sql.NullInt32) *types.Birthday {
+	if !day.Valid || !month.Valid {
+		return nil
+	}
+
+	return &types.Birthday{
+		Day:   int(day.Int32),
+		Month: time.Month(month.Int32),
+		Year:  int(year.Int32),
+	}
 }
@@ -0,0 +1,218 @@
+package database
+
+import (
+	"database/sql"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+	"github.com/profectus200/contact-book-bot/internal/types"
+	"golang.org/x/net/context"
+)
+
+// WriteCustomField adds the field to the contact or replaces the field with the same name.
+func (db *contactsDB) WriteCustomField(ctx context.Context, userID int64, contactID int, field types.CustomField) error {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"WriteCustomField",
+	)
+	defer span.Finish()
+
+	return db.changed(ctx, userID, contactID, types.ContactUpdated, func(ctx context.Context) error {
+		return db.writeCustomField(ctx, userID, contactID, field)
+	})
+}
+
+// writeCustomField is WriteCustomField without the webhook event, for the changes making their own.
+func (db *contactsDB) writeCustomField(ctx context.Context, userID int64, contactID int, field types.CustomField) error {
+	// The field is only added to an existing contact, like the other fields are only written to one.
+	const query = `
+		INSERT INTO contact_fields(
+			tg_user_id,
+			contact_id,
+			name,
+			type,
+			value
+		)
+		SELECT
+			$1, $2, $3, $4, $5
+		WHERE EXISTS (
+			SELECT 1 FROM contacts WHERE tg_user_id = $1 AND contact_id = $2
+		)
+		ON CONFLICT (tg_user_id, contact_id, name) DO UPDATE SET
+			type = excluded.type,
+			value = excluded.value
+	`
+
+	_, err := conn(ctx, db.db).ExecContext(ctx, query,
+		userID,
+		contactID,
+		field.Name,
+		string(field.Type),
+		field.Value,
+	)
+	if err != nil {
+		return errors.Wrap(err, "cannot ExecContent")
+	}
+
+	return db.updateSearchText(ctx, userID, contactID)
+}
+
+func (db *contactsDB) DeleteCustomField(ctx context.Context, userID int64, contactID int, name string) error {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"DeleteCustomField",
+	)
+	defer span.Finish()
+
+	const query = `
+		DELETE FROM
+			contact_fields
+		WHERE
+			tg_user_id = $1 AND
+			contact_id = $2 AND
+			name = $3
+	`
+
+	return db.changed(ctx, userID, contactID, types.ContactUpdated, func(ctx context.Context) error {
+		_, err := conn(ctx, db.db).ExecContext(ctx, query,
+			userID,
+			contactID,
+			name,
+		)
+		if err != nil {
+			return errors.Wrap(err, "cannot ExecContent")
+		}
+
+		return db.updateSearchText(ctx, userID, contactID)
+	})
+}
+
+// deleteCustomFields deletes the fields of the deleted contact.
+func (db *contactsDB) deleteCustomFields(ctx context.Context, userID int64, contactID int) error {
+	const query = `
+		DELETE FROM
+			contact_fields
+		WHERE
+			tg_user_id = $1 AND
+			contact_id = $2
+	`
+
+	_, err := conn(ctx, db.db).ExecContext(ctx, query,
+		userID,
+		contactID,
+	)
+	return errors.Wrap(err, "cannot ExecContent")
+}
+
+// updateSearchText writes the words of the name, the description and the values of the custom
+// fields into the contact for its full-text index, see types.SearchText. SQLite has no index
+// and searches the contacts themselves.
+func (db *contactsDB) updateSearchText(ctx context.Context, userID int64, contactID int) error {
+	if db.dialect == dialectSQLite {
+		return nil
+	}
+
+	const selectQuery = `
+		SELECT
+			coalesce(name, ''),
+			coalesce(description, ''),
+			coalesce((
+				SELECT
+					string_agg(value, ' ' ORDER BY name COLLATE "C")
+				FROM
+					contact_fields
+				WHERE
+					tg_user_id = $1 AND
+					contact_id = $2
+			), '')
+		FROM
+			contacts
+		WHERE
+			tg_user_id = $1 AND
+			contact_id = $2
+	`
+
+	var name, description, fields string
+	err := conn(ctx, db.db).QueryRowContext(ctx, selectQuery,
+		userID,
+		contactID,
+	).Scan(&name, &description, &fields)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "cannot Scan")
+	}
+
+	const updateQuery = `
+		UPDATE
+			contacts
+		SET
+			search_text = $3
+		WHERE
+			tg_user_id = $1 AND
+			contact_id = $2
+	`
+
+	_, err = conn(ctx, db.db).ExecContext(ctx, updateQuery,
+		userID,
+		contactID,
+		types.SearchText(name, description, fields),
+	)
+	return errors.Wrap(err, "cannot ExecContent")
+}
+
+// attachCustomFields loads the custom fields of the contacts of the user into them.
+func (db *contactsDB) attachCustomFields(ctx context.Context, userID int64, contacts ...*types.Contact) error {
+	if len(contacts) == 0 {
+		return nil
+	}
+
+	query := `
+		SELECT
+			contact_id,
+			name,
+			type,
+			value
+		FROM
+			contact_fields
+		WHERE
+			tg_user_id = $1
+	`
+	args := []any{userID}
+	// A single contact is loaded often, every list only once in a while.
+	if len(contacts) == 1 {
+		query += ` AND contact_id = $2`
+		args = append(args, contacts[0].ContactID)
+	}
+	// The names go byte by byte like types.SortCustomFields does, SQLite compares them so by default.
+	if db.dialect == dialectSQLite {
+		query += ` ORDER BY name`
+	} else {
+		query += ` ORDER BY name COLLATE "C"`
+	}
+
+	byID := make(map[int]*types.Contact, len(contacts))
+	for _, contact := range contacts {
+		byID[contact.ContactID] = contact
+	}
+
+	rows, err := conn(ctx, db.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return errors.Wrap(err, "cannot QueryContext")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var contactID int
+		var field types.CustomField
+		if err := rows.Scan(&contactID, &field.Name, &field.Type, &field.Value); err != nil {
+			return errors.Wrap(err, "cannot Scan")
+		}
+		if contact, ok := byID[contactID]; ok {
+			contact.CustomFields = append(contact.CustomFields, field)
+		}
+	}
+
+	return errors.Wrap(rows.Err(), "cannot Scan")
+}
@@ -8,6 +8,15 @@ import (
 	"github.com/profectus200/contact-book-bot/internal/config"
 )
 
+// dialect tells the SQL storages which database they talk to, for the few queries
+// which differ between Postgres and SQLite.
+type dialect int
+
+const (
+	dialectPostgres dialect = iota
+	dialectSQLite
+)
+
 func New(service *config.Service) (*sql.DB, error) {
 	dataSourceName := fmt.Sprintf("host=%s port=%d user=%s password=%s database=%s sslmode=%s",
 		service.Config.Host,
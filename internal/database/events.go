@@ -0,0 +1,163 @@
+package database
+
+import (
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+	"github.com/profectus200/contact-book-bot/internal/types"
+	"golang.org/x/net/context"
+)
+
+// WriteEvent adds the date to the contact or replaces the date with the same name.
+func (db *contactsDB) WriteEvent(ctx context.Context, userID int64, contactID int, event types.Event) error {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"WriteEvent",
+	)
+	defer span.Finish()
+
+	return db.changed(ctx, userID, contactID, types.ContactUpdated, func(ctx context.Context) error {
+		return db.writeEvent(ctx, userID, contactID, event)
+	})
+}
+
+// writeEvent is WriteEvent without the webhook event, for the changes making their own.
+func (db *contactsDB) writeEvent(ctx context.Context, userID int64, contactID int, event types.Event) error {
+	const query = `
+		INSERT INTO contact_events(
+			tg_user_id,
+			contact_id,
+			name,
+			date,
+			every,
+			unit
+		)
+		SELECT
+			$1, $2, $3, $4, $5, $6
+		WHERE EXISTS (
+			SELECT 1 FROM contacts WHERE tg_user_id = $1 AND contact_id = $2
+		)
+		ON CONFLICT (tg_user_id, contact_id, name) DO UPDATE SET
+			date = excluded.date,
+			every = excluded.every,
+			unit = excluded.unit
+	`
+
+	_, err := conn(ctx, db.db).ExecContext(ctx, query,
+		userID,
+		contactID,
+		event.Name,
+		event.Date.ISO(),
+		event.Recurrence.Every,
+		string(event.Recurrence.Unit),
+	)
+	if err != nil {
+		return errors.Wrap(err, "cannot ExecContent")
+	}
+
+	return nil
+}
+
+func (db *contactsDB) DeleteEvent(ctx context.Context, userID int64, contactID int, name string) error {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"DeleteEvent",
+	)
+	defer span.Finish()
+
+	const query = `
+		DELETE FROM
+			contact_events
+		WHERE
+			tg_user_id = $1 AND
+			contact_id = $2 AND
+			name = $3
+	`
+
+	return db.changed(ctx, userID, contactID, types.ContactUpdated, func(ctx context.Context) error {
+		_, err := conn(ctx, db.db).ExecContext(ctx, query,
+			userID,
+			contactID,
+			name,
+		)
+		return errors.Wrap(err, "cannot ExecContent")
+	})
+}
+
+// deleteEvents deletes the dates of the deleted contact.
+func (db *contactsDB) deleteEvents(ctx context.Context, userID int64, contactID int) error {
+	const query = `
+		DELETE FROM
+			contact_events
+		WHERE
+			tg_user_id = $1 AND
+			contact_id = $2
+	`
+
+	_, err := conn(ctx, db.db).ExecContext(ctx, query,
+		userID,
+		contactID,
+	)
+	return errors.Wrap(err, "cannot ExecContent")
+}
+
+// attachEvents loads the dates of the contacts of the user into them.
+func (db *contactsDB) attachEvents(ctx context.Context, userID int64, contacts ...*types.Contact) error {
+	if len(contacts) == 0 {
+		return nil
+	}
+
+	query := `
+		SELECT
+			contact_id,
+			name,
+			date,
+			every,
+			unit
+		FROM
+			contact_events
+		WHERE
+			tg_user_id = $1
+	`
+	args := []any{userID}
+	if len(contacts) == 1 {
+		query += ` AND contact_id = $2`
+		args = append(args, contacts[0].ContactID)
+	}
+	// The names go byte by byte like types.SortEvents does.
+	if db.dialect == dialectSQLite {
+		query += ` ORDER BY name`
+	} else {
+		query += ` ORDER BY name COLLATE "C"`
+	}
+
+	byID := make(map[int]*types.Contact, len(contacts))
+	for _, contact := range contacts {
+		byID[contact.ContactID] = contact
+	}
+
+	rows, err := conn(ctx, db.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return errors.Wrap(err, "cannot QueryContext")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			contactID int
+			date      string
+			event     types.Event
+		)
+		if err := rows.Scan(&contactID, &event.Name, &date, &event.Recurrence.Every, &event.Recurrence.Unit); err != nil {
+			return errors.Wrap(err, "cannot Scan")
+		}
+		var ok bool
+		if event.Date, ok = types.ParseISO(date); !ok {
+			return errors.Errorf("cannot parse date %q of event %q", date, event.Name)
+		}
+		if contact, ok := byID[contactID]; ok {
+			contact.Events = append(contact.Events, event)
+		}
+	}
+
+	return errors.Wrap(rows.Err(), "cannot Scan")
+}
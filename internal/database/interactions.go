@@ -0,0 +1,209 @@
+package database
+
+import (
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+	"github.com/profectus200/contact-book-bot/internal/types"
+	"golang.org/x/net/context"
+)
+
+// dateFormat is how the days of the interactions are passed to the storages, as a time
+// would be turned into a day in the time zone of the Postgres session.
+const dateFormat = "2006-01-02"
+
+func (db *contactsDB) AddInteraction(ctx context.Context, userID int64, contactID int, interaction types.Interaction) error {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"AddInteraction",
+	)
+	defer span.Finish()
+
+	const query = `
+		INSERT INTO interactions(
+			tg_user_id,
+			contact_id,
+			kind,
+			note,
+			happened_on
+		)
+		SELECT
+			$1, $2, $3, $4, $5
+		WHERE EXISTS (
+			SELECT 1 FROM contacts WHERE tg_user_id = $1 AND contact_id = $2
+		)
+	`
+
+	_, err := conn(ctx, db.db).ExecContext(ctx, query,
+		userID,
+		contactID,
+		string(interaction.Kind),
+		interaction.Note,
+		interaction.Date.Format(dateFormat),
+	)
+	if err != nil {
+		return errors.Wrap(err, "cannot ExecContent")
+	}
+
+	return nil
+}
+
+func (db *contactsDB) GetInteractions(ctx context.Context, userID int64, contactID int) ([]types.Interaction, error) {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"GetInteractions",
+	)
+	defer span.Finish()
+
+	const query = `
+		SELECT
+			interaction_id,
+			kind,
+			note,
+			happened_on
+		FROM
+			interactions
+		WHERE
+			tg_user_id = $1 AND
+			contact_id = $2
+		ORDER BY
+			happened_on DESC,
+			interaction_id DESC
+	`
+
+	rows, err := conn(ctx, db.db).QueryContext(ctx, query, userID, contactID)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot QueryContext")
+	}
+	defer rows.Close()
+
+	interactions := []types.Interaction{}
+	for rows.Next() {
+		var interaction types.Interaction
+		var happenedOn time.Time
+		err := rows.Scan(&interaction.ID, &interaction.Kind, &interaction.Note, &happenedOn)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot Scan")
+		}
+		interaction.Date = types.Day(happenedOn.UTC())
+		interactions = append(interactions, interaction)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "cannot Scan")
+	}
+
+	return interactions, nil
+}
+
+// deleteInteractions deletes the log of the deleted contact.
+func (db *contactsDB) deleteInteractions(ctx context.Context, userID int64, contactID int) error {
+	const query = `
+		DELETE FROM
+			interactions
+		WHERE
+			tg_user_id = $1 AND
+			contact_id = $2
+	`
+
+	_, err := conn(ctx, db.db).ExecContext(ctx, query,
+		userID,
+		contactID,
+	)
+	return errors.Wrap(err, "cannot ExecContent")
+}
+
+// moveInteractions moves the log of the merged contact to the kept one.
+func (db *contactsDB) moveInteractions(ctx context.Context, userID int64, fromID, toID int) error {
+	const query = `
+		UPDATE
+			interactions
+		SET
+			contact_id = $1
+		WHERE
+			tg_user_id = $2 AND
+			contact_id = $3
+	`
+
+	_, err := conn(ctx, db.db).ExecContext(ctx, query,
+		toID,
+		userID,
+		fromID,
+	)
+	return errors.Wrap(err, "cannot ExecContent")
+}
+
+// attachLastInteractions loads the latest interactions of the contacts of the user into them.
+func (db *contactsDB) attachLastInteractions(ctx context.Context, userID int64, contacts ...*types.Contact) error {
+	if len(contacts) == 0 {
+		return nil
+	}
+
+	// The latest interaction is the one no other interaction of the contact is later than.
+	query := `
+		SELECT
+			contact_id,
+			interaction_id,
+			kind,
+			note,
+			happened_on
+		FROM
+			interactions i
+		WHERE
+			tg_user_id = $1 AND
+			NOT EXISTS (
+				SELECT 1
+				FROM interactions later
+				WHERE
+					later.tg_user_id = i.tg_user_id AND
+					later.contact_id = i.contact_id AND (
+						later.happened_on > i.happened_on OR
+						(later.happened_on = i.happened_on AND later.interaction_id > i.interaction_id)
+					)
+			)
+	`
+	args := []any{userID}
+	if len(contacts) == 1 {
+		query += ` AND contact_id = $2`
+		args = append(args, contacts[0].ContactID)
+	}
+
+	byID := make(map[int]*types.Contact, len(contacts))
+	for _, contact := range contacts {
+		byID[contact.ContactID] = contact
+	}
+
+	rows, err := conn(ctx, db.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return errors.Wrap(err, "cannot QueryContext")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var contactID int
+		var interaction types.Interaction
+		var happenedOn time.Time
+		err := rows.Scan(&contactID, &interaction.ID, &interaction.Kind, &interaction.Note, &happenedOn)
+		if err != nil {
+			return errors.Wrap(err, "cannot Scan")
+		}
+		interaction.Date = types.Day(happenedOn.UTC())
+		if contact, ok := byID[contactID]; ok {
+			contact.LastInteraction = &interaction
+		}
+	}
+
+	return errors.Wrap(rows.Err(), "cannot Scan")
+}
+
+// attachDetails loads what is kept apart from the contacts into them.
+func (db *contactsDB) attachDetails(ctx context.Context, userID int64, contacts ...*types.Contact) error {
+	if err := db.attachCustomFields(ctx, userID, contacts...); err != nil {
+		return errors.Wrap(err, "cannot attachCustomFields")
+	}
+	if err := db.attachEvents(ctx, userID, contacts...); err != nil {
+		return errors.Wrap(err, "cannot attachEvents")
+	}
+	return errors.Wrap(db.attachLastInteractions(ctx, userID, contacts...), "cannot attachLastInteractions")
+}
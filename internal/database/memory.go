@@ -0,0 +1,1361 @@
+package database
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/profectus200/contact-book-bot/internal/types"
+)
+
+// memoryStore keeps everything in maps. It is meant for trying the bot out and for tests:
+// nothing survives a restart.
+type memoryStore struct {
+	// txMu runs the transactions one at a time, mu guards the data.
+	txMu sync.Mutex
+	mu   sync.Mutex
+	memoryData
+}
+
+type memoryData struct {
+	contacts map[int64]map[int]types.Contact
+	states   map[int64]types.CurrentState
+	settings map[int64]types.Settings
+	// interactions are the logs of the contacts of every user in the order of adding.
+	interactions      map[int64][]memoryInteraction
+	lastInteractionID int
+	// reminders are the reminders of all the users in the order of adding.
+	reminders      []memoryReminder
+	lastReminderID int
+	// digests are when the daily reminders about the dates of the contacts are due next.
+	digests map[int64]time.Time
+	// externalContactIDs are the IDs of the latest contacts the users have added outside
+	// of the chat.
+	externalContactIDs map[int64]int
+	// calendarTokens are the hashes of the secrets in the links to the calendar feeds.
+	calendarTokens map[int64]string
+	// cardResources are the names of the vCards of the contacts of every user by their IDs.
+	cardResources map[int64]map[int]types.CardResource
+	// carddavPasswords are the hashes of the app passwords of the users.
+	carddavPasswords map[int64]string
+	// apiTokens are the hashes of the tokens of the REST API of the users.
+	apiTokens map[int64]string
+	// lastSeen are when the users sent the bot anything last.
+	lastSeen map[int64]time.Time
+	// usernames are the usernames the users have last written to the bot with.
+	usernames map[int64]string
+	banned    map[int64]bool
+	// accessMode is the access mode set by the admins, empty when they have not set any.
+	accessMode types.AccessMode
+	// allowlist is in the order of adding.
+	allowlist []types.AllowlistEntry
+	invites   map[string]memoryInvite
+	// webhooks are the webhooks of all the users in the order of adding.
+	webhooks      []types.Webhook
+	lastWebhookID int
+	// outbox are the events waiting for the webhooks in the order of queuing.
+	outbox         []memoryDelivery
+	lastDeliveryID int
+}
+
+type memoryInteraction struct {
+	contactID int
+	types.Interaction
+}
+
+type memoryReminder struct {
+	types.Reminder
+	sent bool
+	// nextAttemptAt is when the due reminder may be tried again, zero for at once.
+	nextAttemptAt time.Time
+}
+
+// memoryDelivery is an event in the outbox, its Webhook has only the ID.
+type memoryDelivery struct {
+	types.WebhookDelivery
+	nextAttemptAt time.Time
+}
+
+type memoryInvite struct {
+	types.Invite
+	used   bool
+	usedBy int64
+}
+
+type memoryContactsDB struct {
+	store *memoryStore
+}
+
+type memoryUsersDB struct {
+	store *memoryStore
+}
+
+type memorySettingsDB struct {
+	store *memoryStore
+}
+
+type memoryWebhooksDB struct {
+	store *memoryStore
+}
+
+type memoryAccessDB struct {
+	store *memoryStore
+}
+
+type memoryTxManager struct {
+	store *memoryStore
+}
+
+func NewMemoryStorage() *Storage {
+	store := &memoryStore{
+		memoryData: memoryData{
+			contacts: make(map[int64]map[int]types.Contact),
+			states:   make(map[int64]types.CurrentState),
+			settings: make(map[int64]types.Settings),
+
+			interactions: make(map[int64][]memoryInteraction),
+			digests:      make(map[int64]time.Time),
+
+			externalContactIDs: make(map[int64]int),
+
+			calendarTokens:   make(map[int64]string),
+			cardResources:    make(map[int64]map[int]types.CardResource),
+			carddavPasswords: make(map[int64]string),
+			apiTokens:        make(map[int64]string),
+
+			lastSeen:  make(map[int64]time.Time),
+			usernames: make(map[int64]string),
+			banned:    make(map[int64]bool),
+			invites:   make(map[string]memoryInvite),
+		},
+	}
+
+	return &Storage{
+		Contacts: &memoryContactsDB{store: store},
+		Users:    &memoryUsersDB{store: store},
+		Settings: &memorySettingsDB{store: store},
+		Webhooks: &memoryWebhooksDB{store: store},
+		Access:   &memoryAccessDB{store: store},
+		Tx:       &memoryTxManager{store: store},
+	}
+}
+
+// Actions with contacts.
+
+func (db *memoryContactsDB) WriteContact(ctx context.Context, userID int64, contact *types.Contact) error {
+	defer db.store.lock(ctx)()
+
+	contacts, ok := db.store.contacts[userID]
+	if !ok {
+		contacts = make(map[int]types.Contact)
+		db.store.contacts[userID] = contacts
+	}
+
+	stored := cloneContact(*contact)
+	types.SortCustomFields(stored.CustomFields)
+	types.SortEvents(stored.Events)
+	contacts[contact.ContactID] = stored
+
+	return db.enqueueEvent(userID, contact.ContactID, types.ContactCreated)
+}
+
+func (db *memoryContactsDB) GetContact(ctx context.Context, userID int64, contactID int) (*types.Contact, error) {
+	defer db.store.lock(ctx)()
+
+	contact, ok := db.store.contacts[userID][contactID]
+	if !ok {
+		return nil, nil
+	}
+
+	contact = cloneContact(contact)
+	contact.LastInteraction = db.lastInteraction(userID, contactID)
+	return &contact, nil
+}
+
+func (db *memoryContactsDB) GetAllContacts(ctx context.Context, userID int64) ([]*types.Contact, error) {
+	return db.filter(ctx, userID, func(*types.Contact) bool {
+		return true
+	}), nil
+}
+
+func (db *memoryContactsDB) GetContactByName(ctx context.Context, userID int64, name string) ([]*types.Contact, error) {
+	return db.filter(ctx, userID, func(contact *types.Contact) bool {
+		return contact.Name == name
+	}), nil
+}
+
+func (db *memoryContactsDB) DeleteContact(ctx context.Context, userID int64, contactID int) error {
+	defer db.store.lock(ctx)()
+
+	if _, ok := db.store.contacts[userID][contactID]; !ok {
+		return nil
+	}
+
+	delete(db.store.contacts[userID], contactID)
+	delete(db.store.cardResources[userID], contactID)
+	db.moveInteractions(userID, contactID, 0)
+	db.moveReminders(userID, contactID, 0)
+
+	return db.enqueueEvent(userID, contactID, types.ContactDeleted)
+}
+
+func (db *memoryContactsDB) WriteName(ctx context.Context, name string, userID int64, contactID int) error {
+	return db.update(ctx, userID, contactID, func(contact *types.Contact) {
+		contact.Name = name
+	})
+}
+
+func (db *memoryContactsDB) WriteEmail(ctx context.Context, email string, userID int64, contactID int) error {
+	return db.update(ctx, userID, contactID, func(contact *types.Contact) {
+		contact.Email = email
+	})
+}
+
+func (db *memoryContactsDB) WritePhone(ctx context.Context, phone string, userID int64, contactID int) error {
+	return db.update(ctx, userID, contactID, func(contact *types.Contact) {
+		contact.Phone = phone
+	})
+}
+
+func (db *memoryContactsDB) WriteBirthday(ctx context.Context, birthday *types.Birthday, userID int64, contactID int) error {
+	return db.update(ctx, userID, contactID, func(contact *types.Contact) {
+		contact.Birthday = birthday
+		*contact = cloneContact(*contact)
+	})
+}
+
+func (db *memoryContactsDB) WriteDescription(ctx context.Context, description string, userID int64, contactID int) error {
+	return db.update(ctx, userID, contactID, func(contact *types.Contact) {
+		contact.Description = description
+	})
+}
+
+func (db *memoryContactsDB) WritePhoto(ctx context.Context, photoID string, userID int64, contactID int) error {
+	return db.update(ctx, userID, contactID, func(contact *types.Contact) {
+		contact.PhotoID = photoID
+	})
+}
+
+func (db *memoryContactsDB) WriteCustomField(ctx context.Context, userID int64, contactID int, field types.CustomField) error {
+	return db.update(ctx, userID, contactID, func(contact *types.Contact) {
+		*contact = cloneContact(*contact)
+		for i := range contact.CustomFields {
+			if contact.CustomFields[i].Name == field.Name {
+				contact.CustomFields[i] = field
+				return
+			}
+		}
+		contact.CustomFields = append(contact.CustomFields, field)
+		types.SortCustomFields(contact.CustomFields)
+	})
+}
+
+func (db *memoryContactsDB) DeleteCustomField(ctx context.Context, userID int64, contactID int, name string) error {
+	return db.update(ctx, userID, contactID, func(contact *types.Contact) {
+		fields := make([]types.CustomField, 0, len(contact.CustomFields))
+		for _, field := range contact.CustomFields {
+			if field.Name != name {
+				fields = append(fields, field)
+			}
+		}
+		contact.CustomFields = fields
+	})
+}
+
+func (db *memoryContactsDB) WriteEvent(ctx context.Context, userID int64, contactID int, event types.Event) error {
+	return db.update(ctx, userID, contactID, func(contact *types.Contact) {
+		*contact = cloneContact(*contact)
+		for i := range contact.Events {
+			if contact.Events[i].Name == event.Name {
+				contact.Events[i] = event
+				return
+			}
+		}
+		contact.Events = append(contact.Events, event)
+		types.SortEvents(contact.Events)
+	})
+}
+
+func (db *memoryContactsDB) DeleteEvent(ctx context.Context, userID int64, contactID int, name string) error {
+	return db.update(ctx, userID, contactID, func(contact *types.Contact) {
+		events := make([]types.Event, 0, len(contact.Events))
+		for _, event := range contact.Events {
+			if event.Name != name {
+				events = append(events, event)
+			}
+		}
+		contact.Events = events
+	})
+}
+
+func (db *memoryContactsDB) SearchContacts(ctx context.Context, userID int64, query types.SearchQuery) ([]types.SearchResult, error) {
+	contacts, err := db.GetAllContacts(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return types.SearchContacts(contacts, query), nil
+}
+
+func (db *memoryContactsDB) MergeContacts(ctx context.Context, userID int64, keepID, otherID int) (*types.Contact, error) {
+	defer db.store.lock(ctx)()
+
+	contacts := db.store.contacts[userID]
+	keep, ok := contacts[keepID]
+	if !ok {
+		return nil, nil
+	}
+	other, ok := contacts[otherID]
+	if !ok || keepID == otherID {
+		return nil, nil
+	}
+
+	keep.LastInteraction = db.lastInteraction(userID, keepID)
+	other.LastInteraction = db.lastInteraction(userID, otherID)
+	merged := types.MergeContacts(&keep, &other)
+	stored := cloneContact(*merged)
+	stored.LastInteraction = nil
+	contacts[keepID] = stored
+	delete(contacts, otherID)
+	db.moveInteractions(userID, otherID, keepID)
+	db.moveReminders(userID, otherID, keepID)
+
+	if err := db.enqueueEvent(userID, keepID, types.ContactUpdated); err != nil {
+		return nil, err
+	}
+	if err := db.enqueueEvent(userID, otherID, types.ContactDeleted); err != nil {
+		return nil, err
+	}
+
+	return merged, nil
+}
+
+func (db *memoryContactsDB) AddInteraction(ctx context.Context, userID int64, contactID int, interaction types.Interaction) error {
+	defer db.store.lock(ctx)()
+
+	if _, ok := db.store.contacts[userID][contactID]; !ok {
+		return nil
+	}
+
+	db.store.lastInteractionID++
+	interaction.ID = db.store.lastInteractionID
+	db.store.interactions[userID] = append(db.store.interactions[userID], memoryInteraction{
+		contactID:   contactID,
+		Interaction: interaction,
+	})
+
+	return nil
+}
+
+func (db *memoryContactsDB) GetInteractions(ctx context.Context, userID int64, contactID int) ([]types.Interaction, error) {
+	defer db.store.lock(ctx)()
+
+	interactions := []types.Interaction{}
+	for _, interaction := range db.store.interactions[userID] {
+		if interaction.contactID == contactID {
+			interactions = append(interactions, interaction.Interaction)
+		}
+	}
+
+	sort.SliceStable(interactions, func(i, j int) bool {
+		if !interactions[i].Date.Equal(interactions[j].Date) {
+			return interactions[i].Date.After(interactions[j].Date)
+		}
+		return interactions[i].ID > interactions[j].ID
+	})
+
+	return interactions, nil
+}
+
+// lastInteraction returns the latest interaction with the contact, the store must be locked.
+func (db *memoryContactsDB) lastInteraction(userID int64, contactID int) *types.Interaction {
+	var last *types.Interaction
+	for _, interaction := range db.store.interactions[userID] {
+		if interaction.contactID != contactID {
+			continue
+		}
+		if last == nil || !interaction.Date.Before(last.Date) {
+			interaction := interaction.Interaction
+			last = &interaction
+		}
+	}
+	return last
+}
+
+// moveInteractions moves the log of the contact to another one, or deletes it for the ID 0.
+// The store must be locked.
+func (db *memoryContactsDB) moveInteractions(userID int64, fromID, toID int) {
+	interactions := make([]memoryInteraction, 0, len(db.store.interactions[userID]))
+	for _, interaction := range db.store.interactions[userID] {
+		if interaction.contactID == fromID {
+			if toID == 0 {
+				continue
+			}
+			interaction.contactID = toID
+		}
+		interactions = append(interactions, interaction)
+	}
+	db.store.interactions[userID] = interactions
+}
+
+func (db *memoryContactsDB) AddReminder(ctx context.Context, userID int64, contactID int, reminder types.Reminder) error {
+	defer db.store.lock(ctx)()
+
+	if _, ok := db.store.contacts[userID][contactID]; !ok {
+		return nil
+	}
+
+	db.store.lastReminderID++
+	reminder.ID = db.store.lastReminderID
+	reminder.UserID = userID
+	reminder.ContactID = contactID
+	db.store.reminders = append(db.store.reminders, memoryReminder{Reminder: reminder})
+
+	return nil
+}
+
+func (db *memoryContactsDB) GetReminders(ctx context.Context, userID int64) ([]types.Reminder, error) {
+	defer db.store.lock(ctx)()
+
+	reminders := []types.Reminder{}
+	for _, reminder := range db.store.reminders {
+		if reminder.UserID == userID && !reminder.sent {
+			reminders = append(reminders, db.withContactName(reminder.Reminder))
+		}
+	}
+
+	sort.SliceStable(reminders, func(i, j int) bool {
+		return reminders[i].DueAt.Before(reminders[j].DueAt)
+	})
+
+	return reminders, nil
+}
+
+func (db *memoryContactsDB) GetReminder(ctx context.Context, userID int64, reminderID int) (*types.Reminder, error) {
+	defer db.store.lock(ctx)()
+
+	for _, reminder := range db.store.reminders {
+		if reminder.UserID == userID && reminder.ID == reminderID {
+			reminder := db.withContactName(reminder.Reminder)
+			return &reminder, nil
+		}
+	}
+	return nil, nil
+}
+
+func (db *memoryContactsDB) SnoozeReminder(ctx context.Context, userID int64, reminderID int, dueAt time.Time) error {
+	defer db.store.lock(ctx)()
+
+	for i := range db.store.reminders {
+		reminder := &db.store.reminders[i]
+		if reminder.UserID == userID && reminder.ID == reminderID {
+			reminder.DueAt = dueAt
+			reminder.Attempts = 0
+			reminder.sent = false
+			reminder.nextAttemptAt = time.Time{}
+		}
+	}
+	return nil
+}
+
+func (db *memoryContactsDB) DeleteReminder(ctx context.Context, userID int64, reminderID int) error {
+	defer db.store.lock(ctx)()
+
+	reminders := make([]memoryReminder, 0, len(db.store.reminders))
+	for _, reminder := range db.store.reminders {
+		if reminder.UserID != userID || reminder.ID != reminderID {
+			reminders = append(reminders, reminder)
+		}
+	}
+	db.store.reminders = reminders
+
+	return nil
+}
+
+func (db *memoryContactsDB) ClaimReminders(ctx context.Context, now, leaseUntil time.Time) ([]types.Reminder, error) {
+	defer db.store.lock(ctx)()
+
+	reminders := []types.Reminder{}
+	for i := range db.store.reminders {
+		reminder := &db.store.reminders[i]
+		if !reminder.sent && !reminder.DueAt.After(now) && !reminder.nextAttemptAt.After(now) {
+			reminder.nextAttemptAt = leaseUntil
+			reminders = append(reminders, db.withContactName(reminder.Reminder))
+		}
+	}
+	return reminders, nil
+}
+
+func (db *memoryContactsDB) CompleteReminder(ctx context.Context, claimed types.Reminder, sentAt time.Time) error {
+	defer db.store.lock(ctx)()
+
+	for i := range db.store.reminders {
+		reminder := &db.store.reminders[i]
+		if reminder.ID == claimed.ID && reminder.DueAt.Equal(claimed.DueAt) {
+			reminder.sent = true
+			reminder.nextAttemptAt = time.Time{}
+		}
+	}
+	return nil
+}
+
+func (db *memoryContactsDB) RetryReminder(ctx context.Context, reminderID, attempts int, at time.Time) error {
+	defer db.store.lock(ctx)()
+
+	for i := range db.store.reminders {
+		reminder := &db.store.reminders[i]
+		if reminder.ID == reminderID {
+			reminder.Attempts = attempts
+			reminder.nextAttemptAt = at
+		}
+	}
+	return nil
+}
+
+// withContactName returns the reminder with the current name of its contact, the store must be locked.
+func (db *memoryContactsDB) withContactName(reminder types.Reminder) types.Reminder {
+	reminder.ContactName = db.store.contacts[reminder.UserID][reminder.ContactID].Name
+	return reminder
+}
+
+// moveReminders moves the reminders about the contact to another one, or deletes them for
+// the ID 0. The store must be locked.
+func (db *memoryContactsDB) moveReminders(userID int64, fromID, toID int) {
+	reminders := make([]memoryReminder, 0, len(db.store.reminders))
+	for _, reminder := range db.store.reminders {
+		if reminder.UserID == userID && reminder.ContactID == fromID {
+			if toID == 0 {
+				continue
+			}
+			reminder.ContactID = toID
+		}
+		reminders = append(reminders, reminder)
+	}
+	db.store.reminders = reminders
+}
+
+// filter returns copies of the contacts of the user matching the predicate, ordered by ID.
+func (db *memoryContactsDB) GetCardResources(ctx context.Context, userID int64) ([]types.CardResource, error) {
+	defer db.store.lock(ctx)()
+
+	resources := make([]types.CardResource, 0, len(db.store.cardResources[userID]))
+	for _, resource := range db.store.cardResources[userID] {
+		resources = append(resources, resource)
+	}
+	sort.Slice(resources, func(i, j int) bool {
+		return resources[i].ContactID < resources[j].ContactID
+	})
+
+	return resources, nil
+}
+
+func (db *memoryContactsDB) WriteCardResource(ctx context.Context, userID int64, resource types.CardResource) error {
+	defer db.store.lock(ctx)()
+
+	if _, ok := db.store.contacts[userID][resource.ContactID]; !ok {
+		return nil
+	}
+	for contactID, other := range db.store.cardResources[userID] {
+		if other.Name == resource.Name && contactID != resource.ContactID {
+			return errors.Errorf("vCard name %q is taken by contact %d", resource.Name, contactID)
+		}
+	}
+	if db.store.cardResources[userID] == nil {
+		db.store.cardResources[userID] = make(map[int]types.CardResource)
+	}
+	db.store.cardResources[userID][resource.ContactID] = resource
+
+	return nil
+}
+
+func (db *memoryContactsDB) filter(ctx context.Context, userID int64, match func(*types.Contact) bool) []*types.Contact {
+	defer db.store.lock(ctx)()
+
+	contacts := []*types.Contact{}
+	for _, contact := range db.store.contacts[userID] {
+		contact := cloneContact(contact)
+		contact.LastInteraction = db.lastInteraction(userID, contact.ContactID)
+		if match(&contact) {
+			contacts = append(contacts, &contact)
+		}
+	}
+
+	sort.Slice(contacts, func(i, j int) bool {
+		return contacts[i].ContactID < contacts[j].ContactID
+	})
+
+	return contacts
+}
+
+func (db *memoryContactsDB) update(ctx context.Context, userID int64, contactID int, apply func(*types.Contact)) error {
+	defer db.store.lock(ctx)()
+
+	contact, ok := db.store.contacts[userID][contactID]
+	if !ok {
+		return nil
+	}
+
+	apply(&contact)
+	db.store.contacts[userID][contactID] = contact
+
+	return db.enqueueEvent(userID, contactID, types.ContactUpdated)
+}
+
+// enqueueEvent queues the event about the contact for every webhook of the user like
+// contactsDB.enqueueEvent does. The store must be locked.
+func (db *memoryContactsDB) enqueueEvent(userID int64, contactID int, eventType types.WebhookEventType) error {
+	var webhookIDs []int
+	for _, webhook := range db.store.webhooks {
+		if webhook.UserID == userID {
+			webhookIDs = append(webhookIDs, webhook.ID)
+		}
+	}
+	if len(webhookIDs) == 0 {
+		return nil
+	}
+
+	var contact *types.Contact
+	if eventType != types.ContactDeleted {
+		stored, ok := db.store.contacts[userID][contactID]
+		if !ok {
+			return nil
+		}
+		stored = cloneContact(stored)
+		stored.LastInteraction = db.lastInteraction(userID, contactID)
+		contact = &stored
+	}
+
+	now := time.Now()
+	payload, err := types.NewContactEvent(eventType, contactID, contact, now)
+	if err != nil {
+		return errors.Wrap(err, "cannot NewContactEvent")
+	}
+
+	for _, webhookID := range webhookIDs {
+		db.store.lastDeliveryID++
+		db.store.outbox = append(db.store.outbox, memoryDelivery{
+			WebhookDelivery: types.WebhookDelivery{
+				ID:        db.store.lastDeliveryID,
+				Webhook:   types.Webhook{ID: webhookID},
+				EventType: eventType,
+				Payload:   payload,
+			},
+			nextAttemptAt: now,
+		})
+	}
+	return nil
+}
+
+// cloneContact copies the contact together with the values it points to,
+// so that the stored contacts are not changed through the returned ones.
+func cloneContact(contact types.Contact) types.Contact {
+	if contact.Birthday != nil {
+		birthday := *contact.Birthday
+		contact.Birthday = &birthday
+	}
+	contact.CustomFields = append([]types.CustomField(nil), contact.CustomFields...)
+	contact.Events = append([]types.Event(nil), contact.Events...)
+	return contact
+}
+
+// Actions with users.
+
+func (db *memoryUsersDB) SetCurrentState(ctx context.Context, userID int64, state types.CurrentState) error {
+	defer db.store.lock(ctx)()
+
+	db.store.states[userID] = state
+
+	return nil
+}
+
+func (db *memoryUsersDB) GetCurrentState(ctx context.Context, userID int64) (*types.UserStateType, bool) {
+	defer db.store.lock(ctx)()
+
+	state, ok := db.store.states[userID]
+	if !ok {
+		return nil, false
+	}
+
+	return &types.UserStateType{CurrentState: state}, true
+}
+
+func (db *memoryUsersDB) ToWaitState(ctx context.Context, userID int64) error {
+	return db.SetCurrentState(ctx, userID, types.CurrentState{})
+}
+
+func (db *memoryUsersDB) ExpireStates(ctx context.Context, now time.Time) ([]int64, error) {
+	defer db.store.lock(ctx)()
+
+	var userIDs []int64
+	for userID, state := range db.store.states {
+		if state.Expired(now) {
+			db.store.states[userID] = types.CurrentState{}
+			userIDs = append(userIDs, userID)
+		}
+	}
+
+	return userIDs, nil
+}
+
+func (db *memoryUsersDB) LockUser(ctx context.Context, userID int64) error {
+	defer db.store.lock(ctx)()
+
+	// Transactions are serialized as a whole, so only the creation of the user is left.
+	if _, ok := db.store.states[userID]; !ok {
+		db.store.states[userID] = types.CurrentState{}
+	}
+
+	return nil
+}
+
+func (db *memoryUsersDB) DueDigests(ctx context.Context, now time.Time) ([]int64, error) {
+	defer db.store.lock(ctx)()
+
+	var userIDs []int64
+	for userID, contacts := range db.store.contacts {
+		if next, ok := db.store.digests[userID]; ok && next.After(now) {
+			continue
+		}
+		for _, contact := range contacts {
+			if contact.Birthday != nil || len(contact.Events) > 0 {
+				userIDs = append(userIDs, userID)
+				break
+			}
+		}
+	}
+
+	return userIDs, nil
+}
+
+func (db *memoryUsersDB) ClaimDigest(ctx context.Context, userID int64, now, leaseUntil time.Time) (bool, error) {
+	defer db.store.lock(ctx)()
+
+	if due, ok := db.store.digests[userID]; ok && due.After(now) {
+		return false, nil
+	}
+	db.store.digests[userID] = leaseUntil
+
+	return true, nil
+}
+
+func (db *memoryUsersDB) ScheduleDigest(ctx context.Context, userID int64, at time.Time) error {
+	defer db.store.lock(ctx)()
+
+	db.store.digests[userID] = at
+
+	return nil
+}
+
+func (db *memoryUsersDB) NextExternalContactID(ctx context.Context, userID int64) (int, error) {
+	defer db.store.lock(ctx)()
+
+	db.store.externalContactIDs[userID]--
+
+	return db.store.externalContactIDs[userID], nil
+}
+
+func (db *memoryUsersDB) SetCalendarToken(ctx context.Context, userID int64, hash string) error {
+	defer db.store.lock(ctx)()
+
+	if _, ok := db.store.states[userID]; !ok {
+		db.store.states[userID] = types.CurrentState{}
+	}
+	if hash == "" {
+		delete(db.store.calendarTokens, userID)
+	} else {
+		db.store.calendarTokens[userID] = hash
+	}
+
+	return nil
+}
+
+func (db *memoryUsersDB) UserByCalendarToken(ctx context.Context, hash string) (int64, bool, error) {
+	defer db.store.lock(ctx)()
+
+	if hash == "" {
+		return 0, false, nil
+	}
+	for userID, userHash := range db.store.calendarTokens {
+		if userHash == hash && !db.store.banned[userID] {
+			return userID, true, nil
+		}
+	}
+
+	return 0, false, nil
+}
+
+func (db *memoryUsersDB) GetCardDAVPassword(ctx context.Context, userID int64) (string, error) {
+	defer db.store.lock(ctx)()
+
+	if db.store.banned[userID] {
+		return "", nil
+	}
+	return db.store.carddavPasswords[userID], nil
+}
+
+func (db *memoryUsersDB) SetCardDAVPassword(ctx context.Context, userID int64, hash string) error {
+	defer db.store.lock(ctx)()
+
+	if _, ok := db.store.states[userID]; !ok {
+		db.store.states[userID] = types.CurrentState{}
+	}
+	if hash == "" {
+		delete(db.store.carddavPasswords, userID)
+	} else {
+		db.store.carddavPasswords[userID] = hash
+	}
+
+	return nil
+}
+
+func (db *memoryUsersDB) SetAPIToken(ctx context.Context, userID int64, hash string) error {
+	defer db.store.lock(ctx)()
+
+	if _, ok := db.store.states[userID]; !ok {
+		db.store.states[userID] = types.CurrentState{}
+	}
+	if hash == "" {
+		delete(db.store.apiTokens, userID)
+	} else {
+		db.store.apiTokens[userID] = hash
+	}
+
+	return nil
+}
+
+func (db *memoryUsersDB) UserByAPIToken(ctx context.Context, hash string) (int64, bool, error) {
+	defer db.store.lock(ctx)()
+
+	if hash == "" {
+		return 0, false, nil
+	}
+	for userID, userHash := range db.store.apiTokens {
+		if userHash == hash && !db.store.banned[userID] {
+			return userID, true, nil
+		}
+	}
+
+	return 0, false, nil
+}
+
+func (db *memoryUsersDB) TouchUser(ctx context.Context, userID int64, username string, now time.Time) (bool, error) {
+	defer db.store.lock(ctx)()
+
+	if _, ok := db.store.states[userID]; !ok {
+		db.store.states[userID] = types.CurrentState{}
+	}
+	db.store.lastSeen[userID] = now
+	if username == "" {
+		delete(db.store.usernames, userID)
+	} else {
+		db.store.usernames[userID] = username
+	}
+
+	return db.store.banned[userID], nil
+}
+
+func (db *memoryUsersDB) GetUsername(ctx context.Context, userID int64) (string, error) {
+	defer db.store.lock(ctx)()
+
+	return db.store.usernames[userID], nil
+}
+
+func (db *memoryUsersDB) SetBanned(ctx context.Context, userID int64, banned bool) error {
+	defer db.store.lock(ctx)()
+
+	if _, ok := db.store.states[userID]; !ok {
+		db.store.states[userID] = types.CurrentState{}
+	}
+	if banned {
+		db.store.banned[userID] = true
+	} else {
+		delete(db.store.banned, userID)
+	}
+
+	return nil
+}
+
+func (db *memoryUsersDB) GetUserIDs(ctx context.Context) ([]int64, error) {
+	defer db.store.lock(ctx)()
+
+	var userIDs []int64
+	for userID := range db.store.states {
+		if !db.store.banned[userID] {
+			userIDs = append(userIDs, userID)
+		}
+	}
+	sort.Slice(userIDs, func(i, j int) bool {
+		return userIDs[i] < userIDs[j]
+	})
+
+	return userIDs, nil
+}
+
+func (db *memoryUsersDB) GetStats(ctx context.Context, activeSince time.Time) (types.Stats, error) {
+	defer db.store.lock(ctx)()
+
+	stats := types.Stats{
+		Users:  len(db.store.states),
+		Banned: len(db.store.banned),
+	}
+	for _, seen := range db.store.lastSeen {
+		if !seen.Before(activeSince) {
+			stats.Active++
+		}
+	}
+	for _, contacts := range db.store.contacts {
+		stats.Contacts += len(contacts)
+	}
+
+	return stats, nil
+}
+
+func (db *memoryUsersDB) GetUserInfo(ctx context.Context, userID int64) (*types.UserInfo, error) {
+	defer db.store.lock(ctx)()
+
+	if _, ok := db.store.states[userID]; !ok {
+		return nil, nil
+	}
+
+	info := &types.UserInfo{
+		UserID:      userID,
+		Banned:      db.store.banned[userID],
+		Username:    db.store.usernames[userID],
+		LastSeen:    db.store.lastSeen[userID],
+		Language:    db.store.settings[userID].Language,
+		Contacts:    len(db.store.contacts[userID]),
+		HasCalendar: db.store.calendarTokens[userID] != "",
+		HasCardDAV:  db.store.carddavPasswords[userID] != "",
+		HasAPIToken: db.store.apiTokens[userID] != "",
+	}
+	for _, reminder := range db.store.reminders {
+		if reminder.UserID == userID && !reminder.sent {
+			info.Reminders++
+		}
+	}
+	for _, webhook := range db.store.webhooks {
+		if webhook.UserID == userID {
+			info.Webhooks++
+		}
+	}
+
+	return info, nil
+}
+
+func (db *memoryUsersDB) DeleteUser(ctx context.Context, userID int64) error {
+	defer db.store.lock(ctx)()
+
+	delete(db.store.contacts, userID)
+	delete(db.store.states, userID)
+	delete(db.store.settings, userID)
+	delete(db.store.interactions, userID)
+	delete(db.store.digests, userID)
+	delete(db.store.externalContactIDs, userID)
+	delete(db.store.calendarTokens, userID)
+	delete(db.store.cardResources, userID)
+	delete(db.store.carddavPasswords, userID)
+	delete(db.store.apiTokens, userID)
+	delete(db.store.lastSeen, userID)
+	delete(db.store.usernames, userID)
+	delete(db.store.banned, userID)
+
+	reminders := make([]memoryReminder, 0, len(db.store.reminders))
+	for _, reminder := range db.store.reminders {
+		if reminder.UserID != userID {
+			reminders = append(reminders, reminder)
+		}
+	}
+	db.store.reminders = reminders
+
+	webhookIDs := make(map[int]bool)
+	webhooks := make([]types.Webhook, 0, len(db.store.webhooks))
+	for _, webhook := range db.store.webhooks {
+		if webhook.UserID == userID {
+			webhookIDs[webhook.ID] = true
+			continue
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	db.store.webhooks = webhooks
+
+	outbox := make([]memoryDelivery, 0, len(db.store.outbox))
+	for _, delivery := range db.store.outbox {
+		if !webhookIDs[delivery.Webhook.ID] {
+			outbox = append(outbox, delivery)
+		}
+	}
+	db.store.outbox = outbox
+
+	return nil
+}
+
+// Settings.
+
+func (db *memorySettingsDB) GetSettings(ctx context.Context, userID int64) (types.Settings, error) {
+	defer db.store.lock(ctx)()
+
+	settings, ok := db.store.settings[userID]
+	if !ok {
+		return types.DefaultSettings(), nil
+	}
+	return cloneSettings(settings), nil
+}
+
+func (db *memorySettingsDB) SaveSettings(ctx context.Context, userID int64, settings types.Settings) error {
+	defer db.store.lock(ctx)()
+
+	if _, ok := db.store.states[userID]; !ok {
+		db.store.states[userID] = types.CurrentState{}
+	}
+	db.store.settings[userID] = cloneSettings(settings)
+
+	return nil
+}
+
+func cloneSettings(settings types.Settings) types.Settings {
+	settings.HiddenFields = append([]types.CardField(nil), settings.HiddenFields...)
+	return settings
+}
+
+// Transactions.
+
+// Actions with webhooks.
+
+func (db *memoryWebhooksDB) AddWebhook(ctx context.Context, webhook types.Webhook) (types.Webhook, error) {
+	defer db.store.lock(ctx)()
+
+	db.store.lastWebhookID++
+	webhook.ID = db.store.lastWebhookID
+	db.store.webhooks = append(db.store.webhooks, webhook)
+
+	return webhook, nil
+}
+
+func (db *memoryWebhooksDB) GetWebhooks(ctx context.Context, userID int64) ([]types.Webhook, error) {
+	defer db.store.lock(ctx)()
+
+	webhooks := []types.Webhook{}
+	for _, webhook := range db.store.webhooks {
+		if webhook.UserID == userID {
+			webhooks = append(webhooks, webhook)
+		}
+	}
+	return webhooks, nil
+}
+
+func (db *memoryWebhooksDB) DeleteWebhook(ctx context.Context, userID int64, webhookID int) error {
+	defer db.store.lock(ctx)()
+
+	webhooks := make([]types.Webhook, 0, len(db.store.webhooks))
+	for _, webhook := range db.store.webhooks {
+		if webhook.UserID == userID && webhook.ID == webhookID {
+			continue
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	if len(webhooks) == len(db.store.webhooks) {
+		return nil
+	}
+	db.store.webhooks = webhooks
+
+	outbox := make([]memoryDelivery, 0, len(db.store.outbox))
+	for _, delivery := range db.store.outbox {
+		if delivery.Webhook.ID != webhookID {
+			outbox = append(outbox, delivery)
+		}
+	}
+	db.store.outbox = outbox
+
+	return nil
+}
+
+func (db *memoryWebhooksDB) ClaimDeliveries(ctx context.Context, now, leaseUntil time.Time, limit int) ([]types.WebhookDelivery, error) {
+	defer db.store.lock(ctx)()
+
+	deliveries := []types.WebhookDelivery{}
+	for i := range db.store.outbox {
+		if len(deliveries) == limit {
+			break
+		}
+		delivery := &db.store.outbox[i]
+		if delivery.nextAttemptAt.After(now) {
+			continue
+		}
+		delivery.nextAttemptAt = leaseUntil
+
+		claimed := delivery.WebhookDelivery
+		for _, webhook := range db.store.webhooks {
+			if webhook.ID == claimed.Webhook.ID {
+				claimed.Webhook = webhook
+			}
+		}
+		deliveries = append(deliveries, claimed)
+	}
+	return deliveries, nil
+}
+
+func (db *memoryWebhooksDB) CompleteDelivery(ctx context.Context, deliveryID int) error {
+	defer db.store.lock(ctx)()
+
+	outbox := make([]memoryDelivery, 0, len(db.store.outbox))
+	for _, delivery := range db.store.outbox {
+		if delivery.ID != deliveryID {
+			outbox = append(outbox, delivery)
+		}
+	}
+	db.store.outbox = outbox
+
+	return nil
+}
+
+func (db *memoryWebhooksDB) RetryDelivery(ctx context.Context, deliveryID, attempts int, at time.Time) error {
+	defer db.store.lock(ctx)()
+
+	for i := range db.store.outbox {
+		if delivery := &db.store.outbox[i]; delivery.ID == deliveryID {
+			delivery.Attempts = attempts
+			delivery.nextAttemptAt = at
+		}
+	}
+	return nil
+}
+
+// Access.
+
+func (db *memoryAccessDB) GetAccessMode(ctx context.Context) (types.AccessMode, error) {
+	defer db.store.lock(ctx)()
+
+	return db.store.accessMode, nil
+}
+
+func (db *memoryAccessDB) SetAccessMode(ctx context.Context, mode types.AccessMode) error {
+	defer db.store.lock(ctx)()
+
+	db.store.accessMode = mode
+
+	return nil
+}
+
+func (db *memoryAccessDB) GetAllowlist(ctx context.Context) ([]types.AllowlistEntry, error) {
+	defer db.store.lock(ctx)()
+
+	return append([]types.AllowlistEntry(nil), db.store.allowlist...), nil
+}
+
+func (db *memoryAccessDB) IsAllowed(ctx context.Context, userID int64, username string) (bool, error) {
+	defer db.store.lock(ctx)()
+
+	for _, entry := range db.store.allowlist {
+		if entry.Matches(userID, username) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (db *memoryAccessDB) Allow(ctx context.Context, entry types.AllowlistEntry, now time.Time) error {
+	defer db.store.lock(ctx)()
+
+	entry.Username = types.NormalizeUsername(entry.Username)
+	for _, allowed := range db.store.allowlist {
+		if allowed == entry {
+			return nil
+		}
+	}
+	db.store.allowlist = append(db.store.allowlist, entry)
+
+	return nil
+}
+
+func (db *memoryAccessDB) Disallow(ctx context.Context, entry types.AllowlistEntry) (bool, error) {
+	defer db.store.lock(ctx)()
+
+	entry.Username = types.NormalizeUsername(entry.Username)
+	allowlist := make([]types.AllowlistEntry, 0, len(db.store.allowlist))
+	for _, allowed := range db.store.allowlist {
+		if allowed != entry {
+			allowlist = append(allowlist, allowed)
+		}
+	}
+	if len(allowlist) == len(db.store.allowlist) {
+		return false, nil
+	}
+	db.store.allowlist = allowlist
+
+	return true, nil
+}
+
+func (db *memoryAccessDB) AddInvite(ctx context.Context, invite types.Invite) error {
+	defer db.store.lock(ctx)()
+
+	if _, ok := db.store.invites[invite.Code]; ok {
+		return errors.Errorf("invite %q already exists", invite.Code)
+	}
+	db.store.invites[invite.Code] = memoryInvite{Invite: invite}
+
+	return nil
+}
+
+func (db *memoryAccessDB) UseInvite(ctx context.Context, code string, userID int64, now time.Time) (bool, error) {
+	defer db.store.lock(ctx)()
+
+	invite, ok := db.store.invites[code]
+	if !ok || invite.used || !invite.ExpiresAt.After(now) {
+		return false, nil
+	}
+	invite.used = true
+	invite.usedBy = userID
+	db.store.invites[code] = invite
+
+	return true, nil
+}
+
+func (db *memoryAccessDB) ForgetInvites(ctx context.Context, userID int64) error {
+	defer db.store.lock(ctx)()
+
+	for code, invite := range db.store.invites {
+		if invite.CreatedBy == userID || (invite.used && invite.usedBy == userID) {
+			delete(db.store.invites, code)
+		}
+	}
+
+	return nil
+}
+
+type memoryTxKey struct{}
+
+// lock locks the data for a call and returns the unlocking. Outside of a transaction it
+// also waits for the running one, so that its rollback cannot drop the writes of the call.
+func (s *memoryStore) lock(ctx context.Context) (unlock func()) {
+	if ctx.Value(memoryTxKey{}) != nil {
+		s.mu.Lock()
+		return s.mu.Unlock
+	}
+
+	s.txMu.Lock()
+	s.mu.Lock()
+	return func() {
+		s.mu.Unlock()
+		s.txMu.Unlock()
+	}
+}
+
+// InTx runs the transactions one at a time and rolls back by restoring a copy of the maps
+// taken at the start. The calls outside of transactions wait for the running one.
+func (m *memoryTxManager) InTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if ctx.Value(memoryTxKey{}) != nil {
+		return fn(ctx)
+	}
+
+	m.store.txMu.Lock()
+	defer m.store.txMu.Unlock()
+
+	m.store.mu.Lock()
+	snapshot := m.store.memoryData.clone()
+	m.store.mu.Unlock()
+
+	committed := false
+	defer func() {
+		if !committed {
+			m.store.mu.Lock()
+			m.store.memoryData = snapshot
+			m.store.mu.Unlock()
+		}
+	}()
+
+	if err := fn(context.WithValue(ctx, memoryTxKey{}, true)); err != nil {
+		return err
+	}
+
+	committed = true
+	return nil
+}
+
+// clone returns a deep copy of the data.
+func (d *memoryData) clone() memoryData {
+	clone := memoryData{
+		contacts: make(map[int64]map[int]types.Contact, len(d.contacts)),
+		states:   make(map[int64]types.CurrentState, len(d.states)),
+		settings: make(map[int64]types.Settings, len(d.settings)),
+
+		interactions:      make(map[int64][]memoryInteraction, len(d.interactions)),
+		lastInteractionID: d.lastInteractionID,
+
+		reminders:      append([]memoryReminder(nil), d.reminders...),
+		lastReminderID: d.lastReminderID,
+
+		digests:            make(map[int64]time.Time, len(d.digests)),
+		externalContactIDs: make(map[int64]int, len(d.externalContactIDs)),
+		calendarTokens:     make(map[int64]string, len(d.calendarTokens)),
+
+		cardResources:    make(map[int64]map[int]types.CardResource, len(d.cardResources)),
+		carddavPasswords: make(map[int64]string, len(d.carddavPasswords)),
+		apiTokens:        make(map[int64]string, len(d.apiTokens)),
+
+		lastSeen:  make(map[int64]time.Time, len(d.lastSeen)),
+		usernames: make(map[int64]string, len(d.usernames)),
+		banned:    make(map[int64]bool, len(d.banned)),
+
+		accessMode: d.accessMode,
+		allowlist:  append([]types.AllowlistEntry(nil), d.allowlist...),
+		invites:    make(map[string]memoryInvite, len(d.invites)),
+
+		webhooks:       append([]types.Webhook(nil), d.webhooks...),
+		lastWebhookID:  d.lastWebhookID,
+		outbox:         append([]memoryDelivery(nil), d.outbox...),
+		lastDeliveryID: d.lastDeliveryID,
+	}
+
+	for userID, contacts := range d.contacts {
+		clone.contacts[userID] = make(map[int]types.Contact, len(contacts))
+		for contactID, contact := range contacts {
+			clone.contacts[userID][contactID] = contact
+		}
+	}
+	for userID, state := range d.states {
+		clone.states[userID] = state
+	}
+	for userID, settings := range d.settings {
+		clone.settings[userID] = cloneSettings(settings)
+	}
+	for userID, interactions := range d.interactions {
+		clone.interactions[userID] = append([]memoryInteraction(nil), interactions...)
+	}
+	for userID, next := range d.digests {
+		clone.digests[userID] = next
+	}
+	for userID, contactID := range d.externalContactIDs {
+		clone.externalContactIDs[userID] = contactID
+	}
+	for userID, token := range d.calendarTokens {
+		clone.calendarTokens[userID] = token
+	}
+	for userID, resources := range d.cardResources {
+		clone.cardResources[userID] = make(map[int]types.CardResource, len(resources))
+		for contactID, resource := range resources {
+			clone.cardResources[userID][contactID] = resource
+		}
+	}
+	for userID, hash := range d.carddavPasswords {
+		clone.carddavPasswords[userID] = hash
+	}
+	for userID, hash := range d.apiTokens {
+		clone.apiTokens[userID] = hash
+	}
+	for userID, seen := range d.lastSeen {
+		clone.lastSeen[userID] = seen
+	}
+	for userID, username := range d.usernames {
+		clone.usernames[userID] = username
+	}
+	for userID := range d.banned {
+		clone.banned[userID] = true
+	}
+	for code, invite := range d.invites {
+		clone.invites[code] = invite
+	}
+
+	return clone
+}
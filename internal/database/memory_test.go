@@ -0,0 +1,14 @@
+package database_test
+
+import (
+	"testing"
+
+	"github.com/profectus200/contact-book-bot/internal/database"
+	"github.com/profectus200/contact-book-bot/internal/database/storagetest"
+)
+
+func TestMemoryStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) *database.Storage {
+		return database.NewMemoryStorage()
+	})
+}
@@ -0,0 +1,17 @@
+CREATE TABLE users
+(
+    tg_user_id       BIGINT UNIQUE PRIMARY KEY,
+    contact_id       INTEGER,
+    message_id       INTEGER,
+    current_state    TEXT
+);
+
+CREATE TABLE contacts
+(
+    tg_user_id  BIGINT REFERENCES users (tg_user_id),
+    contact_id  INTEGER,
+    name        TEXT,
+    phone       TEXT,
+    birthday    DATE,
+    description TEXT
+);
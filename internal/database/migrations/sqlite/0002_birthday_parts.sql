@@ -0,0 +1,12 @@
+ALTER TABLE contacts ADD COLUMN birthday_day INTEGER;
+ALTER TABLE contacts ADD COLUMN birthday_month INTEGER;
+ALTER TABLE contacts ADD COLUMN birthday_year INTEGER;
+
+-- Birthdays used to be stored 1000 years back, as the year was never asked for,
+-- and contacts created without a birthday got the date of their creation.
+UPDATE contacts
+SET birthday_day   = CAST(strftime('%d', birthday) AS INTEGER),
+    birthday_month = CAST(strftime('%m', birthday) AS INTEGER)
+WHERE birthday < '1900-01-01';
+
+ALTER TABLE contacts DROP COLUMN birthday;
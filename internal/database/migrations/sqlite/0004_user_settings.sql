@@ -0,0 +1,17 @@
+CREATE TABLE user_settings
+(
+    tg_user_id    BIGINT PRIMARY KEY REFERENCES users (tg_user_id) ON DELETE CASCADE,
+    language      TEXT    NOT NULL DEFAULT '',
+    timezone      TEXT    NOT NULL DEFAULT 'UTC',
+    phone_region  TEXT    NOT NULL DEFAULT '',
+    reminder_time INTEGER NOT NULL DEFAULT 540,
+    sort_order    TEXT    NOT NULL DEFAULT 'name',
+    hidden_fields TEXT    NOT NULL DEFAULT ''
+);
+
+INSERT INTO user_settings (tg_user_id, language)
+SELECT tg_user_id, language
+FROM users
+WHERE language IS NOT NULL;
+
+ALTER TABLE users DROP COLUMN language;
@@ -0,0 +1,12 @@
+ALTER TABLE users ADD COLUMN flow TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN step TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN payload TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN expires_at TIMESTAMP;
+
+-- The states of the old state machine cannot be resumed as conversations,
+-- the users in the middle of an edit will have to press the button again.
+ALTER TABLE users DROP COLUMN contact_id;
+ALTER TABLE users DROP COLUMN message_id;
+ALTER TABLE users DROP COLUMN current_state;
+
+CREATE INDEX users_expires_at_idx ON users (expires_at) WHERE flow <> '';
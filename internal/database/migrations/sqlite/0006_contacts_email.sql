@@ -0,0 +1 @@
+ALTER TABLE contacts ADD COLUMN email TEXT NOT NULL DEFAULT '';
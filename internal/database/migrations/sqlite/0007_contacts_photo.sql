@@ -0,0 +1 @@
+ALTER TABLE contacts ADD COLUMN photo_file_id TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,9 @@
+CREATE TABLE contact_fields
+(
+    tg_user_id BIGINT  NOT NULL REFERENCES users (tg_user_id) ON DELETE CASCADE,
+    contact_id INTEGER NOT NULL,
+    name       TEXT    NOT NULL,
+    type       TEXT    NOT NULL,
+    value      TEXT    NOT NULL,
+    PRIMARY KEY (tg_user_id, contact_id, name)
+);
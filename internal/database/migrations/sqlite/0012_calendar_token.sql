@@ -0,0 +1,4 @@
+-- calendar_token is the secret in the link to the calendar feed of the user, NULL without a link.
+ALTER TABLE users ADD COLUMN calendar_token TEXT;
+
+CREATE UNIQUE INDEX users_calendar_token_idx ON users (calendar_token);
@@ -0,0 +1,4 @@
+-- api_token is the SHA-256 of the token of the REST API of the user, NULL without one.
+ALTER TABLE users ADD COLUMN api_token TEXT;
+
+CREATE UNIQUE INDEX users_api_token_idx ON users (api_token);
@@ -0,0 +1,27 @@
+CREATE TABLE webhooks
+(
+    webhook_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    tg_user_id BIGINT    NOT NULL REFERENCES users (tg_user_id) ON DELETE CASCADE,
+    url        TEXT      NOT NULL,
+    -- secret is the key of the HMAC signatures of the deliveries.
+    secret     TEXT      NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX webhooks_user_idx ON webhooks (tg_user_id);
+
+-- webhook_outbox keeps the events until their webhooks have accepted them.
+CREATE TABLE webhook_outbox
+(
+    delivery_id     INTEGER PRIMARY KEY AUTOINCREMENT,
+    webhook_id      INTEGER   NOT NULL REFERENCES webhooks (webhook_id) ON DELETE CASCADE,
+    event_type      TEXT      NOT NULL,
+    payload         TEXT      NOT NULL,
+    -- attempts is the number of the failed deliveries so far.
+    attempts        INTEGER   NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL,
+    created_at      TIMESTAMP NOT NULL
+);
+
+CREATE INDEX webhook_outbox_next_attempt_at_idx ON webhook_outbox (next_attempt_at);
+CREATE INDEX webhook_outbox_webhook_idx ON webhook_outbox (webhook_id);
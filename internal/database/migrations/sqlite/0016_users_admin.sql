@@ -0,0 +1,6 @@
+-- banned users get no answers from the bot. last_seen_at is when the user sent the bot
+-- anything last, for the statistics of the admins, NULL if never since it is recorded.
+ALTER TABLE users ADD COLUMN banned BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE users ADD COLUMN last_seen_at TIMESTAMP;
+
+CREATE INDEX users_last_seen_at_idx ON users (last_seen_at);
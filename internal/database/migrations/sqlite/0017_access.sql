@@ -0,0 +1,29 @@
+-- access_policy is the access mode set by the admins in the chat, a single row. The mode
+-- from the config applies without it.
+CREATE TABLE access_policy
+(
+    id   INTEGER PRIMARY KEY CHECK (id = 1),
+    mode TEXT    NOT NULL
+);
+
+-- allowlist are the users let in by the admins in the chat or with an invite, by the ID
+-- or by the username in lower case.
+CREATE TABLE allowlist
+(
+    entry_id   INTEGER PRIMARY KEY AUTOINCREMENT,
+    tg_user_id BIGINT UNIQUE,
+    username   TEXT UNIQUE,
+    created_at TIMESTAMP NOT NULL,
+    CHECK ((tg_user_id IS NULL) <> (username IS NULL))
+);
+
+-- invites are the codes letting a new user in once, used_by is set when one is used.
+CREATE TABLE invites
+(
+    code       TEXT PRIMARY KEY,
+    created_by BIGINT    NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_by    BIGINT,
+    used_at    TIMESTAMP
+);
@@ -0,0 +1,25 @@
+-- The contacts go away with their user, like everything else of the user does.
+-- SQLite cannot change a foreign key, so the table is made anew.
+CREATE TABLE contacts_new
+(
+    tg_user_id     BIGINT REFERENCES users (tg_user_id) ON DELETE CASCADE,
+    contact_id     INTEGER,
+    name           TEXT,
+    phone          TEXT,
+    description    TEXT,
+    birthday_day   INTEGER,
+    birthday_month INTEGER,
+    birthday_year  INTEGER,
+    email          TEXT NOT NULL DEFAULT '',
+    photo_file_id  TEXT NOT NULL DEFAULT ''
+);
+
+INSERT INTO contacts_new (tg_user_id, contact_id, name, phone, description, birthday_day, birthday_month,
+                          birthday_year, email, photo_file_id)
+SELECT tg_user_id, contact_id, name, phone, description, birthday_day, birthday_month,
+       birthday_year, email, photo_file_id
+FROM contacts;
+
+DROP TABLE contacts;
+
+ALTER TABLE contacts_new RENAME TO contacts;
@@ -0,0 +1,5 @@
+-- attempts counts the failed deliveries of the reminder. next_attempt_at is when the due
+-- reminder may be tried again: the end of the lease of the bot delivering it, or the time
+-- of the retry after a failure. NULL means at once.
+ALTER TABLE reminders ADD COLUMN attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE reminders ADD COLUMN next_attempt_at TIMESTAMP;
@@ -0,0 +1,14 @@
+-- last_external_contact_id is the ID of the latest contact the user has added outside of
+-- the chat, e.g. over CardDAV. It only goes down, so that the ID of a deleted contact is
+-- never given to another one.
+ALTER TABLE users ADD COLUMN last_external_contact_id INTEGER NOT NULL DEFAULT 0;
+
+UPDATE users
+SET
+    last_external_contact_id = (
+        SELECT MIN(contact_id) FROM contacts WHERE contacts.tg_user_id = users.tg_user_id
+    )
+WHERE
+    EXISTS (
+        SELECT 1 FROM contacts WHERE contacts.tg_user_id = users.tg_user_id AND contact_id < 0
+    );
@@ -0,0 +1,3 @@
+-- username is the Telegram username the user has last written to the bot with, NULL
+-- without one. The requests over HTTP have no username to check the allowlist with.
+ALTER TABLE users ADD COLUMN username TEXT;
@@ -0,0 +1,10 @@
+-- A contact is one per ID of its user. Of the copies made by the adds racing for an ID
+-- the latest one is kept. SQLite cannot add a primary key to a table, a unique index
+-- does the same.
+DELETE FROM contacts
+WHERE
+    rowid NOT IN (
+        SELECT MAX(rowid) FROM contacts GROUP BY tg_user_id, contact_id
+    );
+
+CREATE UNIQUE INDEX contacts_key_idx ON contacts (tg_user_id, contact_id);
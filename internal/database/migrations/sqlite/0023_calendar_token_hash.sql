@@ -0,0 +1,4 @@
+-- calendar_token is the SHA-256 of the secret in the link to the calendar feed now, like
+-- api_token. SQLite cannot hash the secrets, so the links given out stop working and the
+-- users make new ones with /calendar.
+UPDATE users SET calendar_token = NULL;
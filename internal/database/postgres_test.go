@@ -0,0 +1,17 @@
+package database_test
+
+import (
+	"testing"
+
+	"github.com/profectus200/contact-book-bot/internal/database"
+	"github.com/profectus200/contact-book-bot/internal/database/storagetest"
+)
+
+// TestPostgresStorage runs against the database in storagetest.PostgresEnv, the cases share it.
+func TestPostgresStorage(t *testing.T) {
+	storage := storagetest.OpenPostgres(t)
+
+	storagetest.Run(t, func(t *testing.T) *database.Storage {
+		return storage
+	})
+}
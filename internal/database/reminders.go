@@ -0,0 +1,318 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+	"github.com/profectus200/contact-book-bot/internal/types"
+	"golang.org/x/net/context"
+)
+
+// reminderColumns are the columns of a reminder as types.Reminder has them, the name of the
+// contact is looked up as the contact may be renamed after the reminder was added.
+const reminderColumns = `
+	reminder_id,
+	tg_user_id,
+	contact_id,
+	COALESCE((
+		SELECT name
+		FROM contacts c
+		WHERE c.tg_user_id = reminders.tg_user_id AND c.contact_id = reminders.contact_id
+	), ''),
+	text,
+	due_at,
+	attempts
+`
+
+func (db *contactsDB) AddReminder(ctx context.Context, userID int64, contactID int, reminder types.Reminder) error {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"AddReminder",
+	)
+	defer span.Finish()
+
+	const query = `
+		INSERT INTO reminders(
+			tg_user_id,
+			contact_id,
+			text,
+			due_at
+		)
+		SELECT
+			$1, $2, $3, $4
+		WHERE EXISTS (
+			SELECT 1 FROM contacts WHERE tg_user_id = $1 AND contact_id = $2
+		)
+	`
+
+	_, err := conn(ctx, db.db).ExecContext(ctx, query,
+		userID,
+		contactID,
+		reminder.Text,
+		reminder.DueAt.UTC(),
+	)
+	if err != nil {
+		return errors.Wrap(err, "cannot ExecContent")
+	}
+
+	return nil
+}
+
+func (db *contactsDB) GetReminders(ctx context.Context, userID int64) ([]types.Reminder, error) {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"GetReminders",
+	)
+	defer span.Finish()
+
+	const query = `
+		SELECT` + reminderColumns + `
+		FROM
+			reminders
+		WHERE
+			tg_user_id = $1 AND
+			sent_at IS NULL
+		ORDER BY
+			due_at,
+			reminder_id
+	`
+
+	rows, err := conn(ctx, db.db).QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot QueryContext")
+	}
+	return scanReminders(rows)
+}
+
+func (db *contactsDB) GetReminder(ctx context.Context, userID int64, reminderID int) (*types.Reminder, error) {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"GetReminder",
+	)
+	defer span.Finish()
+
+	const query = `
+		SELECT` + reminderColumns + `
+		FROM
+			reminders
+		WHERE
+			tg_user_id = $1 AND
+			reminder_id = $2
+	`
+
+	rows, err := conn(ctx, db.db).QueryContext(ctx, query, userID, reminderID)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot QueryContext")
+	}
+	reminders, err := scanReminders(rows)
+	if err != nil || len(reminders) == 0 {
+		return nil, err
+	}
+	return &reminders[0], nil
+}
+
+func (db *contactsDB) SnoozeReminder(ctx context.Context, userID int64, reminderID int, dueAt time.Time) error {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"SnoozeReminder",
+	)
+	defer span.Finish()
+
+	const query = `
+		UPDATE
+			reminders
+		SET
+			due_at = $1,
+			sent_at = NULL,
+			attempts = 0,
+			next_attempt_at = NULL
+		WHERE
+			tg_user_id = $2 AND
+			reminder_id = $3
+	`
+
+	_, err := conn(ctx, db.db).ExecContext(ctx, query,
+		dueAt.UTC(),
+		userID,
+		reminderID,
+	)
+	if err != nil {
+		return errors.Wrap(err, "cannot ExecContent")
+	}
+
+	return nil
+}
+
+func (db *contactsDB) DeleteReminder(ctx context.Context, userID int64, reminderID int) error {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"DeleteReminder",
+	)
+	defer span.Finish()
+
+	const query = `
+		DELETE FROM
+			reminders
+		WHERE
+			tg_user_id = $1 AND
+			reminder_id = $2
+	`
+
+	_, err := conn(ctx, db.db).ExecContext(ctx, query,
+		userID,
+		reminderID,
+	)
+	if err != nil {
+		return errors.Wrap(err, "cannot ExecContent")
+	}
+
+	return nil
+}
+
+// ClaimReminders takes the reminders of all the users due by now and postpones them until
+// leaseUntil, so that the other bots do not deliver them meanwhile. A reminder whose delivery
+// is never completed nor retried, e.g. as the bot has stopped, is due again then.
+func (db *contactsDB) ClaimReminders(ctx context.Context, now, leaseUntil time.Time) ([]types.Reminder, error) {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"ClaimReminders",
+	)
+	defer span.Finish()
+
+	const query = `
+		UPDATE
+			reminders
+		SET
+			next_attempt_at = $1
+		WHERE
+			sent_at IS NULL AND
+			due_at <= $2 AND
+			(next_attempt_at IS NULL OR next_attempt_at <= $2)
+		RETURNING` + reminderColumns
+
+	rows, err := conn(ctx, db.db).QueryContext(ctx, query,
+		leaseUntil.UTC(),
+		now.UTC(),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot QueryContext")
+	}
+	return scanReminders(rows)
+}
+
+// CompleteReminder marks the reminder delivered at sentAt. It does nothing when the reminder
+// has been snoozed since it was claimed, so that it is delivered again at the new time.
+func (db *contactsDB) CompleteReminder(ctx context.Context, reminder types.Reminder, sentAt time.Time) error {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"CompleteReminder",
+	)
+	defer span.Finish()
+
+	const query = `
+		UPDATE
+			reminders
+		SET
+			sent_at = $1,
+			next_attempt_at = NULL
+		WHERE
+			reminder_id = $2 AND
+			due_at = $3
+	`
+
+	_, err := conn(ctx, db.db).ExecContext(ctx, query,
+		sentAt.UTC(),
+		reminder.ID,
+		reminder.DueAt.UTC(),
+	)
+	return errors.Wrap(err, "cannot ExecContent")
+}
+
+// RetryReminder counts the failed attempts of the reminder and makes it due again at the time.
+func (db *contactsDB) RetryReminder(ctx context.Context, reminderID, attempts int, at time.Time) error {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"RetryReminder",
+	)
+	defer span.Finish()
+
+	const query = `
+		UPDATE
+			reminders
+		SET
+			attempts = $1,
+			next_attempt_at = $2
+		WHERE
+			reminder_id = $3
+	`
+
+	_, err := conn(ctx, db.db).ExecContext(ctx, query,
+		attempts,
+		at.UTC(),
+		reminderID,
+	)
+	return errors.Wrap(err, "cannot ExecContent")
+}
+
+func scanReminders(rows *sql.Rows) ([]types.Reminder, error) {
+	defer rows.Close()
+
+	reminders := []types.Reminder{}
+	for rows.Next() {
+		var reminder types.Reminder
+		err := rows.Scan(
+			&reminder.ID,
+			&reminder.UserID,
+			&reminder.ContactID,
+			&reminder.ContactName,
+			&reminder.Text,
+			&reminder.DueAt,
+			&reminder.Attempts,
+		)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot Scan")
+		}
+		reminders = append(reminders, reminder)
+	}
+
+	return reminders, errors.Wrap(rows.Err(), "cannot Scan")
+}
+
+// deleteReminders deletes the reminders about the deleted contact.
+func (db *contactsDB) deleteReminders(ctx context.Context, userID int64, contactID int) error {
+	const query = `
+		DELETE FROM
+			reminders
+		WHERE
+			tg_user_id = $1 AND
+			contact_id = $2
+	`
+
+	_, err := conn(ctx, db.db).ExecContext(ctx, query,
+		userID,
+		contactID,
+	)
+	return errors.Wrap(err, "cannot ExecContent")
+}
+
+// moveReminders moves the reminders about the merged contact to the kept one.
+func (db *contactsDB) moveReminders(ctx context.Context, userID int64, fromID, toID int) error {
+	const query = `
+		UPDATE
+			reminders
+		SET
+			contact_id = $1
+		WHERE
+			tg_user_id = $2 AND
+			contact_id = $3
+	`
+
+	_, err := conn(ctx, db.db).ExecContext(ctx, query,
+		toID,
+		userID,
+		fromID,
+	)
+	return errors.Wrap(err, "cannot ExecContent")
+}
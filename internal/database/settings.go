@@ -0,0 +1,158 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+	"github.com/profectus200/contact-book-bot/internal/types"
+)
+
+type settingsDB struct {
+	db *sql.DB
+}
+
+func NewSettingsDB(db *sql.DB) *settingsDB {
+	return &settingsDB{db: db}
+}
+
+// GetSettings returns the default settings for a user who has not changed any.
+func (db *settingsDB) GetSettings(ctx context.Context, userID int64) (types.Settings, error) {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"GetSettings",
+	)
+	defer span.Finish()
+
+	const query = `
+		SELECT
+			language,
+			timezone,
+			phone_region,
+			reminder_time,
+			sort_order,
+			hidden_fields,
+			stale_days
+		FROM
+			user_settings
+		WHERE
+			tg_user_id = $1
+	`
+
+	var (
+		settings     types.Settings
+		sortOrder    string
+		hiddenFields string
+	)
+	err := conn(ctx, db.db).QueryRowContext(ctx, query,
+		userID,
+	).Scan(
+		&settings.Language,
+		&settings.Timezone,
+		&settings.PhoneRegion,
+		&settings.ReminderTime,
+		&sortOrder,
+		&hiddenFields,
+		&settings.StaleDays,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return types.DefaultSettings(), nil
+		}
+		return types.Settings{}, errors.Wrap(err, "cannot Scan")
+	}
+
+	settings.SortOrder = types.SortOrder(sortOrder)
+	settings.HiddenFields = parseCardFields(hiddenFields)
+
+	return settings, nil
+}
+
+func (db *settingsDB) SaveSettings(ctx context.Context, userID int64, settings types.Settings) error {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"SaveSettings",
+	)
+	defer span.Finish()
+
+	// Settings belong to a user, who may have never had a state yet.
+	const userQuery = `
+		INSERT INTO users(
+			tg_user_id
+		) VALUES (
+			$1
+		)
+		ON CONFLICT(tg_user_id) DO NOTHING
+	`
+
+	_, err := conn(ctx, db.db).ExecContext(ctx, userQuery,
+		userID,
+	)
+	if err != nil {
+		return errors.Wrap(err, "cannot insert user")
+	}
+
+	const query = `
+		INSERT INTO user_settings(
+			tg_user_id,
+			language,
+			timezone,
+			phone_region,
+			reminder_time,
+			sort_order,
+			hidden_fields,
+			stale_days
+		) VALUES (
+			$1, $2, $3, $4, $5, $6, $7, $8
+		)
+		ON CONFLICT(tg_user_id)
+		DO UPDATE
+			SET
+			language = $2,
+			timezone = $3,
+			phone_region = $4,
+			reminder_time = $5,
+			sort_order = $6,
+			hidden_fields = $7,
+			stale_days = $8
+	`
+
+	_, err = conn(ctx, db.db).ExecContext(ctx, query,
+		userID,
+		settings.Language,
+		settings.Timezone,
+		settings.PhoneRegion,
+		settings.ReminderTime,
+		string(settings.SortOrder),
+		formatCardFields(settings.HiddenFields),
+		settings.StaleDays,
+	)
+
+	if err != nil {
+		return errors.Wrap(err, "cannot ExecContent")
+	}
+
+	return nil
+}
+
+// Hidden card fields are stored comma-separated, as SQLite has no arrays.
+func formatCardFields(fields []types.CardField) string {
+	names := make([]string, 0, len(fields))
+	for _, field := range fields {
+		names = append(names, string(field))
+	}
+	return strings.Join(names, ",")
+}
+
+func parseCardFields(text string) []types.CardField {
+	var fields []types.CardField
+	for _, name := range strings.Split(text, ",") {
+		if field, ok := types.ParseCardField(name); ok {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
@@ -0,0 +1,91 @@
+package database
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/pkg/errors"
+)
+
+const defaultSQLitePath = "data/contacts.db"
+
+// sqliteMigrations is the schema of the SQLite storage. Unlike Postgres, which is migrated
+// with goose from the migrations directory, a SQLite file is migrated when it is opened:
+// the files are applied in order and the number of applied ones is kept in user_version.
+//
+//go:embed migrations/sqlite/*.sql
+var sqliteMigrations embed.FS
+
+// NewSQLite opens the SQLite database at the path and brings its schema up to date.
+func NewSQLite(dbPath string) (*sql.DB, error) {
+	if dbPath == "" {
+		dbPath = defaultSQLitePath
+	}
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0o755); err != nil {
+		return nil, errors.Wrap(err, "cannot MkdirAll")
+	}
+
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?_foreign_keys=on&_busy_timeout=5000", dbPath))
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot Open")
+	}
+
+	// SQLite allows a single writer anyway, one connection saves us from "database is locked".
+	db.SetMaxOpenConns(1)
+
+	if err := migrateSQLite(db); err != nil {
+		db.Close()
+		return nil, errors.Wrap(err, "cannot migrateSQLite")
+	}
+
+	return db, nil
+}
+
+func migrateSQLite(db *sql.DB) error {
+	const dir = "migrations/sqlite"
+
+	entries, err := sqliteMigrations.ReadDir(dir)
+	if err != nil {
+		return errors.Wrap(err, "cannot ReadDir")
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return errors.Wrap(err, "cannot get user_version")
+	}
+
+	for i := version; i < len(entries); i++ {
+		migration, err := sqliteMigrations.ReadFile(path.Join(dir, entries[i].Name()))
+		if err != nil {
+			return errors.Wrap(err, "cannot ReadFile")
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			return errors.Wrap(err, "cannot Begin")
+		}
+		if _, err := tx.Exec(string(migration)); err != nil {
+			tx.Rollback()
+			return errors.Wrapf(err, "cannot apply %s", entries[i].Name())
+		}
+		// PRAGMA does not accept parameters.
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", i+1)); err != nil {
+			tx.Rollback()
+			return errors.Wrap(err, "cannot set user_version")
+		}
+		if err := tx.Commit(); err != nil {
+			return errors.Wrap(err, "cannot Commit")
+		}
+	}
+
+	return nil
+}
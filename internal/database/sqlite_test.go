@@ -0,0 +1,28 @@
+package database_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/profectus200/contact-book-bot/internal/config"
+	"github.com/profectus200/contact-book-bot/internal/database"
+	"github.com/profectus200/contact-book-bot/internal/database/storagetest"
+)
+
+func TestSQLiteStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) *database.Storage {
+		// The directory of the file does not exist yet, NewSQLite creates it.
+		path := filepath.Join(t.TempDir(), "data", "contacts.db")
+
+		storage, err := database.Open(&config.Service{Config: config.Config{
+			Storage:    database.DriverSQLite,
+			SQLitePath: path,
+		}})
+		if err != nil {
+			t.Fatalf("cannot open storage: %v", err)
+		}
+		t.Cleanup(func() { storage.Close() })
+
+		return storage
+	})
+}
@@ -0,0 +1,247 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/profectus200/contact-book-bot/internal/config"
+	"github.com/profectus200/contact-book-bot/internal/types"
+)
+
+// Storage drivers which can be set in the config.
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+	DriverMemory   = "memory"
+)
+
+// ContactsStorage keeps the contacts of the users.
+// Contacts are identified by the user and the ID of the contact, which is unique per user.
+type ContactsStorage interface {
+	// WriteContact replaces the contact with the same ID, if there is one.
+	WriteContact(ctx context.Context, userID int64, contact *types.Contact) error
+	// GetContact returns nil without an error when there is no such contact.
+	GetContact(ctx context.Context, userID int64, contactID int) (*types.Contact, error)
+	GetContactByName(ctx context.Context, userID int64, name string) ([]*types.Contact, error)
+	GetAllContacts(ctx context.Context, userID int64) ([]*types.Contact, error)
+	// SearchContacts finds the contacts with every term of the query in the name,
+	// the description or the values of the custom fields, the best matches first.
+	SearchContacts(ctx context.Context, userID int64, query types.SearchQuery) ([]types.SearchResult, error)
+	DeleteContact(ctx context.Context, userID int64, contactID int) error
+	// MergeContacts merges the other contact into the kept one and deletes it in one go.
+	// It returns nil without an error when either contact does not exist.
+	MergeContacts(ctx context.Context, userID int64, keepID, otherID int) (*types.Contact, error)
+	// Field writers do nothing when there is no such contact.
+	WriteName(ctx context.Context, name string, userID int64, contactID int) error
+	WriteEmail(ctx context.Context, email string, userID int64, contactID int) error
+	WritePhone(ctx context.Context, phone string, userID int64, contactID int) error
+	// WriteBirthday removes the birthday when it is nil.
+	WriteBirthday(ctx context.Context, birthday *types.Birthday, userID int64, contactID int) error
+	WriteDescription(ctx context.Context, description string, userID int64, contactID int) error
+	// WritePhoto sets the Telegram file_id of the photo of the contact, empty to remove the photo.
+	WritePhoto(ctx context.Context, photoID string, userID int64, contactID int) error
+	// WriteCustomField adds the field or replaces the one with exactly the same name.
+	WriteCustomField(ctx context.Context, userID int64, contactID int, field types.CustomField) error
+	DeleteCustomField(ctx context.Context, userID int64, contactID int, name string) error
+	// WriteEvent adds the date or replaces the one with exactly the same name.
+	WriteEvent(ctx context.Context, userID int64, contactID int, event types.Event) error
+	DeleteEvent(ctx context.Context, userID int64, contactID int, name string) error
+	// AddInteraction adds the entry to the log of the contact, the contacts read afterwards
+	// have the latest one in LastInteraction. It does nothing when there is no such contact.
+	AddInteraction(ctx context.Context, userID int64, contactID int, interaction types.Interaction) error
+	// GetInteractions returns the log of the contact, the latest first.
+	GetInteractions(ctx context.Context, userID int64, contactID int) ([]types.Interaction, error)
+	// AddReminder adds the reminder about the contact, it does nothing when there is no such contact.
+	AddReminder(ctx context.Context, userID int64, contactID int, reminder types.Reminder) error
+	// GetReminders returns the reminders of the user not delivered yet, the soonest first.
+	GetReminders(ctx context.Context, userID int64) ([]types.Reminder, error)
+	// GetReminder returns nil without an error when there is no such reminder.
+	GetReminder(ctx context.Context, userID int64, reminderID int) (*types.Reminder, error)
+	// SnoozeReminder makes the reminder due again at the time, even if it has been delivered.
+	SnoozeReminder(ctx context.Context, userID int64, reminderID int, dueAt time.Time) error
+	DeleteReminder(ctx context.Context, userID int64, reminderID int) error
+	// ClaimReminders returns the reminders of all the users due by now, and keeps them from
+	// the other callers until leaseUntil. The claimed reminders are still pending until
+	// CompleteReminder, RetryReminder makes a reminder due again at another time.
+	ClaimReminders(ctx context.Context, now, leaseUntil time.Time) ([]types.Reminder, error)
+	// CompleteReminder marks the claimed reminder delivered, unless it has been snoozed since.
+	CompleteReminder(ctx context.Context, reminder types.Reminder, sentAt time.Time) error
+	RetryReminder(ctx context.Context, reminderID, attempts int, at time.Time) error
+	// GetCardResources returns the names CardDAV clients have given to the vCards of the contacts.
+	GetCardResources(ctx context.Context, userID int64) ([]types.CardResource, error)
+	// WriteCardResource names the vCard of the contact, it does nothing when there is no such contact.
+	WriteCardResource(ctx context.Context, userID int64, resource types.CardResource) error
+}
+
+// UsersStorage keeps the state of the conversation with every user.
+type UsersStorage interface {
+	SetCurrentState(ctx context.Context, userID int64, state types.CurrentState) error
+	// GetCurrentState returns false when the user has no state yet.
+	GetCurrentState(ctx context.Context, userID int64) (*types.UserStateType, bool)
+	// ToWaitState ends the conversation of the user.
+	ToWaitState(ctx context.Context, userID int64) error
+	// ExpireStates ends the conversations which have expired by now and returns their users.
+	ExpireStates(ctx context.Context, now time.Time) ([]int64, error)
+	// LockUser serializes the transactions of a user, see TxManager.
+	LockUser(ctx context.Context, userID int64) error
+	// DueDigests returns the users with a birthday or another date among the contacts whose
+	// daily reminder about them is due by now, or has never been scheduled.
+	DueDigests(ctx context.Context, now time.Time) ([]int64, error)
+	// ClaimDigest postpones the daily reminder of the user until leaseUntil if it is due by now.
+	// It is false when the reminder is not due, e.g. another bot has claimed it already.
+	ClaimDigest(ctx context.Context, userID int64, now, leaseUntil time.Time) (bool, error)
+	// ScheduleDigest makes the daily reminder of the user due at the time.
+	ScheduleDigest(ctx context.Context, userID int64, at time.Time) error
+	// NextExternalContactID returns the ID of a new contact of the user added outside of the
+	// chat. The IDs are negative and every call returns a new one.
+	NextExternalContactID(ctx context.Context, userID int64) (int, error)
+	// SetCalendarToken replaces the hash of the secret in the link to the calendar feed,
+	// so that the old link stops working. An empty hash removes the link.
+	SetCalendarToken(ctx context.Context, userID int64, hash string) error
+	// UserByCalendarToken is false when no user has a link with the hash of the secret,
+	// or the user is banned.
+	UserByCalendarToken(ctx context.Context, hash string) (int64, bool, error)
+	// GetCardDAVPassword returns the hash of the app password of the CardDAV server,
+	// empty when the user has no password or is banned.
+	GetCardDAVPassword(ctx context.Context, userID int64) (string, error)
+	// SetCardDAVPassword replaces the hash, so that the old password stops working.
+	// An empty hash removes the password.
+	SetCardDAVPassword(ctx context.Context, userID int64, hash string) error
+	// SetAPIToken replaces the hash of the token of the REST API, so that the old token
+	// stops working. An empty hash removes the token.
+	SetAPIToken(ctx context.Context, userID int64, hash string) error
+	// UserByAPIToken is false when no user has a token with the hash, or the user is banned.
+	UserByAPIToken(ctx context.Context, hash string) (int64, bool, error)
+	// TouchUser records that the user has sent the bot something now with the username,
+	// creating the user if needed, and tells whether the user is banned.
+	TouchUser(ctx context.Context, userID int64, username string, now time.Time) (bool, error)
+	// GetUsername returns the username the user has last written to the bot with, empty
+	// when the user has none or is unknown.
+	GetUsername(ctx context.Context, userID int64) (string, error)
+	// SetBanned bans or unbans the user, creating the user if needed.
+	SetBanned(ctx context.Context, userID int64, banned bool) error
+	// GetUserIDs returns the users who are not banned, in the order of their IDs.
+	GetUserIDs(ctx context.Context) ([]int64, error)
+	// GetStats counts the users, the ones seen since the moment, the banned ones and the contacts.
+	GetStats(ctx context.Context, activeSince time.Time) (types.Stats, error)
+	// GetUserInfo returns nil without an error when there is no such user.
+	GetUserInfo(ctx context.Context, userID int64) (*types.UserInfo, error)
+	// DeleteUser deletes the user with everything kept about the user: the contacts with
+	// all their records, the settings, the reminders and the webhooks with their events.
+	DeleteUser(ctx context.Context, userID int64) error
+}
+
+// WebhooksStorage keeps the webhooks of the users and the outbox of the events for them.
+// ContactsStorage queues the events in the same transactions as the changes of the contacts.
+type WebhooksStorage interface {
+	// AddWebhook adds the webhook and returns it with its ID.
+	AddWebhook(ctx context.Context, webhook types.Webhook) (types.Webhook, error)
+	// GetWebhooks returns the webhooks of the user, the oldest first.
+	GetWebhooks(ctx context.Context, userID int64) ([]types.Webhook, error)
+	// DeleteWebhook deletes the webhook with the events waiting for it.
+	// It does nothing when the user has no such webhook.
+	DeleteWebhook(ctx context.Context, userID int64, webhookID int) error
+	// ClaimDeliveries takes up to limit events of all the users due by now, the oldest first,
+	// and makes them due at leaseUntil, so that the other bots do not deliver them meanwhile.
+	ClaimDeliveries(ctx context.Context, now, leaseUntil time.Time, limit int) ([]types.WebhookDelivery, error)
+	// CompleteDelivery removes the delivered event from the outbox.
+	CompleteDelivery(ctx context.Context, deliveryID int) error
+	// RetryDelivery counts the failed attempts of the event and makes it due again at the time.
+	RetryDelivery(ctx context.Context, deliveryID, attempts int, at time.Time) error
+}
+
+// AccessStorage keeps who may use the bot besides the config: the access mode and the
+// allowlist set by the admins in the chat, and the invites.
+type AccessStorage interface {
+	// GetAccessMode returns the mode set by the admins, empty when they have not set any.
+	GetAccessMode(ctx context.Context) (types.AccessMode, error)
+	// SetAccessMode replaces the mode, an empty one brings back the mode from the config.
+	SetAccessMode(ctx context.Context, mode types.AccessMode) error
+	// GetAllowlist returns the entries in the order of adding.
+	GetAllowlist(ctx context.Context) ([]types.AllowlistEntry, error)
+	// IsAllowed tells whether the user is on the allowlist by the ID or by the username.
+	IsAllowed(ctx context.Context, userID int64, username string) (bool, error)
+	// Allow adds the entry, it does nothing when the entry is there already.
+	Allow(ctx context.Context, entry types.AllowlistEntry, now time.Time) error
+	// Disallow removes the entry, it is false when the entry is not there.
+	Disallow(ctx context.Context, entry types.AllowlistEntry) (bool, error)
+	AddInvite(ctx context.Context, invite types.Invite) error
+	// UseInvite marks the invite used by the user. It is false when there is no such
+	// invite, it has been used or it has expired by now.
+	UseInvite(ctx context.Context, code string, userID int64, now time.Time) (bool, error)
+	// ForgetInvites deletes the invites the user has made or used. The user stays on the
+	// allowlist, which is up to the admins.
+	ForgetInvites(ctx context.Context, userID int64) error
+}
+
+// SettingsStorage keeps the preferences of the users.
+type SettingsStorage interface {
+	// GetSettings returns types.DefaultSettings for a user who has not saved any.
+	GetSettings(ctx context.Context, userID int64) (types.Settings, error)
+	SaveSettings(ctx context.Context, userID int64, settings types.Settings) error
+}
+
+// Storage is the set of storages of one backend.
+type Storage struct {
+	Contacts ContactsStorage
+	Users    UsersStorage
+	Settings SettingsStorage
+	Webhooks WebhooksStorage
+	Access   AccessStorage
+	Tx       TxManager
+
+	close func() error
+}
+
+// Open opens the storage backend chosen in the config.
+func Open(service *config.Service) (*Storage, error) {
+	switch service.StorageDriver() {
+	case DriverPostgres, "":
+		db, err := New(service)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot open postgres")
+		}
+		return NewPostgresStorage(db), nil
+	case DriverSQLite:
+		db, err := NewSQLite(service.SQLitePath())
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot open sqlite")
+		}
+		return &Storage{
+			Contacts: &contactsDB{db: db, tx: NewTxManager(db), dialect: dialectSQLite},
+			Users:    &usersDB{db: db, dialect: dialectSQLite},
+			Settings: NewSettingsDB(db),
+			Webhooks: NewWebhooksDB(db),
+			Access:   NewAccessDB(db),
+			Tx:       NewTxManager(db),
+			close:    db.Close,
+		}, nil
+	case DriverMemory:
+		return NewMemoryStorage(), nil
+	}
+
+	return nil, errors.Errorf("unknown storage driver %q", service.StorageDriver())
+}
+
+// NewPostgresStorage is the storage in the Postgres database, migrated with goose.
+// Closing the storage closes the database.
+func NewPostgresStorage(db *sql.DB) *Storage {
+	return &Storage{
+		Contacts: NewContactsDB(db),
+		Users:    NewUsersDB(db),
+		Settings: NewSettingsDB(db),
+		Webhooks: NewWebhooksDB(db),
+		Access:   NewAccessDB(db),
+		Tx:       NewTxManager(db),
+		close:    db.Close,
+	}
+}
+
+func (s *Storage) Close() error {
+	if s.close == nil {
+		return nil
+	}
+	return s.close()
+}
@@ -0,0 +1,2128 @@
+// Package storagetest is the conformance suite of the storage backends.
+//
+// Every backend must behave the same for the models, so each one is checked with the same
+// cases here. The cases use fresh users starting from the given ID and may be run against
+// a database with other data in it.
+package storagetest
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/profectus200/contact-book-bot/internal/database"
+	"github.com/profectus200/contact-book-bot/internal/types"
+)
+
+type testCase struct {
+	name string
+	run  func(ctx context.Context, s *database.Storage, userID int64) error
+}
+
+var cases = []testCase{
+	{name: "no state for unknown user", run: testNoState},
+	{name: "set and get state", run: testSetState},
+	{name: "wait state for new user", run: testWaitStateNewUser},
+	{name: "wait state ends conversation", run: testWaitStateEndsConversation},
+	{name: "expire states", run: testExpireStates},
+	{name: "no contact", run: testNoContact},
+	{name: "write and get contact", run: testWriteContact},
+	{name: "write contact over another", run: testRewriteContact},
+	{name: "write fields", run: testWriteFields},
+	{name: "write fields of missing contact", run: testWriteMissing},
+	{name: "remove birthday", run: testRemoveBirthday},
+	{name: "list contacts of user", run: testListContacts},
+	{name: "find contacts by name", run: testFindByName},
+	{name: "search contacts", run: testSearchContacts},
+	{name: "delete contact", run: testDeleteContact},
+	{name: "external contact ids", run: testExternalContactIDs},
+	{name: "merge contacts", run: testMergeContacts},
+	{name: "custom fields", run: testCustomFields},
+	{name: "events", run: testEvents},
+	{name: "digests", run: testDigests},
+	{name: "calendar tokens", run: testCalendarTokens},
+	{name: "carddav", run: testCardDAV},
+	{name: "api tokens", run: testAPITokens},
+	{name: "banned credentials", run: testBannedCredentials},
+	{name: "webhooks", run: testWebhooks},
+	{name: "admin", run: testAdmin},
+	{name: "access", run: testAccess},
+	{name: "usernames", run: testUsernames},
+	{name: "delete user", run: testDeleteUser},
+	{name: "interactions", run: testInteractions},
+	{name: "reminders", run: testReminders},
+	{name: "lock creates user", run: testLockCreatesUser},
+	{name: "default settings", run: testDefaultSettings},
+	{name: "save settings", run: testSaveSettings},
+	{name: "transaction commits", run: testTxCommit},
+	{name: "transaction rolls back", run: testTxRollback},
+	{name: "rollback keeps writes outside of transaction", run: testTxRollbackKeepsOthers},
+	{name: "nested transaction joins outer", run: testTxNested},
+}
+
+// PostgresEnv is the variable with the connection string of the Postgres database to run
+// the tests against, e.g. "host=localhost user=postgres password=secret dbname=contact_book sslmode=disable".
+// The schema must be migrated with goose beforehand.
+const PostgresEnv = "TEST_POSTGRES_DSN"
+
+// Run runs every case as a subtest on the storage open gives it, as a different user.
+func Run(t *testing.T, open func(t *testing.T) *database.Storage) {
+	// Fresh users on every run, so that the cases do not see the data of the previous ones
+	// in a database kept between the runs.
+	firstUserID := time.Now().UnixNano() / int64(time.Millisecond)
+
+	for i, c := range cases {
+		userID := firstUserID + int64(i)
+		t.Run(c.name, func(t *testing.T) {
+			if err := c.run(context.Background(), open(t), userID); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+// OpenPostgres opens the database from PostgresEnv and closes it after the test.
+// The test is skipped when the variable is not set.
+func OpenPostgres(t *testing.T) *database.Storage {
+	dsn := os.Getenv(PostgresEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", PostgresEnv)
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("cannot open postgres: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return database.NewPostgresStorage(db)
+}
+
+var birthday = &types.Birthday{Day: 12, Month: time.March, Year: 1990}
+
+func newContact(contactID int, name string) *types.Contact {
+	return &types.Contact{
+		ContactID:   contactID,
+		Name:        name,
+		Email:       "alice@example.com",
+		Phone:       "+7 900 123 45 67",
+		Birthday:    birthday,
+		Description: "Met at GopherCon",
+		PhotoID:     "photo-alice",
+	}
+}
+
+// addUser creates the user, as contacts may only belong to a known one.
+func addUser(ctx context.Context, s *database.Storage, userID int64) error {
+	return errors.Wrap(s.Users.ToWaitState(ctx, userID), "cannot ToWaitState")
+}
+
+func addContacts(ctx context.Context, s *database.Storage, userID int64, contacts ...*types.Contact) error {
+	if err := addUser(ctx, s, userID); err != nil {
+		return err
+	}
+	for _, contact := range contacts {
+		if err := s.Contacts.WriteContact(ctx, userID, contact); err != nil {
+			return errors.Wrap(err, "cannot WriteContact")
+		}
+	}
+	return nil
+}
+
+func testNoState(ctx context.Context, s *database.Storage, userID int64) error {
+	if state, ok := s.Users.GetCurrentState(ctx, userID); ok {
+		return errors.Errorf("got state %+v for unknown user", state.CurrentState)
+	}
+	return nil
+}
+
+func testSetState(ctx context.Context, s *database.Storage, userID int64) error {
+	// Timestamps are stored with a precision of microseconds in Postgres.
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	for _, want := range []types.CurrentState{
+		{Flow: "contact.name", Step: "value", Payload: `{"contact_id":10}`, ExpiresAt: expiresAt},
+		{Flow: "search", Step: "phrase", Payload: `{}`},
+	} {
+		if err := s.Users.SetCurrentState(ctx, userID, want); err != nil {
+			return errors.Wrap(err, "cannot SetCurrentState")
+		}
+
+		got, ok := s.Users.GetCurrentState(ctx, userID)
+		if !ok {
+			return errors.New("no state after SetCurrentState")
+		}
+		if !equalStates(got.CurrentState, want) {
+			return errors.Errorf("got state %+v, want %+v", got.CurrentState, want)
+		}
+	}
+	return nil
+}
+
+func testWaitStateNewUser(ctx context.Context, s *database.Storage, userID int64) error {
+	if err := s.Users.ToWaitState(ctx, userID); err != nil {
+		return errors.Wrap(err, "cannot ToWaitState")
+	}
+
+	got, ok := s.Users.GetCurrentState(ctx, userID)
+	if !ok {
+		return errors.New("no state after ToWaitState")
+	}
+	if !got.CurrentState.Waiting() {
+		return errors.Errorf("got state %+v, want waiting", got.CurrentState)
+	}
+	return nil
+}
+
+func testWaitStateEndsConversation(ctx context.Context, s *database.Storage, userID int64) error {
+	err := s.Users.SetCurrentState(ctx, userID, types.CurrentState{
+		Flow:      "contact.name",
+		Step:      "value",
+		Payload:   `{"contact_id":10}`,
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		return errors.Wrap(err, "cannot SetCurrentState")
+	}
+	if err := s.Users.ToWaitState(ctx, userID); err != nil {
+		return errors.Wrap(err, "cannot ToWaitState")
+	}
+
+	got, _ := s.Users.GetCurrentState(ctx, userID)
+	if got == nil || !equalStates(got.CurrentState, types.CurrentState{}) {
+		return errors.Errorf("got state %+v, want an empty one", got)
+	}
+	return nil
+}
+
+func testExpireStates(ctx context.Context, s *database.Storage, userID int64) error {
+	now := time.Now()
+
+	expiring := types.CurrentState{Flow: "search", Step: "phrase", ExpiresAt: now.Add(-time.Minute)}
+	if err := s.Users.SetCurrentState(ctx, userID, expiring); err != nil {
+		return errors.Wrap(err, "cannot SetCurrentState")
+	}
+	// Another user of the same case, who still has time to answer.
+	fresh := types.CurrentState{Flow: "search", Step: "phrase", ExpiresAt: now.Add(time.Hour)}
+	if err := s.Users.SetCurrentState(ctx, -userID, fresh); err != nil {
+		return errors.Wrap(err, "cannot SetCurrentState")
+	}
+
+	expired, err := s.Users.ExpireStates(ctx, now)
+	if err != nil {
+		return errors.Wrap(err, "cannot ExpireStates")
+	}
+
+	found := false
+	for _, expiredID := range expired {
+		if expiredID == -userID {
+			return errors.New("conversation which has not expired yet was ended")
+		}
+		found = found || expiredID == userID
+	}
+	if !found {
+		return errors.Errorf("expired users %v do not include %d", expired, userID)
+	}
+
+	if got, _ := s.Users.GetCurrentState(ctx, userID); got == nil || !got.CurrentState.Waiting() {
+		return errors.Errorf("got state %+v after expiry, want waiting", got)
+	}
+	if got, _ := s.Users.GetCurrentState(ctx, -userID); got == nil || got.CurrentState.Waiting() {
+		return errors.Errorf("got state %+v of fresh conversation, want it kept", got)
+	}
+	return nil
+}
+
+func equalStates(a, b types.CurrentState) bool {
+	return a.Flow == b.Flow && a.Step == b.Step && a.Payload == b.Payload && a.ExpiresAt.Equal(b.ExpiresAt)
+}
+
+func testNoContact(ctx context.Context, s *database.Storage, userID int64) error {
+	contact, err := s.Contacts.GetContact(ctx, userID, 1)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetContact")
+	}
+	if contact != nil {
+		return errors.Errorf("got contact %+v, want none", contact)
+	}
+	return nil
+}
+
+func testWriteContact(ctx context.Context, s *database.Storage, userID int64) error {
+	want := newContact(1, "Alice")
+	if err := addContacts(ctx, s, userID, want); err != nil {
+		return err
+	}
+
+	got, err := s.Contacts.GetContact(ctx, userID, want.ContactID)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetContact")
+	}
+	return compareContacts(got, want)
+}
+
+func testRewriteContact(ctx context.Context, s *database.Storage, userID int64) error {
+	alice := newContact(1, "Alice")
+	alice.CustomFields = []types.CustomField{{Name: "Company", Type: types.CustomText, Value: "Gopher Inc"}}
+	alice.Events = []types.Event{
+		{Name: "Wedding", Date: types.Birthday{Day: 12, Month: time.June, Year: 2015}, Recurrence: types.Yearly},
+	}
+	if err := addContacts(ctx, s, userID, alice); err != nil {
+		return err
+	}
+
+	// The contact written with the ID of another one replaces it with its fields and dates.
+	want := newContact(1, "Alicia")
+	want.CustomFields = []types.CustomField{{Name: "Website", Type: types.CustomURL, Value: "https://alicia.example.com"}}
+	if err := s.Contacts.WriteContact(ctx, userID, want); err != nil {
+		return errors.Wrap(err, "cannot WriteContact")
+	}
+
+	contacts, err := s.Contacts.GetAllContacts(ctx, userID)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetAllContacts")
+	}
+	if len(contacts) != 1 {
+		return errors.Errorf("got %d contacts, want 1", len(contacts))
+	}
+	return compareContacts(contacts[0], want)
+}
+
+func testWriteFields(ctx context.Context, s *database.Storage, userID int64) error {
+	if err := addContacts(ctx, s, userID, newContact(1, "Alice")); err != nil {
+		return err
+	}
+
+	want := &types.Contact{
+		ContactID:   1,
+		Name:        "Alicia",
+		Email:       "alicia@example.org",
+		Phone:       "+44 20 7946 0000",
+		Birthday:    &types.Birthday{Day: 29, Month: time.February},
+		Description: "Works on payments",
+		PhotoID:     "photo-alicia",
+	}
+	writes := []error{
+		s.Contacts.WriteName(ctx, want.Name, userID, want.ContactID),
+		s.Contacts.WriteEmail(ctx, want.Email, userID, want.ContactID),
+		s.Contacts.WritePhone(ctx, want.Phone, userID, want.ContactID),
+		s.Contacts.WriteBirthday(ctx, want.Birthday, userID, want.ContactID),
+		s.Contacts.WriteDescription(ctx, want.Description, userID, want.ContactID),
+		s.Contacts.WritePhoto(ctx, want.PhotoID, userID, want.ContactID),
+	}
+	for _, err := range writes {
+		if err != nil {
+			return errors.Wrap(err, "cannot write field")
+		}
+	}
+
+	got, err := s.Contacts.GetContact(ctx, userID, want.ContactID)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetContact")
+	}
+	return compareContacts(got, want)
+}
+
+func testRemoveBirthday(ctx context.Context, s *database.Storage, userID int64) error {
+	want := newContact(1, "Alice")
+	if err := addContacts(ctx, s, userID, want); err != nil {
+		return err
+	}
+
+	if err := s.Contacts.WriteBirthday(ctx, nil, userID, want.ContactID); err != nil {
+		return errors.Wrap(err, "cannot WriteBirthday")
+	}
+	want.Birthday = nil
+
+	got, err := s.Contacts.GetContact(ctx, userID, want.ContactID)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetContact")
+	}
+	return compareContacts(got, want)
+}
+
+func testWriteMissing(ctx context.Context, s *database.Storage, userID int64) error {
+	if err := addUser(ctx, s, userID); err != nil {
+		return err
+	}
+	if err := s.Contacts.WriteName(ctx, "Alice", userID, 1); err != nil {
+		return errors.Wrap(err, "cannot WriteName")
+	}
+
+	contacts, err := s.Contacts.GetAllContacts(ctx, userID)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetAllContacts")
+	}
+	if len(contacts) != 0 {
+		return errors.Errorf("writing a field created %d contacts", len(contacts))
+	}
+	return nil
+}
+
+func testListContacts(ctx context.Context, s *database.Storage, userID int64) error {
+	contacts, err := s.Contacts.GetAllContacts(ctx, userID)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetAllContacts")
+	}
+	if contacts == nil || len(contacts) != 0 {
+		return errors.Errorf("got %v for user without contacts, want an empty list", contacts)
+	}
+
+	if err := addContacts(ctx, s, userID, newContact(1, "Alice"), newContact(2, "Bob")); err != nil {
+		return err
+	}
+
+	contacts, err = s.Contacts.GetAllContacts(ctx, userID)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetAllContacts")
+	}
+	if len(contacts) != 2 {
+		return errors.Errorf("got %d contacts, want 2", len(contacts))
+	}
+	return nil
+}
+
+func testFindByName(ctx context.Context, s *database.Storage, userID int64) error {
+	alice := newContact(1, "Alice")
+	if err := addContacts(ctx, s, userID, alice, newContact(2, "Bob"), newContact(3, "Alice Cooper")); err != nil {
+		return err
+	}
+
+	found, err := s.Contacts.GetContactByName(ctx, userID, "Alice")
+	if err != nil {
+		return errors.Wrap(err, "cannot GetContactByName")
+	}
+	if len(found) != 1 {
+		return errors.Errorf("found %d contacts, want 1", len(found))
+	}
+	return compareContacts(found[0], alice)
+}
+
+func testSearchContacts(ctx context.Context, s *database.Storage, userID int64) error {
+	alice := newContact(1, "Alice")
+	alice.Description = "Met at GopherCon, works on payments"
+	bob := newContact(2, "Bob")
+	bob.Description = "Payments team lead"
+	carol := newContact(3, "Carol")
+	carol.Description = "Likes Go"
+	carol.CustomFields = []types.CustomField{{Name: "Website", Type: types.CustomURL, Value: "https://carol.example.net/blog"}}
+	dave := newContact(4, "Dave")
+	dave.Description = "Write to dave@example.org about the offer"
+	if err := addContacts(ctx, s, userID, alice, bob, carol, dave); err != nil {
+		return err
+	}
+	// The contacts of other users are not found.
+	if err := addContacts(ctx, s, userID+1000, newContact(1, "Payments")); err != nil {
+		return err
+	}
+
+	cases := []struct {
+		query   string
+		found   []int
+		snippet string
+	}{
+		{query: "gophercon", found: []int{1}, snippet: "[GopherCon]"},
+		{query: "pay*", found: []int{1, 2}},
+		{query: `"works on payments"`, found: []int{1}, snippet: "[works] [on] [payments]"},
+		{query: `"payments works"`},
+		{query: "bob", found: []int{2}},
+		{query: "alice payments", found: []int{1}, snippet: "[payments]"},
+		// Emails and links are found by their words, as the phrases of them.
+		{query: "dave@example.org", found: []int{4}, snippet: "[dave]@[example].[org]"},
+		{query: "example*", found: []int{3, 4}},
+		{query: "carol.example.net/blog", found: []int{3}},
+		{query: "https://carol.example.net", found: []int{3}},
+		{query: "dave@example.net"},
+	}
+	for _, c := range cases {
+		query, err := types.ParseSearchQuery(c.query)
+		if err != nil {
+			return errors.Wrapf(err, "cannot ParseSearchQuery %q", c.query)
+		}
+		results, err := s.Contacts.SearchContacts(ctx, userID, query)
+		if err != nil {
+			return errors.Wrapf(err, "cannot SearchContacts %q", c.query)
+		}
+
+		found := make([]int, 0, len(results))
+		for _, result := range results {
+			found = append(found, result.Contact.ContactID)
+		}
+		sort.Ints(found)
+		if len(found) != len(c.found) || (len(found) > 0 && !reflect.DeepEqual(found, c.found)) {
+			return errors.Errorf("%q found %v, want %v", c.query, found, c.found)
+		}
+		if c.snippet != "" && !strings.Contains(results[0].Snippet, c.snippet) {
+			return errors.Errorf("%q has snippet %q, want %q in it", c.query, results[0].Snippet, c.snippet)
+		}
+	}
+
+	// A contact found by the name only has nothing to highlight in the description.
+	query, _ := types.ParseSearchQuery("bob")
+	results, err := s.Contacts.SearchContacts(ctx, userID, query)
+	if err != nil {
+		return errors.Wrap(err, "cannot SearchContacts")
+	}
+	if results[0].Snippet != "" {
+		return errors.Errorf("name match has snippet %q", results[0].Snippet)
+	}
+	return compareContacts(results[0].Contact, bob)
+}
+
+func testDeleteContact(ctx context.Context, s *database.Storage, userID int64) error {
+	if err := addContacts(ctx, s, userID, newContact(1, "Alice"), newContact(2, "Bob")); err != nil {
+		return err
+	}
+
+	if err := s.Contacts.DeleteContact(ctx, userID, 1); err != nil {
+		return errors.Wrap(err, "cannot DeleteContact")
+	}
+	// Deleting twice is not an error.
+	if err := s.Contacts.DeleteContact(ctx, userID, 1); err != nil {
+		return errors.Wrap(err, "cannot DeleteContact twice")
+	}
+
+	contact, err := s.Contacts.GetContact(ctx, userID, 1)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetContact")
+	}
+	if contact != nil {
+		return errors.New("deleted contact is still there")
+	}
+
+	contacts, err := s.Contacts.GetAllContacts(ctx, userID)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetAllContacts")
+	}
+	if len(contacts) != 1 || contacts[0].Name != "Bob" {
+		return errors.Errorf("got %d contacts after delete, want only Bob", len(contacts))
+	}
+	return nil
+}
+
+func testExternalContactIDs(ctx context.Context, s *database.Storage, userID int64) error {
+	next := func() (int, error) {
+		contactID, err := s.Users.NextExternalContactID(ctx, userID)
+		if err != nil {
+			return 0, errors.Wrap(err, "cannot NextExternalContactID")
+		}
+		return contactID, errors.Wrap(addContacts(ctx, s, userID, newContact(contactID, "External")), "cannot add contact")
+	}
+
+	first, err := next()
+	if err != nil {
+		return err
+	}
+	if first != -1 {
+		return errors.Errorf("got ID %d of the first contact, want -1", first)
+	}
+	second, err := next()
+	if err != nil {
+		return err
+	}
+	if second != -2 {
+		return errors.Errorf("got ID %d of the second contact, want -2", second)
+	}
+
+	// The ID of a deleted contact is not given to another one.
+	if err := s.Contacts.DeleteContact(ctx, userID, second); err != nil {
+		return errors.Wrap(err, "cannot DeleteContact")
+	}
+	third, err := next()
+	if err != nil {
+		return err
+	}
+	if third != -3 {
+		return errors.Errorf("got ID %d after deleting the contact %d, want -3", third, second)
+	}
+	return nil
+}
+
+func testMergeContacts(ctx context.Context, s *database.Storage, userID int64) error {
+	keep := &types.Contact{ContactID: 1, Name: "Alice", Phone: "+7 900 123 45 67", Description: "Neighbour"}
+	other := newContact(2, "Alice Smith")
+	other.Phone = "8 (900) 123-45-67"
+	if err := addContacts(ctx, s, userID, keep, other); err != nil {
+		return err
+	}
+
+	merged, err := s.Contacts.MergeContacts(ctx, userID, 1, 2)
+	if err != nil {
+		return errors.Wrap(err, "cannot MergeContacts")
+	}
+	want := &types.Contact{
+		ContactID:   1,
+		Name:        "Alice Smith",
+		Email:       other.Email,
+		Phone:       keep.Phone,
+		Birthday:    birthday,
+		Description: "Neighbour\nMet at GopherCon",
+		PhotoID:     other.PhotoID,
+	}
+	if err := compareContacts(merged, want); err != nil {
+		return errors.Wrap(err, "merged contact")
+	}
+
+	stored, err := s.Contacts.GetContact(ctx, userID, 1)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetContact")
+	}
+	if err := compareContacts(stored, want); err != nil {
+		return errors.Wrap(err, "stored contact")
+	}
+	removed, err := s.Contacts.GetContact(ctx, userID, 2)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetContact")
+	}
+	if removed != nil {
+		return errors.New("merged contact is still there")
+	}
+
+	// The other contact is gone, so there is nothing to merge any more.
+	merged, err = s.Contacts.MergeContacts(ctx, userID, 1, 2)
+	if err != nil {
+		return errors.Wrap(err, "cannot MergeContacts twice")
+	}
+	if merged != nil {
+		return errors.Errorf("merged with missing contact into %+v", merged)
+	}
+	return nil
+}
+
+func testCustomFields(ctx context.Context, s *database.Storage, userID int64) error {
+	alice := newContact(1, "Alice")
+	alice.CustomFields = []types.CustomField{
+		{Name: "Website", Type: types.CustomURL, Value: "https://alice.example.com"},
+		{Name: "Company", Type: types.CustomText, Value: "Gopher Inc"},
+	}
+	if err := addContacts(ctx, s, userID, alice, newContact(2, "Bob")); err != nil {
+		return err
+	}
+
+	// The fields come ordered by the name.
+	want := *alice
+	want.CustomFields = []types.CustomField{alice.CustomFields[1], alice.CustomFields[0]}
+	got, err := s.Contacts.GetContact(ctx, userID, 1)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetContact")
+	}
+	if err := compareContacts(got, &want); err != nil {
+		return errors.Wrap(err, "written contact")
+	}
+
+	// A field with the same name is replaced, a new one is added.
+	founded := types.CustomField{Name: "Founded", Type: types.CustomDate, Value: "--04-01"}
+	company := types.CustomField{Name: "Company", Type: types.CustomText, Value: "Gopher Ltd"}
+	for _, field := range []types.CustomField{founded, company} {
+		if err := s.Contacts.WriteCustomField(ctx, userID, 1, field); err != nil {
+			return errors.Wrap(err, "cannot WriteCustomField")
+		}
+	}
+	if err := s.Contacts.DeleteCustomField(ctx, userID, 1, "Website"); err != nil {
+		return errors.Wrap(err, "cannot DeleteCustomField")
+	}
+	want.CustomFields = []types.CustomField{company, founded}
+
+	contacts, err := s.Contacts.GetAllContacts(ctx, userID)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetAllContacts")
+	}
+	if len(contacts) != 2 {
+		return errors.Errorf("got %d contacts, want 2", len(contacts))
+	}
+	if err := compareContacts(contacts[0], &want); err != nil {
+		return errors.Wrap(err, "listed contact")
+	}
+	if len(contacts[1].CustomFields) != 0 {
+		return errors.Errorf("got fields %+v of a contact without them", contacts[1].CustomFields)
+	}
+
+	query, err := types.ParseSearchQuery("gopher ltd")
+	if err != nil {
+		return errors.Wrap(err, "cannot ParseSearchQuery")
+	}
+	results, err := s.Contacts.SearchContacts(ctx, userID, query)
+	if err != nil {
+		return errors.Wrap(err, "cannot SearchContacts")
+	}
+	if len(results) != 1 {
+		return errors.Errorf("found %d contacts by the field, want 1", len(results))
+	}
+	if err := compareContacts(results[0].Contact, &want); err != nil {
+		return errors.Wrap(err, "found contact")
+	}
+
+	// A field is only added to an existing contact.
+	if err := s.Contacts.WriteCustomField(ctx, userID, 3, company); err != nil {
+		return errors.Wrap(err, "cannot WriteCustomField of missing contact")
+	}
+	missing, err := s.Contacts.GetContact(ctx, userID, 3)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetContact")
+	}
+	if missing != nil {
+		return errors.Errorf("writing a field created contact %+v", missing)
+	}
+
+	// Merging keeps the fields of both contacts, the kept contact wins on the same name.
+	bobCompany := types.CustomField{Name: "Company", Type: types.CustomText, Value: "Bob & Co"}
+	telegram := types.CustomField{Name: "Telegram", Type: types.CustomText, Value: "@bob"}
+	for _, field := range []types.CustomField{bobCompany, telegram} {
+		if err := s.Contacts.WriteCustomField(ctx, userID, 2, field); err != nil {
+			return errors.Wrap(err, "cannot WriteCustomField")
+		}
+	}
+	if _, err := s.Contacts.MergeContacts(ctx, userID, 1, 2); err != nil {
+		return errors.Wrap(err, "cannot MergeContacts")
+	}
+	merged, err := s.Contacts.GetContact(ctx, userID, 1)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetContact")
+	}
+	wantFields := []types.CustomField{company, founded, telegram}
+	if merged == nil || !sameCustomFields(merged.CustomFields, wantFields) {
+		return errors.Errorf("got merged contact %+v, want fields %+v", merged, wantFields)
+	}
+
+	// The fields go away with the contact and do not come back with a new one under its ID.
+	if err := s.Contacts.DeleteContact(ctx, userID, 1); err != nil {
+		return errors.Wrap(err, "cannot DeleteContact")
+	}
+	if err := addContacts(ctx, s, userID, newContact(1, "Carol")); err != nil {
+		return err
+	}
+	carol, err := s.Contacts.GetContact(ctx, userID, 1)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetContact")
+	}
+	if carol == nil || len(carol.CustomFields) != 0 {
+		return errors.Errorf("got contact %+v, want no fields", carol)
+	}
+	return nil
+}
+
+func testEvents(ctx context.Context, s *database.Storage, userID int64) error {
+	alice := newContact(1, "Alice")
+	alice.Events = []types.Event{
+		{Name: "Wedding", Date: types.Birthday{Day: 12, Month: time.June, Year: 2015}, Recurrence: types.Yearly},
+		{Name: "Name day", Date: types.Birthday{Day: 23, Month: time.April}, Recurrence: types.Yearly},
+	}
+	if err := addContacts(ctx, s, userID, alice, newContact(2, "Bob")); err != nil {
+		return err
+	}
+
+	// The dates come ordered by the name.
+	want := *alice
+	want.Events = []types.Event{alice.Events[1], alice.Events[0]}
+	got, err := s.Contacts.GetContact(ctx, userID, 1)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetContact")
+	}
+	if err := compareContacts(got, &want); err != nil {
+		return errors.Wrap(err, "written contact")
+	}
+
+	// A date with the same name is replaced, a new one is added.
+	renewal := types.Event{
+		Name:       "Contract renewal",
+		Date:       types.Birthday{Day: 31, Month: time.January, Year: 2023},
+		Recurrence: types.Recurrence{Every: 6, Unit: types.RecurMonth},
+	}
+	wedding := types.Event{Name: "Wedding", Date: types.Birthday{Day: 13, Month: time.June, Year: 2015}, Recurrence: types.Yearly}
+	for _, event := range []types.Event{renewal, wedding} {
+		if err := s.Contacts.WriteEvent(ctx, userID, 1, event); err != nil {
+			return errors.Wrap(err, "cannot WriteEvent")
+		}
+	}
+	if err := s.Contacts.DeleteEvent(ctx, userID, 1, "Name day"); err != nil {
+		return errors.Wrap(err, "cannot DeleteEvent")
+	}
+	want.Events = []types.Event{renewal, wedding}
+
+	contacts, err := s.Contacts.GetAllContacts(ctx, userID)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetAllContacts")
+	}
+	if len(contacts) != 2 {
+		return errors.Errorf("got %d contacts, want 2", len(contacts))
+	}
+	if err := compareContacts(contacts[0], &want); err != nil {
+		return errors.Wrap(err, "listed contact")
+	}
+	if len(contacts[1].Events) != 0 {
+		return errors.Errorf("got dates %+v of a contact without them", contacts[1].Events)
+	}
+
+	// A date is only added to an existing contact.
+	if err := s.Contacts.WriteEvent(ctx, userID, 3, wedding); err != nil {
+		return errors.Wrap(err, "cannot WriteEvent of missing contact")
+	}
+	missing, err := s.Contacts.GetContact(ctx, userID, 3)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetContact")
+	}
+	if missing != nil {
+		return errors.Errorf("writing a date created contact %+v", missing)
+	}
+
+	// Merging keeps the dates of both contacts, the kept contact wins on the same name.
+	bobWedding := types.Event{Name: "Wedding", Date: types.Birthday{Day: 1, Month: time.May, Year: 2010}, Recurrence: types.Yearly}
+	dojo := types.Event{Name: "Dojo", Date: types.Birthday{Day: 3, Month: time.March, Year: 2023}, Recurrence: types.Recurrence{Every: 2, Unit: types.RecurWeek}}
+	for _, event := range []types.Event{bobWedding, dojo} {
+		if err := s.Contacts.WriteEvent(ctx, userID, 2, event); err != nil {
+			return errors.Wrap(err, "cannot WriteEvent")
+		}
+	}
+	if _, err := s.Contacts.MergeContacts(ctx, userID, 1, 2); err != nil {
+		return errors.Wrap(err, "cannot MergeContacts")
+	}
+	merged, err := s.Contacts.GetContact(ctx, userID, 1)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetContact")
+	}
+	wantEvents := []types.Event{renewal, dojo, wedding}
+	if merged == nil || !sameEvents(merged.Events, wantEvents) {
+		return errors.Errorf("got merged contact %+v, want dates %+v", merged, wantEvents)
+	}
+
+	// The dates go away with the contact and do not come back with a new one under its ID.
+	if err := s.Contacts.DeleteContact(ctx, userID, 1); err != nil {
+		return errors.Wrap(err, "cannot DeleteContact")
+	}
+	if err := addContacts(ctx, s, userID, newContact(1, "Carol")); err != nil {
+		return err
+	}
+	carol, err := s.Contacts.GetContact(ctx, userID, 1)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetContact")
+	}
+	if carol == nil || len(carol.Events) != 0 {
+		return errors.Errorf("got contact %+v, want no dates", carol)
+	}
+	return nil
+}
+
+func testDigests(ctx context.Context, s *database.Storage, userID int64) error {
+	// The user has a contact with a birthday, the next one only a contact with no dates.
+	bob := newContact(1, "Bob")
+	bob.Birthday = nil
+	if err := addContacts(ctx, s, userID+500, bob); err != nil {
+		return err
+	}
+	if err := addContacts(ctx, s, userID, newContact(1, "Alice")); err != nil {
+		return err
+	}
+
+	now := time.Date(2023, time.August, 2, 9, 0, 0, 0, time.UTC)
+	next := now.AddDate(0, 0, 1)
+	due := func(at time.Time) (bool, bool, error) {
+		userIDs, err := s.Users.DueDigests(ctx, at)
+		if err != nil {
+			return false, false, errors.Wrap(err, "cannot DueDigests")
+		}
+		var user, other bool
+		for _, id := range userIDs {
+			user = user || id == userID
+			other = other || id == userID+500
+		}
+		return user, other, nil
+	}
+
+	user, other, err := due(now)
+	if err != nil {
+		return err
+	}
+	if !user || other {
+		return errors.Errorf("got due %v and %v for the users with and without dates, want only the first", user, other)
+	}
+
+	claimed, err := s.Users.ClaimDigest(ctx, userID, now, next)
+	if err != nil {
+		return errors.Wrap(err, "cannot ClaimDigest")
+	}
+	if !claimed {
+		return errors.New("cannot claim the first digest")
+	}
+	claimed, err = s.Users.ClaimDigest(ctx, userID, now, next)
+	if err != nil {
+		return errors.Wrap(err, "cannot ClaimDigest")
+	}
+	if claimed {
+		return errors.New("claimed the same digest twice")
+	}
+
+	if user, _, err = due(now.Add(time.Hour)); err != nil {
+		return err
+	}
+	if user {
+		return errors.New("digest is due before the scheduled time")
+	}
+	if user, _, err = due(next); err != nil {
+		return err
+	}
+	if !user {
+		return errors.New("digest is not due at the scheduled time")
+	}
+	claimed, err = s.Users.ClaimDigest(ctx, userID, next, next.AddDate(0, 0, 1))
+	if err != nil {
+		return errors.Wrap(err, "cannot ClaimDigest")
+	}
+	if !claimed {
+		return errors.New("cannot claim the next digest")
+	}
+
+	// The digest which could not be sent is due again at the time of the retry.
+	retryAt := next.Add(15 * time.Minute)
+	if err := s.Users.ScheduleDigest(ctx, userID, retryAt); err != nil {
+		return errors.Wrap(err, "cannot ScheduleDigest")
+	}
+	if user, _, err = due(retryAt.Add(-time.Minute)); err != nil {
+		return err
+	}
+	if user {
+		return errors.New("digest is due before the retry")
+	}
+	if user, _, err = due(retryAt); err != nil {
+		return err
+	}
+	if !user {
+		return errors.New("digest is not due at the retry")
+	}
+	return nil
+}
+
+func testCalendarTokens(ctx context.Context, s *database.Storage, userID int64) error {
+	if err := addUser(ctx, s, userID); err != nil {
+		return err
+	}
+
+	// Tokens are unique across the users, so they must differ between the runs too.
+	oldToken := fmt.Sprintf("old-%d-%d", userID, time.Now().UnixNano())
+	newToken := fmt.Sprintf("new-%d-%d", userID, time.Now().UnixNano())
+	if err := s.Users.SetCalendarToken(ctx, userID, oldToken); err != nil {
+		return errors.Wrap(err, "cannot SetCalendarToken")
+	}
+	if err := s.Users.SetCalendarToken(ctx, userID, newToken); err != nil {
+		return errors.Wrap(err, "cannot SetCalendarToken")
+	}
+
+	foundID, ok, err := s.Users.UserByCalendarToken(ctx, newToken)
+	if err != nil {
+		return errors.Wrap(err, "cannot UserByCalendarToken")
+	}
+	if !ok || foundID != userID {
+		return errors.Errorf("got user %d (%v) by the token, want %d", foundID, ok, userID)
+	}
+	if _, ok, err = s.Users.UserByCalendarToken(ctx, oldToken); err != nil {
+		return errors.Wrap(err, "cannot UserByCalendarToken")
+	}
+	if ok {
+		return errors.New("found a user by the replaced token")
+	}
+
+	if err := s.Users.SetCalendarToken(ctx, userID, ""); err != nil {
+		return errors.Wrap(err, "cannot SetCalendarToken")
+	}
+	if _, ok, err = s.Users.UserByCalendarToken(ctx, newToken); err != nil {
+		return errors.Wrap(err, "cannot UserByCalendarToken")
+	}
+	if ok {
+		return errors.New("found a user by the removed token")
+	}
+	return nil
+}
+
+func testAPITokens(ctx context.Context, s *database.Storage, userID int64) error {
+	if err := addUser(ctx, s, userID); err != nil {
+		return err
+	}
+
+	// Hashes are unique across the users, so they must differ between the runs too.
+	oldHash := fmt.Sprintf("old-%d-%d", userID, time.Now().UnixNano())
+	newHash := fmt.Sprintf("new-%d-%d", userID, time.Now().UnixNano())
+	if err := s.Users.SetAPIToken(ctx, userID, oldHash); err != nil {
+		return errors.Wrap(err, "cannot SetAPIToken")
+	}
+	if err := s.Users.SetAPIToken(ctx, userID, newHash); err != nil {
+		return errors.Wrap(err, "cannot SetAPIToken")
+	}
+
+	foundID, ok, err := s.Users.UserByAPIToken(ctx, newHash)
+	if err != nil {
+		return errors.Wrap(err, "cannot UserByAPIToken")
+	}
+	if !ok || foundID != userID {
+		return errors.Errorf("got user %d (%v) by the token, want %d", foundID, ok, userID)
+	}
+	if _, ok, err = s.Users.UserByAPIToken(ctx, oldHash); err != nil {
+		return errors.Wrap(err, "cannot UserByAPIToken")
+	}
+	if ok {
+		return errors.New("found a user by the replaced token")
+	}
+
+	if err := s.Users.SetAPIToken(ctx, userID, ""); err != nil {
+		return errors.Wrap(err, "cannot SetAPIToken")
+	}
+	if _, ok, err = s.Users.UserByAPIToken(ctx, newHash); err != nil {
+		return errors.Wrap(err, "cannot UserByAPIToken")
+	}
+	if ok {
+		return errors.New("found a user by the removed token")
+	}
+	return nil
+}
+
+func testBannedCredentials(ctx context.Context, s *database.Storage, userID int64) error {
+	// Tokens and hashes are unique across the users, so they must differ between the runs too.
+	calendarToken := fmt.Sprintf("calendar-%d-%d", userID, time.Now().UnixNano())
+	apiHash := fmt.Sprintf("api-%d-%d", userID, time.Now().UnixNano())
+	if err := s.Users.SetCalendarToken(ctx, userID, calendarToken); err != nil {
+		return errors.Wrap(err, "cannot SetCalendarToken")
+	}
+	if err := s.Users.SetCardDAVPassword(ctx, userID, "password"); err != nil {
+		return errors.Wrap(err, "cannot SetCardDAVPassword")
+	}
+	if err := s.Users.SetAPIToken(ctx, userID, apiHash); err != nil {
+		return errors.Wrap(err, "cannot SetAPIToken")
+	}
+
+	check := func(want bool) error {
+		_, calendar, err := s.Users.UserByCalendarToken(ctx, calendarToken)
+		if err != nil {
+			return errors.Wrap(err, "cannot UserByCalendarToken")
+		}
+		hash, err := s.Users.GetCardDAVPassword(ctx, userID)
+		if err != nil {
+			return errors.Wrap(err, "cannot GetCardDAVPassword")
+		}
+		_, api, err := s.Users.UserByAPIToken(ctx, apiHash)
+		if err != nil {
+			return errors.Wrap(err, "cannot UserByAPIToken")
+		}
+		if calendar != want || (hash != "") != want || api != want {
+			return errors.Errorf("got calendar %v, CardDAV %v and API %v, want all %v", calendar, hash != "", api, want)
+		}
+		return nil
+	}
+
+	if err := check(true); err != nil {
+		return err
+	}
+	if err := s.Users.SetBanned(ctx, userID, true); err != nil {
+		return errors.Wrap(err, "cannot SetBanned")
+	}
+	if err := check(false); err != nil {
+		return errors.Wrap(err, "banned")
+	}
+	if err := s.Users.SetBanned(ctx, userID, false); err != nil {
+		return errors.Wrap(err, "cannot SetBanned")
+	}
+	return errors.Wrap(check(true), "unbanned")
+}
+
+func testWebhooks(ctx context.Context, s *database.Storage, userID int64) error {
+	// The changes made before the user has webhooks are not queued.
+	if err := addContacts(ctx, s, userID, newContact(1, "Alice")); err != nil {
+		return err
+	}
+
+	created := time.Date(2023, time.August, 10, 10, 0, 0, 0, time.UTC)
+	var webhooks []types.Webhook
+	for _, url := range []string{"https://example.com/a", "https://example.com/b"} {
+		webhook, err := s.Webhooks.AddWebhook(ctx, types.Webhook{UserID: userID, URL: url, Secret: "secret " + url, CreatedAt: created})
+		if err != nil {
+			return errors.Wrap(err, "cannot AddWebhook")
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	got, err := s.Webhooks.GetWebhooks(ctx, userID)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetWebhooks")
+	}
+	if len(got) != 2 || got[0].ID != webhooks[0].ID || got[1].URL != webhooks[1].URL ||
+		got[1].Secret != webhooks[1].Secret || !got[1].CreatedAt.Equal(created) {
+		return errors.Errorf("got webhooks %+v, want %+v", got, webhooks)
+	}
+
+	if err := s.Contacts.WriteName(ctx, "Alicia", userID, 1); err != nil {
+		return errors.Wrap(err, "cannot WriteName")
+	}
+	if err := s.Contacts.WriteContact(ctx, userID, newContact(2, "Bob")); err != nil {
+		return errors.Wrap(err, "cannot WriteContact")
+	}
+	// Deleting twice or writing a missing contact changes nothing.
+	for i := 0; i < 2; i++ {
+		if err := s.Contacts.DeleteContact(ctx, userID, 2); err != nil {
+			return errors.Wrap(err, "cannot DeleteContact")
+		}
+	}
+	if err := s.Contacts.WriteName(ctx, "Carol", userID, 3); err != nil {
+		return errors.Wrap(err, "cannot WriteName of missing contact")
+	}
+	// The event is rolled back with the change.
+	failure := errors.New("failure")
+	err = s.Tx.InTx(ctx, func(ctx context.Context) error {
+		if err := s.Contacts.WriteName(ctx, "Alice", userID, 1); err != nil {
+			return err
+		}
+		return failure
+	})
+	if err != failure {
+		return errors.Errorf("got error %v, want the one returned from the transaction", err)
+	}
+
+	now := time.Now()
+	deliveries, err := claimDeliveries(ctx, s, webhooks, now, now.Add(time.Second))
+	if err != nil {
+		return err
+	}
+	if len(deliveries) != 6 {
+		return errors.Errorf("got %d deliveries, want 6: %+v", len(deliveries), deliveries)
+	}
+	wantTypes := []types.WebhookEventType{types.ContactUpdated, types.ContactCreated, types.ContactDeleted}
+	for i, webhook := range webhooks {
+		var byWebhook []types.WebhookDelivery
+		for _, delivery := range deliveries {
+			if delivery.Webhook.ID == webhook.ID {
+				byWebhook = append(byWebhook, delivery)
+			}
+		}
+		if len(byWebhook) != len(wantTypes) {
+			return errors.Errorf("got deliveries %+v to webhook %d", byWebhook, i)
+		}
+		for j, delivery := range byWebhook {
+			if delivery.EventType != wantTypes[j] || delivery.Webhook.URL != webhook.URL ||
+				delivery.Webhook.Secret != webhook.Secret || delivery.Webhook.UserID != userID || delivery.Attempts != 0 {
+				return errors.Errorf("got delivery %+v, want %s to %+v", delivery, wantTypes[j], webhook)
+			}
+		}
+
+		var updated, deleted types.WebhookEvent
+		if err := json.Unmarshal(byWebhook[0].Payload, &updated); err != nil {
+			return errors.Wrap(err, "cannot Unmarshal")
+		}
+		if err := json.Unmarshal(byWebhook[2].Payload, &deleted); err != nil {
+			return errors.Wrap(err, "cannot Unmarshal")
+		}
+		if updated.Type != types.ContactUpdated || updated.ContactID != 1 || updated.Contact == nil ||
+			updated.Contact.Name != "Alicia" || updated.Contact.Email != "alice@example.com" || updated.ID == "" {
+			return errors.Errorf("got updated event %s", byWebhook[0].Payload)
+		}
+		if deleted.Type != types.ContactDeleted || deleted.ContactID != 2 || deleted.Contact != nil {
+			return errors.Errorf("got deleted event %s", byWebhook[2].Payload)
+		}
+	}
+
+	// The claimed events are not delivered twice until they are retried.
+	again, err := claimDeliveries(ctx, s, webhooks, now, now.Add(time.Second))
+	if err != nil {
+		return err
+	}
+	if len(again) != 0 {
+		return errors.Errorf("got deliveries %+v claimed twice", again)
+	}
+	retried := deliveries[0]
+	if err := s.Webhooks.RetryDelivery(ctx, retried.ID, 1, now.Add(-time.Minute)); err != nil {
+		return errors.Wrap(err, "cannot RetryDelivery")
+	}
+	again, err = claimDeliveries(ctx, s, webhooks, now, now.Add(time.Second))
+	if err != nil {
+		return err
+	}
+	if len(again) != 1 || again[0].ID != retried.ID || again[0].Attempts != 1 || string(again[0].Payload) != string(retried.Payload) {
+		return errors.Errorf("got retried deliveries %+v, want %+v", again, retried)
+	}
+
+	for _, delivery := range deliveries {
+		if err := s.Webhooks.CompleteDelivery(ctx, delivery.ID); err != nil {
+			return errors.Wrap(err, "cannot CompleteDelivery")
+		}
+	}
+	later := now.Add(time.Hour)
+	again, err = claimDeliveries(ctx, s, webhooks, later, later)
+	if err != nil {
+		return err
+	}
+	if len(again) != 0 {
+		return errors.Errorf("got completed deliveries %+v", again)
+	}
+
+	// Only the webhooks left get the events, and another user cannot delete one.
+	if err := s.Webhooks.DeleteWebhook(ctx, userID+500, webhooks[0].ID); err != nil {
+		return errors.Wrap(err, "cannot DeleteWebhook of other user")
+	}
+	if err := s.Webhooks.DeleteWebhook(ctx, userID, webhooks[1].ID); err != nil {
+		return errors.Wrap(err, "cannot DeleteWebhook")
+	}
+	got, err = s.Webhooks.GetWebhooks(ctx, userID)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetWebhooks")
+	}
+	if len(got) != 1 || got[0].ID != webhooks[0].ID {
+		return errors.Errorf("got webhooks %+v after deleting, want %+v", got, webhooks[:1])
+	}
+	if err := s.Contacts.WriteEvent(ctx, userID, 1, types.Event{Name: "Wedding", Date: types.Birthday{Day: 1, Month: time.June, Year: 2015},
+		Recurrence: types.Yearly}); err != nil {
+		return errors.Wrap(err, "cannot WriteEvent")
+	}
+	later = time.Now().Add(time.Hour)
+	deliveries, err = claimDeliveries(ctx, s, webhooks, later, later)
+	if err != nil {
+		return err
+	}
+	if len(deliveries) != 1 || deliveries[0].Webhook.ID != webhooks[0].ID || deliveries[0].EventType != types.ContactUpdated {
+		return errors.Errorf("got deliveries %+v, want one update to %+v", deliveries, webhooks[0])
+	}
+	return errors.Wrap(s.Webhooks.CompleteDelivery(ctx, deliveries[0].ID), "cannot CompleteDelivery")
+}
+
+// claimDeliveries claims the due events of the webhooks, the storage is shared with other users.
+func claimDeliveries(ctx context.Context, s *database.Storage, webhooks []types.Webhook, now, leaseUntil time.Time) ([]types.WebhookDelivery, error) {
+	deliveries, err := s.Webhooks.ClaimDeliveries(ctx, now, leaseUntil, 1000)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot ClaimDeliveries")
+	}
+
+	var own []types.WebhookDelivery
+	for _, delivery := range deliveries {
+		for _, webhook := range webhooks {
+			if delivery.Webhook.ID == webhook.ID {
+				own = append(own, delivery)
+			}
+		}
+	}
+	return own, nil
+}
+
+func testCardDAV(ctx context.Context, s *database.Storage, userID int64) error {
+	if err := addContacts(ctx, s, userID, newContact(1, "Alice"), newContact(2, "Bob")); err != nil {
+		return err
+	}
+
+	resources := []types.CardResource{
+		{ContactID: 1, Name: "alice.vcf", UID: "alice-uid"},
+		{ContactID: 2, Name: "bob.vcf", UID: "bob-uid"},
+		// There is no such contact, it is left out.
+		{ContactID: 3, Name: "carol.vcf", UID: "carol-uid"},
+		// The name of the first one is replaced.
+		{ContactID: 1, Name: "alice-2.vcf", UID: "alice-uid"},
+	}
+	for _, resource := range resources {
+		if err := s.Contacts.WriteCardResource(ctx, userID, resource); err != nil {
+			return errors.Wrapf(err, "cannot WriteCardResource %q", resource.Name)
+		}
+	}
+	if err := s.Contacts.DeleteContact(ctx, userID, 2); err != nil {
+		return errors.Wrap(err, "cannot DeleteContact")
+	}
+
+	got, err := s.Contacts.GetCardResources(ctx, userID)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetCardResources")
+	}
+	want := []types.CardResource{resources[3]}
+	if !reflect.DeepEqual(got, want) {
+		return errors.Errorf("got vCards %+v, want %+v", got, want)
+	}
+
+	hash, err := s.Users.GetCardDAVPassword(ctx, userID)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetCardDAVPassword")
+	}
+	if hash != "" {
+		return errors.Errorf("got password %q before setting one", hash)
+	}
+	for _, want := range []string{"first", "second", ""} {
+		if err := s.Users.SetCardDAVPassword(ctx, userID, want); err != nil {
+			return errors.Wrap(err, "cannot SetCardDAVPassword")
+		}
+		if hash, err = s.Users.GetCardDAVPassword(ctx, userID); err != nil {
+			return errors.Wrap(err, "cannot GetCardDAVPassword")
+		}
+		if hash != want {
+			return errors.Errorf("got password %q, want %q", hash, want)
+		}
+	}
+	return nil
+}
+
+func testAdmin(ctx context.Context, s *database.Storage, userID int64) error {
+	bannedID := userID + 500
+	seen := time.Now().UTC().Truncate(time.Second)
+	since := seen.Add(-time.Minute)
+
+	before, err := s.Users.GetStats(ctx, since)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetStats")
+	}
+	if info, err := s.Users.GetUserInfo(ctx, userID); err != nil || info != nil {
+		return errors.Errorf("got user %+v (%v) before the user is added, want none", info, err)
+	}
+
+	banned, err := s.Users.TouchUser(ctx, userID, "", seen)
+	if err != nil {
+		return errors.Wrap(err, "cannot TouchUser")
+	}
+	if banned {
+		return errors.New("new user is banned")
+	}
+	if err := addContacts(ctx, s, userID, newContact(1, "Alice"), newContact(2, "Bob")); err != nil {
+		return err
+	}
+	if err := s.Users.SetAPIToken(ctx, userID, fmt.Sprintf("admin-%d-%d", userID, time.Now().UnixNano())); err != nil {
+		return errors.Wrap(err, "cannot SetAPIToken")
+	}
+
+	// A user may be banned before sending the bot anything.
+	if err := s.Users.SetBanned(ctx, bannedID, true); err != nil {
+		return errors.Wrap(err, "cannot SetBanned")
+	}
+	if banned, err = s.Users.TouchUser(ctx, bannedID, "", seen.Add(-time.Hour)); err != nil {
+		return errors.Wrap(err, "cannot TouchUser")
+	}
+	if !banned {
+		return errors.New("banned user is not banned")
+	}
+
+	after, err := s.Users.GetStats(ctx, since)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetStats")
+	}
+	want := types.Stats{Users: before.Users + 2, Active: before.Active + 1, Banned: before.Banned + 1, Contacts: before.Contacts + 2}
+	if after != want {
+		return errors.Errorf("got stats %+v, want %+v", after, want)
+	}
+
+	info, err := s.Users.GetUserInfo(ctx, userID)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetUserInfo")
+	}
+	wantInfo := types.UserInfo{UserID: userID, LastSeen: seen, Contacts: 2, HasAPIToken: true}
+	if info == nil || !info.LastSeen.Equal(seen) {
+		return errors.Errorf("got user %+v, want %+v", info, wantInfo)
+	}
+	info.LastSeen = seen
+	if *info != wantInfo {
+		return errors.Errorf("got user %+v, want %+v", *info, wantInfo)
+	}
+
+	userIDs, err := s.Users.GetUserIDs(ctx)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetUserIDs")
+	}
+	if !containsUser(userIDs, userID) || containsUser(userIDs, bannedID) {
+		return errors.Errorf("got users %v, want %d without %d", userIDs, userID, bannedID)
+	}
+	for i := 1; i < len(userIDs); i++ {
+		if userIDs[i-1] >= userIDs[i] {
+			return errors.Errorf("users %v are not in order", userIDs)
+		}
+	}
+
+	if err := s.Users.SetBanned(ctx, bannedID, false); err != nil {
+		return errors.Wrap(err, "cannot SetBanned")
+	}
+	if banned, err = s.Users.TouchUser(ctx, bannedID, "", seen); err != nil {
+		return errors.Wrap(err, "cannot TouchUser")
+	}
+	if banned {
+		return errors.New("unbanned user is banned")
+	}
+	return nil
+}
+
+func testAccess(ctx context.Context, s *database.Storage, userID int64) error {
+	now := time.Now().UTC().Truncate(time.Second)
+
+	// The mode is shared by all the users, the one there was is put back.
+	mode, err := s.Access.GetAccessMode(ctx)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetAccessMode")
+	}
+	defer s.Access.SetAccessMode(ctx, mode)
+
+	for _, want := range []types.AccessMode{types.AccessInvite, types.AccessAllowlist, ""} {
+		if err := s.Access.SetAccessMode(ctx, want); err != nil {
+			return errors.Wrap(err, "cannot SetAccessMode")
+		}
+		got, err := s.Access.GetAccessMode(ctx)
+		if err != nil {
+			return errors.Wrap(err, "cannot GetAccessMode")
+		}
+		if got != want {
+			return errors.Errorf("got mode %q, want %q", got, want)
+		}
+	}
+
+	byID := types.AllowlistEntry{UserID: userID}
+	byName := types.AllowlistEntry{Username: fmt.Sprintf("storagetest%d", userID)}
+	if allowed, err := s.Access.IsAllowed(ctx, userID, ""); err != nil || allowed {
+		return errors.Errorf("got allowed %v (%v) before allowing, want false", allowed, err)
+	}
+
+	// Allowing twice is the same as once.
+	for _, entry := range []types.AllowlistEntry{byID, byName, byID} {
+		if err := s.Access.Allow(ctx, entry, now); err != nil {
+			return errors.Wrap(err, "cannot Allow")
+		}
+	}
+	allowlist, err := s.Access.GetAllowlist(ctx)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetAllowlist")
+	}
+	found := 0
+	for _, entry := range allowlist {
+		if entry == byID || entry == byName {
+			found++
+		}
+	}
+	if found != 2 {
+		return errors.Errorf("got %d of the entries in the allowlist %v, want 2", found, allowlist)
+	}
+
+	for _, c := range []struct {
+		userID   int64
+		username string
+		want     bool
+	}{
+		{userID: userID, want: true},
+		{userID: userID + 500, username: fmt.Sprintf("@Storagetest%d", userID), want: true},
+		{userID: userID + 500, username: "someone_else", want: false},
+	} {
+		allowed, err := s.Access.IsAllowed(ctx, c.userID, c.username)
+		if err != nil {
+			return errors.Wrap(err, "cannot IsAllowed")
+		}
+		if allowed != c.want {
+			return errors.Errorf("got allowed %v for %d %q, want %v", allowed, c.userID, c.username, c.want)
+		}
+	}
+
+	for _, entry := range []types.AllowlistEntry{byID, byName} {
+		for _, want := range []bool{true, false} {
+			removed, err := s.Access.Disallow(ctx, entry)
+			if err != nil {
+				return errors.Wrap(err, "cannot Disallow")
+			}
+			if removed != want {
+				return errors.Errorf("got removed %v for %v, want %v", removed, entry, want)
+			}
+		}
+	}
+	if allowed, err := s.Access.IsAllowed(ctx, userID, byName.Username); err != nil || allowed {
+		return errors.Errorf("got allowed %v (%v) after disallowing, want false", allowed, err)
+	}
+
+	invite, err := types.NewInvite(userID, now)
+	if err != nil {
+		return errors.Wrap(err, "cannot NewInvite")
+	}
+	expired, err := types.NewInvite(userID, now.Add(-types.InviteTTL-time.Minute))
+	if err != nil {
+		return errors.Wrap(err, "cannot NewInvite")
+	}
+	for _, i := range []types.Invite{invite, expired} {
+		if err := s.Access.AddInvite(ctx, i); err != nil {
+			return errors.Wrap(err, "cannot AddInvite")
+		}
+	}
+
+	for _, c := range []struct {
+		code   string
+		userID int64
+		want   bool
+	}{
+		{code: "unknown" + invite.Code, userID: userID, want: false},
+		{code: expired.Code, userID: userID, want: false},
+		{code: invite.Code, userID: userID, want: true},
+		// An invite works once.
+		{code: invite.Code, userID: userID + 500, want: false},
+	} {
+		used, err := s.Access.UseInvite(ctx, c.code, c.userID, now.Add(time.Minute))
+		if err != nil {
+			return errors.Wrap(err, "cannot UseInvite")
+		}
+		if used != c.want {
+			return errors.Errorf("got used %v for %q by %d, want %v", used, c.code, c.userID, c.want)
+		}
+	}
+	return nil
+}
+
+func testUsernames(ctx context.Context, s *database.Storage, userID int64) error {
+	username, err := s.Users.GetUsername(ctx, userID)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetUsername")
+	}
+	if username != "" {
+		return errors.Errorf("got username %q of an unknown user", username)
+	}
+
+	// The latest username is kept, and none when the user has removed it.
+	now := time.Now()
+	for _, want := range []string{"first", "second", ""} {
+		if _, err := s.Users.TouchUser(ctx, userID, want, now); err != nil {
+			return errors.Wrap(err, "cannot TouchUser")
+		}
+		if username, err = s.Users.GetUsername(ctx, userID); err != nil {
+			return errors.Wrap(err, "cannot GetUsername")
+		}
+		if username != want {
+			return errors.Errorf("got username %q, want %q", username, want)
+		}
+	}
+	return nil
+}
+
+func testDeleteUser(ctx context.Context, s *database.Storage, userID int64) error {
+	otherID := userID + 500
+	now := time.Now().UTC().Truncate(time.Second)
+	secret := fmt.Sprintf("delete-%d-%d", userID, now.UnixNano())
+
+	alice := newContact(1, "Alice")
+	alice.CustomFields = []types.CustomField{{Name: "Company", Type: types.CustomText, Value: "Gopher Inc"}}
+	alice.Events = []types.Event{{Name: "Wedding", Date: types.Birthday{Day: 12, Month: time.June}, Recurrence: types.Yearly}}
+	if err := addContacts(ctx, s, userID, alice); err != nil {
+		return err
+	}
+	if err := addContacts(ctx, s, otherID, newContact(1, "Bob")); err != nil {
+		return err
+	}
+	if _, err := s.Users.TouchUser(ctx, userID, "", now); err != nil {
+		return errors.Wrap(err, "cannot TouchUser")
+	}
+	if _, err := s.Webhooks.AddWebhook(ctx, types.Webhook{UserID: userID, URL: "https://example.com/hook", Secret: secret, CreatedAt: now}); err != nil {
+		return errors.Wrap(err, "cannot AddWebhook")
+	}
+	// The change is queued for the webhook.
+	if err := s.Contacts.WriteName(ctx, "Alicia", userID, 1); err != nil {
+		return errors.Wrap(err, "cannot WriteName")
+	}
+	if err := s.Contacts.AddInteraction(ctx, userID, 1, types.Interaction{Kind: types.InteractionMet, Date: types.Day(now)}); err != nil {
+		return errors.Wrap(err, "cannot AddInteraction")
+	}
+	if err := s.Contacts.AddReminder(ctx, userID, 1, types.Reminder{ContactID: 1, Text: "Call", DueAt: now.Add(time.Hour)}); err != nil {
+		return errors.Wrap(err, "cannot AddReminder")
+	}
+	if err := s.Contacts.WriteCardResource(ctx, userID, types.CardResource{ContactID: 1, Name: "alice.vcf", UID: secret}); err != nil {
+		return errors.Wrap(err, "cannot WriteCardResource")
+	}
+	settings := types.DefaultSettings()
+	settings.Timezone = "Europe/Moscow"
+	if err := s.Settings.SaveSettings(ctx, userID, settings); err != nil {
+		return errors.Wrap(err, "cannot SaveSettings")
+	}
+	if err := s.Users.SetCalendarToken(ctx, userID, secret); err != nil {
+		return errors.Wrap(err, "cannot SetCalendarToken")
+	}
+	if err := s.Users.SetCardDAVPassword(ctx, userID, secret); err != nil {
+		return errors.Wrap(err, "cannot SetCardDAVPassword")
+	}
+	if err := s.Users.SetAPIToken(ctx, userID, secret); err != nil {
+		return errors.Wrap(err, "cannot SetAPIToken")
+	}
+	if err := s.Access.Allow(ctx, types.AllowlistEntry{UserID: userID}, now); err != nil {
+		return errors.Wrap(err, "cannot Allow")
+	}
+	invite, err := types.NewInvite(userID, now)
+	if err != nil {
+		return errors.Wrap(err, "cannot NewInvite")
+	}
+	if err := s.Access.AddInvite(ctx, invite); err != nil {
+		return errors.Wrap(err, "cannot AddInvite")
+	}
+
+	err = s.Tx.InTx(ctx, func(ctx context.Context) error {
+		if err := s.Users.DeleteUser(ctx, userID); err != nil {
+			return errors.Wrap(err, "cannot DeleteUser")
+		}
+		return errors.Wrap(s.Access.ForgetInvites(ctx, userID), "cannot ForgetInvites")
+	})
+	if err != nil {
+		return err
+	}
+
+	if info, err := s.Users.GetUserInfo(ctx, userID); err != nil || info != nil {
+		return errors.Errorf("got user %+v (%v) after deleting, want none", info, err)
+	}
+	if contacts, err := s.Contacts.GetAllContacts(ctx, userID); err != nil || len(contacts) != 0 {
+		return errors.Errorf("got contacts %v (%v) after deleting, want none", contacts, err)
+	}
+	if log, err := s.Contacts.GetInteractions(ctx, userID, 1); err != nil || len(log) != 0 {
+		return errors.Errorf("got interactions %v (%v) after deleting, want none", log, err)
+	}
+	if reminders, err := s.Contacts.GetReminders(ctx, userID); err != nil || len(reminders) != 0 {
+		return errors.Errorf("got reminders %v (%v) after deleting, want none", reminders, err)
+	}
+	if resources, err := s.Contacts.GetCardResources(ctx, userID); err != nil || len(resources) != 0 {
+		return errors.Errorf("got card resources %v (%v) after deleting, want none", resources, err)
+	}
+	if webhooks, err := s.Webhooks.GetWebhooks(ctx, userID); err != nil || len(webhooks) != 0 {
+		return errors.Errorf("got webhooks %v (%v) after deleting, want none", webhooks, err)
+	}
+	if got, err := s.Settings.GetSettings(ctx, userID); err != nil || got.Timezone != types.DefaultSettings().Timezone {
+		return errors.Errorf("got settings %+v (%v) after deleting, want the default ones", got, err)
+	}
+	if _, ok, err := s.Users.UserByCalendarToken(ctx, secret); err != nil || ok {
+		return errors.Errorf("got user by the calendar token %v (%v) after deleting, want none", ok, err)
+	}
+	if _, ok, err := s.Users.UserByAPIToken(ctx, secret); err != nil || ok {
+		return errors.Errorf("got user by the API token %v (%v) after deleting, want none", ok, err)
+	}
+	// The admins have let the user in, the user is let in again after coming back.
+	if allowed, err := s.Access.IsAllowed(ctx, userID, ""); err != nil || !allowed {
+		return errors.Errorf("got allowed %v (%v) after deleting, want true", allowed, err)
+	}
+	if used, err := s.Access.UseInvite(ctx, invite.Code, otherID, now); err != nil || used {
+		return errors.Errorf("got invite of the deleted user used %v (%v), want false", used, err)
+	}
+
+	// The other users keep everything.
+	bob, err := s.Contacts.GetContact(ctx, otherID, 1)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetContact")
+	}
+	if bob == nil {
+		return errors.New("contact of another user is deleted")
+	}
+	return nil
+}
+
+func containsUser(userIDs []int64, userID int64) bool {
+	for _, id := range userIDs {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
+
+func testInteractions(ctx context.Context, s *database.Storage, userID int64) error {
+	if err := addContacts(ctx, s, userID, newContact(1, "Alice"), newContact(2, "Bob")); err != nil {
+		return err
+	}
+
+	day := func(d int) time.Time {
+		return time.Date(2023, time.July, d, 0, 0, 0, 0, time.UTC)
+	}
+	log := []types.Interaction{
+		{Kind: types.InteractionMet, Note: "GopherCon", Date: day(20)},
+		{Kind: types.InteractionCalled, Date: day(25)},
+		// Logged later about an earlier day.
+		{Kind: types.InteractionEmailed, Note: "Sent the slides", Date: day(21)},
+		// On the same day the one logged later is the latest.
+		{Kind: types.InteractionEmailed, Note: "Thanks", Date: day(25)},
+	}
+	for _, interaction := range log {
+		if err := s.Contacts.AddInteraction(ctx, userID, 1, interaction); err != nil {
+			return errors.Wrap(err, "cannot AddInteraction")
+		}
+	}
+	// A missing contact gets no log.
+	if err := s.Contacts.AddInteraction(ctx, userID, 3, log[0]); err != nil {
+		return errors.Wrap(err, "cannot AddInteraction to missing contact")
+	}
+
+	got, err := s.Contacts.GetInteractions(ctx, userID, 1)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetInteractions")
+	}
+	if err := compareInteractions(got, []types.Interaction{log[3], log[1], log[2], log[0]}); err != nil {
+		return err
+	}
+	missing, err := s.Contacts.GetInteractions(ctx, userID, 3)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetInteractions of missing contact")
+	}
+	if len(missing) != 0 {
+		return errors.Errorf("got %d interactions of missing contact", len(missing))
+	}
+
+	contacts, err := s.Contacts.GetAllContacts(ctx, userID)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetAllContacts")
+	}
+	if len(contacts) != 2 || contacts[1].LastInteraction != nil {
+		return errors.Errorf("got contacts %+v, want Bob without interactions", contacts)
+	}
+	if last := contacts[0].LastInteraction; last == nil || compareInteractions([]types.Interaction{*last}, log[3:4]) != nil {
+		return errors.Errorf("got last interaction %+v, want %+v", last, log[3])
+	}
+
+	// Merging moves the log of the other contact to the kept one.
+	bob := types.Interaction{Kind: types.InteractionMet, Date: day(28)}
+	if err := s.Contacts.AddInteraction(ctx, userID, 2, bob); err != nil {
+		return errors.Wrap(err, "cannot AddInteraction")
+	}
+	merged, err := s.Contacts.MergeContacts(ctx, userID, 1, 2)
+	if err != nil {
+		return errors.Wrap(err, "cannot MergeContacts")
+	}
+	if merged == nil || merged.LastInteraction == nil || !merged.LastInteraction.Date.Equal(bob.Date) {
+		return errors.Errorf("got merged contact %+v, want the last interaction of Bob", merged)
+	}
+	got, err = s.Contacts.GetInteractions(ctx, userID, 1)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetInteractions")
+	}
+	if err := compareInteractions(got, []types.Interaction{bob, log[3], log[1], log[2], log[0]}); err != nil {
+		return errors.Wrap(err, "merged log")
+	}
+
+	// The log goes away with the contact.
+	if err := s.Contacts.DeleteContact(ctx, userID, 1); err != nil {
+		return errors.Wrap(err, "cannot DeleteContact")
+	}
+	if err := addContacts(ctx, s, userID, newContact(1, "Carol")); err != nil {
+		return err
+	}
+	carol, err := s.Contacts.GetContact(ctx, userID, 1)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetContact")
+	}
+	if carol == nil || carol.LastInteraction != nil {
+		return errors.Errorf("got contact %+v, want no interactions", carol)
+	}
+	return nil
+}
+
+// compareInteractions compares the logs leaving out the IDs given by the storage.
+func compareInteractions(got, want []types.Interaction) error {
+	if len(got) != len(want) {
+		return errors.Errorf("got %d interactions %+v, want %d", len(got), got, len(want))
+	}
+	for i := range got {
+		if got[i].Kind != want[i].Kind || got[i].Note != want[i].Note || !got[i].Date.Equal(want[i].Date) {
+			return errors.Errorf("got interaction %d %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	return nil
+}
+
+func testReminders(ctx context.Context, s *database.Storage, userID int64) error {
+	if err := addContacts(ctx, s, userID, newContact(1, "Alice"), newContact(2, "Bob")); err != nil {
+		return err
+	}
+
+	moscow := time.FixedZone("MSK", 3*60*60)
+	reminders := []types.Reminder{
+		{ContactID: 1, Text: "Call about the offer", DueAt: time.Date(2023, time.July, 20, 10, 0, 0, 0, time.UTC)},
+		// The moment is kept whatever the time zone it is given in.
+		{ContactID: 2, Text: "Send the slides", DueAt: time.Date(2023, time.July, 18, 12, 30, 0, 0, moscow)},
+		{ContactID: 1, Text: "Congratulate", DueAt: time.Date(2100, time.January, 1, 9, 0, 0, 0, time.UTC)},
+	}
+	for _, reminder := range reminders {
+		if err := s.Contacts.AddReminder(ctx, userID, reminder.ContactID, reminder); err != nil {
+			return errors.Wrap(err, "cannot AddReminder")
+		}
+	}
+	// A missing contact gets no reminders.
+	if err := s.Contacts.AddReminder(ctx, userID, 3, reminders[0]); err != nil {
+		return errors.Wrap(err, "cannot AddReminder to missing contact")
+	}
+
+	got, err := s.Contacts.GetReminders(ctx, userID)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetReminders")
+	}
+	if err := compareReminders(got, []types.Reminder{reminders[1], reminders[0], reminders[2]}, []string{"Bob", "Alice", "Alice"}); err != nil {
+		return err
+	}
+	slides, call, congratulate := got[0], got[1], got[2]
+
+	// Due reminders are claimed once, the storage is shared with other users.
+	now := reminders[0].DueAt
+	due, err := s.Contacts.ClaimReminders(ctx, now, now.Add(time.Minute))
+	if err != nil {
+		return errors.Wrap(err, "cannot ClaimReminders")
+	}
+	due = remindersOf(due, userID)
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].DueAt.Before(due[j].DueAt)
+	})
+	if err := compareReminders(due, []types.Reminder{reminders[1], reminders[0]}, []string{"Bob", "Alice"}); err != nil {
+		return errors.Wrap(err, "due reminders")
+	}
+	claimed, err := s.Contacts.ClaimReminders(ctx, now, now.Add(time.Minute))
+	if err != nil {
+		return errors.Wrap(err, "cannot ClaimReminders")
+	}
+	if claimed = remindersOf(claimed, userID); len(claimed) != 0 {
+		return errors.Errorf("got reminders %+v claimed twice", claimed)
+	}
+
+	// The claimed reminders are pending until they are delivered.
+	got, err = s.Contacts.GetReminders(ctx, userID)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetReminders")
+	}
+	if len(got) != 3 {
+		return errors.Errorf("got %d pending reminders after claiming, want 3", len(got))
+	}
+
+	// A failed one is claimed again at the time of the retry with the attempts counted,
+	// a delivered one never again.
+	if err := s.Contacts.CompleteReminder(ctx, due[0], now); err != nil {
+		return errors.Wrap(err, "cannot CompleteReminder")
+	}
+	retryAt := now.Add(10 * time.Minute)
+	if err := s.Contacts.RetryReminder(ctx, due[1].ID, 1, retryAt); err != nil {
+		return errors.Wrap(err, "cannot RetryReminder")
+	}
+	claimed, err = s.Contacts.ClaimReminders(ctx, retryAt.Add(-time.Second), retryAt)
+	if err != nil {
+		return errors.Wrap(err, "cannot ClaimReminders")
+	}
+	if claimed = remindersOf(claimed, userID); len(claimed) != 0 {
+		return errors.Errorf("got reminders %+v claimed before the retry", claimed)
+	}
+	claimed, err = s.Contacts.ClaimReminders(ctx, retryAt, retryAt.Add(time.Minute))
+	if err != nil {
+		return errors.Wrap(err, "cannot ClaimReminders")
+	}
+	claimed = remindersOf(claimed, userID)
+	if len(claimed) != 1 || claimed[0].ID != due[1].ID || claimed[0].Attempts != 1 {
+		return errors.Errorf("got reminders %+v claimed for the retry, want %+v after 1 attempt", claimed, due[1])
+	}
+	if err := s.Contacts.CompleteReminder(ctx, claimed[0], retryAt); err != nil {
+		return errors.Wrap(err, "cannot CompleteReminder")
+	}
+	got, err = s.Contacts.GetReminders(ctx, userID)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetReminders")
+	}
+	if err := compareReminders(got, reminders[2:], []string{"Alice"}); err != nil {
+		return errors.Wrap(err, "after delivery")
+	}
+
+	// A snoozed reminder is pending again.
+	snoozed := time.Date(2023, time.July, 21, 10, 0, 0, 0, time.UTC)
+	if err := s.Contacts.SnoozeReminder(ctx, userID, call.ID, snoozed); err != nil {
+		return errors.Wrap(err, "cannot SnoozeReminder")
+	}
+	got, err = s.Contacts.GetReminders(ctx, userID)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetReminders")
+	}
+	want := []types.Reminder{{ContactID: 1, Text: call.Text, DueAt: snoozed}, reminders[2]}
+	if err := compareReminders(got, want, []string{"Alice", "Alice"}); err != nil {
+		return errors.Wrap(err, "after snoozing")
+	}
+	// The delivery of the reminder claimed before it was snoozed does not complete it.
+	if err := s.Contacts.CompleteReminder(ctx, call, snoozed); err != nil {
+		return errors.Wrap(err, "cannot CompleteReminder")
+	}
+	got, err = s.Contacts.GetReminders(ctx, userID)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetReminders")
+	}
+	if err := compareReminders(got, want, []string{"Alice", "Alice"}); err != nil {
+		return errors.Wrap(err, "after completing the snoozed one")
+	}
+
+	// Merging moves the reminders of the other contact, delivered ones too.
+	if _, err := s.Contacts.MergeContacts(ctx, userID, 1, 2); err != nil {
+		return errors.Wrap(err, "cannot MergeContacts")
+	}
+	moved, err := s.Contacts.GetReminder(ctx, userID, slides.ID)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetReminder")
+	}
+	if moved == nil || moved.ContactID != 1 || moved.ContactName != "Alice" {
+		return errors.Errorf("got merged reminder %+v, want the one about Alice", moved)
+	}
+
+	if err := s.Contacts.DeleteReminder(ctx, userID, congratulate.ID); err != nil {
+		return errors.Wrap(err, "cannot DeleteReminder")
+	}
+	deleted, err := s.Contacts.GetReminder(ctx, userID, congratulate.ID)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetReminder")
+	}
+	if deleted != nil {
+		return errors.Errorf("got deleted reminder %+v", deleted)
+	}
+
+	// The reminders go away with the contact.
+	if err := s.Contacts.DeleteContact(ctx, userID, 1); err != nil {
+		return errors.Wrap(err, "cannot DeleteContact")
+	}
+	got, err = s.Contacts.GetReminders(ctx, userID)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetReminders")
+	}
+	if len(got) != 0 {
+		return errors.Errorf("got reminders %+v of deleted contact", got)
+	}
+	return nil
+}
+
+// compareReminders compares the reminders leaving out the IDs given by the storage.
+func compareReminders(got, want []types.Reminder, names []string) error {
+	if len(got) != len(want) {
+		return errors.Errorf("got %d reminders %+v, want %d", len(got), got, len(want))
+	}
+	for i := range got {
+		if got[i].ContactID != want[i].ContactID || got[i].ContactName != names[i] ||
+			got[i].Text != want[i].Text || !got[i].DueAt.Equal(want[i].DueAt) {
+			return errors.Errorf("got reminder %d %+v, want %+v of %s", i, got[i], want[i], names[i])
+		}
+	}
+	return nil
+}
+
+func remindersOf(reminders []types.Reminder, userID int64) []types.Reminder {
+	var own []types.Reminder
+	for _, reminder := range reminders {
+		if reminder.UserID == userID {
+			own = append(own, reminder)
+		}
+	}
+	return own
+}
+
+func testLockCreatesUser(ctx context.Context, s *database.Storage, userID int64) error {
+	err := s.Tx.InTx(ctx, func(ctx context.Context) error {
+		return s.Users.LockUser(ctx, userID)
+	})
+	if err != nil {
+		return errors.Wrap(err, "cannot LockUser")
+	}
+
+	got, ok := s.Users.GetCurrentState(ctx, userID)
+	if !ok {
+		return errors.New("no state after LockUser")
+	}
+	if !got.CurrentState.Waiting() {
+		return errors.Errorf("got state %+v, want waiting", got.CurrentState)
+	}
+	return nil
+}
+
+func testDefaultSettings(ctx context.Context, s *database.Storage, userID int64) error {
+	settings, err := s.Settings.GetSettings(ctx, userID)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetSettings of unknown user")
+	}
+	if !reflect.DeepEqual(settings, types.DefaultSettings()) {
+		return errors.Errorf("got settings %+v for unknown user, want defaults", settings)
+	}
+	return nil
+}
+
+func testSaveSettings(ctx context.Context, s *database.Storage, userID int64) error {
+	want := types.Settings{
+		Language:     "ru",
+		Timezone:     "Europe/Moscow",
+		PhoneRegion:  "RU",
+		ReminderTime: 8*60 + 30,
+		SortOrder:    types.SortByBirthday,
+		HiddenFields: []types.CardField{types.FieldEmail, types.FieldDescription},
+		StaleDays:    90,
+	}
+	if err := s.Settings.SaveSettings(ctx, userID, want); err != nil {
+		return errors.Wrap(err, "cannot SaveSettings")
+	}
+	// The state does not touch the settings.
+	if err := s.Users.SetCurrentState(ctx, userID, types.CurrentState{Flow: "contact.name", Step: "value"}); err != nil {
+		return errors.Wrap(err, "cannot SetCurrentState")
+	}
+
+	got, err := s.Settings.GetSettings(ctx, userID)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetSettings")
+	}
+	if !reflect.DeepEqual(got, want) {
+		return errors.Errorf("got settings %+v, want %+v", got, want)
+	}
+
+	// Saving again overwrites every setting, including the hidden fields.
+	want.HiddenFields = nil
+	want.Language = ""
+	if err := s.Settings.SaveSettings(ctx, userID, want); err != nil {
+		return errors.Wrap(err, "cannot SaveSettings again")
+	}
+	got, err = s.Settings.GetSettings(ctx, userID)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetSettings after saving again")
+	}
+	if !reflect.DeepEqual(got, want) {
+		return errors.Errorf("got settings %+v after saving again, want %+v", got, want)
+	}
+	return nil
+}
+
+func testTxCommit(ctx context.Context, s *database.Storage, userID int64) error {
+	err := s.Tx.InTx(ctx, func(ctx context.Context) error {
+		if err := s.Users.LockUser(ctx, userID); err != nil {
+			return err
+		}
+		return s.Contacts.WriteContact(ctx, userID, newContact(1, "Alice"))
+	})
+	if err != nil {
+		return errors.Wrap(err, "cannot InTx")
+	}
+
+	contact, err := s.Contacts.GetContact(ctx, userID, 1)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetContact")
+	}
+	if contact == nil {
+		return errors.New("committed contact is missing")
+	}
+	return nil
+}
+
+func testTxRollback(ctx context.Context, s *database.Storage, userID int64) error {
+	if err := addUser(ctx, s, userID); err != nil {
+		return err
+	}
+
+	failure := errors.New("failure")
+	err := s.Tx.InTx(ctx, func(ctx context.Context) error {
+		if err := s.Contacts.WriteContact(ctx, userID, newContact(1, "Alice")); err != nil {
+			return err
+		}
+		if err := s.Users.SetCurrentState(ctx, userID, types.CurrentState{Flow: "contact.name", Step: "value"}); err != nil {
+			return err
+		}
+		return failure
+	})
+	if err != failure {
+		return errors.Errorf("got error %v, want the one returned from the transaction", err)
+	}
+
+	contact, err := s.Contacts.GetContact(ctx, userID, 1)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetContact")
+	}
+	if contact != nil {
+		return errors.New("contact written in a rolled back transaction is there")
+	}
+	if got, _ := s.Users.GetCurrentState(ctx, userID); got == nil || !got.CurrentState.Waiting() {
+		return errors.New("state written in a rolled back transaction is there")
+	}
+	return nil
+}
+
+func testTxRollbackKeepsOthers(ctx context.Context, s *database.Storage, userID int64) error {
+	if err := addUser(ctx, s, userID); err != nil {
+		return err
+	}
+
+	// Bob is written outside of the transaction while it runs, and stays after its rollback.
+	written := make(chan error, 1)
+	failure := errors.New("failure")
+	err := s.Tx.InTx(ctx, func(txCtx context.Context) error {
+		if err := s.Contacts.WriteContact(txCtx, userID, newContact(1, "Alice")); err != nil {
+			return err
+		}
+		go func() {
+			written <- s.Contacts.WriteContact(ctx, userID, newContact(2, "Bob"))
+		}()
+		time.Sleep(50 * time.Millisecond)
+		return failure
+	})
+	if err != failure {
+		return errors.Errorf("got error %v, want the one returned from the transaction", err)
+	}
+	if err := <-written; err != nil {
+		return errors.Wrap(err, "cannot WriteContact outside of transaction")
+	}
+
+	contacts, err := s.Contacts.GetAllContacts(ctx, userID)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetAllContacts")
+	}
+	if len(contacts) != 1 || contacts[0].Name != "Bob" {
+		return errors.Errorf("got contacts %+v, want only Bob", contacts)
+	}
+	return nil
+}
+
+func testTxNested(ctx context.Context, s *database.Storage, userID int64) error {
+	if err := addUser(ctx, s, userID); err != nil {
+		return err
+	}
+
+	failure := errors.New("failure")
+	err := s.Tx.InTx(ctx, func(ctx context.Context) error {
+		err := s.Tx.InTx(ctx, func(ctx context.Context) error {
+			return s.Contacts.WriteContact(ctx, userID, newContact(1, "Alice"))
+		})
+		if err != nil {
+			return err
+		}
+		return failure
+	})
+	if err != failure {
+		return errors.Errorf("got error %v, want the one returned from the transaction", err)
+	}
+
+	contact, err := s.Contacts.GetContact(ctx, userID, 1)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetContact")
+	}
+	if contact != nil {
+		return errors.New("inner transaction was committed separately from the outer one")
+	}
+	return nil
+}
+
+func compareContacts(got, want *types.Contact) error {
+	if got == nil {
+		return errors.Errorf("got no contact, want %+v", want)
+	}
+	if got.ContactID != want.ContactID ||
+		got.Name != want.Name ||
+		got.Email != want.Email ||
+		got.Phone != want.Phone ||
+		got.Description != want.Description ||
+		got.PhotoID != want.PhotoID ||
+		!sameBirthday(got.Birthday, want.Birthday) ||
+		!sameCustomFields(got.CustomFields, want.CustomFields) ||
+		!sameEvents(got.Events, want.Events) {
+		return errors.Errorf("got contact %+v, want %+v", got, want)
+	}
+	return nil
+}
+
+func sameCustomFields(a, b []types.CustomField) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func sameEvents(a, b []types.Event) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func sameBirthday(a, b *types.Birthday) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
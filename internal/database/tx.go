@@ -0,0 +1,67 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/pkg/errors"
+)
+
+// TxManager runs units of work: everything the function does with the storages through
+// the given context is committed together or not at all. Nested calls join the outer
+// transaction.
+type TxManager interface {
+	InTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// querier is what both *sql.DB and *sql.Tx can do.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+type txKey struct{}
+
+// conn returns the transaction running in the context, or the database outside of one.
+func conn(ctx context.Context, db *sql.DB) querier {
+	if tx, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return tx
+	}
+	return db
+}
+
+type txManager struct {
+	db *sql.DB
+}
+
+func NewTxManager(db *sql.DB) *txManager {
+	return &txManager{
+		db: db,
+	}
+}
+
+func (m *txManager) InTx(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	if _, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return fn(ctx)
+	}
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "cannot BeginTx")
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err := fn(context.WithValue(ctx, txKey{}, tx)); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return errors.Wrap(tx.Commit(), "cannot Commit")
+}
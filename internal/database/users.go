@@ -3,6 +3,7 @@ package database
 import (
 	"context"
 	"database/sql"
+	"time"
 
 	"github.com/opentracing/opentracing-go"
 	"github.com/pkg/errors"
@@ -10,12 +11,14 @@ import (
 )
 
 type usersDB struct {
-	db *sql.DB
+	db      *sql.DB
+	dialect dialect
 }
 
 func NewUsersDB(db *sql.DB) *usersDB {
 	return &usersDB{
-		db: db,
+		db:      db,
+		dialect: dialectPostgres,
 	}
 }
 
@@ -31,24 +34,27 @@ func (db *usersDB) SetCurrentState(ctx context.Context, userID int64, state type
 	const query = `
 		INSERT INTO users(
 			tg_user_id,
-			contact_id,
-		    message_id,
-			current_state
+			flow,
+			step,
+			payload,
+			expires_at
 		) VALUES (
-			$1, $2, $3, $4
+			$1, $2, $3, $4, $5
 		)
 		ON CONFLICT (tg_user_id) DO UPDATE
-		SET 
-			contact_id = $2,
-			message_id = $3,
-			current_state = $4
+		SET
+			flow = $2,
+			step = $3,
+			payload = $4,
+			expires_at = $5
 	`
 
-	_, err := db.db.ExecContext(ctx, query,
+	_, err := conn(ctx, db.db).ExecContext(ctx, query,
 		userID,
-		state.ContactID,
-		state.MessageID,
-		state.State,
+		state.Flow,
+		state.Step,
+		state.Payload,
+		nullTime(state.ExpiresAt),
 	)
 
 	if err != nil {
@@ -67,53 +73,723 @@ func (db *usersDB) GetCurrentState(ctx context.Context, userID int64) (*types.Us
 
 	const query = `
 		SELECT
-			contact_id,
-			message_id,
-			current_state
+			flow,
+			step,
+			payload,
+			expires_at
 		FROM
 			users
 		WHERE
 			tg_user_id = $1
 	`
 
-	var userState types.UserStateType
+	var (
+		userState types.UserStateType
+		expiresAt sql.NullTime
+	)
 
-	err := db.db.QueryRowContext(ctx, query,
+	err := conn(ctx, db.db).QueryRowContext(ctx, query,
 		userID,
-	).Scan(&userState.CurrentState.ContactID, &userState.CurrentState.MessageID, &userState.CurrentState.State)
+	).Scan(
+		&userState.CurrentState.Flow,
+		&userState.CurrentState.Step,
+		&userState.CurrentState.Payload,
+		&expiresAt,
+	)
 
 	if err != nil {
 		return nil, false
 	}
 
+	if expiresAt.Valid {
+		userState.CurrentState.ExpiresAt = expiresAt.Time
+	}
+
 	return &userState, true
 }
 
+// ToWaitState ends the conversation of the user.
 func (db *usersDB) ToWaitState(ctx context.Context, userID int64) error {
+	return db.SetCurrentState(ctx, userID, types.CurrentState{})
+}
+
+// ExpireStates ends the conversations which have expired by now and returns their users.
+func (db *usersDB) ExpireStates(ctx context.Context, now time.Time) ([]int64, error) {
 	span, ctx := opentracing.StartSpanFromContext(
 		ctx,
-		"ToWaitState",
+		"ExpireStates",
+	)
+	defer span.Finish()
+
+	const query = `
+		UPDATE users
+		SET
+			flow = '',
+			step = '',
+			payload = '',
+			expires_at = NULL
+		WHERE
+			flow <> '' AND expires_at <= $1
+		RETURNING
+			tg_user_id
+	`
+
+	rows, err := conn(ctx, db.db).QueryContext(ctx, query,
+		now,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot QueryContext")
+	}
+	defer rows.Close()
+
+	var userIDs []int64
+	for rows.Next() {
+		var userID int64
+		if err := rows.Scan(&userID); err != nil {
+			return nil, errors.Wrap(err, "cannot Scan")
+		}
+		userIDs = append(userIDs, userID)
+	}
+
+	return userIDs, errors.Wrap(rows.Err(), "cannot Next")
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+// LockUser creates the user if needed and locks its row until the end of the transaction,
+// so that concurrent updates of the same user are handled one after another.
+// It must be called in a transaction.
+func (db *usersDB) LockUser(ctx context.Context, userID int64) error {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"LockUser",
+	)
+	defer span.Finish()
+
+	const insertQuery = `
+		INSERT INTO users(
+			tg_user_id
+		) VALUES (
+			$1
+		)
+		ON CONFLICT(tg_user_id) DO NOTHING
+	`
+
+	_, err := conn(ctx, db.db).ExecContext(ctx, insertQuery,
+		userID,
+	)
+	if err != nil {
+		return errors.Wrap(err, "cannot ExecContent")
+	}
+
+	// SQLite has no row locks: a write transaction locks the whole database,
+	// and the insert above has already made this one a write transaction.
+	if db.dialect == dialectSQLite {
+		return nil
+	}
+
+	const lockQuery = `
+		SELECT
+			tg_user_id
+		FROM
+			users
+		WHERE
+			tg_user_id = $1
+		FOR UPDATE
+	`
+
+	var lockedID int64
+	err = conn(ctx, db.db).QueryRowContext(ctx, lockQuery,
+		userID,
+	).Scan(&lockedID)
+	if err != nil {
+		return errors.Wrap(err, "cannot Scan")
+	}
+
+	return nil
+}
+
+// DueDigests returns the users with a birthday or another date among the contacts whose
+// daily reminder about them is due by now, or has never been scheduled.
+func (db *usersDB) DueDigests(ctx context.Context, now time.Time) ([]int64, error) {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"DueDigests",
+	)
+	defer span.Finish()
+
+	const query = `
+		SELECT
+			tg_user_id
+		FROM
+			users u
+		WHERE
+			(next_digest_at IS NULL OR next_digest_at <= $1) AND (
+				EXISTS (
+					SELECT 1 FROM contacts c WHERE c.tg_user_id = u.tg_user_id AND c.birthday_day IS NOT NULL
+				) OR EXISTS (
+					SELECT 1 FROM contact_events e WHERE e.tg_user_id = u.tg_user_id
+				)
+			)
+	`
+
+	rows, err := conn(ctx, db.db).QueryContext(ctx, query,
+		now.UTC(),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot QueryContext")
+	}
+	defer rows.Close()
+
+	var userIDs []int64
+	for rows.Next() {
+		var userID int64
+		if err := rows.Scan(&userID); err != nil {
+			return nil, errors.Wrap(err, "cannot Scan")
+		}
+		userIDs = append(userIDs, userID)
+	}
+
+	return userIDs, errors.Wrap(rows.Err(), "cannot Next")
+}
+
+// ClaimDigest postpones the daily reminder of the user until leaseUntil if it is due by now,
+// so that every reminder is sent once even with several bots running.
+func (db *usersDB) ClaimDigest(ctx context.Context, userID int64, now, leaseUntil time.Time) (bool, error) {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"ClaimDigest",
+	)
+	defer span.Finish()
+
+	const query = `
+		UPDATE users
+		SET
+			next_digest_at = $1
+		WHERE
+			tg_user_id = $2 AND
+			(next_digest_at IS NULL OR next_digest_at <= $3)
+	`
+
+	result, err := conn(ctx, db.db).ExecContext(ctx, query,
+		leaseUntil.UTC(),
+		userID,
+		now.UTC(),
+	)
+	if err != nil {
+		return false, errors.Wrap(err, "cannot ExecContent")
+	}
+
+	claimed, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "cannot RowsAffected")
+	}
+	return claimed > 0, nil
+}
+
+// ScheduleDigest makes the daily reminder of the user due at the time.
+func (db *usersDB) ScheduleDigest(ctx context.Context, userID int64, at time.Time) error {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"ScheduleDigest",
+	)
+	defer span.Finish()
+
+	const query = `
+		UPDATE users
+		SET
+			next_digest_at = $1
+		WHERE
+			tg_user_id = $2
+	`
+
+	_, err := conn(ctx, db.db).ExecContext(ctx, query,
+		at.UTC(),
+		userID,
+	)
+	return errors.Wrap(err, "cannot ExecContent")
+}
+
+// NextExternalContactID returns the ID of a new contact of the user added outside of the
+// chat, e.g. over CardDAV. The IDs of the contacts added in the chat are the IDs of the
+// messages with their cards, which are positive, so the contacts added elsewhere go below
+// zero, one after another and never twice.
+func (db *usersDB) NextExternalContactID(ctx context.Context, userID int64) (int, error) {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"NextExternalContactID",
 	)
 	defer span.Finish()
 
 	const query = `
 		INSERT INTO users(
 			tg_user_id,
-			current_state
+			last_external_contact_id
+		) VALUES (
+			$1, -1
+		)
+		ON CONFLICT (tg_user_id) DO UPDATE
+		SET
+			last_external_contact_id = users.last_external_contact_id - 1
+		RETURNING
+			last_external_contact_id
+	`
+
+	var contactID int
+	err := conn(ctx, db.db).QueryRowContext(ctx, query,
+		userID,
+	).Scan(&contactID)
+	if err != nil {
+		return 0, errors.Wrap(err, "cannot Scan")
+	}
+
+	return contactID, nil
+}
+
+// SetCalendarToken replaces the hash of the secret in the link to the calendar feed of the
+// user, so that the old link stops working. An empty hash removes the link.
+func (db *usersDB) SetCalendarToken(ctx context.Context, userID int64, hash string) error {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"SetCalendarToken",
+	)
+	defer span.Finish()
+
+	const query = `
+		INSERT INTO users(
+			tg_user_id,
+			calendar_token
 		) VALUES (
 			$1, $2
 		)
-		ON CONFLICT(tg_user_id)
-		DO UPDATE 
-			SET
-			current_state = $2
+		ON CONFLICT(tg_user_id) DO UPDATE SET
+			calendar_token = excluded.calendar_token
+	`
+
+	_, err := conn(ctx, db.db).ExecContext(ctx, query,
+		userID,
+		sql.NullString{String: hash, Valid: hash != ""},
+	)
+	if err != nil {
+		return errors.Wrap(err, "cannot ExecContent")
+	}
+
+	return nil
+}
+
+// UserByCalendarToken finds the user with the hash of the secret in the link to the calendar
+// feed. It is false when no user has such a link.
+func (db *usersDB) UserByCalendarToken(ctx context.Context, hash string) (int64, bool, error) {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"UserByCalendarToken",
+	)
+	defer span.Finish()
+
+	if hash == "" {
+		return 0, false, nil
+	}
+
+	const query = `
+		SELECT
+			tg_user_id
+		FROM
+			users
+		WHERE
+			calendar_token = $1 AND
+			NOT banned
 	`
 
-	_, err := db.db.ExecContext(ctx, query,
+	var userID int64
+	err := conn(ctx, db.db).QueryRowContext(ctx, query,
+		hash,
+	).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, errors.Wrap(err, "cannot Scan")
+	}
+
+	return userID, true, nil
+}
+
+// GetCardDAVPassword returns the hash of the app password of the CardDAV server of the user,
+// empty when the user has no password.
+func (db *usersDB) GetCardDAVPassword(ctx context.Context, userID int64) (string, error) {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"GetCardDAVPassword",
+	)
+	defer span.Finish()
+
+	const query = `
+		SELECT
+			carddav_password
+		FROM
+			users
+		WHERE
+			tg_user_id = $1 AND
+			NOT banned
+	`
+
+	var hash sql.NullString
+	err := conn(ctx, db.db).QueryRowContext(ctx, query,
 		userID,
-		types.WaitState,
+	).Scan(&hash)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", errors.Wrap(err, "cannot Scan")
+	}
+
+	return hash.String, nil
+}
+
+// SetCardDAVPassword replaces the hash of the app password of the user, so that the old
+// password stops working. An empty hash removes the password.
+func (db *usersDB) SetCardDAVPassword(ctx context.Context, userID int64, hash string) error {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"SetCardDAVPassword",
 	)
+	defer span.Finish()
 
+	const query = `
+		INSERT INTO users(
+			tg_user_id,
+			carddav_password
+		) VALUES (
+			$1, $2
+		)
+		ON CONFLICT(tg_user_id) DO UPDATE SET
+			carddav_password = excluded.carddav_password
+	`
+
+	_, err := conn(ctx, db.db).ExecContext(ctx, query,
+		userID,
+		sql.NullString{String: hash, Valid: hash != ""},
+	)
+	if err != nil {
+		return errors.Wrap(err, "cannot ExecContent")
+	}
+
+	return nil
+}
+
+// SetAPIToken replaces the hash of the token of the REST API of the user, so that the old
+// token stops working. An empty hash removes the token.
+func (db *usersDB) SetAPIToken(ctx context.Context, userID int64, hash string) error {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"SetAPIToken",
+	)
+	defer span.Finish()
+
+	const query = `
+		INSERT INTO users(
+			tg_user_id,
+			api_token
+		) VALUES (
+			$1, $2
+		)
+		ON CONFLICT(tg_user_id) DO UPDATE SET
+			api_token = excluded.api_token
+	`
+
+	_, err := conn(ctx, db.db).ExecContext(ctx, query,
+		userID,
+		sql.NullString{String: hash, Valid: hash != ""},
+	)
+	if err != nil {
+		return errors.Wrap(err, "cannot ExecContent")
+	}
+
+	return nil
+}
+
+// UserByAPIToken finds the user with the hash of the token of the REST API.
+// It is false when no user has such a token.
+func (db *usersDB) UserByAPIToken(ctx context.Context, hash string) (int64, bool, error) {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"UserByAPIToken",
+	)
+	defer span.Finish()
+
+	if hash == "" {
+		return 0, false, nil
+	}
+
+	const query = `
+		SELECT
+			tg_user_id
+		FROM
+			users
+		WHERE
+			api_token = $1 AND
+			NOT banned
+	`
+
+	var userID int64
+	err := conn(ctx, db.db).QueryRowContext(ctx, query,
+		hash,
+	).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, errors.Wrap(err, "cannot Scan")
+	}
+
+	return userID, true, nil
+}
+
+// TouchUser records that the user has sent the bot something now with the username,
+// creating the user if needed, and tells whether the user is banned.
+func (db *usersDB) TouchUser(ctx context.Context, userID int64, username string, now time.Time) (bool, error) {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"TouchUser",
+	)
+	defer span.Finish()
+
+	const query = `
+		INSERT INTO users(
+			tg_user_id,
+			username,
+			last_seen_at
+		) VALUES (
+			$1, $2, $3
+		)
+		ON CONFLICT(tg_user_id) DO UPDATE SET
+			username = excluded.username,
+			last_seen_at = excluded.last_seen_at
+		RETURNING
+			banned
+	`
+
+	var banned bool
+	err := conn(ctx, db.db).QueryRowContext(ctx, query,
+		userID,
+		sql.NullString{String: username, Valid: username != ""},
+		now.UTC(),
+	).Scan(&banned)
+	if err != nil {
+		return false, errors.Wrap(err, "cannot Scan")
+	}
+
+	return banned, nil
+}
+
+// GetUsername returns the username the user has last written to the bot with, empty when
+// the user has none or is unknown.
+func (db *usersDB) GetUsername(ctx context.Context, userID int64) (string, error) {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"GetUsername",
+	)
+	defer span.Finish()
+
+	const query = `
+		SELECT
+			username
+		FROM
+			users
+		WHERE
+			tg_user_id = $1
+	`
+
+	var username sql.NullString
+	err := conn(ctx, db.db).QueryRowContext(ctx, query,
+		userID,
+	).Scan(&username)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", errors.Wrap(err, "cannot Scan")
+	}
+
+	return username.String, nil
+}
+
+// SetBanned bans or unbans the user, creating the user if needed.
+func (db *usersDB) SetBanned(ctx context.Context, userID int64, banned bool) error {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"SetBanned",
+	)
+	defer span.Finish()
+
+	const query = `
+		INSERT INTO users(
+			tg_user_id,
+			banned
+		) VALUES (
+			$1, $2
+		)
+		ON CONFLICT(tg_user_id) DO UPDATE SET
+			banned = excluded.banned
+	`
+
+	_, err := conn(ctx, db.db).ExecContext(ctx, query,
+		userID,
+		banned,
+	)
+	if err != nil {
+		return errors.Wrap(err, "cannot ExecContent")
+	}
+
+	return nil
+}
+
+// GetUserIDs returns the users who are not banned, in the order of their IDs.
+func (db *usersDB) GetUserIDs(ctx context.Context) ([]int64, error) {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"GetUserIDs",
+	)
+	defer span.Finish()
+
+	const query = `
+		SELECT
+			tg_user_id
+		FROM
+			users
+		WHERE
+			NOT banned
+		ORDER BY
+			tg_user_id
+	`
+
+	rows, err := conn(ctx, db.db).QueryContext(ctx, query)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot QueryContext")
+	}
+	defer rows.Close()
+
+	var userIDs []int64
+	for rows.Next() {
+		var userID int64
+		if err := rows.Scan(&userID); err != nil {
+			return nil, errors.Wrap(err, "cannot Scan")
+		}
+		userIDs = append(userIDs, userID)
+	}
+
+	return userIDs, errors.Wrap(rows.Err(), "cannot Next")
+}
+
+// GetStats counts the users, the ones seen since the moment, the banned ones and the contacts.
+func (db *usersDB) GetStats(ctx context.Context, activeSince time.Time) (types.Stats, error) {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"GetStats",
+	)
+	defer span.Finish()
+
+	const query = `
+		SELECT
+			(SELECT COUNT(*) FROM users),
+			(SELECT COUNT(*) FROM users WHERE last_seen_at >= $1),
+			(SELECT COUNT(*) FROM users WHERE banned),
+			(SELECT COUNT(*) FROM contacts)
+	`
+
+	var stats types.Stats
+	err := conn(ctx, db.db).QueryRowContext(ctx, query,
+		activeSince.UTC(),
+	).Scan(
+		&stats.Users,
+		&stats.Active,
+		&stats.Banned,
+		&stats.Contacts,
+	)
+	if err != nil {
+		return types.Stats{}, errors.Wrap(err, "cannot Scan")
+	}
+
+	return stats, nil
+}
+
+// GetUserInfo returns what the admins see of the user, nil without an error when there
+// is no such user.
+func (db *usersDB) GetUserInfo(ctx context.Context, userID int64) (*types.UserInfo, error) {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"GetUserInfo",
+	)
+	defer span.Finish()
+
+	const query = `
+		SELECT
+			u.banned,
+			COALESCE(u.username, ''),
+			u.last_seen_at,
+			COALESCE((SELECT s.language FROM user_settings s WHERE s.tg_user_id = u.tg_user_id), ''),
+			(SELECT COUNT(*) FROM contacts c WHERE c.tg_user_id = u.tg_user_id),
+			(SELECT COUNT(*) FROM reminders r WHERE r.tg_user_id = u.tg_user_id AND r.sent_at IS NULL),
+			(SELECT COUNT(*) FROM webhooks w WHERE w.tg_user_id = u.tg_user_id),
+			u.calendar_token IS NOT NULL,
+			u.carddav_password IS NOT NULL,
+			u.api_token IS NOT NULL
+		FROM
+			users u
+		WHERE
+			u.tg_user_id = $1
+	`
+
+	info := types.UserInfo{UserID: userID}
+	var lastSeen sql.NullTime
+	err := conn(ctx, db.db).QueryRowContext(ctx, query,
+		userID,
+	).Scan(
+		&info.Banned,
+		&info.Username,
+		&lastSeen,
+		&info.Language,
+		&info.Contacts,
+		&info.Reminders,
+		&info.Webhooks,
+		&info.HasCalendar,
+		&info.HasCardDAV,
+		&info.HasAPIToken,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot Scan")
+	}
+
+	if lastSeen.Valid {
+		info.LastSeen = lastSeen.Time
+	}
+	return &info, nil
+}
+
+// DeleteUser deletes the user with the contacts, the settings and everything else of the
+// user, which goes away with the row of the user.
+func (db *usersDB) DeleteUser(ctx context.Context, userID int64) error {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"DeleteUser",
+	)
+	defer span.Finish()
+
+	const query = `
+		DELETE FROM users
+		WHERE
+			tg_user_id = $1
+	`
+
+	_, err := conn(ctx, db.db).ExecContext(ctx, query,
+		userID,
+	)
 	if err != nil {
 		return errors.Wrap(err, "cannot ExecContent")
 	}
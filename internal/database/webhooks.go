@@ -0,0 +1,343 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+	"github.com/profectus200/contact-book-bot/internal/types"
+	"golang.org/x/net/context"
+)
+
+type webhooksDB struct {
+	db *sql.DB
+}
+
+func NewWebhooksDB(db *sql.DB) *webhooksDB {
+	return &webhooksDB{
+		db: db,
+	}
+}
+
+// AddWebhook adds the webhook and returns it with its ID.
+func (db *webhooksDB) AddWebhook(ctx context.Context, webhook types.Webhook) (types.Webhook, error) {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"AddWebhook",
+	)
+	defer span.Finish()
+
+	const query = `
+		INSERT INTO webhooks(
+			tg_user_id,
+			url,
+			secret,
+			created_at
+		) VALUES (
+			$1, $2, $3, $4
+		)
+		RETURNING webhook_id
+	`
+
+	err := conn(ctx, db.db).QueryRowContext(ctx, query,
+		webhook.UserID,
+		webhook.URL,
+		webhook.Secret,
+		webhook.CreatedAt.UTC(),
+	).Scan(&webhook.ID)
+	if err != nil {
+		return types.Webhook{}, errors.Wrap(err, "cannot Scan")
+	}
+
+	return webhook, nil
+}
+
+// GetWebhooks returns the webhooks of the user, the oldest first.
+func (db *webhooksDB) GetWebhooks(ctx context.Context, userID int64) ([]types.Webhook, error) {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"GetWebhooks",
+	)
+	defer span.Finish()
+
+	const query = `
+		SELECT
+			webhook_id,
+			tg_user_id,
+			url,
+			secret,
+			created_at
+		FROM
+			webhooks
+		WHERE
+			tg_user_id = $1
+		ORDER BY
+			webhook_id
+	`
+
+	rows, err := conn(ctx, db.db).QueryContext(ctx, query,
+		userID,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot QueryContext")
+	}
+	defer rows.Close()
+
+	webhooks := []types.Webhook{}
+	for rows.Next() {
+		var webhook types.Webhook
+		if err := rows.Scan(&webhook.ID, &webhook.UserID, &webhook.URL, &webhook.Secret, &webhook.CreatedAt); err != nil {
+			return nil, errors.Wrap(err, "cannot Scan")
+		}
+		webhooks = append(webhooks, webhook)
+	}
+
+	return webhooks, errors.Wrap(rows.Err(), "cannot Scan")
+}
+
+// DeleteWebhook deletes the webhook of the user, the events waiting for it go with it.
+func (db *webhooksDB) DeleteWebhook(ctx context.Context, userID int64, webhookID int) error {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"DeleteWebhook",
+	)
+	defer span.Finish()
+
+	const query = `
+		DELETE FROM
+			webhooks
+		WHERE
+			webhook_id = $1 AND
+			tg_user_id = $2
+	`
+
+	_, err := conn(ctx, db.db).ExecContext(ctx, query,
+		webhookID,
+		userID,
+	)
+	return errors.Wrap(err, "cannot ExecContent")
+}
+
+// ClaimDeliveries takes up to limit events due by now, the oldest first, and postpones them
+// until leaseUntil, so that the other bots do not deliver them meanwhile. An event whose
+// delivery is never completed nor retried, e.g. as the bot has stopped, is due again then.
+func (db *webhooksDB) ClaimDeliveries(ctx context.Context, now, leaseUntil time.Time, limit int) ([]types.WebhookDelivery, error) {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"ClaimDeliveries",
+	)
+	defer span.Finish()
+
+	// The condition is checked again outside of the subquery, as another bot may have
+	// claimed the rows between the two.
+	const query = `
+		UPDATE
+			webhook_outbox
+		SET
+			next_attempt_at = $1
+		WHERE
+			next_attempt_at <= $2 AND
+			delivery_id IN (
+				SELECT
+					delivery_id
+				FROM
+					webhook_outbox
+				WHERE
+					next_attempt_at <= $2
+				ORDER BY
+					delivery_id
+				LIMIT $3
+			)
+		RETURNING
+			delivery_id,
+			webhook_id,
+			event_type,
+			payload,
+			attempts
+	`
+
+	var deliveries []types.WebhookDelivery
+	err := func() error {
+		rows, err := conn(ctx, db.db).QueryContext(ctx, query,
+			leaseUntil.UTC(),
+			now.UTC(),
+			limit,
+		)
+		if err != nil {
+			return errors.Wrap(err, "cannot QueryContext")
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var delivery types.WebhookDelivery
+			var payload string
+			err := rows.Scan(&delivery.ID, &delivery.Webhook.ID, &delivery.EventType, &payload, &delivery.Attempts)
+			if err != nil {
+				return errors.Wrap(err, "cannot Scan")
+			}
+			delivery.Payload = []byte(payload)
+			deliveries = append(deliveries, delivery)
+		}
+		return errors.Wrap(rows.Err(), "cannot Scan")
+	}()
+	if err != nil {
+		return nil, err
+	}
+
+	webhooks := make(map[int]types.Webhook)
+	for i := range deliveries {
+		webhook, ok := webhooks[deliveries[i].Webhook.ID]
+		if !ok {
+			if webhook, err = db.getWebhook(ctx, deliveries[i].Webhook.ID); err != nil {
+				return nil, errors.Wrap(err, "cannot getWebhook")
+			}
+			webhooks[webhook.ID] = webhook
+		}
+		deliveries[i].Webhook = webhook
+	}
+
+	return deliveries, nil
+}
+
+func (db *webhooksDB) getWebhook(ctx context.Context, webhookID int) (types.Webhook, error) {
+	const query = `
+		SELECT
+			tg_user_id,
+			url,
+			secret,
+			created_at
+		FROM
+			webhooks
+		WHERE
+			webhook_id = $1
+	`
+
+	webhook := types.Webhook{ID: webhookID}
+	err := conn(ctx, db.db).QueryRowContext(ctx, query,
+		webhookID,
+	).Scan(&webhook.UserID, &webhook.URL, &webhook.Secret, &webhook.CreatedAt)
+	return webhook, errors.Wrap(err, "cannot Scan")
+}
+
+// CompleteDelivery removes the delivered event from the outbox.
+func (db *webhooksDB) CompleteDelivery(ctx context.Context, deliveryID int) error {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"CompleteDelivery",
+	)
+	defer span.Finish()
+
+	const query = `
+		DELETE FROM
+			webhook_outbox
+		WHERE
+			delivery_id = $1
+	`
+
+	_, err := conn(ctx, db.db).ExecContext(ctx, query,
+		deliveryID,
+	)
+	return errors.Wrap(err, "cannot ExecContent")
+}
+
+// RetryDelivery counts the failed attempts of the event and makes it due again at the time.
+func (db *webhooksDB) RetryDelivery(ctx context.Context, deliveryID, attempts int, at time.Time) error {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"RetryDelivery",
+	)
+	defer span.Finish()
+
+	const query = `
+		UPDATE
+			webhook_outbox
+		SET
+			attempts = $1,
+			next_attempt_at = $2
+		WHERE
+			delivery_id = $3
+	`
+
+	_, err := conn(ctx, db.db).ExecContext(ctx, query,
+		attempts,
+		at.UTC(),
+		deliveryID,
+	)
+	return errors.Wrap(err, "cannot ExecContent")
+}
+
+// changed makes the change of the contact and queues the event about it for the webhooks
+// of the user, both in one transaction.
+func (db *contactsDB) changed(ctx context.Context, userID int64, contactID int, eventType types.WebhookEventType,
+	change func(ctx context.Context) error) error {
+	return db.tx.InTx(ctx, func(ctx context.Context) error {
+		if err := change(ctx); err != nil {
+			return err
+		}
+		return errors.Wrap(db.enqueueEvent(ctx, userID, contactID, eventType), "cannot enqueueEvent")
+	})
+}
+
+// enqueueEvent queues the event about the contact for every webhook of the user, with the
+// contact as it is now. It does nothing when the user has no webhooks, or when there is no
+// such contact unless it has been deleted.
+func (db *contactsDB) enqueueEvent(ctx context.Context, userID int64, contactID int, eventType types.WebhookEventType) error {
+	const countQuery = `
+		SELECT
+			count(*)
+		FROM
+			webhooks
+		WHERE
+			tg_user_id = $1
+	`
+
+	var count int
+	if err := conn(ctx, db.db).QueryRowContext(ctx, countQuery, userID).Scan(&count); err != nil {
+		return errors.Wrap(err, "cannot Scan")
+	}
+	if count == 0 {
+		return nil
+	}
+
+	var contact *types.Contact
+	if eventType != types.ContactDeleted {
+		var err error
+		if contact, err = db.GetContact(ctx, userID, contactID); err != nil {
+			return errors.Wrap(err, "cannot GetContact")
+		}
+		if contact == nil {
+			return nil
+		}
+	}
+
+	now := time.Now()
+	payload, err := types.NewContactEvent(eventType, contactID, contact, now)
+	if err != nil {
+		return errors.Wrap(err, "cannot NewContactEvent")
+	}
+
+	const query = `
+		INSERT INTO webhook_outbox(
+			webhook_id,
+			event_type,
+			payload,
+			next_attempt_at,
+			created_at
+		)
+		SELECT
+			webhook_id, $1, $2, $3, $3
+		FROM
+			webhooks
+		WHERE
+			tg_user_id = $4
+	`
+
+	_, err = conn(ctx, db.db).ExecContext(ctx, query,
+		string(eventType),
+		string(payload),
+		now.UTC(),
+		userID,
+	)
+	return errors.Wrap(err, "cannot ExecContent")
+}
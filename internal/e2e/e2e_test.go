@@ -0,0 +1,2177 @@
+package e2e
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/profectus200/contact-book-bot/internal/clients/tg/tgfake"
+	"github.com/profectus200/contact-book-bot/internal/config"
+	"github.com/profectus200/contact-book-bot/internal/database"
+	"github.com/profectus200/contact-book-bot/internal/database/storagetest"
+	"github.com/profectus200/contact-book-bot/internal/i18n"
+	"github.com/profectus200/contact-book-bot/internal/model/account"
+	"github.com/profectus200/contact-book-bot/internal/model/callbacks"
+	"github.com/profectus200/contact-book-bot/internal/model/webhooks"
+	"github.com/profectus200/contact-book-bot/internal/types"
+	"go.uber.org/zap"
+)
+
+// scenarios cover the whole life of a contact, each is a conversation of a single user with the bot.
+var scenarios = []struct {
+	name string
+	run  func(ctx context.Context, h *Harness, userID int64) error
+}{
+	{name: "add contact", run: addContactScenario},
+	{name: "search contact", run: searchContactScenario},
+	{name: "list contacts", run: listContactsScenario},
+	{name: "full-text search", run: fullTextSearchScenario},
+	{name: "edit contact by ID", run: editContactScenario},
+	{name: "delete contact", run: deleteContactScenario},
+	{name: "change language", run: changeLanguageScenario},
+	{name: "settings", run: settingsScenario},
+	{name: "cancel conversation", run: cancelScenario},
+	{name: "add contact step by step", run: wizardScenario},
+	{name: "two open cards", run: twoCardsScenario},
+	{name: "merge duplicates", run: duplicatesScenario},
+	{name: "contact photo", run: photoScenario},
+	{name: "custom fields", run: customFieldsScenario},
+	{name: "interactions and stale contacts", run: interactionsScenario},
+	{name: "reminders", run: remindersScenario},
+	{name: "dates and upcoming", run: datesScenario},
+	{name: "calendar", run: calendarScenario},
+	{name: "carddav", run: carddavScenario},
+	{name: "webhooks", run: webhooksScenario},
+	{name: "admin", run: adminScenario},
+	{name: "access", run: accessScenario},
+	{name: "my data and account deletion", run: accountScenario},
+	// The requests over the limits of the API turn away the next ones for a while.
+	{name: "rest api", run: apiScenario},
+}
+
+func TestScenarios(t *testing.T) {
+	t.Run(database.DriverMemory, func(t *testing.T) {
+		runScenarios(t, database.NewMemoryStorage())
+	})
+
+	t.Run(database.DriverSQLite, func(t *testing.T) {
+		storage, err := database.Open(&config.Service{Config: config.Config{
+			Storage:    database.DriverSQLite,
+			SQLitePath: filepath.Join(t.TempDir(), "contacts.db"),
+		}})
+		if err != nil {
+			t.Fatalf("cannot open storage: %v", err)
+		}
+		defer storage.Close()
+
+		runScenarios(t, storage)
+	})
+
+	t.Run(database.DriverPostgres, func(t *testing.T) {
+		runScenarios(t, storagetest.OpenPostgres(t))
+	})
+}
+
+// runScenarios runs every scenario as a different user.
+func runScenarios(t *testing.T, storage *database.Storage) {
+	h, err := New(storage, zap.NewNop())
+	if err != nil {
+		t.Fatalf("cannot create harness: %v", err)
+	}
+	defer h.Close()
+
+	// Fresh users on every run, so that the scenarios do not see the data of the previous ones
+	// in a database kept between the runs.
+	firstUserID := time.Now().UnixNano() / int64(time.Millisecond)
+
+	for i, scenario := range scenarios {
+		userID := firstUserID + int64(i)
+		t.Run(scenario.name, func(t *testing.T) {
+			if err := scenario.run(context.Background(), h, userID); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+type testContact struct {
+	name     string
+	phone    string
+	birthday string
+	// birthdayCard is how the card shows the birthday typed by the user.
+	birthdayCard string
+	description  string
+}
+
+var alice = testContact{
+	name:         "Alice",
+	phone:        "+7 900 123 45 67",
+	birthday:     "12.03",
+	birthdayCard: "12 March",
+	description:  "Met at GopherCon",
+}
+
+func addContactScenario(ctx context.Context, h *Harness, userID int64) error {
+	cardID, err := addContact(ctx, h, userID, alice)
+	if err != nil {
+		return err
+	}
+
+	card, err := h.botMessage(userID, cardID)
+	if err != nil {
+		return err
+	}
+	for _, line := range []string{
+		"Name: " + alice.name,
+		"Phone: " + alice.phone,
+		"Birthday: " + alice.birthdayCard,
+		"Description: " + alice.description,
+	} {
+		if !strings.Contains(card.Text, line) {
+			return errors.Errorf("card %q has no %q", card.Text, line)
+		}
+	}
+
+	// Values typed by the user are cleaned up from the chat.
+	for _, msg := range h.Server.Messages(userID) {
+		if !msg.FromBot && !strings.HasPrefix(msg.Text, "/") && !msg.Deleted {
+			return errors.Errorf("message %q of the user was not deleted", msg.Text)
+		}
+	}
+
+	return saveCard(ctx, h, userID, cardID)
+}
+
+func searchContactScenario(ctx context.Context, h *Harness, userID int64) error {
+	if err := addAndSave(ctx, h, userID, alice); err != nil {
+		return err
+	}
+
+	if err := h.SendText(ctx, userID, "/get_contact"); err != nil {
+		return errors.Wrap(err, "cannot send /get_contact")
+	}
+	if _, err := h.expectBotMessage(userID, "Write the name of your contact:"); err != nil {
+		return err
+	}
+
+	if err := h.SendText(ctx, userID, alice.name); err != nil {
+		return errors.Wrap(err, "cannot send search phrase")
+	}
+	_, err := h.expectBotMessage(userID, "Name: "+alice.name)
+	return err
+}
+
+func listContactsScenario(ctx context.Context, h *Harness, userID int64) error {
+	if err := h.SendText(ctx, userID, "/list_contacts"); err != nil {
+		return errors.Wrap(err, "cannot send /list_contacts")
+	}
+	if _, err := h.expectBotMessage(userID, "You don't have any contacts saved yet!"); err != nil {
+		return err
+	}
+
+	bob := testContact{name: "Bob"}
+	for _, contact := range []testContact{alice, bob} {
+		if err := addAndSave(ctx, h, userID, contact); err != nil {
+			return err
+		}
+	}
+
+	if err := h.SendText(ctx, userID, "/list_contacts"); err != nil {
+		return errors.Wrap(err, "cannot send /list_contacts")
+	}
+	list, err := h.expectBotMessage(userID, "Name: "+alice.name)
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(list.Text, "Name: "+bob.name) {
+		return errors.Errorf("list %q has no %s", list.Text, bob.name)
+	}
+	return nil
+}
+
+func fullTextSearchScenario(ctx context.Context, h *Harness, userID int64) error {
+	if err := addAndSave(ctx, h, userID, alice); err != nil {
+		return err
+	}
+	if err := addAndSave(ctx, h, userID, testContact{name: "Bob", description: "Works on payments, met at GopherCon too"}); err != nil {
+		return err
+	}
+
+	searches := []struct {
+		query string
+		want  []string
+		not   string
+	}{
+		{query: "/search gopher*", want: []string{"Name: Alice", "Name: Bob", "[GopherCon]"}},
+		{query: `/search "works on payments"`, want: []string{"Name: Bob", "Found: [Works] [on] [payments]"}, not: "Alice"},
+		{query: "/search alice", want: []string{"Name: Alice"}, not: "Found:"},
+		{query: "/search payroll", want: []string{"Nothing found"}},
+		{query: "/search", want: []string{"Write what to find after /search"}},
+	}
+	for _, search := range searches {
+		if err := h.SendText(ctx, userID, search.query); err != nil {
+			return errors.Wrapf(err, "cannot send %q", search.query)
+		}
+		msg, err := h.expectBotMessage(userID, search.want[0])
+		if err != nil {
+			return errors.Wrap(err, search.query)
+		}
+		for _, want := range search.want[1:] {
+			if !strings.Contains(msg.Text, want) {
+				return errors.Errorf("%s: results %q have no %q", search.query, msg.Text, want)
+			}
+		}
+		if search.not != "" && strings.Contains(msg.Text, search.not) {
+			return errors.Errorf("%s: results %q have %q", search.query, msg.Text, search.not)
+		}
+	}
+	return nil
+}
+
+func editContactScenario(ctx context.Context, h *Harness, userID int64) error {
+	cardID, err := addContact(ctx, h, userID, alice)
+	if err != nil {
+		return err
+	}
+	if err := saveCard(ctx, h, userID, cardID); err != nil {
+		return err
+	}
+
+	// Contacts are identified by the message of the card they were created in.
+	editCardID, err := openContact(ctx, h, userID, cardID)
+	if err != nil {
+		return err
+	}
+
+	if err := editField(ctx, h, userID, editCardID, callbacks.ChangeContactName, "Alicia", "Alicia"); err != nil {
+		return err
+	}
+	if _, err := h.botMessageContaining(userID, editCardID, "Name: Alicia"); err != nil {
+		return err
+	}
+	if err := saveCard(ctx, h, userID, editCardID); err != nil {
+		return err
+	}
+
+	if err := h.SendText(ctx, userID, "/list_contacts"); err != nil {
+		return errors.Wrap(err, "cannot send /list_contacts")
+	}
+	list, err := h.expectBotMessage(userID, "Name: Alicia")
+	if err != nil {
+		return err
+	}
+	if strings.Count(list.Text, "ID: ") != 1 {
+		return errors.Errorf("editing created another contact: %q", list.Text)
+	}
+	return nil
+}
+
+func deleteContactScenario(ctx context.Context, h *Harness, userID int64) error {
+	cardID, err := addContact(ctx, h, userID, alice)
+	if err != nil {
+		return err
+	}
+	if err := saveCard(ctx, h, userID, cardID); err != nil {
+		return err
+	}
+
+	editCardID, err := openContact(ctx, h, userID, cardID)
+	if err != nil {
+		return err
+	}
+	if err := h.pressButton(ctx, userID, editCardID, callbacks.DeleteContact); err != nil {
+		return errors.Wrap(err, "cannot press Delete")
+	}
+	if err := h.expectAlert("Deleted"); err != nil {
+		return err
+	}
+	if card, _ := h.botMessage(userID, editCardID); !card.Deleted {
+		return errors.New("card of the deleted contact is still in the chat")
+	}
+
+	if err := h.SendText(ctx, userID, "/list_contacts"); err != nil {
+		return errors.Wrap(err, "cannot send /list_contacts")
+	}
+	_, err = h.expectBotMessage(userID, "You don't have any contacts saved yet!")
+	return err
+}
+
+func changeLanguageScenario(ctx context.Context, h *Harness, userID int64) error {
+	if err := h.SendText(ctx, userID, "/language"); err != nil {
+		return errors.Wrap(err, "cannot send /language")
+	}
+	menu, err := h.expectBotMessage(userID, "Choose the language:")
+	if err != nil {
+		return err
+	}
+
+	if err := h.pressButtonWith(ctx, userID, menu.ID, callbacks.SetLanguagePayload(i18n.Russian)); err != nil {
+		return errors.Wrap(err, "cannot press Russian")
+	}
+	if err := h.expectAlert("русский"); err != nil {
+		return err
+	}
+
+	if err := h.SendText(ctx, userID, "/add_contact"); err != nil {
+		return errors.Wrap(err, "cannot send /add_contact")
+	}
+	card, err := h.expectBotMessage(userID, "Имя: Новый контакт")
+	if err != nil {
+		return err
+	}
+
+	if err := h.pressButton(ctx, userID, card.ID, callbacks.ChangeContactBirthday); err != nil {
+		return errors.Wrap(err, "cannot press Change birthday")
+	}
+	if err := h.expectAlert("Введите день рождения"); err != nil {
+		return err
+	}
+
+	if err := h.SendText(ctx, userID, "12 марта 1990"); err != nil {
+		return errors.Wrap(err, "cannot send birthday")
+	}
+	_, err = h.botMessageContaining(userID, card.ID, "День рождения: 12 марта 1990")
+	return err
+}
+
+func settingsScenario(ctx context.Context, h *Harness, userID int64) error {
+	if err := addAndSave(ctx, h, userID, alice); err != nil {
+		return err
+	}
+
+	if err := h.SendText(ctx, userID, "/settings"); err != nil {
+		return errors.Wrap(err, "cannot send /settings")
+	}
+	menu, err := h.expectBotMessage(userID, "Timezone: UTC")
+	if err != nil {
+		return err
+	}
+
+	if err := h.pressButton(ctx, userID, menu.ID, callbacks.SettingsTimezone); err != nil {
+		return errors.Wrap(err, "cannot press Timezone")
+	}
+	if err := h.expectAlert("Enter your timezone"); err != nil {
+		return err
+	}
+	if err := h.SendText(ctx, userID, "mars/olympus"); err != nil {
+		return errors.Wrap(err, "cannot send timezone")
+	}
+	if _, err := h.expectBotMessage(userID, "I do not know this timezone"); err != nil {
+		return err
+	}
+	if err := h.SendText(ctx, userID, "europe/moscow"); err != nil {
+		return errors.Wrap(err, "cannot send timezone")
+	}
+	if _, err := h.botMessageContaining(userID, menu.ID, "Timezone: Europe/Moscow"); err != nil {
+		return err
+	}
+
+	if err := h.pressButton(ctx, userID, menu.ID, callbacks.SettingsSortOrder); err != nil {
+		return errors.Wrap(err, "cannot press Sort")
+	}
+	if _, err := h.botMessageContaining(userID, menu.ID, "Sort contacts by upcoming birthday"); err != nil {
+		return err
+	}
+
+	if err := h.pressButtonWith(ctx, userID, menu.ID, callbacks.ToggleFieldPayload(types.FieldPhone)); err != nil {
+		return errors.Wrap(err, "cannot press Phone")
+	}
+	if _, err := h.botMessageContaining(userID, menu.ID, "Lists show: email, birthday, description"); err != nil {
+		return err
+	}
+
+	if err := h.pressButton(ctx, userID, menu.ID, callbacks.SettingsPhoneRegion); err != nil {
+		return errors.Wrap(err, "cannot press Phone region")
+	}
+	if err := h.expectAlert("Enter the two-letter code of your country"); err != nil {
+		return err
+	}
+	if err := h.SendText(ctx, userID, "ru"); err != nil {
+		return errors.Wrap(err, "cannot send phone region")
+	}
+	if _, err := h.botMessageContaining(userID, menu.ID, "Default phone region: RU"); err != nil {
+		return err
+	}
+	if err := h.pressButton(ctx, userID, menu.ID, callbacks.SettingsClose); err != nil {
+		return errors.Wrap(err, "cannot press Close")
+	}
+
+	if err := h.SendText(ctx, userID, "/list_contacts"); err != nil {
+		return errors.Wrap(err, "cannot send /list_contacts")
+	}
+	list, err := h.expectBotMessage(userID, "Name: "+alice.name)
+	if err != nil {
+		return err
+	}
+	if strings.Contains(list.Text, alice.phone) {
+		return errors.Errorf("list %q shows the hidden phone", list.Text)
+	}
+
+	// A phone without a country code is a phone of the region.
+	cardID, err := addContact(ctx, h, userID, testContact{name: "Bob"})
+	if err != nil {
+		return err
+	}
+	if err := editField(ctx, h, userID, cardID, callbacks.ChangeContactPhone, "8 (900) 765-43-21", "Phone: +7 (900) 765-43-21"); err != nil {
+		return err
+	}
+	return saveCard(ctx, h, userID, cardID)
+}
+
+func cancelScenario(ctx context.Context, h *Harness, userID int64) error {
+	if err := h.SendText(ctx, userID, "/cancel"); err != nil {
+		return errors.Wrap(err, "cannot send /cancel")
+	}
+	if _, err := h.expectBotMessage(userID, "There is nothing to cancel"); err != nil {
+		return err
+	}
+
+	if err := h.SendText(ctx, userID, "/get_contact"); err != nil {
+		return errors.Wrap(err, "cannot send /get_contact")
+	}
+	if err := h.SendText(ctx, userID, "/cancel"); err != nil {
+		return errors.Wrap(err, "cannot send /cancel")
+	}
+	if _, err := h.expectBotMessage(userID, "Cancelled"); err != nil {
+		return err
+	}
+
+	// The answer to the cancelled question is not taken anymore.
+	if err := h.SendText(ctx, userID, alice.name); err != nil {
+		return errors.Wrap(err, "cannot send search phrase")
+	}
+	_, err := h.expectBotMessage(userID, "I do not know such a command")
+	return err
+}
+
+func wizardScenario(ctx context.Context, h *Harness, userID int64) error {
+	summaryID, err := addWithWizard(ctx, h, userID, []string{"Carol", "-", "carol at example", "carol@example.com", "-", "Neighbour"})
+	if err != nil {
+		return err
+	}
+	summary, err := h.botMessage(userID, summaryID)
+	if err != nil {
+		return err
+	}
+	for _, line := range []string{"Name: Carol", "Email: carol@example.com", "Description: Neighbour"} {
+		if !strings.Contains(summary.Text, line) {
+			return errors.Errorf("summary %q has no %q", summary.Text, line)
+		}
+	}
+	if strings.Contains(summary.Text, "Phone:") {
+		return errors.Errorf("summary %q has the skipped phone", summary.Text)
+	}
+
+	if err := h.pressButton(ctx, userID, summaryID, callbacks.ConfirmContact); err != nil {
+		return errors.Wrap(err, "cannot press Confirm")
+	}
+	if err := h.expectAlert("Saved"); err != nil {
+		return err
+	}
+	if summary, _ := h.botMessage(userID, summaryID); len(summary.Keyboard) != 0 {
+		return errors.New("confirmed contact still has buttons")
+	}
+
+	// Everything skipped makes a contact with the default name, which is edited in its card.
+	summaryID, err = addWithWizard(ctx, h, userID, []string{"-", "-", "-", "-", "-"})
+	if err != nil {
+		return err
+	}
+	if _, err := h.botMessageContaining(userID, summaryID, "Name: New contact"); err != nil {
+		return err
+	}
+	if err := h.pressButton(ctx, userID, summaryID, callbacks.EditContactCard); err != nil {
+		return errors.Wrap(err, "cannot press Edit")
+	}
+	if err := editField(ctx, h, userID, summaryID, callbacks.ChangeContactName, "Dave", "Name: Dave"); err != nil {
+		return err
+	}
+	if err := saveCard(ctx, h, userID, summaryID); err != nil {
+		return err
+	}
+
+	if err := h.SendText(ctx, userID, "/list_contacts"); err != nil {
+		return errors.Wrap(err, "cannot send /list_contacts")
+	}
+	list, err := h.expectBotMessage(userID, "Name: Carol")
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(list.Text, "Name: Dave") {
+		return errors.Errorf("list %q has no Dave", list.Text)
+	}
+	return nil
+}
+
+func twoCardsScenario(ctx context.Context, h *Harness, userID int64) error {
+	aliceID, err := addContact(ctx, h, userID, alice)
+	if err != nil {
+		return err
+	}
+	bobID, err := addContact(ctx, h, userID, testContact{name: "Bob"})
+	if err != nil {
+		return err
+	}
+
+	// Both cards stay open: every button knows its contact.
+	if err := editField(ctx, h, userID, aliceID, callbacks.ChangeContactName, "Alicia", "Name: Alicia"); err != nil {
+		return err
+	}
+	if err := editField(ctx, h, userID, bobID, callbacks.ChangeContactName, "Robert", "Name: Robert"); err != nil {
+		return err
+	}
+	if _, err := h.botMessageContaining(userID, aliceID, "Name: Alicia"); err != nil {
+		return err
+	}
+
+	if err := h.SendText(ctx, userID, "/list_contacts"); err != nil {
+		return errors.Wrap(err, "cannot send /list_contacts")
+	}
+	list, err := h.expectBotMessage(userID, "Name: Alicia")
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(list.Text, "Name: Robert") || strings.Count(list.Text, "ID: ") != 2 {
+		return errors.Errorf("list %q is not Alicia and Robert", list.Text)
+	}
+	return nil
+}
+
+func duplicatesScenario(ctx context.Context, h *Harness, userID int64) error {
+	aliceID, err := addContact(ctx, h, userID, alice)
+	if err != nil {
+		return err
+	}
+	if err := saveCard(ctx, h, userID, aliceID); err != nil {
+		return err
+	}
+	// The same phone written another way.
+	smithID, err := addContact(ctx, h, userID, testContact{name: "Alice Smith", phone: "8 (900) 123-45-67", description: "Neighbour"})
+	if err != nil {
+		return err
+	}
+	if err := saveCard(ctx, h, userID, smithID); err != nil {
+		return err
+	}
+	if err := addAndSave(ctx, h, userID, testContact{name: "Bob"}); err != nil {
+		return err
+	}
+
+	if err := h.SendText(ctx, userID, "/duplicates"); err != nil {
+		return errors.Wrap(err, "cannot send /duplicates")
+	}
+	pair, err := h.expectBotMessage(userID, "Possible duplicates 1 of 1: the same phone")
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(pair.Text, "Name: Alice | Alice Smith") {
+		return errors.Errorf("pair %q does not show both names", pair.Text)
+	}
+
+	if err := h.pressButtonWith(ctx, userID, pair.ID, callbacks.MergePayload(aliceID, smithID, 0)); err != nil {
+		return errors.Wrap(err, "cannot press Merge")
+	}
+	if err := h.expectAlert("Merged"); err != nil {
+		return err
+	}
+	merged, err := h.botMessageContaining(userID, pair.ID, "Merged into the contact with ID "+strconv.Itoa(aliceID))
+	if err != nil {
+		return err
+	}
+	for _, want := range []string{"Name: Alice Smith", alice.phone, "Met at GopherCon\nNeighbour"} {
+		if !strings.Contains(merged.Text, want) {
+			return errors.Errorf("merged contact %q has no %q", merged.Text, want)
+		}
+	}
+
+	if err := h.SendText(ctx, userID, "/list_contacts"); err != nil {
+		return errors.Wrap(err, "cannot send /list_contacts")
+	}
+	list, err := h.expectBotMessage(userID, "Name: Alice Smith")
+	if err != nil {
+		return err
+	}
+	if strings.Count(list.Text, "ID: ") != 2 {
+		return errors.Errorf("list %q is not Alice Smith and Bob", list.Text)
+	}
+
+	if err := h.SendText(ctx, userID, "/duplicates"); err != nil {
+		return errors.Wrap(err, "cannot send /duplicates")
+	}
+	_, err = h.expectBotMessage(userID, "No possible duplicates found")
+	return err
+}
+
+func photoScenario(ctx context.Context, h *Harness, userID int64) error {
+	cardID, err := addContact(ctx, h, userID, alice)
+	if err != nil {
+		return err
+	}
+
+	if err := h.pressButton(ctx, userID, cardID, callbacks.ChangeContactPhoto); err != nil {
+		return errors.Wrap(err, "cannot press Change photo")
+	}
+	if err := h.expectAlert("Send a photo"); err != nil {
+		return err
+	}
+	if err := h.SendText(ctx, userID, "a nice photo"); err != nil {
+		return errors.Wrap(err, "cannot send text instead of photo")
+	}
+	if _, err := h.expectBotMessage(userID, "It is not a photo"); err != nil {
+		return err
+	}
+
+	// The text card cannot become a photo, so it is sent again.
+	if err := h.SendPhoto(ctx, userID, "photo-1"); err != nil {
+		return errors.Wrap(err, "cannot send photo")
+	}
+	photoCard, err := expectPhotoCard(h, userID, "photo-1", "Name: Alice")
+	if err != nil {
+		return err
+	}
+	if old, err := h.botMessage(userID, cardID); err != nil || !old.Deleted {
+		return errors.New("text card is still in the chat")
+	}
+
+	// The caption is edited together with the photo.
+	if err := editField(ctx, h, userID, photoCard.ID, callbacks.ChangeContactName, "Alicia", "Name: Alicia"); err != nil {
+		return err
+	}
+	if msg, err := h.botMessage(userID, photoCard.ID); err != nil || msg.Photo != "photo-1" {
+		return errors.New("edited card lost its photo")
+	}
+	if err := saveCard(ctx, h, userID, photoCard.ID); err != nil {
+		return err
+	}
+
+	openedID, err := openContact(ctx, h, userID, cardID)
+	if err != nil {
+		return err
+	}
+	if _, err := expectPhotoCard(h, userID, "photo-1", "Name: Alicia"); err != nil {
+		return err
+	}
+
+	if err := h.pressButton(ctx, userID, openedID, callbacks.ChangeContactPhoto); err != nil {
+		return errors.Wrap(err, "cannot press Change photo")
+	}
+	if err := h.SendText(ctx, userID, "-"); err != nil {
+		return errors.Wrap(err, "cannot remove photo")
+	}
+	card, err := h.expectBotMessage(userID, "Name: Alicia")
+	if err != nil {
+		return err
+	}
+	if card.Photo != "" || card.ID == openedID {
+		return errors.Errorf("card %d without photo is not sent again as a text", card.ID)
+	}
+	return nil
+}
+
+func customFieldsScenario(ctx context.Context, h *Harness, userID int64) error {
+	cardID, err := addContact(ctx, h, userID, alice)
+	if err != nil {
+		return err
+	}
+
+	answers := []flowAnswer{
+		{text: "Website", reply: "What is in the field Website? Write text, date, link, phone"},
+		{text: "color", reply: "I do not know such a type"},
+		{text: "link", reply: "Enter link"},
+		{text: "not a link", reply: "It does not look like a link"},
+	}
+	if err := h.runFlow(ctx, userID, cardID, callbacks.AddCustomField, "Enter the name of the field", answers); err != nil {
+		return err
+	}
+	if err := h.SendText(ctx, userID, "alice.example.com"); err != nil {
+		return errors.Wrap(err, "cannot send link")
+	}
+	if _, err := h.botMessageContaining(userID, cardID, "Website: https://alice.example.com"); err != nil {
+		return err
+	}
+	if err := saveCard(ctx, h, userID, cardID); err != nil {
+		return err
+	}
+
+	if err := h.SendText(ctx, userID, "/search alice.example.com"); err != nil {
+		return errors.Wrap(err, "cannot send /search")
+	}
+	if _, err := h.expectBotMessage(userID, "Website: https://alice.example.com"); err != nil {
+		return err
+	}
+
+	// The field is found by its name in any case and removed with "-".
+	openedID, err := openContact(ctx, h, userID, cardID)
+	if err != nil {
+		return err
+	}
+	if err := h.pressButton(ctx, userID, openedID, callbacks.AddCustomField); err != nil {
+		return errors.Wrap(err, "cannot press Add field")
+	}
+	for _, answer := range []string{"website", "link", "-"} {
+		if err := h.SendText(ctx, userID, answer); err != nil {
+			return errors.Wrapf(err, "cannot answer %q", answer)
+		}
+	}
+	card, err := h.botMessageContaining(userID, openedID, "Name: Alice")
+	if err != nil {
+		return err
+	}
+	if strings.Contains(card.Text, "Website") {
+		return errors.Errorf("card %q still has the removed field", card.Text)
+	}
+	return nil
+}
+
+func interactionsScenario(ctx context.Context, h *Harness, userID int64) error {
+	aliceID, err := addContact(ctx, h, userID, alice)
+	if err != nil {
+		return err
+	}
+	answers := []flowAnswer{
+		{text: "phoned", reply: "I do not know such an interaction. Write called, met, emailed"},
+		{text: "called", reply: "When was it?"},
+		{text: "31.02", reply: "I cannot recognize the date"},
+		{text: "-", reply: "Add a note"},
+	}
+	if err := h.runFlow(ctx, userID, aliceID, callbacks.LogInteraction, "What did you do? Write called, met, emailed", answers); err != nil {
+		return err
+	}
+	if err := h.SendText(ctx, userID, "Discussed the offer"); err != nil {
+		return errors.Wrap(err, "cannot send note")
+	}
+	if _, err := h.botMessageContaining(userID, aliceID, "Last contacted today: called, Discussed the offer"); err != nil {
+		return err
+	}
+	if err := saveCard(ctx, h, userID, aliceID); err != nil {
+		return err
+	}
+
+	bobID, err := addContact(ctx, h, userID, testContact{name: "Bob"})
+	if err != nil {
+		return err
+	}
+	if err := saveCard(ctx, h, userID, bobID); err != nil {
+		return err
+	}
+	if err := h.SendText(ctx, userID, "/stale"); err != nil {
+		return errors.Wrap(err, "cannot send /stale")
+	}
+	stale, err := h.expectBotMessage(userID, "Not contacted for over 30 days:")
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(stale.Text, "Name: Bob") || strings.Contains(stale.Text, "Alice") {
+		return errors.Errorf("stale contacts %q are not only Bob", stale.Text)
+	}
+
+	// Bob was met two months ago, which is still too long ago.
+	openedID, err := openContact(ctx, h, userID, bobID)
+	if err != nil {
+		return err
+	}
+	met := time.Now().UTC().AddDate(0, 0, -60).Format("02.01.2006")
+	answers = []flowAnswer{
+		{text: "met", reply: "When was it?"},
+		{text: met, reply: "Add a note"},
+	}
+	if err := h.runFlow(ctx, userID, openedID, callbacks.LogInteraction, "What did you do? Write called, met, emailed", answers); err != nil {
+		return err
+	}
+	if err := h.SendText(ctx, userID, "-"); err != nil {
+		return errors.Wrap(err, "cannot send note")
+	}
+	if _, err := h.botMessageContaining(userID, openedID, "Last contacted 60 days ago: met"); err != nil {
+		return err
+	}
+	if err := saveCard(ctx, h, userID, openedID); err != nil {
+		return err
+	}
+	if err := h.SendText(ctx, userID, "/stale"); err != nil {
+		return errors.Wrap(err, "cannot send /stale")
+	}
+	if _, err := h.expectBotMessage(userID, "Last contacted 60 days ago: met"); err != nil {
+		return err
+	}
+
+	// The threshold is given with the command or in the settings.
+	if err := h.SendText(ctx, userID, "/stale soon"); err != nil {
+		return errors.Wrap(err, "cannot send /stale soon")
+	}
+	if _, err := h.expectBotMessage(userID, "Write the number of days after /stale"); err != nil {
+		return err
+	}
+	if err := h.SendText(ctx, userID, "/stale 90"); err != nil {
+		return errors.Wrap(err, "cannot send /stale 90")
+	}
+	if _, err := h.expectBotMessage(userID, "Everyone was contacted within 90 days"); err != nil {
+		return err
+	}
+
+	if err := h.SendText(ctx, userID, "/settings"); err != nil {
+		return errors.Wrap(err, "cannot send /settings")
+	}
+	menu, err := h.expectBotMessage(userID, "Stale after 30 days without contact")
+	if err != nil {
+		return err
+	}
+	if err := h.pressButton(ctx, userID, menu.ID, callbacks.SettingsStaleDays); err != nil {
+		return errors.Wrap(err, "cannot press Stale after")
+	}
+	if err := h.SendText(ctx, userID, "0"); err != nil {
+		return errors.Wrap(err, "cannot send 0 days")
+	}
+	if _, err := h.expectBotMessage(userID, "Write a number of days from 1 to 3650"); err != nil {
+		return err
+	}
+	if err := h.SendText(ctx, userID, "61"); err != nil {
+		return errors.Wrap(err, "cannot send 61 days")
+	}
+	if _, err := h.botMessageContaining(userID, menu.ID, "Stale after 61 days without contact"); err != nil {
+		return err
+	}
+	if err := h.SendText(ctx, userID, "/stale"); err != nil {
+		return errors.Wrap(err, "cannot send /stale")
+	}
+	_, err = h.expectBotMessage(userID, "Everyone was contacted within 61 days")
+	return err
+}
+
+func remindersScenario(ctx context.Context, h *Harness, userID int64) error {
+	// Without a birthday the daily reminder about the dates does not come in between.
+	cardID, err := addContact(ctx, h, userID, testContact{name: "Alice"})
+	if err != nil {
+		return err
+	}
+	answers := []flowAnswer{
+		{text: "Call about the offer", reply: "When?"},
+		{text: "31.02 10:00", reply: "I cannot recognize the time"},
+		{text: "in 2 hours", reply: "I will remind you on"},
+	}
+	if err := h.runFlow(ctx, userID, cardID, callbacks.AddReminder, "What should I remind you about?", answers); err != nil {
+		return err
+	}
+	answers = []flowAnswer{
+		{text: "Congratulate", reply: "When?"},
+		{text: "in 3 days", reply: "I will remind you on"},
+	}
+	if err := h.runFlow(ctx, userID, cardID, callbacks.AddReminder, "What should I remind you about?", answers); err != nil {
+		return err
+	}
+	if err := saveCard(ctx, h, userID, cardID); err != nil {
+		return err
+	}
+
+	if err := h.SendText(ctx, userID, "/reminders"); err != nil {
+		return errors.Wrap(err, "cannot send /reminders")
+	}
+	list, err := h.expectBotMessage(userID, "Reminders:")
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(list.Text, "1. ") || !strings.Contains(list.Text, "Alice: Call about the offer") ||
+		!strings.Contains(list.Text, "2. ") || !strings.Contains(list.Text, "Alice: Congratulate") {
+		return errors.Errorf("reminders %q are not the call and the congratulation", list.Text)
+	}
+
+	// Cancelling leaves the rest in the list.
+	if err := h.pressLabeled(ctx, userID, list.ID, "Cancel 2"); err != nil {
+		return err
+	}
+	if err := h.expectAlert("The reminder is cancelled"); err != nil {
+		return err
+	}
+	list, err = h.botMessage(userID, list.ID)
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(list.Text, "Alice: Call about the offer") || strings.Contains(list.Text, "Congratulate") {
+		return errors.Errorf("reminders %q are not only the call", list.Text)
+	}
+
+	// The reminder which is not delivered is not lost, it comes with the next attempt.
+	later := time.Now().Add(3 * time.Hour)
+	before, _ := h.Server.LastBotMessage(userID)
+	h.Server.FailNext("sendMessage", http.StatusForbidden, 0)
+	if err := h.SendDueReminders(ctx, later); err != nil {
+		return errors.Wrap(err, "cannot SendDueReminders")
+	}
+	if last, _ := h.Server.LastBotMessage(userID); last.ID != before.ID {
+		return errors.Errorf("message %q was sent while Telegram failed", last.Text)
+	}
+
+	// The reminder comes when it is due, and once.
+	later = later.Add(time.Hour)
+	if err := h.SendDueReminders(ctx, later); err != nil {
+		return errors.Wrap(err, "cannot SendDueReminders")
+	}
+	reminder, err := h.expectBotMessage(userID, "Reminder about Alice: Call about the offer")
+	if err != nil {
+		return err
+	}
+	if err := h.SendDueReminders(ctx, later); err != nil {
+		return errors.Wrap(err, "cannot SendDueReminders")
+	}
+	if last, _ := h.Server.LastBotMessage(userID); last.ID != reminder.ID {
+		return errors.Errorf("reminder was sent again as %q", last.Text)
+	}
+
+	// A snoozed reminder comes again.
+	if err := h.pressButton(ctx, userID, reminder.ID, callbacks.SnoozeReminder); err != nil {
+		return errors.Wrap(err, "cannot press Snooze")
+	}
+	if _, err := h.botMessageContaining(userID, reminder.ID, "Snoozed until"); err != nil {
+		return err
+	}
+	if err := h.SendDueReminders(ctx, later); err != nil {
+		return errors.Wrap(err, "cannot SendDueReminders")
+	}
+	reminder, err = h.expectBotMessage(userID, "Reminder about Alice: Call about the offer")
+	if err != nil {
+		return err
+	}
+
+	if err := h.pressButton(ctx, userID, reminder.ID, callbacks.CompleteReminder); err != nil {
+		return errors.Wrap(err, "cannot press Done")
+	}
+	if _, err := h.botMessageContaining(userID, reminder.ID, "Done"); err != nil {
+		return err
+	}
+
+	if err := h.SendText(ctx, userID, "/reminders"); err != nil {
+		return errors.Wrap(err, "cannot send /reminders")
+	}
+	_, err = h.expectBotMessage(userID, "You have no reminders")
+	return err
+}
+
+func datesScenario(ctx context.Context, h *Harness, userID int64) error {
+	today := time.Now().UTC()
+	tomorrow := today.AddDate(0, 0, 1)
+	contact := testContact{
+		name:         "Alice",
+		birthday:     today.Format("02.01"),
+		birthdayCard: i18n.English.Date(today.Day(), int(today.Month()), 0),
+	}
+	cardID, err := addContact(ctx, h, userID, contact)
+	if err != nil {
+		return err
+	}
+
+	answers := []flowAnswer{
+		{text: "Wedding anniversary", reply: "How often does Wedding anniversary come?"},
+		{text: "now and then", reply: "I cannot recognize it"},
+		{text: "-", reply: "Enter the date"},
+		{text: "31.02.2016", reply: "I cannot recognize the date"},
+	}
+	if err := h.runFlow(ctx, userID, cardID, callbacks.AddEvent, "Enter the name of the date", answers); err != nil {
+		return err
+	}
+	// 2016 is a leap year, so that the test passes on the 28th of February too.
+	if err := h.SendText(ctx, userID, tomorrow.Format("02.01")+".2016"); err != nil {
+		return errors.Wrap(err, "cannot send wedding date")
+	}
+	wedding := "Wedding anniversary: " + i18n.English.Date(tomorrow.Day(), int(tomorrow.Month()), 2016) + " (every year), tomorrow"
+	if _, err := h.botMessageContaining(userID, cardID, wedding); err != nil {
+		return err
+	}
+
+	// Only the yearly dates may come without the year.
+	answers = []flowAnswer{
+		{text: "Contract renewal", reply: "How often does Contract renewal come?"},
+		{text: "every 6 months", reply: "Enter the date"},
+		{text: "15.01", reply: "I cannot recognize the date"},
+	}
+	if err := h.runFlow(ctx, userID, cardID, callbacks.AddEvent, "Enter the name of the date", answers); err != nil {
+		return err
+	}
+	if err := h.SendText(ctx, userID, "15.01.2020"); err != nil {
+		return errors.Wrap(err, "cannot send renewal date")
+	}
+	if _, err := h.botMessageContaining(userID, cardID, "Contract renewal: 15 January 2020 (every 6 months)"); err != nil {
+		return err
+	}
+	if err := saveCard(ctx, h, userID, cardID); err != nil {
+		return err
+	}
+
+	if err := h.SendText(ctx, userID, "/upcoming"); err != nil {
+		return errors.Wrap(err, "cannot send /upcoming")
+	}
+	upcoming, err := h.expectBotMessage(userID, "Coming in 30 days:")
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(upcoming.Text, "today: Alice, birthday") ||
+		!strings.Contains(upcoming.Text, "tomorrow: Alice, Wedding anniversary") {
+		return errors.Errorf("upcoming %q are not the birthday and the anniversary", upcoming.Text)
+	}
+
+	// The birthday comes in the daily reminder at the reminder time, and once a day.
+	tonight := time.Date(today.Year(), today.Month(), today.Day(), 23, 59, 0, 0, time.UTC)
+	if err := h.SendDueReminders(ctx, tonight); err != nil {
+		return errors.Wrap(err, "cannot SendDueReminders")
+	}
+	digest, err := h.expectBotMessage(userID, "Today:")
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(digest.Text, "today: Alice, birthday") || strings.Contains(digest.Text, "Wedding") {
+		return errors.Errorf("daily reminder %q is not only the birthday", digest.Text)
+	}
+	if err := h.SendDueReminders(ctx, tonight); err != nil {
+		return errors.Wrap(err, "cannot SendDueReminders")
+	}
+	if last, _ := h.Server.LastBotMessage(userID); last.ID != digest.ID {
+		return errors.Errorf("daily reminder was sent again as %q", last.Text)
+	}
+	return nil
+}
+
+func calendarScenario(ctx context.Context, h *Harness, userID int64) error {
+	if err := addAndSave(ctx, h, userID, alice); err != nil {
+		return err
+	}
+
+	if err := h.SendText(ctx, userID, "/calendar"); err != nil {
+		return errors.Wrap(err, "cannot send /calendar")
+	}
+	linkMsg, err := h.expectBotMessage(userID, "Subscribe to this link")
+	if err != nil {
+		return err
+	}
+	link := calendarLink(linkMsg.Text)
+
+	// The birthday without the year comes every year from a leap one.
+	feed, err := h.fetchCalendar(ctx, link)
+	if err != nil {
+		return err
+	}
+	for _, line := range []string{"BEGIN:VCALENDAR", "SUMMARY:Alice: birthday", "DTSTART;VALUE=DATE:20000312", "RRULE:FREQ=YEARLY"} {
+		if !strings.Contains(feed, line+"\r\n") {
+			return errors.Errorf("calendar %q has no line %q", feed, line)
+		}
+	}
+
+	// Only the hash of the link is kept, so /calendar gives a new one and the old one stops working.
+	if err := h.SendText(ctx, userID, "/calendar"); err != nil {
+		return errors.Wrap(err, "cannot send /calendar")
+	}
+	if linkMsg, err = h.expectBotMessage(userID, "Subscribe to this link"); err != nil {
+		return err
+	}
+	newLink := calendarLink(linkMsg.Text)
+	if newLink == link {
+		return errors.New("link is the same after sending /calendar again")
+	}
+	if _, err := h.fetchCalendar(ctx, link); err == nil {
+		return errors.New("link replaced by /calendar still works")
+	}
+	link = newLink
+
+	if err := h.pressButton(ctx, userID, linkMsg.ID, callbacks.CalendarFile); err != nil {
+		return errors.Wrap(err, "cannot press Send .ics file")
+	}
+	file, err := h.expectBotMessage(userID, "Open the file")
+	if err != nil {
+		return err
+	}
+	if file.Document == nil || file.Document.Name != "contacts.ics" || !strings.Contains(string(file.Document.Data), "SUMMARY:Alice: birthday") {
+		return errors.Errorf("bot sent %+v, want the calendar file", file.Document)
+	}
+
+	if err := h.pressButton(ctx, userID, linkMsg.ID, callbacks.CalendarReset); err != nil {
+		return errors.Wrap(err, "cannot press New link")
+	}
+	if err := h.expectAlert("The old link does not work anymore"); err != nil {
+		return err
+	}
+	linkMsg, err = h.botMessageContaining(userID, linkMsg.ID, "Subscribe to this link")
+	if err != nil {
+		return err
+	}
+	if newLink := calendarLink(linkMsg.Text); newLink == link {
+		return errors.New("link is the same after replacing it")
+	} else if _, err := h.fetchCalendar(ctx, newLink); err != nil {
+		return err
+	}
+	if _, err := h.fetchCalendar(ctx, link); err == nil {
+		return errors.New("replaced link still works")
+	}
+	return nil
+}
+
+// calendarLink finds the link to the calendar in the message.
+func calendarLink(text string) string {
+	for _, field := range strings.Fields(text) {
+		if strings.HasPrefix(field, "http") {
+			return field
+		}
+	}
+	return ""
+}
+
+// fetchCalendar gets the calendar at the link as a calendar app does.
+func (h *Harness) fetchCalendar(ctx context.Context, link string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return "", errors.Wrapf(err, "cannot make request to %q", link)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "cannot get calendar")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.Errorf("calendar link answered %s", resp.Status)
+	}
+	if contentType := resp.Header.Get("Content-Type"); !strings.HasPrefix(contentType, "text/calendar") {
+		return "", errors.Errorf("calendar has content type %q", contentType)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", errors.Wrap(err, "cannot read calendar")
+	}
+	return string(body), nil
+}
+
+func carddavScenario(ctx context.Context, h *Harness, userID int64) error {
+	if err := addAndSave(ctx, h, userID, alice); err != nil {
+		return err
+	}
+
+	if err := h.SendText(ctx, userID, "/carddav"); err != nil {
+		return errors.Wrap(err, "cannot send /carddav")
+	}
+	accountMsg, err := h.expectBotMessage(userID, "Add a CardDAV account")
+	if err != nil {
+		return err
+	}
+	account := carddavAccount{server: messageField(accountMsg.Text, "Server: ")}
+	account.user = messageField(accountMsg.Text, "User name: ")
+	account.password = messageField(accountMsg.Text, "Password: ")
+	if account.user != strconv.FormatInt(userID, 10) || account.password == "" {
+		return errors.Errorf("account message %q has no user name and password", accountMsg.Text)
+	}
+	book := account.server + account.user + "/contacts/"
+
+	wrong := account
+	wrong.password += "x"
+	if status, _, _, err := h.davRequest(ctx, wrong, "PROPFIND", book, "", nil); err != nil {
+		return err
+	} else if status != http.StatusUnauthorized {
+		return errors.Errorf("wrong password answered %d, want 401", status)
+	}
+
+	// The contact added in the bot is in the address book.
+	status, listing, _, err := h.davRequest(ctx, account, "PROPFIND", book, "", map[string]string{"Depth": "1"})
+	if err != nil {
+		return err
+	}
+	if status != http.StatusMultiStatus || !strings.Contains(listing, "getetag") {
+		return errors.Errorf("PROPFIND answered %d %q", status, listing)
+	}
+	aliceCard := book + cardName(listing)
+	if status, vcard, _, err := h.davRequest(ctx, account, http.MethodGet, aliceCard, "", nil); err != nil {
+		return err
+	} else if status != http.StatusOK || !strings.Contains(vcard, "FN:"+alice.name+"\r\n") {
+		return errors.Errorf("GET answered %d %q", status, vcard)
+	}
+
+	// A contact added on the phone comes to the bot.
+	newCard := book + "new-uid.vcf"
+	vcard := "BEGIN:VCARD\r\nVERSION:3.0\r\nUID:new-uid\r\nFN:Carol\r\nTEL:+7 900 000 00 01\r\nEND:VCARD\r\n"
+	if status, _, _, err := h.davRequest(ctx, account, http.MethodPut, newCard, vcard, map[string]string{"If-None-Match": "*"}); err != nil {
+		return err
+	} else if status != http.StatusCreated {
+		return errors.Errorf("PUT of a new vCard answered %d, want 201", status)
+	}
+	if err := h.SendText(ctx, userID, "/list_contacts"); err != nil {
+		return errors.Wrap(err, "cannot send /list_contacts")
+	}
+	if _, err := h.expectBotMessage(userID, "Name: Carol"); err != nil {
+		return err
+	}
+
+	// Changes go only over the vCard the client has seen.
+	status, _, header, err := h.davRequest(ctx, account, http.MethodGet, newCard, "", nil)
+	if err != nil {
+		return err
+	}
+	etag := header.Get("ETag")
+	if status != http.StatusOK || etag == "" {
+		return errors.Errorf("GET of the new vCard answered %d with ETag %q", status, etag)
+	}
+	updated := strings.Replace(vcard, "FN:Carol", "FN:Caroline", 1)
+	if status, _, _, err := h.davRequest(ctx, account, http.MethodPut, newCard, updated, map[string]string{"If-Match": etag}); err != nil {
+		return err
+	} else if status != http.StatusNoContent {
+		return errors.Errorf("PUT of an update answered %d, want 204", status)
+	}
+	if status, _, _, err := h.davRequest(ctx, account, http.MethodPut, newCard, vcard, map[string]string{"If-Match": etag}); err != nil {
+		return err
+	} else if status != http.StatusPreconditionFailed {
+		return errors.Errorf("PUT over a stale ETag answered %d, want 412", status)
+	}
+
+	multiget := `<?xml version="1.0"?><C:addressbook-multiget xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:carddav">` +
+		`<D:prop><D:getetag/><C:address-data/></D:prop><D:href>` + newCard + `</D:href></C:addressbook-multiget>`
+	if status, report, _, err := h.davRequest(ctx, account, "REPORT", book, multiget, nil); err != nil {
+		return err
+	} else if status != http.StatusMultiStatus || !strings.Contains(report, "FN:Caroline") {
+		return errors.Errorf("REPORT answered %d %q", status, report)
+	}
+
+	// A contact deleted on the phone is gone from the bot.
+	if status, _, _, err := h.davRequest(ctx, account, http.MethodDelete, newCard, "", nil); err != nil {
+		return err
+	} else if status != http.StatusNoContent {
+		return errors.Errorf("DELETE answered %d, want 204", status)
+	}
+	if status, _, _, err := h.davRequest(ctx, account, http.MethodGet, newCard, "", nil); err != nil {
+		return err
+	} else if status != http.StatusNotFound {
+		return errors.Errorf("GET of the deleted vCard answered %d, want 404", status)
+	}
+
+	// A new password replaces the old one.
+	if err := h.SendText(ctx, userID, "/carddav"); err != nil {
+		return errors.Wrap(err, "cannot send /carddav")
+	}
+	if _, err := h.expectBotMessage(userID, "Add a CardDAV account"); err != nil {
+		return err
+	}
+	if status, _, _, err := h.davRequest(ctx, account, "PROPFIND", book, "", nil); err != nil {
+		return err
+	} else if status != http.StatusUnauthorized {
+		return errors.Errorf("old password answered %d, want 401", status)
+	}
+	return nil
+}
+
+type carddavAccount struct {
+	server   string
+	user     string
+	password string
+}
+
+// messageField finds the value after the label in a line of the message.
+func messageField(text, label string) string {
+	for _, line := range strings.Split(text, "\n") {
+		if value, ok := strings.CutPrefix(line, label); ok {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+// cardName finds the name of the first vCard in the PROPFIND response.
+func cardName(listing string) string {
+	end := strings.Index(listing, ".vcf</href>")
+	if end < 0 {
+		return ""
+	}
+	start := strings.LastIndex(listing[:end], "/")
+	return listing[start+1:end] + ".vcf"
+}
+
+// davRequest makes a request to the CardDAV server as a client signed in to the account does.
+func (h *Harness) davRequest(ctx context.Context, account carddavAccount, method, link, body string,
+	header map[string]string) (int, string, http.Header, error) {
+	req, err := http.NewRequestWithContext(ctx, method, link, strings.NewReader(body))
+	if err != nil {
+		return 0, "", nil, errors.Wrapf(err, "cannot make request to %q", link)
+	}
+	req.SetBasicAuth(account.user, account.password)
+	for key, value := range header {
+		req.Header.Set(key, value)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, "", nil, errors.Wrapf(err, "cannot %s %q", method, link)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, "", nil, errors.Wrap(err, "cannot read response")
+	}
+	return resp.StatusCode, string(data), resp.Header, nil
+}
+
+// apiContact is a contact in the responses of the API.
+type apiContact struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Phone    string `json:"phone"`
+	Birthday string `json:"birthday"`
+}
+
+func apiScenario(ctx context.Context, h *Harness, userID int64) error {
+	if err := addAndSave(ctx, h, userID, alice); err != nil {
+		return err
+	}
+
+	base, token, err := issueToken(ctx, h, userID)
+	if err != nil {
+		return err
+	}
+	contacts := base + "contacts"
+
+	if status, _, err := h.apiRequest(ctx, "wrong", http.MethodGet, contacts, "", nil); err != nil {
+		return err
+	} else if status != http.StatusUnauthorized {
+		return errors.Errorf("wrong token answered %d, want 401", status)
+	}
+	if status, _, err := h.apiRequest(ctx, "", http.MethodGet, base+"openapi.yaml", "", nil); err != nil {
+		return err
+	} else if status != http.StatusOK {
+		return errors.Errorf("spec answered %d, want 200", status)
+	}
+
+	var list struct {
+		Contacts []apiContact `json:"contacts"`
+		Total    int          `json:"total"`
+	}
+	if status, _, err := h.apiRequest(ctx, token, http.MethodGet, contacts, "", &list); err != nil {
+		return err
+	} else if status != http.StatusOK || list.Total != 1 || list.Contacts[0].Name != alice.name {
+		return errors.Errorf("list answered %d %+v, want %s", status, list, alice.name)
+	}
+
+	if status, _, err := h.apiRequest(ctx, token, http.MethodPost, contacts, `{"name": "Dave", "email": "not an email"}`, nil); err != nil {
+		return err
+	} else if status != http.StatusBadRequest {
+		return errors.Errorf("invalid email answered %d, want 400", status)
+	}
+	var dave apiContact
+	status, header, err := h.apiRequest(ctx, token, http.MethodPost, contacts,
+		`{"name": "Dave", "email": "dave@example.com", "birthday": "--05-01"}`, &dave)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusCreated || dave.ID >= 0 || dave.Birthday != "--05-01" || header.Get("Location") == "" {
+		return errors.Errorf("create answered %d %+v", status, dave)
+	}
+	daveLink := contacts + "/" + strconv.Itoa(dave.ID)
+
+	if status, _, err := h.apiRequest(ctx, token, http.MethodGet, contacts+"?name=dav&birthday_month=5", "", &list); err != nil {
+		return err
+	} else if status != http.StatusOK || list.Total != 1 || list.Contacts[0].ID != dave.ID {
+		return errors.Errorf("filtered list answered %d %+v, want only Dave", status, list)
+	}
+	if status, _, err := h.apiRequest(ctx, token, http.MethodGet, contacts+"?limit=1&offset=1", "", &list); err != nil {
+		return err
+	} else if status != http.StatusOK || list.Total != 2 || len(list.Contacts) != 1 || list.Contacts[0].Name != alice.name {
+		return errors.Errorf("second page answered %d %+v, want only Alice", status, list)
+	}
+
+	var patched apiContact
+	if status, _, err := h.apiRequest(ctx, token, http.MethodPatch, daveLink, `{"phone": "+1 555 0100", "email": ""}`, &patched); err != nil {
+		return err
+	} else if status != http.StatusOK || patched.Phone != "+1 555 0100" || patched.Email != "" || patched.Name != "Dave" {
+		return errors.Errorf("patch answered %d %+v", status, patched)
+	}
+	if err := h.SendText(ctx, userID, "/list_contacts"); err != nil {
+		return errors.Wrap(err, "cannot send /list_contacts")
+	}
+	if _, err := h.expectBotMessage(userID, "Name: Dave"); err != nil {
+		return err
+	}
+
+	if status, _, err := h.apiRequest(ctx, token, http.MethodDelete, daveLink, "", nil); err != nil {
+		return err
+	} else if status != http.StatusNoContent {
+		return errors.Errorf("delete answered %d, want 204", status)
+	}
+	if status, _, err := h.apiRequest(ctx, token, http.MethodGet, daveLink, "", nil); err != nil {
+		return err
+	} else if status != http.StatusNotFound {
+		return errors.Errorf("deleted contact answered %d, want 404", status)
+	}
+
+	// The requests over the limit are turned away until the bucket fills up again.
+	for i := 0; ; i++ {
+		status, header, err := h.apiRequest(ctx, token, http.MethodGet, contacts, "", nil)
+		if err != nil {
+			return err
+		}
+		if status == http.StatusTooManyRequests {
+			if header.Get("Retry-After") == "" {
+				return errors.New("429 has no Retry-After")
+			}
+			break
+		}
+		if i == 100 {
+			return errors.New("no request was limited")
+		}
+	}
+
+	// The wrong tokens use up the limit of the address, which turns away even the right one.
+	for i := 0; ; i++ {
+		status, _, err := h.apiRequest(ctx, "wrong", http.MethodGet, contacts, "", nil)
+		if err != nil {
+			return err
+		}
+		if status == http.StatusTooManyRequests {
+			break
+		}
+		if i == 10 {
+			return errors.New("wrong tokens were not limited")
+		}
+	}
+	if status, _, err := h.apiRequest(ctx, token, http.MethodGet, contacts, "", nil); err != nil {
+		return err
+	} else if status != http.StatusTooManyRequests {
+		return errors.Errorf("request from the limited address answered %d, want 429", status)
+	}
+	return nil
+}
+
+// issueToken sends /token and returns the URL of the API and the token from the answer.
+func issueToken(ctx context.Context, h *Harness, userID int64) (string, string, error) {
+	if err := h.SendText(ctx, userID, "/token"); err != nil {
+		return "", "", errors.Wrap(err, "cannot send /token")
+	}
+	msg, err := h.expectBotMessage(userID, "Your token for the REST API")
+	if err != nil {
+		return "", "", err
+	}
+	lines := strings.Split(msg.Text, "\n")
+	if len(lines) < 2 || lines[1] == "" {
+		return "", "", errors.Errorf("token message %q has no token", msg.Text)
+	}
+	base := strings.TrimSuffix(strings.TrimPrefix(lines[0], "Your token for the REST API of the contacts at "), ":")
+	return base, lines[1], nil
+}
+
+// apiRequest makes a request to the API with the token, decoding the successful response into out.
+func (h *Harness) apiRequest(ctx context.Context, token, method, link, body string, out any) (int, http.Header, error) {
+	req, err := http.NewRequestWithContext(ctx, method, link, strings.NewReader(body))
+	if err != nil {
+		return 0, nil, errors.Wrapf(err, "cannot make request to %q", link)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, nil, errors.Wrapf(err, "cannot %s %q", method, link)
+	}
+	defer resp.Body.Close()
+
+	if out != nil && resp.StatusCode < http.StatusMultipleChoices {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return 0, nil, errors.Wrap(err, "cannot decode response")
+		}
+	}
+	return resp.StatusCode, resp.Header, nil
+}
+
+func webhooksScenario(ctx context.Context, h *Harness, userID int64) error {
+	receiver := newWebhookReceiver()
+	defer receiver.Close()
+
+	// The contacts added before the webhook are not sent to it.
+	if err := addAndSave(ctx, h, userID, alice); err != nil {
+		return err
+	}
+
+	if err := h.SendText(ctx, userID, "/webhooks"); err != nil {
+		return errors.Wrap(err, "cannot send /webhooks")
+	}
+	list, err := h.expectBotMessage(userID, "You have no webhooks")
+	if err != nil {
+		return err
+	}
+	if err := h.pressButton(ctx, userID, list.ID, callbacks.WebhookAdd); err != nil {
+		return errors.Wrap(err, "cannot press Add webhook")
+	}
+	if err := h.expectAlert("Enter the URL"); err != nil {
+		return err
+	}
+	if err := h.SendText(ctx, userID, "ftp://example.com"); err != nil {
+		return errors.Wrap(err, "cannot send URL")
+	}
+	if _, err := h.expectBotMessage(userID, "It should be an http or https URL"); err != nil {
+		return err
+	}
+	if err := h.SendText(ctx, userID, receiver.URL); err != nil {
+		return errors.Wrap(err, "cannot send URL")
+	}
+	added, err := h.expectBotMessage(userID, "The webhook "+receiver.URL+" is added")
+	if err != nil {
+		return err
+	}
+	lines := strings.Split(added.Text, "\n")
+	if len(lines) < 2 || lines[1] == "" {
+		return errors.Errorf("webhook message %q has no secret", added.Text)
+	}
+	receiver.secret = lines[1]
+
+	if err := h.DeliverWebhooks(ctx, time.Now()); err != nil {
+		return errors.Wrap(err, "cannot DeliverWebhooks")
+	}
+	if got := receiver.Events(); len(got) != 0 {
+		return errors.Errorf("got events %+v before any change", got)
+	}
+
+	cardID, err := addContact(ctx, h, userID, testContact{name: "Bob"})
+	if err != nil {
+		return err
+	}
+	if err := saveCard(ctx, h, userID, cardID); err != nil {
+		return err
+	}
+	if err := h.DeliverWebhooks(ctx, time.Now()); err != nil {
+		return errors.Wrap(err, "cannot DeliverWebhooks")
+	}
+	events := receiver.Events()
+	if len(events) < 2 || events[0].Type != types.ContactCreated {
+		return errors.Errorf("got events %+v, want the new contact and its name", events)
+	}
+	for _, event := range events {
+		if event.ContactID != cardID || event.Contact == nil || event.err != nil {
+			return errors.Errorf("got event %+v, want one about contact %d", event, cardID)
+		}
+	}
+	if last := events[len(events)-1]; last.Type != types.ContactUpdated || last.Contact.Name != "Bob" {
+		return errors.Errorf("got last event %+v, want Bob", last)
+	}
+
+	// A failed delivery is retried later with the same event.
+	receiver.Reset(http.StatusInternalServerError)
+	editCardID, err := openContact(ctx, h, userID, cardID)
+	if err != nil {
+		return err
+	}
+	if err := h.pressButton(ctx, userID, editCardID, callbacks.DeleteContact); err != nil {
+		return errors.Wrap(err, "cannot press Delete")
+	}
+	now := time.Now()
+	if err := h.DeliverWebhooks(ctx, now); err != nil {
+		return errors.Wrap(err, "cannot DeliverWebhooks")
+	}
+	if err := h.DeliverWebhooks(ctx, now); err != nil {
+		return errors.Wrap(err, "cannot DeliverWebhooks")
+	}
+	failed := receiver.Events()
+	if len(failed) != 1 || failed[0].Type != types.ContactDeleted || failed[0].ContactID != cardID || failed[0].Contact != nil {
+		return errors.Errorf("got events %+v, want one deletion of %d", failed, cardID)
+	}
+
+	receiver.Reset(http.StatusOK)
+	if err := h.DeliverWebhooks(ctx, now.Add(webhooks.RetryDelay(1)+time.Second)); err != nil {
+		return errors.Wrap(err, "cannot DeliverWebhooks")
+	}
+	retried := receiver.Events()
+	if len(retried) != 1 || retried[0].ID != failed[0].ID || retried[0].delivery != failed[0].delivery || retried[0].err != nil {
+		return errors.Errorf("got retried events %+v, want %+v", retried, failed)
+	}
+
+	// Nothing is sent to a removed webhook.
+	if err := h.SendText(ctx, userID, "/webhooks"); err != nil {
+		return errors.Wrap(err, "cannot send /webhooks")
+	}
+	list, err = h.expectBotMessage(userID, "1. "+receiver.URL)
+	if err != nil {
+		return err
+	}
+	err = h.pressMatching(ctx, userID, list.ID, "Remove", func(payload callbacks.Payload) bool {
+		return payload.Action == callbacks.WebhookRemove
+	})
+	if err != nil {
+		return err
+	}
+	if err := h.expectAlert("The webhook is removed"); err != nil {
+		return err
+	}
+	if _, err := h.botMessageContaining(userID, list.ID, "You have no webhooks"); err != nil {
+		return err
+	}
+	receiver.Reset(http.StatusOK)
+	if err := addAndSave(ctx, h, userID, testContact{name: "Carol"}); err != nil {
+		return err
+	}
+	if err := h.DeliverWebhooks(ctx, time.Now()); err != nil {
+		return errors.Wrap(err, "cannot DeliverWebhooks")
+	}
+	if got := receiver.Events(); len(got) != 0 {
+		return errors.Errorf("got events %+v after removing the webhook", got)
+	}
+	return nil
+}
+
+func adminScenario(ctx context.Context, h *Harness, userID int64) error {
+	user := strconv.FormatInt(userID, 10)
+
+	// The commands of the admins are unknown to the users.
+	if err := h.SendText(ctx, userID, "/stats"); err != nil {
+		return errors.Wrap(err, "cannot send /stats")
+	}
+	if _, err := h.expectBotMessage(userID, "I do not know such a command"); err != nil {
+		return err
+	}
+	if err := addAndSave(ctx, h, userID, alice); err != nil {
+		return err
+	}
+
+	for _, step := range []struct {
+		text string
+		want string
+	}{
+		{text: "/stats", want: "Active today: "},
+		{text: "/user " + user, want: "User " + user + "\nLast seen: "},
+		{text: "/user " + user, want: "Contacts: 1\n"},
+		{text: "/user 0", want: "There is no user 0"},
+		{text: "/ban Alice", want: "Write the Telegram ID of the user after the command, e.g. /ban"},
+		{text: "/ban " + strconv.FormatInt(AdminID, 10), want: "Admins cannot be banned"},
+		{text: "/ban " + user, want: "User " + user + " is banned"},
+	} {
+		if err := h.SendText(ctx, AdminID, step.text); err != nil {
+			return errors.Wrapf(err, "cannot send %s", step.text)
+		}
+		if _, err := h.expectBotMessage(AdminID, step.want); err != nil {
+			return err
+		}
+	}
+
+	// The bot ignores a banned user.
+	sent := len(h.Server.Messages(userID))
+	if err := h.SendText(ctx, userID, "/start"); err != nil {
+		return errors.Wrap(err, "cannot send /start")
+	}
+	for _, msg := range h.Server.Messages(userID)[sent:] {
+		if msg.FromBot {
+			return errors.Errorf("bot sent %q to a banned user", msg.Text)
+		}
+	}
+
+	if err := h.SendText(ctx, AdminID, "/unban "+user); err != nil {
+		return errors.Wrap(err, "cannot send /unban")
+	}
+	if _, err := h.expectBotMessage(AdminID, "User "+user+" is unbanned"); err != nil {
+		return err
+	}
+	if err := h.SendText(ctx, userID, "/start"); err != nil {
+		return errors.Wrap(err, "cannot send /start")
+	}
+	if _, err := h.expectBotMessage(userID, "Hello!"); err != nil {
+		return err
+	}
+
+	// A broadcast reaches everyone but the banned users. The ID of the banned one is negative,
+	// so that it is never the user of a scenario of another run.
+	bannedID := -userID
+	if err := h.SendText(ctx, AdminID, "/ban "+strconv.FormatInt(bannedID, 10)); err != nil {
+		return errors.Wrap(err, "cannot send /ban")
+	}
+	if err := h.SendText(ctx, AdminID, "/broadcast"); err != nil {
+		return errors.Wrap(err, "cannot send /broadcast")
+	}
+	if _, err := h.expectBotMessage(AdminID, "Write the message after /broadcast"); err != nil {
+		return err
+	}
+	if err := h.SendText(ctx, AdminID, "/broadcast The bot is down for maintenance tonight"); err != nil {
+		return errors.Wrap(err, "cannot send /broadcast")
+	}
+	if _, err := h.expectBotMessage(AdminID, "Sending the message to"); err != nil {
+		return err
+	}
+	h.WaitBroadcast()
+
+	if _, err := h.expectBotMessage(userID, "The bot is down for maintenance tonight"); err != nil {
+		return err
+	}
+	for _, msg := range h.Server.Messages(bannedID) {
+		if msg.FromBot {
+			return errors.Errorf("bot sent %q to a banned user", msg.Text)
+		}
+	}
+	_, err := h.expectBotMessage(AdminID, "The message is sent to")
+	return err
+}
+
+func accessScenario(ctx context.Context, h *Harness, userID int64) (err error) {
+	user := strconv.FormatInt(userID, 10)
+	username := "@user" + user
+
+	// The other scenarios need everyone let in.
+	defer func() {
+		if openErr := h.SendText(ctx, AdminID, "/access open"); err == nil {
+			err = errors.Wrap(openErr, "cannot send /access open")
+		}
+	}()
+
+	// The token got while everyone was let in stops working with the access.
+	base, token, err := issueToken(ctx, h, userID)
+	if err != nil {
+		return err
+	}
+
+	steps := []struct {
+		from int64
+		text string
+		want string
+		// api is the status of a request to the API with the token after the step, if any.
+		api int
+	}{
+		{from: AdminID, text: "/access everyone", want: "The mode is open, allowlist or invite"},
+		{from: AdminID, text: "/access allowlist", want: "Who may use the bot: the users on the allowlist", api: http.StatusForbidden},
+		{from: userID, text: "/start", want: "This bot is private, ask its admins to let you in"},
+		{from: AdminID, text: "/allow " + username, want: username + " may use the bot", api: http.StatusOK},
+		{from: userID, text: "/start", want: "Hello!"},
+		{from: AdminID, text: "/access", want: "\n" + username + "\n"},
+		{from: AdminID, text: "/disallow " + username, want: username + " is removed from the allowlist", api: http.StatusForbidden},
+		{from: AdminID, text: "/disallow " + username, want: username + " is not on the allowlist"},
+		{from: userID, text: "/start", want: "This bot is private"},
+		{from: AdminID, text: "/allow " + user, want: user + " may use the bot", api: http.StatusOK},
+		{from: userID, text: "/start", want: "Hello!"},
+		{from: AdminID, text: "/disallow " + user, want: user + " is removed from the allowlist", api: http.StatusForbidden},
+		{from: AdminID, text: "/disallow user name", want: "Write the Telegram ID or the username after the command, e.g. /disallow"},
+		{from: AdminID, text: "/access invite", want: "Who may use the bot: the users on the allowlist and the ones with an invite"},
+		{from: userID, text: "/start", want: "ask its admins for an invite"},
+		{from: userID, text: "/start wrong", want: "The invite is wrong, used or expired"},
+	}
+	for _, step := range steps {
+		if err := h.SendText(ctx, step.from, step.text); err != nil {
+			return errors.Wrapf(err, "cannot send %s", step.text)
+		}
+		if _, err := h.expectBotMessage(step.from, step.want); err != nil {
+			return err
+		}
+		if step.api == 0 {
+			continue
+		}
+		if status, _, err := h.apiRequest(ctx, token, http.MethodGet, base+"contacts", "", nil); err != nil {
+			return err
+		} else if status != step.api {
+			return errors.Errorf("API answered %d after %q, want %d", status, step.text, step.api)
+		}
+	}
+
+	if err := h.SendText(ctx, AdminID, "/invite"); err != nil {
+		return errors.Wrap(err, "cannot send /invite")
+	}
+	msg, err := h.expectBotMessage(AdminID, "The new user sends the bot:\n/start ")
+	if err != nil {
+		return err
+	}
+	_, code, _ := strings.Cut(msg.Text, "/start ")
+
+	// The invited user is let in and greeted, the invite does not work again.
+	if err := h.SendText(ctx, userID, "/start "+code); err != nil {
+		return errors.Wrap(err, "cannot send /start with the invite")
+	}
+	messages := h.Server.Messages(userID)
+	if len(messages) < 2 || !strings.Contains(messages[len(messages)-2].Text, "The invite is accepted") {
+		return errors.New("bot has not accepted the invite")
+	}
+	if _, err := h.expectBotMessage(userID, "Hello!"); err != nil {
+		return err
+	}
+	if err := h.SendText(ctx, -userID, "/start "+code); err != nil {
+		return errors.Wrap(err, "cannot send /start with the used invite")
+	}
+	if _, err := h.expectBotMessage(-userID, "The invite is wrong, used or expired"); err != nil {
+		return err
+	}
+
+	if err := h.SendText(ctx, AdminID, "/disallow "+user); err != nil {
+		return errors.Wrap(err, "cannot send /disallow")
+	}
+	_, err = h.expectBotMessage(AdminID, user+" is removed from the allowlist")
+	return err
+}
+
+func accountScenario(ctx context.Context, h *Harness, userID int64) error {
+	if err := addAndSave(ctx, h, userID, alice); err != nil {
+		return err
+	}
+
+	data, err := myData(ctx, h, userID)
+	if err != nil {
+		return err
+	}
+	if data.User.ID != userID || data.User.LastSeen == nil || len(data.Contacts) != 1 ||
+		data.Contacts[0].Name != alice.name || data.Contacts[0].Phone == "" {
+		return errors.Errorf("got data %+v, want the user with Alice", data)
+	}
+
+	// Nothing is deleted until the user confirms.
+	for _, step := range []struct {
+		action callbacks.Action
+		want   string
+	}{
+		{action: callbacks.KeepAccount, want: "Nothing is deleted"},
+		{action: callbacks.DeleteAccount, want: "Your account and all your data are deleted"},
+	} {
+		if err := h.SendText(ctx, userID, "/delete_account"); err != nil {
+			return errors.Wrap(err, "cannot send /delete_account")
+		}
+		question, err := h.expectBotMessage(userID, "Delete your account?")
+		if err != nil {
+			return err
+		}
+		if err := h.pressButton(ctx, userID, question.ID, step.action); err != nil {
+			return errors.Wrapf(err, "cannot press %s", step.action)
+		}
+		if _, err := h.botMessageContaining(userID, question.ID, step.want); err != nil {
+			return err
+		}
+
+		if data, err = myData(ctx, h, userID); err != nil {
+			return err
+		}
+		if kept := step.action == callbacks.KeepAccount; kept != (len(data.Contacts) == 1) {
+			return errors.Errorf("got contacts %+v after pressing %s", data.Contacts, step.action)
+		}
+	}
+	return nil
+}
+
+// myData sends /mydata and reads the file the bot sends.
+func myData(ctx context.Context, h *Harness, userID int64) (types.UserData, error) {
+	if err := h.SendText(ctx, userID, "/mydata"); err != nil {
+		return types.UserData{}, errors.Wrap(err, "cannot send /mydata")
+	}
+	file, err := h.expectBotMessage(userID, "Everything the bot keeps about you")
+	if err != nil {
+		return types.UserData{}, err
+	}
+	if file.Document == nil || file.Document.Name != account.FileName {
+		return types.UserData{}, errors.Errorf("bot sent %+v, want %s", file.Document, account.FileName)
+	}
+
+	var data types.UserData
+	if err := json.Unmarshal(file.Document.Data, &data); err != nil {
+		return types.UserData{}, errors.Wrap(err, "cannot Unmarshal")
+	}
+	return data, nil
+}
+
+// webhookReceiver is a stand-in for the service of a user receiving the events.
+type webhookReceiver struct {
+	*httptest.Server
+	// secret checks the signatures, it is known once the webhook is added.
+	secret string
+
+	mu     sync.Mutex
+	status int
+	events []receivedEvent
+}
+
+// receivedEvent is an event with the delivery it came in and whether it was signed right.
+type receivedEvent struct {
+	types.WebhookEvent
+	delivery string
+	err      error
+}
+
+func newWebhookReceiver() *webhookReceiver {
+	r := &webhookReceiver{status: http.StatusOK}
+	r.Server = httptest.NewServer(http.HandlerFunc(r.receive))
+	return r
+}
+
+func (r *webhookReceiver) receive(w http.ResponseWriter, req *http.Request) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	event := receivedEvent{delivery: req.Header.Get(webhooks.DeliveryHeader)}
+	if err := json.Unmarshal(body, &event.WebhookEvent); err != nil {
+		event.err = errors.Wrap(err, "cannot Unmarshal")
+	} else if sig := req.Header.Get(webhooks.SignatureHeader); sig != types.SignPayload(r.secret, body) {
+		event.err = errors.Errorf("wrong signature %q", sig)
+	} else if eventType := req.Header.Get(webhooks.EventHeader); eventType != string(event.Type) {
+		event.err = errors.Errorf("event header %q does not match %q", eventType, event.Type)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+	w.WriteHeader(r.status)
+}
+
+// Events returns the events received since the last Reset.
+func (r *webhookReceiver) Events() []receivedEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]receivedEvent(nil), r.events...)
+}
+
+// Reset forgets the events and answers the next ones with the status.
+func (r *webhookReceiver) Reset(status int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = nil
+	r.status = status
+}
+
+// flowAnswer is an answer to a question of a conversation and the start of the reply to it.
+type flowAnswer struct {
+	text  string
+	reply string
+}
+
+// runFlow presses the button of the conversation under the card, checks the alert and
+// gives the answers checking the replies to them.
+func (h *Harness) runFlow(ctx context.Context, userID int64, cardID int, action callbacks.Action, alert string,
+	answers []flowAnswer) error {
+	if err := h.pressButton(ctx, userID, cardID, action); err != nil {
+		return errors.Wrapf(err, "cannot press %s", action)
+	}
+	if err := h.expectAlert(alert); err != nil {
+		return err
+	}
+	for _, answer := range answers {
+		if err := h.SendText(ctx, userID, answer.text); err != nil {
+			return errors.Wrapf(err, "cannot answer %q", answer.text)
+		}
+		if _, err := h.expectBotMessage(userID, answer.reply); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// expectPhotoCard checks that the latest message of the bot is the card with the photo.
+func expectPhotoCard(h *Harness, userID int64, photo, text string) (tgfake.Message, error) {
+	card, err := h.expectBotMessage(userID, text)
+	if err != nil {
+		return card, err
+	}
+	if card.Photo != photo {
+		return card, errors.Errorf("card %d has photo %q, want %q", card.ID, card.Photo, photo)
+	}
+	return card, nil
+}
+
+// addWithWizard answers the wizard with the answers, invalid ones included, and returns
+// the ID of the summary.
+func addWithWizard(ctx context.Context, h *Harness, userID int64, answers []string) (int, error) {
+	if err := h.SendText(ctx, userID, "/add_contact"); err != nil {
+		return 0, errors.Wrap(err, "cannot send /add_contact")
+	}
+	card, err := h.expectBotMessage(userID, "Name: New contact")
+	if err != nil {
+		return 0, err
+	}
+	if err := h.pressButton(ctx, userID, card.ID, callbacks.StartWizard); err != nil {
+		return 0, errors.Wrap(err, "cannot press Step by step")
+	}
+	if _, err := h.expectBotMessage(userID, "Step 1 of 5"); err != nil {
+		return 0, err
+	}
+
+	for _, answer := range answers {
+		if err := h.SendText(ctx, userID, answer); err != nil {
+			return 0, errors.Wrapf(err, "cannot answer %q", answer)
+		}
+	}
+	summary, err := h.expectBotMessage(userID, "Check the new contact:")
+	if err != nil {
+		return 0, err
+	}
+	return summary.ID, nil
+}
+
+// addContact fills in every field of a new contact and returns the ID of its card.
+func addContact(ctx context.Context, h *Harness, userID int64, contact testContact) (int, error) {
+	if err := h.SendText(ctx, userID, "/add_contact"); err != nil {
+		return 0, errors.Wrap(err, "cannot send /add_contact")
+	}
+	card, err := h.expectBotMessage(userID, "Name: New contact")
+	if err != nil {
+		return 0, err
+	}
+
+	fields := []struct {
+		button callbacks.Action
+		value  string
+		shown  string
+	}{
+		{button: callbacks.ChangeContactName, value: contact.name, shown: contact.name},
+		{button: callbacks.ChangeContactPhone, value: contact.phone, shown: contact.phone},
+		{button: callbacks.ChangeContactBirthday, value: contact.birthday, shown: contact.birthdayCard},
+		{button: callbacks.ChangeContactDescription, value: contact.description, shown: contact.description},
+	}
+	for _, field := range fields {
+		if field.value == "" {
+			continue
+		}
+		if err := editField(ctx, h, userID, card.ID, field.button, field.value, field.shown); err != nil {
+			return 0, err
+		}
+	}
+
+	return card.ID, nil
+}
+
+func addAndSave(ctx context.Context, h *Harness, userID int64, contact testContact) error {
+	cardID, err := addContact(ctx, h, userID, contact)
+	if err != nil {
+		return err
+	}
+	return saveCard(ctx, h, userID, cardID)
+}
+
+// openContact opens the contact with /edit_contact and returns the ID of the new card.
+func openContact(ctx context.Context, h *Harness, userID int64, contactID int) (int, error) {
+	if err := h.SendText(ctx, userID, "/edit_contact"); err != nil {
+		return 0, errors.Wrap(err, "cannot send /edit_contact")
+	}
+	if _, err := h.expectBotMessage(userID, "Write ID of the contact you want to edit:"); err != nil {
+		return 0, err
+	}
+
+	if err := h.SendText(ctx, userID, strconv.Itoa(contactID)); err != nil {
+		return 0, errors.Wrap(err, "cannot send contact ID")
+	}
+	card, err := h.expectBotMessage(userID, "ID: "+strconv.Itoa(contactID))
+	if err != nil {
+		return 0, err
+	}
+	return card.ID, nil
+}
+
+// editField presses the button, types the value and checks that the card shows it as shown.
+func editField(ctx context.Context, h *Harness, userID int64, cardID int, button callbacks.Action, value, shown string) error {
+	if err := h.pressButton(ctx, userID, cardID, button); err != nil {
+		return errors.Wrapf(err, "cannot press %s", button)
+	}
+	if err := h.expectAlert("Enter"); err != nil {
+		return err
+	}
+
+	if err := h.SendText(ctx, userID, value); err != nil {
+		return errors.Wrapf(err, "cannot send value for %s", button)
+	}
+	_, err := h.botMessageContaining(userID, cardID, shown)
+	return err
+}
+
+func saveCard(ctx context.Context, h *Harness, userID int64, cardID int) error {
+	if err := h.pressButton(ctx, userID, cardID, callbacks.ChangeContactDone); err != nil {
+		return errors.Wrap(err, "cannot press Save")
+	}
+	if err := h.expectAlert("Saved"); err != nil {
+		return err
+	}
+
+	card, err := h.botMessage(userID, cardID)
+	if err != nil {
+		return err
+	}
+	if !card.Deleted {
+		return errors.New("saved card is still in the chat")
+	}
+	return nil
+}
+
+// pressButton presses the button doing the action under the message, whichever contact it is for.
+func (h *Harness) pressButton(ctx context.Context, userID int64, messageID int, action callbacks.Action) error {
+	return h.pressMatching(ctx, userID, messageID, string(action), func(payload callbacks.Payload) bool {
+		return payload.Action == action
+	})
+}
+
+// pressButtonWith presses the button with exactly the payload under the message.
+func (h *Harness) pressButtonWith(ctx context.Context, userID int64, messageID int, want callbacks.Payload) error {
+	return h.pressMatching(ctx, userID, messageID, string(want.Action)+" "+want.Arg, func(payload callbacks.Payload) bool {
+		return payload == want
+	})
+}
+
+func (h *Harness) pressMatching(ctx context.Context, userID int64, messageID int, name string, match func(callbacks.Payload) bool) error {
+	msg, err := h.botMessage(userID, messageID)
+	if err != nil {
+		return err
+	}
+	for _, row := range msg.Keyboard {
+		for _, button := range row {
+			payload, err := h.codec.Decode(userID, button.Data)
+			if err != nil {
+				return errors.Wrapf(err, "cannot decode button %q", button.Text)
+			}
+			if match(payload) {
+				return h.PressButton(ctx, userID, messageID, button.Data)
+			}
+		}
+	}
+	return errors.Errorf("message %d has no %s button", messageID, name)
+}
+
+// pressLabeled presses the button with the label under the message.
+func (h *Harness) pressLabeled(ctx context.Context, userID int64, messageID int, label string) error {
+	msg, err := h.botMessage(userID, messageID)
+	if err != nil {
+		return err
+	}
+	for _, row := range msg.Keyboard {
+		for _, button := range row {
+			if button.Text == label {
+				return h.PressButton(ctx, userID, messageID, button.Data)
+			}
+		}
+	}
+	return errors.Errorf("message %d has no %q button", messageID, label)
+}
+
+// expectBotMessage checks that the latest message of the bot contains the text.
+func (h *Harness) expectBotMessage(userID int64, text string) (tgfake.Message, error) {
+	msg, ok := h.Server.LastBotMessage(userID)
+	if !ok {
+		return msg, errors.Errorf("bot sent nothing, want %q", text)
+	}
+	if !strings.Contains(msg.Text, text) {
+		return msg, errors.Errorf("bot sent %q, want %q", msg.Text, text)
+	}
+	return msg, nil
+}
+
+func (h *Harness) botMessage(userID int64, messageID int) (tgfake.Message, error) {
+	for _, msg := range h.Server.Messages(userID) {
+		if msg.FromBot && msg.ID == messageID {
+			return msg, nil
+		}
+	}
+	return tgfake.Message{}, errors.Errorf("bot has no message %d", messageID)
+}
+
+func (h *Harness) botMessageContaining(userID int64, messageID int, text string) (tgfake.Message, error) {
+	msg, err := h.botMessage(userID, messageID)
+	if err != nil {
+		return msg, err
+	}
+	if !strings.Contains(msg.Text, text) {
+		return msg, errors.Errorf("message %d is %q, want %q", messageID, msg.Text, text)
+	}
+	return msg, nil
+}
+
+// expectAlert checks that the latest callback answer contains the text.
+func (h *Harness) expectAlert(text string) error {
+	alerts := h.Server.Alerts()
+	if len(alerts) == 0 {
+		return errors.Errorf("no callback answers, want %q", text)
+	}
+	if last := alerts[len(alerts)-1]; !strings.Contains(last.Text, text) {
+		return errors.Errorf("callback answered with %q, want %q", last.Text, text)
+	}
+	return nil
+}
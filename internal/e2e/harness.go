@@ -0,0 +1,193 @@
+// Package e2e drives whole conversations with the bot against the fake Telegram Bot API.
+//
+// The harness wires the real tg client, models and worker together, makes a user act
+// through the fake server and handles the resulting update before returning, so that
+// a scenario can check the chat right after every step.
+package e2e
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/profectus200/contact-book-bot/internal/clients/tg"
+	"github.com/profectus200/contact-book-bot/internal/clients/tg/tgfake"
+	"github.com/profectus200/contact-book-bot/internal/database"
+	"github.com/profectus200/contact-book-bot/internal/model/access"
+	"github.com/profectus200/contact-book-bot/internal/model/account"
+	"github.com/profectus200/contact-book-bot/internal/model/admin"
+	"github.com/profectus200/contact-book-bot/internal/model/api"
+	"github.com/profectus200/contact-book-bot/internal/model/calendar"
+	"github.com/profectus200/contact-book-bot/internal/model/callbacks"
+	"github.com/profectus200/contact-book-bot/internal/model/carddav"
+	"github.com/profectus200/contact-book-bot/internal/model/conversation"
+	"github.com/profectus200/contact-book-bot/internal/model/flows"
+	"github.com/profectus200/contact-book-bot/internal/model/messages"
+	"github.com/profectus200/contact-book-bot/internal/model/reminders"
+	"github.com/profectus200/contact-book-bot/internal/model/webhooks"
+	"github.com/profectus200/contact-book-bot/internal/types"
+	"github.com/profectus200/contact-book-bot/internal/worker"
+	"go.uber.org/zap"
+)
+
+// callbackSecret signs the buttons sent in the scenarios.
+const callbackSecret = "e2e"
+
+// updateTimeout is how long the harness waits for an update to come through the client.
+const updateTimeout = 5 * time.Second
+
+// limits leave the requests to the fake server unthrottled: the scenarios send hundreds of
+// messages to every chat, which would take minutes within the limits of Telegram.
+var limits = tg.Limits{GlobalRate: 1000, GlobalBurst: 1000, ChatRate: 1000, ChatBurst: 1000}
+
+// AdminID is the user listed as an admin of the bot, the IDs of the users of the scenarios
+// are far above it.
+const AdminID int64 = 1
+
+type Harness struct {
+	Server *tgfake.Server
+	// httpServer serves the calendar feeds, CardDAV and the API, like the HTTP server of the bot.
+	httpServer *httptest.Server
+	client     *tg.Client
+	codec      *callbacks.Codec
+	updates    <-chan types.Update
+	worker     *worker.UpdateListenerWorker
+	reminders  *reminders.Model
+	webhooks   *webhooks.Model
+	admin      *admin.Model
+}
+
+type fakeEndpoint struct {
+	endpoint string
+}
+
+func (e fakeEndpoint) Token() string {
+	return tgfake.Token
+}
+
+func (e fakeEndpoint) APIEndpoint() string {
+	return e.endpoint
+}
+
+// openPolicy lets everyone use the bot, the scenarios of the access change the mode in the chat.
+type openPolicy struct{}
+
+func (openPolicy) Admins() []int64 {
+	return []int64{AdminID}
+}
+
+func (openPolicy) AccessMode() string {
+	return string(types.AccessOpen)
+}
+
+func (openPolicy) AccessUsers() []int64 {
+	return nil
+}
+
+func (openPolicy) AccessUsernames() []string {
+	return nil
+}
+
+func New(storage *database.Storage, logger *zap.Logger) (*Harness, error) {
+	server := tgfake.NewServer()
+
+	codec := callbacks.NewCodec([]byte(callbackSecret))
+	client, err := tg.New(fakeEndpoint{endpoint: server.Endpoint()}, codec, tg.NewLimiter(limits), logger)
+	if err != nil {
+		server.Close()
+		return nil, errors.Wrap(err, "cannot create tg client")
+	}
+
+	engine := conversation.New(client, storage.Users, storage.Settings, storage.Tx, logger)
+	conversations := flows.New(engine, client, storage.Contacts, storage.Settings, storage.Webhooks, logger)
+
+	accessModel, err := access.New(client, storage.Access, storage.Users, storage.Tx, openPolicy{}, logger)
+	if err != nil {
+		server.Close()
+		return nil, errors.Wrap(err, "cannot create access model")
+	}
+
+	mux := http.NewServeMux()
+	httpServer := httptest.NewServer(mux)
+	calendarModel := calendar.New(client, storage.Contacts, storage.Users, storage.Settings, accessModel, httpServer.URL, logger)
+	mux.Handle(calendar.PathPrefix, calendarModel)
+	carddavModel := carddav.New(client, storage.Contacts, storage.Users, storage.Tx, accessModel, httpServer.URL, logger)
+	mux.Handle(carddav.PathPrefix, carddavModel)
+	mux.Handle(carddav.WellKnownPath, carddavModel)
+	apiModel := api.New(client, storage.Contacts, storage.Users, storage.Tx, accessModel, httpServer.URL, logger)
+	mux.Handle(api.PathPrefix, apiModel)
+	// The receivers of the scenarios listen on the loopback.
+	webhookModel := webhooks.New(client, storage.Webhooks, webhooks.NewHTTPClient(true), logger)
+	accountModel := account.New(client, storage.Contacts, storage.Users, storage.Settings, storage.Webhooks, storage.Access, storage.Tx, logger)
+	adminModel := admin.New(client, storage.Users, []int64{AdminID}, admin.BroadcastInterval, logger)
+
+	msgModel := messages.New(client, storage.Contacts, conversations, calendarModel, carddavModel, apiModel, webhookModel, accountModel, adminModel, accessModel, logger)
+	callbackModel := callbacks.New(client, storage.Contacts, storage.Users, storage.Settings, storage.Tx, conversations, calendarModel, webhookModel, accountModel, codec, logger)
+
+	return &Harness{
+		Server:     server,
+		httpServer: httpServer,
+		client:     client,
+		codec:      codec,
+		updates:    client.Start(),
+		worker:     worker.NewUpdateListenerWorker(client, msgModel, callbackModel, storage.Settings, storage.Users, accessModel, logger),
+		reminders:  reminders.New(client, storage.Contacts, storage.Users, storage.Settings, logger),
+		webhooks:   webhookModel,
+		admin:      adminModel,
+	}, nil
+}
+
+func (h *Harness) Close() {
+	h.client.Stop()
+	h.httpServer.Close()
+	h.Server.Close()
+}
+
+// SendText makes the user send the text and waits until the bot handles it.
+func (h *Harness) SendText(ctx context.Context, userID int64, text string) error {
+	h.Server.SendText(userID, text)
+	return h.handleNext(ctx)
+}
+
+// SendPhoto makes the user send a photo with the file_id and waits until the bot handles it.
+func (h *Harness) SendPhoto(ctx context.Context, userID int64, fileID string) error {
+	h.Server.SendPhoto(userID, fileID)
+	return h.handleNext(ctx)
+}
+
+// PressButton makes the user press the button under the message and waits until the bot handles it.
+func (h *Harness) PressButton(ctx context.Context, userID int64, messageID int, data string) error {
+	if _, err := h.Server.PressButton(userID, messageID, data); err != nil {
+		return errors.Wrap(err, "cannot PressButton")
+	}
+	return h.handleNext(ctx)
+}
+
+// SendDueReminders delivers the reminders due by now, as the reminder worker does.
+func (h *Harness) SendDueReminders(ctx context.Context, now time.Time) error {
+	return h.reminders.SendDue(ctx, now)
+}
+
+// DeliverWebhooks posts the events of the webhooks due by now, as the webhook worker does.
+func (h *Harness) DeliverWebhooks(ctx context.Context, now time.Time) error {
+	return h.webhooks.DeliverDue(ctx, now)
+}
+
+// WaitBroadcast waits until the message sent to all the users with /broadcast is delivered.
+func (h *Harness) WaitBroadcast() {
+	h.admin.Wait()
+}
+
+func (h *Harness) handleNext(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, updateTimeout)
+	defer cancel()
+
+	select {
+	case update := <-h.updates:
+		return h.worker.HandleUpdate(ctx, update)
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "no update received")
+	}
+}
@@ -0,0 +1,270 @@
+package i18n
+
+var english = map[string]string{
+	LanguageName:  "English",
+	monthsOfDates: "January|February|March|April|May|June|July|August|September|October|November|December",
+	Days:          "day|days",
+	Weeks:         "week|weeks",
+	Months:        "month|months",
+	Years:         "year|years",
+
+	Start:             "Hello! You can save people contacts here!:)",
+	UnknownCommand:    "I do not know such a command",
+	AskSearchName:     "Write the name of your contact:",
+	AskContactID:      "Write ID of the contact you want to edit:",
+	WrongContactID:    "ID of a contact is a number, e.g. 12. Write it again:",
+	ContactNotFound:   "There is no contact with ID %d",
+	NoContacts:        "You don't have any contacts saved yet!",
+	WrongBirthday:     "I cannot recognize the date. Write it like 12.03, 12.03.1990, 1990-03-12 or 12 March, or '-' to remove the birthday:",
+	ChooseLanguage:    "Choose the language:",
+	NewContactName:    "New contact",
+	ContactsSeparator: "-----------------------------",
+	Cancelled:         "Cancelled, you can start over",
+	NothingToCancel:   "There is nothing to cancel",
+
+	ConversationExpired: "You have not answered for a while, so I stopped waiting. Start over when you are ready",
+
+	WizardStarted:     "Let's fill in the contact step by step",
+	WizardName:        "Step 1 of 5. Enter the name of the contact, or '-' to skip:",
+	WizardPhone:       "Step 2 of 5. Enter the phone, or '-' to skip:",
+	WizardEmail:       "Step 3 of 5. Enter the email, or '-' to skip:",
+	WizardBirthday:    "Step 4 of 5. Enter the birthday, e.g. 12.03 or 12.03.1990, or '-' to skip:",
+	WizardDescription: "Step 5 of 5. Enter a description, or '-' to skip:",
+	WizardSummary:     "Check the new contact:",
+	ChooseField:       "Choose what to change",
+
+	EnterFieldName:   "Enter the name of the field, e.g. Company, Website or Address:",
+	WrongFieldName:   "The name of a field is one line of up to 32 characters. Enter it again:",
+	EnterFieldType:   "What is in the field %s? Write %s:",
+	WrongFieldType:   "I do not know such a type. Write %s:",
+	EnterFieldValue:  "Enter %s, or '-' to remove the field:",
+	WrongFieldDate:   "I cannot recognize the date. Write it like 12.03.2024, 2024-03-12 or 12 March:",
+	WrongFieldURL:    "It does not look like a link. Write it like example.com or https://example.com/page:",
+	WrongFieldPhone:  "It does not look like a phone. Write it with digits, e.g. +7 900 123-45-67:",
+	CustomFieldText:  "text",
+	CustomFieldDate:  "date",
+	CustomFieldURL:   "link",
+	CustomFieldPhone: "phone",
+
+	EnterInteractionKind: "What did you do? Write %s:",
+	WrongInteractionKind: "I do not know such an interaction. Write %s:",
+	EnterInteractionDate: "When was it? Enter the date, e.g. 12.03 or 12.03.2024, or '-' for today:",
+	WrongInteractionDate: "I cannot recognize the date, or it has not come yet. Write it like 12.03 or 12.03.2024, or '-' for today:",
+	EnterInteractionNote: "Add a note, or '-' to skip it:",
+	InteractionCalled:    "called",
+	InteractionMet:       "met",
+	InteractionEmailed:   "emailed",
+	InteractionWithNote:  "%s, %s",
+
+	EnterReminderText: "What should I remind you about? E.g. call about the offer:",
+	EnterReminderDate: "When? E.g. tomorrow, friday 10:00, in 3 days, in 2 hours or 25.12 18:00:",
+	WrongReminderDate: "I cannot recognize the time, or it has passed. Write it like tomorrow, friday 10:00, in 3 days, in 2 hours or 25.12 18:00:",
+	ReminderSet:       "I will remind you on %s",
+	TooManyReminders:  "You already have %d reminders, cancel one in /reminders to add another",
+	ReminderDue:       "Reminder about %s: %s",
+	ReminderSnoozed:   "%s\nSnoozed until %s",
+	ReminderDone:      "%s\nDone",
+	ReminderCancelled: "The reminder is cancelled",
+	RemindersTitle:    "Reminders:",
+	ReminderLine:      "%d. %s, %s: %s",
+	NoReminders:       "You have no reminders. Press \"Remind me\" on a contact card to add one",
+
+	EnterEventName:       "Enter the name of the date, e.g. Wedding anniversary, Name day or Contract renewal:",
+	WrongEventName:       "The name of a date is one line of up to 32 characters. Enter it again:",
+	EnterEventRecurrence: "How often does %s come? Write e.g. every year, every 6 months or every 2 weeks, or '-' for every year:",
+	WrongEventRecurrence: "I cannot recognize it. Write e.g. every year, every 6 months or every 2 weeks, or '-' for every year:",
+	EnterEventDate:       "Enter the date, e.g. 12.06.2015 or 12 June, or '-' to remove the date %s:",
+	WrongEventDate:       "I cannot recognize the date. Write it like 12.06.2015 or 2015-06-12, the year may be left out only for yearly dates, or '-' to remove the date:",
+	EveryDay:             "every day",
+	EveryWeek:            "every week",
+	EveryMonth:           "every month",
+	EveryYear:            "every year",
+	EveryMany:            "every %d %s",
+	EventToday:           "today",
+	EventTomorrow:        "tomorrow",
+	EventIn:              "in %d %s",
+	UpcomingTitle:        "Coming in %d %s:",
+	UpcomingLine:         "%s, %s: %s, %s",
+	UpcomingBirthday:     "birthday",
+	NoUpcoming:           "Nothing is coming in %d %s",
+	TodayTitle:           "Today:",
+
+	CalendarName:        "Birthdays and dates",
+	CalendarBirthday:    "%s: birthday",
+	CalendarEvent:       "%s: %s",
+	CalendarLink:        "Subscribe to this link in your calendar app to see the birthdays and the other dates of your contacts there:\n%s\n\nKeep it secret: anyone with the link sees the dates. The link is shown only now, send /calendar again or press New link for a new one, the old one stops working then",
+	CalendarNoLink:      "This bot gives no calendar links, but you can import the file with the birthdays and the other dates into your calendar",
+	CalendarLinkChanged: "The old link does not work anymore",
+	CalendarFileCaption: "Open the file to import the dates into your calendar. It does not update, subscribe to the link for that",
+
+	MyDataCaption:        "Everything the bot keeps about you. The secrets, like the API token, are only marked as set",
+	DeleteAccountConfirm: "Delete your account? All your contacts with their fields, dates, interactions and reminders, your settings and your webhooks are deleted for good, and the calendar link, the CardDAV password and the API token stop working. Get a copy of your data with /mydata first",
+	DeleteAccountDone:    "Your account and all your data are deleted",
+	DeleteAccountKept:    "Nothing is deleted",
+
+	CardDAVAccount:     "Add a CardDAV account in the settings of your phone or mail app to sync the contacts both ways:\nServer: %s\nUser name: %s\nPassword: %s\n\nThe password is shown only now, delete this message once the account works. Send /carddav again for a new password, the old one stops working then",
+	CardDAVUnavailable: "This bot has no CardDAV server to sync the contacts with",
+
+	APIToken:       "Your token for the REST API of the contacts at %s:\n%s\n\nSend it in the Authorization header as a Bearer token. The API is described at %s\n\nThe token is shown only now and gives full access to your contacts, delete this message once you have saved it. Send /token again for a new token, the old one stops working then",
+	APIUnavailable: "This bot has no REST API",
+
+	WebhooksTitle:   "Your webhooks, notified when your contacts are added, changed or deleted:",
+	WebhookLine:     "%d. %s",
+	NoWebhooks:      "You have no webhooks. Add one to have your contacts sent to a URL whenever they are added, changed or deleted",
+	EnterWebhookURL: "Enter the URL to send the changes of your contacts to, e.g. https://example.com/hooks/contacts:",
+	WrongWebhookURL: "It should be an http or https URL without a password. Enter it again:",
+	WebhookAdded:    "The webhook %s is added. Every change of a contact is sent to it as a JSON POST request, signed in the X-Webhook-Signature-256 header with the HMAC-SHA256 of the body with the secret:\n%s\n\nThe secret is shown only now, keep it safe. A delivery is retried for a while until the URL answers with a 2xx status",
+	TooManyWebhooks: "You already have %d webhooks, remove one to add another",
+	WebhookRemoved:  "The webhook is removed",
+
+	AdminStats:       "Users: %d\nActive today: %d\nBanned: %d\nContacts: %d",
+	AdminUser:        "User %d\nLast seen: %s\nLanguage: %s\nContacts: %d\nReminders: %d\nWebhooks: %d\nCalendar link: %s\nCardDAV: %s\nAPI token: %s\nBanned: %s",
+	AdminNoUser:      "There is no user %d",
+	AdminUserUsage:   "Write the Telegram ID of the user after the command, e.g. %s 123456",
+	AdminYes:         "yes",
+	AdminNo:          "no",
+	AdminNever:       "never",
+	AdminBanned:      "User %d is banned, the bot ignores everything they send",
+	AdminUnbanned:    "User %d is unbanned",
+	AdminCannotBan:   "Admins cannot be banned",
+	BroadcastUsage:   "Write the message after /broadcast, e.g. /broadcast The bot is down for maintenance tonight",
+	BroadcastRunning: "Another message is being sent to everyone, wait until it is done",
+	BroadcastStarted: "Sending the message to %d users",
+	BroadcastDone:    "The message is sent to %d of %d users",
+
+	AccessPrivate:        "This bot is private, ask its admins to let you in",
+	AccessInviteOnly:     "This bot is private, ask its admins for an invite and send /start with the code",
+	AccessWrongInvite:    "The invite is wrong, used or expired, ask the admins for another one",
+	AccessInvited:        "The invite is accepted, welcome!",
+	AccessPolicy:         "Who may use the bot: %s",
+	AccessModeOpen:       "everyone",
+	AccessModeAllowlist:  "the users on the allowlist",
+	AccessModeInvite:     "the users on the allowlist and the ones with an invite",
+	AccessAllowlistTitle: "Allowlist:",
+	AccessAllowlistEmpty: "The allowlist is empty",
+	AccessFromConfig:     "%s (config)",
+	AccessHelp:           "Change who may use the bot with /access open, /access allowlist or /access invite. Add users with /allow 123456 or /allow @username and remove them with /disallow, create a code for a new user with /invite",
+	AccessModeUsage:      "The mode is open, allowlist or invite, e.g. /access invite",
+	AccessEntryUsage:     "Write the Telegram ID or the username after the command, e.g. %s @username",
+	AccessAllowed:        "%s may use the bot",
+	AccessDisallowed:     "%s is removed from the allowlist",
+	AccessNotAllowed:     "%s is not on the allowlist",
+	AccessInConfig:       "%s is allowed in the config, it can only be removed there",
+	AccessInvite:         "The invite works once until %s. The new user sends the bot:\n/start %s",
+	AccessInviteModeOff:  "Invites work only while the access is by invites, turn it on with /access invite",
+
+	StaleTitle: "Not contacted for over %d %s:",
+	NoStale:    "Everyone was contacted within %d %s",
+	StaleUsage: "Write the number of days after /stale, e.g. /stale 60",
+
+	SearchUsage:   "Write what to find after /search: words, the beginning of a word like pay* or a phrase in quotes like \"works on payments\"",
+	SearchNothing: "Nothing found",
+	SearchSnippet: "Found: %s",
+
+	DuplicatesTitle:      "Possible duplicates %d of %d: %s",
+	DuplicateSamePhone:   "the same phone",
+	DuplicateSameEmail:   "the same email",
+	DuplicateSimilarName: "similar names",
+	NoDuplicates:         "No possible duplicates found",
+	NoMoreDuplicates:     "That is all the possible duplicates",
+	MergedInto:           "Merged into the contact with ID %d:",
+	Merged:               "Merged",
+
+	CardID:                     "ID: %d",
+	CardName:                   "Name: %s",
+	CardEmail:                  "Email: %s",
+	CardPhone:                  "Phone: %s",
+	CardBirthday:               "Birthday: %s",
+	CardDescription:            "Description: %s",
+	CardCustomField:            "%s: %s",
+	CardEvent:                  "%s: %s (%s), %s",
+	CardLastContacted:          "Last contacted %d %s ago: %s",
+	CardLastContactedToday:     "Last contacted today: %s",
+	CardLastContactedYesterday: "Last contacted yesterday: %s",
+	CardBirthdayToday:          "Birthday is today!",
+	CardBirthdayTomorrow:       "Birthday is tomorrow",
+	CardBirthdayIn:             "Birthday in %d %s",
+	CardAgeToday:               "Age: %d, turns %d today!",
+	CardAgeTomorrow:            "Age: %d, turns %d tomorrow",
+	CardAgeIn:                  "Age: %d, turns %d in %d %s",
+
+	EnterName:        "Enter the name of your contact:",
+	EnterPhone:       "Enter the phone of your contact:",
+	EnterEmail:       "Enter the email of your contact, or '-' to remove it:",
+	WrongEmail:       "It does not look like an email. Write it like alice@example.com:",
+	EnterBirthday:    "Enter the birthday of your contact, e.g. 12.03 or 12.03.1990:",
+	EnterDescription: "Enter description of your contact:",
+	EnterPhoto:       "Send a photo of your contact, or '-' to remove it:",
+	WrongPhoto:       "It is not a photo. Send a photo, or '-' to remove it:",
+	Saved:            "Saved",
+	Deleted:          "Deleted",
+	LanguageChanged:  "The language is English now",
+	ButtonOutdated:   "This button is outdated, open the contact or the menu again",
+
+	SettingsTitle:        "Settings",
+	SettingsLanguage:     "Language: %s",
+	SettingsLanguageAuto: "%s, as in Telegram",
+	SettingsTimezone:     "Timezone: %s",
+	SettingsPhoneRegion:  "Default phone region: %s",
+	SettingsReminderTime: "Reminder time: %s",
+	SettingsSortOrder:    "Sort contacts %s",
+	SettingsCardFields:   "Lists show: %s",
+	SettingsStaleDays:    "Stale after %d %s without contact",
+	SettingsNotSet:       "not set",
+	SettingsOnlyName:     "only the name",
+
+	SortByName:     "by name",
+	SortByBirthday: "by upcoming birthday",
+	SortByAdded:    "by date added",
+
+	FieldEmail:       "email",
+	FieldPhone:       "phone",
+	FieldBirthday:    "birthday",
+	FieldDescription: "description",
+
+	EnterTimezone:     "Enter your timezone, e.g. Europe/Moscow or UTC+3:",
+	EnterPhoneRegion:  "Enter the two-letter code of your country, e.g. RU or US, or '-' to clear it:",
+	EnterReminderTime: "Enter the time to send reminders at, e.g. 09:00:",
+	WrongTimezone:     "I do not know this timezone. Write it like Europe/Moscow or UTC+3:",
+	WrongPhoneRegion:  "I do not know this country code. Write two letters, e.g. RU or US:",
+	WrongReminderTime: "I cannot recognize the time. Write it like 09:00 or 21:30:",
+	EnterStaleDays:    "Enter after how many days without contact /stale lists a contact, e.g. 30:",
+	WrongStaleDays:    "Write a number of days from 1 to 3650:",
+
+	ButtonChangeName:        "Change name",
+	ButtonChangePhone:       "Change phone",
+	ButtonChangeEmail:       "Change email",
+	ButtonChangeBirthday:    "Change birthday",
+	ButtonChangeDescription: "Change description",
+	ButtonChangePhoto:       "Change photo",
+	ButtonAddField:          "Add field",
+	ButtonLogInteraction:    "Log interaction",
+	ButtonRemind:            "Remind me",
+	ButtonAddDate:           "Add date",
+	ButtonCalendarFile:      "Send .ics file",
+	ButtonCalendarReset:     "New link",
+	ButtonSnooze:            "Snooze for an hour",
+	ButtonReminderDone:      "Done",
+	ButtonCancelReminder:    "Cancel %d",
+	ButtonAddWebhook:        "Add webhook",
+	ButtonRemoveWebhook:     "Remove %d",
+	ButtonDelete:            "Delete contact",
+	ButtonSave:              "Save",
+	ButtonLanguage:          "Language",
+	ButtonTimezone:          "Timezone",
+	ButtonPhoneRegion:       "Phone region",
+	ButtonReminderTime:      "Reminder time",
+	ButtonStaleDays:         "Stale after",
+	ButtonSortOrder:         "Sort: %s",
+	ButtonFieldShown:        "✓ %s",
+	ButtonFieldHidden:       "✗ %s",
+	ButtonClose:             "Close",
+	ButtonWizard:            "Step by step",
+	ButtonEdit:              "Edit",
+	ButtonConfirm:           "Confirm",
+	ButtonMergeInto:         "Merge into %d",
+	ButtonSkip:              "Skip",
+	ButtonNext:              "Next",
+	ButtonDeleteAccount:     "Delete everything",
+	ButtonKeepAccount:       "Keep my account",
+}
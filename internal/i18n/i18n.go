@@ -0,0 +1,114 @@
+// Package i18n is the message catalog of the bot.
+//
+// Every text shown to users has a key here and a translation for every supported language.
+// A missing translation falls back to English, so a new text may be added in English first.
+package i18n
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Lang is a supported language, identified by its ISO 639-1 code.
+type Lang string
+
+const (
+	English Lang = "en"
+	Russian Lang = "ru"
+
+	Default = English
+)
+
+// Languages are the supported languages in the order they are offered to users.
+var Languages = []Lang{English, Russian}
+
+var catalogs = map[Lang]map[string]string{
+	English: english,
+	Russian: russian,
+}
+
+// Parse returns the supported language for a language code like "ru" or "en-US",
+// as Telegram sends it. It is false for unsupported languages.
+func Parse(code string) (Lang, bool) {
+	code = strings.ToLower(code)
+	if i := strings.IndexAny(code, "-_"); i >= 0 {
+		code = code[:i]
+	}
+
+	lang := Lang(code)
+	if _, ok := catalogs[lang]; !ok {
+		return Default, false
+	}
+	return lang, true
+}
+
+// Name is the name of the language in the language itself.
+func (l Lang) Name() string {
+	return l.T(LanguageName)
+}
+
+// T returns the text for the key in the language, formatted with the args.
+func (l Lang) T(key string, args ...any) string {
+	text, ok := catalogs[l][key]
+	if !ok {
+		text, ok = catalogs[Default][key]
+	}
+	if !ok {
+		return key
+	}
+
+	if len(args) == 0 {
+		return text
+	}
+	return fmt.Sprintf(text, args...)
+}
+
+// Plural returns the form of the word for the number, e.g. "day" or "days".
+// The forms of a word are kept in the catalog separated by "|": one and other for English,
+// one, few and many for Russian.
+func (l Lang) Plural(key string, n int) string {
+	forms := strings.Split(l.T(key), "|")
+
+	var form int
+	switch l {
+	case Russian:
+		form = russianPluralForm(n)
+	default:
+		if n != 1 {
+			form = 1
+		}
+	}
+
+	if form >= len(forms) {
+		form = len(forms) - 1
+	}
+	return forms[form]
+}
+
+func russianPluralForm(n int) int {
+	if n < 0 {
+		n = -n
+	}
+
+	switch {
+	case n%10 == 1 && n%100 != 11:
+		return 0
+	case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+		return 1
+	}
+	return 2
+}
+
+// Date formats a day of a month, with the year when it is not 0, e.g. "12 March 1990".
+func (l Lang) Date(day int, month int, year int) string {
+	months := strings.Split(l.T(monthsOfDates), "|")
+	monthName := fmt.Sprint(month)
+	if month >= 1 && month <= len(months) {
+		monthName = months[month-1]
+	}
+
+	if year == 0 {
+		return fmt.Sprintf("%d %s", day, monthName)
+	}
+	return fmt.Sprintf("%d %s %d", day, monthName, year)
+}
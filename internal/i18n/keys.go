@@ -0,0 +1,332 @@
+package i18n
+
+// Keys of the catalog. The values are the keys themselves, so that a text missing
+// from every catalog shows up in the chat recognizably instead of an empty message.
+const (
+	LanguageName  = "language_name"
+	monthsOfDates = "months_of_dates"
+	Days          = "days"
+	Weeks         = "weeks"
+	Months        = "months"
+	Years         = "years"
+)
+
+// Replies to commands.
+const (
+	Start             = "start"
+	UnknownCommand    = "unknown_command"
+	AskSearchName     = "ask_search_name"
+	AskContactID      = "ask_contact_id"
+	WrongContactID    = "wrong_contact_id"
+	ContactNotFound   = "contact_not_found"
+	NoContacts        = "no_contacts"
+	WrongBirthday     = "wrong_birthday"
+	ChooseLanguage    = "choose_language"
+	NewContactName    = "new_contact_name"
+	ContactsSeparator = "contacts_separator"
+	Cancelled         = "cancelled"
+	NothingToCancel   = "nothing_to_cancel"
+
+	ConversationExpired = "conversation_expired"
+)
+
+// The flow adding a custom field to a contact.
+const (
+	EnterFieldName   = "enter_field_name"
+	WrongFieldName   = "wrong_field_name"
+	EnterFieldType   = "enter_field_type"
+	WrongFieldType   = "wrong_field_type"
+	EnterFieldValue  = "enter_field_value"
+	WrongFieldDate   = "wrong_field_date"
+	WrongFieldURL    = "wrong_field_url"
+	WrongFieldPhone  = "wrong_field_phone"
+	CustomFieldText  = "custom_field_text"
+	CustomFieldDate  = "custom_field_date"
+	CustomFieldURL   = "custom_field_url"
+	CustomFieldPhone = "custom_field_phone"
+)
+
+// The flow logging an interaction with a contact.
+const (
+	EnterInteractionKind = "enter_interaction_kind"
+	WrongInteractionKind = "wrong_interaction_kind"
+	EnterInteractionDate = "enter_interaction_date"
+	WrongInteractionDate = "wrong_interaction_date"
+	EnterInteractionNote = "enter_interaction_note"
+	InteractionCalled    = "interaction_called"
+	InteractionMet       = "interaction_met"
+	InteractionEmailed   = "interaction_emailed"
+	InteractionWithNote  = "interaction_with_note"
+)
+
+// Reminders about a contact and the /reminders command.
+const (
+	EnterReminderText = "enter_reminder_text"
+	EnterReminderDate = "enter_reminder_date"
+	WrongReminderDate = "wrong_reminder_date"
+	ReminderSet       = "reminder_set"
+	TooManyReminders  = "too_many_reminders"
+	ReminderDue       = "reminder_due"
+	ReminderSnoozed   = "reminder_snoozed"
+	ReminderDone      = "reminder_done"
+	ReminderCancelled = "reminder_cancelled"
+	RemindersTitle    = "reminders_title"
+	ReminderLine      = "reminder_line"
+	NoReminders       = "no_reminders"
+)
+
+// Dates of a contact, the /upcoming command and the daily reminder about them.
+const (
+	EnterEventName       = "enter_event_name"
+	WrongEventName       = "wrong_event_name"
+	EnterEventRecurrence = "enter_event_recurrence"
+	WrongEventRecurrence = "wrong_event_recurrence"
+	EnterEventDate       = "enter_event_date"
+	WrongEventDate       = "wrong_event_date"
+	EveryDay             = "every_day"
+	EveryWeek            = "every_week"
+	EveryMonth           = "every_month"
+	EveryYear            = "every_year"
+	EveryMany            = "every_many"
+	EventToday           = "event_today"
+	EventTomorrow        = "event_tomorrow"
+	EventIn              = "event_in"
+	UpcomingTitle        = "upcoming_title"
+	UpcomingLine         = "upcoming_line"
+	UpcomingBirthday     = "upcoming_birthday"
+	NoUpcoming           = "no_upcoming"
+	TodayTitle           = "today_title"
+)
+
+// The /calendar command and the calendars it gives.
+const (
+	CalendarName        = "calendar_name"
+	CalendarBirthday    = "calendar_birthday"
+	CalendarEvent       = "calendar_event"
+	CalendarLink        = "calendar_link"
+	CalendarNoLink      = "calendar_no_link"
+	CalendarLinkChanged = "calendar_link_changed"
+	CalendarFileCaption = "calendar_file_caption"
+)
+
+// The /mydata and /delete_account commands.
+const (
+	MyDataCaption        = "my_data_caption"
+	DeleteAccountConfirm = "delete_account_confirm"
+	DeleteAccountDone    = "delete_account_done"
+	DeleteAccountKept    = "delete_account_kept"
+)
+
+// The /carddav command.
+const (
+	CardDAVAccount     = "carddav_account"
+	CardDAVUnavailable = "carddav_unavailable"
+)
+
+// The /token command.
+const (
+	APIToken       = "api_token"
+	APIUnavailable = "api_unavailable"
+)
+
+// The /webhooks command.
+const (
+	WebhooksTitle   = "webhooks_title"
+	WebhookLine     = "webhook_line"
+	NoWebhooks      = "no_webhooks"
+	EnterWebhookURL = "enter_webhook_url"
+	WrongWebhookURL = "wrong_webhook_url"
+	WebhookAdded    = "webhook_added"
+	TooManyWebhooks = "too_many_webhooks"
+	WebhookRemoved  = "webhook_removed"
+)
+
+// The commands of the admins.
+const (
+	AdminStats       = "admin_stats"
+	AdminUser        = "admin_user"
+	AdminNoUser      = "admin_no_user"
+	AdminUserUsage   = "admin_user_usage"
+	AdminYes         = "admin_yes"
+	AdminNo          = "admin_no"
+	AdminNever       = "admin_never"
+	AdminBanned      = "admin_banned"
+	AdminUnbanned    = "admin_unbanned"
+	AdminCannotBan   = "admin_cannot_ban"
+	BroadcastUsage   = "broadcast_usage"
+	BroadcastRunning = "broadcast_running"
+	BroadcastStarted = "broadcast_started"
+	BroadcastDone    = "broadcast_done"
+)
+
+// Who may use the bot, and the commands of the admins changing it.
+const (
+	AccessPrivate        = "access_private"
+	AccessInviteOnly     = "access_invite_only"
+	AccessWrongInvite    = "access_wrong_invite"
+	AccessInvited        = "access_invited"
+	AccessPolicy         = "access_policy"
+	AccessModeOpen       = "access_mode_open"
+	AccessModeAllowlist  = "access_mode_allowlist"
+	AccessModeInvite     = "access_mode_invite"
+	AccessAllowlistTitle = "access_allowlist_title"
+	AccessAllowlistEmpty = "access_allowlist_empty"
+	AccessFromConfig     = "access_from_config"
+	AccessHelp           = "access_help"
+	AccessModeUsage      = "access_mode_usage"
+	AccessEntryUsage     = "access_entry_usage"
+	AccessAllowed        = "access_allowed"
+	AccessDisallowed     = "access_disallowed"
+	AccessNotAllowed     = "access_not_allowed"
+	AccessInConfig       = "access_in_config"
+	AccessInvite         = "access_invite"
+	AccessInviteModeOff  = "access_invite_mode_off"
+)
+
+// The /stale command.
+const (
+	StaleTitle = "stale_title"
+	NoStale    = "no_stale"
+	StaleUsage = "stale_usage"
+)
+
+// The /search command.
+const (
+	SearchUsage   = "search_usage"
+	SearchNothing = "search_nothing"
+	SearchSnippet = "search_snippet"
+)
+
+// The /duplicates command.
+const (
+	DuplicatesTitle      = "duplicates_title"
+	DuplicateSamePhone   = "duplicate_same_phone"
+	DuplicateSameEmail   = "duplicate_same_email"
+	DuplicateSimilarName = "duplicate_similar_name"
+	NoDuplicates         = "no_duplicates"
+	NoMoreDuplicates     = "no_more_duplicates"
+	MergedInto           = "merged_into"
+	Merged               = "merged"
+)
+
+// The step-by-step wizard adding a contact.
+const (
+	WizardStarted     = "wizard_started"
+	WizardName        = "wizard_name"
+	WizardPhone       = "wizard_phone"
+	WizardEmail       = "wizard_email"
+	WizardBirthday    = "wizard_birthday"
+	WizardDescription = "wizard_description"
+	WizardSummary     = "wizard_summary"
+	ChooseField       = "choose_field"
+)
+
+// Lines of a contact card.
+const (
+	CardID                     = "card_id"
+	CardName                   = "card_name"
+	CardEmail                  = "card_email"
+	CardPhone                  = "card_phone"
+	CardBirthday               = "card_birthday"
+	CardDescription            = "card_description"
+	CardCustomField            = "card_custom_field"
+	CardEvent                  = "card_event"
+	CardLastContacted          = "card_last_contacted"
+	CardLastContactedToday     = "card_last_contacted_today"
+	CardLastContactedYesterday = "card_last_contacted_yesterday"
+	CardBirthdayToday          = "card_birthday_today"
+	CardBirthdayTomorrow       = "card_birthday_tomorrow"
+	CardBirthdayIn             = "card_birthday_in"
+	CardAgeToday               = "card_age_today"
+	CardAgeTomorrow            = "card_age_tomorrow"
+	CardAgeIn                  = "card_age_in"
+)
+
+// Notifications shown when a button is pressed.
+const (
+	EnterName        = "enter_name"
+	EnterPhone       = "enter_phone"
+	EnterEmail       = "enter_email"
+	WrongEmail       = "wrong_email"
+	EnterBirthday    = "enter_birthday"
+	EnterDescription = "enter_description"
+	EnterPhoto       = "enter_photo"
+	WrongPhoto       = "wrong_photo"
+	Saved            = "saved"
+	Deleted          = "deleted"
+	LanguageChanged  = "language_changed"
+	ButtonOutdated   = "button_outdated"
+)
+
+// The /settings menu.
+const (
+	SettingsTitle        = "settings_title"
+	SettingsLanguage     = "settings_language"
+	SettingsLanguageAuto = "settings_language_auto"
+	SettingsTimezone     = "settings_timezone"
+	SettingsPhoneRegion  = "settings_phone_region"
+	SettingsReminderTime = "settings_reminder_time"
+	SettingsSortOrder    = "settings_sort_order"
+	SettingsCardFields   = "settings_card_fields"
+	SettingsStaleDays    = "settings_stale_days"
+	SettingsNotSet       = "settings_not_set"
+	SettingsOnlyName     = "settings_only_name"
+
+	SortByName     = "sort_by_name"
+	SortByBirthday = "sort_by_birthday"
+	SortByAdded    = "sort_by_added"
+
+	FieldEmail       = "field_email"
+	FieldPhone       = "field_phone"
+	FieldBirthday    = "field_birthday"
+	FieldDescription = "field_description"
+
+	EnterTimezone     = "enter_timezone"
+	EnterPhoneRegion  = "enter_phone_region"
+	EnterReminderTime = "enter_reminder_time"
+	WrongTimezone     = "wrong_timezone"
+	WrongPhoneRegion  = "wrong_phone_region"
+	WrongReminderTime = "wrong_reminder_time"
+	EnterStaleDays    = "enter_stale_days"
+	WrongStaleDays    = "wrong_stale_days"
+)
+
+// Labels of buttons.
+const (
+	ButtonChangeName        = "button_change_name"
+	ButtonChangePhone       = "button_change_phone"
+	ButtonChangeEmail       = "button_change_email"
+	ButtonChangeBirthday    = "button_change_birthday"
+	ButtonChangeDescription = "button_change_description"
+	ButtonChangePhoto       = "button_change_photo"
+	ButtonAddField          = "button_add_field"
+	ButtonLogInteraction    = "button_log_interaction"
+	ButtonRemind            = "button_remind"
+	ButtonAddDate           = "button_add_date"
+	ButtonCalendarFile      = "button_calendar_file"
+	ButtonCalendarReset     = "button_calendar_reset"
+	ButtonSnooze            = "button_snooze"
+	ButtonReminderDone      = "button_reminder_done"
+	ButtonCancelReminder    = "button_cancel_reminder"
+	ButtonAddWebhook        = "button_add_webhook"
+	ButtonRemoveWebhook     = "button_remove_webhook"
+	ButtonDelete            = "button_delete"
+	ButtonSave              = "button_save"
+	ButtonLanguage          = "button_language"
+	ButtonTimezone          = "button_timezone"
+	ButtonPhoneRegion       = "button_phone_region"
+	ButtonReminderTime      = "button_reminder_time"
+	ButtonStaleDays         = "button_stale_days"
+	ButtonSortOrder         = "button_sort_order"
+	ButtonFieldShown        = "button_field_shown"
+	ButtonFieldHidden       = "button_field_hidden"
+	ButtonClose             = "button_close"
+	ButtonWizard            = "button_wizard"
+	ButtonEdit              = "button_edit"
+	ButtonConfirm           = "button_confirm"
+	ButtonMergeInto         = "button_merge_into"
+	ButtonSkip              = "button_skip"
+	ButtonNext              = "button_next"
+	ButtonDeleteAccount     = "button_delete_account"
+	ButtonKeepAccount       = "button_keep_account"
+)
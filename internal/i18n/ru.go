@@ -0,0 +1,270 @@
+package i18n
+
+var russian = map[string]string{
+	LanguageName:  "Русский",
+	monthsOfDates: "января|февраля|марта|апреля|мая|июня|июля|августа|сентября|октября|ноября|декабря",
+	Days:          "день|дня|дней",
+	Weeks:         "неделя|недели|недель",
+	Months:        "месяц|месяца|месяцев",
+	Years:         "год|года|лет",
+
+	Start:             "Привет! Здесь можно хранить контакты людей :)",
+	UnknownCommand:    "Я не знаю такой команды",
+	AskSearchName:     "Напишите имя контакта:",
+	AskContactID:      "Напишите ID контакта, который хотите изменить:",
+	WrongContactID:    "ID контакта — это число, например 12. Напишите его ещё раз:",
+	ContactNotFound:   "Контакта с ID %d нет",
+	NoContacts:        "У вас пока нет сохранённых контактов!",
+	WrongBirthday:     "Не могу распознать дату. Напишите её как 12.03, 12.03.1990, 1990-03-12 или 12 March, или '-', чтобы удалить день рождения:",
+	ChooseLanguage:    "Выберите язык:",
+	NewContactName:    "Новый контакт",
+	ContactsSeparator: "-----------------------------",
+	Cancelled:         "Отменено, можно начать заново",
+	NothingToCancel:   "Нечего отменять",
+
+	ConversationExpired: "Вы долго не отвечали, и я перестал ждать ответа. Начните заново, когда будете готовы",
+
+	WizardStarted:     "Заполним контакт по шагам",
+	WizardName:        "Шаг 1 из 5. Введите имя контакта или '-', чтобы пропустить:",
+	WizardPhone:       "Шаг 2 из 5. Введите телефон или '-', чтобы пропустить:",
+	WizardEmail:       "Шаг 3 из 5. Введите email или '-', чтобы пропустить:",
+	WizardBirthday:    "Шаг 4 из 5. Введите день рождения, например 12.03 или 12.03.1990, или '-', чтобы пропустить:",
+	WizardDescription: "Шаг 5 из 5. Введите описание или '-', чтобы пропустить:",
+	WizardSummary:     "Проверьте новый контакт:",
+	ChooseField:       "Выберите, что изменить",
+
+	EnterFieldName:   "Введите название поля, например Компания, Сайт или Адрес:",
+	WrongFieldName:   "Название поля — одна строка до 32 символов. Введите его ещё раз:",
+	EnterFieldType:   "Что хранится в поле %s? Напишите %s:",
+	WrongFieldType:   "Я не знаю такого типа. Напишите %s:",
+	EnterFieldValue:  "Введите %s или '-', чтобы удалить поле:",
+	WrongFieldDate:   "Не могу распознать дату. Напишите её как 12.03.2024, 2024-03-12 или 12 марта:",
+	WrongFieldURL:    "Это не похоже на ссылку. Напишите её как example.com или https://example.com/page:",
+	WrongFieldPhone:  "Это не похоже на телефон. Напишите его цифрами, например +7 900 123-45-67:",
+	CustomFieldText:  "текст",
+	CustomFieldDate:  "дата",
+	CustomFieldURL:   "ссылка",
+	CustomFieldPhone: "телефон",
+
+	EnterInteractionKind: "Что было? Напишите %s:",
+	WrongInteractionKind: "Я не знаю такого. Напишите %s:",
+	EnterInteractionDate: "Когда это было? Введите дату, например 12.03 или 12.03.2024, или '-', если сегодня:",
+	WrongInteractionDate: "Не могу распознать дату, или она ещё не наступила. Напишите её как 12.03 или 12.03.2024, или '-', если сегодня:",
+	EnterInteractionNote: "Добавьте заметку или '-', чтобы пропустить:",
+	InteractionCalled:    "звонок",
+	InteractionMet:       "встреча",
+	InteractionEmailed:   "письмо",
+	InteractionWithNote:  "%s, %s",
+
+	EnterReminderText: "О чём напомнить? Например, позвонить насчёт предложения:",
+	EnterReminderDate: "Когда? Например, завтра, пятница 10:00, через 3 дня, через 2 часа или 25.12 18:00:",
+	WrongReminderDate: "Не могу распознать время, или оно уже прошло. Напишите его как завтра, пятница 10:00, через 3 дня, через 2 часа или 25.12 18:00:",
+	ReminderSet:       "Напомню %s",
+	TooManyReminders:  "У вас уже %d напоминаний, отмените одно в /reminders, чтобы добавить другое",
+	ReminderDue:       "Напоминание про %s: %s",
+	ReminderSnoozed:   "%s\nОтложено до %s",
+	ReminderDone:      "%s\nГотово",
+	ReminderCancelled: "Напоминание отменено",
+	RemindersTitle:    "Напоминания:",
+	ReminderLine:      "%d. %s, %s: %s",
+	NoReminders:       "Напоминаний нет. Нажмите «Напомнить» в карточке контакта, чтобы добавить",
+
+	EnterEventName:       "Введите название даты, например Годовщина свадьбы, Именины или Продление договора:",
+	WrongEventName:       "Название даты — одна строка до 32 символов. Введите его ещё раз:",
+	EnterEventRecurrence: "Как часто повторяется %s? Напишите, например, каждый год, каждые 6 месяцев или каждые 2 недели, или '-', если каждый год:",
+	WrongEventRecurrence: "Не могу распознать. Напишите, например, каждый год, каждые 6 месяцев или каждые 2 недели, или '-', если каждый год:",
+	EnterEventDate:       "Введите дату, например 12.06.2015 или 12 июня, или '-', чтобы удалить дату «%s»:",
+	WrongEventDate:       "Не могу распознать дату. Напишите её как 12.06.2015 или 2015-06-12, год можно не писать только для ежегодных дат, или '-', чтобы удалить дату:",
+	EveryDay:             "каждый день",
+	EveryWeek:            "каждую неделю",
+	EveryMonth:           "каждый месяц",
+	EveryYear:            "каждый год",
+	EveryMany:            "каждые %d %s",
+	EventToday:           "сегодня",
+	EventTomorrow:        "завтра",
+	EventIn:              "через %d %s",
+	UpcomingTitle:        "Ближайшие %d %s:",
+	UpcomingLine:         "%s, %s: %s, %s",
+	UpcomingBirthday:     "день рождения",
+	NoUpcoming:           "В ближайшие %d %s ничего нет",
+	TodayTitle:           "Сегодня:",
+
+	CalendarName:        "Дни рождения и даты",
+	CalendarBirthday:    "%s: день рождения",
+	CalendarEvent:       "%s: %s",
+	CalendarLink:        "Подпишитесь на эту ссылку в приложении календаря, чтобы видеть там дни рождения и другие даты контактов:\n%s\n\nНикому её не показывайте: по ссылке видны все даты. Ссылка показывается только сейчас. Отправьте /calendar ещё раз или нажмите «Новая ссылка», чтобы получить новую, старая тогда перестанет работать",
+	CalendarNoLink:      "Этот бот не даёт ссылок на календарь, но файл с днями рождения и другими датами можно импортировать в календарь",
+	CalendarLinkChanged: "Старая ссылка больше не работает",
+	CalendarFileCaption: "Откройте файл, чтобы импортировать даты в календарь. Он не обновляется, для этого подпишитесь на ссылку",
+
+	MyDataCaption:        "Всё, что бот хранит о вас. Секреты, например токен API, только отмечены как заданные",
+	DeleteAccountConfirm: "Удалить аккаунт? Все ваши контакты с полями, датами, взаимодействиями и напоминаниями, ваши настройки и вебхуки будут удалены навсегда, а ссылка на календарь, пароль CardDAV и токен API перестанут работать. Сначала сохраните копию данных командой /mydata",
+	DeleteAccountDone:    "Ваш аккаунт и все ваши данные удалены",
+	DeleteAccountKept:    "Ничего не удалено",
+
+	CardDAVAccount:     "Добавьте учётную запись CardDAV в настройках телефона или почтового приложения, чтобы контакты синхронизировались в обе стороны:\nСервер: %s\nИмя пользователя: %s\nПароль: %s\n\nПароль показывается только сейчас, удалите это сообщение, когда учётная запись заработает. Отправьте /carddav ещё раз, чтобы получить новый пароль, старый тогда перестанет работать",
+	CardDAVUnavailable: "У этого бота нет сервера CardDAV для синхронизации контактов",
+
+	APIToken:       "Ваш токен для REST API контактов по адресу %s:\n%s\n\nПередавайте его в заголовке Authorization как токен Bearer. API описано по адресу %s\n\nТокен показывается только сейчас и даёт полный доступ к вашим контактам, удалите это сообщение, когда сохраните его. Отправьте /token ещё раз, чтобы получить новый токен, старый тогда перестанет работать",
+	APIUnavailable: "У этого бота нет REST API",
+
+	WebhooksTitle:   "Ваши вебхуки, которым сообщается о добавлении, изменении и удалении контактов:",
+	WebhookLine:     "%d. %s",
+	NoWebhooks:      "У вас нет вебхуков. Добавьте вебхук, чтобы контакты отправлялись на URL каждый раз, когда их добавляют, изменяют или удаляют",
+	EnterWebhookURL: "Введите URL, на который отправлять изменения ваших контактов, например https://example.com/hooks/contacts:",
+	WrongWebhookURL: "Нужен URL с http или https без пароля. Введите его ещё раз:",
+	WebhookAdded:    "Вебхук %s добавлен. Каждое изменение контакта отправляется на него POST-запросом с JSON, подписанным в заголовке X-Webhook-Signature-256 с помощью HMAC-SHA256 тела с секретом:\n%s\n\nСекрет показывается только сейчас, храните его в надёжном месте. Отправка повторяется некоторое время, пока URL не ответит статусом 2xx",
+	TooManyWebhooks: "У вас уже %d вебхуков, удалите один, чтобы добавить другой",
+	WebhookRemoved:  "Вебхук удалён",
+
+	AdminStats:       "Пользователей: %d\nАктивных сегодня: %d\nЗаблокированных: %d\nКонтактов: %d",
+	AdminUser:        "Пользователь %d\nПоследняя активность: %s\nЯзык: %s\nКонтактов: %d\nНапоминаний: %d\nВебхуков: %d\nСсылка на календарь: %s\nCardDAV: %s\nТокен API: %s\nЗаблокирован: %s",
+	AdminNoUser:      "Нет пользователя %d",
+	AdminUserUsage:   "После команды напишите Telegram ID пользователя, например %s 123456",
+	AdminYes:         "да",
+	AdminNo:          "нет",
+	AdminNever:       "никогда",
+	AdminBanned:      "Пользователь %d заблокирован, бот игнорирует всё, что он отправляет",
+	AdminUnbanned:    "Пользователь %d разблокирован",
+	AdminCannotBan:   "Администраторов нельзя заблокировать",
+	BroadcastUsage:   "После /broadcast напишите сообщение, например /broadcast Сегодня ночью бот не будет работать",
+	BroadcastRunning: "Другое сообщение ещё рассылается всем, дождитесь окончания",
+	BroadcastStarted: "Сообщение рассылается %d пользователям",
+	BroadcastDone:    "Сообщение отправлено %d из %d пользователей",
+
+	AccessPrivate:        "Это закрытый бот, попросите его администраторов пустить вас",
+	AccessInviteOnly:     "Это закрытый бот, попросите у его администраторов приглашение и отправьте /start с кодом",
+	AccessWrongInvite:    "Приглашение неверное, использованное или просроченное, попросите у администраторов другое",
+	AccessInvited:        "Приглашение принято, добро пожаловать!",
+	AccessPolicy:         "Кто может пользоваться ботом: %s",
+	AccessModeOpen:       "все",
+	AccessModeAllowlist:  "пользователи из списка разрешённых",
+	AccessModeInvite:     "пользователи из списка разрешённых и с приглашением",
+	AccessAllowlistTitle: "Список разрешённых:",
+	AccessAllowlistEmpty: "Список разрешённых пуст",
+	AccessFromConfig:     "%s (конфиг)",
+	AccessHelp:           "Измените, кто может пользоваться ботом, с помощью /access open, /access allowlist или /access invite. Добавляйте пользователей командой /allow 123456 или /allow @username и удаляйте командой /disallow, создайте код для нового пользователя командой /invite",
+	AccessModeUsage:      "Режим — open, allowlist или invite, например /access invite",
+	AccessEntryUsage:     "После команды напишите Telegram ID или имя пользователя, например %s @username",
+	AccessAllowed:        "%s может пользоваться ботом",
+	AccessDisallowed:     "%s удалён из списка разрешённых",
+	AccessNotAllowed:     "%s нет в списке разрешённых",
+	AccessInConfig:       "%s разрешён в конфиге, удалить его можно только там",
+	AccessInvite:         "Приглашение действует один раз до %s. Новый пользователь отправляет боту:\n/start %s",
+	AccessInviteModeOff:  "Приглашения работают, только когда доступ по приглашениям, включите его командой /access invite",
+
+	StaleTitle: "Давно без контакта (порог: %d %s):",
+	NoStale:    "Все контакты свежие (порог: %d %s)",
+	StaleUsage: "После /stale напишите число дней, например /stale 60",
+
+	SearchUsage:   "Напишите, что найти, после /search: слова, начало слова как опл* или фразу в кавычках как \"работает в платежах\"",
+	SearchNothing: "Ничего не найдено",
+	SearchSnippet: "Найдено: %s",
+
+	DuplicatesTitle:      "Возможные дубликаты %d из %d: %s",
+	DuplicateSamePhone:   "одинаковый телефон",
+	DuplicateSameEmail:   "одинаковый email",
+	DuplicateSimilarName: "похожие имена",
+	NoDuplicates:         "Возможных дубликатов не найдено",
+	NoMoreDuplicates:     "Больше возможных дубликатов нет",
+	MergedInto:           "Объединено в контакт с ID %d:",
+	Merged:               "Объединено",
+
+	CardID:                     "ID: %d",
+	CardName:                   "Имя: %s",
+	CardEmail:                  "Email: %s",
+	CardPhone:                  "Телефон: %s",
+	CardBirthday:               "День рождения: %s",
+	CardDescription:            "Описание: %s",
+	CardCustomField:            "%s: %s",
+	CardEvent:                  "%s: %s (%s), %s",
+	CardLastContacted:          "Последний контакт %d %s назад: %s",
+	CardLastContactedToday:     "Последний контакт сегодня: %s",
+	CardLastContactedYesterday: "Последний контакт вчера: %s",
+	CardBirthdayToday:          "День рождения сегодня!",
+	CardBirthdayTomorrow:       "День рождения завтра",
+	CardBirthdayIn:             "День рождения через %d %s",
+	CardAgeToday:               "Возраст: %d, сегодня исполняется %d!",
+	CardAgeTomorrow:            "Возраст: %d, завтра исполнится %d",
+	CardAgeIn:                  "Возраст: %d, %d исполнится через %d %s",
+
+	EnterName:        "Введите имя контакта:",
+	EnterPhone:       "Введите телефон контакта:",
+	EnterEmail:       "Введите email контакта или '-', чтобы удалить его:",
+	WrongEmail:       "Это не похоже на email. Напишите его как alice@example.com:",
+	EnterBirthday:    "Введите день рождения контакта, например 12.03 или 12.03.1990:",
+	EnterDescription: "Введите описание контакта:",
+	EnterPhoto:       "Отправьте фото контакта или '-', чтобы удалить его:",
+	WrongPhoto:       "Это не фото. Отправьте фото или '-', чтобы удалить его:",
+	Saved:            "Сохранено",
+	Deleted:          "Удалено",
+	LanguageChanged:  "Теперь язык — русский",
+	ButtonOutdated:   "Эта кнопка устарела, откройте контакт или меню заново",
+
+	SettingsTitle:        "Настройки",
+	SettingsLanguage:     "Язык: %s",
+	SettingsLanguageAuto: "%s, как в Telegram",
+	SettingsTimezone:     "Часовой пояс: %s",
+	SettingsPhoneRegion:  "Страна телефонов: %s",
+	SettingsReminderTime: "Время напоминаний: %s",
+	SettingsSortOrder:    "Сортировать контакты %s",
+	SettingsCardFields:   "В списках видны: %s",
+	SettingsStaleDays:    "Давно без контакта: через %d %s",
+	SettingsNotSet:       "не задана",
+	SettingsOnlyName:     "только имя",
+
+	SortByName:     "по имени",
+	SortByBirthday: "по ближайшему дню рождения",
+	SortByAdded:    "по дате добавления",
+
+	FieldEmail:       "email",
+	FieldPhone:       "телефон",
+	FieldBirthday:    "день рождения",
+	FieldDescription: "описание",
+
+	EnterTimezone:     "Введите ваш часовой пояс, например Europe/Moscow или UTC+3:",
+	EnterPhoneRegion:  "Введите двухбуквенный код вашей страны, например RU или US, или '-', чтобы его убрать:",
+	EnterReminderTime: "Введите время, в которое присылать напоминания, например 09:00:",
+	WrongTimezone:     "Я не знаю такого часового пояса. Напишите его как Europe/Moscow или UTC+3:",
+	WrongPhoneRegion:  "Я не знаю такого кода страны. Напишите две буквы, например RU или US:",
+	WrongReminderTime: "Не могу распознать время. Напишите его как 09:00 или 21:30:",
+	EnterStaleDays:    "Через сколько дней без контакта показывать контакт в /stale? Например, 30:",
+	WrongStaleDays:    "Напишите число дней от 1 до 3650:",
+
+	ButtonChangeName:        "Изменить имя",
+	ButtonChangePhone:       "Изменить телефон",
+	ButtonChangeEmail:       "Изменить email",
+	ButtonChangeBirthday:    "Изменить день рождения",
+	ButtonChangeDescription: "Изменить описание",
+	ButtonChangePhoto:       "Изменить фото",
+	ButtonAddField:          "Добавить поле",
+	ButtonLogInteraction:    "Записать контакт",
+	ButtonRemind:            "Напомнить",
+	ButtonAddDate:           "Добавить дату",
+	ButtonCalendarFile:      "Прислать файл .ics",
+	ButtonCalendarReset:     "Новая ссылка",
+	ButtonSnooze:            "Отложить на час",
+	ButtonReminderDone:      "Готово",
+	ButtonCancelReminder:    "Отменить %d",
+	ButtonAddWebhook:        "Добавить вебхук",
+	ButtonRemoveWebhook:     "Удалить %d",
+	ButtonDelete:            "Удалить контакт",
+	ButtonSave:              "Сохранить",
+	ButtonLanguage:          "Язык",
+	ButtonTimezone:          "Часовой пояс",
+	ButtonPhoneRegion:       "Страна телефонов",
+	ButtonReminderTime:      "Время напоминаний",
+	ButtonStaleDays:         "Порог /stale",
+	ButtonSortOrder:         "Сортировка: %s",
+	ButtonFieldShown:        "✓ %s",
+	ButtonFieldHidden:       "✗ %s",
+	ButtonClose:             "Закрыть",
+	ButtonWizard:            "По шагам",
+	ButtonEdit:              "Изменить",
+	ButtonConfirm:           "Подтвердить",
+	ButtonMergeInto:         "Объединить в %d",
+	ButtonSkip:              "Пропустить",
+	ButtonNext:              "Дальше",
+	ButtonDeleteAccount:     "Удалить всё",
+	ButtonKeepAccount:       "Оставить аккаунт",
+}
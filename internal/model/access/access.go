@@ -0,0 +1,242 @@
+// Package access is who may use the bot: everyone, the users on the allowlist, or also the
+// ones registering with an invite code. The mode and the allowlist come from the config,
+// and the admins may change the mode and add to the allowlist in the chat.
+package access
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+	"github.com/profectus200/contact-book-bot/cmd/logging"
+	"github.com/profectus200/contact-book-bot/internal/i18n"
+	"github.com/profectus200/contact-book-bot/internal/types"
+	"go.uber.org/zap"
+)
+
+type messageSender interface {
+	SendMessage(ctx context.Context, text string, userID int64) error
+}
+
+type accessDB interface {
+	GetAccessMode(ctx context.Context) (types.AccessMode, error)
+	SetAccessMode(ctx context.Context, mode types.AccessMode) error
+	GetAllowlist(ctx context.Context) ([]types.AllowlistEntry, error)
+	IsAllowed(ctx context.Context, userID int64, username string) (bool, error)
+	Allow(ctx context.Context, entry types.AllowlistEntry, now time.Time) error
+	Disallow(ctx context.Context, entry types.AllowlistEntry) (bool, error)
+	AddInvite(ctx context.Context, invite types.Invite) error
+	UseInvite(ctx context.Context, code string, userID int64, now time.Time) (bool, error)
+}
+
+type usersDB interface {
+	GetUsername(ctx context.Context, userID int64) (string, error)
+}
+
+type txManager interface {
+	InTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type policyGetter interface {
+	Admins() []int64
+	AccessMode() string
+	AccessUsers() []int64
+	AccessUsernames() []string
+}
+
+type Model struct {
+	tgClient  messageSender
+	accessDB  accessDB
+	usersDB   usersDB
+	txManager txManager
+	admins    map[int64]bool
+	// mode is the mode from the config, used until the admins set another one.
+	mode types.AccessMode
+	// allowlist is the allowlist from the config, the admins cannot change it.
+	allowlist []types.AllowlistEntry
+	logger    *zap.Logger
+}
+
+// New reads the policy from the config, it fails on an unknown mode or a wrong username.
+func New(tgClient messageSender, accessDB accessDB, usersDB usersDB, txManager txManager, policy policyGetter,
+	logger *zap.Logger) (*Model, error) {
+	m := &Model{
+		tgClient:  tgClient,
+		accessDB:  accessDB,
+		usersDB:   usersDB,
+		txManager: txManager,
+		admins:    make(map[int64]bool, len(policy.Admins())),
+		mode:      types.AccessOpen,
+		logger:    logger.Named("access"),
+	}
+	for _, userID := range policy.Admins() {
+		m.admins[userID] = true
+	}
+
+	if policy.AccessMode() != "" {
+		mode, ok := types.ParseAccessMode(policy.AccessMode())
+		if !ok {
+			return nil, errors.Errorf("unknown access mode %q", policy.AccessMode())
+		}
+		m.mode = mode
+	}
+
+	for _, userID := range policy.AccessUsers() {
+		m.allowlist = append(m.allowlist, types.AllowlistEntry{UserID: userID})
+	}
+	for _, username := range policy.AccessUsernames() {
+		entry, ok := types.ParseAllowlistEntry(username)
+		if !ok || entry.Username == "" {
+			return nil, errors.Errorf("wrong username %q in the access allowlist", username)
+		}
+		m.allowlist = append(m.allowlist, entry)
+	}
+
+	return m, nil
+}
+
+// Admit tells whether the user of the update may use the bot. The users who may not are
+// told so in reply to their messages, and in the invite mode /start with a valid code
+// puts the user on the allowlist.
+func (m *Model) Admit(ctx context.Context, update types.Update) (bool, error) {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"Admit",
+	)
+	defer span.Finish()
+
+	var (
+		userID       int64
+		username     string
+		languageCode string
+	)
+	switch {
+	case update.Message != nil:
+		userID, username, languageCode = update.Message.UserID, update.Message.UserName, update.Message.LanguageCode
+	case update.Callback != nil:
+		userID, username, languageCode = update.Callback.UserID, update.Callback.UserName, update.Callback.LanguageCode
+	default:
+		return true, nil
+	}
+
+	allowed, mode, err := m.allows(ctx, userID, username)
+	if err != nil || allowed {
+		return allowed, err
+	}
+
+	m.log(ctx).Info("Access denied", zap.String("mode", string(mode)))
+	// The buttons are under the messages of the bot, a stranger has none of them.
+	if update.Message == nil {
+		return false, nil
+	}
+
+	// The language chosen with /language is not looked at: a stranger has not chosen any.
+	lang, _ := i18n.Parse(languageCode)
+	if mode == types.AccessInvite {
+		if command, code, _ := strings.Cut(update.Message.Text, " "); command == "/start" && strings.TrimSpace(code) != "" {
+			return m.register(ctx, userID, strings.TrimSpace(code), lang)
+		}
+		return false, m.tgClient.SendMessage(ctx, lang.T(i18n.AccessInviteOnly), userID)
+	}
+	return false, m.tgClient.SendMessage(ctx, lang.T(i18n.AccessPrivate), userID)
+}
+
+// AllowsUser tells whether the user may use the bot now, for the requests over HTTP signed
+// in with the credentials the user has got in the chat: the calendar feed, CardDAV and the
+// REST API. The allowlist is matched with the username the user has last written to the
+// bot with.
+func (m *Model) AllowsUser(ctx context.Context, userID int64) (bool, error) {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"AllowsUser",
+	)
+	defer span.Finish()
+
+	username, err := m.usersDB.GetUsername(ctx, userID)
+	if err != nil {
+		return false, errors.Wrap(err, "cannot GetUsername")
+	}
+
+	allowed, _, err := m.allows(ctx, userID, username)
+	return allowed, err
+}
+
+// allows tells whether the current mode, the admins or an allowlist let in the user.
+func (m *Model) allows(ctx context.Context, userID int64, username string) (bool, types.AccessMode, error) {
+	if m.admins[userID] {
+		return true, "", nil
+	}
+
+	mode, err := m.currentMode(ctx)
+	if err != nil {
+		return false, "", err
+	}
+	if mode == types.AccessOpen || m.inConfig(userID, username) {
+		return true, mode, nil
+	}
+
+	allowed, err := m.accessDB.IsAllowed(ctx, userID, username)
+	if err != nil {
+		return false, "", errors.Wrap(err, "cannot IsAllowed")
+	}
+	return allowed, mode, nil
+}
+
+// register uses the invite and puts the user on the allowlist. The /start with the code is
+// then handled as any other, so that the new user gets the greeting.
+func (m *Model) register(ctx context.Context, userID int64, code string, lang i18n.Lang) (bool, error) {
+	used := false
+	err := m.txManager.InTx(ctx, func(ctx context.Context) error {
+		now := time.Now()
+
+		var err error
+		used, err = m.accessDB.UseInvite(ctx, code, userID, now)
+		if err != nil {
+			return errors.Wrap(err, "cannot UseInvite")
+		}
+		if !used {
+			return nil
+		}
+
+		return errors.Wrap(m.accessDB.Allow(ctx, types.AllowlistEntry{UserID: userID}, now), "cannot Allow")
+	})
+	if err != nil {
+		return false, err
+	}
+
+	if !used {
+		m.log(ctx).Info("Wrong invite")
+		return false, m.tgClient.SendMessage(ctx, lang.T(i18n.AccessWrongInvite), userID)
+	}
+
+	m.log(ctx).Info("Invite used")
+	return true, m.tgClient.SendMessage(ctx, lang.T(i18n.AccessInvited), userID)
+}
+
+// currentMode is the mode set by the admins, or the one from the config.
+func (m *Model) currentMode(ctx context.Context) (types.AccessMode, error) {
+	mode, err := m.accessDB.GetAccessMode(ctx)
+	if err != nil {
+		return "", errors.Wrap(err, "cannot GetAccessMode")
+	}
+	if mode == "" {
+		return m.mode, nil
+	}
+	return mode, nil
+}
+
+// inConfig tells whether the user is on the allowlist from the config.
+func (m *Model) inConfig(userID int64, username string) bool {
+	for _, entry := range m.allowlist {
+		if entry.Matches(userID, username) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Model) log(ctx context.Context) *zap.Logger {
+	return logging.FromContext(ctx, m.logger)
+}
@@ -0,0 +1,160 @@
+package access
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+	"github.com/profectus200/contact-book-bot/internal/i18n"
+	"github.com/profectus200/contact-book-bot/internal/types"
+	"go.uber.org/zap"
+)
+
+// ShowAccess sends the admin the mode and the allowlist, or sets the mode in the argument.
+func (m *Model) ShowAccess(ctx context.Context, adminID int64, arg string, lang i18n.Lang) error {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"ShowAccess",
+	)
+	defer span.Finish()
+
+	if strings.TrimSpace(arg) != "" {
+		return m.setMode(ctx, adminID, arg, lang)
+	}
+
+	mode, err := m.currentMode(ctx)
+	if err != nil {
+		return err
+	}
+	allowlist, err := m.accessDB.GetAllowlist(ctx)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetAllowlist")
+	}
+
+	var sb strings.Builder
+	sb.WriteString(lang.T(i18n.AccessPolicy, modeName(mode, lang)))
+	sb.WriteString("\n\n")
+	if len(m.allowlist)+len(allowlist) == 0 {
+		sb.WriteString(lang.T(i18n.AccessAllowlistEmpty))
+	} else {
+		sb.WriteString(lang.T(i18n.AccessAllowlistTitle))
+		for _, entry := range m.allowlist {
+			sb.WriteString("\n" + lang.T(i18n.AccessFromConfig, entry.String()))
+		}
+		for _, entry := range allowlist {
+			sb.WriteString("\n" + entry.String())
+		}
+	}
+	sb.WriteString("\n\n")
+	sb.WriteString(lang.T(i18n.AccessHelp))
+
+	return m.tgClient.SendMessage(ctx, sb.String(), adminID)
+}
+
+func (m *Model) setMode(ctx context.Context, adminID int64, arg string, lang i18n.Lang) error {
+	mode, ok := types.ParseAccessMode(arg)
+	if !ok {
+		return m.tgClient.SendMessage(ctx, lang.T(i18n.AccessModeUsage), adminID)
+	}
+
+	if err := m.accessDB.SetAccessMode(ctx, mode); err != nil {
+		return errors.Wrap(err, "cannot SetAccessMode")
+	}
+	m.log(ctx).Info("Access mode changed", zap.String("mode", string(mode)))
+
+	return m.tgClient.SendMessage(ctx, lang.T(i18n.AccessPolicy, modeName(mode, lang)), adminID)
+}
+
+// Allow puts the user with the ID or the username in the argument on the allowlist.
+func (m *Model) Allow(ctx context.Context, adminID int64, arg string, lang i18n.Lang) error {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"Allow",
+	)
+	defer span.Finish()
+
+	entry, ok := types.ParseAllowlistEntry(arg)
+	if !ok {
+		return m.tgClient.SendMessage(ctx, lang.T(i18n.AccessEntryUsage, "/allow"), adminID)
+	}
+
+	if err := m.accessDB.Allow(ctx, entry, time.Now()); err != nil {
+		return errors.Wrap(err, "cannot Allow")
+	}
+	m.log(ctx).Info("User allowed", zap.Int64("target_user_id", entry.UserID))
+
+	return m.tgClient.SendMessage(ctx, lang.T(i18n.AccessAllowed, entry.String()), adminID)
+}
+
+// Disallow removes the user with the ID or the username in the argument from the allowlist.
+// The users allowed in the config stay allowed.
+func (m *Model) Disallow(ctx context.Context, adminID int64, arg string, lang i18n.Lang) error {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"Disallow",
+	)
+	defer span.Finish()
+
+	entry, ok := types.ParseAllowlistEntry(arg)
+	if !ok {
+		return m.tgClient.SendMessage(ctx, lang.T(i18n.AccessEntryUsage, "/disallow"), adminID)
+	}
+	for _, configEntry := range m.allowlist {
+		if configEntry == entry {
+			return m.tgClient.SendMessage(ctx, lang.T(i18n.AccessInConfig, entry.String()), adminID)
+		}
+	}
+
+	removed, err := m.accessDB.Disallow(ctx, entry)
+	if err != nil {
+		return errors.Wrap(err, "cannot Disallow")
+	}
+	if !removed {
+		return m.tgClient.SendMessage(ctx, lang.T(i18n.AccessNotAllowed, entry.String()), adminID)
+	}
+	m.log(ctx).Info("User disallowed", zap.Int64("target_user_id", entry.UserID))
+
+	return m.tgClient.SendMessage(ctx, lang.T(i18n.AccessDisallowed, entry.String()), adminID)
+}
+
+// Invite sends the admin a new invite code for a new user, see types.AccessInvite.
+func (m *Model) Invite(ctx context.Context, adminID int64, lang i18n.Lang) error {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"Invite",
+	)
+	defer span.Finish()
+
+	invite, err := types.NewInvite(adminID, time.Now())
+	if err != nil {
+		return errors.Wrap(err, "cannot NewInvite")
+	}
+	if err := m.accessDB.AddInvite(ctx, invite); err != nil {
+		return errors.Wrap(err, "cannot AddInvite")
+	}
+	m.log(ctx).Info("Invite created")
+
+	text := lang.T(i18n.AccessInvite, invite.ExpiresAt.UTC().Format("02.01.2006 15:04 UTC"), invite.Code)
+
+	mode, err := m.currentMode(ctx)
+	if err != nil {
+		return err
+	}
+	if mode != types.AccessInvite {
+		text += "\n\n" + lang.T(i18n.AccessInviteModeOff)
+	}
+
+	return m.tgClient.SendMessage(ctx, text, adminID)
+}
+
+func modeName(mode types.AccessMode, lang i18n.Lang) string {
+	switch mode {
+	case types.AccessAllowlist:
+		return lang.T(i18n.AccessModeAllowlist)
+	case types.AccessInvite:
+		return lang.T(i18n.AccessModeInvite)
+	}
+	return lang.T(i18n.AccessModeOpen)
+}
@@ -0,0 +1,217 @@
+// Package account gives the users everything the bot keeps about them, and deletes it all
+// when they leave.
+package account
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+	"github.com/profectus200/contact-book-bot/cmd/logging"
+	"github.com/profectus200/contact-book-bot/internal/i18n"
+	"github.com/profectus200/contact-book-bot/internal/types"
+	"go.uber.org/zap"
+)
+
+// FileName is the name of the file /mydata sends.
+const FileName = "mydata.json"
+
+type messageSender interface {
+	SendDocument(ctx context.Context, name string, data []byte, caption string, userID int64) error
+	SendDeleteAccount(ctx context.Context, text string, userID int64, lang i18n.Lang) error
+	EditMessage(ctx context.Context, text string, userID int64, messageID int) error
+}
+
+type contactsDB interface {
+	GetAllContacts(ctx context.Context, userID int64) ([]*types.Contact, error)
+	GetInteractions(ctx context.Context, userID int64, contactID int) ([]types.Interaction, error)
+	GetReminders(ctx context.Context, userID int64) ([]types.Reminder, error)
+	GetCardResources(ctx context.Context, userID int64) ([]types.CardResource, error)
+}
+
+type usersDB interface {
+	LockUser(ctx context.Context, userID int64) error
+	GetUserInfo(ctx context.Context, userID int64) (*types.UserInfo, error)
+	DeleteUser(ctx context.Context, userID int64) error
+}
+
+type settingsDB interface {
+	GetSettings(ctx context.Context, userID int64) (types.Settings, error)
+}
+
+type webhooksDB interface {
+	GetWebhooks(ctx context.Context, userID int64) ([]types.Webhook, error)
+}
+
+type accessDB interface {
+	IsAllowed(ctx context.Context, userID int64, username string) (bool, error)
+	ForgetInvites(ctx context.Context, userID int64) error
+}
+
+type txManager interface {
+	InTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type Model struct {
+	tgClient   messageSender
+	contactsDB contactsDB
+	usersDB    usersDB
+	settingsDB settingsDB
+	webhooksDB webhooksDB
+	accessDB   accessDB
+	txManager  txManager
+	logger     *zap.Logger
+}
+
+func New(tgClient messageSender, contactsDB contactsDB, usersDB usersDB, settingsDB settingsDB,
+	webhooksDB webhooksDB, accessDB accessDB, txManager txManager, logger *zap.Logger) *Model {
+	return &Model{
+		tgClient:   tgClient,
+		contactsDB: contactsDB,
+		usersDB:    usersDB,
+		settingsDB: settingsDB,
+		webhooksDB: webhooksDB,
+		accessDB:   accessDB,
+		txManager:  txManager,
+		logger:     logger.Named("account"),
+	}
+}
+
+// ExportData sends the user a JSON file with everything the bot keeps about the user.
+func (m *Model) ExportData(ctx context.Context, userID int64, lang i18n.Lang) error {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"ExportData",
+	)
+	defer span.Finish()
+
+	// The user is locked, so that no change comes in between the reads.
+	var data types.UserData
+	err := m.txManager.InTx(ctx, func(ctx context.Context) error {
+		err := m.usersDB.LockUser(ctx, userID)
+		if err != nil {
+			return errors.Wrap(err, "cannot LockUser")
+		}
+
+		data, err = m.userData(ctx, userID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	file, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "cannot MarshalIndent")
+	}
+	m.log(ctx).Info("Data exported", zap.Int("contacts", len(data.Contacts)))
+
+	return m.tgClient.SendDocument(ctx, FileName, file, lang.T(i18n.MyDataCaption), userID)
+}
+
+// userData reads the records of the user. It must be called in a transaction with the user
+// locked, so that the records are of the same moment.
+func (m *Model) userData(ctx context.Context, userID int64) (types.UserData, error) {
+	info, err := m.usersDB.GetUserInfo(ctx, userID)
+	if err != nil {
+		return types.UserData{}, errors.Wrap(err, "cannot GetUserInfo")
+	}
+	if info == nil {
+		info = &types.UserInfo{UserID: userID}
+	}
+	allowlisted, err := m.accessDB.IsAllowed(ctx, userID, "")
+	if err != nil {
+		return types.UserData{}, errors.Wrap(err, "cannot IsAllowed")
+	}
+	settings, err := m.settingsDB.GetSettings(ctx, userID)
+	if err != nil {
+		return types.UserData{}, errors.Wrap(err, "cannot GetSettings")
+	}
+
+	contacts, err := m.contactsDB.GetAllContacts(ctx, userID)
+	if err != nil {
+		return types.UserData{}, errors.Wrap(err, "cannot GetAllContacts")
+	}
+	interactions := make(map[int][]types.Interaction, len(contacts))
+	for _, contact := range contacts {
+		log, err := m.contactsDB.GetInteractions(ctx, userID, contact.ContactID)
+		if err != nil {
+			return types.UserData{}, errors.Wrap(err, "cannot GetInteractions")
+		}
+		interactions[contact.ContactID] = log
+	}
+	resources, err := m.contactsDB.GetCardResources(ctx, userID)
+	if err != nil {
+		return types.UserData{}, errors.Wrap(err, "cannot GetCardResources")
+	}
+	reminders, err := m.contactsDB.GetReminders(ctx, userID)
+	if err != nil {
+		return types.UserData{}, errors.Wrap(err, "cannot GetReminders")
+	}
+	webhooks, err := m.webhooksDB.GetWebhooks(ctx, userID)
+	if err != nil {
+		return types.UserData{}, errors.Wrap(err, "cannot GetWebhooks")
+	}
+
+	return types.NewUserData(*info, allowlisted, settings, contacts, interactions, resources, reminders, webhooks, time.Now()), nil
+}
+
+// AskDelete asks the user whether to delete the account, the buttons under the question
+// delete it or keep it.
+func (m *Model) AskDelete(ctx context.Context, userID int64, lang i18n.Lang) error {
+	span, _ := opentracing.StartSpanFromContext(
+		ctx,
+		"AskDelete",
+	)
+	defer span.Finish()
+
+	return m.tgClient.SendDeleteAccount(ctx, lang.T(i18n.DeleteAccountConfirm), userID, lang)
+}
+
+// DeleteAccount deletes everything the bot keeps about the user in one go and replaces
+// the question with the answer. A new message of the user starts the bot anew. The user
+// stays on the allowlist, which is for the admins to change.
+func (m *Model) DeleteAccount(ctx context.Context, userID int64, messageID int, lang i18n.Lang) error {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"DeleteAccount",
+	)
+	defer span.Finish()
+
+	err := m.txManager.InTx(ctx, func(ctx context.Context) error {
+		err := m.usersDB.LockUser(ctx, userID)
+		if err != nil {
+			return errors.Wrap(err, "cannot LockUser")
+		}
+
+		err = m.usersDB.DeleteUser(ctx, userID)
+		if err != nil {
+			return errors.Wrap(err, "cannot DeleteUser")
+		}
+
+		return errors.Wrap(m.accessDB.ForgetInvites(ctx, userID), "cannot ForgetInvites")
+	})
+	if err != nil {
+		return err
+	}
+	m.log(ctx).Info("Account deleted")
+
+	return m.tgClient.EditMessage(ctx, lang.T(i18n.DeleteAccountDone), userID, messageID)
+}
+
+// KeepAccount replaces the question with the answer that nothing is deleted.
+func (m *Model) KeepAccount(ctx context.Context, userID int64, messageID int, lang i18n.Lang) error {
+	span, _ := opentracing.StartSpanFromContext(
+		ctx,
+		"KeepAccount",
+	)
+	defer span.Finish()
+
+	return m.tgClient.EditMessage(ctx, lang.T(i18n.DeleteAccountKept), userID, messageID)
+}
+
+func (m *Model) log(ctx context.Context) *zap.Logger {
+	return logging.FromContext(ctx, m.logger)
+}
@@ -0,0 +1,146 @@
+// Package admin is the commands of the operators of the bot: the statistics of the usage,
+// the lookup of a user, the bans and the messages to all the users. Only the users listed
+// as admins in the config may use them, the others do not know the commands exist.
+package admin
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+	"github.com/profectus200/contact-book-bot/cmd/logging"
+	"github.com/profectus200/contact-book-bot/internal/i18n"
+	"github.com/profectus200/contact-book-bot/internal/types"
+	"go.uber.org/zap"
+)
+
+type messageSender interface {
+	SendMessage(ctx context.Context, text string, userID int64) error
+	SendMessageOnce(ctx context.Context, key string, text string, userID int64) error
+}
+
+type usersDB interface {
+	SetBanned(ctx context.Context, userID int64, banned bool) error
+	GetUserIDs(ctx context.Context) ([]int64, error)
+	GetStats(ctx context.Context, activeSince time.Time) (types.Stats, error)
+	GetUserInfo(ctx context.Context, userID int64) (*types.UserInfo, error)
+}
+
+type Model struct {
+	tgClient messageSender
+	usersDB  usersDB
+	admins   map[int64]bool
+	// interval is the pause between the messages of a broadcast.
+	interval time.Duration
+
+	// mu guards broadcasting, a single broadcast is sent at a time.
+	mu           sync.Mutex
+	broadcasting bool
+	broadcasts   sync.WaitGroup
+
+	logger *zap.Logger
+}
+
+func New(tgClient messageSender, usersDB usersDB, admins []int64, interval time.Duration, logger *zap.Logger) *Model {
+	m := &Model{
+		tgClient: tgClient,
+		usersDB:  usersDB,
+		admins:   make(map[int64]bool, len(admins)),
+		interval: interval,
+		logger:   logger.Named("admin"),
+	}
+	for _, userID := range admins {
+		m.admins[userID] = true
+	}
+	return m
+}
+
+// IsAdmin tells whether the user may use the commands of the admins.
+func (m *Model) IsAdmin(userID int64) bool {
+	return m.admins[userID]
+}
+
+// ShowStats sends the admin the numbers of the users and the contacts. The users active
+// today are the ones seen since the start of the day in UTC.
+func (m *Model) ShowStats(ctx context.Context, adminID int64, lang i18n.Lang) error {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"ShowStats",
+	)
+	defer span.Finish()
+
+	now := time.Now().UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	stats, err := m.usersDB.GetStats(ctx, today)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetStats")
+	}
+	return m.tgClient.SendMessage(ctx, stats.ToString(lang), adminID)
+}
+
+// ShowUser sends the admin what there is of the user with the ID in the argument.
+func (m *Model) ShowUser(ctx context.Context, adminID int64, arg string, lang i18n.Lang) error {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"ShowUser",
+	)
+	defer span.Finish()
+
+	userID, err := strconv.ParseInt(strings.TrimSpace(arg), 10, 64)
+	if err != nil {
+		return m.tgClient.SendMessage(ctx, lang.T(i18n.AdminUserUsage, "/user"), adminID)
+	}
+
+	info, err := m.usersDB.GetUserInfo(ctx, userID)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetUserInfo")
+	}
+	if info == nil {
+		return m.tgClient.SendMessage(ctx, lang.T(i18n.AdminNoUser, userID), adminID)
+	}
+	m.log(ctx).Info("User looked up", zap.Int64("target_user_id", userID))
+
+	return m.tgClient.SendMessage(ctx, info.ToString(lang), adminID)
+}
+
+// SetBanned bans or unbans the user with the ID in the argument. The bot ignores the
+// updates of the banned users, the admins cannot be banned.
+func (m *Model) SetBanned(ctx context.Context, adminID int64, arg string, banned bool, lang i18n.Lang) error {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"SetBanned",
+	)
+	span.SetTag("banned", banned)
+	defer span.Finish()
+
+	userID, err := strconv.ParseInt(strings.TrimSpace(arg), 10, 64)
+	if err != nil {
+		command := "/unban"
+		if banned {
+			command = "/ban"
+		}
+		return m.tgClient.SendMessage(ctx, lang.T(i18n.AdminUserUsage, command), adminID)
+	}
+	if banned && m.IsAdmin(userID) {
+		return m.tgClient.SendMessage(ctx, lang.T(i18n.AdminCannotBan), adminID)
+	}
+
+	if err := m.usersDB.SetBanned(ctx, userID, banned); err != nil {
+		return errors.Wrap(err, "cannot SetBanned")
+	}
+	m.log(ctx).Info("User ban changed", zap.Int64("target_user_id", userID), zap.Bool("banned", banned))
+
+	if banned {
+		return m.tgClient.SendMessage(ctx, lang.T(i18n.AdminBanned, userID), adminID)
+	}
+	return m.tgClient.SendMessage(ctx, lang.T(i18n.AdminUnbanned, userID), adminID)
+}
+
+func (m *Model) log(ctx context.Context) *zap.Logger {
+	return logging.FromContext(ctx, m.logger)
+}
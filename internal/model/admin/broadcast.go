@@ -0,0 +1,102 @@
+package admin
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+	"github.com/profectus200/contact-book-bot/cmd/logging"
+	"github.com/profectus200/contact-book-bot/internal/i18n"
+	"go.uber.org/zap"
+)
+
+// BroadcastInterval is the pause between the messages of a broadcast: a third of the rate
+// the Bot API allows, so that the answers to the users are not held up meanwhile.
+const BroadcastInterval = 100 * time.Millisecond
+
+// Broadcast starts sending the text to every user who is not banned and tells the admin
+// how many got it when it is done. The messages are sent in the background, one every
+// interval, and a single broadcast is sent at a time.
+func (m *Model) Broadcast(ctx context.Context, adminID int64, messageID int, text string, lang i18n.Lang) error {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"Broadcast",
+	)
+	defer span.Finish()
+
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return m.tgClient.SendMessage(ctx, lang.T(i18n.BroadcastUsage), adminID)
+	}
+
+	m.mu.Lock()
+	running := m.broadcasting
+	m.broadcasting = true
+	m.mu.Unlock()
+	if running {
+		return m.tgClient.SendMessage(ctx, lang.T(i18n.BroadcastRunning), adminID)
+	}
+
+	userIDs, err := m.usersDB.GetUserIDs(ctx)
+	if err != nil {
+		m.finishBroadcast()
+		return errors.Wrap(err, "cannot GetUserIDs")
+	}
+	m.log(ctx).Info("Broadcast started", zap.Int("users", len(userIDs)))
+
+	if err := m.tgClient.SendMessage(ctx, lang.T(i18n.BroadcastStarted, len(userIDs)), adminID); err != nil {
+		m.finishBroadcast()
+		return err
+	}
+
+	// The broadcast outlives the update, so it is not cancelled with it.
+	broadcastCtx := logging.WithLogger(context.Background(), m.log(ctx))
+	// The key is the same when the update of the command is handled again.
+	key := fmt.Sprintf("broadcast:%d:%d", adminID, messageID)
+
+	m.broadcasts.Add(1)
+	go func() {
+		defer m.broadcasts.Done()
+		defer m.finishBroadcast()
+		m.broadcast(broadcastCtx, adminID, key, text, userIDs, lang)
+	}()
+	return nil
+}
+
+// broadcast sends the text to the users one every interval and reports to the admin.
+func (m *Model) broadcast(ctx context.Context, adminID int64, key, text string, userIDs []int64, lang i18n.Lang) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	sent := 0
+	for i, userID := range userIDs {
+		if i > 0 {
+			<-ticker.C
+		}
+		// The users who have blocked the bot cannot be sent anything, that is expected.
+		if err := m.tgClient.SendMessageOnce(ctx, fmt.Sprintf("%s:%d", key, userID), text, userID); err != nil {
+			m.log(ctx).Debug("Cannot send broadcast", zap.Int64("target_user_id", userID), zap.Error(err))
+			continue
+		}
+		sent++
+	}
+	m.log(ctx).Info("Broadcast sent", zap.Int("sent", sent), zap.Int("users", len(userIDs)))
+
+	if err := m.tgClient.SendMessage(ctx, lang.T(i18n.BroadcastDone, sent, len(userIDs)), adminID); err != nil {
+		m.log(ctx).Error("Cannot report broadcast", zap.Error(err))
+	}
+}
+
+func (m *Model) finishBroadcast() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.broadcasting = false
+}
+
+// Wait waits until the broadcast being sent is done.
+func (m *Model) Wait() {
+	m.broadcasts.Wait()
+}
@@ -0,0 +1,316 @@
+// Package api is the JSON REST API of the contacts, for the tools of the users. The users
+// sign in with a token given by the /token command, sent as a Bearer token, and every user
+// and every address of the clients have a limited rate of requests. The API is described
+// by the OpenAPI spec it serves.
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+	"github.com/profectus200/contact-book-bot/cmd/logging"
+	"github.com/profectus200/contact-book-bot/internal/i18n"
+	"github.com/profectus200/contact-book-bot/internal/types"
+	"go.uber.org/zap"
+)
+
+const (
+	// PathPrefix is the path of the API on the HTTP server, with the version.
+	PathPrefix = "/api/v1/"
+	// SpecPath is the path of the OpenAPI spec after PathPrefix.
+	SpecPath = "openapi.yaml"
+
+	contactsPath = "contacts"
+	// tokenLength is the number of random bytes in a token, which is longer in base64.
+	tokenLength = 32
+	// maxBodySize limits the bodies of the requests.
+	maxBodySize = 64 << 10
+)
+
+//go:embed openapi.yaml
+var spec []byte
+
+type messageSender interface {
+	SendMessage(ctx context.Context, text string, userID int64) error
+}
+
+type contactsDB interface {
+	WriteContact(ctx context.Context, userID int64, contact *types.Contact) error
+	GetContact(ctx context.Context, userID int64, contactID int) (*types.Contact, error)
+	GetAllContacts(ctx context.Context, userID int64) ([]*types.Contact, error)
+	DeleteContact(ctx context.Context, userID int64, contactID int) error
+	WriteName(ctx context.Context, name string, userID int64, contactID int) error
+	WriteEmail(ctx context.Context, email string, userID int64, contactID int) error
+	WritePhone(ctx context.Context, phone string, userID int64, contactID int) error
+	WriteBirthday(ctx context.Context, birthday *types.Birthday, userID int64, contactID int) error
+	WriteDescription(ctx context.Context, description string, userID int64, contactID int) error
+}
+
+type usersDB interface {
+	LockUser(ctx context.Context, userID int64) error
+	ToWaitState(ctx context.Context, userID int64) error
+	SetAPIToken(ctx context.Context, userID int64, hash string) error
+	UserByAPIToken(ctx context.Context, hash string) (int64, bool, error)
+	NextExternalContactID(ctx context.Context, userID int64) (int, error)
+}
+
+type txManager interface {
+	InTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type accessChecker interface {
+	AllowsUser(ctx context.Context, userID int64) (bool, error)
+}
+
+type Model struct {
+	tgClient   messageSender
+	contactsDB contactsDB
+	usersDB    usersDB
+	txManager  txManager
+	access     accessChecker
+	limiter    *limiter
+	// addrLimiter limits the requests by the addresses of the clients, before the tokens
+	// are checked.
+	addrLimiter *limiter
+	// publicURL is where the HTTP server is reachable by the tools,
+	// empty when the bot serves no API.
+	publicURL string
+	logger    *zap.Logger
+}
+
+func New(tgClient messageSender, contactsDB contactsDB, usersDB usersDB, txManager txManager,
+	access accessChecker, publicURL string, logger *zap.Logger) *Model {
+	return &Model{
+		tgClient:    tgClient,
+		contactsDB:  contactsDB,
+		usersDB:     usersDB,
+		txManager:   txManager,
+		access:      access,
+		limiter:     newLimiter(requestsPerMinute, burst),
+		addrLimiter: newLimiter(addrRequestsPerMinute, addrBurst),
+		publicURL:   strings.TrimSuffix(publicURL, "/"),
+		logger:      logger.Named("api"),
+	}
+}
+
+// IssueToken gives the user a new token of the API, the old token stops working.
+func (m *Model) IssueToken(ctx context.Context, userID int64, lang i18n.Lang) error {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"IssueAPIToken",
+	)
+	defer span.Finish()
+
+	if m.publicURL == "" {
+		return m.tgClient.SendMessage(ctx, lang.T(i18n.APIUnavailable), userID)
+	}
+
+	secret := make([]byte, tokenLength)
+	if _, err := rand.Read(secret); err != nil {
+		return errors.Wrap(err, "cannot read random bytes")
+	}
+	token := base64.RawURLEncoding.EncodeToString(secret)
+
+	if err := m.usersDB.SetAPIToken(ctx, userID, hashToken(token)); err != nil {
+		return errors.Wrap(err, "cannot SetAPIToken")
+	}
+	m.log(ctx).Info("API token issued")
+
+	text := lang.T(i18n.APIToken, m.publicURL+PathPrefix, token, m.publicURL+PathPrefix+SpecPath)
+	return m.tgClient.SendMessage(ctx, text, userID)
+}
+
+// hashToken is what is kept of a token. The tokens are random and long, so a plain hash
+// is enough to keep a leaked database from giving them away.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// ServeHTTP serves the spec to anyone and the contacts to the users signed in with a token.
+func (m *Model) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	span, ctx := opentracing.StartSpanFromContext(
+		r.Context(),
+		"ServeAPI",
+	)
+	span.SetTag("method", r.Method)
+	defer span.Finish()
+
+	path := strings.TrimPrefix(r.URL.Path, PathPrefix)
+	if path == SpecPath {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			m.fail(ctx, w, errMethodNotAllowed(http.MethodGet, http.MethodHead))
+			return
+		}
+		w.Header().Set("Content-Type", "application/yaml")
+		_, _ = w.Write(spec)
+		return
+	}
+
+	addr := clientAddr(r)
+	if allowed, wait := m.addrLimiter.allow(addr, time.Now()); !allowed {
+		m.tooManyRequests(ctx, w, wait)
+		return
+	}
+
+	userID, ok, err := m.authenticate(ctx, r)
+	if err != nil {
+		m.fail(ctx, w, errors.Wrap(err, "cannot authenticate"))
+		return
+	}
+	if !ok {
+		m.addrLimiter.spend(addr, failedAuthCost, time.Now())
+		w.Header().Set("WWW-Authenticate", `Bearer realm="contacts"`)
+		m.fail(ctx, w, &apiError{status: http.StatusUnauthorized, message: "missing or invalid token"})
+		return
+	}
+	ctx = logging.WithLogger(ctx, m.logger.With(zap.Int64("user_id", userID)))
+
+	if allowed, wait := m.limiter.allow(userKey(userID), time.Now()); !allowed {
+		m.tooManyRequests(ctx, w, wait)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+
+	segments := strings.Split(strings.TrimSuffix(path, "/"), "/")
+	switch {
+	case len(segments) == 1 && segments[0] == contactsPath:
+		err = m.serveContacts(ctx, w, r, userID)
+	case len(segments) == 2 && segments[0] == contactsPath:
+		contactID, parseErr := strconv.Atoi(segments[1])
+		if parseErr != nil {
+			err = &apiError{status: http.StatusNotFound, message: "no such contact"}
+			break
+		}
+		err = m.serveContact(ctx, w, r, userID, contactID)
+	default:
+		err = &apiError{status: http.StatusNotFound, message: "no such resource"}
+	}
+	if err != nil {
+		m.fail(ctx, w, err)
+	}
+}
+
+// clientAddr is the IP address of the client without the port. Behind a reverse proxy it is
+// the address of the proxy, so all the clients share its limit.
+func clientAddr(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func (m *Model) tooManyRequests(ctx context.Context, w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	m.fail(ctx, w, &apiError{status: http.StatusTooManyRequests, message: "too many requests"})
+}
+
+// authenticate checks the Bearer token. It is false when the token is missing or wrong,
+// and errForbidden when the user may not use the bot.
+func (m *Model) authenticate(ctx context.Context, r *http.Request) (int64, bool, error) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || strings.TrimSpace(token) == "" {
+		return 0, false, nil
+	}
+
+	userID, ok, err := m.usersDB.UserByAPIToken(ctx, hashToken(strings.TrimSpace(token)))
+	if err != nil {
+		return 0, false, errors.Wrap(err, "cannot UserByAPIToken")
+	}
+	if !ok {
+		return 0, false, nil
+	}
+
+	allowed, err := m.access.AllowsUser(ctx, userID)
+	if err != nil {
+		return 0, false, errors.Wrap(err, "cannot AllowsUser")
+	}
+	if !allowed {
+		return 0, false, errForbidden
+	}
+	return userID, true, nil
+}
+
+func (m *Model) serveContacts(ctx context.Context, w http.ResponseWriter, r *http.Request, userID int64) error {
+	switch r.Method {
+	case http.MethodGet:
+		return m.listContacts(ctx, w, r, userID)
+	case http.MethodPost:
+		return m.createContact(ctx, w, r, userID)
+	}
+	return errMethodNotAllowed(http.MethodGet, http.MethodPost)
+}
+
+func (m *Model) serveContact(ctx context.Context, w http.ResponseWriter, r *http.Request, userID int64, contactID int) error {
+	switch r.Method {
+	case http.MethodGet:
+		return m.getContact(ctx, w, userID, contactID)
+	case http.MethodPatch:
+		return m.patchContact(ctx, w, r, userID, contactID)
+	case http.MethodDelete:
+		return m.deleteContact(ctx, w, userID, contactID)
+	}
+	return errMethodNotAllowed(http.MethodGet, http.MethodPatch, http.MethodDelete)
+}
+
+// apiError is an error of the client answered with the status and the message.
+type apiError struct {
+	status  int
+	message string
+	// allow are the methods of the resource for 405.
+	allow []string
+}
+
+func (e *apiError) Error() string {
+	return e.message
+}
+
+// errForbidden is the answer to the users who may not use the bot, e.g. the ones removed
+// from the allowlist, whose tokens are right.
+var errForbidden = &apiError{status: http.StatusForbidden, message: "access to the bot is denied"}
+
+func errMethodNotAllowed(allow ...string) error {
+	return &apiError{status: http.StatusMethodNotAllowed, message: "method not allowed", allow: allow}
+}
+
+// errorResponse is the body of every failed request.
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// fail answers the request failed with the error, with the status of an apiError.
+func (m *Model) fail(ctx context.Context, w http.ResponseWriter, err error) {
+	var apiErr *apiError
+	if !errors.As(err, &apiErr) {
+		m.log(ctx).Error("Cannot serve API request", zap.Error(err))
+		apiErr = &apiError{status: http.StatusInternalServerError, message: "internal error"}
+	}
+	if len(apiErr.allow) > 0 {
+		w.Header().Set("Allow", strings.Join(apiErr.allow, ", "))
+	}
+	writeJSON(w, apiErr.status, errorResponse{Error: apiErr.message})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func (m *Model) log(ctx context.Context) *zap.Logger {
+	return logging.FromContext(ctx, m.logger)
+}
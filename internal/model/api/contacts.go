@@ -0,0 +1,297 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/profectus200/contact-book-bot/internal/types"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultLimit = 50
+	maxLimit     = 200
+)
+
+type listResponse struct {
+	Contacts []types.ContactData `json:"contacts"`
+	// Total is the number of the contacts matching the filters on all the pages.
+	Total  int `json:"total"`
+	Offset int `json:"offset"`
+	Limit  int `json:"limit"`
+}
+
+// contactInput is the body of POST and PATCH. The fields left out are kept, and an empty
+// string removes the field.
+type contactInput struct {
+	Name        *string `json:"name"`
+	Email       *string `json:"email"`
+	Phone       *string `json:"phone"`
+	Birthday    *string `json:"birthday"`
+	Description *string `json:"description"`
+}
+
+// listContacts answers a page of the contacts matching the filters, ordered by the ID.
+func (m *Model) listContacts(ctx context.Context, w http.ResponseWriter, r *http.Request, userID int64) error {
+	query := r.URL.Query()
+	limit, err := intParam(query.Get("limit"), defaultLimit, 1, maxLimit)
+	if err != nil {
+		return &apiError{status: http.StatusBadRequest, message: "limit must be from 1 to " + strconv.Itoa(maxLimit)}
+	}
+	offset, err := intParam(query.Get("offset"), 0, 0, -1)
+	if err != nil {
+		return &apiError{status: http.StatusBadRequest, message: "offset must not be negative"}
+	}
+	month, err := intParam(query.Get("birthday_month"), 0, 1, 12)
+	if err != nil {
+		return &apiError{status: http.StatusBadRequest, message: "birthday_month must be from 1 to 12"}
+	}
+	name := strings.ToLower(strings.TrimSpace(query.Get("name")))
+
+	contacts, err := m.contactsDB.GetAllContacts(ctx, userID)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetAllContacts")
+	}
+	sort.Slice(contacts, func(i, j int) bool {
+		return contacts[i].ContactID < contacts[j].ContactID
+	})
+
+	resp := listResponse{Contacts: []types.ContactData{}, Offset: offset, Limit: limit}
+	for _, contact := range contacts {
+		if name != "" && !strings.Contains(strings.ToLower(contact.Name), name) {
+			continue
+		}
+		if month != 0 && (contact.Birthday == nil || int(contact.Birthday.Month) != month) {
+			continue
+		}
+		if resp.Total >= offset && len(resp.Contacts) < limit {
+			resp.Contacts = append(resp.Contacts, types.NewContactData(contact))
+		}
+		resp.Total++
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+	return nil
+}
+
+// intParam reads the query parameter within min and max, max is not checked when negative.
+// It is the default when the parameter is missing.
+func intParam(text string, def, min, max int) (int, error) {
+	if text == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(text)
+	if err != nil {
+		return 0, errors.Wrap(err, "cannot Atoi")
+	}
+	if n < min || (max >= 0 && n > max) {
+		return 0, errors.Errorf("%d is out of range", n)
+	}
+	return n, nil
+}
+
+func (m *Model) getContact(ctx context.Context, w http.ResponseWriter, userID int64, contactID int) error {
+	contact, err := m.contactsDB.GetContact(ctx, userID, contactID)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetContact")
+	}
+	if contact == nil {
+		return errNoContact
+	}
+
+	writeJSON(w, http.StatusOK, types.NewContactData(contact))
+	return nil
+}
+
+var errNoContact = &apiError{status: http.StatusNotFound, message: "no such contact"}
+
+// createContact adds the contact. It has no card in the chat until the user opens it.
+func (m *Model) createContact(ctx context.Context, w http.ResponseWriter, r *http.Request, userID int64) error {
+	input, err := decodeInput(r)
+	if err != nil {
+		return err
+	}
+	if input.Name == nil {
+		return &apiError{status: http.StatusBadRequest, message: "name is required"}
+	}
+
+	contact := &types.Contact{}
+	if err := input.apply(contact); err != nil {
+		return err
+	}
+
+	err = m.txManager.InTx(ctx, func(ctx context.Context) error {
+		err := m.usersDB.LockUser(ctx, userID)
+		if err != nil {
+			return errors.Wrap(err, "cannot LockUser")
+		}
+
+		if contact.ContactID, err = m.usersDB.NextExternalContactID(ctx, userID); err != nil {
+			return errors.Wrap(err, "cannot NextExternalContactID")
+		}
+		return errors.Wrap(m.contactsDB.WriteContact(ctx, userID, contact), "cannot WriteContact")
+	})
+	if err != nil {
+		return err
+	}
+	m.log(ctx).Info("Contact added over API", zap.Int("contact_id", contact.ContactID))
+
+	w.Header().Set("Location", strings.TrimSuffix(r.URL.Path, "/")+"/"+strconv.Itoa(contact.ContactID))
+	writeJSON(w, http.StatusCreated, types.NewContactData(contact))
+	return nil
+}
+
+// patchContact writes the fields in the body, the others are kept.
+func (m *Model) patchContact(ctx context.Context, w http.ResponseWriter, r *http.Request, userID int64, contactID int) error {
+	input, err := decodeInput(r)
+	if err != nil {
+		return err
+	}
+
+	var contact *types.Contact
+	err = m.txManager.InTx(ctx, func(ctx context.Context) error {
+		err := m.usersDB.LockUser(ctx, userID)
+		if err != nil {
+			return errors.Wrap(err, "cannot LockUser")
+		}
+
+		if contact, err = m.contactsDB.GetContact(ctx, userID, contactID); err != nil {
+			return errors.Wrap(err, "cannot GetContact")
+		}
+		if contact == nil {
+			return errNoContact
+		}
+		if err := input.apply(contact); err != nil {
+			return err
+		}
+		return m.writeFields(ctx, userID, contact, input)
+	})
+	if err != nil {
+		return err
+	}
+
+	writeJSON(w, http.StatusOK, types.NewContactData(contact))
+	return nil
+}
+
+// writeFields writes the fields of the contact given in the input.
+func (m *Model) writeFields(ctx context.Context, userID int64, contact *types.Contact, input contactInput) error {
+	if input.Name != nil {
+		if err := m.contactsDB.WriteName(ctx, contact.Name, userID, contact.ContactID); err != nil {
+			return errors.Wrap(err, "cannot WriteName")
+		}
+	}
+	if input.Email != nil {
+		if err := m.contactsDB.WriteEmail(ctx, contact.Email, userID, contact.ContactID); err != nil {
+			return errors.Wrap(err, "cannot WriteEmail")
+		}
+	}
+	if input.Phone != nil {
+		if err := m.contactsDB.WritePhone(ctx, contact.Phone, userID, contact.ContactID); err != nil {
+			return errors.Wrap(err, "cannot WritePhone")
+		}
+	}
+	if input.Birthday != nil {
+		if err := m.contactsDB.WriteBirthday(ctx, contact.Birthday, userID, contact.ContactID); err != nil {
+			return errors.Wrap(err, "cannot WriteBirthday")
+		}
+	}
+	if input.Description != nil {
+		if err := m.contactsDB.WriteDescription(ctx, contact.Description, userID, contact.ContactID); err != nil {
+			return errors.Wrap(err, "cannot WriteDescription")
+		}
+	}
+	return nil
+}
+
+func (m *Model) deleteContact(ctx context.Context, w http.ResponseWriter, userID int64, contactID int) error {
+	err := m.txManager.InTx(ctx, func(ctx context.Context) error {
+		err := m.usersDB.LockUser(ctx, userID)
+		if err != nil {
+			return errors.Wrap(err, "cannot LockUser")
+		}
+
+		contact, err := m.contactsDB.GetContact(ctx, userID, contactID)
+		if err != nil {
+			return errors.Wrap(err, "cannot GetContact")
+		}
+		if contact == nil {
+			return errNoContact
+		}
+		if err := m.contactsDB.DeleteContact(ctx, userID, contactID); err != nil {
+			return errors.Wrap(err, "cannot DeleteContact")
+		}
+		// The user may have been editing the deleted contact.
+		return errors.Wrap(m.usersDB.ToWaitState(ctx, userID), "cannot ToWaitState")
+	})
+	if err != nil {
+		return err
+	}
+	m.log(ctx).Info("Contact deleted over API", zap.Int("contact_id", contactID))
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func decodeInput(r *http.Request) (contactInput, error) {
+	var input contactInput
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&input); err != nil {
+		return contactInput{}, &apiError{status: http.StatusBadRequest, message: "invalid JSON: " + err.Error()}
+	}
+	return input, nil
+}
+
+// apply checks the fields given and sets them on the contact.
+func (in contactInput) apply(contact *types.Contact) error {
+	if in.Name != nil {
+		name := strings.TrimSpace(*in.Name)
+		if name == "" {
+			return &apiError{status: http.StatusBadRequest, message: "name must not be empty"}
+		}
+		contact.Name = name
+	}
+	if in.Email != nil {
+		contact.Email = ""
+		if strings.TrimSpace(*in.Email) != "" {
+			email, err := types.ParseEmail(*in.Email)
+			if err != nil {
+				return &apiError{status: http.StatusBadRequest, message: "email is not valid"}
+			}
+			contact.Email = email
+		}
+	}
+	if in.Phone != nil {
+		contact.Phone = strings.TrimSpace(*in.Phone)
+	}
+	if in.Birthday != nil {
+		contact.Birthday = nil
+		if text := strings.TrimSpace(*in.Birthday); text != "" {
+			birthday, err := parseDate(text)
+			if err != nil {
+				return &apiError{status: http.StatusBadRequest, message: "birthday must be yyyy-mm-dd or --mm-dd"}
+			}
+			contact.Birthday = &birthday
+		}
+	}
+	if in.Description != nil {
+		contact.Description = strings.TrimSpace(*in.Description)
+	}
+	return nil
+}
+
+// parseDate reads a birthday formatted by Birthday.ISO and checks it.
+func parseDate(text string) (types.Birthday, error) {
+	date, ok := types.ParseISO(text)
+	if !ok || date.ISO() != text {
+		return types.Birthday{}, errors.Errorf("%q is not an ISO date", text)
+	}
+	return types.NewBirthday(date.Day, date.Month, date.Year, time.Now())
+}
@@ -0,0 +1,120 @@
+package api
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// requestsPerMinute is the sustained rate of the requests of a user.
+	requestsPerMinute = 60
+	// burst is how many requests a user may make at once after a pause.
+	burst = 20
+
+	// addrRequestsPerMinute and addrBurst limit the requests from an address before the
+	// token is checked. The limit is higher than the one of a user, as several users may
+	// share an address, e.g. behind a NAT.
+	addrRequestsPerMinute = 120
+	addrBurst             = 40
+	// failedAuthCost is how many requests a wrong token costs the address, so that tokens
+	// cannot be guessed at the rate of the requests.
+	failedAuthCost = 10
+)
+
+// limiter limits the rate of the requests of every user, or of every address, with a token
+// bucket. The buckets are kept in memory, so every instance of the bot limits the requests
+// to itself.
+type limiter struct {
+	mu sync.Mutex
+	// perSecond is how many requests are added to a bucket every second.
+	perSecond float64
+	burst     float64
+	buckets   map[string]*bucket
+	// pruned is when the full buckets were dropped last.
+	pruned time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+func newLimiter(perMinute, burst int) *limiter {
+	return &limiter{
+		perSecond: float64(perMinute) / 60,
+		burst:     float64(burst),
+		buckets:   make(map[string]*bucket),
+	}
+}
+
+// userKey is the key of the bucket of the user.
+func userKey(userID int64) string {
+	return strconv.FormatInt(userID, 10)
+}
+
+// allow takes a request from the bucket with the key. When the bucket is empty it is false
+// with how long to wait for the next request.
+func (l *limiter) allow(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b := l.bucket(key, now)
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / l.perSecond * float64(time.Second))
+		return false, wait
+	}
+	b.tokens--
+	return true, 0
+}
+
+// spend takes n more requests from the bucket with the key, down to an empty bucket.
+func (l *limiter) spend(key string, n float64, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b := l.bucket(key, now)
+	b.tokens -= n
+	if b.tokens < 0 {
+		b.tokens = 0
+	}
+}
+
+// bucket returns the refilled bucket with the key, a full one when there is none.
+func (l *limiter) bucket(key string, now time.Time) *bucket {
+	l.prune(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, updated: now}
+		l.buckets[key] = b
+	}
+	l.refill(b, now)
+	return b
+}
+
+func (l *limiter) refill(b *bucket, now time.Time) {
+	if elapsed := now.Sub(b.updated).Seconds(); elapsed > 0 {
+		b.tokens += elapsed * l.perSecond
+		if b.tokens > l.burst {
+			b.tokens = l.burst
+		}
+	}
+	b.updated = now
+}
+
+// prune drops the buckets which have filled up, as they are the same as new ones,
+// so that the users and the addresses which made requests long ago take no memory.
+func (l *limiter) prune(now time.Time) {
+	if now.Sub(l.pruned) < time.Minute {
+		return
+	}
+	l.pruned = now
+
+	for key, b := range l.buckets {
+		l.refill(b, now)
+		if b.tokens >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
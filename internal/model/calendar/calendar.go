@@ -0,0 +1,250 @@
+// Package calendar gives the users the birthdays and the other dates of their contacts as an
+// iCalendar feed behind a secret link, and as a file to import once.
+package calendar
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+	"github.com/profectus200/contact-book-bot/cmd/logging"
+	"github.com/profectus200/contact-book-bot/internal/i18n"
+	"github.com/profectus200/contact-book-bot/internal/types"
+	"go.uber.org/zap"
+)
+
+const (
+	// PathPrefix is the path of the feeds on the HTTP server, followed by the token and .ics.
+	PathPrefix = "/calendar/"
+	// FileName is the name of the file sent to the chat.
+	FileName = "contacts.ics"
+
+	feedExtension = ".ics"
+	// tokenLength is the number of random bytes in a token, which is longer in base64.
+	tokenLength = 24
+)
+
+type calendarSender interface {
+	SendCalendarLink(ctx context.Context, text string, userID int64, hasLink bool, lang i18n.Lang) error
+	EditCalendarLink(ctx context.Context, text string, userID int64, messageID int, lang i18n.Lang) error
+	SendDocument(ctx context.Context, name string, data []byte, caption string, userID int64) error
+}
+
+type contactsDB interface {
+	GetAllContacts(ctx context.Context, userID int64) ([]*types.Contact, error)
+}
+
+type usersDB interface {
+	SetCalendarToken(ctx context.Context, userID int64, hash string) error
+	UserByCalendarToken(ctx context.Context, hash string) (int64, bool, error)
+}
+
+type settingsDB interface {
+	GetSettings(ctx context.Context, userID int64) (types.Settings, error)
+}
+
+type accessChecker interface {
+	AllowsUser(ctx context.Context, userID int64) (bool, error)
+}
+
+type Model struct {
+	tgClient   calendarSender
+	contactsDB contactsDB
+	usersDB    usersDB
+	settingsDB settingsDB
+	access     accessChecker
+	// publicURL is where the HTTP server is reachable by the calendar apps,
+	// empty when the bot serves no feeds.
+	publicURL string
+	logger    *zap.Logger
+}
+
+func New(tgClient calendarSender, contactsDB contactsDB, usersDB usersDB, settingsDB settingsDB,
+	access accessChecker, publicURL string, logger *zap.Logger) *Model {
+	return &Model{
+		tgClient:   tgClient,
+		contactsDB: contactsDB,
+		usersDB:    usersDB,
+		settingsDB: settingsDB,
+		access:     access,
+		publicURL:  strings.TrimSuffix(publicURL, "/"),
+		logger:     logger.Named("calendar"),
+	}
+}
+
+// ShowLink gives the user a new link to the feed, the old one stops working. Only the hash
+// of the secret in it is kept, so the link cannot be shown again. Without the public URL
+// it offers only the file.
+func (m *Model) ShowLink(ctx context.Context, userID int64, lang i18n.Lang) error {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"ShowCalendarLink",
+	)
+	defer span.Finish()
+
+	if m.publicURL == "" {
+		return m.tgClient.SendCalendarLink(ctx, lang.T(i18n.CalendarNoLink), userID, false, lang)
+	}
+
+	token, err := m.newToken(ctx, userID)
+	if err != nil {
+		return err
+	}
+	m.log(ctx).Info("Calendar link issued")
+
+	return m.tgClient.SendCalendarLink(ctx, lang.T(i18n.CalendarLink, m.feedURL(token)), userID, true, lang)
+}
+
+// ResetLink replaces the link of the user, so that the old one stops working,
+// and shows the new one in the message.
+func (m *Model) ResetLink(ctx context.Context, userID int64, messageID int, lang i18n.Lang) error {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"ResetCalendarLink",
+	)
+	defer span.Finish()
+
+	if m.publicURL == "" {
+		return errors.New("no public URL to make a link with")
+	}
+
+	token, err := m.newToken(ctx, userID)
+	if err != nil {
+		return err
+	}
+	m.log(ctx).Info("Calendar link replaced")
+
+	return m.tgClient.EditCalendarLink(ctx, lang.T(i18n.CalendarLink, m.feedURL(token)), userID, messageID, lang)
+}
+
+// SendFile sends the calendar to the chat as a file.
+func (m *Model) SendFile(ctx context.Context, userID int64, lang i18n.Lang) error {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"SendCalendarFile",
+	)
+	defer span.Finish()
+
+	contacts, err := m.contactsDB.GetAllContacts(ctx, userID)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetAllContacts")
+	}
+
+	data := types.Calendar(contacts, userID, lang, time.Now())
+	return m.tgClient.SendDocument(ctx, FileName, data, lang.T(i18n.CalendarFileCaption), userID)
+}
+
+// ServeHTTP serves the feed of the user with the token in the path. Unknown tokens get
+// 404, the same as any other path, so that the response tells nothing about them.
+func (m *Model) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	span, ctx := opentracing.StartSpanFromContext(
+		r.Context(),
+		"ServeCalendar",
+	)
+	defer span.Finish()
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, PathPrefix)
+	token, ok := strings.CutSuffix(name, feedExtension)
+	if !ok || token == "" || strings.Contains(token, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	data, found, err := m.feed(ctx, token)
+	if err != nil {
+		m.log(ctx).Error("Cannot serve calendar", zap.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="`+FileName+`"`)
+	// The feed changes with the contacts, the apps must not keep an old one.
+	w.Header().Set("Cache-Control", "no-cache")
+	_, _ = w.Write(data)
+}
+
+// feed renders the calendar of the user with the token, false when there is no such user
+// or the user may not use the bot.
+func (m *Model) feed(ctx context.Context, token string) ([]byte, bool, error) {
+	userID, ok, err := m.usersDB.UserByCalendarToken(ctx, hashToken(token))
+	if err != nil {
+		return nil, false, errors.Wrap(err, "cannot UserByCalendarToken")
+	}
+	if !ok {
+		return nil, false, nil
+	}
+	allowed, err := m.access.AllowsUser(ctx, userID)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "cannot AllowsUser")
+	}
+	if !allowed {
+		return nil, false, nil
+	}
+
+	settings, err := m.settingsDB.GetSettings(ctx, userID)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "cannot GetSettings")
+	}
+	contacts, err := m.contactsDB.GetAllContacts(ctx, userID)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "cannot GetAllContacts")
+	}
+
+	return types.Calendar(contacts, userID, userLang(settings), time.Now()), true, nil
+}
+
+// newToken makes a new secret for the link of the user and saves its hash.
+func (m *Model) newToken(ctx context.Context, userID int64) (string, error) {
+	secret := make([]byte, tokenLength)
+	if _, err := rand.Read(secret); err != nil {
+		return "", errors.Wrap(err, "cannot read random bytes")
+	}
+	token := base64.RawURLEncoding.EncodeToString(secret)
+
+	if err := m.usersDB.SetCalendarToken(ctx, userID, hashToken(token)); err != nil {
+		return "", errors.Wrap(err, "cannot SetCalendarToken")
+	}
+	return token, nil
+}
+
+// hashToken is what is kept of a token. The tokens are random and long, so a plain hash
+// is enough to keep a leaked database from giving the feeds away.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (m *Model) feedURL(token string) string {
+	return m.publicURL + PathPrefix + token + feedExtension
+}
+
+// userLang is the language chosen in the settings, the calendar apps fetching the feed
+// have no language of the Telegram app to follow.
+func userLang(settings types.Settings) i18n.Lang {
+	if lang, ok := i18n.Parse(settings.Language); ok {
+		return lang
+	}
+	return i18n.Default
+}
+
+func (m *Model) log(ctx context.Context) *zap.Logger {
+	return logging.FromContext(ctx, m.logger)
+}
@@ -0,0 +1,25 @@
+package callbacks
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+// deleteAccount deletes everything of the user after /delete_account.
+func (s *Model) deleteAccount(ctx context.Context, data *CallbackData) error {
+	err := s.account.DeleteAccount(ctx, data.FromID, data.MessageID, data.Lang)
+	if err != nil {
+		return errors.Wrap(err, "cannot DeleteAccount")
+	}
+	return s.tgClient.ShowAlert(ctx, "", data.CallbackID)
+}
+
+// keepAccount answers /delete_account that nothing is deleted.
+func (s *Model) keepAccount(ctx context.Context, data *CallbackData) error {
+	err := s.account.KeepAccount(ctx, data.FromID, data.MessageID, data.Lang)
+	if err != nil {
+		return errors.Wrap(err, "cannot KeepAccount")
+	}
+	return s.tgClient.ShowAlert(ctx, "", data.CallbackID)
+}
@@ -0,0 +1,26 @@
+package callbacks
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/profectus200/contact-book-bot/internal/i18n"
+)
+
+// sendCalendarFile sends the calendar of the contacts to import once.
+func (s *Model) sendCalendarFile(ctx context.Context, data *CallbackData) error {
+	err := s.tgClient.ShowAlert(ctx, "", data.CallbackID)
+	if err != nil {
+		return errors.Wrap(err, "cannot ShowAlert")
+	}
+	return errors.Wrap(s.calendar.SendFile(ctx, data.FromID, data.Lang), "cannot SendFile")
+}
+
+// resetCalendarLink replaces the /calendar link with a new one, the old one stops working.
+func (s *Model) resetCalendarLink(ctx context.Context, data *CallbackData) error {
+	err := s.calendar.ResetLink(ctx, data.FromID, data.MessageID, data.Lang)
+	if err != nil {
+		return errors.Wrap(err, "cannot ResetLink")
+	}
+	return s.tgClient.ShowAlert(ctx, data.Lang.T(i18n.CalendarLinkChanged), data.CallbackID)
+}
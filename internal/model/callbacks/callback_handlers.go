@@ -2,48 +2,119 @@ package callbacks
 
 import (
 	"context"
-	"errors"
+	"time"
+
 	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+	"github.com/profectus200/contact-book-bot/cmd/logging"
+	"github.com/profectus200/contact-book-bot/internal/i18n"
+	"github.com/profectus200/contact-book-bot/internal/model/conversation"
 	"github.com/profectus200/contact-book-bot/internal/types"
-)
-
-const (
-	ChangeContactName        string = "ChangeContactName"
-	ChangeContactPhone       string = "ChangeContactPhone"
-	ChangeContactBirthday    string = "ChangeContactBirthday"
-	ChangeContactDescription string = "ChangeContactDescription"
-	ChangeContactDone        string = "ChangeContactDone"
-	DeleteContact            string = "DeleteContact"
+	"go.uber.org/zap"
 )
 
 type callbackHandler interface {
-	SendMessage(text string, userID int64) error
-	DoneMessage(userID int64, messageID int) error
-	DeleteMessage(userID int64, messageID int) error
-	ShowAlert(text string, messageID string) error
+	SendMessage(ctx context.Context, text string, userID int64) error
+	DoneMessage(ctx context.Context, userID int64, messageID int, lang i18n.Lang) error
+	DeleteMessage(ctx context.Context, userID int64, messageID int) error
+	ShowAlert(ctx context.Context, text string, messageID string) error
+	EditChooseLanguage(ctx context.Context, text string, userID int64, messageID int) error
+	EditSettings(ctx context.Context, text string, userID int64, messageID int, settings types.Settings, lang i18n.Lang) error
+	EditContactMessage(ctx context.Context, text string, userID int64, messageID int, contactID int, photoID string, lang i18n.Lang) error
+	EditMessage(ctx context.Context, text string, userID int64, messageID int) error
+	EditDuplicates(ctx context.Context, text string, userID int64, messageID int, dup types.Duplicate, page int, lang i18n.Lang) error
+	EditMergedContact(ctx context.Context, text string, userID int64, messageID int, page int, lang i18n.Lang) error
+	EditReminders(ctx context.Context, text string, userID int64, messageID int, reminders []types.Reminder, lang i18n.Lang) error
 }
 
 type contactsDB interface {
+	GetContact(ctx context.Context, userID int64, contactID int) (*types.Contact, error)
+	GetAllContacts(ctx context.Context, userID int64) ([]*types.Contact, error)
 	DeleteContact(ctx context.Context, userID int64, contactID int) error
+	MergeContacts(ctx context.Context, userID int64, keepID, otherID int) (*types.Contact, error)
+	GetReminders(ctx context.Context, userID int64) ([]types.Reminder, error)
+	GetReminder(ctx context.Context, userID int64, reminderID int) (*types.Reminder, error)
+	SnoozeReminder(ctx context.Context, userID int64, reminderID int, dueAt time.Time) error
+	DeleteReminder(ctx context.Context, userID int64, reminderID int) error
 }
 
 type usersDB interface {
-	SetCurrentState(ctx context.Context, userID int64, state types.CurrentState) error
-	GetCurrentState(ctx context.Context, userID int64) (*types.UserStateType, bool)
 	ToWaitState(ctx context.Context, userID int64) error
+	LockUser(ctx context.Context, userID int64) error
+}
+
+type settingsDB interface {
+	GetSettings(ctx context.Context, userID int64) (types.Settings, error)
+	SaveSettings(ctx context.Context, userID int64, settings types.Settings) error
+}
+
+type txManager interface {
+	InTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type conversations interface {
+	EditName(ctx context.Context, c *conversation.Chat, contactID int, cardID int) error
+	EditEmail(ctx context.Context, c *conversation.Chat, contactID int, cardID int) error
+	EditPhone(ctx context.Context, c *conversation.Chat, contactID int, cardID int) error
+	EditBirthday(ctx context.Context, c *conversation.Chat, contactID int, cardID int) error
+	EditDescription(ctx context.Context, c *conversation.Chat, contactID int, cardID int) error
+	EditPhoto(ctx context.Context, c *conversation.Chat, contactID int, cardID int) error
+	AddField(ctx context.Context, c *conversation.Chat, contactID int, cardID int) error
+	AddEvent(ctx context.Context, c *conversation.Chat, contactID int, cardID int) error
+	LogInteraction(ctx context.Context, c *conversation.Chat, contactID int, cardID int) error
+	AddReminder(ctx context.Context, c *conversation.Chat, contactID int) error
+	AddContact(ctx context.Context, c *conversation.Chat, contactID int) error
+	SetTimezone(ctx context.Context, c *conversation.Chat, menuID int) error
+	SetPhoneRegion(ctx context.Context, c *conversation.Chat, menuID int) error
+	SetReminderTime(ctx context.Context, c *conversation.Chat, menuID int) error
+	SetStaleDays(ctx context.Context, c *conversation.Chat, menuID int) error
+	AddWebhook(ctx context.Context, c *conversation.Chat) error
+	Cancel(ctx context.Context, userID int64) (bool, error)
+}
+
+type calendar interface {
+	ResetLink(ctx context.Context, userID int64, messageID int, lang i18n.Lang) error
+	SendFile(ctx context.Context, userID int64, lang i18n.Lang) error
+}
+
+type webhooks interface {
+	RemoveWebhook(ctx context.Context, userID int64, messageID int, webhookID int, lang i18n.Lang) error
+}
+
+type account interface {
+	DeleteAccount(ctx context.Context, userID int64, messageID int, lang i18n.Lang) error
+	KeepAccount(ctx context.Context, userID int64, messageID int, lang i18n.Lang) error
 }
 
 type Model struct {
-	tgClient   callbackHandler
-	contactsDB contactsDB
-	usersDB    usersDB
+	tgClient      callbackHandler
+	contactsDB    contactsDB
+	usersDB       usersDB
+	settingsDB    settingsDB
+	txManager     txManager
+	conversations conversations
+	calendar      calendar
+	webhooks      webhooks
+	account       account
+	codec         *Codec
+	logger        *zap.Logger
 }
 
-func New(tgClient callbackHandler, contactsDB contactsDB, usersDB usersDB) *Model {
+func New(tgClient callbackHandler, contactsDB contactsDB, usersDB usersDB, settingsDB settingsDB,
+	txManager txManager, conversations conversations, calendar calendar, webhooks webhooks, account account, codec *Codec,
+	logger *zap.Logger) *Model {
 	return &Model{
-		tgClient:   tgClient,
-		contactsDB: contactsDB,
-		usersDB:    usersDB,
+		tgClient:      tgClient,
+		contactsDB:    contactsDB,
+		usersDB:       usersDB,
+		settingsDB:    settingsDB,
+		txManager:     txManager,
+		conversations: conversations,
+		calendar:      calendar,
+		webhooks:      webhooks,
+		account:       account,
+		codec:         codec,
+		logger:        logger.Named("callbacks"),
 	}
 }
 
@@ -52,6 +123,19 @@ type CallbackData struct {
 	MessageID  int
 	Data       string
 	CallbackID string
+	Lang       i18n.Lang
+	Settings   types.Settings
+}
+
+// chat is the user pressing the button, for the conversations started with it.
+func (data *CallbackData) chat() *conversation.Chat {
+	return &conversation.Chat{
+		UserID:     data.FromID,
+		MessageID:  data.MessageID,
+		CallbackID: data.CallbackID,
+		Lang:       data.Lang,
+		Settings:   data.Settings,
+	}
 }
 
 func (s *Model) IncomingCallback(ctx context.Context, data *CallbackData) error {
@@ -59,23 +143,104 @@ func (s *Model) IncomingCallback(ctx context.Context, data *CallbackData) error
 		ctx,
 		"IncomingCallback",
 	)
-	span.SetTag("callback", data.Data)
 	defer span.Finish()
 
-	switch data.Data {
+	payload, err := s.codec.Decode(data.FromID, data.Data)
+	if err != nil {
+		// Buttons sent by an older version of the bot end up here too.
+		s.log(ctx).Warn("Cannot decode callback data", zap.Error(err))
+		return s.tgClient.ShowAlert(ctx, data.Lang.T(i18n.ButtonOutdated), data.CallbackID)
+	}
+	span.SetTag("action", string(payload.Action))
+
+	switch payload.Action {
+	case SettingsLanguage:
+		return s.chooseLanguage(ctx, data)
+	case SettingsTimezone:
+		return s.conversations.SetTimezone(ctx, data.chat(), data.MessageID)
+	case SettingsPhoneRegion:
+		return s.conversations.SetPhoneRegion(ctx, data.chat(), data.MessageID)
+	case SettingsReminderTime:
+		return s.conversations.SetReminderTime(ctx, data.chat(), data.MessageID)
+	case SettingsStaleDays:
+		return s.conversations.SetStaleDays(ctx, data.chat(), data.MessageID)
+	case SettingsSortOrder:
+		return s.changeSettings(ctx, data, func(settings *types.Settings) {
+			settings.SortOrder = settings.SortOrder.Next()
+		})
+	case SettingsClose:
+		return s.closeSettings(ctx, data)
+	case SettingsToggleField:
+		return s.toggleField(ctx, data, payload.Arg)
+	case SetLanguage:
+		return s.setLanguage(ctx, data, payload.Arg)
+	case ShowDuplicates:
+		return s.showDuplicates(ctx, data, payload.Page)
+	case SnoozeReminder:
+		return s.snoozeReminder(ctx, data, payload.Arg)
+	case CompleteReminder:
+		return s.completeReminder(ctx, data, payload.Arg)
+	case CancelReminder:
+		return s.cancelReminder(ctx, data, payload.Arg)
+	case CalendarFile:
+		return s.sendCalendarFile(ctx, data)
+	case CalendarReset:
+		return s.resetCalendarLink(ctx, data)
+	case WebhookAdd:
+		return s.conversations.AddWebhook(ctx, data.chat())
+	case WebhookRemove:
+		return s.removeWebhook(ctx, data, payload.Arg)
+	case DeleteAccount:
+		return s.deleteAccount(ctx, data)
+	case KeepAccount:
+		return s.keepAccount(ctx, data)
+	}
+
+	// A new contact gets the ID of the message with its card.
+	contactID := payload.ContactID
+	if contactID == 0 {
+		contactID = data.MessageID
+	}
+	span.SetTag("contact_id", contactID)
+
+	switch payload.Action {
 	case ChangeContactName:
-		return s.toWriteNameState(ctx, data)
+		return s.conversations.EditName(ctx, data.chat(), contactID, data.MessageID)
+	case ChangeContactEmail:
+		return s.conversations.EditEmail(ctx, data.chat(), contactID, data.MessageID)
 	case ChangeContactPhone:
-		return s.toWritePhoneState(ctx, data)
+		return s.conversations.EditPhone(ctx, data.chat(), contactID, data.MessageID)
 	case ChangeContactBirthday:
-		return s.toWriteBirthdayState(ctx, data)
+		return s.conversations.EditBirthday(ctx, data.chat(), contactID, data.MessageID)
 	case ChangeContactDescription:
-		return s.toWriteDescriptionState(ctx, data)
+		return s.conversations.EditDescription(ctx, data.chat(), contactID, data.MessageID)
+	case ChangeContactPhoto:
+		return s.conversations.EditPhoto(ctx, data.chat(), contactID, data.MessageID)
+	case AddCustomField:
+		return s.conversations.AddField(ctx, data.chat(), contactID, data.MessageID)
+	case AddEvent:
+		return s.conversations.AddEvent(ctx, data.chat(), contactID, data.MessageID)
+	case LogInteraction:
+		return s.conversations.LogInteraction(ctx, data.chat(), contactID, data.MessageID)
+	case AddReminder:
+		return s.conversations.AddReminder(ctx, data.chat(), contactID)
 	case ChangeContactDone:
-		return s.saveContact(data)
+		return s.saveContact(ctx, data)
 	case DeleteContact:
-		return s.deleteContact(ctx, data)
+		return s.deleteContact(ctx, data, contactID)
+	case StartWizard:
+		return s.startWizard(ctx, data, contactID)
+	case EditContactCard:
+		return s.editContactCard(ctx, data, contactID)
+	case ConfirmContact:
+		return s.confirmContact(ctx, data, contactID)
+	case MergeDuplicates:
+		return s.mergeDuplicates(ctx, data, contactID, payload.Arg, payload.Page)
 	}
 
-	return errors.New("Callback handler for data '" + data.Data + "' was not found.")
+	return errors.Errorf("callback handler for action %q was not found", payload.Action)
+}
+
+func (s *Model) log(ctx context.Context) *zap.Logger {
+	return logging.FromContext(ctx, s.logger)
 }
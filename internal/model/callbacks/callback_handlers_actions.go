@@ -2,125 +2,198 @@ package callbacks
 
 import (
 	"context"
-	"fmt"
 	"github.com/pkg/errors"
+	"github.com/profectus200/contact-book-bot/internal/i18n"
 	"github.com/profectus200/contact-book-bot/internal/types"
+	"go.uber.org/zap"
 )
 
-func (s *Model) toWriteNameState(ctx context.Context, data *CallbackData) error {
-	// Change state of the user - he is now entering name for this user and this messageID.
-	contactID := data.MessageID
-	if state, ok := s.usersDB.GetCurrentState(ctx, data.FromID); ok {
-		if state.CurrentState.ContactID != 0 {
-			contactID = state.CurrentState.ContactID
-		}
+// saveContact closes the card. The contact is already saved field by field,
+// only the field the user may have been asked for is left unanswered.
+func (s *Model) saveContact(ctx context.Context, data *CallbackData) error {
+	_, err := s.conversations.Cancel(ctx, data.FromID)
+	if err != nil {
+		return errors.Wrap(err, "cannot Cancel")
 	}
 
-	err := s.usersDB.SetCurrentState(ctx, data.FromID, types.CurrentState{
-		ContactID: contactID,
-		MessageID: data.MessageID,
-		State:     types.EditingName,
-	})
+	err = s.tgClient.ShowAlert(ctx, data.Lang.T(i18n.Saved), data.CallbackID)
+	if err != nil {
+		return errors.Wrap(err, "cannot ShowAlert")
+	}
+
+	return s.tgClient.DeleteMessage(ctx, data.FromID, data.MessageID)
+}
 
-	if state, ok := s.usersDB.GetCurrentState(ctx, data.FromID); ok {
-		fmt.Println(state.CurrentState.State, state.CurrentState.ContactID, state.CurrentState.MessageID)
+func (s *Model) deleteContact(ctx context.Context, data *CallbackData, contactID int) error {
+	err := s.txManager.InTx(ctx, func(ctx context.Context) error {
+		err := s.usersDB.LockUser(ctx, data.FromID)
+		if err != nil {
+			return errors.Wrap(err, "cannot LockUser")
+		}
+
+		err = s.contactsDB.DeleteContact(ctx, data.FromID, contactID)
+		if err != nil {
+			return errors.Wrap(err, "cannot DeleteContact")
+		}
+
+		// The user may have been editing the deleted contact.
+		return errors.Wrap(s.usersDB.ToWaitState(ctx, data.FromID), "cannot ToWaitState")
+	})
+	if err != nil {
+		return err
 	}
+	s.log(ctx).Info("Contact deleted", zap.Int("contact_id", contactID))
+
+	err = s.tgClient.ShowAlert(ctx, data.Lang.T(i18n.Deleted), data.CallbackID)
 	if err != nil {
-		return errors.Wrap(err, "cannot SetCurrentState")
+		return errors.Wrap(err, "cannot ShowAlert")
 	}
 
-	// Show notification about the action.
-	return s.tgClient.ShowAlert("Enter the name of your contact:", data.CallbackID)
+	return s.tgClient.DeleteMessage(ctx, data.FromID, data.MessageID)
 }
 
-func (s *Model) toWritePhoneState(ctx context.Context, data *CallbackData) error {
-	// Change state of the user - he is now entering name for this user and this messageID.
+// startWizard replaces the card of a new contact with the questions of the wizard.
+func (s *Model) startWizard(ctx context.Context, data *CallbackData, contactID int) error {
+	err := s.tgClient.ShowAlert(ctx, data.Lang.T(i18n.WizardStarted), data.CallbackID)
+	if err != nil {
+		return errors.Wrap(err, "cannot ShowAlert")
+	}
 
-	contactID := data.MessageID
-	if state, ok := s.usersDB.GetCurrentState(ctx, data.FromID); ok {
-		if state.CurrentState.ContactID != 0 {
-			contactID = state.CurrentState.ContactID
-		}
+	err = s.tgClient.DeleteMessage(ctx, data.FromID, data.MessageID)
+	if err != nil {
+		return errors.Wrap(err, "cannot DeleteMessage")
 	}
 
-	err := s.usersDB.SetCurrentState(ctx, data.FromID, types.CurrentState{
-		ContactID: contactID,
-		MessageID: data.MessageID,
-		State:     types.EditingPhone,
-	})
+	// The button is answered already, the questions are asked with messages.
+	chat := data.chat()
+	chat.CallbackID = ""
+	return s.conversations.AddContact(ctx, chat, contactID)
+}
+
+// editContactCard turns the summary of the wizard into the card of the contact.
+func (s *Model) editContactCard(ctx context.Context, data *CallbackData, contactID int) error {
+	contact, err := s.contactsDB.GetContact(ctx, data.FromID, contactID)
 	if err != nil {
-		return errors.Wrap(err, "cannot SetCurrentState")
+		return errors.Wrap(err, "cannot GetContact")
+	}
+	if contact == nil {
+		return s.tgClient.ShowAlert(ctx, data.Lang.T(i18n.ContactNotFound, contactID), data.CallbackID)
+	}
+
+	err = s.tgClient.ShowAlert(ctx, data.Lang.T(i18n.ChooseField), data.CallbackID)
+	if err != nil {
+		return errors.Wrap(err, "cannot ShowAlert")
 	}
 
-	// Show notification about the action.
-	return s.tgClient.ShowAlert("Enter the phone of your contact:", data.CallbackID)
+	card := contact.ToString(data.Lang, data.Settings.ShowingAll())
+	return s.tgClient.EditContactMessage(ctx, card, data.FromID, data.MessageID, contact.ContactID, contact.PhotoID, data.Lang)
 }
 
-func (s *Model) toWriteBirthdayState(ctx context.Context, data *CallbackData) error {
-	// Change state of the user - he is now entering name for this user and this messageID.
-	contactID := data.MessageID
-	if state, ok := s.usersDB.GetCurrentState(ctx, data.FromID); ok {
-		if state.CurrentState.ContactID != 0 {
-			contactID = state.CurrentState.ContactID
-		}
+// confirmContact leaves the summary of the wizard in the chat without the buttons.
+func (s *Model) confirmContact(ctx context.Context, data *CallbackData, contactID int) error {
+	contact, err := s.contactsDB.GetContact(ctx, data.FromID, contactID)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetContact")
+	}
+	if contact == nil {
+		return s.tgClient.ShowAlert(ctx, data.Lang.T(i18n.ContactNotFound, contactID), data.CallbackID)
 	}
 
-	err := s.usersDB.SetCurrentState(ctx, data.FromID, types.CurrentState{
-		ContactID: contactID,
-		MessageID: data.MessageID,
-		State:     types.EditingBirthday,
-	})
+	err = s.tgClient.ShowAlert(ctx, data.Lang.T(i18n.Saved), data.CallbackID)
 	if err != nil {
-		return errors.Wrap(err, "cannot SetCurrentState")
+		return errors.Wrap(err, "cannot ShowAlert")
 	}
 
-	// Show notification about the action.
-	return s.tgClient.ShowAlert("Enter the birthday of your contact in format 'dd.mm':", data.CallbackID)
+	return s.tgClient.EditMessage(ctx, contact.ToString(data.Lang, data.Settings.ShowingAll()), data.FromID, data.MessageID)
 }
 
-func (s *Model) toWriteDescriptionState(ctx context.Context, data *CallbackData) error {
-	// Change state of the user - he is now entering name for this user and this messageID.
-	contactID := data.MessageID
-	if state, ok := s.usersDB.GetCurrentState(ctx, data.FromID); ok {
-		if state.CurrentState.ContactID != 0 {
-			contactID = state.CurrentState.ContactID
-		}
+func (s *Model) setLanguage(ctx context.Context, data *CallbackData, code string) error {
+	lang, ok := i18n.Parse(code)
+	if !ok {
+		return errors.Errorf("unsupported language %q", code)
 	}
 
-	err := s.usersDB.SetCurrentState(ctx, data.FromID, types.CurrentState{
-		ContactID: contactID,
-		MessageID: data.MessageID,
-		State:     types.EditingDescription,
+	_, err := s.updateSettings(ctx, data.FromID, func(settings *types.Settings) {
+		settings.Language = string(lang)
 	})
 	if err != nil {
-		return errors.Wrap(err, "cannot SetCurrentState")
+		return err
 	}
+	s.log(ctx).Info("Language changed", zap.String("language", string(lang)))
 
-	// Show notification about the action.
-	return s.tgClient.ShowAlert("Enter description of your contact:", data.CallbackID)
+	// The confirmation is already in the new language.
+	err = s.tgClient.ShowAlert(ctx, lang.T(i18n.LanguageChanged), data.CallbackID)
+	if err != nil {
+		return errors.Wrap(err, "cannot ShowAlert")
+	}
+
+	return s.tgClient.DeleteMessage(ctx, data.FromID, data.MessageID)
 }
 
-func (s *Model) saveContact(data *CallbackData) error {
-	err := s.tgClient.ShowAlert("Saved", data.CallbackID)
+// updateSettings changes the settings of the user with the user locked, so that two
+// buttons pressed quickly one after another do not undo each other.
+func (s *Model) updateSettings(ctx context.Context, userID int64, update func(settings *types.Settings)) (types.Settings, error) {
+	var settings types.Settings
+	err := s.txManager.InTx(ctx, func(ctx context.Context) error {
+		err := s.usersDB.LockUser(ctx, userID)
+		if err != nil {
+			return errors.Wrap(err, "cannot LockUser")
+		}
+
+		settings, err = s.settingsDB.GetSettings(ctx, userID)
+		if err != nil {
+			return errors.Wrap(err, "cannot GetSettings")
+		}
+
+		update(&settings)
+
+		return errors.Wrap(s.settingsDB.SaveSettings(ctx, userID, settings), "cannot SaveSettings")
+	})
+
+	return settings, err
+}
+
+// changeSettings applies a change made with a button of the /settings menu and shows it in the menu.
+func (s *Model) changeSettings(ctx context.Context, data *CallbackData, update func(settings *types.Settings)) error {
+	settings, err := s.updateSettings(ctx, data.FromID, update)
+	if err != nil {
+		return err
+	}
+	s.log(ctx).Debug("Settings changed")
+
+	err = s.tgClient.ShowAlert(ctx, data.Lang.T(i18n.Saved), data.CallbackID)
 	if err != nil {
 		return errors.Wrap(err, "cannot ShowAlert")
 	}
 
-	return s.tgClient.DeleteMessage(data.FromID, data.MessageID)
+	return s.tgClient.EditSettings(ctx, settings.ToString(data.Lang), data.FromID, data.MessageID, settings, data.Lang)
+}
+
+func (s *Model) toggleField(ctx context.Context, data *CallbackData, name string) error {
+	field, ok := types.ParseCardField(name)
+	if !ok {
+		return errors.Errorf("unknown card field %q", name)
+	}
 
+	return s.changeSettings(ctx, data, func(settings *types.Settings) {
+		settings.ToggleField(field)
+	})
 }
 
-func (s *Model) deleteContact(ctx context.Context, data *CallbackData) error {
-	state, _ := s.usersDB.GetCurrentState(ctx, data.FromID)
-	err := s.contactsDB.DeleteContact(ctx, data.FromID, state.CurrentState.ContactID)
+func (s *Model) chooseLanguage(ctx context.Context, data *CallbackData) error {
+	err := s.tgClient.ShowAlert(ctx, data.Lang.T(i18n.ChooseLanguage), data.CallbackID)
 	if err != nil {
-		return errors.Wrap(err, "cannot DeleteContact")
+		return errors.Wrap(err, "cannot ShowAlert")
 	}
 
-	err = s.tgClient.ShowAlert("Deleted", data.CallbackID)
+	return s.tgClient.EditChooseLanguage(ctx, data.Lang.T(i18n.ChooseLanguage), data.FromID, data.MessageID)
+}
+
+func (s *Model) closeSettings(ctx context.Context, data *CallbackData) error {
+	err := s.tgClient.ShowAlert(ctx, data.Lang.T(i18n.Saved), data.CallbackID)
 	if err != nil {
 		return errors.Wrap(err, "cannot ShowAlert")
 	}
 
-	return s.tgClient.DeleteMessage(data.FromID, data.MessageID)
+	return s.tgClient.DeleteMessage(ctx, data.FromID, data.MessageID)
 }
@@ -0,0 +1,95 @@
+package callbacks
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/profectus200/contact-book-bot/internal/i18n"
+	"github.com/profectus200/contact-book-bot/internal/types"
+	"go.uber.org/zap"
+)
+
+// mergeDuplicates merges the other contact into the kept one and shows the result.
+// The pairs are found again afterwards, so the one with the same number is the next one.
+func (s *Model) mergeDuplicates(ctx context.Context, data *CallbackData, keepID int, other string, page int) error {
+	otherID, err := strconv.Atoi(other)
+	if err != nil {
+		return errors.Wrapf(err, "wrong ID of the contact to merge %q", other)
+	}
+
+	var merged *types.Contact
+	err = s.txManager.InTx(ctx, func(ctx context.Context) error {
+		err := s.usersDB.LockUser(ctx, data.FromID)
+		if err != nil {
+			return errors.Wrap(err, "cannot LockUser")
+		}
+
+		merged, err = s.contactsDB.MergeContacts(ctx, data.FromID, keepID, otherID)
+		if err != nil {
+			return errors.Wrap(err, "cannot MergeContacts")
+		}
+		if merged == nil {
+			return nil
+		}
+
+		// The user may have been editing the removed contact.
+		return errors.Wrap(s.usersDB.ToWaitState(ctx, data.FromID), "cannot ToWaitState")
+	})
+	if err != nil {
+		return err
+	}
+	if merged == nil {
+		// One of the contacts was deleted or merged since the pair was shown.
+		return s.showDuplicates(ctx, data, page)
+	}
+	s.log(ctx).Info("Contacts merged", zap.Int("contact_id", keepID), zap.Int("merged_id", otherID))
+
+	err = s.tgClient.ShowAlert(ctx, data.Lang.T(i18n.Merged), data.CallbackID)
+	if err != nil {
+		return errors.Wrap(err, "cannot ShowAlert")
+	}
+
+	duplicates, err := s.findDuplicates(ctx, data)
+	if err != nil {
+		return err
+	}
+
+	text := data.Lang.T(i18n.MergedInto, keepID) + "\n" + merged.ToString(data.Lang, data.Settings.ShowingAll())
+	if page >= len(duplicates) {
+		return s.tgClient.EditMessage(ctx, text, data.FromID, data.MessageID)
+	}
+	return s.tgClient.EditMergedContact(ctx, text, data.FromID, data.MessageID, page, data.Lang)
+}
+
+// showDuplicates shows the pair of possible duplicates with the given number.
+func (s *Model) showDuplicates(ctx context.Context, data *CallbackData, page int) error {
+	duplicates, err := s.findDuplicates(ctx, data)
+	if err != nil {
+		return err
+	}
+
+	if page >= len(duplicates) {
+		err = s.tgClient.ShowAlert(ctx, data.Lang.T(i18n.NoMoreDuplicates), data.CallbackID)
+		if err != nil {
+			return errors.Wrap(err, "cannot ShowAlert")
+		}
+		return s.tgClient.EditMessage(ctx, data.Lang.T(i18n.NoMoreDuplicates), data.FromID, data.MessageID)
+	}
+
+	err = s.tgClient.ShowAlert(ctx, "", data.CallbackID)
+	if err != nil {
+		return errors.Wrap(err, "cannot ShowAlert")
+	}
+
+	dup := duplicates[page]
+	return s.tgClient.EditDuplicates(ctx, dup.ToString(data.Lang, page+1, len(duplicates)), data.FromID, data.MessageID, dup, page, data.Lang)
+}
+
+func (s *Model) findDuplicates(ctx context.Context, data *CallbackData) ([]types.Duplicate, error) {
+	contacts, err := s.contactsDB.GetAllContacts(ctx, data.FromID)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot GetAllContacts")
+	}
+	return types.FindDuplicates(contacts, data.Settings.PhoneRegion), nil
+}
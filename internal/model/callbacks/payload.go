@@ -0,0 +1,233 @@
+package callbacks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/profectus200/contact-book-bot/internal/i18n"
+	"github.com/profectus200/contact-book-bot/internal/types"
+)
+
+// MaxDataLength is the limit Telegram puts on the data of a button.
+const MaxDataLength = 64
+
+// version is the first field of the data. Buttons of another version are outdated:
+// they were sent by an older bot and are not handled.
+const version = "1"
+
+// signatureLength is the number of bytes of the HMAC kept in the data.
+const signatureLength = 8
+
+// Action is what the button does. The values are short, as they are sent in every button.
+type Action string
+
+// Actions of the contact card buttons, pressed for the contact of Payload.ContactID.
+const (
+	ChangeContactName        Action = "n"
+	ChangeContactEmail       Action = "e"
+	ChangeContactPhone       Action = "p"
+	ChangeContactBirthday    Action = "b"
+	ChangeContactDescription Action = "d"
+	ChangeContactPhoto       Action = "ph"
+	AddCustomField           Action = "af"
+	AddEvent                 Action = "ad"
+	LogInteraction           Action = "li"
+	AddReminder              Action = "ar"
+	ChangeContactDone        Action = "s"
+	DeleteContact            Action = "x"
+	StartWizard              Action = "w"
+	// The buttons under the contact added with the wizard.
+	EditContactCard Action = "ec"
+	ConfirmContact  Action = "ok"
+)
+
+const (
+	// SetLanguage has the code of the chosen language in Payload.Arg.
+	SetLanguage Action = "l"
+
+	SettingsLanguage     Action = "sl"
+	SettingsTimezone     Action = "st"
+	SettingsPhoneRegion  Action = "sp"
+	SettingsReminderTime Action = "sr"
+	SettingsStaleDays    Action = "sd"
+	SettingsSortOrder    Action = "so"
+	SettingsClose        Action = "sc"
+	// SettingsToggleField has the name of the card field in Payload.Arg.
+	SettingsToggleField Action = "sf"
+)
+
+// Actions of the /duplicates buttons, Payload.Page is the number of the pair from 0.
+const (
+	// MergeDuplicates merges the contact of Payload.Arg into the one of Payload.ContactID.
+	MergeDuplicates Action = "dm"
+	// ShowDuplicates shows the pair of Payload.Page, either the next one or the same one
+	// after merging.
+	ShowDuplicates Action = "dp"
+)
+
+// Actions of the buttons of reminders, Payload.Arg is the ID of the reminder.
+const (
+	// SnoozeReminder and CompleteReminder are under a delivered reminder.
+	SnoozeReminder   Action = "rs"
+	CompleteReminder Action = "rd"
+	// CancelReminder is under the list of /reminders.
+	CancelReminder Action = "rc"
+)
+
+// Actions of the buttons under the /calendar link.
+const (
+	CalendarFile  Action = "cf"
+	CalendarReset Action = "cn"
+)
+
+// Actions of the buttons under the list of /webhooks.
+const (
+	WebhookAdd Action = "ha"
+	// WebhookRemove has the ID of the webhook in Payload.Arg.
+	WebhookRemove Action = "hr"
+)
+
+// Actions of the buttons under the question of /delete_account.
+const (
+	DeleteAccount Action = "da"
+	KeepAccount   Action = "dk"
+)
+
+// Payload is what a button tells the bot when it is pressed.
+type Payload struct {
+	Action Action
+	// ContactID is the contact the button is for. A new contact has no ID yet: its card
+	// has 0 and the contact gets the ID of the message with the card.
+	ContactID int
+	// Page is the page of a list the button shows.
+	Page int
+	// Arg is the argument of the action, e.g. the code of the language to choose.
+	Arg string
+}
+
+// CardPayload is the payload of the button of the contact card.
+func CardPayload(action Action, contactID int) Payload {
+	return Payload{Action: action, ContactID: contactID}
+}
+
+// SetLanguagePayload is the payload of the button choosing the language.
+func SetLanguagePayload(lang i18n.Lang) Payload {
+	return Payload{Action: SetLanguage, Arg: string(lang)}
+}
+
+// ToggleFieldPayload is the payload of the button hiding or showing the field in lists.
+func ToggleFieldPayload(field types.CardField) Payload {
+	return Payload{Action: SettingsToggleField, Arg: string(field)}
+}
+
+// MergePayload is the payload of the button merging the other contact into the kept one.
+func MergePayload(keepID, otherID, page int) Payload {
+	return Payload{Action: MergeDuplicates, ContactID: keepID, Page: page, Arg: strconv.Itoa(otherID)}
+}
+
+// ReminderPayload is the payload of the button of the reminder.
+func ReminderPayload(action Action, reminderID int) Payload {
+	return Payload{Action: action, Arg: strconv.Itoa(reminderID)}
+}
+
+// WebhookPayload is the payload of the button removing the webhook.
+func WebhookPayload(webhookID int) Payload {
+	return Payload{Action: WebhookRemove, Arg: strconv.Itoa(webhookID)}
+}
+
+// ErrInvalidData means that the data was not made by the bot for the user who pressed
+// the button, or was made by another version of the bot.
+var ErrInvalidData = errors.New("invalid callback data")
+
+// Codec turns payloads into the data of the buttons and back. The data is signed for the
+// user the button is sent to, so that it cannot be forged or pressed by another user.
+//
+// The data is "1:action:contact:page:arg:signature" with the numbers in base 36 and the
+// zero values left empty.
+type Codec struct {
+	secret []byte
+}
+
+func NewCodec(secret []byte) *Codec {
+	return &Codec{secret: secret}
+}
+
+// Encode makes the data of the button sent to the user. It panics when the data does not
+// fit into MaxDataLength, as the payloads are made by the bot itself.
+func (c *Codec) Encode(userID int64, p Payload) string {
+	body := strings.Join([]string{
+		version,
+		string(p.Action),
+		formatNumber(p.ContactID),
+		formatNumber(p.Page),
+		p.Arg,
+	}, ":")
+	data := body + ":" + c.sign(userID, body)
+
+	if len(data) > MaxDataLength {
+		panic("callbacks: data of " + string(p.Action) + " is longer than " + strconv.Itoa(MaxDataLength) + " bytes")
+	}
+	return data
+}
+
+// Decode checks the data of the button pressed by the user and returns its payload.
+func (c *Codec) Decode(userID int64, data string) (Payload, error) {
+	sep := strings.LastIndex(data, ":")
+	if sep < 0 {
+		return Payload{}, errors.Wrap(ErrInvalidData, "no signature")
+	}
+	body, signature := data[:sep], data[sep+1:]
+
+	if !hmac.Equal([]byte(signature), []byte(c.sign(userID, body))) {
+		return Payload{}, errors.Wrap(ErrInvalidData, "wrong signature")
+	}
+
+	// The argument is the last field, so it may have colons itself.
+	fields := strings.SplitN(body, ":", 5)
+	if len(fields) != 5 || fields[0] != version {
+		return Payload{}, errors.Wrap(ErrInvalidData, "unknown version")
+	}
+
+	contactID, err := parseNumber(fields[2])
+	if err != nil {
+		return Payload{}, errors.Wrap(ErrInvalidData, "wrong contact ID")
+	}
+	page, err := parseNumber(fields[3])
+	if err != nil {
+		return Payload{}, errors.Wrap(ErrInvalidData, "wrong page")
+	}
+
+	return Payload{
+		Action:    Action(fields[1]),
+		ContactID: contactID,
+		Page:      page,
+		Arg:       fields[4],
+	}, nil
+}
+
+func (c *Codec) sign(userID int64, body string) string {
+	mac := hmac.New(sha256.New, c.secret)
+	_ = binary.Write(mac, binary.BigEndian, userID)
+	mac.Write([]byte(body))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:signatureLength])
+}
+
+func formatNumber(n int) string {
+	if n == 0 {
+		return ""
+	}
+	return strconv.FormatInt(int64(n), 36)
+}
+
+func parseNumber(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseInt(s, 36, 64)
+	return int(n), err
+}
@@ -0,0 +1,101 @@
+package callbacks
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/profectus200/contact-book-bot/internal/i18n"
+	"github.com/profectus200/contact-book-bot/internal/types"
+	"go.uber.org/zap"
+)
+
+// snoozeReminder makes the delivered reminder come again later.
+func (s *Model) snoozeReminder(ctx context.Context, data *CallbackData, arg string) error {
+	reminder, err := s.pressedReminder(ctx, data, arg)
+	if err != nil || reminder == nil {
+		return err
+	}
+
+	dueAt := time.Now().Add(types.ReminderSnooze).Truncate(time.Minute)
+	err = s.contactsDB.SnoozeReminder(ctx, data.FromID, reminder.ID, dueAt)
+	if err != nil {
+		return errors.Wrap(err, "cannot SnoozeReminder")
+	}
+	s.log(ctx).Debug("Reminder snoozed", zap.Int("reminder_id", reminder.ID), zap.Time("due_at", dueAt))
+
+	err = s.tgClient.ShowAlert(ctx, "", data.CallbackID)
+	if err != nil {
+		return errors.Wrap(err, "cannot ShowAlert")
+	}
+	text := data.Lang.T(i18n.ReminderSnoozed, reminder.ToString(data.Lang), types.FormatDueAt(dueAt, data.Settings.Location()))
+	return s.tgClient.EditMessage(ctx, text, data.FromID, data.MessageID)
+}
+
+// completeReminder removes the delivered reminder as done.
+func (s *Model) completeReminder(ctx context.Context, data *CallbackData, arg string) error {
+	reminder, err := s.pressedReminder(ctx, data, arg)
+	if err != nil || reminder == nil {
+		return err
+	}
+
+	err = s.contactsDB.DeleteReminder(ctx, data.FromID, reminder.ID)
+	if err != nil {
+		return errors.Wrap(err, "cannot DeleteReminder")
+	}
+
+	err = s.tgClient.ShowAlert(ctx, "", data.CallbackID)
+	if err != nil {
+		return errors.Wrap(err, "cannot ShowAlert")
+	}
+	return s.tgClient.EditMessage(ctx, data.Lang.T(i18n.ReminderDone, reminder.ToString(data.Lang)), data.FromID, data.MessageID)
+}
+
+// pressedReminder returns the reminder of the button, or tells the user that the button is
+// outdated and returns nil when the reminder is gone with its contact.
+func (s *Model) pressedReminder(ctx context.Context, data *CallbackData, arg string) (*types.Reminder, error) {
+	reminderID, err := strconv.Atoi(arg)
+	if err != nil {
+		return nil, errors.Wrapf(err, "wrong ID of the reminder %q", arg)
+	}
+
+	reminder, err := s.contactsDB.GetReminder(ctx, data.FromID, reminderID)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot GetReminder")
+	}
+	if reminder == nil {
+		return nil, s.tgClient.ShowAlert(ctx, data.Lang.T(i18n.ButtonOutdated), data.CallbackID)
+	}
+	return reminder, nil
+}
+
+// cancelReminder removes the reminder from /reminders and shows the ones left.
+func (s *Model) cancelReminder(ctx context.Context, data *CallbackData, arg string) error {
+	reminderID, err := strconv.Atoi(arg)
+	if err != nil {
+		return errors.Wrapf(err, "wrong ID of the reminder %q", arg)
+	}
+
+	err = s.contactsDB.DeleteReminder(ctx, data.FromID, reminderID)
+	if err != nil {
+		return errors.Wrap(err, "cannot DeleteReminder")
+	}
+	s.log(ctx).Debug("Reminder cancelled", zap.Int("reminder_id", reminderID))
+
+	err = s.tgClient.ShowAlert(ctx, data.Lang.T(i18n.ReminderCancelled), data.CallbackID)
+	if err != nil {
+		return errors.Wrap(err, "cannot ShowAlert")
+	}
+
+	reminders, err := s.contactsDB.GetReminders(ctx, data.FromID)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetReminders")
+	}
+	if len(reminders) == 0 {
+		return s.tgClient.EditMessage(ctx, data.Lang.T(i18n.NoReminders), data.FromID, data.MessageID)
+	}
+	reminders = types.ListedReminders(reminders)
+	text := types.ListReminders(reminders, data.Lang, data.Settings.Location())
+	return s.tgClient.EditReminders(ctx, text, data.FromID, data.MessageID, reminders, data.Lang)
+}
@@ -0,0 +1,23 @@
+package callbacks
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/profectus200/contact-book-bot/internal/i18n"
+)
+
+// removeWebhook removes the webhook from /webhooks and shows the ones left.
+func (s *Model) removeWebhook(ctx context.Context, data *CallbackData, arg string) error {
+	webhookID, err := strconv.Atoi(arg)
+	if err != nil {
+		return errors.Wrapf(err, "wrong ID of the webhook %q", arg)
+	}
+
+	err = s.webhooks.RemoveWebhook(ctx, data.FromID, data.MessageID, webhookID, data.Lang)
+	if err != nil {
+		return errors.Wrap(err, "cannot RemoveWebhook")
+	}
+	return s.tgClient.ShowAlert(ctx, data.Lang.T(i18n.WebhookRemoved), data.CallbackID)
+}
@@ -0,0 +1,306 @@
+// Package carddav is a minimal CardDAV server (RFC 6352) of the contacts, so that phones
+// and mail apps sync them both ways. Every user has a single address book and signs in
+// with the ID in Telegram and an app password given by the /carddav command.
+package carddav
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+	"github.com/profectus200/contact-book-bot/cmd/logging"
+	"github.com/profectus200/contact-book-bot/internal/i18n"
+	"github.com/profectus200/contact-book-bot/internal/types"
+	"go.uber.org/zap"
+)
+
+const (
+	// PathPrefix is the path of the server on the HTTP server.
+	PathPrefix = "/carddav/"
+	// WellKnownPath is where the clients look for the server first, see RFC 6764.
+	WellKnownPath = "/.well-known/carddav"
+
+	// addressBook is the name of the single address book of a user.
+	addressBook = "contacts"
+	// displayName is the name the clients show for the address book.
+	displayName = "Contact book"
+	// passwordLength is the number of random bytes in a password, which is longer in base64.
+	passwordLength = 18
+	// maxBodySize limits the requests, vCards with photos included.
+	maxBodySize = 1 << 20
+)
+
+type messageSender interface {
+	SendMessage(ctx context.Context, text string, userID int64) error
+}
+
+type contactsDB interface {
+	WriteContact(ctx context.Context, userID int64, contact *types.Contact) error
+	GetAllContacts(ctx context.Context, userID int64) ([]*types.Contact, error)
+	DeleteContact(ctx context.Context, userID int64, contactID int) error
+	WriteName(ctx context.Context, name string, userID int64, contactID int) error
+	WriteEmail(ctx context.Context, email string, userID int64, contactID int) error
+	WritePhone(ctx context.Context, phone string, userID int64, contactID int) error
+	WriteBirthday(ctx context.Context, birthday *types.Birthday, userID int64, contactID int) error
+	WriteDescription(ctx context.Context, description string, userID int64, contactID int) error
+	GetCardResources(ctx context.Context, userID int64) ([]types.CardResource, error)
+	WriteCardResource(ctx context.Context, userID int64, resource types.CardResource) error
+}
+
+type usersDB interface {
+	LockUser(ctx context.Context, userID int64) error
+	ToWaitState(ctx context.Context, userID int64) error
+	GetCardDAVPassword(ctx context.Context, userID int64) (string, error)
+	SetCardDAVPassword(ctx context.Context, userID int64, hash string) error
+	NextExternalContactID(ctx context.Context, userID int64) (int, error)
+}
+
+type txManager interface {
+	InTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type accessChecker interface {
+	AllowsUser(ctx context.Context, userID int64) (bool, error)
+}
+
+type Model struct {
+	tgClient   messageSender
+	contactsDB contactsDB
+	usersDB    usersDB
+	txManager  txManager
+	access     accessChecker
+	// publicURL is where the HTTP server is reachable by the clients,
+	// empty when the bot serves no CardDAV.
+	publicURL string
+	// basePath is the path of publicURL, for a server behind a proxy under a path.
+	basePath string
+	logger   *zap.Logger
+}
+
+func New(tgClient messageSender, contactsDB contactsDB, usersDB usersDB, txManager txManager,
+	access accessChecker, publicURL string, logger *zap.Logger) *Model {
+	publicURL = strings.TrimSuffix(publicURL, "/")
+
+	var basePath string
+	if parsed, err := url.Parse(publicURL); err == nil {
+		basePath = strings.TrimSuffix(parsed.Path, "/")
+	}
+
+	return &Model{
+		tgClient:   tgClient,
+		contactsDB: contactsDB,
+		usersDB:    usersDB,
+		txManager:  txManager,
+		access:     access,
+		publicURL:  publicURL,
+		basePath:   basePath,
+		logger:     logger.Named("carddav"),
+	}
+}
+
+// IssuePassword gives the user a new app password and tells how to add the account,
+// the old password stops working.
+func (m *Model) IssuePassword(ctx context.Context, userID int64, lang i18n.Lang) error {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"IssueCardDAVPassword",
+	)
+	defer span.Finish()
+
+	if m.publicURL == "" {
+		return m.tgClient.SendMessage(ctx, lang.T(i18n.CardDAVUnavailable), userID)
+	}
+
+	secret := make([]byte, passwordLength)
+	if _, err := rand.Read(secret); err != nil {
+		return errors.Wrap(err, "cannot read random bytes")
+	}
+	password := base64.RawURLEncoding.EncodeToString(secret)
+
+	if err := m.usersDB.SetCardDAVPassword(ctx, userID, hashPassword(password)); err != nil {
+		return errors.Wrap(err, "cannot SetCardDAVPassword")
+	}
+	m.log(ctx).Info("CardDAV password issued")
+
+	text := lang.T(i18n.CardDAVAccount, m.publicURL+PathPrefix, strconv.FormatInt(userID, 10), password)
+	return m.tgClient.SendMessage(ctx, text, userID)
+}
+
+// hashPassword is what is kept of a password. The passwords are random and long, so a
+// plain hash is enough to keep a leaked database from giving them away.
+func hashPassword(password string) string {
+	sum := sha256.Sum256([]byte(password))
+	return hex.EncodeToString(sum[:])
+}
+
+// ServeHTTP serves the address books of the users signed in with Basic authentication.
+func (m *Model) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	span, ctx := opentracing.StartSpanFromContext(
+		r.Context(),
+		"ServeCardDAV",
+	)
+	span.SetTag("method", r.Method)
+	defer span.Finish()
+
+	if r.URL.Path == WellKnownPath {
+		http.Redirect(w, r, m.basePath+PathPrefix, http.StatusMovedPermanently)
+		return
+	}
+	// The clients ask what the server can do before signing in.
+	if r.Method == http.MethodOptions {
+		w.Header().Set("DAV", "1, 3, addressbook")
+		w.Header().Set("Allow", "OPTIONS, PROPFIND, REPORT, GET, HEAD, PUT, DELETE")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	userID, ok, err := m.authenticate(ctx, r)
+	if err != nil {
+		m.fail(ctx, w, errors.Wrap(err, "cannot authenticate"))
+		return
+	}
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Basic realm="`+displayName+`", charset="UTF-8"`)
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	ctx = logging.WithLogger(ctx, m.logger.With(zap.Int64("user_id", userID)))
+
+	t, ok := parseTarget(strings.TrimPrefix(r.URL.Path, PathPrefix), userID)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+
+	switch r.Method {
+	case "PROPFIND":
+		err = m.propfind(ctx, w, r, userID, t)
+	case "REPORT":
+		err = m.report(ctx, w, r, userID, t)
+	case http.MethodGet, http.MethodHead:
+		err = m.getCard(ctx, w, r, userID, t)
+	case http.MethodPut:
+		err = m.putCard(ctx, w, r, userID, t)
+	case http.MethodDelete:
+		err = m.deleteCard(ctx, w, r, userID, t)
+	default:
+		w.Header().Set("Allow", "OPTIONS, PROPFIND, REPORT, GET, HEAD, PUT, DELETE")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+	if err != nil {
+		m.fail(ctx, w, err)
+	}
+}
+
+// authenticate checks the ID and the app password of the user.
+// It is false when they are missing or wrong, or the user may not use the bot.
+func (m *Model) authenticate(ctx context.Context, r *http.Request) (int64, bool, error) {
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return 0, false, nil
+	}
+	userID, err := strconv.ParseInt(username, 10, 64)
+	if err != nil {
+		return 0, false, nil
+	}
+
+	hash, err := m.usersDB.GetCardDAVPassword(ctx, userID)
+	if err != nil {
+		return 0, false, errors.Wrap(err, "cannot GetCardDAVPassword")
+	}
+	if hash == "" || subtle.ConstantTimeCompare([]byte(hashPassword(password)), []byte(hash)) != 1 {
+		return 0, false, nil
+	}
+
+	allowed, err := m.access.AllowsUser(ctx, userID)
+	if err != nil {
+		return 0, false, errors.Wrap(err, "cannot AllowsUser")
+	}
+	return userID, allowed, nil
+}
+
+// fail answers the request failed with the error, with the status of a statusError.
+func (m *Model) fail(ctx context.Context, w http.ResponseWriter, err error) {
+	var status statusError
+	if errors.As(err, &status) {
+		http.Error(w, http.StatusText(int(status)), int(status))
+		return
+	}
+
+	m.log(ctx).Error("Cannot serve CardDAV request", zap.Error(err))
+	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+}
+
+// statusError is an error of the client answered with the status.
+type statusError int
+
+func (e statusError) Error() string {
+	return http.StatusText(int(e))
+}
+
+// targetKind is what a path leads to.
+type targetKind int
+
+const (
+	// targetRoot is the root of the server, pointing the clients to the user.
+	targetRoot targetKind = iota
+	// targetHome is the principal of the user, which is the home of the address book too.
+	targetHome
+	targetBook
+	targetCard
+)
+
+type target struct {
+	kind targetKind
+	// name is the name of the vCard of targetCard.
+	name string
+}
+
+// parseTarget reads the path after PathPrefix: "", "<user ID>/", "<user ID>/contacts/" or
+// "<user ID>/contacts/<name>". The paths of the other users are not found.
+func parseTarget(path string, userID int64) (target, bool) {
+	path = strings.TrimSuffix(path, "/")
+	if path == "" {
+		return target{kind: targetRoot}, true
+	}
+
+	segments := strings.Split(path, "/")
+	if segments[0] != strconv.FormatInt(userID, 10) {
+		return target{}, false
+	}
+	switch {
+	case len(segments) == 1:
+		return target{kind: targetHome}, true
+	case len(segments) == 2 && segments[1] == addressBook:
+		return target{kind: targetBook}, true
+	case len(segments) == 3 && segments[1] == addressBook && segments[2] != "":
+		return target{kind: targetCard, name: segments[2]}, true
+	}
+	return target{}, false
+}
+
+func (m *Model) homeHref(userID int64) string {
+	return m.basePath + PathPrefix + strconv.FormatInt(userID, 10) + "/"
+}
+
+func (m *Model) bookHref(userID int64) string {
+	return m.homeHref(userID) + addressBook + "/"
+}
+
+func (m *Model) cardHref(userID int64, name string) string {
+	return m.bookHref(userID) + url.PathEscape(name)
+}
+
+func (m *Model) log(ctx context.Context) *zap.Logger {
+	return logging.FromContext(ctx, m.logger)
+}
@@ -0,0 +1,272 @@
+package carddav
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/profectus200/contact-book-bot/internal/types"
+	"go.uber.org/zap"
+)
+
+// cardName is how the vCards of the contacts added in the bot are named.
+var cardName = regexp.MustCompile(`^contact-(-?\d+)\.vcf$`)
+
+// card is the vCard of a contact.
+type card struct {
+	name    string
+	contact *types.Contact
+	data    []byte
+	// etag is the hash of the data, so it changes with any field in the vCard.
+	etag string
+}
+
+// cards renders the vCards of all the contacts of the user, ordered by the name.
+func (m *Model) cards(ctx context.Context, userID int64) ([]card, error) {
+	contacts, err := m.contactsDB.GetAllContacts(ctx, userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot GetAllContacts")
+	}
+	resources, err := m.contactsDB.GetCardResources(ctx, userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot GetCardResources")
+	}
+
+	byID := make(map[int]types.CardResource, len(resources))
+	for _, resource := range resources {
+		byID[resource.ContactID] = resource
+	}
+
+	cards := make([]card, 0, len(contacts))
+	for _, contact := range contacts {
+		resource, ok := byID[contact.ContactID]
+		if !ok {
+			resource = types.CardResource{
+				Name: fmt.Sprintf("contact-%d.vcf", contact.ContactID),
+				UID:  fmt.Sprintf("%d-%d@contact-book-bot", userID, contact.ContactID),
+			}
+		}
+
+		data := types.VCard(contact, resource.UID)
+		sum := sha256.Sum256(data)
+		cards = append(cards, card{
+			name:    resource.Name,
+			contact: contact,
+			data:    data,
+			etag:    `"` + hex.EncodeToString(sum[:16]) + `"`,
+		})
+	}
+	sort.Slice(cards, func(i, j int) bool {
+		return cards[i].name < cards[j].name
+	})
+
+	return cards, nil
+}
+
+func findCard(cards []card, name string) *card {
+	for i := range cards {
+		if cards[i].name == name {
+			return &cards[i]
+		}
+	}
+	return nil
+}
+
+// ctag changes with any vCard of the address book, so that the clients know when to sync.
+func ctag(cards []card) string {
+	hash := sha256.New()
+	for _, card := range cards {
+		fmt.Fprintf(hash, "%s %s\n", card.name, card.etag)
+	}
+	return hex.EncodeToString(hash.Sum(nil)[:16])
+}
+
+func (m *Model) getCard(ctx context.Context, w http.ResponseWriter, r *http.Request, userID int64, t target) error {
+	if t.kind != targetCard {
+		return statusError(http.StatusMethodNotAllowed)
+	}
+
+	cards, err := m.cards(ctx, userID)
+	if err != nil {
+		return err
+	}
+	found := findCard(cards, t.name)
+	if found == nil {
+		return statusError(http.StatusNotFound)
+	}
+
+	w.Header().Set("Content-Type", "text/vcard; charset=utf-8")
+	w.Header().Set("ETag", found.etag)
+	if match := r.Header.Get("If-None-Match"); match != "" && matchesETag(match, found.etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+	if r.Method == http.MethodHead {
+		w.Header().Set("Content-Length", strconv.Itoa(len(found.data)))
+		return nil
+	}
+	_, _ = w.Write(found.data)
+	return nil
+}
+
+// putCard creates the contact or updates the fields kept in vCards. The other fields of
+// the contact, like the photo and the custom fields, are kept.
+func (m *Model) putCard(ctx context.Context, w http.ResponseWriter, r *http.Request, userID int64, t target) error {
+	if t.kind != targetCard {
+		return statusError(http.StatusMethodNotAllowed)
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return statusError(http.StatusRequestEntityTooLarge)
+	}
+	contact, uid, err := types.ParseVCard(body)
+	if err != nil {
+		m.log(ctx).Debug("Cannot parse vCard", zap.Error(err))
+		return statusError(http.StatusBadRequest)
+	}
+
+	created := false
+	err = m.txManager.InTx(ctx, func(ctx context.Context) error {
+		err := m.usersDB.LockUser(ctx, userID)
+		if err != nil {
+			return errors.Wrap(err, "cannot LockUser")
+		}
+
+		cards, err := m.cards(ctx, userID)
+		if err != nil {
+			return err
+		}
+		found := findCard(cards, t.name)
+		if err := checkPreconditions(r, found); err != nil {
+			return err
+		}
+
+		if found != nil {
+			return m.updateContact(ctx, userID, found.contact.ContactID, contact)
+		}
+
+		// The names of the vCards of the contacts added in the bot are not for the clients.
+		if cardName.MatchString(t.name) {
+			return statusError(http.StatusForbidden)
+		}
+		created = true
+		if contact.ContactID, err = m.usersDB.NextExternalContactID(ctx, userID); err != nil {
+			return errors.Wrap(err, "cannot NextExternalContactID")
+		}
+		if err := m.contactsDB.WriteContact(ctx, userID, contact); err != nil {
+			return errors.Wrap(err, "cannot WriteContact")
+		}
+		if uid == "" {
+			uid = fmt.Sprintf("%d-%d@contact-book-bot", userID, contact.ContactID)
+		}
+		resource := types.CardResource{ContactID: contact.ContactID, Name: t.name, UID: uid}
+		return errors.Wrap(m.contactsDB.WriteCardResource(ctx, userID, resource), "cannot WriteCardResource")
+	})
+	if err != nil {
+		return err
+	}
+
+	// No ETag: the vCard kept is not the one sent, the clients have to get it again.
+	if created {
+		m.log(ctx).Info("Contact added over CardDAV", zap.Int("contact_id", contact.ContactID))
+		w.WriteHeader(http.StatusCreated)
+		return nil
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// updateContact writes the fields kept in vCards, the ones missing from the vCard are removed.
+func (m *Model) updateContact(ctx context.Context, userID int64, contactID int, contact *types.Contact) error {
+	if err := m.contactsDB.WriteName(ctx, contact.Name, userID, contactID); err != nil {
+		return errors.Wrap(err, "cannot WriteName")
+	}
+	if err := m.contactsDB.WritePhone(ctx, contact.Phone, userID, contactID); err != nil {
+		return errors.Wrap(err, "cannot WritePhone")
+	}
+	if err := m.contactsDB.WriteEmail(ctx, contact.Email, userID, contactID); err != nil {
+		return errors.Wrap(err, "cannot WriteEmail")
+	}
+	if err := m.contactsDB.WriteBirthday(ctx, contact.Birthday, userID, contactID); err != nil {
+		return errors.Wrap(err, "cannot WriteBirthday")
+	}
+	if err := m.contactsDB.WriteDescription(ctx, contact.Description, userID, contactID); err != nil {
+		return errors.Wrap(err, "cannot WriteDescription")
+	}
+	return nil
+}
+
+func (m *Model) deleteCard(ctx context.Context, w http.ResponseWriter, r *http.Request, userID int64, t target) error {
+	if t.kind != targetCard {
+		return statusError(http.StatusForbidden)
+	}
+
+	var contactID int
+	err := m.txManager.InTx(ctx, func(ctx context.Context) error {
+		err := m.usersDB.LockUser(ctx, userID)
+		if err != nil {
+			return errors.Wrap(err, "cannot LockUser")
+		}
+
+		cards, err := m.cards(ctx, userID)
+		if err != nil {
+			return err
+		}
+		found := findCard(cards, t.name)
+		if found == nil {
+			return statusError(http.StatusNotFound)
+		}
+		if err := checkPreconditions(r, found); err != nil {
+			return err
+		}
+
+		contactID = found.contact.ContactID
+		if err := m.contactsDB.DeleteContact(ctx, userID, contactID); err != nil {
+			return errors.Wrap(err, "cannot DeleteContact")
+		}
+		// The user may have been editing the deleted contact.
+		return errors.Wrap(m.usersDB.ToWaitState(ctx, userID), "cannot ToWaitState")
+	})
+	if err != nil {
+		return err
+	}
+	m.log(ctx).Info("Contact deleted over CardDAV", zap.Int("contact_id", contactID))
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// checkPreconditions checks If-Match and If-None-Match of the request changing the vCard,
+// nil when there is no vCard yet.
+func checkPreconditions(r *http.Request, found *card) error {
+	if match := r.Header.Get("If-Match"); match != "" {
+		if found == nil || (strings.TrimSpace(match) != "*" && !matchesETag(match, found.etag)) {
+			return statusError(http.StatusPreconditionFailed)
+		}
+	}
+	if match := r.Header.Get("If-None-Match"); match != "" && found != nil {
+		if strings.TrimSpace(match) == "*" || matchesETag(match, found.etag) {
+			return statusError(http.StatusPreconditionFailed)
+		}
+	}
+	return nil
+}
+
+// matchesETag tells whether the list of ETags in the header has the ETag.
+func matchesETag(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,330 @@
+package carddav
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// Namespaces of the properties.
+const (
+	nsDAV     = "DAV:"
+	nsCardDAV = "urn:ietf:params:xml:ns:carddav"
+	// nsCalendarServer has getctag, which the clients use to see whether to sync at all.
+	nsCalendarServer = "http://calendarserver.org/ns/"
+)
+
+// Statuses of the properties and the resources in the responses.
+const (
+	statusOK       = "HTTP/1.1 200 OK"
+	statusNotFound = "HTTP/1.1 404 Not Found"
+)
+
+var propAddressData = xml.Name{Space: nsCardDAV, Local: "address-data"}
+
+// propfindRequest is the body of PROPFIND, an empty one asks for all the properties.
+type propfindRequest struct {
+	XMLName  xml.Name   `xml:"DAV: propfind"`
+	AllProp  *struct{}  `xml:"DAV: allprop"`
+	PropName *struct{}  `xml:"DAV: propname"`
+	Prop     *propNames `xml:"DAV: prop"`
+}
+
+// reportRequest is the body of REPORT, the hrefs are of addressbook-multiget.
+type reportRequest struct {
+	XMLName xml.Name
+	Prop    *propNames `xml:"DAV: prop"`
+	Hrefs   []string   `xml:"DAV: href"`
+}
+
+type propNames struct {
+	Names []anyElement `xml:",any"`
+}
+
+type anyElement struct {
+	XMLName xml.Name
+}
+
+type multistatus struct {
+	XMLName   xml.Name   `xml:"DAV: multistatus"`
+	Responses []response `xml:"response"`
+}
+
+type response struct {
+	Href      string     `xml:"href"`
+	Propstats []propstat `xml:"propstat,omitempty"`
+	Status    string     `xml:"status,omitempty"`
+}
+
+type propstat struct {
+	Prop   propList `xml:"prop"`
+	Status string   `xml:"status"`
+}
+
+type propList struct {
+	Props []property
+}
+
+// property is a property with its value as XML.
+type property struct {
+	XMLName xml.Name
+	Inner   string `xml:",innerxml"`
+}
+
+func (m *Model) propfind(ctx context.Context, w http.ResponseWriter, r *http.Request, userID int64, t target) error {
+	var req propfindRequest
+	if err := decodeBody(r, &req); err != nil {
+		m.log(ctx).Debug("Cannot parse PROPFIND", zap.Error(err))
+		return statusError(http.StatusBadRequest)
+	}
+	var names []xml.Name
+	if req.Prop != nil && req.AllProp == nil {
+		for _, name := range req.Prop.Names {
+			names = append(names, name.XMLName)
+		}
+	}
+
+	// Depth 1 adds the children, "infinity" is not supported and taken for 1.
+	depth := r.Header.Get("Depth")
+	children := depth != "0"
+
+	var cards []card
+	if t.kind != targetRoot {
+		var err error
+		if cards, err = m.cards(ctx, userID); err != nil {
+			return err
+		}
+	}
+
+	var responses []response
+	switch t.kind {
+	case targetRoot:
+		responses = append(responses, m.collectionResponse(userID, m.basePath+PathPrefix, false, nil, names))
+		if children {
+			responses = append(responses, m.collectionResponse(userID, m.homeHref(userID), true, nil, names))
+		}
+	case targetHome:
+		responses = append(responses, m.collectionResponse(userID, m.homeHref(userID), true, nil, names))
+		if children {
+			responses = append(responses, m.collectionResponse(userID, m.bookHref(userID), false, cards, names))
+		}
+	case targetBook:
+		responses = append(responses, m.collectionResponse(userID, m.bookHref(userID), false, cards, names))
+		if children {
+			for _, card := range cards {
+				responses = append(responses, m.cardResponse(userID, card, names))
+			}
+		}
+	case targetCard:
+		found := findCard(cards, t.name)
+		if found == nil {
+			return statusError(http.StatusNotFound)
+		}
+		responses = append(responses, m.cardResponse(userID, *found, names))
+	}
+
+	return writeMultistatus(w, responses)
+}
+
+func (m *Model) report(ctx context.Context, w http.ResponseWriter, r *http.Request, userID int64, t target) error {
+	if t.kind != targetBook {
+		return statusError(http.StatusForbidden)
+	}
+
+	var req reportRequest
+	if err := decodeBody(r, &req); err != nil {
+		m.log(ctx).Debug("Cannot parse REPORT", zap.Error(err))
+		return statusError(http.StatusBadRequest)
+	}
+	names := []xml.Name{{Space: nsDAV, Local: "getetag"}, propAddressData}
+	if req.Prop != nil {
+		names = names[:0]
+		for _, name := range req.Prop.Names {
+			names = append(names, name.XMLName)
+		}
+	}
+
+	cards, err := m.cards(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	var responses []response
+	switch req.XMLName {
+	case xml.Name{Space: nsCardDAV, Local: "addressbook-multiget"}:
+		for _, href := range req.Hrefs {
+			href = strings.TrimSpace(href)
+			name, err := url.PathUnescape(path.Base(href))
+			if err != nil {
+				return statusError(http.StatusBadRequest)
+			}
+			if found := findCard(cards, name); found != nil {
+				responses = append(responses, m.cardResponse(userID, *found, names))
+			} else {
+				responses = append(responses, response{Href: href, Status: statusNotFound})
+			}
+		}
+	case xml.Name{Space: nsCardDAV, Local: "addressbook-query"}:
+		// The filters are not supported, the clients get every vCard and filter them.
+		for _, card := range cards {
+			responses = append(responses, m.cardResponse(userID, card, names))
+		}
+	default:
+		return statusError(http.StatusForbidden)
+	}
+
+	return writeMultistatus(w, responses)
+}
+
+// collectionResponse describes the root, the home of the user or, with home false, the
+// address book when the cards are given. Without names it has all the properties.
+func (m *Model) collectionResponse(userID int64, href string, home bool, cards []card, names []xml.Name) response {
+	resourceType := davElement("collection")
+	if home {
+		resourceType += davElement("principal")
+	}
+	isBook := href == m.bookHref(userID)
+	if isBook {
+		resourceType += `<addressbook xmlns="` + nsCardDAV + `"/>`
+	}
+
+	props := []property{
+		{XMLName: xml.Name{Space: nsDAV, Local: "resourcetype"}, Inner: resourceType},
+		{XMLName: xml.Name{Space: nsDAV, Local: "current-user-principal"}, Inner: hrefElement(m.homeHref(userID))},
+		{XMLName: xml.Name{Space: nsDAV, Local: "principal-URL"}, Inner: hrefElement(m.homeHref(userID))},
+		{XMLName: xml.Name{Space: nsCardDAV, Local: "addressbook-home-set"}, Inner: hrefElement(m.homeHref(userID))},
+		{XMLName: xml.Name{Space: nsDAV, Local: "displayname"}, Inner: escapeText(displayName)},
+	}
+	if isBook {
+		props = append(props,
+			property{XMLName: xml.Name{Space: nsCalendarServer, Local: "getctag"}, Inner: escapeText(ctag(cards))},
+			property{XMLName: xml.Name{Space: nsDAV, Local: "current-user-privilege-set"}, Inner: privileges()},
+			property{XMLName: xml.Name{Space: nsDAV, Local: "supported-report-set"}, Inner: supportedReports()},
+			property{XMLName: xml.Name{Space: nsCardDAV, Local: "supported-address-data"},
+				Inner: `<address-data-type xmlns="` + nsCardDAV + `" content-type="text/vcard" version="3.0"/>`},
+			property{XMLName: xml.Name{Space: nsCardDAV, Local: "max-resource-size"}, Inner: strconv.Itoa(maxBodySize)},
+		)
+	}
+	return propResponse(href, props, names)
+}
+
+// cardResponse describes the vCard, with the vCard itself only when it is asked for.
+func (m *Model) cardResponse(userID int64, card card, names []xml.Name) response {
+	props := []property{
+		{XMLName: xml.Name{Space: nsDAV, Local: "resourcetype"}},
+		{XMLName: xml.Name{Space: nsDAV, Local: "getetag"}, Inner: escapeText(card.etag)},
+		{XMLName: xml.Name{Space: nsDAV, Local: "getcontenttype"}, Inner: "text/vcard; charset=utf-8"},
+		{XMLName: xml.Name{Space: nsDAV, Local: "current-user-privilege-set"}, Inner: privileges()},
+	}
+	for _, name := range names {
+		if name == propAddressData {
+			props = append(props, property{XMLName: propAddressData, Inner: escapeText(string(card.data))})
+		}
+	}
+	return propResponse(m.cardHref(userID, card.name), props, names)
+}
+
+// propResponse has the properties asked for, and those missing as not found.
+// Without names it has all the properties.
+func propResponse(href string, props []property, names []xml.Name) response {
+	if len(names) == 0 {
+		return response{Href: href, Propstats: []propstat{{Prop: propList{Props: props}, Status: statusOK}}}
+	}
+
+	var found, missing []property
+	for _, name := range names {
+		property, ok := findProperty(props, name)
+		if ok {
+			found = append(found, property)
+		} else {
+			missing = append(missing, property)
+		}
+	}
+
+	resp := response{Href: href}
+	if len(found) > 0 {
+		resp.Propstats = append(resp.Propstats, propstat{Prop: propList{Props: found}, Status: statusOK})
+	}
+	if len(missing) > 0 {
+		resp.Propstats = append(resp.Propstats, propstat{Prop: propList{Props: missing}, Status: statusNotFound})
+	}
+	return resp
+}
+
+// findProperty returns the property with the name, or an empty one when there is none.
+func findProperty(props []property, name xml.Name) (property, bool) {
+	for _, property := range props {
+		if property.XMLName == name {
+			return property, true
+		}
+	}
+	return property{XMLName: name}, false
+}
+
+func privileges() string {
+	var b strings.Builder
+	for _, privilege := range []string{"read", "write", "write-content", "bind", "unbind", "read-current-user-privilege-set"} {
+		b.WriteString(davElement("privilege", davElement(privilege)))
+	}
+	return b.String()
+}
+
+func supportedReports() string {
+	var b strings.Builder
+	for _, report := range []string{"addressbook-multiget", "addressbook-query"} {
+		b.WriteString(davElement("supported-report", davElement("report", `<`+report+` xmlns="`+nsCardDAV+`"/>`)))
+	}
+	return b.String()
+}
+
+// davElement is an element of the DAV: namespace with the inner XML.
+func davElement(name string, inner ...string) string {
+	if len(inner) == 0 {
+		return `<` + name + ` xmlns="` + nsDAV + `"/>`
+	}
+	return `<` + name + ` xmlns="` + nsDAV + `">` + strings.Join(inner, "") + `</` + name + `>`
+}
+
+func hrefElement(href string) string {
+	return davElement("href", escapeText(href))
+}
+
+func escapeText(text string) string {
+	var b bytes.Buffer
+	_ = xml.EscapeText(&b, []byte(text))
+	return b.String()
+}
+
+// decodeBody reads the XML of the request, leaving v empty when there is none.
+func decodeBody(r *http.Request, v any) error {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return errors.Wrap(err, "cannot read body")
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil
+	}
+	return errors.Wrap(xml.Unmarshal(body, v), "cannot Unmarshal")
+}
+
+func writeMultistatus(w http.ResponseWriter, responses []response) error {
+	data, err := xml.Marshal(multistatus{Responses: responses})
+	if err != nil {
+		return errors.Wrap(err, "cannot Marshal")
+	}
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	_, _ = w.Write([]byte(xml.Header))
+	_, _ = w.Write(data)
+	return nil
+}
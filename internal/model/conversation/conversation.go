@@ -0,0 +1,225 @@
+// Package conversation runs the conversations of the bot with its users.
+//
+// A conversation is a Flow of steps. Every step asks the user for something with its prompt
+// and takes the answer with Accept, which validates the answer and puts it into the payload
+// of the flow. The payload is a struct of the flow's own, kept between the steps as JSON.
+// After the last step Finish persists the result in the same transaction the answer is
+// handled in, and Done shows the result to the user once the transaction is committed.
+//
+// A user is in one conversation at a time: starting a flow abandons the previous one.
+// A conversation the user does not answer in time expires and the user returns to waiting.
+package conversation
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/profectus200/contact-book-bot/cmd/logging"
+	"github.com/profectus200/contact-book-bot/internal/i18n"
+	"github.com/profectus200/contact-book-bot/internal/types"
+	"go.uber.org/zap"
+)
+
+// DefaultTimeout is the time to answer for flows which do not set their own.
+const DefaultTimeout = 15 * time.Minute
+
+type sender interface {
+	SendMessage(ctx context.Context, text string, userID int64) error
+	ShowAlert(ctx context.Context, text string, callbackID string) error
+}
+
+type usersDB interface {
+	SetCurrentState(ctx context.Context, userID int64, state types.CurrentState) error
+	GetCurrentState(ctx context.Context, userID int64) (*types.UserStateType, bool)
+	ToWaitState(ctx context.Context, userID int64) error
+	ExpireStates(ctx context.Context, now time.Time) ([]int64, error)
+	LockUser(ctx context.Context, userID int64) error
+}
+
+type settingsDB interface {
+	GetSettings(ctx context.Context, userID int64) (types.Settings, error)
+}
+
+type txManager interface {
+	InTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// Chat is the user the bot is talking to in the update being handled.
+type Chat struct {
+	UserID int64
+	// MessageID is the message the user sent, or the message with the button the user pressed.
+	MessageID int
+	// CallbackID is set when the user pressed a button, the prompt is shown as its notification then.
+	CallbackID string
+	// PhotoID is the file_id of the photo the user sent, the answer is its caption then.
+	PhotoID  string
+	Lang     i18n.Lang
+	Settings types.Settings
+}
+
+// Invalid is returned by Accept to reject the answer: the reply is sent to the user
+// and the step waits for another answer.
+func Invalid(reply string) error {
+	return &invalidError{reply: reply}
+}
+
+type invalidError struct {
+	reply string
+}
+
+func (e *invalidError) Error() string {
+	return "invalid answer: " + e.reply
+}
+
+// Engine keeps the state of the conversations in the users storage and runs the flows
+// registered in it.
+type Engine struct {
+	tgClient   sender
+	usersDB    usersDB
+	settingsDB settingsDB
+	txManager  txManager
+	flows      map[string]flow
+	logger     *zap.Logger
+}
+
+func New(tgClient sender, usersDB usersDB, settingsDB settingsDB, txManager txManager, logger *zap.Logger) *Engine {
+	return &Engine{
+		tgClient:   tgClient,
+		usersDB:    usersDB,
+		settingsDB: settingsDB,
+		txManager:  txManager,
+		flows:      make(map[string]flow),
+		logger:     logger.Named("conversation"),
+	}
+}
+
+// flow is a Flow of any payload.
+type flow interface {
+	name() string
+	handle(ctx context.Context, c *Chat, state types.CurrentState, text string) (after func(ctx context.Context) error, err error)
+}
+
+// Handle passes the text the user sent to the conversation the user is in.
+// It is false when the user is not in a conversation.
+func (e *Engine) Handle(ctx context.Context, c *Chat, text string) (bool, error) {
+	var (
+		handled bool
+		after   func(ctx context.Context) error
+	)
+
+	err := e.txManager.InTx(ctx, func(ctx context.Context) error {
+		err := e.usersDB.LockUser(ctx, c.UserID)
+		if err != nil {
+			return errors.Wrap(err, "cannot LockUser")
+		}
+
+		userState, ok := e.usersDB.GetCurrentState(ctx, c.UserID)
+		if !ok {
+			return errors.New("cannot GetCurrentState of a locked user")
+		}
+		state := userState.CurrentState
+
+		if state.Waiting() {
+			return nil
+		}
+		if state.Expired(time.Now()) {
+			e.log(ctx).Debug("Conversation expired", zap.String("flow", state.Flow))
+			return errors.Wrap(e.usersDB.ToWaitState(ctx, c.UserID), "cannot ToWaitState")
+		}
+
+		f, ok := e.flows[state.Flow]
+		if !ok {
+			// The flow may have been removed in a newer version of the bot.
+			e.log(ctx).Warn("Unknown flow", zap.String("flow", state.Flow))
+			return errors.Wrap(e.usersDB.ToWaitState(ctx, c.UserID), "cannot ToWaitState")
+		}
+
+		handled = true
+		after, err = f.handle(ctx, c, state, text)
+		return err
+	})
+	if err != nil {
+		return handled, err
+	}
+
+	if after == nil {
+		return handled, nil
+	}
+	return handled, after(ctx)
+}
+
+// Cancel ends the conversation of the user. It is false when there was none.
+func (e *Engine) Cancel(ctx context.Context, userID int64) (bool, error) {
+	var cancelled bool
+
+	err := e.txManager.InTx(ctx, func(ctx context.Context) error {
+		err := e.usersDB.LockUser(ctx, userID)
+		if err != nil {
+			return errors.Wrap(err, "cannot LockUser")
+		}
+
+		userState, ok := e.usersDB.GetCurrentState(ctx, userID)
+		if !ok {
+			return errors.New("cannot GetCurrentState of a locked user")
+		}
+		if userState.CurrentState.Waiting() || userState.CurrentState.Expired(time.Now()) {
+			return nil
+		}
+
+		cancelled = true
+		return errors.Wrap(e.usersDB.ToWaitState(ctx, userID), "cannot ToWaitState")
+	})
+
+	return cancelled, err
+}
+
+// ExpireStale returns the users who have not answered in time to waiting and tells them so.
+func (e *Engine) ExpireStale(ctx context.Context) error {
+	userIDs, err := e.usersDB.ExpireStates(ctx, time.Now())
+	if err != nil {
+		return errors.Wrap(err, "cannot ExpireStates")
+	}
+
+	for _, userID := range userIDs {
+		lang := i18n.Default
+		settings, err := e.settingsDB.GetSettings(ctx, userID)
+		if err != nil {
+			e.logger.Warn("Cannot GetSettings", zap.Int64("user_id", userID), zap.Error(err))
+		} else if chosen, ok := i18n.Parse(settings.Language); ok {
+			lang = chosen
+		}
+
+		err = e.tgClient.SendMessage(ctx, lang.T(i18n.ConversationExpired), userID)
+		if err != nil {
+			e.logger.Warn("Cannot tell about expired conversation", zap.Int64("user_id", userID), zap.Error(err))
+		}
+	}
+
+	if len(userIDs) > 0 {
+		e.logger.Info("Conversations expired", zap.Int("count", len(userIDs)))
+	}
+	return nil
+}
+
+// prompt asks the user for the answer to the step: in the notification of the pressed
+// button if there is one, as a message otherwise.
+func (e *Engine) prompt(ctx context.Context, c *Chat, text string) error {
+	if c.CallbackID != "" {
+		return errors.Wrap(e.tgClient.ShowAlert(ctx, text, c.CallbackID), "cannot ShowAlert")
+	}
+	return errors.Wrap(e.tgClient.SendMessage(ctx, text, c.UserID), "cannot SendMessage")
+}
+
+func (e *Engine) log(ctx context.Context) *zap.Logger {
+	return logging.FromContext(ctx, e.logger)
+}
+
+func encodePayload(payload any) (string, error) {
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return "", errors.Wrap(err, "cannot Marshal payload")
+	}
+	return string(encoded), nil
+}
@@ -0,0 +1,167 @@
+package conversation
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/profectus200/contact-book-bot/internal/types"
+	"go.uber.org/zap"
+)
+
+// Flow is a conversation collecting a payload of type P.
+type Flow[P any] struct {
+	// Name identifies the flow in the stored state, so it must not change between versions.
+	Name string
+	// Timeout is the time the user has to answer every step, DefaultTimeout if zero.
+	Timeout time.Duration
+	Steps   []Step[P]
+	// Finish persists the result after the last step. It runs in a transaction with the user locked.
+	Finish func(ctx context.Context, c *Chat, payload *P) error
+	// Done shows the result to the user after the transaction of Finish is committed.
+	Done func(ctx context.Context, c *Chat, payload *P) error
+
+	engine *Engine
+}
+
+// Step asks the user for a single answer.
+type Step[P any] struct {
+	// Name identifies the step in the stored state, so it must not change between versions.
+	Name string
+	// Prompt is the text asking for the answer.
+	Prompt func(c *Chat, payload *P) string
+	// Accept validates the answer and puts it into the payload. It runs in the transaction
+	// of the answer and returns an error made with Invalid to ask for another answer.
+	Accept func(ctx context.Context, c *Chat, text string, payload *P) error
+}
+
+// Prompt is a Step.Prompt showing the same text every time.
+func Prompt[P any](key string) func(c *Chat, payload *P) string {
+	return func(c *Chat, payload *P) string {
+		return c.Lang.T(key)
+	}
+}
+
+// Register makes the engine run the flow and returns it to be started.
+func Register[P any](e *Engine, f *Flow[P]) *Flow[P] {
+	if len(f.Steps) == 0 {
+		panic("conversation: flow " + f.Name + " has no steps")
+	}
+	if _, ok := e.flows[f.Name]; ok {
+		panic("conversation: flow " + f.Name + " is registered twice")
+	}
+
+	f.engine = e
+	e.flows[f.Name] = f
+	return f
+}
+
+// Start starts the conversation with the first step, abandoning the one the user was in.
+func (f *Flow[P]) Start(ctx context.Context, c *Chat, payload P) error {
+	err := f.engine.txManager.InTx(ctx, func(ctx context.Context) error {
+		err := f.engine.usersDB.LockUser(ctx, c.UserID)
+		if err != nil {
+			return errors.Wrap(err, "cannot LockUser")
+		}
+
+		return f.toStep(ctx, c, 0, &payload)
+	})
+	if err != nil {
+		return err
+	}
+	f.engine.log(ctx).Debug("Conversation started", zap.String("flow", f.Name))
+
+	return f.engine.prompt(ctx, c, f.Steps[0].Prompt(c, &payload))
+}
+
+func (f *Flow[P]) name() string {
+	return f.Name
+}
+
+func (f *Flow[P]) handle(ctx context.Context, c *Chat, state types.CurrentState, text string) (func(ctx context.Context) error, error) {
+	var payload P
+	if state.Payload != "" {
+		if err := json.Unmarshal([]byte(state.Payload), &payload); err != nil {
+			return nil, errors.Wrapf(err, "cannot Unmarshal payload of %s", f.Name)
+		}
+	}
+
+	current := f.step(state.Step)
+	if current < 0 {
+		f.engine.log(ctx).Warn("Unknown step", zap.String("flow", f.Name), zap.String("step", state.Step))
+		return nil, errors.Wrap(f.engine.usersDB.ToWaitState(ctx, c.UserID), "cannot ToWaitState")
+	}
+
+	err := f.Steps[current].Accept(ctx, c, text, &payload)
+	var invalid *invalidError
+	if errors.As(err, &invalid) {
+		f.engine.log(ctx).Debug("Answer rejected", zap.String("flow", f.Name), zap.String("step", state.Step))
+		return func(ctx context.Context) error {
+			return errors.Wrap(f.engine.tgClient.SendMessage(ctx, invalid.reply, c.UserID), "cannot SendMessage")
+		}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// The prompts of the following steps are messages: there is no button to answer now.
+	next := *c
+	next.CallbackID = ""
+
+	if current+1 < len(f.Steps) {
+		if err := f.toStep(ctx, c, current+1, &payload); err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context) error {
+			return f.engine.prompt(ctx, &next, f.Steps[current+1].Prompt(&next, &payload))
+		}, nil
+	}
+
+	if f.Finish != nil {
+		if err := f.Finish(ctx, c, &payload); err != nil {
+			return nil, err
+		}
+	}
+	if err := f.engine.usersDB.ToWaitState(ctx, c.UserID); err != nil {
+		return nil, errors.Wrap(err, "cannot ToWaitState")
+	}
+	f.engine.log(ctx).Debug("Conversation finished", zap.String("flow", f.Name))
+
+	if f.Done == nil {
+		return nil, nil
+	}
+	return func(ctx context.Context) error {
+		return f.Done(ctx, &next, &payload)
+	}, nil
+}
+
+// toStep makes the user answer the step.
+func (f *Flow[P]) toStep(ctx context.Context, c *Chat, step int, payload *P) error {
+	encoded, err := encodePayload(payload)
+	if err != nil {
+		return err
+	}
+
+	timeout := f.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+
+	err = f.engine.usersDB.SetCurrentState(ctx, c.UserID, types.CurrentState{
+		Flow:      f.Name,
+		Step:      f.Steps[step].Name,
+		Payload:   encoded,
+		ExpiresAt: time.Now().Add(timeout),
+	})
+	return errors.Wrap(err, "cannot SetCurrentState")
+}
+
+func (f *Flow[P]) step(name string) int {
+	for i, step := range f.Steps {
+		if step.Name == name {
+			return i
+		}
+	}
+	return -1
+}
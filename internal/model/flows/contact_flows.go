@@ -0,0 +1,303 @@
+package flows
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/profectus200/contact-book-bot/cmd/logging"
+	"github.com/profectus200/contact-book-bot/internal/i18n"
+	"github.com/profectus200/contact-book-bot/internal/model/conversation"
+	"github.com/profectus200/contact-book-bot/internal/types"
+	"go.uber.org/zap"
+)
+
+// removeValue is what the user sends to remove an optional value.
+const removeValue = "-"
+
+// fieldPayload is the state of editing a field of the contact shown in a card.
+type fieldPayload struct {
+	ContactID int `json:"contact_id"`
+	// CardID is the message with the card of the contact, updated with the new value.
+	CardID   int             `json:"card_id"`
+	Text     string          `json:"text,omitempty"`
+	Birthday *types.Birthday `json:"birthday,omitempty"`
+
+	// contact is the edited contact, passed from Finish to Done.
+	contact *types.Contact
+}
+
+type fieldWriter func(ctx context.Context, userID int64, payload *fieldPayload) error
+
+// EditName asks for the name of the contact in the card. A contact is created on the first
+// edit of a new contact card.
+func (f *Flows) EditName(ctx context.Context, c *conversation.Chat, contactID int, cardID int) error {
+	return f.editName.Start(ctx, c, fieldPayload{ContactID: contactID, CardID: cardID})
+}
+
+func (f *Flows) EditEmail(ctx context.Context, c *conversation.Chat, contactID int, cardID int) error {
+	return f.editEmail.Start(ctx, c, fieldPayload{ContactID: contactID, CardID: cardID})
+}
+
+func (f *Flows) EditPhone(ctx context.Context, c *conversation.Chat, contactID int, cardID int) error {
+	return f.editPhone.Start(ctx, c, fieldPayload{ContactID: contactID, CardID: cardID})
+}
+
+func (f *Flows) EditBirthday(ctx context.Context, c *conversation.Chat, contactID int, cardID int) error {
+	return f.editBirthday.Start(ctx, c, fieldPayload{ContactID: contactID, CardID: cardID})
+}
+
+func (f *Flows) EditDescription(ctx context.Context, c *conversation.Chat, contactID int, cardID int) error {
+	return f.editDescription.Start(ctx, c, fieldPayload{ContactID: contactID, CardID: cardID})
+}
+
+// EditPhoto asks for the photo of the contact. The card becomes the photo with the card in the caption.
+func (f *Flows) EditPhoto(ctx context.Context, c *conversation.Chat, contactID int, cardID int) error {
+	return f.editPhoto.Start(ctx, c, fieldPayload{ContactID: contactID, CardID: cardID})
+}
+
+// fieldFlow writes a single field of the contact and shows it in the card. The answer
+// of the user is deleted from the chat, so that the card stays the last message.
+func (f *Flows) fieldFlow(name string, prompt string,
+	accept func(ctx context.Context, c *conversation.Chat, text string, payload *fieldPayload) error,
+	write fieldWriter) *conversation.Flow[fieldPayload] {
+	return &conversation.Flow[fieldPayload]{
+		Name: name,
+		Steps: []conversation.Step[fieldPayload]{
+			{
+				Name:   "value",
+				Prompt: conversation.Prompt[fieldPayload](prompt),
+				Accept: accept,
+			},
+		},
+		Finish: func(ctx context.Context, c *conversation.Chat, payload *fieldPayload) error {
+			contact, err := f.contactForEditing(ctx, c, payload.ContactID)
+			if err != nil {
+				return err
+			}
+			payload.contact = contact
+
+			return write(ctx, c.UserID, payload)
+		},
+		Done: func(ctx context.Context, c *conversation.Chat, payload *fieldPayload) error {
+			err := f.tgClient.DeleteMessage(ctx, c.UserID, c.MessageID)
+			if err != nil {
+				return errors.Wrap(err, "cannot DeleteMessage")
+			}
+
+			contact := payload.contact
+			card := contact.ToString(c.Lang, c.Settings.ShowingAll())
+			return f.tgClient.EditContactMessage(ctx, card, c.UserID, payload.CardID, contact.ContactID, contact.PhotoID, c.Lang)
+		},
+	}
+}
+
+// contactForEditing returns the contact, creating it on the first edit of a new contact card.
+func (f *Flows) contactForEditing(ctx context.Context, c *conversation.Chat, contactID int) (*types.Contact, error) {
+	contact, err := f.contactsDB.GetContact(ctx, c.UserID, contactID)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot GetContact")
+	}
+
+	if contact == nil {
+		contact = types.NewContact(c.Lang)
+		contact.ContactID = contactID
+		err := f.contactsDB.WriteContact(ctx, c.UserID, contact)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot WriteContact")
+		}
+	}
+
+	return contact, nil
+}
+
+func acceptText(ctx context.Context, c *conversation.Chat, text string, payload *fieldPayload) error {
+	payload.Text = text
+	return nil
+}
+
+// acceptPhone gives the phone written without a country code the one of the phone region.
+func acceptPhone(ctx context.Context, c *conversation.Chat, text string, payload *fieldPayload) error {
+	payload.Text = types.WithCountryCode(text, c.Settings.PhoneRegion)
+	return nil
+}
+
+// acceptEmail takes "-" to remove the email.
+func (f *Flows) acceptEmail(ctx context.Context, c *conversation.Chat, text string, payload *fieldPayload) error {
+	if strings.TrimSpace(text) == removeValue {
+		payload.Text = ""
+		return nil
+	}
+
+	email, err := types.ParseEmail(text)
+	if err != nil {
+		f.log(ctx).Debug("Cannot parse email", zap.Error(err))
+		return conversation.Invalid(c.Lang.T(i18n.WrongEmail))
+	}
+	payload.Text = email
+	return nil
+}
+
+// acceptBirthday takes "-" to remove the birthday.
+func (f *Flows) acceptBirthday(ctx context.Context, c *conversation.Chat, text string, payload *fieldPayload) error {
+	if strings.TrimSpace(text) == removeValue {
+		payload.Birthday = nil
+		return nil
+	}
+
+	birthday, err := types.ParseBirthday(text, c.Settings.Now())
+	if err != nil {
+		f.log(ctx).Debug("Cannot parse birthday", zap.Error(err))
+		return conversation.Invalid(c.Lang.T(i18n.WrongBirthday))
+	}
+	payload.Birthday = &birthday
+	return nil
+}
+
+// acceptPhoto takes the file_id of the photo sent, or "-" to remove the photo.
+func (f *Flows) acceptPhoto(ctx context.Context, c *conversation.Chat, text string, payload *fieldPayload) error {
+	switch {
+	case c.PhotoID != "":
+		payload.Text = c.PhotoID
+	case strings.TrimSpace(text) == removeValue:
+		payload.Text = ""
+	default:
+		return conversation.Invalid(c.Lang.T(i18n.WrongPhoto))
+	}
+	return nil
+}
+
+func (f *Flows) writeName(ctx context.Context, userID int64, payload *fieldPayload) error {
+	contact := payload.contact
+	contact.Name = payload.Text
+	f.log(ctx).Debug("Writing name", zap.Int("contact_id", contact.ContactID), logging.Name("name", contact.Name))
+	return errors.Wrap(f.contactsDB.WriteName(ctx, contact.Name, userID, contact.ContactID), "cannot WriteName")
+}
+
+func (f *Flows) writeEmail(ctx context.Context, userID int64, payload *fieldPayload) error {
+	contact := payload.contact
+	contact.Email = payload.Text
+	f.log(ctx).Debug("Writing email", zap.Int("contact_id", contact.ContactID), logging.Email("email", contact.Email))
+	return errors.Wrap(f.contactsDB.WriteEmail(ctx, contact.Email, userID, contact.ContactID), "cannot WriteEmail")
+}
+
+func (f *Flows) writePhone(ctx context.Context, userID int64, payload *fieldPayload) error {
+	contact := payload.contact
+	contact.Phone = payload.Text
+	f.log(ctx).Debug("Writing phone", zap.Int("contact_id", contact.ContactID), logging.Phone("phone", contact.Phone))
+	return errors.Wrap(f.contactsDB.WritePhone(ctx, contact.Phone, userID, contact.ContactID), "cannot WritePhone")
+}
+
+func (f *Flows) writeBirthday(ctx context.Context, userID int64, payload *fieldPayload) error {
+	contact := payload.contact
+	contact.Birthday = payload.Birthday
+	f.log(ctx).Debug("Writing birthday", zap.Int("contact_id", contact.ContactID))
+	return errors.Wrap(f.contactsDB.WriteBirthday(ctx, contact.Birthday, userID, contact.ContactID), "cannot WriteBirthday")
+}
+
+func (f *Flows) writeDescription(ctx context.Context, userID int64, payload *fieldPayload) error {
+	contact := payload.contact
+	contact.Description = payload.Text
+	f.log(ctx).Debug("Writing description", zap.Int("contact_id", contact.ContactID), logging.Text("description", contact.Description))
+	return errors.Wrap(f.contactsDB.WriteDescription(ctx, contact.Description, userID, contact.ContactID), "cannot WriteDescription")
+}
+
+func (f *Flows) writePhoto(ctx context.Context, userID int64, payload *fieldPayload) error {
+	contact := payload.contact
+	contact.PhotoID = payload.Text
+	f.log(ctx).Debug("Writing photo", zap.Int("contact_id", contact.ContactID), zap.Bool("removed", contact.PhotoID == ""))
+	return errors.Wrap(f.contactsDB.WritePhoto(ctx, contact.PhotoID, userID, contact.ContactID), "cannot WritePhoto")
+}
+
+type searchPayload struct {
+	Phrase string `json:"phrase"`
+}
+
+// Search asks for the name of the contacts to show.
+func (f *Flows) Search(ctx context.Context, c *conversation.Chat) error {
+	return f.search.Start(ctx, c, searchPayload{})
+}
+
+func (f *Flows) searchFlow() *conversation.Flow[searchPayload] {
+	return &conversation.Flow[searchPayload]{
+		Name: "contact.search",
+		Steps: []conversation.Step[searchPayload]{
+			{
+				Name:   "phrase",
+				Prompt: conversation.Prompt[searchPayload](i18n.AskSearchName),
+				Accept: func(ctx context.Context, c *conversation.Chat, text string, payload *searchPayload) error {
+					payload.Phrase = text
+					return nil
+				},
+			},
+		},
+		Done: func(ctx context.Context, c *conversation.Chat, payload *searchPayload) error {
+			contacts, err := f.contactsDB.GetContactByName(ctx, c.UserID, payload.Phrase)
+			if err != nil {
+				return errors.Wrap(err, "cannot GetContactByName")
+			}
+
+			if len(contacts) == 0 {
+				return f.tgClient.SendMessage(ctx, c.Lang.T(i18n.NoContacts), c.UserID)
+			}
+			return f.tgClient.SendMessage(ctx, ContactsText(contacts, c), c.UserID)
+		},
+	}
+}
+
+type editByIDPayload struct {
+	ContactID int `json:"contact_id"`
+}
+
+// EditByID asks for the ID of the contact to open in a card.
+func (f *Flows) EditByID(ctx context.Context, c *conversation.Chat) error {
+	return f.editByID.Start(ctx, c, editByIDPayload{})
+}
+
+func (f *Flows) editByIDFlow() *conversation.Flow[editByIDPayload] {
+	return &conversation.Flow[editByIDPayload]{
+		Name: "contact.edit_by_id",
+		Steps: []conversation.Step[editByIDPayload]{
+			{
+				Name:   "id",
+				Prompt: conversation.Prompt[editByIDPayload](i18n.AskContactID),
+				Accept: func(ctx context.Context, c *conversation.Chat, text string, payload *editByIDPayload) error {
+					contactID, err := strconv.Atoi(strings.TrimSpace(text))
+					if err != nil {
+						return conversation.Invalid(c.Lang.T(i18n.WrongContactID))
+					}
+					payload.ContactID = contactID
+					return nil
+				},
+			},
+		},
+		Done: func(ctx context.Context, c *conversation.Chat, payload *editByIDPayload) error {
+			contact, err := f.contactsDB.GetContact(ctx, c.UserID, payload.ContactID)
+			if err != nil {
+				return errors.Wrap(err, "cannot GetContact")
+			}
+
+			if contact == nil {
+				return f.tgClient.SendMessage(ctx, c.Lang.T(i18n.ContactNotFound, payload.ContactID), c.UserID)
+			}
+			card := contact.ToString(c.Lang, c.Settings.ShowingAll())
+			return f.tgClient.EditContact(ctx, card, c.UserID, contact.ContactID, contact.PhotoID, c.Lang)
+		},
+	}
+}
+
+// ContactsText lists the cards of the contacts one under another in the order chosen in the settings.
+func ContactsText(contacts []*types.Contact, c *conversation.Chat) string {
+	types.SortContacts(contacts, c.Settings.SortOrder, c.Settings.Now())
+
+	text := ""
+	for _, contact := range contacts {
+		text += contact.ToString(c.Lang, c.Settings) + c.Lang.T(i18n.ContactsSeparator) + "\n"
+	}
+	return text
+}
+
+func (f *Flows) log(ctx context.Context) *zap.Logger {
+	return logging.FromContext(ctx, f.logger)
+}
@@ -0,0 +1,175 @@
+package flows
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/profectus200/contact-book-bot/cmd/logging"
+	"github.com/profectus200/contact-book-bot/internal/i18n"
+	"github.com/profectus200/contact-book-bot/internal/model/conversation"
+	"github.com/profectus200/contact-book-bot/internal/types"
+	"go.uber.org/zap"
+)
+
+// customFieldPayload is the state of adding, changing or removing a custom field of the
+// contact shown in a card.
+type customFieldPayload struct {
+	ContactID int `json:"contact_id"`
+	// CardID is the message with the card of the contact, updated with the field.
+	CardID int                   `json:"card_id"`
+	Name   string                `json:"name,omitempty"`
+	Type   types.CustomFieldType `json:"type,omitempty"`
+	Value  string                `json:"value,omitempty"`
+	// Remove is set when the user sends "-" instead of the value.
+	Remove bool `json:"remove,omitempty"`
+
+	// contact is the edited contact, passed from Finish to Done.
+	contact *types.Contact
+}
+
+// AddField asks for the name, the type and the value of a custom field of the contact.
+// Entering the name of an existing field changes it.
+func (f *Flows) AddField(ctx context.Context, c *conversation.Chat, contactID int, cardID int) error {
+	return f.addField.Start(ctx, c, customFieldPayload{ContactID: contactID, CardID: cardID})
+}
+
+func (f *Flows) customFieldFlow() *conversation.Flow[customFieldPayload] {
+	return &conversation.Flow[customFieldPayload]{
+		Name: "contact.field",
+		Steps: []conversation.Step[customFieldPayload]{
+			{
+				Name:   "name",
+				Prompt: conversation.Prompt[customFieldPayload](i18n.EnterFieldName),
+				Accept: f.acceptFieldName,
+			},
+			{
+				Name: "type",
+				Prompt: func(c *conversation.Chat, payload *customFieldPayload) string {
+					return c.Lang.T(i18n.EnterFieldType, payload.Name, fieldTypeNames(c.Lang))
+				},
+				Accept: func(ctx context.Context, c *conversation.Chat, text string, payload *customFieldPayload) error {
+					fieldType, ok := types.ParseCustomFieldType(text, c.Lang)
+					if !ok {
+						return conversation.Invalid(c.Lang.T(i18n.WrongFieldType, fieldTypeNames(c.Lang)))
+					}
+					payload.Type = fieldType
+					return nil
+				},
+			},
+			{
+				Name: "value",
+				Prompt: func(c *conversation.Chat, payload *customFieldPayload) string {
+					return c.Lang.T(i18n.EnterFieldValue, payload.Type.Name(c.Lang))
+				},
+				Accept: f.acceptFieldValue,
+			},
+		},
+		Finish: func(ctx context.Context, c *conversation.Chat, payload *customFieldPayload) error {
+			contact, err := f.contactForEditing(ctx, c, payload.ContactID)
+			if err != nil {
+				return err
+			}
+
+			if payload.Remove {
+				f.log(ctx).Debug("Deleting custom field", zap.Int("contact_id", contact.ContactID))
+				err = f.contactsDB.DeleteCustomField(ctx, c.UserID, contact.ContactID, payload.Name)
+				if err != nil {
+					return errors.Wrap(err, "cannot DeleteCustomField")
+				}
+			} else {
+				field := types.CustomField{Name: payload.Name, Type: payload.Type, Value: payload.Value}
+				f.log(ctx).Debug("Writing custom field", zap.Int("contact_id", contact.ContactID), logging.Text("value", field.Value))
+				err = f.contactsDB.WriteCustomField(ctx, c.UserID, contact.ContactID, field)
+				if err != nil {
+					return errors.Wrap(err, "cannot WriteCustomField")
+				}
+			}
+
+			// The fields are ordered by the storage, so the contact is read again.
+			payload.contact, err = f.contactsDB.GetContact(ctx, c.UserID, contact.ContactID)
+			if err != nil {
+				return errors.Wrap(err, "cannot GetContact")
+			}
+			if payload.contact == nil {
+				return errors.Errorf("contact %d is gone", contact.ContactID)
+			}
+			return nil
+		},
+		Done: func(ctx context.Context, c *conversation.Chat, payload *customFieldPayload) error {
+			err := f.tgClient.DeleteMessage(ctx, c.UserID, c.MessageID)
+			if err != nil {
+				return errors.Wrap(err, "cannot DeleteMessage")
+			}
+
+			contact := payload.contact
+			card := contact.ToString(c.Lang, c.Settings.ShowingAll())
+			return f.tgClient.EditContactMessage(ctx, card, c.UserID, payload.CardID, contact.ContactID, contact.PhotoID, c.Lang)
+		},
+	}
+}
+
+// acceptFieldName takes the name of a new field or of an existing one in any case,
+// which is then kept as it is.
+func (f *Flows) acceptFieldName(ctx context.Context, c *conversation.Chat, text string, payload *customFieldPayload) error {
+	name, err := types.ParseCustomFieldName(text)
+	if err != nil {
+		f.log(ctx).Debug("Cannot parse field name", zap.Error(err))
+		return conversation.Invalid(c.Lang.T(i18n.WrongFieldName))
+	}
+
+	contact, err := f.contactsDB.GetContact(ctx, c.UserID, payload.ContactID)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetContact")
+	}
+	if contact != nil {
+		if field, ok := contact.CustomField(name); ok {
+			name = field.Name
+		}
+	}
+
+	payload.Name = name
+	return nil
+}
+
+// acceptFieldValue takes "-" to remove the field.
+func (f *Flows) acceptFieldValue(ctx context.Context, c *conversation.Chat, text string, payload *customFieldPayload) error {
+	if strings.TrimSpace(text) == removeValue {
+		payload.Remove = true
+		return nil
+	}
+
+	value, err := payload.Type.ParseValue(text)
+	if err != nil {
+		f.log(ctx).Debug("Cannot parse field value", zap.String("type", string(payload.Type)), zap.Error(err))
+		return conversation.Invalid(wrongFieldValue(c.Lang, payload.Type))
+	}
+	if payload.Type == types.CustomPhone {
+		value = types.WithCountryCode(value, c.Settings.PhoneRegion)
+	}
+	payload.Value = value
+	return nil
+}
+
+func wrongFieldValue(lang i18n.Lang, fieldType types.CustomFieldType) string {
+	switch fieldType {
+	case types.CustomDate:
+		return lang.T(i18n.WrongFieldDate)
+	case types.CustomURL:
+		return lang.T(i18n.WrongFieldURL)
+	case types.CustomPhone:
+		return lang.T(i18n.WrongFieldPhone)
+	default:
+		// Only an empty text is wrong, e.g. a photo without a caption.
+		return lang.T(i18n.EnterFieldValue, fieldType.Name(lang))
+	}
+}
+
+// fieldTypeNames lists the types for the user to choose from, e.g. "text, date, link, phone".
+func fieldTypeNames(lang i18n.Lang) string {
+	names := make([]string, 0, len(types.CustomFieldTypes))
+	for _, t := range types.CustomFieldTypes {
+		names = append(names, t.Name(lang))
+	}
+	return strings.Join(names, ", ")
+}
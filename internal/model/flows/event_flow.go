@@ -0,0 +1,154 @@
+package flows
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/profectus200/contact-book-bot/internal/i18n"
+	"github.com/profectus200/contact-book-bot/internal/model/conversation"
+	"github.com/profectus200/contact-book-bot/internal/types"
+	"go.uber.org/zap"
+)
+
+// eventPayload is the state of adding, changing or removing a date of the contact shown
+// in a card.
+type eventPayload struct {
+	ContactID int `json:"contact_id"`
+	// CardID is the message with the card of the contact, updated with the date.
+	CardID     int              `json:"card_id"`
+	Name       string           `json:"name,omitempty"`
+	Recurrence types.Recurrence `json:"recurrence"`
+	Date       types.Birthday   `json:"date"`
+	// Remove is set when the user sends "-" instead of the date.
+	Remove bool `json:"remove,omitempty"`
+
+	// contact is the edited contact, passed from Finish to Done.
+	contact *types.Contact
+}
+
+// AddEvent asks for the name, the recurrence and the date of a date of the contact.
+// Entering the name of an existing date changes it.
+func (f *Flows) AddEvent(ctx context.Context, c *conversation.Chat, contactID int, cardID int) error {
+	return f.addEvent.Start(ctx, c, eventPayload{ContactID: contactID, CardID: cardID})
+}
+
+func (f *Flows) eventFlow() *conversation.Flow[eventPayload] {
+	return &conversation.Flow[eventPayload]{
+		Name: "contact.event",
+		Steps: []conversation.Step[eventPayload]{
+			{
+				Name:   "name",
+				Prompt: conversation.Prompt[eventPayload](i18n.EnterEventName),
+				Accept: f.acceptEventName,
+			},
+			{
+				Name: "recurrence",
+				Prompt: func(c *conversation.Chat, payload *eventPayload) string {
+					return c.Lang.T(i18n.EnterEventRecurrence, payload.Name)
+				},
+				Accept: func(ctx context.Context, c *conversation.Chat, text string, payload *eventPayload) error {
+					if strings.TrimSpace(text) == removeValue {
+						payload.Recurrence = types.Yearly
+						return nil
+					}
+
+					recurrence, err := types.ParseRecurrence(text)
+					if err != nil {
+						f.log(ctx).Debug("Cannot parse recurrence", zap.Error(err))
+						return conversation.Invalid(c.Lang.T(i18n.WrongEventRecurrence))
+					}
+					payload.Recurrence = recurrence
+					return nil
+				},
+			},
+			{
+				Name: "date",
+				Prompt: func(c *conversation.Chat, payload *eventPayload) string {
+					return c.Lang.T(i18n.EnterEventDate, payload.Name)
+				},
+				Accept: f.acceptEventDate,
+			},
+		},
+		Finish: func(ctx context.Context, c *conversation.Chat, payload *eventPayload) error {
+			contact, err := f.contactForEditing(ctx, c, payload.ContactID)
+			if err != nil {
+				return err
+			}
+
+			if payload.Remove {
+				f.log(ctx).Debug("Deleting event", zap.Int("contact_id", contact.ContactID))
+				err = f.contactsDB.DeleteEvent(ctx, c.UserID, contact.ContactID, payload.Name)
+				if err != nil {
+					return errors.Wrap(err, "cannot DeleteEvent")
+				}
+			} else {
+				event := types.Event{Name: payload.Name, Date: payload.Date, Recurrence: payload.Recurrence}
+				f.log(ctx).Debug("Writing event", zap.Int("contact_id", contact.ContactID), zap.Stringer("date", event.Date))
+				err = f.contactsDB.WriteEvent(ctx, c.UserID, contact.ContactID, event)
+				if err != nil {
+					return errors.Wrap(err, "cannot WriteEvent")
+				}
+			}
+
+			// The dates are ordered by the storage, so the contact is read again.
+			payload.contact, err = f.contactsDB.GetContact(ctx, c.UserID, contact.ContactID)
+			if err != nil {
+				return errors.Wrap(err, "cannot GetContact")
+			}
+			if payload.contact == nil {
+				return errors.Errorf("contact %d is gone", contact.ContactID)
+			}
+			return nil
+		},
+		Done: func(ctx context.Context, c *conversation.Chat, payload *eventPayload) error {
+			err := f.tgClient.DeleteMessage(ctx, c.UserID, c.MessageID)
+			if err != nil {
+				return errors.Wrap(err, "cannot DeleteMessage")
+			}
+
+			contact := payload.contact
+			card := contact.ToString(c.Lang, c.Settings.ShowingAll())
+			return f.tgClient.EditContactMessage(ctx, card, c.UserID, payload.CardID, contact.ContactID, contact.PhotoID, c.Lang)
+		},
+	}
+}
+
+// acceptEventName takes the name of a new date or of an existing one in any case,
+// which is then kept as it is.
+func (f *Flows) acceptEventName(ctx context.Context, c *conversation.Chat, text string, payload *eventPayload) error {
+	name, err := types.ParseEventName(text)
+	if err != nil {
+		f.log(ctx).Debug("Cannot parse event name", zap.Error(err))
+		return conversation.Invalid(c.Lang.T(i18n.WrongEventName))
+	}
+
+	contact, err := f.contactsDB.GetContact(ctx, c.UserID, payload.ContactID)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetContact")
+	}
+	if contact != nil {
+		if event, ok := contact.Event(name); ok {
+			name = event.Name
+		}
+	}
+
+	payload.Name = name
+	return nil
+}
+
+// acceptEventDate takes "-" to remove the date.
+func (f *Flows) acceptEventDate(ctx context.Context, c *conversation.Chat, text string, payload *eventPayload) error {
+	if strings.TrimSpace(text) == removeValue {
+		payload.Remove = true
+		return nil
+	}
+
+	date, err := types.ParseEventDate(text, payload.Recurrence)
+	if err != nil {
+		f.log(ctx).Debug("Cannot parse event date", zap.Error(err))
+		return conversation.Invalid(c.Lang.T(i18n.WrongEventDate))
+	}
+	payload.Date = date
+	return nil
+}
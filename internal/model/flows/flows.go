@@ -0,0 +1,114 @@
+// Package flows declares the conversations of the bot on the conversation engine.
+package flows
+
+import (
+	"context"
+
+	"github.com/profectus200/contact-book-bot/internal/i18n"
+	"github.com/profectus200/contact-book-bot/internal/model/conversation"
+	"github.com/profectus200/contact-book-bot/internal/types"
+	"go.uber.org/zap"
+)
+
+type messageSender interface {
+	SendMessage(ctx context.Context, text string, userID int64) error
+	SendContactSummary(ctx context.Context, text string, userID int64, contactID int, lang i18n.Lang) error
+	EditContact(ctx context.Context, text string, userID int64, contactID int, photoID string, lang i18n.Lang) error
+	EditContactMessage(ctx context.Context, text string, userID int64, messageID int, contactID int, photoID string, lang i18n.Lang) error
+	EditSettings(ctx context.Context, text string, userID int64, messageID int, settings types.Settings, lang i18n.Lang) error
+	DeleteMessage(ctx context.Context, userID int64, messageID int) error
+}
+
+type contactsDB interface {
+	WriteContact(ctx context.Context, userID int64, contact *types.Contact) error
+	GetContact(ctx context.Context, userID int64, contactID int) (*types.Contact, error)
+	GetContactByName(ctx context.Context, userID int64, name string) ([]*types.Contact, error)
+	WriteName(ctx context.Context, name string, userID int64, contactID int) error
+	WriteEmail(ctx context.Context, email string, userID int64, contactID int) error
+	WritePhone(ctx context.Context, phone string, userID int64, contactID int) error
+	WriteBirthday(ctx context.Context, birthday *types.Birthday, userID int64, contactID int) error
+	WriteDescription(ctx context.Context, description string, userID int64, contactID int) error
+	WritePhoto(ctx context.Context, photoID string, userID int64, contactID int) error
+	WriteCustomField(ctx context.Context, userID int64, contactID int, field types.CustomField) error
+	DeleteCustomField(ctx context.Context, userID int64, contactID int, name string) error
+	WriteEvent(ctx context.Context, userID int64, contactID int, event types.Event) error
+	DeleteEvent(ctx context.Context, userID int64, contactID int, name string) error
+	AddInteraction(ctx context.Context, userID int64, contactID int, interaction types.Interaction) error
+	AddReminder(ctx context.Context, userID int64, contactID int, reminder types.Reminder) error
+	GetReminders(ctx context.Context, userID int64) ([]types.Reminder, error)
+}
+
+type settingsDB interface {
+	GetSettings(ctx context.Context, userID int64) (types.Settings, error)
+	SaveSettings(ctx context.Context, userID int64, settings types.Settings) error
+}
+
+type webhooksDB interface {
+	AddWebhook(ctx context.Context, webhook types.Webhook) (types.Webhook, error)
+	GetWebhooks(ctx context.Context, userID int64) ([]types.Webhook, error)
+}
+
+// Flows are the conversations of the bot. The engine they run on is embedded,
+// so that the models may pass the answers of the users to it.
+type Flows struct {
+	*conversation.Engine
+
+	editName        *conversation.Flow[fieldPayload]
+	editEmail       *conversation.Flow[fieldPayload]
+	editPhone       *conversation.Flow[fieldPayload]
+	editBirthday    *conversation.Flow[fieldPayload]
+	editDescription *conversation.Flow[fieldPayload]
+	editPhoto       *conversation.Flow[fieldPayload]
+	addField        *conversation.Flow[customFieldPayload]
+	addEvent        *conversation.Flow[eventPayload]
+	logInteraction  *conversation.Flow[interactionPayload]
+	addReminder     *conversation.Flow[reminderPayload]
+	addContact      *conversation.Flow[wizardPayload]
+	search          *conversation.Flow[searchPayload]
+	editByID        *conversation.Flow[editByIDPayload]
+	timezone        *conversation.Flow[settingPayload]
+	phoneRegion     *conversation.Flow[settingPayload]
+	reminderTime    *conversation.Flow[settingPayload]
+	staleDays       *conversation.Flow[settingPayload]
+	addWebhook      *conversation.Flow[webhookPayload]
+
+	tgClient   messageSender
+	contactsDB contactsDB
+	settingsDB settingsDB
+	webhooksDB webhooksDB
+	logger     *zap.Logger
+}
+
+// New registers the flows in the engine.
+func New(engine *conversation.Engine, tgClient messageSender, contactsDB contactsDB, settingsDB settingsDB,
+	webhooksDB webhooksDB, logger *zap.Logger) *Flows {
+	f := &Flows{
+		Engine:     engine,
+		tgClient:   tgClient,
+		contactsDB: contactsDB,
+		settingsDB: settingsDB,
+		webhooksDB: webhooksDB,
+		logger:     logger.Named("flows"),
+	}
+
+	f.editName = conversation.Register(engine, f.fieldFlow("contact.name", i18n.EnterName, acceptText, f.writeName))
+	f.editEmail = conversation.Register(engine, f.fieldFlow("contact.email", i18n.EnterEmail, f.acceptEmail, f.writeEmail))
+	f.editPhone = conversation.Register(engine, f.fieldFlow("contact.phone", i18n.EnterPhone, acceptPhone, f.writePhone))
+	f.editBirthday = conversation.Register(engine, f.fieldFlow("contact.birthday", i18n.EnterBirthday, f.acceptBirthday, f.writeBirthday))
+	f.editDescription = conversation.Register(engine, f.fieldFlow("contact.description", i18n.EnterDescription, acceptText, f.writeDescription))
+	f.editPhoto = conversation.Register(engine, f.fieldFlow("contact.photo", i18n.EnterPhoto, f.acceptPhoto, f.writePhoto))
+	f.addField = conversation.Register(engine, f.customFieldFlow())
+	f.addEvent = conversation.Register(engine, f.eventFlow())
+	f.logInteraction = conversation.Register(engine, f.interactionFlow())
+	f.addReminder = conversation.Register(engine, f.reminderFlow())
+	f.addContact = conversation.Register(engine, f.wizardFlow())
+	f.search = conversation.Register(engine, f.searchFlow())
+	f.editByID = conversation.Register(engine, f.editByIDFlow())
+	f.timezone = conversation.Register(engine, f.settingFlow("settings.timezone", i18n.EnterTimezone, f.acceptTimezone, applyTimezone))
+	f.phoneRegion = conversation.Register(engine, f.settingFlow("settings.phone_region", i18n.EnterPhoneRegion, f.acceptPhoneRegion, applyPhoneRegion))
+	f.reminderTime = conversation.Register(engine, f.settingFlow("settings.reminder_time", i18n.EnterReminderTime, f.acceptReminderTime, applyReminderTime))
+	f.staleDays = conversation.Register(engine, f.settingFlow("settings.stale_days", i18n.EnterStaleDays, f.acceptStaleDays, applyStaleDays))
+	f.addWebhook = conversation.Register(engine, f.webhookFlow())
+
+	return f
+}
@@ -0,0 +1,128 @@
+package flows
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/profectus200/contact-book-bot/internal/i18n"
+	"github.com/profectus200/contact-book-bot/internal/model/conversation"
+	"github.com/profectus200/contact-book-bot/internal/types"
+	"go.uber.org/zap"
+)
+
+// interactionPayload is the state of logging an interaction with the contact shown in a card.
+type interactionPayload struct {
+	ContactID int `json:"contact_id"`
+	// CardID is the message with the card of the contact, updated with the last contact.
+	CardID int                   `json:"card_id"`
+	Kind   types.InteractionKind `json:"kind,omitempty"`
+	Date   time.Time             `json:"date"`
+	Note   string                `json:"note,omitempty"`
+
+	// contact is the contact with the interaction logged, passed from Finish to Done.
+	contact *types.Contact
+}
+
+// LogInteraction asks what the user did to keep in touch with the contact, when and
+// how it went, and adds it to the log of the contact.
+func (f *Flows) LogInteraction(ctx context.Context, c *conversation.Chat, contactID int, cardID int) error {
+	return f.logInteraction.Start(ctx, c, interactionPayload{ContactID: contactID, CardID: cardID})
+}
+
+func (f *Flows) interactionFlow() *conversation.Flow[interactionPayload] {
+	return &conversation.Flow[interactionPayload]{
+		Name: "contact.interaction",
+		Steps: []conversation.Step[interactionPayload]{
+			{
+				Name: "kind",
+				Prompt: func(c *conversation.Chat, payload *interactionPayload) string {
+					return c.Lang.T(i18n.EnterInteractionKind, interactionKindNames(c.Lang))
+				},
+				Accept: func(ctx context.Context, c *conversation.Chat, text string, payload *interactionPayload) error {
+					kind, ok := types.ParseInteractionKind(text, c.Lang)
+					if !ok {
+						return conversation.Invalid(c.Lang.T(i18n.WrongInteractionKind, interactionKindNames(c.Lang)))
+					}
+					payload.Kind = kind
+					return nil
+				},
+			},
+			{
+				Name:   "date",
+				Prompt: conversation.Prompt[interactionPayload](i18n.EnterInteractionDate),
+				Accept: f.acceptInteractionDate,
+			},
+			{
+				Name:   "note",
+				Prompt: conversation.Prompt[interactionPayload](i18n.EnterInteractionNote),
+				Accept: func(ctx context.Context, c *conversation.Chat, text string, payload *interactionPayload) error {
+					if text = strings.TrimSpace(text); text != removeValue {
+						payload.Note = text
+					}
+					return nil
+				},
+			},
+		},
+		Finish: func(ctx context.Context, c *conversation.Chat, payload *interactionPayload) error {
+			contact, err := f.contactForEditing(ctx, c, payload.ContactID)
+			if err != nil {
+				return err
+			}
+
+			interaction := types.Interaction{Kind: payload.Kind, Note: payload.Note, Date: payload.Date}
+			f.log(ctx).Debug("Logging interaction", zap.Int("contact_id", contact.ContactID), zap.String("kind", string(interaction.Kind)))
+			err = f.contactsDB.AddInteraction(ctx, c.UserID, contact.ContactID, interaction)
+			if err != nil {
+				return errors.Wrap(err, "cannot AddInteraction")
+			}
+
+			// The logged interaction is not necessarily the latest one.
+			payload.contact, err = f.contactsDB.GetContact(ctx, c.UserID, contact.ContactID)
+			if err != nil {
+				return errors.Wrap(err, "cannot GetContact")
+			}
+			if payload.contact == nil {
+				return errors.Errorf("contact %d is gone", contact.ContactID)
+			}
+			return nil
+		},
+		Done: func(ctx context.Context, c *conversation.Chat, payload *interactionPayload) error {
+			err := f.tgClient.DeleteMessage(ctx, c.UserID, c.MessageID)
+			if err != nil {
+				return errors.Wrap(err, "cannot DeleteMessage")
+			}
+
+			contact := payload.contact
+			card := contact.ToString(c.Lang, c.Settings.ShowingAll())
+			return f.tgClient.EditContactMessage(ctx, card, c.UserID, payload.CardID, contact.ContactID, contact.PhotoID, c.Lang)
+		},
+	}
+}
+
+// acceptInteractionDate takes "-" for today in the time zone of the user.
+func (f *Flows) acceptInteractionDate(ctx context.Context, c *conversation.Chat, text string, payload *interactionPayload) error {
+	now := c.Settings.Now()
+	if strings.TrimSpace(text) == removeValue {
+		payload.Date = types.Day(now)
+		return nil
+	}
+
+	date, err := types.ParseInteractionDate(text, now)
+	if err != nil {
+		f.log(ctx).Debug("Cannot parse interaction date", zap.Error(err))
+		return conversation.Invalid(c.Lang.T(i18n.WrongInteractionDate))
+	}
+	payload.Date = date
+	return nil
+}
+
+// interactionKindNames lists the kinds for the user to choose from, e.g. "called, met, emailed".
+func interactionKindNames(lang i18n.Lang) string {
+	names := make([]string, 0, len(types.InteractionKinds))
+	for _, k := range types.InteractionKinds {
+		names = append(names, k.Name(lang))
+	}
+	return strings.Join(names, ", ")
+}
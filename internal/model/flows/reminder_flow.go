@@ -0,0 +1,87 @@
+package flows
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/profectus200/contact-book-bot/internal/i18n"
+	"github.com/profectus200/contact-book-bot/internal/model/conversation"
+	"github.com/profectus200/contact-book-bot/internal/types"
+	"go.uber.org/zap"
+)
+
+// reminderPayload is the state of adding a reminder about the contact shown in a card.
+type reminderPayload struct {
+	ContactID int       `json:"contact_id"`
+	Text      string    `json:"text,omitempty"`
+	DueAt     time.Time `json:"due_at"`
+
+	// tooMany is set when the user has enough reminders, passed from Finish to Done.
+	tooMany bool
+}
+
+// AddReminder asks what to remind the user of about the contact and when.
+func (f *Flows) AddReminder(ctx context.Context, c *conversation.Chat, contactID int) error {
+	return f.addReminder.Start(ctx, c, reminderPayload{ContactID: contactID})
+}
+
+func (f *Flows) reminderFlow() *conversation.Flow[reminderPayload] {
+	return &conversation.Flow[reminderPayload]{
+		Name: "contact.reminder",
+		Steps: []conversation.Step[reminderPayload]{
+			{
+				Name:   "text",
+				Prompt: conversation.Prompt[reminderPayload](i18n.EnterReminderText),
+				Accept: func(ctx context.Context, c *conversation.Chat, text string, payload *reminderPayload) error {
+					payload.Text = strings.TrimSpace(text)
+					return nil
+				},
+			},
+			{
+				Name:   "date",
+				Prompt: conversation.Prompt[reminderPayload](i18n.EnterReminderDate),
+				Accept: f.acceptReminderDate,
+			},
+		},
+		Finish: func(ctx context.Context, c *conversation.Chat, payload *reminderPayload) error {
+			reminders, err := f.contactsDB.GetReminders(ctx, c.UserID)
+			if err != nil {
+				return errors.Wrap(err, "cannot GetReminders")
+			}
+			if len(reminders) >= types.MaxReminders {
+				payload.tooMany = true
+				return nil
+			}
+
+			contact, err := f.contactForEditing(ctx, c, payload.ContactID)
+			if err != nil {
+				return err
+			}
+
+			reminder := types.Reminder{Text: payload.Text, DueAt: payload.DueAt}
+			f.log(ctx).Debug("Adding reminder", zap.Int("contact_id", contact.ContactID), zap.Time("due_at", reminder.DueAt))
+			return errors.Wrap(f.contactsDB.AddReminder(ctx, c.UserID, contact.ContactID, reminder), "cannot AddReminder")
+		},
+		Done: func(ctx context.Context, c *conversation.Chat, payload *reminderPayload) error {
+			if payload.tooMany {
+				return f.tgClient.SendMessage(ctx, c.Lang.T(i18n.TooManyReminders, types.MaxReminders), c.UserID)
+			}
+			dueAt := types.FormatDueAt(payload.DueAt, c.Settings.Location())
+			return f.tgClient.SendMessage(ctx, c.Lang.T(i18n.ReminderSet, dueAt), c.UserID)
+		},
+	}
+}
+
+// acceptReminderDate takes the moment in the time zone of the user, a day without the time
+// is at the reminder time of the settings.
+func (f *Flows) acceptReminderDate(ctx context.Context, c *conversation.Chat, text string, payload *reminderPayload) error {
+	dueAt, err := types.ParseReminderDate(text, c.Settings.Now(), c.Settings.ReminderTime)
+	if err != nil {
+		f.log(ctx).Debug("Cannot parse reminder date", zap.Error(err))
+		return conversation.Invalid(c.Lang.T(i18n.WrongReminderDate))
+	}
+	payload.DueAt = dueAt
+	return nil
+}
@@ -0,0 +1,142 @@
+package flows
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/profectus200/contact-book-bot/internal/i18n"
+	"github.com/profectus200/contact-book-bot/internal/model/conversation"
+	"github.com/profectus200/contact-book-bot/internal/types"
+	"go.uber.org/zap"
+)
+
+// settingPayload is the state of typing a setting from the /settings menu.
+type settingPayload struct {
+	// MenuID is the message with the /settings menu, updated with the new value.
+	MenuID       int    `json:"menu_id"`
+	Timezone     string `json:"timezone,omitempty"`
+	PhoneRegion  string `json:"phone_region,omitempty"`
+	ReminderTime int    `json:"reminder_time,omitempty"`
+	StaleDays    int    `json:"stale_days,omitempty"`
+
+	// settings are the saved settings, passed from Finish to Done.
+	settings types.Settings
+}
+
+type settingAcceptor func(ctx context.Context, c *conversation.Chat, text string, payload *settingPayload) error
+
+// settingApplier puts the accepted value into the settings.
+type settingApplier func(settings *types.Settings, payload *settingPayload)
+
+func (f *Flows) SetTimezone(ctx context.Context, c *conversation.Chat, menuID int) error {
+	return f.timezone.Start(ctx, c, settingPayload{MenuID: menuID})
+}
+
+func (f *Flows) SetPhoneRegion(ctx context.Context, c *conversation.Chat, menuID int) error {
+	return f.phoneRegion.Start(ctx, c, settingPayload{MenuID: menuID})
+}
+
+func (f *Flows) SetReminderTime(ctx context.Context, c *conversation.Chat, menuID int) error {
+	return f.reminderTime.Start(ctx, c, settingPayload{MenuID: menuID})
+}
+
+func (f *Flows) SetStaleDays(ctx context.Context, c *conversation.Chat, menuID int) error {
+	return f.staleDays.Start(ctx, c, settingPayload{MenuID: menuID})
+}
+
+// settingFlow saves a setting typed by the user and shows it in the /settings menu
+// the user came from, like fieldFlow does with the contact card.
+func (f *Flows) settingFlow(name string, prompt string, accept settingAcceptor, apply settingApplier) *conversation.Flow[settingPayload] {
+	return &conversation.Flow[settingPayload]{
+		Name: name,
+		Steps: []conversation.Step[settingPayload]{
+			{
+				Name:   "value",
+				Prompt: conversation.Prompt[settingPayload](prompt),
+				Accept: accept,
+			},
+		},
+		Finish: func(ctx context.Context, c *conversation.Chat, payload *settingPayload) error {
+			settings, err := f.settingsDB.GetSettings(ctx, c.UserID)
+			if err != nil {
+				return errors.Wrap(err, "cannot GetSettings")
+			}
+
+			apply(&settings, payload)
+
+			err = f.settingsDB.SaveSettings(ctx, c.UserID, settings)
+			if err != nil {
+				return errors.Wrap(err, "cannot SaveSettings")
+			}
+			payload.settings = settings
+			f.log(ctx).Debug("Settings changed")
+
+			return nil
+		},
+		Done: func(ctx context.Context, c *conversation.Chat, payload *settingPayload) error {
+			err := f.tgClient.DeleteMessage(ctx, c.UserID, c.MessageID)
+			if err != nil {
+				return errors.Wrap(err, "cannot DeleteMessage")
+			}
+
+			settings := payload.settings
+			return f.tgClient.EditSettings(ctx, settings.ToString(c.Lang), c.UserID, payload.MenuID, settings, c.Lang)
+		},
+	}
+}
+
+func (f *Flows) acceptTimezone(ctx context.Context, c *conversation.Chat, text string, payload *settingPayload) error {
+	timezone, err := types.ParseTimezone(text)
+	if err != nil {
+		f.log(ctx).Debug("Cannot parse timezone", zap.Error(err))
+		return conversation.Invalid(c.Lang.T(i18n.WrongTimezone))
+	}
+	payload.Timezone = timezone
+	return nil
+}
+
+func (f *Flows) acceptPhoneRegion(ctx context.Context, c *conversation.Chat, text string, payload *settingPayload) error {
+	region, err := types.ParsePhoneRegion(text)
+	if err != nil {
+		f.log(ctx).Debug("Cannot parse phone region", zap.Error(err))
+		return conversation.Invalid(c.Lang.T(i18n.WrongPhoneRegion))
+	}
+	payload.PhoneRegion = region
+	return nil
+}
+
+func (f *Flows) acceptReminderTime(ctx context.Context, c *conversation.Chat, text string, payload *settingPayload) error {
+	reminderTime, err := types.ParseReminderTime(text)
+	if err != nil {
+		f.log(ctx).Debug("Cannot parse reminder time", zap.Error(err))
+		return conversation.Invalid(c.Lang.T(i18n.WrongReminderTime))
+	}
+	payload.ReminderTime = reminderTime
+	return nil
+}
+
+func (f *Flows) acceptStaleDays(ctx context.Context, c *conversation.Chat, text string, payload *settingPayload) error {
+	days, err := types.ParseStaleDays(text)
+	if err != nil {
+		f.log(ctx).Debug("Cannot parse stale days", zap.Error(err))
+		return conversation.Invalid(c.Lang.T(i18n.WrongStaleDays))
+	}
+	payload.StaleDays = days
+	return nil
+}
+
+func applyTimezone(settings *types.Settings, payload *settingPayload) {
+	settings.Timezone = payload.Timezone
+}
+
+func applyPhoneRegion(settings *types.Settings, payload *settingPayload) {
+	settings.PhoneRegion = payload.PhoneRegion
+}
+
+func applyReminderTime(settings *types.Settings, payload *settingPayload) {
+	settings.ReminderTime = payload.ReminderTime
+}
+
+func applyStaleDays(settings *types.Settings, payload *settingPayload) {
+	settings.StaleDays = payload.StaleDays
+}
@@ -0,0 +1,76 @@
+package flows
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/profectus200/contact-book-bot/internal/i18n"
+	"github.com/profectus200/contact-book-bot/internal/model/conversation"
+	"github.com/profectus200/contact-book-bot/internal/types"
+	"go.uber.org/zap"
+)
+
+// webhookPayload is the state of adding a webhook from /webhooks.
+type webhookPayload struct {
+	URL string `json:"url,omitempty"`
+
+	// webhook is the added one and tooMany is set instead when the user has enough,
+	// passed from Finish to Done.
+	webhook types.Webhook
+	tooMany bool
+}
+
+// AddWebhook asks for the URL of a new webhook.
+func (f *Flows) AddWebhook(ctx context.Context, c *conversation.Chat) error {
+	return f.addWebhook.Start(ctx, c, webhookPayload{})
+}
+
+func (f *Flows) webhookFlow() *conversation.Flow[webhookPayload] {
+	return &conversation.Flow[webhookPayload]{
+		Name: "webhooks.add",
+		Steps: []conversation.Step[webhookPayload]{
+			{
+				Name:   "url",
+				Prompt: conversation.Prompt[webhookPayload](i18n.EnterWebhookURL),
+				Accept: func(ctx context.Context, c *conversation.Chat, text string, payload *webhookPayload) error {
+					url, err := types.ParseWebhookURL(text)
+					if err != nil {
+						f.log(ctx).Debug("Cannot parse webhook URL", zap.Error(err))
+						return conversation.Invalid(c.Lang.T(i18n.WrongWebhookURL))
+					}
+					payload.URL = url
+					return nil
+				},
+			},
+		},
+		Finish: func(ctx context.Context, c *conversation.Chat, payload *webhookPayload) error {
+			// The list may have been sent before the other webhooks were added.
+			webhooks, err := f.webhooksDB.GetWebhooks(ctx, c.UserID)
+			if err != nil {
+				return errors.Wrap(err, "cannot GetWebhooks")
+			}
+			if len(webhooks) >= types.MaxWebhooks {
+				payload.tooMany = true
+				return nil
+			}
+
+			secret, err := types.NewWebhookSecret()
+			if err != nil {
+				return errors.Wrap(err, "cannot NewWebhookSecret")
+			}
+			webhook := types.Webhook{UserID: c.UserID, URL: payload.URL, Secret: secret, CreatedAt: time.Now()}
+			if payload.webhook, err = f.webhooksDB.AddWebhook(ctx, webhook); err != nil {
+				return errors.Wrap(err, "cannot AddWebhook")
+			}
+			f.log(ctx).Info("Webhook added", zap.Int("webhook_id", payload.webhook.ID))
+			return nil
+		},
+		Done: func(ctx context.Context, c *conversation.Chat, payload *webhookPayload) error {
+			if payload.tooMany {
+				return f.tgClient.SendMessage(ctx, c.Lang.T(i18n.TooManyWebhooks, types.MaxWebhooks), c.UserID)
+			}
+			return f.tgClient.SendMessage(ctx, c.Lang.T(i18n.WebhookAdded, payload.webhook.URL, payload.webhook.Secret), c.UserID)
+		},
+	}
+}
@@ -0,0 +1,133 @@
+package flows
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/profectus200/contact-book-bot/internal/i18n"
+	"github.com/profectus200/contact-book-bot/internal/model/conversation"
+	"github.com/profectus200/contact-book-bot/internal/types"
+	"go.uber.org/zap"
+)
+
+// wizardPayload collects the fields of a new contact one by one. Skipped fields stay empty.
+type wizardPayload struct {
+	ContactID   int             `json:"contact_id"`
+	Name        string          `json:"name,omitempty"`
+	Phone       string          `json:"phone,omitempty"`
+	Email       string          `json:"email,omitempty"`
+	Birthday    *types.Birthday `json:"birthday,omitempty"`
+	Description string          `json:"description,omitempty"`
+
+	// contact is the created contact, passed from Finish to Done.
+	contact *types.Contact
+}
+
+// AddContact asks for every field of a new contact in turn and creates the contact
+// after the last one. The contact gets the ID of the card it is added from.
+func (f *Flows) AddContact(ctx context.Context, c *conversation.Chat, contactID int) error {
+	return f.addContact.Start(ctx, c, wizardPayload{ContactID: contactID})
+}
+
+func (f *Flows) wizardFlow() *conversation.Flow[wizardPayload] {
+	return &conversation.Flow[wizardPayload]{
+		Name: "contact.add",
+		Steps: []conversation.Step[wizardPayload]{
+			{
+				Name:   "name",
+				Prompt: conversation.Prompt[wizardPayload](i18n.WizardName),
+				Accept: skippable(func(ctx context.Context, c *conversation.Chat, text string, payload *wizardPayload) error {
+					payload.Name = text
+					return nil
+				}),
+			},
+			{
+				Name:   "phone",
+				Prompt: conversation.Prompt[wizardPayload](i18n.WizardPhone),
+				Accept: skippable(func(ctx context.Context, c *conversation.Chat, text string, payload *wizardPayload) error {
+					payload.Phone = types.WithCountryCode(text, c.Settings.PhoneRegion)
+					return nil
+				}),
+			},
+			{
+				Name:   "email",
+				Prompt: conversation.Prompt[wizardPayload](i18n.WizardEmail),
+				Accept: skippable(func(ctx context.Context, c *conversation.Chat, text string, payload *wizardPayload) error {
+					email, err := types.ParseEmail(text)
+					if err != nil {
+						f.log(ctx).Debug("Cannot parse email", zap.Error(err))
+						return conversation.Invalid(c.Lang.T(i18n.WrongEmail))
+					}
+					payload.Email = email
+					return nil
+				}),
+			},
+			{
+				Name:   "birthday",
+				Prompt: conversation.Prompt[wizardPayload](i18n.WizardBirthday),
+				Accept: skippable(func(ctx context.Context, c *conversation.Chat, text string, payload *wizardPayload) error {
+					birthday, err := types.ParseBirthday(text, c.Settings.Now())
+					if err != nil {
+						f.log(ctx).Debug("Cannot parse birthday", zap.Error(err))
+						return conversation.Invalid(c.Lang.T(i18n.WrongBirthday))
+					}
+					payload.Birthday = &birthday
+					return nil
+				}),
+			},
+			{
+				Name:   "description",
+				Prompt: conversation.Prompt[wizardPayload](i18n.WizardDescription),
+				Accept: skippable(func(ctx context.Context, c *conversation.Chat, text string, payload *wizardPayload) error {
+					payload.Description = text
+					return nil
+				}),
+			},
+		},
+		Finish: func(ctx context.Context, c *conversation.Chat, payload *wizardPayload) error {
+			existing, err := f.contactsDB.GetContact(ctx, c.UserID, payload.ContactID)
+			if err != nil {
+				return errors.Wrap(err, "cannot GetContact")
+			}
+			if existing != nil {
+				// The card was edited with its buttons while the wizard was running.
+				return errors.Errorf("contact %d already exists", payload.ContactID)
+			}
+
+			contact := types.NewContact(c.Lang)
+			contact.ContactID = payload.ContactID
+			if payload.Name != "" {
+				contact.Name = payload.Name
+			}
+			contact.Phone = payload.Phone
+			contact.Email = payload.Email
+			contact.Birthday = payload.Birthday
+			contact.Description = payload.Description
+
+			err = f.contactsDB.WriteContact(ctx, c.UserID, contact)
+			if err != nil {
+				return errors.Wrap(err, "cannot WriteContact")
+			}
+			payload.contact = contact
+			f.log(ctx).Info("Contact added", zap.Int("contact_id", contact.ContactID))
+
+			return nil
+		},
+		Done: func(ctx context.Context, c *conversation.Chat, payload *wizardPayload) error {
+			summary := c.Lang.T(i18n.WizardSummary) + "\n" + payload.contact.ToString(c.Lang, c.Settings.ShowingAll())
+			return f.tgClient.SendContactSummary(ctx, summary, c.UserID, payload.contact.ContactID, c.Lang)
+		},
+	}
+}
+
+// skippable lets the user skip the step of the wizard with "-".
+func skippable(accept func(ctx context.Context, c *conversation.Chat, text string, payload *wizardPayload) error,
+) func(ctx context.Context, c *conversation.Chat, text string, payload *wizardPayload) error {
+	return func(ctx context.Context, c *conversation.Chat, text string, payload *wizardPayload) error {
+		if strings.TrimSpace(text) == removeValue {
+			return nil
+		}
+		return accept(ctx, c, text, payload)
+	}
+}
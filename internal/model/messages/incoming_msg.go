@@ -2,47 +2,103 @@ package messages
 
 import (
 	"context"
+	"strings"
+
 	"github.com/opentracing/opentracing-go"
-	"time"
+	"go.uber.org/zap"
 
+	"github.com/profectus200/contact-book-bot/cmd/logging"
+	"github.com/profectus200/contact-book-bot/internal/i18n"
+	"github.com/profectus200/contact-book-bot/internal/model/conversation"
 	"github.com/profectus200/contact-book-bot/internal/types"
 )
 
 type messageSender interface {
-	SendMessage(text string, userID int64) error
-	EditContact(text string, userID int64) error
-	EditContactMessage(text string, userID int64, messageID int) error
-	DeleteMessage(userID int64, messageID int) error
+	SendMessage(ctx context.Context, text string, userID int64) error
+	EditContact(ctx context.Context, text string, userID int64, contactID int, photoID string, lang i18n.Lang) error
+	ChooseLanguage(ctx context.Context, text string, userID int64) error
+	SendSettings(ctx context.Context, text string, userID int64, settings types.Settings, lang i18n.Lang) error
+	SendDuplicates(ctx context.Context, text string, userID int64, dup types.Duplicate, page int, lang i18n.Lang) error
+	SendReminders(ctx context.Context, text string, userID int64, reminders []types.Reminder, lang i18n.Lang) error
 }
 
 type contactsDB interface {
-	WriteContact(ctx context.Context, userID int64, contact *types.Contact) error
-	GetContact(ctx context.Context, userID int64, contactID int) (*types.Contact, error)
-	GetContactByName(ctx context.Context, userID int64, name string) ([]*types.Contact, error)
 	GetAllContacts(ctx context.Context, userID int64) ([]*types.Contact, error)
-	WriteName(ctx context.Context, name string, userID int64, contactID int) error
-	WritePhone(ctx context.Context, phone string, userID int64, contactID int) error
-	WriteBirthday(ctx context.Context, birthday time.Time, userID int64, contactID int) error
-	WriteDescription(ctx context.Context, description string, userID int64, contactID int) error
+	SearchContacts(ctx context.Context, userID int64, query types.SearchQuery) ([]types.SearchResult, error)
+	GetReminders(ctx context.Context, userID int64) ([]types.Reminder, error)
+}
+
+type conversations interface {
+	Handle(ctx context.Context, c *conversation.Chat, text string) (bool, error)
+	Cancel(ctx context.Context, userID int64) (bool, error)
+	Search(ctx context.Context, c *conversation.Chat) error
+	EditByID(ctx context.Context, c *conversation.Chat) error
+}
+
+type calendar interface {
+	ShowLink(ctx context.Context, userID int64, lang i18n.Lang) error
+}
+
+type carddav interface {
+	IssuePassword(ctx context.Context, userID int64, lang i18n.Lang) error
+}
+
+type apiTokens interface {
+	IssueToken(ctx context.Context, userID int64, lang i18n.Lang) error
+}
+
+type webhooks interface {
+	ShowWebhooks(ctx context.Context, userID int64, lang i18n.Lang) error
+}
+
+type admin interface {
+	IsAdmin(userID int64) bool
+	ShowStats(ctx context.Context, adminID int64, lang i18n.Lang) error
+	ShowUser(ctx context.Context, adminID int64, arg string, lang i18n.Lang) error
+	SetBanned(ctx context.Context, adminID int64, arg string, banned bool, lang i18n.Lang) error
+	Broadcast(ctx context.Context, adminID int64, messageID int, text string, lang i18n.Lang) error
+}
+
+type access interface {
+	ShowAccess(ctx context.Context, adminID int64, arg string, lang i18n.Lang) error
+	Allow(ctx context.Context, adminID int64, arg string, lang i18n.Lang) error
+	Disallow(ctx context.Context, adminID int64, arg string, lang i18n.Lang) error
+	Invite(ctx context.Context, adminID int64, lang i18n.Lang) error
 }
 
-type usersDB interface {
-	ToWaitState(ctx context.Context, userID int64) error
-	SetCurrentState(ctx context.Context, userID int64, state types.CurrentState) error
-	GetCurrentState(ctx context.Context, userID int64) (*types.UserStateType, bool)
+type account interface {
+	ExportData(ctx context.Context, userID int64, lang i18n.Lang) error
+	AskDelete(ctx context.Context, userID int64, lang i18n.Lang) error
 }
 
 type Model struct {
-	tgClient   messageSender
-	contactsDB contactsDB
-	usersDB    usersDB
+	tgClient      messageSender
+	contactsDB    contactsDB
+	conversations conversations
+	calendar      calendar
+	carddav       carddav
+	apiTokens     apiTokens
+	webhooks      webhooks
+	account       account
+	admin         admin
+	access        access
+	logger        *zap.Logger
 }
 
-func New(tgClient messageSender, contactsDB contactsDB, usersDB usersDB) *Model {
+func New(tgClient messageSender, contactsDB contactsDB, conversations conversations, calendar calendar,
+	carddav carddav, apiTokens apiTokens, webhooks webhooks, account account, admin admin, access access, logger *zap.Logger) *Model {
 	return &Model{
-		tgClient:   tgClient,
-		contactsDB: contactsDB,
-		usersDB:    usersDB,
+		tgClient:      tgClient,
+		contactsDB:    contactsDB,
+		conversations: conversations,
+		calendar:      calendar,
+		carddav:       carddav,
+		apiTokens:     apiTokens,
+		webhooks:      webhooks,
+		account:       account,
+		admin:         admin,
+		access:        access,
+		logger:        logger.Named("messages"),
 	}
 }
 
@@ -50,53 +106,121 @@ type Message struct {
 	Text      string
 	UserID    int64
 	MessageID int
+	// PhotoID is the file_id of the photo sent, its caption is in Text.
+	PhotoID string
+	// Lang is the language to answer in.
+	Lang     i18n.Lang
+	Settings types.Settings
 }
 
-const (
-	getContactMsg  = "Write the name of your contact:"
-	editContactMsg = "Write ID of the contact you want to edit:"
-)
+// chat is the user sending the message, for the conversations.
+func (msg *Message) chat() *conversation.Chat {
+	return &conversation.Chat{
+		UserID:    msg.UserID,
+		MessageID: msg.MessageID,
+		PhotoID:   msg.PhotoID,
+		Lang:      msg.Lang,
+		Settings:  msg.Settings,
+	}
+}
 
 func (s *Model) IncomingMessage(ctx context.Context, msg *Message) error {
 	span, ctx := opentracing.StartSpanFromContext(
 		ctx,
 		"IncomingMessage",
 	)
-	span.SetTag("message", msg.Text)
+	// Only the command is tagged: the rest of the text may be contact data.
+	if strings.HasPrefix(msg.Text, "/") {
+		span.SetTag("command", strings.Fields(msg.Text)[0])
+	}
 	defer span.Finish()
 
+	// The commands with an argument.
+	switch command, arg, _ := strings.Cut(msg.Text, " "); command {
+	case "/start":
+		// The argument is the invite code, used before the message gets here.
+		return s.tgClient.SendMessage(ctx, msg.Lang.T(i18n.Start), msg.UserID)
+	case "/search":
+		return s.search(ctx, msg, arg)
+	case "/stale":
+		return s.listStale(ctx, msg, arg)
+	case "/stats", "/user", "/ban", "/unban", "/broadcast", "/access", "/allow", "/disallow", "/invite":
+		// The commands of the admins are unknown to everyone else.
+		if s.admin.IsAdmin(msg.UserID) {
+			return s.adminCommand(ctx, msg, command, arg)
+		}
+	}
+
 	// Trying to recognize the command.
 	switch msg.Text {
-	case "/start":
-		return s.tgClient.SendMessage("Hello! You can save people contacts here!:)", msg.UserID)
 	case "/add_contact":
-		return s.addContact(ctx, msg.UserID)
+		return s.addContact(ctx, msg)
 	case "/get_contact":
-		return s.getContact(ctx, msg.UserID)
+		return s.conversations.Search(ctx, msg.chat())
 	case "/edit_contact":
-		return s.editContact(ctx, msg.UserID)
+		return s.conversations.EditByID(ctx, msg.chat())
 	case "/list_contacts":
-		return s.listContacts(ctx, msg.UserID)
+		return s.listContacts(ctx, msg)
+	case "/duplicates":
+		return s.findDuplicates(ctx, msg)
+	case "/reminders":
+		return s.listReminders(ctx, msg)
+	case "/upcoming":
+		return s.listUpcoming(ctx, msg)
+	case "/calendar":
+		return s.calendar.ShowLink(ctx, msg.UserID, msg.Lang)
+	case "/carddav":
+		return s.carddav.IssuePassword(ctx, msg.UserID, msg.Lang)
+	case "/token":
+		return s.apiTokens.IssueToken(ctx, msg.UserID, msg.Lang)
+	case "/webhooks":
+		return s.webhooks.ShowWebhooks(ctx, msg.UserID, msg.Lang)
+	case "/mydata":
+		return s.account.ExportData(ctx, msg.UserID, msg.Lang)
+	case "/delete_account":
+		return s.account.AskDelete(ctx, msg.UserID, msg.Lang)
+	case "/language":
+		return s.tgClient.ChooseLanguage(ctx, msg.Lang.T(i18n.ChooseLanguage), msg.UserID)
+	case "/settings":
+		return s.tgClient.SendSettings(ctx, msg.Settings.ToString(msg.Lang), msg.UserID, msg.Settings, msg.Lang)
+	case "/cancel":
+		return s.cancel(ctx, msg)
 	}
 
-	// It is not a known command - maybe it is message to change the state.
-	if userState, ok := s.usersDB.GetCurrentState(ctx, msg.UserID); ok {
-		switch userState.CurrentState.State {
-		case types.EditingName:
-			return s.nameEntered(ctx, msg, userState.CurrentState)
-		case types.EditingPhone:
-			return s.phoneEntered(ctx, msg, userState.CurrentState)
-		case types.EditingBirthday:
-			return s.birthdayEntered(ctx, msg, userState.CurrentState)
-		case types.EditingDescription:
-			return s.descriptionEntered(ctx, msg, userState.CurrentState)
-		case types.EditingSearchPhrase:
-			return s.searchPhraseEntered(ctx, msg)
-		case types.EditingEditID:
-			return s.editIDEntered(ctx, msg)
-		case types.WaitState:
-		}
+	// It is not a known command - maybe it is an answer in a conversation.
+	handled, err := s.conversations.Handle(ctx, msg.chat(), msg.Text)
+	if err != nil || handled {
+		return err
 	}
 
-	return s.tgClient.SendMessage("I do not know such a command", msg.UserID)
+	s.log(ctx).Debug("Unknown command")
+	return s.tgClient.SendMessage(ctx, msg.Lang.T(i18n.UnknownCommand), msg.UserID)
+}
+
+func (s *Model) adminCommand(ctx context.Context, msg *Message, command, arg string) error {
+	s.log(ctx).Info("Admin command")
+
+	switch command {
+	case "/stats":
+		return s.admin.ShowStats(ctx, msg.UserID, msg.Lang)
+	case "/user":
+		return s.admin.ShowUser(ctx, msg.UserID, arg, msg.Lang)
+	case "/ban":
+		return s.admin.SetBanned(ctx, msg.UserID, arg, true, msg.Lang)
+	case "/unban":
+		return s.admin.SetBanned(ctx, msg.UserID, arg, false, msg.Lang)
+	case "/access":
+		return s.access.ShowAccess(ctx, msg.UserID, arg, msg.Lang)
+	case "/allow":
+		return s.access.Allow(ctx, msg.UserID, arg, msg.Lang)
+	case "/disallow":
+		return s.access.Disallow(ctx, msg.UserID, arg, msg.Lang)
+	case "/invite":
+		return s.access.Invite(ctx, msg.UserID, msg.Lang)
+	}
+	return s.admin.Broadcast(ctx, msg.UserID, msg.MessageID, arg, msg.Lang)
+}
+
+func (s *Model) log(ctx context.Context) *zap.Logger {
+	return logging.FromContext(ctx, s.logger)
 }
@@ -2,281 +2,156 @@ package messages
 
 import (
 	"context"
-	"fmt"
-	"strconv"
-	"time"
+	"strings"
 
 	"github.com/pkg/errors"
+	"github.com/profectus200/contact-book-bot/internal/i18n"
+	"github.com/profectus200/contact-book-bot/internal/model/flows"
 	"github.com/profectus200/contact-book-bot/internal/types"
+	"go.uber.org/zap"
 )
 
-func (s *Model) editContactAfterEditing(ctx context.Context, contact *types.Contact, userID int64, messageID int) error {
-	message := contact.ToString()
-	return s.tgClient.EditContactMessage(message, userID, messageID)
+// addContact shows the card of a new contact. The contact is created on the first edit.
+func (s *Model) addContact(ctx context.Context, msg *Message) error {
+	card := types.NewContact(msg.Lang).ToString(msg.Lang, msg.Settings.ShowingAll())
+	return s.tgClient.EditContact(ctx, card, msg.UserID, 0, "", msg.Lang)
 }
 
-func (s *Model) nameEntered(ctx context.Context, msg *Message, userState types.CurrentState) error {
-	name := msg.Text
-
-	contact, err := s.contactsDB.GetContact(ctx, msg.UserID, userState.ContactID)
-	if err != nil {
-		return errors.Wrap(err, "cannot GetContact")
-	}
-
-	if contact == nil {
-		contact = types.NewContact()
-		contact.ContactID = userState.ContactID
-		err := s.initializeContact(ctx, msg, contact)
-		if err != nil {
-			return errors.Wrap(err, "cannot InitializeContact")
-		}
-	}
-
-	contact.Name = name
-	err = s.contactsDB.WriteName(ctx, name, msg.UserID, userState.ContactID)
-	if err != nil {
-		return errors.Wrap(err, "cannot WriteName")
-	}
-
-	err = s.tgClient.DeleteMessage(msg.UserID, msg.MessageID)
+func (s *Model) listContacts(ctx context.Context, msg *Message) error {
+	contacts, err := s.contactsDB.GetAllContacts(ctx, msg.UserID)
 	if err != nil {
-		return errors.Wrap(err, "cannot DeleteMessage")
+		return errors.Wrap(err, "cannot GetAllContacts")
 	}
 
-	err = s.usersDB.ToWaitState(ctx, msg.UserID)
-	if err != nil {
-		return errors.Wrap(err, "cannot ToWaitState")
+	if len(contacts) == 0 {
+		return s.tgClient.SendMessage(ctx, msg.Lang.T(i18n.NoContacts), msg.UserID)
 	}
-
-	return s.editContactAfterEditing(ctx, contact, msg.UserID, userState.MessageID)
+	return s.tgClient.SendMessage(ctx, flows.ContactsText(contacts, msg.chat()), msg.UserID)
 }
 
-func (s *Model) phoneEntered(ctx context.Context, msg *Message, userState types.CurrentState) error {
-	phone := msg.Text
-
-	contact, err := s.contactsDB.GetContact(ctx, msg.UserID, userState.ContactID)
-	if err != nil {
-		return errors.Wrap(err, "cannot GetContact")
-	}
-
-	if contact == nil {
-		contact = types.NewContact()
-		contact.ContactID = userState.ContactID
-		err := s.initializeContact(ctx, msg, contact)
-		if err != nil {
-			return errors.Wrap(err, "cannot InitializeContact")
-		}
-	}
-
-	contact.Phone = phone
-	err = s.contactsDB.WritePhone(ctx, phone, msg.UserID, userState.ContactID)
-	if err != nil {
-		return errors.Wrap(err, "cannot WritePhone")
-	}
-
-	err = s.tgClient.DeleteMessage(msg.UserID, msg.MessageID)
+// search shows the contacts found by the words of the query, the best matches first,
+// with the found words highlighted in their descriptions.
+func (s *Model) search(ctx context.Context, msg *Message, text string) error {
+	query, err := types.ParseSearchQuery(text)
 	if err != nil {
-		return errors.Wrap(err, "cannot DeleteMessage")
+		return s.tgClient.SendMessage(ctx, msg.Lang.T(i18n.SearchUsage), msg.UserID)
 	}
 
-	err = s.usersDB.ToWaitState(ctx, msg.UserID)
+	results, err := s.contactsDB.SearchContacts(ctx, msg.UserID, query)
 	if err != nil {
-		return errors.Wrap(err, "cannot ToWaitState")
+		return errors.Wrap(err, "cannot SearchContacts")
 	}
+	s.log(ctx).Debug("Contacts searched", zap.Int("terms", len(query.Terms)), zap.Int("found", len(results)))
 
-	return s.editContactAfterEditing(ctx, contact, msg.UserID, userState.MessageID)
-}
-
-func (s *Model) birthdayEntered(ctx context.Context, msg *Message, userState types.CurrentState) error {
-	year := time.Now().Year() - 1000
-	dateString := fmt.Sprintf("%s.%d", msg.Text, year)
-	birthday, err := time.Parse("02.01.2006", dateString)
-	if err != nil {
-		return errors.Wrap(err, "Cannot time.Parse")
-	}
-
-	contact, err := s.contactsDB.GetContact(ctx, msg.UserID, userState.ContactID)
-	if err != nil {
-		return errors.Wrap(err, "cannot GetContact")
+	if len(results) == 0 {
+		return s.tgClient.SendMessage(ctx, msg.Lang.T(i18n.SearchNothing), msg.UserID)
 	}
 
-	if contact == nil {
-		contact = types.NewContact()
-		contact.ContactID = userState.ContactID
-		err := s.initializeContact(ctx, msg, contact)
-		if err != nil {
-			return errors.Wrap(err, "cannot InitializeContact")
+	text = ""
+	for _, result := range results {
+		text += result.Contact.ToString(msg.Lang, msg.Settings)
+		if result.Snippet != "" {
+			text += msg.Lang.T(i18n.SearchSnippet, result.Snippet) + "\n"
 		}
+		text += msg.Lang.T(i18n.ContactsSeparator) + "\n"
 	}
-
-	contact.Birthday = birthday
-	err = s.contactsDB.WriteBirthday(ctx, birthday, msg.UserID, userState.ContactID)
-	if err != nil {
-		return errors.Wrap(err, "cannot WriteBirthday")
-	}
-
-	err = s.tgClient.DeleteMessage(msg.UserID, msg.MessageID)
-	if err != nil {
-		return errors.Wrap(err, "cannot DeleteMessage")
-	}
-
-	err = s.usersDB.ToWaitState(ctx, msg.UserID)
-	if err != nil {
-		return errors.Wrap(err, "cannot ToWaitState")
-	}
-
-	return s.editContactAfterEditing(ctx, contact, msg.UserID, userState.MessageID)
+	return s.tgClient.SendMessage(ctx, text, msg.UserID)
 }
 
-func (s *Model) descriptionEntered(ctx context.Context, msg *Message, userState types.CurrentState) error {
-	description := msg.Text
-
-	contact, err := s.contactsDB.GetContact(ctx, msg.UserID, userState.ContactID)
-	if err != nil {
-		return errors.Wrap(err, "cannot GetContact")
-	}
-
-	if contact == nil {
-		contact = types.NewContact()
-		contact.ContactID = userState.ContactID
-		err := s.initializeContact(ctx, msg, contact)
+// listStale shows the contacts not contacted for longer than the days in the settings,
+// or the days written after the command.
+func (s *Model) listStale(ctx context.Context, msg *Message, arg string) error {
+	days := msg.Settings.StaleDays
+	if strings.TrimSpace(arg) != "" {
+		var err error
+		days, err = types.ParseStaleDays(arg)
 		if err != nil {
-			return errors.Wrap(err, "cannot InitializeContact")
+			return s.tgClient.SendMessage(ctx, msg.Lang.T(i18n.StaleUsage), msg.UserID)
 		}
 	}
 
-	contact.Description = description
-	err = s.contactsDB.WriteDescription(ctx, description, msg.UserID, userState.ContactID)
+	contacts, err := s.contactsDB.GetAllContacts(ctx, msg.UserID)
 	if err != nil {
-		return errors.Wrap(err, "cannot WriteDescription")
-	}
-
-	err = s.tgClient.DeleteMessage(msg.UserID, msg.MessageID)
-	if err != nil {
-		return errors.Wrap(err, "cannot DeleteMessage")
+		return errors.Wrap(err, "cannot GetAllContacts")
 	}
-
-	err = s.usersDB.ToWaitState(ctx, msg.UserID)
-	if err != nil {
-		return errors.Wrap(err, "cannot ToWaitState")
+	if len(contacts) == 0 {
+		return s.tgClient.SendMessage(ctx, msg.Lang.T(i18n.NoContacts), msg.UserID)
 	}
 
-	return s.editContactAfterEditing(ctx, contact, msg.UserID, userState.MessageID)
-}
-
-func (s *Model) initializeContact(ctx context.Context, msg *Message, contact *types.Contact) error {
-	err := s.contactsDB.WriteContact(ctx, msg.UserID, contact)
-	if err != nil {
-		return errors.Wrap(err, "cannot WriteContact")
+	stale := types.StaleContacts(contacts, days, msg.Settings.Now())
+	s.log(ctx).Debug("Stale contacts found", zap.Int("days", days), zap.Int("stale", len(stale)))
+	if len(stale) == 0 {
+		return s.tgClient.SendMessage(ctx, msg.Lang.T(i18n.NoStale, days, msg.Lang.Plural(i18n.Days, days)), msg.UserID)
 	}
 
-	return nil
-}
-
-func (s *Model) addContact(ctx context.Context, userID int64) error {
-	err := s.usersDB.SetCurrentState(ctx, userID, types.CurrentState{
-		ContactID: 0,
-		MessageID: 0,
-		State:     types.WaitState,
-	})
-	if err != nil {
-		return errors.Wrap(err, "cannot SetCurrentState")
+	text := msg.Lang.T(i18n.StaleTitle, days, msg.Lang.Plural(i18n.Days, days)) + "\n"
+	for _, contact := range stale {
+		text += contact.ToString(msg.Lang, msg.Settings) + msg.Lang.T(i18n.ContactsSeparator) + "\n"
 	}
-
-	return s.tgClient.EditContact(types.NewContact().ToString(), userID)
+	return s.tgClient.SendMessage(ctx, text, msg.UserID)
 }
 
-func (s *Model) getContact(ctx context.Context, userID int64) error {
-	err := s.tgClient.SendMessage(getContactMsg, userID)
+// listReminders shows the reminders not delivered yet with the buttons cancelling them.
+func (s *Model) listReminders(ctx context.Context, msg *Message) error {
+	reminders, err := s.contactsDB.GetReminders(ctx, msg.UserID)
 	if err != nil {
-		return errors.Wrap(err, "cannot SendMessage")
+		return errors.Wrap(err, "cannot GetReminders")
 	}
-
-	err = s.usersDB.SetCurrentState(ctx, userID, types.CurrentState{
-		ContactID: -1,
-		State:     types.EditingSearchPhrase,
-	})
-	if err != nil {
-		return errors.Wrap(err, "cannot SetCurrentState")
+	if len(reminders) == 0 {
+		return s.tgClient.SendMessage(ctx, msg.Lang.T(i18n.NoReminders), msg.UserID)
 	}
 
-	return nil
+	reminders = types.ListedReminders(reminders)
+	text := types.ListReminders(reminders, msg.Lang, msg.Settings.Location())
+	return s.tgClient.SendReminders(ctx, text, msg.UserID, reminders, msg.Lang)
 }
 
-func (s *Model) searchPhraseEntered(ctx context.Context, msg *Message) error {
-	searchPhrase := msg.Text
-
-	contacts, err := s.contactsDB.GetContactByName(ctx, msg.UserID, searchPhrase)
+// listUpcoming shows the birthdays and the other dates of the contacts coming in the next days.
+func (s *Model) listUpcoming(ctx context.Context, msg *Message) error {
+	contacts, err := s.contactsDB.GetAllContacts(ctx, msg.UserID)
 	if err != nil {
-		return errors.Wrap(err, "cannot GetContactByName")
+		return errors.Wrap(err, "cannot GetAllContacts")
 	}
 
-	err = s.usersDB.ToWaitState(ctx, msg.UserID)
-	if err != nil {
-		return errors.Wrap(err, "cannot ToWaitState")
+	days := types.UpcomingDays
+	upcoming := types.Upcoming(contacts, msg.Settings.Now(), days)
+	s.log(ctx).Debug("Upcoming dates found", zap.Int("count", len(upcoming)))
+	if len(upcoming) == 0 {
+		return s.tgClient.SendMessage(ctx, msg.Lang.T(i18n.NoUpcoming, days, msg.Lang.Plural(i18n.Days, days)), msg.UserID)
 	}
 
-	text := ""
-	for _, contact := range contacts {
-		text += contact.ToString() + "-----------------------------\n"
+	lines := []string{msg.Lang.T(i18n.UpcomingTitle, days, msg.Lang.Plural(i18n.Days, days))}
+	for _, occasion := range upcoming {
+		lines = append(lines, occasion.ToString(msg.Lang))
 	}
-
-	return s.tgClient.SendMessage(text, msg.UserID)
+	return s.tgClient.SendMessage(ctx, strings.Join(lines, "\n"), msg.UserID)
 }
 
-func (s *Model) editContact(ctx context.Context, userID int64) error {
-	err := s.tgClient.SendMessage(editContactMsg, userID)
+// findDuplicates shows the first pair of possible duplicates, the buttons go on to the others.
+func (s *Model) findDuplicates(ctx context.Context, msg *Message) error {
+	contacts, err := s.contactsDB.GetAllContacts(ctx, msg.UserID)
 	if err != nil {
-		return errors.Wrap(err, "cannot SendMessage")
-	}
-
-	err = s.usersDB.SetCurrentState(ctx, userID, types.CurrentState{
-		ContactID: -1,
-		State:     types.EditingEditID,
-	})
-	if err != nil {
-		return errors.Wrap(err, "cannot SetCurrentState")
-	}
-
-	return nil
-}
-
-func (s *Model) editIDEntered(ctx context.Context, msg *Message) error {
-	ID, err := strconv.Atoi(msg.Text)
-	if err != nil {
-		return errors.Wrap(err, "cannot convert string to int")
-	}
-
-	contact, err := s.contactsDB.GetContact(ctx, msg.UserID, ID)
-	if err != nil {
-		return errors.Wrap(err, "cannot GetContact")
+		return errors.Wrap(err, "cannot GetAllContacts")
 	}
 
-	err = s.usersDB.SetCurrentState(ctx, msg.UserID, types.CurrentState{
-		ContactID: contact.ContactID,
-		State:     types.WaitState,
-	})
-	if err != nil {
-		return errors.Wrap(err, "cannot SetCurrentState")
+	duplicates := types.FindDuplicates(contacts, msg.Settings.PhoneRegion)
+	if len(duplicates) == 0 {
+		return s.tgClient.SendMessage(ctx, msg.Lang.T(i18n.NoDuplicates), msg.UserID)
 	}
+	s.log(ctx).Debug("Duplicates found", zap.Int("pairs", len(duplicates)))
 
-	return s.tgClient.EditContact(contact.ToString(), msg.UserID)
+	return s.tgClient.SendDuplicates(ctx, duplicates[0].ToString(msg.Lang, 1, len(duplicates)), msg.UserID, duplicates[0], 0, msg.Lang)
 }
 
-func (s *Model) listContacts(ctx context.Context, userID int64) error {
-	contacts, err := s.contactsDB.GetAllContacts(ctx, userID)
+func (s *Model) cancel(ctx context.Context, msg *Message) error {
+	cancelled, err := s.conversations.Cancel(ctx, msg.UserID)
 	if err != nil {
-		return errors.Wrap(err, "cannot GetAllContacts")
+		return errors.Wrap(err, "cannot Cancel")
 	}
 
-	text := ""
-	if len(contacts) == 0 {
-		text = "You don't have any contacts saved yet!"
-	} else {
-		for _, contact := range contacts {
-			text += contact.ToString() + "-----------------------------\n"
-		}
+	if !cancelled {
+		return s.tgClient.SendMessage(ctx, msg.Lang.T(i18n.NothingToCancel), msg.UserID)
 	}
-
-	return s.tgClient.SendMessage(text, userID)
+	s.log(ctx).Debug("Conversation cancelled")
+	return s.tgClient.SendMessage(ctx, msg.Lang.T(i18n.Cancelled), msg.UserID)
 }
@@ -0,0 +1,90 @@
+package reminders
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/profectus200/contact-book-bot/internal/i18n"
+	"github.com/profectus200/contact-book-bot/internal/types"
+	"go.uber.org/zap"
+)
+
+// sendDigests sends the users the birthdays and the other dates of their contacts coming today,
+// once a day at the reminder time of the settings.
+func (m *Model) sendDigests(ctx context.Context, now time.Time) error {
+	userIDs, err := m.usersDB.DueDigests(ctx, now)
+	if err != nil {
+		return errors.Wrap(err, "cannot DueDigests")
+	}
+
+	for _, userID := range userIDs {
+		if err := m.sendDigest(ctx, userID, now); err != nil {
+			m.log(ctx).Warn("Cannot send digest", zap.Int64("user_id", userID), zap.Error(err))
+		}
+	}
+	return nil
+}
+
+// digestRetry is the delay after a daily reminder which could not be sent. It is tried again
+// until the next one is due.
+const digestRetry = 15 * time.Minute
+
+// sendDigest schedules the next reminder of the user and sends the one due now, if any.
+// The first reminder of a user is only scheduled when the reminder time of today is yet to come.
+func (m *Model) sendDigest(ctx context.Context, userID int64, now time.Time) error {
+	settings, err := m.settingsDB.GetSettings(ctx, userID)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetSettings")
+	}
+
+	local := now.In(settings.Location())
+	due := time.Date(local.Year(), local.Month(), local.Day(), 0, settings.ReminderTime, 0, 0, local.Location())
+	next := due
+	if !now.Before(due) {
+		next = due.AddDate(0, 0, 1)
+	}
+
+	claimed, err := m.usersDB.ClaimDigest(ctx, userID, now, now.Add(lease))
+	if err != nil {
+		return errors.Wrap(err, "cannot ClaimDigest")
+	}
+	if !claimed {
+		return nil
+	}
+
+	if !now.Before(due) {
+		if err := m.sendToday(ctx, userID, settings, local); err != nil {
+			if retry := now.Add(digestRetry); retry.Before(next) {
+				next = retry
+			}
+			m.log(ctx).Warn("Cannot send digest", zap.Int64("user_id", userID), zap.Time("next_digest_at", next), zap.Error(err))
+		}
+	}
+
+	return errors.Wrap(m.usersDB.ScheduleDigest(ctx, userID, next), "cannot ScheduleDigest")
+}
+
+// sendToday sends the user the dates of the contacts coming on the day, once for the day.
+func (m *Model) sendToday(ctx context.Context, userID int64, settings types.Settings, day time.Time) error {
+	contacts, err := m.contactsDB.GetAllContacts(ctx, userID)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetAllContacts")
+	}
+	today := types.Upcoming(contacts, day, 0)
+	if len(today) == 0 {
+		return nil
+	}
+
+	lang := userLang(settings)
+	lines := []string{lang.T(i18n.TodayTitle)}
+	for _, occasion := range today {
+		lines = append(lines, occasion.ToString(lang))
+	}
+	m.log(ctx).Debug("Sending digest", zap.Int64("user_id", userID), zap.Int("count", len(today)))
+
+	key := fmt.Sprintf("digest:%d:%s", userID, day.Format(time.DateOnly))
+	return m.tgClient.SendMessageOnce(ctx, key, strings.Join(lines, "\n"), userID)
+}
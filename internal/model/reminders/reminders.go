@@ -0,0 +1,138 @@
+// Package reminders delivers the reminders about the contacts when they are due, and the daily
+// reminders about their birthdays and other dates.
+package reminders
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+	"github.com/profectus200/contact-book-bot/cmd/logging"
+	"github.com/profectus200/contact-book-bot/internal/i18n"
+	"github.com/profectus200/contact-book-bot/internal/types"
+	"go.uber.org/zap"
+)
+
+const (
+	// lease is how long the claimed reminders are kept from the other bots. A reminder whose
+	// delivery is never completed, e.g. as the bot has stopped, is due again after it.
+	lease = 5 * time.Minute
+	// maxAttempts is how many times a reminder is tried before it is dropped.
+	maxAttempts = 5
+	// firstRetry is the delay after the first failure, it doubles with every next one.
+	firstRetry = time.Minute
+)
+
+type reminderSender interface {
+	SendMessageOnce(ctx context.Context, key string, text string, userID int64) error
+	SendReminder(ctx context.Context, key string, text string, userID int64, reminderID int, lang i18n.Lang) error
+}
+
+type contactsDB interface {
+	GetAllContacts(ctx context.Context, userID int64) ([]*types.Contact, error)
+	ClaimReminders(ctx context.Context, now, leaseUntil time.Time) ([]types.Reminder, error)
+	CompleteReminder(ctx context.Context, reminder types.Reminder, sentAt time.Time) error
+	RetryReminder(ctx context.Context, reminderID, attempts int, at time.Time) error
+}
+
+type usersDB interface {
+	DueDigests(ctx context.Context, now time.Time) ([]int64, error)
+	ClaimDigest(ctx context.Context, userID int64, now, leaseUntil time.Time) (bool, error)
+	ScheduleDigest(ctx context.Context, userID int64, at time.Time) error
+}
+
+type settingsDB interface {
+	GetSettings(ctx context.Context, userID int64) (types.Settings, error)
+}
+
+type Model struct {
+	tgClient   reminderSender
+	contactsDB contactsDB
+	usersDB    usersDB
+	settingsDB settingsDB
+	logger     *zap.Logger
+}
+
+func New(tgClient reminderSender, contactsDB contactsDB, usersDB usersDB, settingsDB settingsDB, logger *zap.Logger) *Model {
+	return &Model{
+		tgClient:   tgClient,
+		contactsDB: contactsDB,
+		usersDB:    usersDB,
+		settingsDB: settingsDB,
+		logger:     logger.Named("reminders"),
+	}
+}
+
+// SendDue delivers the reminders due by now, and the daily reminders about the dates of the
+// contacts. A reminder is marked delivered only once it is sent, a failed one is tried again
+// later with a growing delay.
+func (m *Model) SendDue(ctx context.Context, now time.Time) error {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"SendDueReminders",
+	)
+	defer span.Finish()
+
+	reminders, err := m.contactsDB.ClaimReminders(ctx, now, now.Add(lease))
+	if err != nil {
+		return errors.Wrap(err, "cannot ClaimReminders")
+	}
+
+	for _, reminder := range reminders {
+		if err := m.sendReminder(ctx, reminder, now); err != nil {
+			return err
+		}
+	}
+
+	if len(reminders) > 0 {
+		m.log(ctx).Info("Reminders sent", zap.Int("count", len(reminders)))
+	}
+
+	return m.sendDigests(ctx, now)
+}
+
+// sendReminder sends the reminder and completes it or schedules the next attempt. Only the
+// errors of the storage are returned, the failures of the delivery are logged.
+func (m *Model) sendReminder(ctx context.Context, reminder types.Reminder, now time.Time) error {
+	log := m.log(ctx).With(zap.Int64("user_id", reminder.UserID), zap.Int("reminder_id", reminder.ID))
+
+	lang := i18n.Default
+	settings, err := m.settingsDB.GetSettings(ctx, reminder.UserID)
+	if err != nil {
+		log.Warn("Cannot GetSettings", zap.Error(err))
+	} else {
+		lang = userLang(settings)
+	}
+
+	// The key is of the due time, so that a snoozed reminder is delivered again.
+	key := fmt.Sprintf("reminder:%d:%d", reminder.ID, reminder.DueAt.Unix())
+	err = m.tgClient.SendReminder(ctx, key, reminder.ToString(lang), reminder.UserID, reminder.ID, lang)
+	if err == nil {
+		return errors.Wrap(m.contactsDB.CompleteReminder(ctx, reminder, now), "cannot CompleteReminder")
+	}
+
+	attempts := reminder.Attempts + 1
+	if attempts >= maxAttempts {
+		log.Warn("Reminder dropped", zap.Int("attempts", attempts), zap.Error(err))
+		return errors.Wrap(m.contactsDB.CompleteReminder(ctx, reminder, now), "cannot CompleteReminder")
+	}
+
+	next := now.Add(firstRetry << (attempts - 1))
+	log.Warn("Cannot send reminder", zap.Int("attempts", attempts), zap.Time("next_attempt_at", next), zap.Error(err))
+	return errors.Wrap(m.contactsDB.RetryReminder(ctx, reminder.ID, attempts, next), "cannot RetryReminder")
+}
+
+// userLang is the language chosen in the settings, reminders are not answers to the user
+// and have no language of the Telegram app to follow.
+func userLang(settings types.Settings) i18n.Lang {
+	if lang, ok := i18n.Parse(settings.Language); ok {
+		return lang
+	}
+	return i18n.Default
+}
+
+func (m *Model) log(ctx context.Context) *zap.Logger {
+	return logging.FromContext(ctx, m.logger)
+}
@@ -0,0 +1,58 @@
+package webhooks
+
+import (
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	userAgent = "contact-book-bot-webhooks/1"
+	// requestTimeout limits a whole delivery, so that a slow webhook does not hold the others.
+	requestTimeout = 10 * time.Second
+)
+
+// NewHTTPClient makes the client of the deliveries. Unless allowPrivate is set, it refuses to
+// connect to the loopback, private and link-local addresses whatever the host name resolves to,
+// so that the webhooks cannot reach the services next to the bot. The redirects are not
+// followed, a webhook answering with one fails.
+func NewHTTPClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+	}
+	if !allowPrivate {
+		dialer.Control = refusePrivate
+	}
+
+	return &http.Client{
+		Timeout: requestTimeout,
+		Transport: &http.Transport{
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   5 * time.Second,
+			ResponseHeaderTimeout: requestTimeout,
+			MaxIdleConnsPerHost:   2,
+			IdleConnTimeout:       90 * time.Second,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// refusePrivate is called with the resolved address of every connection.
+func refusePrivate(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return errors.Wrap(err, "cannot SplitHostPort")
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() {
+		return errors.Errorf("address %s is not public", host)
+	}
+	return nil
+}
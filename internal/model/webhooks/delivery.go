@@ -0,0 +1,130 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+	"github.com/profectus200/contact-book-bot/internal/types"
+	"go.uber.org/zap"
+)
+
+const (
+	// batchSize is how many events are claimed at once.
+	batchSize = 20
+	// lease is how long the claimed events are kept from the other bots. It is longer than
+	// a batch may take, as the requests time out.
+	lease = 5 * time.Minute
+	// MaxAttempts is how many times an event is tried before it is dropped.
+	MaxAttempts = 10
+	// firstRetry is the delay after the first failure, it doubles with every next one
+	// up to maxRetry. The last attempt comes about 4 hours after the first.
+	firstRetry = 30 * time.Second
+	maxRetry   = 6 * time.Hour
+	// maxResponseSize is how much of a response is read to reuse the connection.
+	maxResponseSize = 64 << 10
+)
+
+// Headers of the deliveries.
+const (
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+	SignatureHeader = "X-Webhook-Signature-256"
+)
+
+// DeliverDue posts the events due by now to their webhooks. A delivery succeeds when the
+// webhook answers with a 2xx status, a failed one is retried later with a growing delay.
+func (m *Model) DeliverDue(ctx context.Context, now time.Time) error {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"DeliverWebhooks",
+	)
+	defer span.Finish()
+
+	for {
+		deliveries, err := m.webhooksDB.ClaimDeliveries(ctx, now, now.Add(lease), batchSize)
+		if err != nil {
+			return errors.Wrap(err, "cannot ClaimDeliveries")
+		}
+
+		for _, delivery := range deliveries {
+			if err := m.deliver(ctx, delivery, now); err != nil {
+				return err
+			}
+		}
+		if len(deliveries) > 0 {
+			m.log(ctx).Debug("Webhook events delivered", zap.Int("count", len(deliveries)))
+		}
+
+		// The next batch is claimed right away while there may be more events due.
+		if len(deliveries) < batchSize || ctx.Err() != nil {
+			return nil
+		}
+	}
+}
+
+// deliver posts the event and completes it or schedules the next attempt. Only the errors
+// of the storage are returned, the failures of the webhook are logged.
+func (m *Model) deliver(ctx context.Context, delivery types.WebhookDelivery, now time.Time) error {
+	log := m.log(ctx).With(
+		zap.Int64("user_id", delivery.Webhook.UserID),
+		zap.Int("webhook_id", delivery.Webhook.ID),
+		zap.Int("delivery_id", delivery.ID),
+	)
+
+	err := m.post(ctx, delivery)
+	if err == nil {
+		return errors.Wrap(m.webhooksDB.CompleteDelivery(ctx, delivery.ID), "cannot CompleteDelivery")
+	}
+
+	attempts := delivery.Attempts + 1
+	if attempts >= MaxAttempts {
+		log.Warn("Webhook event dropped", zap.Int("attempts", attempts), zap.Error(err))
+		return errors.Wrap(m.webhooksDB.CompleteDelivery(ctx, delivery.ID), "cannot CompleteDelivery")
+	}
+
+	next := now.Add(RetryDelay(attempts))
+	log.Info("Webhook delivery failed", zap.Int("attempts", attempts), zap.Time("next_attempt_at", next), zap.Error(err))
+	return errors.Wrap(m.webhooksDB.RetryDelivery(ctx, delivery.ID, attempts, next), "cannot RetryDelivery")
+}
+
+// RetryDelay is how long to wait after the failed attempt of the number, counted from 1.
+func RetryDelay(attempts int) time.Duration {
+	delay := firstRetry
+	for i := 1; i < attempts && delay < maxRetry; i++ {
+		delay *= 2
+	}
+	if delay > maxRetry {
+		delay = maxRetry
+	}
+	return delay
+}
+
+func (m *Model) post(ctx context.Context, delivery types.WebhookDelivery) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.Webhook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return errors.Wrap(err, "cannot NewRequest")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set(EventHeader, string(delivery.EventType))
+	req.Header.Set(DeliveryHeader, strconv.Itoa(delivery.ID))
+	req.Header.Set(SignatureHeader, types.SignPayload(delivery.Webhook.Secret, delivery.Payload))
+
+	resp, err := m.httpClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "cannot Do")
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseSize))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+// Package webhooks lets the users have the changes of their contacts sent to their URLs.
+// The storage queues an event in the outbox with every change of a contact, and DeliverDue
+// posts the events signed with the secrets of the webhooks, retrying the failed ones.
+package webhooks
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+	"github.com/profectus200/contact-book-bot/cmd/logging"
+	"github.com/profectus200/contact-book-bot/internal/i18n"
+	"github.com/profectus200/contact-book-bot/internal/types"
+	"go.uber.org/zap"
+)
+
+type webhooksSender interface {
+	SendWebhooks(ctx context.Context, text string, userID int64, webhooks []types.Webhook, lang i18n.Lang) error
+	EditWebhooks(ctx context.Context, text string, userID int64, messageID int, webhooks []types.Webhook, lang i18n.Lang) error
+}
+
+type webhooksDB interface {
+	GetWebhooks(ctx context.Context, userID int64) ([]types.Webhook, error)
+	DeleteWebhook(ctx context.Context, userID int64, webhookID int) error
+	ClaimDeliveries(ctx context.Context, now, leaseUntil time.Time, limit int) ([]types.WebhookDelivery, error)
+	CompleteDelivery(ctx context.Context, deliveryID int) error
+	RetryDelivery(ctx context.Context, deliveryID, attempts int, at time.Time) error
+}
+
+type Model struct {
+	tgClient   webhooksSender
+	webhooksDB webhooksDB
+	httpClient *http.Client
+	logger     *zap.Logger
+}
+
+// New makes the model delivering the events with the client, see NewHTTPClient.
+func New(tgClient webhooksSender, webhooksDB webhooksDB, httpClient *http.Client, logger *zap.Logger) *Model {
+	return &Model{
+		tgClient:   tgClient,
+		webhooksDB: webhooksDB,
+		httpClient: httpClient,
+		logger:     logger.Named("webhooks"),
+	}
+}
+
+// ShowWebhooks sends the list of /webhooks with the buttons removing them and adding one.
+func (m *Model) ShowWebhooks(ctx context.Context, userID int64, lang i18n.Lang) error {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"ShowWebhooks",
+	)
+	defer span.Finish()
+
+	webhooks, err := m.webhooksDB.GetWebhooks(ctx, userID)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetWebhooks")
+	}
+	return m.tgClient.SendWebhooks(ctx, types.ListWebhooks(webhooks, lang), userID, webhooks, lang)
+}
+
+// RemoveWebhook deletes the webhook with the events not delivered to it yet and shows
+// the ones left in the message of the list.
+func (m *Model) RemoveWebhook(ctx context.Context, userID int64, messageID int, webhookID int, lang i18n.Lang) error {
+	span, ctx := opentracing.StartSpanFromContext(
+		ctx,
+		"RemoveWebhook",
+	)
+	defer span.Finish()
+
+	if err := m.webhooksDB.DeleteWebhook(ctx, userID, webhookID); err != nil {
+		return errors.Wrap(err, "cannot DeleteWebhook")
+	}
+	m.log(ctx).Info("Webhook removed", zap.Int("webhook_id", webhookID))
+
+	webhooks, err := m.webhooksDB.GetWebhooks(ctx, userID)
+	if err != nil {
+		return errors.Wrap(err, "cannot GetWebhooks")
+	}
+	return m.tgClient.EditWebhooks(ctx, types.ListWebhooks(webhooks, lang), userID, messageID, webhooks, lang)
+}
+
+func (m *Model) log(ctx context.Context) *zap.Logger {
+	return logging.FromContext(ctx, m.logger)
+}
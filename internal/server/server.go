@@ -0,0 +1,97 @@
+// Package server is the HTTP server of the bot, serving what the users open outside of
+// Telegram, like the calendar feeds.
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	readHeaderTimeout = 10 * time.Second
+	writeTimeout      = 30 * time.Second
+	// shutdownTimeout is how long the requests being served may take to finish on shutdown.
+	shutdownTimeout = 5 * time.Second
+)
+
+type Server struct {
+	addr   string
+	mux    *http.ServeMux
+	logger *zap.Logger
+}
+
+func New(addr string, logger *zap.Logger) *Server {
+	return &Server{
+		addr:   addr,
+		mux:    http.NewServeMux(),
+		logger: logger.Named("http"),
+	}
+}
+
+// Handle serves the requests to the pattern with the handler, see http.ServeMux.
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// Run serves the requests until the context is done.
+func (s *Server) Run(ctx context.Context) error {
+	server := &http.Server{
+		Addr:              s.addr,
+		Handler:           s.logged(s.mux),
+		ReadHeaderTimeout: readHeaderTimeout,
+		WriteTimeout:      writeTimeout,
+		BaseContext: func(net.Listener) context.Context {
+			return ctx
+		},
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			s.logger.Warn("Cannot shut down gracefully", zap.Error(err))
+		}
+	}()
+
+	s.logger.Info("Serving HTTP", zap.String("addr", s.addr))
+	err := server.ListenAndServe()
+	if err == http.ErrServerClosed {
+		<-stopped
+		return nil
+	}
+	return errors.Wrap(err, "cannot ListenAndServe")
+}
+
+// logged logs the requests without their paths, as the paths may be secret links.
+func (s *Server) logged(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		s.logger.Debug("Request served",
+			zap.String("method", r.Method),
+			zap.Int("status", recorder.status),
+			zap.Duration("took", time.Since(started)),
+		)
+	})
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
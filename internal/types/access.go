@@ -0,0 +1,108 @@
+package types
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// AccessMode is who may use the bot. The admins may always use it.
+type AccessMode string
+
+const (
+	// AccessOpen lets everyone use the bot.
+	AccessOpen AccessMode = "open"
+	// AccessAllowlist lets in only the users on the allowlist.
+	AccessAllowlist AccessMode = "allowlist"
+	// AccessInvite lets in the users on the allowlist and adds to it the ones who send
+	// /start with an invite code.
+	AccessInvite AccessMode = "invite"
+)
+
+// ParseAccessMode is false for an unknown mode.
+func ParseAccessMode(text string) (AccessMode, bool) {
+	switch mode := AccessMode(strings.ToLower(strings.TrimSpace(text))); mode {
+	case AccessOpen, AccessAllowlist, AccessInvite:
+		return mode, true
+	}
+	return "", false
+}
+
+// AllowlistEntry is a user let in by the ID or by the username. Exactly one of them is set.
+type AllowlistEntry struct {
+	UserID int64
+	// Username is without the @, in lower case.
+	Username string
+}
+
+// usernamePattern is what Telegram allows in usernames.
+var usernamePattern = regexp.MustCompile(`^[a-z0-9_]{1,32}$`)
+
+// ParseAllowlistEntry reads a user ID like 123456 or a username like @name.
+func ParseAllowlistEntry(text string) (AllowlistEntry, bool) {
+	text = strings.TrimSpace(text)
+	if userID, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return AllowlistEntry{UserID: userID}, true
+	}
+
+	username := NormalizeUsername(text)
+	if !usernamePattern.MatchString(username) {
+		return AllowlistEntry{}, false
+	}
+	return AllowlistEntry{Username: username}, true
+}
+
+// NormalizeUsername is the username as it is kept in the allowlist.
+func NormalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimPrefix(username, "@"))
+}
+
+// String is the entry as the admins write it.
+func (e AllowlistEntry) String() string {
+	if e.Username != "" {
+		return "@" + e.Username
+	}
+	return strconv.FormatInt(e.UserID, 10)
+}
+
+// Matches tells whether the entry lets in the user.
+func (e AllowlistEntry) Matches(userID int64, username string) bool {
+	if e.Username != "" {
+		return e.Username == NormalizeUsername(username)
+	}
+	return e.UserID == userID
+}
+
+// InviteTTL is how long an invite code works.
+const InviteTTL = 7 * 24 * time.Hour
+
+// inviteLength is the number of random bytes in an invite code, which is longer in base64.
+const inviteLength = 9
+
+// Invite is a code letting a new user in once, see AccessInvite.
+type Invite struct {
+	Code      string
+	CreatedBy int64
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+// NewInvite makes an invite with a random code, working until InviteTTL from now.
+func NewInvite(createdBy int64, now time.Time) (Invite, error) {
+	code := make([]byte, inviteLength)
+	if _, err := rand.Read(code); err != nil {
+		return Invite{}, errors.Wrap(err, "cannot read random bytes")
+	}
+
+	return Invite{
+		Code:      base64.RawURLEncoding.EncodeToString(code),
+		CreatedBy: createdBy,
+		CreatedAt: now,
+		ExpiresAt: now.Add(InviteTTL),
+	}, nil
+}
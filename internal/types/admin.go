@@ -0,0 +1,62 @@
+package types
+
+import (
+	"time"
+
+	"github.com/profectus200/contact-book-bot/internal/i18n"
+)
+
+// Stats are the numbers of the usage of the bot shown to the admins.
+type Stats struct {
+	Users int
+	// Active is the number of the users who have sent the bot anything since the moment asked.
+	Active   int
+	Banned   int
+	Contacts int
+}
+
+// ToString is the text of /stats.
+func (s Stats) ToString(lang i18n.Lang) string {
+	return lang.T(i18n.AdminStats, s.Users, s.Active, s.Banned, s.Contacts)
+}
+
+// UserInfo is what the admins see of a user: how much the user has, but not the contacts.
+type UserInfo struct {
+	UserID int64
+	Banned bool
+	// Username is the one the user has last written to the bot with.
+	Username string
+	// LastSeen is when the user sent the bot anything last, zero if never since it is recorded.
+	LastSeen time.Time
+	// Language is the language chosen with /language, empty when the app language is used.
+	Language  string
+	Contacts  int
+	Reminders int
+	Webhooks  int
+
+	HasCalendar bool
+	HasCardDAV  bool
+	HasAPIToken bool
+}
+
+// ToString is the text of /user.
+func (u UserInfo) ToString(lang i18n.Lang) string {
+	lastSeen := lang.T(i18n.AdminNever)
+	if !u.LastSeen.IsZero() {
+		lastSeen = u.LastSeen.UTC().Format("02.01.2006 15:04 UTC")
+	}
+	language := u.Language
+	if language == "" {
+		language = "-"
+	}
+
+	return lang.T(i18n.AdminUser, u.UserID, lastSeen, language, u.Contacts, u.Reminders, u.Webhooks,
+		yesNo(u.HasCalendar, lang), yesNo(u.HasCardDAV, lang), yesNo(u.HasAPIToken, lang), yesNo(u.Banned, lang))
+}
+
+func yesNo(b bool, lang i18n.Lang) string {
+	if b {
+		return lang.T(i18n.AdminYes)
+	}
+	return lang.T(i18n.AdminNo)
+}
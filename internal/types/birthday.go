@@ -0,0 +1,233 @@
+package types
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// minBirthdayYear is the earliest year of birth we accept, to catch typos like 199.
+const minBirthdayYear = 1900
+
+// Birthday is a day of the year someone was born on, with the year when it is known.
+type Birthday struct {
+	Day   int
+	Month time.Month
+	// Year is 0 when it is unknown.
+	Year int
+}
+
+// HasYear tells whether the year of birth is known.
+func (b Birthday) HasYear() bool {
+	return b.Year != 0
+}
+
+// String formats the birthday as dd.mm or dd.mm.yyyy.
+func (b Birthday) String() string {
+	if b.HasYear() {
+		return fmt.Sprintf("%02d.%02d.%04d", b.Day, b.Month, b.Year)
+	}
+	return fmt.Sprintf("%02d.%02d", b.Day, b.Month)
+}
+
+// ISO formats the date as yyyy-mm-dd, or --mm-dd without the year, the way dates are kept.
+func (b Birthday) ISO() string {
+	if b.HasYear() {
+		return fmt.Sprintf("%04d-%02d-%02d", b.Year, b.Month, b.Day)
+	}
+	return fmt.Sprintf("--%02d-%02d", b.Month, b.Day)
+}
+
+// ParseISO reads the date formatted by ISO.
+func ParseISO(text string) (Birthday, bool) {
+	var date Birthday
+	if _, err := fmt.Sscanf(text, "--%02d-%02d", &date.Month, &date.Day); err == nil {
+		return date, true
+	}
+	if _, err := fmt.Sscanf(text, "%04d-%02d-%02d", &date.Year, &date.Month, &date.Day); err == nil {
+		return date, true
+	}
+	return Birthday{}, false
+}
+
+// Next returns the date of the nearest birthday not before the day of now.
+// Those born on the 29th of February celebrate on the 28th in common years.
+func (b Birthday) Next(now time.Time) time.Time {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	next := b.in(today.Year(), now.Location())
+	if next.Before(today) {
+		next = b.in(today.Year()+1, now.Location())
+	}
+	return next
+}
+
+// DaysUntil returns the number of days until the nearest birthday, 0 if it is today.
+func (b Birthday) DaysUntil(now time.Time) int {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	next := b.Next(now)
+	next = time.Date(next.Year(), next.Month(), next.Day(), 0, 0, 0, 0, time.UTC)
+
+	return int(next.Sub(today).Hours() / 24)
+}
+
+// Age returns how old the person is on the day of now. It is false when the year is unknown.
+func (b Birthday) Age(now time.Time) (int, bool) {
+	if !b.HasYear() {
+		return 0, false
+	}
+
+	age := now.Year() - b.Year
+	if b.in(now.Year(), now.Location()).After(now) {
+		age--
+	}
+	return age, true
+}
+
+func (b Birthday) in(year int, loc *time.Location) time.Time {
+	day := b.Day
+	if b.Month == time.February && day == 29 && !isLeap(year) {
+		day = 28
+	}
+	return time.Date(year, b.Month, day, 0, 0, 0, 0, loc)
+}
+
+func isLeap(year int) bool {
+	return year%4 == 0 && (year%100 != 0 || year%400 == 0)
+}
+
+// NewBirthday validates the date. Year may be 0 when it is unknown.
+func NewBirthday(day int, month time.Month, year int, now time.Time) (Birthday, error) {
+	if month < time.January || month > time.December {
+		return Birthday{}, errors.Errorf("no month %d", month)
+	}
+
+	// A leap year lets the 29th of February through when the year is unknown.
+	checkYear := year
+	if checkYear == 0 {
+		checkYear = 2000
+	}
+	if day < 1 || time.Date(checkYear, month, day, 0, 0, 0, 0, time.UTC).Month() != month {
+		return Birthday{}, errors.Errorf("no day %d in %s", day, month)
+	}
+
+	if year != 0 {
+		if year < minBirthdayYear {
+			return Birthday{}, errors.Errorf("year %d is too long ago", year)
+		}
+		if time.Date(year, month, day, 0, 0, 0, 0, now.Location()).After(now) {
+			return Birthday{}, errors.New("birthday is in the future")
+		}
+	}
+
+	return Birthday{Day: day, Month: month, Year: year}, nil
+}
+
+// ParseBirthday recognizes a birthday written as 12.03, 12.03.1990, 1990-03-12,
+// 12 March, 12 March 1990, March 12, 1990 or 12 марта 1990, with a dot at the end or without.
+func ParseBirthday(text string, now time.Time) (Birthday, error) {
+	text = strings.TrimSuffix(strings.TrimSpace(text), ".")
+
+	if parts := strings.Split(text, "."); len(parts) == 2 || len(parts) == 3 {
+		numbers, err := atoiAll(parts)
+		if err == nil {
+			year := 0
+			if len(numbers) == 3 {
+				year = numbers[2]
+			}
+			return NewBirthday(numbers[0], time.Month(numbers[1]), year, now)
+		}
+	}
+
+	if parts := strings.Split(text, "-"); len(parts) == 3 {
+		numbers, err := atoiAll(parts)
+		if err == nil {
+			return NewBirthday(numbers[2], time.Month(numbers[1]), numbers[0], now)
+		}
+	}
+
+	if birthday, ok := parseWords(text, now); ok {
+		return birthday, nil
+	}
+
+	return Birthday{}, errors.Errorf("cannot recognize date %q", text)
+}
+
+// ParseAnyDate recognizes the dates ParseBirthday does, the future ones included.
+func ParseAnyDate(text string) (Birthday, error) {
+	return ParseBirthday(text, time.Date(9999, time.December, 31, 0, 0, 0, 0, time.UTC))
+}
+
+// parseWords parses dates with the month written as a word in any order with the day.
+func parseWords(text string, now time.Time) (Birthday, bool) {
+	fields := strings.Fields(strings.NewReplacer(",", " ", ".", " ").Replace(text))
+	if len(fields) != 2 && len(fields) != 3 {
+		return Birthday{}, false
+	}
+
+	day, month, year := 0, time.Month(0), 0
+	for i, field := range fields {
+		if m, ok := monthByName(field); ok && month == 0 {
+			month = m
+			continue
+		}
+
+		number, err := strconv.Atoi(field)
+		if err != nil {
+			return Birthday{}, false
+		}
+		if i == 2 {
+			year = number
+		} else {
+			day = number
+		}
+	}
+
+	birthday, err := NewBirthday(day, month, year, now)
+	if err != nil {
+		return Birthday{}, false
+	}
+	return birthday, true
+}
+
+// russianMonthStems are the beginnings of Russian month names common to all their cases.
+var russianMonthStems = []string{"янв", "фев", "мар", "апр", "ма", "июн", "июл", "авг", "сен", "окт", "ноя", "дек"}
+
+// monthByName recognizes English month names and their three-letter abbreviations,
+// and Russian month names in any case.
+func monthByName(name string) (time.Month, bool) {
+	name = strings.ToLower(name)
+	if utf8.RuneCountInString(name) < 3 {
+		return 0, false
+	}
+
+	for month := time.January; month <= time.December; month++ {
+		full := strings.ToLower(month.String())
+		if strings.HasPrefix(full, name) {
+			return month, true
+		}
+	}
+
+	for i, stem := range russianMonthStems {
+		if strings.HasPrefix(name, stem) {
+			return time.January + time.Month(i), true
+		}
+	}
+	return 0, false
+}
+
+func atoiAll(parts []string) ([]int, error) {
+	numbers := make([]int, 0, len(parts))
+	for _, part := range parts {
+		number, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return nil, err
+		}
+		numbers = append(numbers, number)
+	}
+	return numbers, nil
+}
@@ -0,0 +1,61 @@
+package types_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/profectus200/contact-book-bot/internal/types"
+)
+
+func TestParseBirthday(t *testing.T) {
+	now := time.Date(2023, time.August, 24, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		text    string
+		want    types.Birthday
+		wantErr bool
+	}{
+		{text: "12.03", want: types.Birthday{Day: 12, Month: time.March}},
+		{text: "12.03.1990", want: types.Birthday{Day: 12, Month: time.March, Year: 1990}},
+		{text: "12.03.", want: types.Birthday{Day: 12, Month: time.March}},
+		{text: "12.03.1990.", want: types.Birthday{Day: 12, Month: time.March, Year: 1990}},
+		{text: "1990-03-12", want: types.Birthday{Day: 12, Month: time.March, Year: 1990}},
+		{text: "12 March 1990", want: types.Birthday{Day: 12, Month: time.March, Year: 1990}},
+		{text: "March 12, 1990", want: types.Birthday{Day: 12, Month: time.March, Year: 1990}},
+		{text: "12 mar.", want: types.Birthday{Day: 12, Month: time.March}},
+		{text: "12 may", want: types.Birthday{Day: 12, Month: time.May}},
+		// The Russian months are told by their stems: "мар" is March, "ма" only starts May.
+		{text: "12 марта 1990", want: types.Birthday{Day: 12, Month: time.March, Year: 1990}},
+		{text: "12 мар", want: types.Birthday{Day: 12, Month: time.March}},
+		{text: "12 мая", want: types.Birthday{Day: 12, Month: time.May}},
+		{text: "12 май", want: types.Birthday{Day: 12, Month: time.May}},
+		{text: "12 ма", wantErr: true},
+		// The 29th of February needs a leap year, or no year at all.
+		{text: "29.02", want: types.Birthday{Day: 29, Month: time.February}},
+		{text: "29 февраля", want: types.Birthday{Day: 29, Month: time.February}},
+		{text: "29.02.2020", want: types.Birthday{Day: 29, Month: time.February, Year: 2020}},
+		{text: "29.02.2023", wantErr: true},
+		{text: "31.04", wantErr: true},
+		{text: "12.13", wantErr: true},
+		{text: "12.03.1899", wantErr: true},
+		{text: "12.03.2024", wantErr: true},
+		{text: "12", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			got, err := types.ParseBirthday(tt.text, now)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("got %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("cannot parse: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
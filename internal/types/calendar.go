@@ -0,0 +1,132 @@
+package types
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/profectus200/contact-book-bot/internal/i18n"
+)
+
+const (
+	// productID identifies the bot as the maker of the calendars and the vCards.
+	productID = "-//contact-book-bot//Contacts//EN"
+	// contentLineLimit is the longest line of a calendar or a vCard in octets, the rest is folded.
+	contentLineLimit = 75
+	// unknownYear starts the dates without the year, a leap one for the 29th of February.
+	unknownYear = 2000
+)
+
+// textEscaper escapes the text values as RFC 5545 and vCard 3.0 (RFC 2426) require.
+var textEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+// Calendar renders the birthdays and the other dates of the contacts of the user as an
+// iCalendar (RFC 5545) calendar of all-day recurring events.
+func Calendar(contacts []*Contact, userID int64, lang i18n.Lang, now time.Time) []byte {
+	c := calendarWriter{}
+	c.line("BEGIN:VCALENDAR")
+	c.line("VERSION:2.0")
+	c.line("PRODID:" + productID)
+	c.line("CALSCALE:GREGORIAN")
+	c.line("METHOD:PUBLISH")
+	c.line("X-WR-CALNAME:" + textEscaper.Replace(lang.T(i18n.CalendarName)))
+
+	stamp := now.UTC().Format("20060102T150405Z")
+	for _, contact := range contacts {
+		if contact.Birthday != nil {
+			uid := fmt.Sprintf("%d-%d-birthday", userID, contact.ContactID)
+			summary := lang.T(i18n.CalendarBirthday, contact.Name)
+			c.event(uid, stamp, summary, *contact.Birthday, Yearly)
+		}
+		for _, event := range contact.Events {
+			// The names may have any characters, the hash of one keeps the UID short and plain.
+			hash := sha256.Sum256([]byte(event.Name))
+			uid := fmt.Sprintf("%d-%d-%s", userID, contact.ContactID, hex.EncodeToString(hash[:8]))
+			summary := lang.T(i18n.CalendarEvent, contact.Name, event.Name)
+			c.event(uid, stamp, summary, event.Date, event.Recurrence)
+		}
+	}
+
+	c.line("END:VCALENDAR")
+	return []byte(c.String())
+}
+
+type calendarWriter struct {
+	contentWriter
+}
+
+func (c *calendarWriter) event(uid, stamp, summary string, date Birthday, recurrence Recurrence) {
+	year := date.Year
+	if !date.HasYear() {
+		year = unknownYear
+	}
+
+	c.line("BEGIN:VEVENT")
+	c.line("UID:" + uid + "@contact-book-bot")
+	c.line("DTSTAMP:" + stamp)
+	c.line(fmt.Sprintf("DTSTART;VALUE=DATE:%04d%02d%02d", year, date.Month, date.Day))
+	c.line("RRULE:" + recurrenceRule(date, recurrence))
+	c.line("SUMMARY:" + textEscaper.Replace(summary))
+	c.line("TRANSP:TRANSPARENT")
+	c.line("END:VEVENT")
+}
+
+// recurrenceRule is the RRULE of the date. The 29th of February comes on the last day of
+// February every year, the way Birthday.Next has it, and the days after the 28th of a month
+// come on the last day of the shorter months, the way Event.Next has it.
+func recurrenceRule(date Birthday, recurrence Recurrence) string {
+	var rule string
+	switch recurrence.Unit {
+	case RecurDay:
+		rule = "FREQ=DAILY"
+	case RecurWeek:
+		rule = "FREQ=WEEKLY"
+	case RecurMonth:
+		rule = "FREQ=MONTHLY"
+		if date.Day > 28 {
+			// The latest of the days from the 28th up to the date which the month has.
+			days := make([]string, 0, date.Day-27)
+			for day := 28; day <= date.Day; day++ {
+				days = append(days, strconv.Itoa(day))
+			}
+			rule += ";BYMONTHDAY=" + strings.Join(days, ",") + ";BYSETPOS=-1"
+		}
+	default:
+		rule = "FREQ=YEARLY"
+		if date.Month == time.February && date.Day == 29 {
+			rule += ";BYMONTH=2;BYMONTHDAY=-1"
+		}
+	}
+	if recurrence.Every > 1 {
+		rule += fmt.Sprintf(";INTERVAL=%d", recurrence.Every)
+	}
+	return rule
+}
+
+// contentWriter writes the content lines of calendars and vCards.
+type contentWriter struct {
+	strings.Builder
+}
+
+// line writes the content line folded at the limit without splitting a character, and
+// ended with CRLF.
+func (c *contentWriter) line(text string) {
+	limit := contentLineLimit
+	for len(text) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(text[cut]) {
+			cut--
+		}
+		c.WriteString(text[:cut])
+		c.WriteString("\r\n ")
+		text = text[cut:]
+		// The space starting a continuation line counts too.
+		limit = contentLineLimit - 1
+	}
+	c.WriteString(text)
+	c.WriteString("\r\n")
+}
@@ -0,0 +1,72 @@
+package types_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/profectus200/contact-book-bot/internal/i18n"
+	"github.com/profectus200/contact-book-bot/internal/types"
+)
+
+func TestCalendarRecurrence(t *testing.T) {
+	now := time.Date(2023, time.August, 24, 12, 0, 0, 0, time.UTC)
+	monthly := types.Recurrence{Every: 1, Unit: types.RecurMonth}
+	tests := []struct {
+		name       string
+		date       types.Birthday
+		recurrence types.Recurrence
+		want       string
+	}{
+		{
+			name:       "yearly",
+			date:       types.Birthday{Day: 12, Month: time.June, Year: 2015},
+			recurrence: types.Yearly,
+			want:       "FREQ=YEARLY",
+		},
+		{
+			name:       "29th of February",
+			date:       types.Birthday{Day: 29, Month: time.February},
+			recurrence: types.Yearly,
+			want:       "FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=-1",
+		},
+		{
+			name:       "every two weeks",
+			date:       types.Birthday{Day: 3, Month: time.January, Year: 2023},
+			recurrence: types.Recurrence{Every: 2, Unit: types.RecurWeek},
+			want:       "FREQ=WEEKLY;INTERVAL=2",
+		},
+		{
+			name:       "monthly on the 28th",
+			date:       types.Birthday{Day: 28, Month: time.January, Year: 2023},
+			recurrence: monthly,
+			want:       "FREQ=MONTHLY",
+		},
+		{
+			name:       "monthly on the 29th",
+			date:       types.Birthday{Day: 29, Month: time.January, Year: 2023},
+			recurrence: monthly,
+			want:       "FREQ=MONTHLY;BYMONTHDAY=28,29;BYSETPOS=-1",
+		},
+		{
+			name:       "quarterly on the 31st",
+			date:       types.Birthday{Day: 31, Month: time.January, Year: 2023},
+			recurrence: types.Recurrence{Every: 3, Unit: types.RecurMonth},
+			want:       "FREQ=MONTHLY;BYMONTHDAY=28,29,30,31;BYSETPOS=-1;INTERVAL=3",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			contact := &types.Contact{
+				ContactID: 1,
+				Name:      "Alice",
+				Events:    []types.Event{{Name: "Payday", Date: tt.date, Recurrence: tt.recurrence}},
+			}
+			calendar := string(types.Calendar([]*types.Contact{contact}, 42, i18n.English, now))
+			if !strings.Contains(calendar, "\r\nRRULE:"+tt.want+"\r\n") {
+				t.Errorf("got calendar\n%s\nwant RRULE:%s", calendar, tt.want)
+			}
+		})
+	}
+}
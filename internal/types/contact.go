@@ -1,8 +1,11 @@
 package types
 
 import (
-	"fmt"
+	"strings"
 	"time"
+
+	"github.com/pkg/errors"
+	"github.com/profectus200/contact-book-bot/internal/i18n"
 )
 
 type Contact struct {
@@ -10,35 +13,98 @@ type Contact struct {
 	Name        string
 	Email       string
 	Phone       string
-	Birthday    time.Time
+	Birthday    *Birthday
 	Description string
+	// PhotoID is the Telegram file_id of the photo of the contact, empty without a photo.
+	PhotoID string
+	// CustomFields are the fields added by the user, ordered by the name.
+	CustomFields []CustomField
+	// Events are the dates of the contact besides the birthday, ordered by the name.
+	Events []Event
+	// LastInteraction is the latest entry of the interaction log, nil when there is none.
+	LastInteraction *Interaction
 }
 
-func NewContact() *Contact {
+// NewContact returns an empty contact named in the language of the user.
+func NewContact(lang i18n.Lang) *Contact {
 	return &Contact{
 		ContactID:   0,
-		Name:        "New contact",
+		Name:        lang.T(i18n.NewContactName),
 		Email:       "",
 		Phone:       "",
-		Birthday:    time.Now(),
+		Birthday:    nil,
 		Description: "",
 	}
 }
 
-func (c *Contact) ToString() string {
-	str := fmt.Sprintf("ID: %d\n", c.ContactID)
-	str += fmt.Sprintf("Name: %s\n", c.Name)
-	if c.Email != "" {
-		str += fmt.Sprintf("Email: %s\n", c.Email)
+// ParseEmail checks that the text looks like an email address: a mailbox and a domain
+// with a dot, without spaces. Whether the address exists is not checked.
+func ParseEmail(text string) (string, error) {
+	text = strings.TrimSpace(text)
+
+	mailbox, domain, ok := strings.Cut(text, "@")
+	if !ok || mailbox == "" || strings.ContainsAny(text, " \t\n") || strings.Contains(domain, "@") {
+		return "", errors.Errorf("%q is not an email", text)
+	}
+	if dot := strings.LastIndex(domain, "."); dot <= 0 || dot == len(domain)-1 {
+		return "", errors.Errorf("%q has no valid domain", text)
+	}
+	return text, nil
+}
+
+// ToString renders the card of the contact, leaving out the fields hidden in the settings.
+func (c *Contact) ToString(lang i18n.Lang, settings Settings) string {
+	lines := []string{
+		lang.T(i18n.CardID, c.ContactID),
+		lang.T(i18n.CardName, c.Name),
+	}
+	if c.Email != "" && settings.Shows(FieldEmail) {
+		lines = append(lines, lang.T(i18n.CardEmail, c.Email))
+	}
+	if c.Phone != "" && settings.Shows(FieldPhone) {
+		lines = append(lines, lang.T(i18n.CardPhone, c.Phone))
 	}
-	if c.Phone != "" {
-		str += fmt.Sprintf("Phone: %s\n", c.Phone)
+	if c.Birthday != nil && settings.Shows(FieldBirthday) {
+		lines = append(lines,
+			lang.T(i18n.CardBirthday, lang.Date(c.Birthday.Day, int(c.Birthday.Month), c.Birthday.Year)),
+			birthdayCountdown(lang, *c.Birthday, settings.Now()),
+		)
 	}
-	if c.Birthday.Year() != time.Now().Year() {
-		str += fmt.Sprintf("Birthday: %s\n", c.Birthday.Format("02.01"))
+	if c.Description != "" && settings.Shows(FieldDescription) {
+		lines = append(lines, lang.T(i18n.CardDescription, c.Description))
 	}
-	if c.Description != "" {
-		str += fmt.Sprintf("Description: %s\n", c.Description)
+	for _, field := range c.CustomFields {
+		lines = append(lines, lang.T(i18n.CardCustomField, field.Name, field.Display(lang)))
+	}
+	for _, event := range c.Events {
+		lines = append(lines, eventLine(lang, event, settings.Now()))
+	}
+	if c.LastInteraction != nil {
+		lines = append(lines, lastContacted(lang, *c.LastInteraction, settings.Now()))
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// birthdayCountdown tells the age and how soon the next birthday is.
+func birthdayCountdown(lang i18n.Lang, birthday Birthday, now time.Time) string {
+	days := birthday.DaysUntil(now)
+
+	age, ok := birthday.Age(now)
+	if !ok {
+		switch days {
+		case 0:
+			return lang.T(i18n.CardBirthdayToday)
+		case 1:
+			return lang.T(i18n.CardBirthdayTomorrow)
+		}
+		return lang.T(i18n.CardBirthdayIn, days, lang.Plural(i18n.Days, days))
+	}
+
+	switch days {
+	case 0:
+		return lang.T(i18n.CardAgeToday, age, age)
+	case 1:
+		return lang.T(i18n.CardAgeTomorrow, age, age+1)
 	}
-	return str
+	return lang.T(i18n.CardAgeIn, age, age+1, days, lang.Plural(i18n.Days, days))
 }
@@ -0,0 +1,62 @@
+package types
+
+import "time"
+
+// ContactData is the contact as the REST API and the webhooks give it to other systems.
+// The dates are yyyy-mm-dd, or --mm-dd without the year.
+type ContactData struct {
+	ID            int               `json:"id"`
+	Name          string            `json:"name"`
+	Email         string            `json:"email,omitempty"`
+	Phone         string            `json:"phone,omitempty"`
+	Birthday      string            `json:"birthday,omitempty"`
+	Description   string            `json:"description,omitempty"`
+	HasPhoto      bool              `json:"has_photo"`
+	CustomFields  []CustomFieldData `json:"custom_fields"`
+	Events        []EventData       `json:"events"`
+	LastContacted string            `json:"last_contacted,omitempty"`
+}
+
+type CustomFieldData struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type EventData struct {
+	Name  string `json:"name"`
+	Date  string `json:"date"`
+	Every int    `json:"every"`
+	Unit  string `json:"unit"`
+}
+
+func NewContactData(contact *Contact) ContactData {
+	c := ContactData{
+		ID:           contact.ContactID,
+		Name:         contact.Name,
+		Email:        contact.Email,
+		Phone:        contact.Phone,
+		Description:  contact.Description,
+		HasPhoto:     contact.PhotoID != "",
+		CustomFields: make([]CustomFieldData, 0, len(contact.CustomFields)),
+		Events:       make([]EventData, 0, len(contact.Events)),
+	}
+	if contact.Birthday != nil {
+		c.Birthday = contact.Birthday.ISO()
+	}
+	for _, field := range contact.CustomFields {
+		c.CustomFields = append(c.CustomFields, CustomFieldData{Name: field.Name, Type: string(field.Type), Value: field.Value})
+	}
+	for _, event := range contact.Events {
+		c.Events = append(c.Events, EventData{
+			Name:  event.Name,
+			Date:  event.Date.ISO(),
+			Every: event.Recurrence.Every,
+			Unit:  string(event.Recurrence.Unit),
+		})
+	}
+	if contact.LastInteraction != nil {
+		c.LastContacted = contact.LastInteraction.Date.Format(time.DateOnly)
+	}
+	return c
+}
@@ -1,21 +1,25 @@
 package types
 
-// State tells what we are modifying un the expense.
-type State int
+import "time"
 
-const (
-	EditingName State = iota + 1
-	EditingPhone
-	EditingBirthday
-	EditingDescription
-	EditingSearchPhrase
-	EditingEditID
-	WaitState
-)
-
-// CurrentState contains id on the expense we are modifying now, and what we are modifying.
+// CurrentState is the conversation the user is in, see package conversation.
 type CurrentState struct {
-	ContactID int
-	MessageID int
-	State     State
+	// Flow is the name of the conversation, empty when the user is not in one.
+	Flow string
+	// Step is the name of the step of the flow waiting for the answer of the user.
+	Step string
+	// Payload is the data collected by the flow so far, encoded as JSON.
+	Payload string
+	// ExpiresAt is when the conversation is abandoned if the user does not answer.
+	ExpiresAt time.Time
+}
+
+// Waiting tells whether the user is not in a conversation.
+func (s CurrentState) Waiting() bool {
+	return s.Flow == ""
+}
+
+// Expired tells whether the user has not answered in time.
+func (s CurrentState) Expired(now time.Time) bool {
+	return !s.Waiting() && !s.ExpiresAt.IsZero() && !now.Before(s.ExpiresAt)
 }
@@ -0,0 +1,148 @@
+package types
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	"github.com/profectus200/contact-book-bot/internal/i18n"
+)
+
+// MaxCustomFieldName is the longest name of a custom field in characters.
+const MaxCustomFieldName = 32
+
+// CustomFieldType tells how the value of a custom field is checked and shown.
+type CustomFieldType string
+
+const (
+	CustomText  CustomFieldType = "text"
+	CustomDate  CustomFieldType = "date"
+	CustomURL   CustomFieldType = "url"
+	CustomPhone CustomFieldType = "phone"
+)
+
+var CustomFieldTypes = []CustomFieldType{CustomText, CustomDate, CustomURL, CustomPhone}
+
+// ParseCustomFieldType takes the type written by the user: its code or its name in the language.
+func ParseCustomFieldType(text string, lang i18n.Lang) (CustomFieldType, bool) {
+	text = strings.TrimSpace(text)
+	for _, t := range CustomFieldTypes {
+		if strings.EqualFold(text, string(t)) || strings.EqualFold(text, t.Name(lang)) {
+			return t, true
+		}
+	}
+	return "", false
+}
+
+func (t CustomFieldType) Name(lang i18n.Lang) string {
+	switch t {
+	case CustomDate:
+		return lang.T(i18n.CustomFieldDate)
+	case CustomURL:
+		return lang.T(i18n.CustomFieldURL)
+	case CustomPhone:
+		return lang.T(i18n.CustomFieldPhone)
+	default:
+		return lang.T(i18n.CustomFieldText)
+	}
+}
+
+// CustomField is a field the user added to the contact, e.g. the company or the website.
+// Its name is unique within the contact regardless of the case.
+type CustomField struct {
+	Name string
+	Type CustomFieldType
+	// Value is normalized by ParseValue: dates are yyyy-mm-dd, or --mm-dd without the year.
+	Value string
+}
+
+// ParseCustomFieldName checks the name of a new field.
+func ParseCustomFieldName(text string) (string, error) {
+	name := strings.TrimSpace(text)
+	if name == "" || strings.ContainsAny(name, "\n\t") {
+		return "", errors.Errorf("%q is not a field name", text)
+	}
+	if utf8.RuneCountInString(name) > MaxCustomFieldName {
+		return "", errors.Errorf("field name %q is too long", name)
+	}
+	return name, nil
+}
+
+// ParseValue checks the value written by the user and normalizes it for storing.
+func (t CustomFieldType) ParseValue(text string) (string, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return "", errors.New("empty value")
+	}
+
+	switch t {
+	case CustomDate:
+		date, err := ParseAnyDate(text)
+		if err != nil {
+			return "", err
+		}
+		return date.ISO(), nil
+	case CustomURL:
+		if !strings.Contains(text, "://") {
+			text = "https://" + text
+		}
+		u, err := url.Parse(text)
+		if err != nil {
+			return "", errors.Wrap(err, "cannot Parse")
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || !strings.Contains(u.Hostname(), ".") || strings.ContainsAny(text, " \n") {
+			return "", errors.Errorf("%q is not a link", text)
+		}
+		return u.String(), nil
+	case CustomPhone:
+		digits := 0
+		for _, r := range text {
+			switch {
+			case r >= '0' && r <= '9':
+				digits++
+			case !strings.ContainsRune("+-() ", r):
+				return "", errors.Errorf("%q is not a phone", text)
+			}
+		}
+		if digits < 5 || digits > 15 {
+			return "", errors.Errorf("phone %q has %d digits", text, digits)
+		}
+		return text, nil
+	default:
+		return text, nil
+	}
+}
+
+// Date returns the value of a date field.
+func (f CustomField) Date() (Birthday, bool) {
+	return ParseISO(f.Value)
+}
+
+// Display is the value as the card shows it.
+func (f CustomField) Display(lang i18n.Lang) string {
+	if f.Type == CustomDate {
+		if date, ok := f.Date(); ok {
+			return lang.Date(date.Day, int(date.Month), date.Year)
+		}
+	}
+	return f.Value
+}
+
+// SortCustomFields orders the fields by the name the way the storages do.
+func SortCustomFields(fields []CustomField) {
+	sort.Slice(fields, func(i, j int) bool {
+		return fields[i].Name < fields[j].Name
+	})
+}
+
+// CustomField returns the field of the contact with the name in any case.
+func (c *Contact) CustomField(name string) (CustomField, bool) {
+	for _, field := range c.CustomFields {
+		if strings.EqualFold(field.Name, name) {
+			return field, true
+		}
+	}
+	return CustomField{}, false
+}
@@ -0,0 +1,260 @@
+package types
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/profectus200/contact-book-bot/internal/i18n"
+)
+
+// DuplicateReason is why two contacts look like the same person.
+type DuplicateReason string
+
+const (
+	SamePhone   DuplicateReason = "phone"
+	SameEmail   DuplicateReason = "email"
+	SimilarName DuplicateReason = "name"
+)
+
+func (r DuplicateReason) Name(lang i18n.Lang) string {
+	switch r {
+	case SamePhone:
+		return lang.T(i18n.DuplicateSamePhone)
+	case SameEmail:
+		return lang.T(i18n.DuplicateSameEmail)
+	default:
+		return lang.T(i18n.DuplicateSimilarName)
+	}
+}
+
+// Duplicate is a pair of contacts which are likely the same person, the older one first.
+type Duplicate struct {
+	First  *Contact
+	Second *Contact
+	Reason DuplicateReason
+}
+
+// FindDuplicates returns the likely duplicates among the contacts ordered by their IDs.
+// A pair is reported once, for the strongest reason: the phone, then the email, then the name.
+// The phones without a country code are taken for the phones of the region, see Settings.PhoneRegion.
+func FindDuplicates(contacts []*Contact, region string) []Duplicate {
+	sorted := make([]*Contact, len(contacts))
+	copy(sorted, contacts)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].ContactID < sorted[j].ContactID
+	})
+
+	var duplicates []Duplicate
+	for i, first := range sorted {
+		for _, second := range sorted[i+1:] {
+			if reason, ok := duplicateReason(first, second, region); ok {
+				duplicates = append(duplicates, Duplicate{First: first, Second: second, Reason: reason})
+			}
+		}
+	}
+	return duplicates
+}
+
+func duplicateReason(a, b *Contact, region string) (DuplicateReason, bool) {
+	if phone := NormalizePhone(a.Phone, region); phone != "" && phone == NormalizePhone(b.Phone, region) {
+		return SamePhone, true
+	}
+	if email := normalizeEmail(a.Email); email != "" && email == normalizeEmail(b.Email) {
+		return SameEmail, true
+	}
+	if similarNames(a.Name, b.Name) {
+		return SimilarName, true
+	}
+	return "", false
+}
+
+// NormalizePhone keeps the digits of the phone which identify it whatever way it is written:
+// the last ten, so that +7 900 123-45-67 and 8 (900) 1234567 are the same phone. A phone
+// without a country code gets the one of the region first, so that in FR 06 12 34 56 78
+// is +33 6 12 34 56 78 though the last ten digits differ.
+func NormalizePhone(phone, region string) string {
+	phone = WithCountryCode(phone, region)
+
+	digits := make([]rune, 0, len(phone))
+	for _, r := range phone {
+		if r >= '0' && r <= '9' {
+			digits = append(digits, r)
+		}
+	}
+
+	const significant = 10
+	if len(digits) > significant {
+		digits = digits[len(digits)-significant:]
+	}
+	return string(digits)
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// similarNames tells whether the names differ by a typo or by the order of the words.
+func similarNames(a, b string) bool {
+	a, b = normalizeName(a), normalizeName(b)
+	if a == "" || b == "" {
+		return false
+	}
+	if a == b || sortedWords(a) == sortedWords(b) {
+		return true
+	}
+
+	// Short names differing by a letter are often different names, e.g. Ivan and Ivana.
+	length := len([]rune(a))
+	if l := len([]rune(b)); l < length {
+		length = l
+	}
+	switch {
+	case length >= 8:
+		return editDistance(a, b) <= 2
+	case length >= 5:
+		return editDistance(a, b) <= 1
+	default:
+		return false
+	}
+}
+
+func normalizeName(name string) string {
+	name = strings.ToLower(strings.ReplaceAll(strings.ReplaceAll(name, "ё", "е"), "Ё", "Е"))
+	return strings.Join(strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
+
+func sortedWords(name string) string {
+	words := strings.Fields(name)
+	sort.Strings(words)
+	return strings.Join(words, " ")
+}
+
+// editDistance is the Levenshtein distance between the strings.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+func minInt(first int, rest ...int) int {
+	for _, n := range rest {
+		if n < first {
+			first = n
+		}
+	}
+	return first
+}
+
+// MergeContacts makes the contact kept after merging the other one into it. Every field
+// is taken from the kept contact unless the other one knows more: a value where the kept
+// one has none, a fuller name, a birthday with the year. Descriptions are combined, and so
+// are the interaction logs.
+func MergeContacts(keep, other *Contact) *Contact {
+	merged := *keep
+
+	if containsFold(other.Name, keep.Name) && len(other.Name) > len(keep.Name) {
+		merged.Name = other.Name
+	}
+	if merged.Email == "" {
+		merged.Email = other.Email
+	}
+	if merged.Phone == "" {
+		merged.Phone = other.Phone
+	}
+	if merged.PhotoID == "" {
+		merged.PhotoID = other.PhotoID
+	}
+	if merged.Birthday == nil || (!merged.Birthday.HasYear() && other.Birthday != nil && other.Birthday.HasYear()) {
+		merged.Birthday = other.Birthday
+	}
+	if merged.Birthday != nil {
+		birthday := *merged.Birthday
+		merged.Birthday = &birthday
+	}
+	merged.CustomFields = append([]CustomField(nil), keep.CustomFields...)
+	for _, field := range other.CustomFields {
+		if _, ok := keep.CustomField(field.Name); !ok {
+			merged.CustomFields = append(merged.CustomFields, field)
+		}
+	}
+	SortCustomFields(merged.CustomFields)
+	merged.Events = append([]Event(nil), keep.Events...)
+	for _, event := range other.Events {
+		if _, ok := keep.Event(event.Name); !ok {
+			merged.Events = append(merged.Events, event)
+		}
+	}
+	SortEvents(merged.Events)
+	if other.LastInteraction != nil && (merged.LastInteraction == nil || other.LastInteraction.after(*merged.LastInteraction)) {
+		merged.LastInteraction = other.LastInteraction
+	}
+	if merged.LastInteraction != nil {
+		last := *merged.LastInteraction
+		merged.LastInteraction = &last
+	}
+
+	switch {
+	case merged.Description == "":
+		merged.Description = other.Description
+	case other.Description != "" && !containsFold(merged.Description, other.Description):
+		merged.Description += "\n" + other.Description
+	}
+
+	return &merged
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+// ToString shows the contacts of the pair side by side for /duplicates.
+func (d Duplicate) ToString(lang i18n.Lang, number, total int) string {
+	const missing = "—"
+
+	pair := func(a, b string) string {
+		if a == "" {
+			a = missing
+		}
+		if b == "" {
+			b = missing
+		}
+		return a + " | " + b
+	}
+	birthday := func(c *Contact) string {
+		if c.Birthday == nil {
+			return ""
+		}
+		return lang.Date(c.Birthday.Day, int(c.Birthday.Month), c.Birthday.Year)
+	}
+
+	lines := []string{
+		lang.T(i18n.DuplicatesTitle, number, total, d.Reason.Name(lang)),
+		"",
+		lang.T(i18n.CardID, d.First.ContactID) + " | " + lang.T(i18n.CardID, d.Second.ContactID),
+		lang.T(i18n.CardName, pair(d.First.Name, d.Second.Name)),
+		lang.T(i18n.CardEmail, pair(d.First.Email, d.Second.Email)),
+		lang.T(i18n.CardPhone, pair(d.First.Phone, d.Second.Phone)),
+		lang.T(i18n.CardBirthday, pair(birthday(d.First), birthday(d.Second))),
+		lang.T(i18n.CardDescription, pair(d.First.Description, d.Second.Description)),
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
@@ -0,0 +1,283 @@
+package types
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	"github.com/profectus200/contact-book-bot/internal/i18n"
+)
+
+// UpcomingDays is how far ahead /upcoming looks.
+const UpcomingDays = 30
+
+// MaxEventName is the longest name of a date of a contact in characters.
+const MaxEventName = 32
+
+// RecurrenceUnit is what an event repeats every few of.
+type RecurrenceUnit string
+
+const (
+	RecurDay   RecurrenceUnit = "day"
+	RecurWeek  RecurrenceUnit = "week"
+	RecurMonth RecurrenceUnit = "month"
+	RecurYear  RecurrenceUnit = "year"
+)
+
+// Recurrence is how often an event repeats: every Every units.
+type Recurrence struct {
+	Every int
+	Unit  RecurrenceUnit
+}
+
+// Yearly is how birthdays and most of the other dates repeat.
+var Yearly = Recurrence{Every: 1, Unit: RecurYear}
+
+// recurrenceWords are the beginnings of the words of the units in English and Russian.
+var recurrenceWords = []struct {
+	unit  RecurrenceUnit
+	stems []string
+}{
+	{unit: RecurDay, stems: []string{"day", "дн", "ден", "день"}},
+	{unit: RecurWeek, stems: []string{"week", "недел"}},
+	{unit: RecurMonth, stems: []string{"month", "месяц"}},
+	{unit: RecurYear, stems: []string{"year", "год", "лет"}},
+}
+
+// ParseRecurrence recognizes "every year", "yearly", "every 6 months", "every 2 weeks" and the
+// same in Russian: "каждый год", "ежегодно", "каждые 6 месяцев".
+func ParseRecurrence(text string) (Recurrence, error) {
+	fields := strings.Fields(strings.ToLower(text))
+	switch {
+	case len(fields) == 1 && (fields[0] == "yearly" || fields[0] == "ежегодно" || fields[0] == "annually"):
+		return Yearly, nil
+	case len(fields) == 1 && (fields[0] == "monthly" || fields[0] == "ежемесячно"):
+		return Recurrence{Every: 1, Unit: RecurMonth}, nil
+	case len(fields) == 1 && (fields[0] == "weekly" || fields[0] == "еженедельно"):
+		return Recurrence{Every: 1, Unit: RecurWeek}, nil
+	}
+
+	if len(fields) > 0 && (fields[0] == "every" || strings.HasPrefix(fields[0], "кажд")) {
+		fields = fields[1:]
+	}
+	every := 1
+	if len(fields) == 2 {
+		n, err := strconv.Atoi(fields[0])
+		if err != nil || n < 1 || n > 1000 {
+			return Recurrence{}, errors.Errorf("%q is not a number", fields[0])
+		}
+		every, fields = n, fields[1:]
+	}
+	if len(fields) != 1 {
+		return Recurrence{}, errors.Errorf("cannot recognize recurrence %q", text)
+	}
+
+	for _, words := range recurrenceWords {
+		for _, stem := range words.stems {
+			if strings.HasPrefix(fields[0], stem) {
+				return Recurrence{Every: every, Unit: words.unit}, nil
+			}
+		}
+	}
+	return Recurrence{}, errors.Errorf("unknown unit %q", fields[0])
+}
+
+// Name tells how often the event repeats, e.g. "every year" or "every 6 months".
+func (r Recurrence) Name(lang i18n.Lang) string {
+	every, unit := i18n.EveryYear, i18n.Years
+	switch r.Unit {
+	case RecurDay:
+		every, unit = i18n.EveryDay, i18n.Days
+	case RecurWeek:
+		every, unit = i18n.EveryWeek, i18n.Weeks
+	case RecurMonth:
+		every, unit = i18n.EveryMonth, i18n.Months
+	}
+
+	if r.Every == 1 {
+		return lang.T(every)
+	}
+	return lang.T(i18n.EveryMany, r.Every, lang.Plural(unit, r.Every))
+}
+
+// months is the recurrence in months, 0 for the recurrences in days.
+func (r Recurrence) months() int {
+	switch r.Unit {
+	case RecurMonth:
+		return r.Every
+	case RecurYear:
+		return 12 * r.Every
+	}
+	return 0
+}
+
+// days is the recurrence in days, 0 for the recurrences in months.
+func (r Recurrence) days() int {
+	switch r.Unit {
+	case RecurDay:
+		return r.Every
+	case RecurWeek:
+		return 7 * r.Every
+	}
+	return 0
+}
+
+// Event is a named recurring date of the contact, e.g. the wedding anniversary.
+// Its name is unique within the contact.
+type Event struct {
+	Name string
+	// Date is the first occurrence. Only a yearly date may be without the year.
+	Date       Birthday
+	Recurrence Recurrence
+}
+
+// ParseEventName checks the name of a new date.
+func ParseEventName(text string) (string, error) {
+	name := strings.TrimSpace(text)
+	if name == "" || strings.ContainsAny(name, "\n\t") {
+		return "", errors.Errorf("%q is not a name of a date", text)
+	}
+	if utf8.RuneCountInString(name) > MaxEventName {
+		return "", errors.Errorf("name of a date %q is too long", name)
+	}
+	return name, nil
+}
+
+// ParseEventDate recognizes the first occurrence of the date written the way ParseAnyDate
+// takes it. Only a yearly date may come without the year.
+func ParseEventDate(text string, recurrence Recurrence) (Birthday, error) {
+	date, err := ParseAnyDate(text)
+	if err != nil {
+		return Birthday{}, err
+	}
+	if !date.HasYear() && recurrence != Yearly {
+		return Birthday{}, errors.Errorf("date %s repeating %d %s has no year", date, recurrence.Every, recurrence.Unit)
+	}
+	return date, nil
+}
+
+// Next returns the nearest occurrence not before the day of now, at midnight in its time zone.
+// The 31st comes on the last day of the shorter months, like the 29th of February on the 28th.
+func (e Event) Next(now time.Time) time.Time {
+	if !e.Date.HasYear() {
+		return e.Date.Next(now)
+	}
+
+	today := Day(now)
+	next := e.occurrence(0)
+	if next.Before(today) {
+		if days := e.Recurrence.days(); days > 0 {
+			passed := int(today.Sub(next).Hours() / 24)
+			next = e.occurrence((passed + days - 1) / days)
+		} else {
+			months := (today.Year()-next.Year())*12 + int(today.Month()-next.Month())
+			n := months / e.Recurrence.months()
+			for next = e.occurrence(n); next.Before(today); next = e.occurrence(n) {
+				n++
+			}
+		}
+	}
+	return time.Date(next.Year(), next.Month(), next.Day(), 0, 0, 0, 0, now.Location())
+}
+
+// occurrence returns the day of the nth occurrence from 0 at midnight UTC.
+func (e Event) occurrence(n int) time.Time {
+	if days := e.Recurrence.days(); days > 0 {
+		return time.Date(e.Date.Year, e.Date.Month, e.Date.Day+n*days, 0, 0, 0, 0, time.UTC)
+	}
+
+	first := time.Date(e.Date.Year, e.Date.Month+time.Month(n*e.Recurrence.months()), 1, 0, 0, 0, 0, time.UTC)
+	day := e.Date.Day
+	if last := first.AddDate(0, 1, -1).Day(); day > last {
+		day = last
+	}
+	return first.AddDate(0, 0, day-1)
+}
+
+// DaysUntil returns the number of days until the nearest occurrence, 0 if it is today.
+func (e Event) DaysUntil(now time.Time) int {
+	return int(Day(e.Next(now)).Sub(Day(now)).Hours() / 24)
+}
+
+// SortEvents orders the dates by the name the way the storages do.
+func SortEvents(events []Event) {
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Name < events[j].Name
+	})
+}
+
+// Event returns the date of the contact with the name in any case.
+func (c *Contact) Event(name string) (Event, bool) {
+	for _, event := range c.Events {
+		if strings.EqualFold(event.Name, name) {
+			return event, true
+		}
+	}
+	return Event{}, false
+}
+
+// eventLine is the card line of the date with how soon it comes.
+func eventLine(lang i18n.Lang, event Event, now time.Time) string {
+	date := lang.Date(event.Date.Day, int(event.Date.Month), event.Date.Year)
+	return lang.T(i18n.CardEvent, event.Name, date, event.Recurrence.Name(lang), countdown(lang, event.DaysUntil(now)))
+}
+
+// countdown tells how soon something is coming: today, tomorrow or in a few days.
+func countdown(lang i18n.Lang, days int) string {
+	switch days {
+	case 0:
+		return lang.T(i18n.EventToday)
+	case 1:
+		return lang.T(i18n.EventTomorrow)
+	}
+	return lang.T(i18n.EventIn, days, lang.Plural(i18n.Days, days))
+}
+
+// Occasion is a birthday or another date of a contact coming up.
+type Occasion struct {
+	Contact *Contact
+	// Event is nil for the birthday.
+	Event *Event
+	Date  time.Time
+	Days  int
+}
+
+// Upcoming returns the birthdays and the other dates of the contacts coming within the days
+// from today, 0 for only the ones today, the soonest first.
+func Upcoming(contacts []*Contact, now time.Time, days int) []Occasion {
+	var occasions []Occasion
+	for _, contact := range contacts {
+		if contact.Birthday != nil {
+			if until := contact.Birthday.DaysUntil(now); until <= days {
+				occasions = append(occasions, Occasion{Contact: contact, Date: contact.Birthday.Next(now), Days: until})
+			}
+		}
+		for i := range contact.Events {
+			event := &contact.Events[i]
+			if until := event.DaysUntil(now); until <= days {
+				occasions = append(occasions, Occasion{Contact: contact, Event: event, Date: event.Next(now), Days: until})
+			}
+		}
+	}
+
+	sort.SliceStable(occasions, func(i, j int) bool {
+		if occasions[i].Days != occasions[j].Days {
+			return occasions[i].Days < occasions[j].Days
+		}
+		return strings.ToLower(occasions[i].Contact.Name) < strings.ToLower(occasions[j].Contact.Name)
+	})
+	return occasions
+}
+
+// ToString is the line of /upcoming and of the daily reminder about the occasion.
+func (o Occasion) ToString(lang i18n.Lang) string {
+	what := lang.T(i18n.UpcomingBirthday)
+	if o.Event != nil {
+		what = o.Event.Name
+	}
+	date := lang.Date(o.Date.Day(), int(o.Date.Month()), 0)
+	return lang.T(i18n.UpcomingLine, date, countdown(lang, o.Days), o.Contact.Name, what)
+}
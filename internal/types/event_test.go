@@ -0,0 +1,126 @@
+package types_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/profectus200/contact-book-bot/internal/types"
+)
+
+func TestParseRecurrence(t *testing.T) {
+	tests := []struct {
+		text    string
+		want    types.Recurrence
+		wantErr bool
+	}{
+		{text: "yearly", want: types.Yearly},
+		{text: "Every year", want: types.Yearly},
+		{text: "ежегодно", want: types.Yearly},
+		{text: "каждый год", want: types.Yearly},
+		{text: "monthly", want: types.Recurrence{Every: 1, Unit: types.RecurMonth}},
+		{text: "every 6 months", want: types.Recurrence{Every: 6, Unit: types.RecurMonth}},
+		{text: "каждые 6 месяцев", want: types.Recurrence{Every: 6, Unit: types.RecurMonth}},
+		{text: "every 2 weeks", want: types.Recurrence{Every: 2, Unit: types.RecurWeek}},
+		{text: "еженедельно", want: types.Recurrence{Every: 1, Unit: types.RecurWeek}},
+		{text: "every 10 days", want: types.Recurrence{Every: 10, Unit: types.RecurDay}},
+		{text: "каждые 5 лет", want: types.Recurrence{Every: 5, Unit: types.RecurYear}},
+		{text: "every 0 days", wantErr: true},
+		{text: "every 1001 days", wantErr: true},
+		{text: "every few weeks", wantErr: true},
+		{text: "now and then", wantErr: true},
+		{text: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			got, err := types.ParseRecurrence(tt.text)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("got %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("cannot parse: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEventNext(t *testing.T) {
+	monthly := types.Recurrence{Every: 1, Unit: types.RecurMonth}
+	halfYearly := types.Recurrence{Every: 6, Unit: types.RecurMonth}
+	biweekly := types.Recurrence{Every: 2, Unit: types.RecurWeek}
+	tests := []struct {
+		name  string
+		event types.Event
+		now   time.Time
+		want  time.Time
+	}{
+		{
+			name:  "31st in February",
+			event: types.Event{Date: types.Birthday{Day: 31, Month: time.January, Year: 2023}, Recurrence: monthly},
+			now:   time.Date(2023, time.February, 10, 12, 0, 0, 0, time.UTC),
+			want:  time.Date(2023, time.February, 28, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:  "31st in February of a leap year",
+			event: types.Event{Date: types.Birthday{Day: 31, Month: time.January, Year: 2023}, Recurrence: monthly},
+			now:   time.Date(2024, time.February, 10, 12, 0, 0, 0, time.UTC),
+			want:  time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:  "31st in April",
+			event: types.Event{Date: types.Birthday{Day: 31, Month: time.January, Year: 2023}, Recurrence: monthly},
+			now:   time.Date(2023, time.April, 1, 12, 0, 0, 0, time.UTC),
+			want:  time.Date(2023, time.April, 30, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:  "31st back after a shorter month",
+			event: types.Event{Date: types.Birthday{Day: 31, Month: time.January, Year: 2023}, Recurrence: monthly},
+			now:   time.Date(2023, time.March, 1, 12, 0, 0, 0, time.UTC),
+			want:  time.Date(2023, time.March, 31, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:  "today",
+			event: types.Event{Date: types.Birthday{Day: 30, Month: time.January, Year: 2023}, Recurrence: monthly},
+			now:   time.Date(2023, time.April, 30, 23, 0, 0, 0, time.UTC),
+			want:  time.Date(2023, time.April, 30, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:  "every 6 months from the 31st of August",
+			event: types.Event{Date: types.Birthday{Day: 31, Month: time.August, Year: 2022}, Recurrence: halfYearly},
+			now:   time.Date(2023, time.January, 1, 12, 0, 0, 0, time.UTC),
+			want:  time.Date(2023, time.February, 28, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:  "29th of February every year",
+			event: types.Event{Date: types.Birthday{Day: 29, Month: time.February, Year: 2020}, Recurrence: types.Yearly},
+			now:   time.Date(2023, time.January, 1, 12, 0, 0, 0, time.UTC),
+			want:  time.Date(2023, time.February, 28, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:  "every 2 weeks",
+			event: types.Event{Date: types.Birthday{Day: 3, Month: time.January, Year: 2023}, Recurrence: biweekly},
+			now:   time.Date(2023, time.January, 18, 12, 0, 0, 0, time.UTC),
+			want:  time.Date(2023, time.January, 31, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:  "first occurrence ahead",
+			event: types.Event{Date: types.Birthday{Day: 15, Month: time.January, Year: 2024}, Recurrence: monthly},
+			now:   time.Date(2023, time.August, 24, 12, 0, 0, 0, time.UTC),
+			want:  time.Date(2024, time.January, 15, 0, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.event.Next(tt.now); !got.Equal(tt.want) {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
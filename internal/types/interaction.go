@@ -0,0 +1,139 @@
+package types
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/profectus200/contact-book-bot/internal/i18n"
+)
+
+// InteractionKind is what the user did to keep in touch with the contact.
+type InteractionKind string
+
+const (
+	InteractionCalled  InteractionKind = "called"
+	InteractionMet     InteractionKind = "met"
+	InteractionEmailed InteractionKind = "emailed"
+)
+
+var InteractionKinds = []InteractionKind{InteractionCalled, InteractionMet, InteractionEmailed}
+
+// ParseInteractionKind takes the kind written by the user: its code or its name in the language.
+func ParseInteractionKind(text string, lang i18n.Lang) (InteractionKind, bool) {
+	text = strings.TrimSpace(text)
+	for _, k := range InteractionKinds {
+		if strings.EqualFold(text, string(k)) || strings.EqualFold(text, k.Name(lang)) {
+			return k, true
+		}
+	}
+	return "", false
+}
+
+func (k InteractionKind) Name(lang i18n.Lang) string {
+	switch k {
+	case InteractionMet:
+		return lang.T(i18n.InteractionMet)
+	case InteractionEmailed:
+		return lang.T(i18n.InteractionEmailed)
+	default:
+		return lang.T(i18n.InteractionCalled)
+	}
+}
+
+// Interaction is an entry of the log of the contact.
+type Interaction struct {
+	ID   int
+	Kind InteractionKind
+	Note string
+	// Date is the day of the interaction in the time zone of the user, at midnight UTC.
+	Date time.Time
+}
+
+// Day returns the day of the time in its time zone at midnight UTC, the way the dates
+// of the interactions are kept.
+func Day(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// ParseInteractionDate recognizes the dates ParseBirthday does. A date without the year
+// is the latest such day not after today, and no date may be in the future.
+func ParseInteractionDate(text string, now time.Time) (time.Time, error) {
+	date, err := ParseBirthday(text, now)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	today := Day(now)
+	if !date.HasYear() {
+		day := date.in(today.Year(), time.UTC)
+		if day.After(today) {
+			day = date.in(today.Year()-1, time.UTC)
+		}
+		return day, nil
+	}
+
+	day := time.Date(date.Year, date.Month, date.Day, 0, 0, 0, 0, time.UTC)
+	if day.After(today) {
+		return time.Time{}, errors.Errorf("%s is in the future", day.Format("2006-01-02"))
+	}
+	return day, nil
+}
+
+// after tells whether the interaction is later in the log than the other one: on a later
+// day, or logged later on the same day.
+func (i Interaction) after(other Interaction) bool {
+	if !i.Date.Equal(other.Date) {
+		return i.Date.After(other.Date)
+	}
+	return i.ID > other.ID
+}
+
+// DaysAgo tells how many days ago the interaction was on the day of now.
+func (i Interaction) DaysAgo(now time.Time) int {
+	return int(Day(now).Sub(i.Date).Hours() / 24)
+}
+
+// Summary is the kind of the interaction with its note, if any.
+func (i Interaction) Summary(lang i18n.Lang) string {
+	if i.Note == "" {
+		return i.Kind.Name(lang)
+	}
+	return lang.T(i18n.InteractionWithNote, i.Kind.Name(lang), i.Note)
+}
+
+// lastContacted is the card line telling when the contact was contacted last.
+func lastContacted(lang i18n.Lang, last Interaction, now time.Time) string {
+	switch days := last.DaysAgo(now); days {
+	case 0:
+		return lang.T(i18n.CardLastContactedToday, last.Summary(lang))
+	case 1:
+		return lang.T(i18n.CardLastContactedYesterday, last.Summary(lang))
+	default:
+		return lang.T(i18n.CardLastContacted, days, lang.Plural(i18n.Days, days), last.Summary(lang))
+	}
+}
+
+// StaleContacts returns the contacts not contacted for more than the days, the ones never
+// contacted first and then the longest not contacted.
+func StaleContacts(contacts []*Contact, days int, now time.Time) []*Contact {
+	stale := make([]*Contact, 0, len(contacts))
+	for _, contact := range contacts {
+		if contact.LastInteraction == nil || contact.LastInteraction.DaysAgo(now) > days {
+			stale = append(stale, contact)
+		}
+	}
+
+	sort.Slice(stale, func(i, j int) bool {
+		a, b := stale[i].LastInteraction, stale[j].LastInteraction
+		switch {
+		case (a == nil) != (b == nil):
+			return a == nil
+		case a != nil && !a.Date.Equal(b.Date):
+			return a.Date.Before(b.Date)
+		}
+		return stale[i].ContactID < stale[j].ContactID
+	})
+	return stale
+}
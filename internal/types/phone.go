@@ -0,0 +1,110 @@
+package types
+
+import "strings"
+
+// phoneRegion is how the phones of a country are written.
+type phoneRegion struct {
+	// code is the country calling code.
+	code string
+	// trunk is the prefix the phones are dialled with inside the country, it is dropped
+	// after the country code: 8 900 123-45-67 is +7 900 123-45-67.
+	trunk string
+}
+
+// phoneRegions are the countries ParsePhoneRegion knows by their ISO 3166-1 codes.
+var phoneRegions = map[string]phoneRegion{
+	"AE": {code: "971", trunk: "0"},
+	"AM": {code: "374", trunk: "0"},
+	"AR": {code: "54", trunk: "0"},
+	"AT": {code: "43", trunk: "0"},
+	"AU": {code: "61", trunk: "0"},
+	"AZ": {code: "994", trunk: "0"},
+	"BD": {code: "880", trunk: "0"},
+	"BE": {code: "32", trunk: "0"},
+	"BG": {code: "359", trunk: "0"},
+	"BR": {code: "55", trunk: "0"},
+	"BY": {code: "375", trunk: "8"},
+	"CA": {code: "1", trunk: "1"},
+	"CH": {code: "41", trunk: "0"},
+	"CL": {code: "56"},
+	"CN": {code: "86", trunk: "0"},
+	"CO": {code: "57"},
+	"CY": {code: "357"},
+	"CZ": {code: "420"},
+	"DE": {code: "49", trunk: "0"},
+	"DK": {code: "45"},
+	"EE": {code: "372"},
+	"EG": {code: "20", trunk: "0"},
+	"ES": {code: "34"},
+	"FI": {code: "358", trunk: "0"},
+	"FR": {code: "33", trunk: "0"},
+	"GB": {code: "44", trunk: "0"},
+	"GE": {code: "995", trunk: "0"},
+	"GR": {code: "30"},
+	"HK": {code: "852"},
+	"HR": {code: "385", trunk: "0"},
+	"HU": {code: "36", trunk: "06"},
+	"ID": {code: "62", trunk: "0"},
+	"IE": {code: "353", trunk: "0"},
+	"IL": {code: "972", trunk: "0"},
+	"IN": {code: "91", trunk: "0"},
+	"IR": {code: "98", trunk: "0"},
+	"IS": {code: "354"},
+	// The leading zero of the Italian phones is a part of the number.
+	"IT": {code: "39"},
+	"JP": {code: "81", trunk: "0"},
+	"KE": {code: "254", trunk: "0"},
+	"KG": {code: "996", trunk: "0"},
+	"KR": {code: "82", trunk: "0"},
+	"KZ": {code: "7", trunk: "8"},
+	"LU": {code: "352"},
+	"LV": {code: "371"},
+	"MD": {code: "373", trunk: "0"},
+	"MT": {code: "356"},
+	"MX": {code: "52"},
+	"MY": {code: "60", trunk: "0"},
+	"NG": {code: "234", trunk: "0"},
+	"NL": {code: "31", trunk: "0"},
+	"NO": {code: "47"},
+	"NZ": {code: "64", trunk: "0"},
+	"PH": {code: "63", trunk: "0"},
+	"PK": {code: "92", trunk: "0"},
+	"PL": {code: "48"},
+	"PT": {code: "351"},
+	"RO": {code: "40", trunk: "0"},
+	"RS": {code: "381", trunk: "0"},
+	"RU": {code: "7", trunk: "8"},
+	"SA": {code: "966", trunk: "0"},
+	"SE": {code: "46", trunk: "0"},
+	"SG": {code: "65"},
+	"SI": {code: "386", trunk: "0"},
+	"SK": {code: "421", trunk: "0"},
+	"TH": {code: "66", trunk: "0"},
+	"TR": {code: "90", trunk: "0"},
+	"TW": {code: "886", trunk: "0"},
+	"UA": {code: "380", trunk: "0"},
+	"US": {code: "1", trunk: "1"},
+	"VN": {code: "84", trunk: "0"},
+	"ZA": {code: "27", trunk: "0"},
+}
+
+// WithCountryCode puts the code of the country of the region in front of the phone written
+// without one, e.g. 8 (900) 123-45-67 is +7 (900) 123-45-67 in RU. The phones with a
+// country code, the text which is not a phone and any phone without a known region are
+// kept as they are.
+func WithCountryCode(phone, region string) string {
+	phone = strings.TrimSpace(phone)
+	r, ok := phoneRegions[region]
+	if !ok || phone == "" || strings.HasPrefix(phone, "00") {
+		return phone
+	}
+	if first := phone[0]; first != '(' && (first < '0' || first > '9') {
+		return phone
+	}
+
+	national := phone
+	if r.trunk != "" && strings.HasPrefix(national, r.trunk) {
+		national = strings.TrimLeft(strings.TrimPrefix(national, r.trunk), " -")
+	}
+	return "+" + r.code + " " + national
+}
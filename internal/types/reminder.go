@@ -0,0 +1,255 @@
+package types
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/profectus200/contact-book-bot/internal/i18n"
+)
+
+const (
+	// ReminderSnooze is how much later a snoozed reminder comes again.
+	ReminderSnooze = time.Hour
+	// MaxReminders is how many reminders not delivered yet a user may have, so that
+	// /reminders with a button for each fits in one message.
+	MaxReminders = 30
+	// maxListedText is how many characters of the name and of the text of a reminder
+	// /reminders shows.
+	maxListedText = 50
+	// maxReminderYears is how many years ahead a reminder may be set "in", which also keeps
+	// the sums of the periods from overflowing.
+	maxReminderYears = 10
+)
+
+// Reminder is something the user asked to be reminded of about a contact.
+type Reminder struct {
+	ID        int
+	UserID    int64
+	ContactID int
+	// ContactName is the name of the contact at the time the reminder is read.
+	ContactName string
+	Text        string
+	// DueAt is the moment to remind at, to the minute.
+	DueAt time.Time
+	// Attempts is how many times the delivery of the reminder has failed.
+	Attempts int
+}
+
+// ToString is the reminder as it is delivered.
+func (r Reminder) ToString(lang i18n.Lang) string {
+	return lang.T(i18n.ReminderDue, r.ContactName, r.Text)
+}
+
+// FormatDueAt formats the moment of the reminder as dd.mm.yyyy hh:mm in the time zone.
+func FormatDueAt(t time.Time, loc *time.Location) string {
+	return t.In(loc).Format("02.01.2006 15:04")
+}
+
+// ListedReminders are the reminders /reminders shows, the first MaxReminders of them.
+// There are more only if they were added before the limit.
+func ListedReminders(reminders []Reminder) []Reminder {
+	if len(reminders) > MaxReminders {
+		return reminders[:MaxReminders]
+	}
+	return reminders
+}
+
+// ListReminders is the text of /reminders, the reminders numbered from 1 with their moments
+// in the time zone. The long names and texts are cut short.
+func ListReminders(reminders []Reminder, lang i18n.Lang, loc *time.Location) string {
+	text := lang.T(i18n.RemindersTitle)
+	for i, reminder := range reminders {
+		name, reminderText := shorten(reminder.ContactName, maxListedText), shorten(reminder.Text, maxListedText)
+		text += "\n" + lang.T(i18n.ReminderLine, i+1, FormatDueAt(reminder.DueAt, loc), name, reminderText)
+	}
+	return text
+}
+
+// shorten cuts the text to n characters, the last one an ellipsis.
+func shorten(text string, n int) string {
+	runes := []rune(text)
+	if len(runes) <= n {
+		return text
+	}
+	return string(runes[:n-1]) + "…"
+}
+
+// Words of the relative dates of reminders, in English and in Russian.
+var (
+	todayWords          = []string{"today", "сегодня"}
+	tomorrowWords       = []string{"tomorrow", "завтра"}
+	dayAfterTomorrow    = []string{"day after tomorrow", "послезавтра"}
+	reminderAtWords     = []string{"at", "в", "во"}
+	reminderOnWords     = []string{"on", "в", "во"}
+	reminderInWords     = []string{"in", "через"}
+	reminderOneWords    = []string{"a", "an", "one", "один", "одну"}
+	russianWeekdayStems = []string{"воскресен", "понедельн", "вторн", "сред", "четверг", "пятниц", "суббот"}
+)
+
+// ParseReminderDate recognizes when to remind in the time zone of now: "tomorrow",
+// "friday at 10:00", "in 3 days", "in 2 hours", "25.12 18:00", "18:00" or any date
+// ParseBirthday does, and the same in Russian. A day without the time gets
+// defaultTime, in minutes after midnight. The moment must be in the future.
+func ParseReminderDate(text string, now time.Time, defaultTime int) (time.Time, error) {
+	fields := strings.Fields(strings.ToLower(text))
+
+	clock, hasTime := defaultTime, false
+	if n := len(fields); n > 0 && strings.Contains(fields[n-1], ":") {
+		var err error
+		clock, err = ParseReminderTime(fields[n-1])
+		if err != nil {
+			return time.Time{}, err
+		}
+		hasTime = true
+		fields = fields[:n-1]
+		if n := len(fields); n > 0 && oneOf(fields[n-1], reminderAtWords) {
+			fields = fields[:n-1]
+		}
+	}
+	date := strings.Join(fields, " ")
+
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	at := func(day time.Time) time.Time {
+		return time.Date(day.Year(), day.Month(), day.Day(), clock/60, clock%60, 0, 0, now.Location())
+	}
+
+	var due time.Time
+	switch {
+	case date == "" && hasTime:
+		// Only the time is the nearest such time.
+		due = at(today)
+		if !due.After(now) {
+			due = at(today.AddDate(0, 0, 1))
+		}
+	case date == "":
+		return time.Time{}, errors.New("no date")
+	case oneOf(date, todayWords):
+		due = at(today)
+	case oneOf(date, tomorrowWords):
+		due = at(today.AddDate(0, 0, 1))
+	case oneOf(date, dayAfterTomorrow):
+		due = at(today.AddDate(0, 0, 2))
+	case oneOf(fields[0], reminderInWords):
+		in, isDay, err := parseReminderIn(fields[1:], now)
+		if err != nil {
+			return time.Time{}, err
+		}
+		// "In 2 hours" is a moment already, but "in 2 days" is a day.
+		switch {
+		case isDay:
+			due = at(in)
+		case hasTime:
+			return time.Time{}, errors.New("both a period in hours and the time")
+		default:
+			due = in
+		}
+	default:
+		weekday, ok := parseWeekday(fields)
+		if ok {
+			// The weekday is the next such day, a week later when it is today.
+			days := (int(weekday)-int(today.Weekday())+6)%7 + 1
+			due = at(today.AddDate(0, 0, days))
+			break
+		}
+
+		birthday, err := ParseAnyDate(date)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if birthday.HasYear() {
+			due = at(birthday.in(birthday.Year, now.Location()))
+			break
+		}
+		// A day without the year is the nearest such day.
+		due = at(birthday.in(today.Year(), now.Location()))
+		if !due.After(now) {
+			due = at(birthday.in(today.Year()+1, now.Location()))
+		}
+	}
+
+	if !due.After(now) {
+		return time.Time{}, errors.Errorf("%s is in the past", due.Format(time.RFC3339))
+	}
+	return due, nil
+}
+
+// parseReminderIn recognizes the period after "in", e.g. "3 days" or "an hour", and returns
+// the moment that much later than now, at most maxReminderYears. It is true for days and
+// weeks, which give a day.
+func parseReminderIn(fields []string, now time.Time) (time.Time, bool, error) {
+	n := 1
+	switch {
+	case len(fields) == 2 && oneOf(fields[0], reminderOneWords):
+		fields = fields[1:]
+	case len(fields) == 2:
+		var err error
+		n, err = strconv.Atoi(fields[0])
+		if err != nil || n < 1 {
+			return time.Time{}, false, errors.Errorf("%q is not a number", fields[0])
+		}
+		fields = fields[1:]
+	case len(fields) != 1:
+		return time.Time{}, false, errors.New("no period")
+	}
+
+	var period time.Duration
+	var days int
+	unit := fields[0]
+	switch {
+	case strings.HasPrefix(unit, "min"), strings.HasPrefix(unit, "мин"):
+		period = time.Minute
+	case strings.HasPrefix(unit, "hour"), strings.HasPrefix(unit, "час"):
+		period = time.Hour
+	case strings.HasPrefix(unit, "day"), strings.HasPrefix(unit, "ден"), strings.HasPrefix(unit, "дн"):
+		days = 1
+	case strings.HasPrefix(unit, "week"), strings.HasPrefix(unit, "недел"):
+		days = 7
+	default:
+		return time.Time{}, false, errors.Errorf("unknown unit %q", unit)
+	}
+
+	ahead := now.AddDate(maxReminderYears, 0, 0).Sub(now)
+	if period > 0 {
+		if time.Duration(n) > ahead/period {
+			return time.Time{}, false, errors.Errorf("%d %s is too far", n, unit)
+		}
+		return now.Add(time.Duration(n) * period).Truncate(time.Minute), false, nil
+	}
+	if n > int(ahead/(24*time.Hour))/days {
+		return time.Time{}, false, errors.Errorf("%d %s is too far", n, unit)
+	}
+	return now.AddDate(0, 0, days*n), true, nil
+}
+
+// parseWeekday recognizes a day of the week in English or Russian, e.g. "friday", "on fri"
+// or "в пятницу".
+func parseWeekday(fields []string) (time.Weekday, bool) {
+	if len(fields) == 2 && oneOf(fields[0], reminderOnWords) {
+		fields = fields[1:]
+	}
+	if len(fields) != 1 || len([]rune(fields[0])) < 3 {
+		return 0, false
+	}
+
+	name := fields[0]
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if strings.HasPrefix(strings.ToLower(day.String()), name) {
+			return day, true
+		}
+		if strings.HasPrefix(name, russianWeekdayStems[day]) {
+			return day, true
+		}
+	}
+	return 0, false
+}
+
+func oneOf(text string, words []string) bool {
+	for _, word := range words {
+		if text == word {
+			return true
+		}
+	}
+	return false
+}
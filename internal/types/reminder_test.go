@@ -0,0 +1,66 @@
+package types_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/profectus200/contact-book-bot/internal/types"
+)
+
+func TestParseReminderDate(t *testing.T) {
+	// A Thursday at noon, the reminders without the time come at 9:00.
+	now := time.Date(2023, time.August, 24, 12, 0, 0, 0, time.UTC)
+	const defaultTime = 9 * 60
+	tests := []struct {
+		text    string
+		want    time.Time
+		wantErr bool
+	}{
+		{text: "tomorrow", want: time.Date(2023, time.August, 25, 9, 0, 0, 0, time.UTC)},
+		{text: "завтра в 18:30", want: time.Date(2023, time.August, 25, 18, 30, 0, 0, time.UTC)},
+		{text: "today", wantErr: true},
+		{text: "today at 18:00", want: time.Date(2023, time.August, 24, 18, 0, 0, 0, time.UTC)},
+		// The time already passed today comes tomorrow.
+		{text: "12:00", want: time.Date(2023, time.August, 25, 12, 0, 0, 0, time.UTC)},
+		// The weekday of today is the one a week later.
+		{text: "thursday", want: time.Date(2023, time.August, 31, 9, 0, 0, 0, time.UTC)},
+		{text: "в четверг", want: time.Date(2023, time.August, 31, 9, 0, 0, 0, time.UTC)},
+		{text: "friday at 10:00", want: time.Date(2023, time.August, 25, 10, 0, 0, 0, time.UTC)},
+		{text: "in 2 hours", want: time.Date(2023, time.August, 24, 14, 0, 0, 0, time.UTC)},
+		{text: "in 2 hours 10:00", wantErr: true},
+		{text: "in 3 days at 10:00", want: time.Date(2023, time.August, 27, 10, 0, 0, 0, time.UTC)},
+		{text: "через неделю", want: time.Date(2023, time.August, 31, 9, 0, 0, 0, time.UTC)},
+		{text: "in an hour", want: time.Date(2023, time.August, 24, 13, 0, 0, 0, time.UTC)},
+		{text: "in 0 days", wantErr: true},
+		{text: "in 3 fortnights", wantErr: true},
+		{text: "in 521 weeks", want: time.Date(2033, time.August, 18, 9, 0, 0, 0, time.UTC)},
+		{text: "in 9223372036854775807 hours", wantErr: true},
+		{text: "in 9223372036854775807 weeks", wantErr: true},
+		// The day already passed this year comes next year.
+		{text: "12.03", want: time.Date(2024, time.March, 12, 9, 0, 0, 0, time.UTC)},
+		{text: "25.12 18:00", want: time.Date(2023, time.December, 25, 18, 0, 0, 0, time.UTC)},
+		{text: "12.03.2024", want: time.Date(2024, time.March, 12, 9, 0, 0, 0, time.UTC)},
+		{text: "12.03.2023", wantErr: true},
+		{text: "31.02", wantErr: true},
+		{text: "25:00", wantErr: true},
+		{text: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			got, err := types.ParseReminderDate(tt.text, now, defaultTime)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("got %s, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("cannot parse: %v", err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,269 @@
+package types
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// Highlighting of the words found in the snippets of the search results.
+const (
+	HighlightStart = "["
+	HighlightStop  = "]"
+)
+
+// ErrEmptySearch means that the query has no words to search for.
+var ErrEmptySearch = errors.New("empty search query")
+
+// SearchTerm is a word, a prefix of a word or a phrase of consecutive words.
+type SearchTerm struct {
+	// Words are lowercased and made of letters and digits only.
+	Words []string
+	// Prefix is set for a word written with a trailing "*", e.g. pay*.
+	Prefix bool
+}
+
+// SearchQuery finds the contacts with every term of it in the name, the description or
+// the values of the custom fields.
+type SearchQuery struct {
+	Terms []SearchTerm
+}
+
+// ParseSearchQuery reads the query of /search: words, prefixes like pay* and phrases
+// in double quotes like "works on payments".
+func ParseSearchQuery(text string) (SearchQuery, error) {
+	var query SearchQuery
+
+	for i, part := range strings.Split(text, `"`) {
+		// The parts inside the quotes have odd indexes.
+		if i%2 == 1 {
+			if words := searchWords(part); len(words) > 0 {
+				query.Terms = append(query.Terms, SearchTerm{Words: words})
+			}
+			continue
+		}
+
+		for _, field := range strings.Fields(part) {
+			words := searchWords(field)
+			if len(words) == 0 {
+				continue
+			}
+			// A word like e-mail is the phrase of its parts.
+			query.Terms = append(query.Terms, SearchTerm{
+				Words:  words,
+				Prefix: strings.HasSuffix(field, "*") && len(words) == 1,
+			})
+		}
+	}
+
+	if len(query.Terms) == 0 {
+		return query, ErrEmptySearch
+	}
+	return query, nil
+}
+
+// SearchText is the words of the texts the way the queries are split into them. The Postgres
+// storage indexes it instead of the texts, whose parser keeps e.g. emails and links whole,
+// so that it finds the same as the search in Go.
+func SearchText(texts ...string) string {
+	var words []string
+	for _, text := range texts {
+		words = append(words, searchWords(text)...)
+	}
+	return strings.Join(words, " ")
+}
+
+func searchWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), isNotWordRune)
+}
+
+func isNotWordRune(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
+
+// TSQuery is the query as a Postgres tsquery matching every term.
+func (q SearchQuery) TSQuery() string {
+	terms := make([]string, 0, len(q.Terms))
+	for _, term := range q.Terms {
+		// The words are letters and digits only, so they need no quoting.
+		lexemes := strings.Join(term.Words, " <-> ")
+		if term.Prefix {
+			lexemes += ":*"
+		}
+		terms = append(terms, "("+lexemes+")")
+	}
+	return strings.Join(terms, " & ")
+}
+
+// SearchResult is a contact found with the snippet of its description showing what was found.
+type SearchResult struct {
+	Contact *Contact
+	// Snippet is empty when only the name of the contact matches.
+	Snippet string
+}
+
+// SearchContacts finds the contacts matching the query the way the Postgres storage does
+// with its full-text index, for the storages without one. The contacts with more matches
+// go first.
+func SearchContacts(contacts []*Contact, query SearchQuery) []SearchResult {
+	type found struct {
+		result  SearchResult
+		matches int
+	}
+
+	var results []found
+	for _, contact := range contacts {
+		name, description := tokenize(contact.Name), tokenize(contact.Description)
+		all := append(append([]token(nil), name...), description...)
+		for _, field := range contact.CustomFields {
+			all = append(all, tokenize(field.Value)...)
+		}
+
+		matches := 0
+		for _, term := range query.Terms {
+			n := len(term.matches(all))
+			if n == 0 {
+				matches = 0
+				break
+			}
+			matches += n
+		}
+		if matches == 0 {
+			continue
+		}
+
+		results = append(results, found{
+			result:  SearchResult{Contact: contact, Snippet: snippet(contact.Description, description, query)},
+			matches: matches,
+		})
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].matches != results[j].matches {
+			return results[i].matches > results[j].matches
+		}
+		return results[i].result.Contact.ContactID < results[j].result.Contact.ContactID
+	})
+
+	converted := make([]SearchResult, 0, len(results))
+	for _, r := range results {
+		converted = append(converted, r.result)
+	}
+	return converted
+}
+
+// token is a word of a text with its place in the text.
+type token struct {
+	word       string
+	start, end int
+}
+
+func tokenize(text string) []token {
+	var tokens []token
+	start := -1
+	for i, r := range text {
+		switch {
+		case !isNotWordRune(r) && start < 0:
+			start = i
+		case isNotWordRune(r) && start >= 0:
+			tokens = append(tokens, token{word: strings.ToLower(text[start:i]), start: start, end: i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, token{word: strings.ToLower(text[start:]), start: start, end: len(text)})
+	}
+	return tokens
+}
+
+// matches returns the indexes of the tokens starting a match of the term.
+func (t SearchTerm) matches(tokens []token) []int {
+	var starts []int
+	for i := 0; i+len(t.Words) <= len(tokens); i++ {
+		if t.matchesAt(tokens, i) {
+			starts = append(starts, i)
+		}
+	}
+	return starts
+}
+
+func (t SearchTerm) matchesAt(tokens []token, i int) bool {
+	for j, word := range t.Words {
+		got := tokens[i+j].word
+		if t.Prefix && j == len(t.Words)-1 {
+			if !strings.HasPrefix(got, word) {
+				return false
+			}
+		} else if got != word {
+			return false
+		}
+	}
+	return true
+}
+
+// Snippet shows the words of the description around the first match of the query with
+// every match highlighted, empty when the description has none.
+func Snippet(description string, query SearchQuery) string {
+	return snippet(description, tokenize(description), query)
+}
+
+// snippet shows the words of the description around the first match with every match highlighted.
+func snippet(description string, tokens []token, query SearchQuery) string {
+	highlighted := make([]bool, len(tokens))
+	for _, term := range query.Terms {
+		for _, start := range term.matches(tokens) {
+			for i := start; i < start+len(term.Words); i++ {
+				highlighted[i] = true
+			}
+		}
+	}
+
+	first := -1
+	for i, ok := range highlighted {
+		if ok {
+			first = i
+			break
+		}
+	}
+	if first < 0 {
+		return ""
+	}
+
+	const (
+		wordsBefore = 4
+		maxWords    = 15
+	)
+	from := first - wordsBefore
+	if from < 0 {
+		from = 0
+	}
+	to := from + maxWords
+	if to > len(tokens) {
+		to = len(tokens)
+	}
+
+	var b strings.Builder
+	start := tokens[from].start
+	if from > 0 {
+		b.WriteString("…")
+	} else {
+		start = 0
+	}
+	for i := from; i < to; i++ {
+		b.WriteString(description[start:tokens[i].start])
+		if highlighted[i] {
+			b.WriteString(HighlightStart + description[tokens[i].start:tokens[i].end] + HighlightStop)
+		} else {
+			b.WriteString(description[tokens[i].start:tokens[i].end])
+		}
+		start = tokens[i].end
+	}
+	if to < len(tokens) {
+		b.WriteString("…")
+	} else {
+		b.WriteString(description[start:])
+	}
+	return b.String()
+}
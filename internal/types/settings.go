@@ -0,0 +1,322 @@
+package types
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/profectus200/contact-book-bot/internal/i18n"
+)
+
+// SortOrder is the order in which contacts are listed.
+type SortOrder string
+
+const (
+	SortByName     SortOrder = "name"
+	SortByBirthday SortOrder = "birthday"
+	SortByAdded    SortOrder = "added"
+)
+
+// SortOrders are the orders in the sequence the settings button cycles through them.
+var SortOrders = []SortOrder{SortByName, SortByBirthday, SortByAdded}
+
+// Next returns the order following this one in SortOrders.
+func (o SortOrder) Next() SortOrder {
+	for i, order := range SortOrders {
+		if order == o {
+			return SortOrders[(i+1)%len(SortOrders)]
+		}
+	}
+	return SortOrders[0]
+}
+
+func (o SortOrder) label() string {
+	switch o {
+	case SortByBirthday:
+		return i18n.SortByBirthday
+	case SortByAdded:
+		return i18n.SortByAdded
+	}
+	return i18n.SortByName
+}
+
+// Name is the name of the order in the language.
+func (o SortOrder) Name(lang i18n.Lang) string {
+	return lang.T(o.label())
+}
+
+// CardField is a field of a contact card which the user may hide from lists.
+type CardField string
+
+const (
+	FieldEmail       CardField = "email"
+	FieldPhone       CardField = "phone"
+	FieldBirthday    CardField = "birthday"
+	FieldDescription CardField = "description"
+)
+
+// CardFields are the fields which can be hidden, in the order of the card.
+var CardFields = []CardField{FieldEmail, FieldPhone, FieldBirthday, FieldDescription}
+
+// ParseCardField is false for anything but the fields in CardFields.
+func ParseCardField(name string) (CardField, bool) {
+	for _, field := range CardFields {
+		if string(field) == name {
+			return field, true
+		}
+	}
+	return "", false
+}
+
+// Name is the name of the field in the language.
+func (f CardField) Name(lang i18n.Lang) string {
+	switch f {
+	case FieldEmail:
+		return lang.T(i18n.FieldEmail)
+	case FieldPhone:
+		return lang.T(i18n.FieldPhone)
+	case FieldBirthday:
+		return lang.T(i18n.FieldBirthday)
+	}
+	return lang.T(i18n.FieldDescription)
+}
+
+const (
+	defaultTimezone     = "UTC"
+	defaultReminderTime = 9 * 60
+	defaultStaleDays    = 30
+	// maxStaleDays is about ten years.
+	maxStaleDays = 3650
+)
+
+// Settings are the preferences of a user.
+type Settings struct {
+	// Language is the code of the language chosen with /language, empty to follow the Telegram app.
+	Language string
+	// Timezone is an IANA time zone name like Europe/Moscow.
+	Timezone string
+	// PhoneRegion is the ISO 3166-1 code of the country phone numbers without a country code
+	// belong to, empty when unknown.
+	PhoneRegion string
+	// ReminderTime is the time of the day reminders are sent at, in minutes after midnight.
+	ReminderTime int
+	SortOrder    SortOrder
+	HiddenFields []CardField
+	// StaleDays is how long a contact may go without an interaction before /stale lists it.
+	StaleDays int
+}
+
+// DefaultSettings are the settings of a user who has not changed any.
+func DefaultSettings() Settings {
+	return Settings{
+		Timezone:     defaultTimezone,
+		ReminderTime: defaultReminderTime,
+		SortOrder:    SortByName,
+		StaleDays:    defaultStaleDays,
+	}
+}
+
+// Location is the time zone of the user, UTC if the stored one is not known to the system.
+func (s Settings) Location() *time.Location {
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// Now is the current time in the time zone of the user.
+func (s Settings) Now() time.Time {
+	return time.Now().In(s.Location())
+}
+
+// Shows tells whether lists show the field.
+func (s Settings) Shows(field CardField) bool {
+	for _, hidden := range s.HiddenFields {
+		if hidden == field {
+			return false
+		}
+	}
+	return true
+}
+
+// ToggleField hides the field if it is shown and shows it if it is hidden.
+func (s *Settings) ToggleField(field CardField) {
+	hidden := make([]CardField, 0, len(CardFields))
+	for _, f := range CardFields {
+		if s.Shows(f) == (f == field) {
+			hidden = append(hidden, f)
+		}
+	}
+	s.HiddenFields = hidden
+}
+
+// ShowingAll returns the settings with every field shown, for the card being edited.
+func (s Settings) ShowingAll() Settings {
+	s.HiddenFields = nil
+	return s
+}
+
+// ToString describes the settings for the /settings menu.
+func (s Settings) ToString(lang i18n.Lang) string {
+	language := lang.Name()
+	if s.Language == "" {
+		language = lang.T(i18n.SettingsLanguageAuto, language)
+	}
+
+	region := s.PhoneRegion
+	if region == "" {
+		region = lang.T(i18n.SettingsNotSet)
+	}
+
+	shown := make([]string, 0, len(CardFields))
+	for _, field := range CardFields {
+		if s.Shows(field) {
+			shown = append(shown, field.Name(lang))
+		}
+	}
+	fields := strings.Join(shown, ", ")
+	if len(shown) == 0 {
+		fields = lang.T(i18n.SettingsOnlyName)
+	}
+
+	lines := []string{
+		lang.T(i18n.SettingsTitle),
+		lang.T(i18n.SettingsLanguage, language),
+		lang.T(i18n.SettingsTimezone, s.Timezone),
+		lang.T(i18n.SettingsPhoneRegion, region),
+		lang.T(i18n.SettingsReminderTime, FormatReminderTime(s.ReminderTime)),
+		lang.T(i18n.SettingsSortOrder, s.SortOrder.Name(lang)),
+		lang.T(i18n.SettingsCardFields, fields),
+		lang.T(i18n.SettingsStaleDays, s.StaleDays, lang.Plural(i18n.Days, s.StaleDays)),
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// ParseTimezone recognizes an IANA time zone name like Europe/Moscow, in any case,
+// or a whole-hour UTC offset like UTC+3 or +03:00, and returns the name of the zone.
+func ParseTimezone(text string) (string, error) {
+	text = strings.TrimSpace(text)
+
+	if loc, err := time.LoadLocation(text); err == nil && text != "" && text != "Local" {
+		return loc.String(), nil
+	}
+	if name, ok := canonicalZoneName(text); ok {
+		return name, nil
+	}
+
+	offset := strings.ToUpper(text)
+	offset = strings.TrimPrefix(offset, "UTC")
+	offset = strings.TrimPrefix(offset, "GMT")
+	if offset == "" || (offset[0] != '+' && offset[0] != '-') {
+		return "", errors.Errorf("unknown time zone %q", text)
+	}
+
+	hours, minutes, _ := strings.Cut(offset[1:], ":")
+	h, err := strconv.Atoi(hours)
+	if err != nil || h > 14 || (minutes != "" && minutes != "00") {
+		return "", errors.Errorf("unsupported offset %q", text)
+	}
+	if h == 0 {
+		return defaultTimezone, nil
+	}
+
+	// The signs of Etc zones are inverted: Etc/GMT-3 is three hours ahead of UTC.
+	sign := "-"
+	if offset[0] == '-' {
+		sign = "+"
+	}
+	return fmt.Sprintf("Etc/GMT%s%d", sign, h), nil
+}
+
+// canonicalZoneName finds the zone whose name differs from the text in case only,
+// as zone files are looked up case-sensitively.
+func canonicalZoneName(text string) (string, bool) {
+	if !strings.Contains(text, "/") {
+		return "", false
+	}
+
+	// Zone names capitalize every word, e.g. America/New_York.
+	name := []byte(strings.ToLower(text))
+	for i, c := range name {
+		first := i == 0 || name[i-1] == '/' || name[i-1] == '_' || name[i-1] == '-'
+		if first && c >= 'a' && c <= 'z' {
+			name[i] = c - 'a' + 'A'
+		}
+	}
+
+	if _, err := time.LoadLocation(string(name)); err != nil {
+		return "", false
+	}
+	return string(name), true
+}
+
+// ParsePhoneRegion recognizes a two-letter country code like RU, "-" clears the region.
+// Only the countries the phones can be written for are known, see WithCountryCode.
+func ParsePhoneRegion(text string) (string, error) {
+	text = strings.ToUpper(strings.TrimSpace(text))
+	if text == "-" {
+		return "", nil
+	}
+
+	if _, ok := phoneRegions[text]; !ok {
+		return "", errors.Errorf("%q is not a country code", text)
+	}
+	return text, nil
+}
+
+// ParseReminderTime recognizes a time of the day like 9:00, 09:30 or 21.
+func ParseReminderTime(text string) (int, error) {
+	hours, minutes, hasMinutes := strings.Cut(strings.TrimSpace(text), ":")
+
+	h, err := strconv.Atoi(hours)
+	if err != nil || h < 0 || h > 23 {
+		return 0, errors.Errorf("no hour %q", hours)
+	}
+
+	m := 0
+	if hasMinutes {
+		m, err = strconv.Atoi(minutes)
+		if err != nil || len(minutes) != 2 || m < 0 || m > 59 {
+			return 0, errors.Errorf("no minute %q", minutes)
+		}
+	}
+	return h*60 + m, nil
+}
+
+// ParseStaleDays recognizes the number of days for /stale.
+func ParseStaleDays(text string) (int, error) {
+	days, err := strconv.Atoi(strings.TrimSpace(text))
+	if err != nil || days < 1 || days > maxStaleDays {
+		return 0, errors.Errorf("%q is not a number of days", text)
+	}
+	return days, nil
+}
+
+// FormatReminderTime formats minutes after midnight as hh:mm.
+func FormatReminderTime(minutes int) string {
+	return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+}
+
+// SortContacts sorts the contacts in the order. Those without a birthday go last
+// when sorting by birthday.
+func SortContacts(contacts []*Contact, order SortOrder, now time.Time) {
+	sort.SliceStable(contacts, func(i, j int) bool {
+		a, b := contacts[i], contacts[j]
+
+		switch order {
+		case SortByBirthday:
+			if a.Birthday == nil || b.Birthday == nil {
+				return a.Birthday != nil
+			}
+			return a.Birthday.DaysUntil(now) < b.Birthday.DaysUntil(now)
+		case SortByAdded:
+			// The ID of a contact is the ID of the message it was created in.
+			return a.ContactID < b.ContactID
+		}
+		return strings.ToLower(a.Name) < strings.ToLower(b.Name)
+	})
+}
@@ -0,0 +1,30 @@
+package types
+
+// Update is an incoming event from the messenger, independent of its API.
+// Exactly one of Message and Callback is set.
+type Update struct {
+	UpdateID int
+	Message  *UpdateMessage
+	Callback *UpdateCallback
+}
+
+// UpdateMessage is a message sent by a user: a text or a photo.
+type UpdateMessage struct {
+	MessageID    int
+	UserID       int64
+	UserName     string
+	LanguageCode string
+	Text         string
+	// PhotoID is the file_id of the photo sent, its caption is in Text.
+	PhotoID string
+}
+
+// UpdateCallback is a press of an inline keyboard button under a message of the bot.
+type UpdateCallback struct {
+	CallbackID   string
+	UserID       int64
+	UserName     string
+	LanguageCode string
+	MessageID    int
+	Data         string
+}
@@ -0,0 +1,137 @@
+package types
+
+import "time"
+
+// UserData is everything the bot keeps about a user, as /mydata gives it. The secrets,
+// i.e. the calendar link, the CardDAV password, the API token and the secrets of the
+// webhooks, are only marked as there: they are credentials, not data about anyone.
+type UserData struct {
+	ExportedAt time.Time         `json:"exported_at"`
+	User       UserRecord        `json:"user"`
+	Settings   SettingsData      `json:"settings"`
+	Contacts   []ExportedContact `json:"contacts"`
+	// Reminders are the ones not delivered yet.
+	Reminders []ReminderData `json:"reminders"`
+	Webhooks  []WebhookData  `json:"webhooks"`
+}
+
+type UserRecord struct {
+	ID       int64      `json:"id"`
+	Username string     `json:"username,omitempty"`
+	LastSeen *time.Time `json:"last_seen,omitempty"`
+	Banned   bool       `json:"banned"`
+	// Allowlisted is whether the user is on the allowlist by the ID, see AccessAllowlist.
+	Allowlisted        bool `json:"allowlisted"`
+	HasCalendarLink    bool `json:"has_calendar_link"`
+	HasCardDAVPassword bool `json:"has_carddav_password"`
+	HasAPIToken        bool `json:"has_api_token"`
+}
+
+type SettingsData struct {
+	Language     string   `json:"language,omitempty"`
+	Timezone     string   `json:"timezone"`
+	PhoneRegion  string   `json:"phone_region,omitempty"`
+	ReminderTime string   `json:"reminder_time"`
+	SortOrder    string   `json:"sort_order"`
+	HiddenFields []string `json:"hidden_fields"`
+	StaleDays    int      `json:"stale_days"`
+}
+
+// ExportedContact is the contact as the REST API gives it, with what only the bot needs.
+type ExportedContact struct {
+	ContactData
+	// PhotoID is the Telegram file_id of the photo.
+	PhotoID string `json:"photo_file_id,omitempty"`
+	// CardDAVName is the name the CardDAV clients have given to the vCard of the contact.
+	CardDAVName  string            `json:"carddav_name,omitempty"`
+	Interactions []InteractionData `json:"interactions"`
+}
+
+type InteractionData struct {
+	Kind string `json:"kind"`
+	Date string `json:"date"`
+	Note string `json:"note,omitempty"`
+}
+
+type ReminderData struct {
+	ContactID int       `json:"contact_id"`
+	Text      string    `json:"text"`
+	DueAt     time.Time `json:"due_at"`
+}
+
+type WebhookData struct {
+	URL       string    `json:"url"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// NewUserData puts together the records of the user. The contacts have their interactions
+// and the CardDAV names of their vCards from the maps by the IDs of the contacts.
+func NewUserData(info UserInfo, allowlisted bool, settings Settings, contacts []*Contact,
+	interactions map[int][]Interaction, resources []CardResource, reminders []Reminder,
+	webhooks []Webhook, now time.Time) UserData {
+	data := UserData{
+		ExportedAt: now.UTC(),
+		User: UserRecord{
+			ID:                 info.UserID,
+			Username:           info.Username,
+			Banned:             info.Banned,
+			Allowlisted:        allowlisted,
+			HasCalendarLink:    info.HasCalendar,
+			HasCardDAVPassword: info.HasCardDAV,
+			HasAPIToken:        info.HasAPIToken,
+		},
+		Settings: SettingsData{
+			Language:     settings.Language,
+			Timezone:     settings.Timezone,
+			PhoneRegion:  settings.PhoneRegion,
+			ReminderTime: FormatReminderTime(settings.ReminderTime),
+			SortOrder:    string(settings.SortOrder),
+			HiddenFields: make([]string, 0, len(settings.HiddenFields)),
+			StaleDays:    settings.StaleDays,
+		},
+		Contacts:  make([]ExportedContact, 0, len(contacts)),
+		Reminders: make([]ReminderData, 0, len(reminders)),
+		Webhooks:  make([]WebhookData, 0, len(webhooks)),
+	}
+	if !info.LastSeen.IsZero() {
+		lastSeen := info.LastSeen.UTC()
+		data.User.LastSeen = &lastSeen
+	}
+	for _, field := range settings.HiddenFields {
+		data.Settings.HiddenFields = append(data.Settings.HiddenFields, string(field))
+	}
+
+	names := make(map[int]string, len(resources))
+	for _, resource := range resources {
+		names[resource.ContactID] = resource.Name
+	}
+	for _, contact := range contacts {
+		c := ExportedContact{
+			ContactData:  NewContactData(contact),
+			PhotoID:      contact.PhotoID,
+			CardDAVName:  names[contact.ContactID],
+			Interactions: make([]InteractionData, 0, len(interactions[contact.ContactID])),
+		}
+		for _, interaction := range interactions[contact.ContactID] {
+			c.Interactions = append(c.Interactions, InteractionData{
+				Kind: string(interaction.Kind),
+				Date: interaction.Date.Format(time.DateOnly),
+				Note: interaction.Note,
+			})
+		}
+		data.Contacts = append(data.Contacts, c)
+	}
+
+	for _, reminder := range reminders {
+		data.Reminders = append(data.Reminders, ReminderData{
+			ContactID: reminder.ContactID,
+			Text:      reminder.Text,
+			DueAt:     reminder.DueAt.UTC(),
+		})
+	}
+	for _, webhook := range webhooks {
+		data.Webhooks = append(data.Webhooks, WebhookData{URL: webhook.URL, CreatedAt: webhook.CreatedAt.UTC()})
+	}
+
+	return data
+}
@@ -0,0 +1,222 @@
+package types
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// appleNoYear is the year Apple puts in the birthdays without one, with the
+// X-APPLE-OMIT-YEAR parameter, as vCard 3.0 has no dates without the year.
+const appleNoYear = 1604
+
+// CardResource is the vCard of a contact added with a CardDAV client, named the way the
+// client has named it. The vCards of the other contacts are named after their IDs.
+type CardResource struct {
+	ContactID int
+	// Name is the last segment of the URL of the vCard.
+	Name string
+	// UID is the UID of the vCard.
+	UID string
+}
+
+// VCard renders the contact as a vCard 3.0 (RFC 2426) with the UID. The fields vCards have
+// no place for, like the photo and the custom fields, are left out.
+func VCard(contact *Contact, uid string) []byte {
+	c := contentWriter{}
+	c.line("BEGIN:VCARD")
+	c.line("VERSION:3.0")
+	c.line("PRODID:" + productID)
+	c.line("UID:" + textEscaper.Replace(uid))
+	c.line("FN:" + textEscaper.Replace(contact.Name))
+	// The name is not split into the given and the family one, the whole of it is the given one.
+	c.line("N:;" + textEscaper.Replace(contact.Name) + ";;;")
+	if contact.Phone != "" {
+		c.line("TEL;TYPE=CELL:" + textEscaper.Replace(contact.Phone))
+	}
+	if contact.Email != "" {
+		c.line("EMAIL;TYPE=INTERNET:" + textEscaper.Replace(contact.Email))
+	}
+	if birthday := contact.Birthday; birthday != nil {
+		if birthday.HasYear() {
+			c.line("BDAY;VALUE=DATE:" + birthday.ISO())
+		} else {
+			withYear := Birthday{Day: birthday.Day, Month: birthday.Month, Year: appleNoYear}
+			c.line("BDAY;X-APPLE-OMIT-YEAR=" + strconv.Itoa(appleNoYear) + ":" + withYear.ISO())
+		}
+	}
+	if contact.Description != "" {
+		c.line("NOTE:" + textEscaper.Replace(contact.Description))
+	}
+	c.line("END:VCARD")
+	return []byte(c.String())
+}
+
+// ParseVCard reads the fields of the contact kept in vCards from a vCard of version 3.0
+// or 4.0, and its UID. Only the first phone and email are kept, and a birthday which
+// cannot be recognized is left out.
+func ParseVCard(data []byte) (*Contact, string, error) {
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	text = strings.NewReplacer("\n ", "", "\n\t", "").Replace(text)
+
+	var (
+		contact    Contact
+		uid        string
+		structured string
+		begun      bool
+		ended      bool
+	)
+	for _, line := range strings.Split(text, "\n") {
+		name, params, value, ok := splitContentLine(line)
+		if !ok || ended || (!begun && name != "BEGIN") {
+			continue
+		}
+
+		switch name {
+		case "BEGIN":
+			begun = strings.EqualFold(value, "VCARD")
+		case "END":
+			ended = true
+		case "UID":
+			uid = unescapeText(value)
+		case "FN":
+			contact.Name = strings.TrimSpace(unescapeText(value))
+		case "N":
+			structured = value
+		case "TEL":
+			if contact.Phone == "" {
+				contact.Phone = strings.TrimSpace(strings.TrimPrefix(unescapeText(value), "tel:"))
+			}
+		case "EMAIL":
+			if contact.Email == "" {
+				contact.Email = strings.TrimSpace(unescapeText(value))
+			}
+		case "BDAY":
+			if birthday, ok := parseVCardDate(value, params); ok {
+				contact.Birthday = &birthday
+			}
+		case "NOTE":
+			contact.Description = strings.TrimSpace(unescapeText(value))
+		}
+	}
+	if !begun || !ended {
+		return nil, "", errors.New("not a vCard")
+	}
+
+	if contact.Name == "" {
+		// N is family;given;additional;prefixes;suffixes.
+		parts := splitStructured(structured)
+		var names []string
+		for _, i := range []int{3, 1, 2, 0, 4} {
+			if i < len(parts) && strings.TrimSpace(parts[i]) != "" {
+				names = append(names, strings.TrimSpace(parts[i]))
+			}
+		}
+		contact.Name = strings.Join(names, " ")
+	}
+	if contact.Name == "" {
+		return nil, "", errors.New("vCard has no name")
+	}
+
+	return &contact, uid, nil
+}
+
+// splitContentLine splits "group.NAME;PARAM=value:value" into the upper-case name,
+// the parameters with upper-case keys and the value.
+func splitContentLine(line string) (string, map[string]string, string, bool) {
+	colon := -1
+	quoted := false
+	for i, r := range line {
+		if r == '"' {
+			quoted = !quoted
+		} else if r == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return "", nil, "", false
+	}
+
+	head := strings.Split(line[:colon], ";")
+	name := head[0]
+	if dot := strings.LastIndex(name, "."); dot >= 0 {
+		name = name[dot+1:]
+	}
+
+	params := make(map[string]string, len(head)-1)
+	for _, param := range head[1:] {
+		key, value, _ := strings.Cut(param, "=")
+		params[strings.ToUpper(key)] = strings.Trim(value, `"`)
+	}
+	return strings.ToUpper(name), params, line[colon+1:], true
+}
+
+// splitStructured splits the value at the semicolons which are not escaped, unescaping
+// the parts.
+func splitStructured(value string) []string {
+	var parts []string
+	start := 0
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '\\':
+			i++
+		case ';':
+			parts = append(parts, unescapeText(value[start:i]))
+			start = i + 1
+		}
+	}
+	return append(parts, unescapeText(value[start:]))
+}
+
+func unescapeText(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' || i == len(value)-1 {
+			b.WriteByte(value[i])
+			continue
+		}
+		i++
+		switch value[i] {
+		case 'n', 'N':
+			b.WriteByte('\n')
+		default:
+			b.WriteByte(value[i])
+		}
+	}
+	return b.String()
+}
+
+// parseVCardDate reads the dates like 1990-03-12, 19900312 or, without the year, --0312
+// and --03-12. The years before minBirthdayYear are taken for the placeholders of the
+// apps, like the one of Apple, and dropped.
+func parseVCardDate(value string, params map[string]string) (Birthday, bool) {
+	if t := strings.IndexByte(value, 'T'); t >= 0 {
+		value = value[:t]
+	}
+	noYear := strings.HasPrefix(value, "--")
+	digits := strings.ReplaceAll(strings.TrimPrefix(value, "--"), "-", "")
+
+	var numbers []int
+	var err error
+	switch {
+	case noYear && len(digits) == 4:
+		numbers, err = atoiAll([]string{"0", digits[:2], digits[2:]})
+	case !noYear && len(digits) == 8:
+		numbers, err = atoiAll([]string{digits[:4], digits[4:6], digits[6:]})
+	default:
+		return Birthday{}, false
+	}
+	if err != nil {
+		return Birthday{}, false
+	}
+
+	year := numbers[0]
+	if _, ok := params["X-APPLE-OMIT-YEAR"]; ok || year < minBirthdayYear {
+		year = 0
+	}
+	birthday, err := NewBirthday(numbers[2], time.Month(numbers[1]), year, time.Now())
+	return birthday, err == nil
+}
@@ -0,0 +1,144 @@
+package types
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/profectus200/contact-book-bot/internal/i18n"
+)
+
+const (
+	// MaxWebhooks is how many webhooks a user may have.
+	MaxWebhooks = 5
+	// maxWebhookURLLength keeps the URLs short enough for a message and a button.
+	maxWebhookURLLength = 2048
+	// webhookSecretLength is the number of random bytes in a secret, which is longer in base64.
+	webhookSecretLength = 24
+)
+
+// Webhook is a URL of the user notified about the changes of the contacts.
+type Webhook struct {
+	ID     int
+	UserID int64
+	URL    string
+	// Secret is the key of the signatures of the deliveries, see SignPayload.
+	Secret    string
+	CreatedAt time.Time
+}
+
+// WebhookEventType is what has happened to a contact.
+type WebhookEventType string
+
+const (
+	ContactCreated WebhookEventType = "contact.created"
+	ContactUpdated WebhookEventType = "contact.updated"
+	ContactDeleted WebhookEventType = "contact.deleted"
+)
+
+// WebhookEvent is the body of a delivery.
+type WebhookEvent struct {
+	// ID is the same in every attempt to deliver the event, for the receivers to skip repeats.
+	ID        string           `json:"id"`
+	Type      WebhookEventType `json:"type"`
+	CreatedAt time.Time        `json:"created_at"`
+	ContactID int              `json:"contact_id"`
+	// Contact is the contact after the change, it is missing when the contact is deleted.
+	Contact *ContactData `json:"contact,omitempty"`
+}
+
+// NewContactEvent is the payload of the event about the contact, which is nil when deleted.
+func NewContactEvent(eventType WebhookEventType, contactID int, contact *Contact, now time.Time) ([]byte, error) {
+	id, err := randomString(16)
+	if err != nil {
+		return nil, err
+	}
+
+	event := WebhookEvent{
+		ID:        id,
+		Type:      eventType,
+		CreatedAt: now.UTC().Truncate(time.Second),
+		ContactID: contactID,
+	}
+	if contact != nil {
+		data := NewContactData(contact)
+		event.Contact = &data
+	}
+
+	payload, err := json.Marshal(event)
+	return payload, errors.Wrap(err, "cannot Marshal")
+}
+
+// WebhookDelivery is an event waiting in the outbox to be delivered to the webhook.
+type WebhookDelivery struct {
+	ID        int
+	Webhook   Webhook
+	EventType WebhookEventType
+	Payload   []byte
+	// Attempts is the number of the failed deliveries so far.
+	Attempts int
+}
+
+// SignPayload is the signature of the payload sent in X-Webhook-Signature-256: the hex
+// HMAC-SHA256 of the body with the secret of the webhook, prefixed with "sha256=".
+func SignPayload(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// NewWebhookSecret makes a random secret for a new webhook.
+func NewWebhookSecret() (string, error) {
+	return randomString(webhookSecretLength)
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "cannot read random bytes")
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// ParseWebhookURL checks that the text is an absolute http or https URL.
+func ParseWebhookURL(text string) (string, error) {
+	text = strings.TrimSpace(text)
+	if len(text) > maxWebhookURLLength {
+		return "", errors.New("the URL is too long")
+	}
+
+	u, err := url.Parse(text)
+	if err != nil {
+		return "", errors.Wrap(err, "cannot Parse")
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", errors.Errorf("scheme %q is not http or https", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return "", errors.New("the URL has no host")
+	}
+	if u.User != nil {
+		return "", errors.New("the URL has credentials")
+	}
+	return u.String(), nil
+}
+
+// ListWebhooks is the text of /webhooks, the webhooks numbered from 1.
+func ListWebhooks(webhooks []Webhook, lang i18n.Lang) string {
+	if len(webhooks) == 0 {
+		return lang.T(i18n.NoWebhooks)
+	}
+
+	text := lang.T(i18n.WebhooksTitle)
+	for i, webhook := range webhooks {
+		text += "\n" + lang.T(i18n.WebhookLine, i+1, webhook.URL)
+	}
+	return text
+}
@@ -0,0 +1,47 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ConversationTimeoutInterval is how often expired conversations are looked for.
+// A user is told that the conversation expired at most this late.
+const ConversationTimeoutInterval = time.Minute
+
+type conversationExpirer interface {
+	ExpireStale(ctx context.Context) error
+}
+
+type ConversationTimeoutWorker struct {
+	expirer  conversationExpirer
+	interval time.Duration
+	logger   *zap.Logger
+}
+
+func NewConversationTimeoutWorker(expirer conversationExpirer, interval time.Duration, logger *zap.Logger) *ConversationTimeoutWorker {
+	return &ConversationTimeoutWorker{
+		expirer:  expirer,
+		interval: interval,
+		logger:   logger.Named("conversation_timeout"),
+	}
+}
+
+func (w *ConversationTimeoutWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := w.expirer.ExpireStale(ctx)
+			if err != nil {
+				w.logger.Error("Cannot expire conversations", zap.Error(err))
+			}
+		}
+	}
+}
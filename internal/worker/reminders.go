@@ -0,0 +1,46 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ReminderInterval is how often due reminders are looked for, reminders are set to the minute.
+const ReminderInterval = 30 * time.Second
+
+type reminderSender interface {
+	SendDue(ctx context.Context, now time.Time) error
+}
+
+type ReminderWorker struct {
+	sender   reminderSender
+	interval time.Duration
+	logger   *zap.Logger
+}
+
+func NewReminderWorker(sender reminderSender, interval time.Duration, logger *zap.Logger) *ReminderWorker {
+	return &ReminderWorker{
+		sender:   sender,
+		interval: interval,
+		logger:   logger.Named("reminders"),
+	}
+}
+
+func (w *ReminderWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := w.sender.SendDue(ctx, time.Now())
+			if err != nil {
+				w.logger.Error("Cannot send reminders", zap.Error(err))
+			}
+		}
+	}
+}
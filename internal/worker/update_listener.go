@@ -2,17 +2,22 @@ package worker
 
 import (
 	"context"
-	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"strings"
+	"time"
+
 	"github.com/opentracing/opentracing-go"
 	"github.com/pkg/errors"
+	"github.com/profectus200/contact-book-bot/cmd/logging"
+	"github.com/profectus200/contact-book-bot/internal/i18n"
 	"github.com/profectus200/contact-book-bot/internal/model/callbacks"
 	"github.com/profectus200/contact-book-bot/internal/model/messages"
-	"log"
+	"github.com/profectus200/contact-book-bot/internal/types"
+	"github.com/uber/jaeger-client-go"
+	"go.uber.org/zap"
 )
 
 type updateFetcher interface {
-	Start() tgbotapi.UpdatesChannel
-	Request(callback tgbotapi.CallbackConfig) error
+	Start() <-chan types.Update
 	Stop()
 }
 
@@ -24,18 +29,39 @@ type CallbackHandler interface {
 	IncomingCallback(ctx context.Context, callback *callbacks.CallbackData) error
 }
 
+type settingsGetter interface {
+	GetSettings(ctx context.Context, userID int64) (types.Settings, error)
+}
+
+type userTracker interface {
+	TouchUser(ctx context.Context, userID int64, username string, now time.Time) (bool, error)
+}
+
+type accessChecker interface {
+	Admit(ctx context.Context, update types.Update) (bool, error)
+}
+
 type UpdateListenerWorker struct {
 	updateFetcher   updateFetcher
 	messageHandler  MessageHandler
 	callbackHandler CallbackHandler
+	settingsGetter  settingsGetter
+	userTracker     userTracker
+	accessChecker   accessChecker
+	logger          *zap.Logger
 }
 
-func NewUpdateListenerWorker(updateFetcher updateFetcher,
-	messageHandler MessageHandler, callbackHandler CallbackHandler) *UpdateListenerWorker {
+func NewUpdateListenerWorker(updateFetcher updateFetcher, messageHandler MessageHandler,
+	callbackHandler CallbackHandler, settingsGetter settingsGetter, userTracker userTracker,
+	accessChecker accessChecker, logger *zap.Logger) *UpdateListenerWorker {
 	return &UpdateListenerWorker{
 		updateFetcher:   updateFetcher,
 		messageHandler:  messageHandler,
 		callbackHandler: callbackHandler,
+		settingsGetter:  settingsGetter,
+		userTracker:     userTracker,
+		accessChecker:   accessChecker,
+		logger:          logger.Named("worker"),
 	}
 }
 
@@ -54,42 +80,67 @@ func (w *UpdateListenerWorker) Run(ctx context.Context) {
 			}
 			err := w.HandleUpdate(ctx, update)
 			if err != nil {
-				log.Println(err)
+				w.logger.Error("Cannot handle update", zap.Int("update_id", update.UpdateID), zap.Error(err))
 			}
 		}
 	}
 }
 
-func (w *UpdateListenerWorker) HandleUpdate(ctx context.Context, update tgbotapi.Update) error {
+func (w *UpdateListenerWorker) HandleUpdate(ctx context.Context, update types.Update) error {
 	span, ctx := opentracing.StartSpanFromContext(
 		ctx,
 		"HandleUpdate",
 	)
 	defer span.Finish()
 
+	logger := w.updateLogger(span, update)
+	ctx = logging.WithLogger(ctx, logger)
+
+	// The users not let in are not recorded, so they are neither counted nor sent broadcasts.
+	admitted, err := w.accessChecker.Admit(ctx, update)
+	if err != nil {
+		return errors.Wrap(err, "cannot Admit")
+	}
+	if !admitted {
+		return nil
+	}
+
+	banned, err := w.touchUser(ctx, update)
+	if err != nil {
+		return err
+	}
+	if banned {
+		logger.Info("Update of a banned user ignored")
+		return nil
+	}
+
 	if update.Message != nil {
-		log.Printf("[%s] %s", update.Message.From.UserName, update.Message.Text)
+		logger.Info("Incoming message", logging.Text("text", update.Message.Text))
 
+		settings := w.settings(ctx, update.Message.UserID)
 		err := w.messageHandler.IncomingMessage(ctx, &messages.Message{
 			Text:      update.Message.Text,
-			UserID:    update.Message.From.ID,
+			PhotoID:   update.Message.PhotoID,
+			UserID:    update.Message.UserID,
 			MessageID: update.Message.MessageID,
+			Lang:      language(settings, update.Message.LanguageCode),
+			Settings:  settings,
 		})
 
 		if err != nil {
 			return errors.Wrap(err, "cannot IncomingMessage")
 		}
-	} else if update.CallbackQuery != nil {
-		log.Printf("[%s] data: %s",
-			update.CallbackQuery.Message.From.UserName,
-			update.CallbackQuery.Data,
-		)
+	} else if update.Callback != nil {
+		logger.Info("Incoming callback")
 
+		settings := w.settings(ctx, update.Callback.UserID)
 		err := w.callbackHandler.IncomingCallback(ctx, &callbacks.CallbackData{
-			Data:       update.CallbackData(),
-			FromID:     update.CallbackQuery.From.ID,
-			MessageID:  update.CallbackQuery.Message.MessageID,
-			CallbackID: update.CallbackQuery.ID,
+			Data:       update.Callback.Data,
+			FromID:     update.Callback.UserID,
+			MessageID:  update.Callback.MessageID,
+			CallbackID: update.Callback.CallbackID,
+			Lang:       language(settings, update.Callback.LanguageCode),
+			Settings:   settings,
 		})
 
 		if err != nil {
@@ -99,3 +150,71 @@ func (w *UpdateListenerWorker) HandleUpdate(ctx context.Context, update tgbotapi
 
 	return nil
 }
+
+// touchUser records that the user of the update is active and tells whether the user is banned.
+func (w *UpdateListenerWorker) touchUser(ctx context.Context, update types.Update) (bool, error) {
+	var (
+		userID   int64
+		username string
+	)
+	switch {
+	case update.Message != nil:
+		userID, username = update.Message.UserID, update.Message.UserName
+	case update.Callback != nil:
+		userID, username = update.Callback.UserID, update.Callback.UserName
+	default:
+		return false, nil
+	}
+
+	banned, err := w.userTracker.TouchUser(ctx, userID, username, time.Now())
+	if err != nil {
+		return false, errors.Wrap(err, "cannot TouchUser")
+	}
+	return banned, nil
+}
+
+// settings returns the settings of the user, or the default ones if they cannot be loaded:
+// an answer with the default settings is better than no answer.
+func (w *UpdateListenerWorker) settings(ctx context.Context, userID int64) types.Settings {
+	settings, err := w.settingsGetter.GetSettings(ctx, userID)
+	if err != nil {
+		logging.FromContext(ctx, w.logger).Warn("Cannot GetSettings", zap.Error(err))
+		return types.DefaultSettings()
+	}
+	return settings
+}
+
+// language returns the language chosen by the user with /language,
+// or the language of the Telegram app of the user if it is supported.
+func language(settings types.Settings, languageCode string) i18n.Lang {
+	if lang, ok := i18n.Parse(settings.Language); ok {
+		return lang
+	}
+
+	lang, _ := i18n.Parse(languageCode)
+	return lang
+}
+
+// updateLogger returns a logger with the fields identifying the update.
+// Only the command itself is logged from the message text: anything else may be contact data.
+func (w *UpdateListenerWorker) updateLogger(span opentracing.Span, update types.Update) *zap.Logger {
+	fields := []zap.Field{zap.Int("update_id", update.UpdateID)}
+
+	if spanContext, ok := span.Context().(jaeger.SpanContext); ok {
+		fields = append(fields, zap.String("trace_id", spanContext.TraceID().String()))
+	}
+
+	if update.Message != nil {
+		fields = append(fields, zap.Int64("user_id", update.Message.UserID))
+		if strings.HasPrefix(update.Message.Text, "/") {
+			fields = append(fields, zap.String("command", strings.Fields(update.Message.Text)[0]))
+		}
+	} else if update.Callback != nil {
+		fields = append(fields,
+			zap.Int64("user_id", update.Callback.UserID),
+			zap.String("command", update.Callback.Data),
+		)
+	}
+
+	return w.logger.With(fields...)
+}
@@ -0,0 +1,46 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// WebhookInterval is how often the outbox of the webhooks is looked at.
+const WebhookInterval = 10 * time.Second
+
+type webhookDeliverer interface {
+	DeliverDue(ctx context.Context, now time.Time) error
+}
+
+type WebhookWorker struct {
+	deliverer webhookDeliverer
+	interval  time.Duration
+	logger    *zap.Logger
+}
+
+func NewWebhookWorker(deliverer webhookDeliverer, interval time.Duration, logger *zap.Logger) *WebhookWorker {
+	return &WebhookWorker{
+		deliverer: deliverer,
+		interval:  interval,
+		logger:    logger.Named("webhooks"),
+	}
+}
+
+func (w *WebhookWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := w.deliverer.DeliverDue(ctx, time.Now())
+			if err != nil {
+				w.logger.Error("Cannot deliver webhook events", zap.Error(err))
+			}
+		}
+	}
+}
@@ -0,0 +1,38 @@
+-- +goose Up
+-- +goose StatementBegin
+
+ALTER TABLE contacts
+    ADD COLUMN birthday_day   SMALLINT,
+    ADD COLUMN birthday_month SMALLINT,
+    ADD COLUMN birthday_year  SMALLINT;
+
+-- Birthdays used to be stored 1000 years back, as the year was never asked for,
+-- and contacts created without a birthday got the date of their creation.
+UPDATE contacts
+SET birthday_day   = EXTRACT(DAY FROM birthday),
+    birthday_month = EXTRACT(MONTH FROM birthday)
+WHERE birthday < DATE '1900-01-01';
+
+ALTER TABLE contacts
+    DROP COLUMN birthday;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+ALTER TABLE contacts
+    ADD COLUMN birthday DATE;
+
+UPDATE contacts
+SET birthday = CASE
+    WHEN birthday_month IS NULL THEN CURRENT_DATE
+    ELSE make_date(COALESCE(birthday_year, 1004), birthday_month, birthday_day)
+END;
+
+ALTER TABLE contacts
+    DROP COLUMN birthday_day,
+    DROP COLUMN birthday_month,
+    DROP COLUMN birthday_year;
+
+-- +goose StatementEnd
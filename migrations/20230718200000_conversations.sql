@@ -0,0 +1,37 @@
+-- +goose Up
+-- +goose StatementBegin
+
+ALTER TABLE users
+    ADD COLUMN flow       TEXT NOT NULL DEFAULT '',
+    ADD COLUMN step       TEXT NOT NULL DEFAULT '',
+    ADD COLUMN payload    TEXT NOT NULL DEFAULT '',
+    ADD COLUMN expires_at TIMESTAMPTZ;
+
+-- The states of the old state machine cannot be resumed as conversations,
+-- the users in the middle of an edit will have to press the button again.
+ALTER TABLE users
+    DROP COLUMN contact_id,
+    DROP COLUMN message_id,
+    DROP COLUMN current_state;
+
+CREATE INDEX users_expires_at_idx ON users (expires_at) WHERE flow <> '';
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP INDEX users_expires_at_idx;
+
+ALTER TABLE users
+    ADD COLUMN contact_id    INTEGER DEFAULT 0,
+    ADD COLUMN message_id    INTEGER DEFAULT 0,
+    ADD COLUMN current_state TEXT DEFAULT '7';
+
+ALTER TABLE users
+    DROP COLUMN flow,
+    DROP COLUMN step,
+    DROP COLUMN payload,
+    DROP COLUMN expires_at;
+
+-- +goose StatementEnd
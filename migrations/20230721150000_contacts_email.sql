@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+
+ALTER TABLE contacts
+    ADD COLUMN email TEXT NOT NULL DEFAULT '';
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+ALTER TABLE contacts
+    DROP COLUMN email;
+
+-- +goose StatementEnd
@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+
+ALTER TABLE contacts
+    ADD COLUMN search tsvector GENERATED ALWAYS AS (
+        to_tsvector('simple', coalesce(name, '') || ' ' || coalesce(description, ''))
+    ) STORED;
+
+CREATE INDEX contacts_search_idx ON contacts USING GIN (search);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP INDEX contacts_search_idx;
+
+ALTER TABLE contacts
+    DROP COLUMN search;
+
+-- +goose StatementEnd
@@ -0,0 +1,49 @@
+-- +goose Up
+-- +goose StatementBegin
+
+CREATE TABLE contact_fields
+(
+    tg_user_id BIGINT  NOT NULL REFERENCES users (tg_user_id) ON DELETE CASCADE,
+    contact_id INTEGER NOT NULL,
+    name       TEXT    NOT NULL,
+    type       TEXT    NOT NULL,
+    value      TEXT    NOT NULL,
+    PRIMARY KEY (tg_user_id, contact_id, name)
+);
+
+-- The values of the custom fields are copied into the contact, so that the full-text
+-- index of the contact covers them too.
+ALTER TABLE contacts
+    ADD COLUMN fields_text TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE contacts
+    DROP COLUMN search;
+
+ALTER TABLE contacts
+    ADD COLUMN search tsvector GENERATED ALWAYS AS (
+        to_tsvector('simple', coalesce(name, '') || ' ' || coalesce(description, '') || ' ' || fields_text)
+    ) STORED;
+
+CREATE INDEX contacts_search_idx ON contacts USING GIN (search);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+ALTER TABLE contacts
+    DROP COLUMN search;
+
+ALTER TABLE contacts
+    ADD COLUMN search tsvector GENERATED ALWAYS AS (
+        to_tsvector('simple', coalesce(name, '') || ' ' || coalesce(description, ''))
+    ) STORED;
+
+CREATE INDEX contacts_search_idx ON contacts USING GIN (search);
+
+ALTER TABLE contacts
+    DROP COLUMN fields_text;
+
+DROP TABLE contact_fields;
+
+-- +goose StatementEnd
@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+
+CREATE TABLE interactions
+(
+    interaction_id BIGSERIAL PRIMARY KEY,
+    tg_user_id     BIGINT  NOT NULL REFERENCES users (tg_user_id) ON DELETE CASCADE,
+    contact_id     INTEGER NOT NULL,
+    kind           TEXT    NOT NULL,
+    note           TEXT    NOT NULL DEFAULT '',
+    happened_on    DATE    NOT NULL
+);
+
+CREATE INDEX interactions_contact_idx ON interactions (tg_user_id, contact_id, happened_on);
+
+ALTER TABLE user_settings
+    ADD COLUMN stale_days INTEGER NOT NULL DEFAULT 30;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+ALTER TABLE user_settings
+    DROP COLUMN stale_days;
+
+DROP TABLE interactions;
+
+-- +goose StatementEnd
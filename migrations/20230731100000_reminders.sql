@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+
+CREATE TABLE reminders
+(
+    reminder_id BIGSERIAL PRIMARY KEY,
+    tg_user_id  BIGINT      NOT NULL REFERENCES users (tg_user_id) ON DELETE CASCADE,
+    contact_id  INTEGER     NOT NULL,
+    text        TEXT        NOT NULL,
+    due_at      TIMESTAMPTZ NOT NULL,
+    -- sent_at is set when the reminder is delivered, and cleared when it is snoozed.
+    sent_at     TIMESTAMPTZ
+);
+
+CREATE INDEX reminders_due_at_idx ON reminders (due_at) WHERE sent_at IS NULL;
+CREATE INDEX reminders_contact_idx ON reminders (tg_user_id, contact_id);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP TABLE reminders;
+
+-- +goose StatementEnd
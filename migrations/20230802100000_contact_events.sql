@@ -0,0 +1,31 @@
+-- +goose Up
+-- +goose StatementBegin
+
+CREATE TABLE contact_events
+(
+    tg_user_id BIGINT  NOT NULL REFERENCES users (tg_user_id) ON DELETE CASCADE,
+    contact_id INTEGER NOT NULL,
+    name       TEXT    NOT NULL,
+    -- date is yyyy-mm-dd, or --mm-dd when the year is unknown.
+    date       TEXT    NOT NULL,
+    every      INTEGER NOT NULL,
+    unit       TEXT    NOT NULL,
+    PRIMARY KEY (tg_user_id, contact_id, name)
+);
+
+-- next_digest_at is when the daily reminder about the birthdays and the other dates is due,
+-- NULL before the first one.
+ALTER TABLE users
+    ADD COLUMN next_digest_at TIMESTAMPTZ;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+ALTER TABLE users
+    DROP COLUMN next_digest_at;
+
+DROP TABLE contact_events;
+
+-- +goose StatementEnd
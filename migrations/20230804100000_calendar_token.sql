@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- calendar_token is the secret in the link to the calendar feed of the user, NULL without a link.
+ALTER TABLE users
+    ADD COLUMN calendar_token TEXT;
+
+CREATE UNIQUE INDEX users_calendar_token_idx ON users (calendar_token);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP INDEX users_calendar_token_idx;
+
+ALTER TABLE users
+    DROP COLUMN calendar_token;
+
+-- +goose StatementEnd
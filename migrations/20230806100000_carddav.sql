@@ -0,0 +1,30 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- carddav_resources are the names and the UIDs CardDAV clients have given to the vCards of
+-- the contacts they have added.
+CREATE TABLE carddav_resources
+(
+    tg_user_id BIGINT  NOT NULL REFERENCES users (tg_user_id) ON DELETE CASCADE,
+    contact_id INTEGER NOT NULL,
+    name       TEXT    NOT NULL,
+    uid        TEXT    NOT NULL,
+    PRIMARY KEY (tg_user_id, contact_id),
+    UNIQUE (tg_user_id, name)
+);
+
+-- carddav_password is the SHA-256 of the app password of the CardDAV server, NULL without one.
+ALTER TABLE users
+    ADD COLUMN carddav_password TEXT;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+ALTER TABLE users
+    DROP COLUMN carddav_password;
+
+DROP TABLE carddav_resources;
+
+-- +goose StatementEnd
@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- api_token is the SHA-256 of the token of the REST API of the user, NULL without one.
+ALTER TABLE users
+    ADD COLUMN api_token TEXT;
+
+CREATE UNIQUE INDEX users_api_token_idx ON users (api_token);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP INDEX users_api_token_idx;
+
+ALTER TABLE users
+    DROP COLUMN api_token;
+
+-- +goose StatementEnd
@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- banned users get no answers from the bot. last_seen_at is when the user sent the bot
+-- anything last, for the statistics of the admins, NULL if never since it is recorded.
+ALTER TABLE users
+    ADD COLUMN banned       BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN last_seen_at TIMESTAMPTZ;
+
+CREATE INDEX users_last_seen_at_idx ON users (last_seen_at);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP INDEX users_last_seen_at_idx;
+
+ALTER TABLE users
+    DROP COLUMN banned,
+    DROP COLUMN last_seen_at;
+
+-- +goose StatementEnd
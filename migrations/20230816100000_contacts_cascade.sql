@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- The contacts go away with their user, like everything else of the user does.
+ALTER TABLE contacts
+    DROP CONSTRAINT contacts_tg_user_id_fkey,
+    ADD CONSTRAINT contacts_tg_user_id_fkey
+        FOREIGN KEY (tg_user_id) REFERENCES users (tg_user_id) ON DELETE CASCADE;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+ALTER TABLE contacts
+    DROP CONSTRAINT contacts_tg_user_id_fkey,
+    ADD CONSTRAINT contacts_tg_user_id_fkey
+        FOREIGN KEY (tg_user_id) REFERENCES users (tg_user_id);
+
+-- +goose StatementEnd
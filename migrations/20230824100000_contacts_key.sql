@@ -0,0 +1,33 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- A contact is one per ID of its user. Of the copies made by the adds racing for an ID
+-- the latest one is kept, and the rows without a user or an ID are unreachable anyway.
+DELETE FROM contacts
+WHERE
+    tg_user_id IS NULL OR
+    contact_id IS NULL;
+
+DELETE FROM contacts a
+    USING contacts b
+WHERE
+    a.tg_user_id = b.tg_user_id AND
+    a.contact_id = b.contact_id AND
+    a.ctid < b.ctid;
+
+ALTER TABLE contacts
+    ADD PRIMARY KEY (tg_user_id, contact_id);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+ALTER TABLE contacts
+    DROP CONSTRAINT contacts_pkey;
+
+ALTER TABLE contacts
+    ALTER COLUMN tg_user_id DROP NOT NULL,
+    ALTER COLUMN contact_id DROP NOT NULL;
+
+-- +goose StatementEnd
@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- calendar_token is the SHA-256 of the secret in the link to the calendar feed now, like
+-- api_token. The links given out keep working.
+UPDATE users
+SET
+    calendar_token = encode(sha256(convert_to(calendar_token, 'UTF8')), 'hex')
+WHERE
+    calendar_token IS NOT NULL;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+-- The secrets cannot be got back from the hashes, the users make new links.
+UPDATE users
+SET
+    calendar_token = NULL;
+
+-- +goose StatementEnd
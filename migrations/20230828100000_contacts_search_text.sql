@@ -0,0 +1,62 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- search_text is the words of the name, the description and the values of the custom fields
+-- the way the bot splits the queries into them. The bot writes it, as the parser of Postgres
+-- keeps e.g. emails and links whole and would not find them by their parts.
+ALTER TABLE contacts
+    ADD COLUMN search_text TEXT NOT NULL DEFAULT '';
+
+-- The letters and the digits are the words for the bot too.
+UPDATE contacts
+SET
+    search_text = trim(regexp_replace(
+        lower(coalesce(name, '') || ' ' || coalesce(description, '') || ' ' || fields_text),
+        '[^[:alnum:]]+', ' ', 'g'
+    ));
+
+ALTER TABLE contacts
+    DROP COLUMN search;
+
+ALTER TABLE contacts
+    ADD COLUMN search tsvector GENERATED ALWAYS AS (to_tsvector('simple', search_text)) STORED;
+
+CREATE INDEX contacts_search_idx ON contacts USING GIN (search);
+
+ALTER TABLE contacts
+    DROP COLUMN fields_text;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+ALTER TABLE contacts
+    ADD COLUMN fields_text TEXT NOT NULL DEFAULT '';
+
+UPDATE contacts
+SET
+    fields_text = coalesce((
+        SELECT
+            string_agg(value, ' ' ORDER BY name COLLATE "C")
+        FROM
+            contact_fields
+        WHERE
+            contact_fields.tg_user_id = contacts.tg_user_id AND
+            contact_fields.contact_id = contacts.contact_id
+    ), '');
+
+ALTER TABLE contacts
+    DROP COLUMN search;
+
+ALTER TABLE contacts
+    ADD COLUMN search tsvector GENERATED ALWAYS AS (
+        to_tsvector('simple', coalesce(name, '') || ' ' || coalesce(description, '') || ' ' || fields_text)
+    ) STORED;
+
+CREATE INDEX contacts_search_idx ON contacts USING GIN (search);
+
+ALTER TABLE contacts
+    DROP COLUMN search_text;
+
+-- +goose StatementEnd